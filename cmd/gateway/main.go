@@ -6,17 +6,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/alerts"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/handlers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/health"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/logexport"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/postprocess"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/pricingsync"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/priority"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tracing"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/retry"
 )
 
 func main() {
@@ -27,13 +36,28 @@ func main() {
 	}
 
 	log.Printf("Starting LLM Gateway Starter on port %s (env: %s)", cfg.Port, cfg.Env)
+	log.Printf("Providers: %s", strings.Join(cfg.EnabledProviders(), ", "))
+	log.Printf("Features: %s", strings.Join(cfg.EnabledFeatures(), ", "))
 
 	// Setup context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(ctx, cfg.OTLPEndpoint, cfg.OTelServiceName)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	if cfg.OTLPEndpoint != "" {
+		log.Println("✓ Initialized OpenTelemetry tracing")
+	}
+
 	// Initialize database
-	db, err := database.New(cfg.DatabaseURL)
+	db, err := database.New(cfg.DatabaseURL, database.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
@@ -41,7 +65,17 @@ func main() {
 	log.Println("✓ Connected to PostgreSQL")
 
 	// Initialize Redis
-	redisClient, err := redis.New(ctx, cfg.RedisURL)
+	redisClient, err := redis.New(ctx, redis.Options{
+		Mode:             cfg.RedisMode,
+		URL:              cfg.RedisURL,
+		Addrs:            cfg.RedisAddrs,
+		MasterName:       cfg.RedisMasterName,
+		Username:         cfg.RedisUsername,
+		Password:         cfg.RedisPassword,
+		SentinelPassword: cfg.RedisSentinelPassword,
+		DB:               cfg.RedisDB,
+		TLS:              cfg.RedisTLS,
+	})
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
@@ -49,16 +83,109 @@ func main() {
 	log.Println("✓ Connected to Redis")
 
 	// Initialize provider manager
-	providerMgr := providers.NewManager(cfg)
+	providerMgr := providers.NewManager(cfg, redisClient)
 	log.Println("✓ Initialized LLM providers")
 
+	// Check failover chains, downgrades and pricing against the configured providers
+	if pricing, err := db.ListModelPricing(ctx); err != nil {
+		log.Printf("Skipping model validation: %v", err)
+	} else {
+		if len(pricing) == 0 {
+			log.Println("Warning: model_pricing is empty, so requests are logged at $0 and spend limits never trigger; run the migrations or set PRICING_SYNC_SOURCE")
+		}
+		report := providerMgr.ValidateModels(pricing)
+		for _, warning := range report.Warnings {
+			log.Printf("Model validation warning: %s", warning)
+		}
+		for _, problem := range report.Errors {
+			log.Printf("Model validation error: %s", problem)
+		}
+		if cfg.StrictModelValidation && len(report.Errors) > 0 {
+			log.Fatalf("Model validation failed with %d errors (STRICT_MODEL_VALIDATION=true)", len(report.Errors))
+		}
+	}
+
+	// Open provider connections in the background so startup isn't delayed
+	if cfg.ProviderWarmup {
+		go providerMgr.WarmUp(ctx)
+	}
+
+	// Initialize provider health checks
+	healthChecker := health.New(providerMgr.Providers(), cfg.HealthCheckInterval)
+	healthChecker.Start(ctx)
+
+	// Initialize log export to S3 (optional)
+	var logExporter *logexport.Exporter
+	if cfg.LogExportBucket != "" {
+		uploader := logexport.NewS3Uploader(cfg.LogExportEndpoint, cfg.LogExportBucket, cfg.LogExportRegion,
+			cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, cfg.AWSSessionToken)
+		logExporter = logexport.New(db, uploader, logexport.Config{
+			Prefix:      cfg.LogExportPrefix,
+			PageSize:    cfg.LogExportPageSize,
+			Retention:   cfg.LogExportRetention,
+			Interval:    cfg.LogExportInterval,
+			DeleteAfter: cfg.LogExportDelete,
+		})
+		logExporter.Start(ctx)
+		log.Printf("✓ Log export to s3://%s/%s enabled", cfg.LogExportBucket, cfg.LogExportPrefix)
+	}
+
+	// Initialize pricing sync (optional)
+	var pricingSyncer *pricingsync.Syncer
+	if cfg.PricingSyncSource != "" {
+		pricingSyncer = pricingsync.New(db, cfg.PricingSyncSource, cfg.PricingSyncInterval)
+		pricingSyncer.Start(ctx)
+		log.Printf("✓ Pricing sync from %s enabled", cfg.PricingSyncSource)
+	}
+
 	// Initialize cache
-	cacheService := cache.New(redisClient)
-	log.Println("✓ Initialized cache")
+	var cacheBackend cache.Backend = cache.NewRedisBackend(redisClient)
+	if cfg.CacheBackend == "memory" {
+		cacheBackend = cache.NewMemoryBackend(cfg.CacheMemoryMaxEntries)
+	}
+	cacheService := cache.New(cacheBackend)
+	log.Printf("✓ Initialized cache (%s)", cfg.CacheBackend)
+
+	// Initialize async request logging
+	logWriter := database.NewLogWriter(db, database.LogWriterConfig{
+		BufferSize:    cfg.LogBufferSize,
+		Workers:       cfg.LogWorkers,
+		BatchSize:     cfg.LogBatchSize,
+		FlushInterval: cfg.LogFlushInterval,
+		Retry:         retry.Policy{Retries: cfg.LogWriteRetries, Backoff: cfg.LogWriteRetryBackoff},
+		FailClosed:    cfg.LogWriteFailClosed,
+
+		SampleRate:         cfg.LogSampleRate,
+		CacheHitSampleRate: cfg.LogCacheHitSampleRate,
+		Totals:             redisClient,
+
+		LastUsedInterval: cfg.LastUsedInterval,
+		LastUsedGate:     redisClient,
+	})
+	log.Println("✓ Initialized request logging")
+
+	// Initialize alerting
+	alertNotifier := alerts.New(cfg.AlertWebhookURL, cfg.AlertDebounceInterval)
+	if alertNotifier.Enabled() {
+		log.Println("✓ Initialized alert webhook")
+	}
 
 	// Initialize handlers
-	chatHandler := handlers.NewChatHandler(providerMgr, cacheService, db)
-	middleware := handlers.NewMiddleware(db, redisClient)
+	// Provider worker pool with interactive-before-batch dispatch (nil = unbounded)
+	workerQueue := priority.New(cfg.PriorityWorkers, cfg.PriorityQueueSize)
+	if workerQueue != nil {
+		log.Printf("Priority queue enabled (%d workers, %d queued)", cfg.PriorityWorkers, cfg.PriorityQueueSize)
+	}
+
+	chatHandler := handlers.NewChatHandler(cfg, providerMgr, cacheService, db, logWriter, alertNotifier, workerQueue, postprocess.New(cfg.PostprocessTimeout))
+	batchHandler := handlers.NewBatchHandler(cfg, chatHandler, redisClient)
+	audioHandler := handlers.NewAudioHandler(cfg, providerMgr, db, logWriter)
+	healthHandler := handlers.NewHealthHandler(healthChecker)
+	statsHandler := handlers.NewStatsHandler(db, redisClient)
+	keysHandler := handlers.NewKeysHandler(redisClient)
+	conversationHandler := handlers.NewConversationHandler(db)
+	middleware := handlers.NewMiddleware(cfg, db, redisClient, logWriter)
+	adminHandler := handlers.NewAdminHandler(db, redisClient, middleware, logExporter, pricingSyncer)
 
 	// Setup router
 	r := chi.NewRouter()
@@ -66,8 +193,11 @@ func main() {
 	// Global middleware
 	r.Use(chimiddleware.Logger)
 	r.Use(chimiddleware.Recoverer)
-	r.Use(chimiddleware.Timeout(60 * time.Second))
+	r.Use(middleware.ClientIPMiddleware)
+	r.Use(middleware.RequestTimeoutMiddleware)
 	r.Use(middleware.CORSMiddleware)
+	r.Use(tracing.Middleware)
+	r.Use(middleware.CompressionMiddleware)
 
 	// Health check (no auth required)
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -75,20 +205,81 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Redis usage metrics (no auth required, like /health)
+	if cfg.RedisMetricsInterval > 0 {
+		metricsHandler := handlers.NewMetricsHandler(redisClient, cfg.RedisMetricsInterval)
+		metricsHandler.Start(ctx)
+		r.Get("/metrics", metricsHandler.HandleMetrics)
+	}
+
 	// API routes (with auth and rate limiting)
+	keyed := chi.Chain(
+		middleware.AuthMiddleware,
+		middleware.RetryBudgetMiddleware,
+		middleware.RateLimitMiddleware,
+		middleware.ConcurrencyMiddleware,
+		middleware.UpstreamHeadersMiddleware,
+	)
 	r.Route("/v1", func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
-		r.Use(middleware.RateLimitMiddleware)
+		r.Use(middleware.LogHealthMiddleware)
+
+		// Maintenance fails these fast, before the key lookup and rate limits
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.MaintenanceMiddleware)
+			r.Use(middleware.IPRateLimitMiddleware)
+			r.Use(keyed...)
+
+			r.Post("/chat/completions", chatHandler.HandleChatCompletion)
+			r.Post("/chat/completions/batch", batchHandler.HandleBatchChatCompletion)
+			r.Post("/responses", chatHandler.HandleResponses)
+			r.Post("/audio/transcriptions", audioHandler.HandleTranscription)
 
-		r.Post("/chat/completions", chatHandler.HandleChatCompletion)
+			// Cache warming fills the bearer key's cache, but the request
+			// must also be signed as an admin request
+			if cfg.AdminSigningSecret != "" {
+				r.With(middleware.AdminSignatureMiddleware).Post("/cache/warm", batchHandler.HandleWarmCache)
+			}
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.IPRateLimitMiddleware)
+			r.Use(keyed...)
+
+			r.Get("/capabilities", chatHandler.HandleCapabilities)
+			r.Get("/quote", chatHandler.HandleQuote)
+			r.Post("/quote", chatHandler.HandleQuote)
+			r.Get("/health/providers", healthHandler.HandleProviderHealth)
+			r.Get("/keys/me", keysHandler.HandleKeyInfo)
+			r.Get("/stats/latency", statsHandler.HandleKeyLatencyStats)
+			r.Post("/conversations", conversationHandler.HandleCreateConversation)
+			r.Get("/conversations/{id}", conversationHandler.HandleGetConversation)
+		})
 	})
 
+	// Admin routes (HMAC-signed, only when ADMIN_SIGNING_SECRET is set)
+	if cfg.AdminSigningSecret != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.IPRateLimitMiddleware)
+			r.Use(middleware.AdminSignatureMiddleware)
+
+			r.Post("/keys/{id}/revoke", adminHandler.HandleRevokeKey)
+			r.Put("/maintenance", adminHandler.HandleSetMaintenance)
+			r.Post("/logs/export", adminHandler.HandleExportLogs)
+			r.Post("/pricing/sync", adminHandler.HandleSyncPricing)
+			r.Get("/redis", adminHandler.HandleRedisUsage)
+			r.Post("/redis/{namespace}/purge", adminHandler.HandlePurgeNamespace)
+			r.Get("/stats/latency", statsHandler.HandleLatencyStats)
+			r.Get("/stats/errors", statsHandler.HandleErrorStats)
+			r.Get("/stats/totals", statsHandler.HandleTotals)
+		})
+	}
+
 	// HTTP server
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
 		Handler:      r,
 		ReadTimeout:  60 * time.Second,
-		WriteTimeout: 60 * time.Second,
+		WriteTimeout: cfg.RequestTimeoutMax + 5*time.Second, // per-request deadlines are enforced by middleware
 		IdleTimeout:  120 * time.Second,
 	}
 
@@ -96,7 +287,30 @@ func main() {
 	go func() {
 		log.Printf("🚀 Server listening on http://localhost:%s", cfg.Port)
 		log.Println("   POST /v1/chat/completions - Chat completions (OpenAI-compatible)")
+		log.Println("   POST /v1/chat/completions/batch - Batched chat completions")
+		log.Println("   POST /v1/responses        - Chat completions in OpenAI Responses API shape")
+		log.Println("   POST /v1/audio/transcriptions - Audio transcription (OpenAI)")
+		log.Println("   GET  /v1/capabilities     - Supported features per provider")
+		log.Println("   POST /v1/quote            - Estimated cost of a request on each equivalent model")
+		log.Println("   GET  /v1/health/providers - Provider health status")
+		log.Println("   GET  /v1/keys/me          - Limits and live usage for the calling key")
+		log.Println("   GET  /v1/stats/latency    - Latency percentiles for the calling key's requests")
+		log.Println("   POST /v1/conversations    - Start a server-side conversation")
+		log.Println("   GET  /v1/conversations/{id} - Messages in a conversation")
 		log.Println("   GET  /health              - Health check")
+		if cfg.RedisMetricsInterval > 0 {
+			log.Println("   GET  /metrics             - Redis usage per namespace (Prometheus)")
+		}
+		if cfg.AdminSigningSecret != "" {
+			log.Println("   POST /admin/keys/{id}/revoke - Revoke an API key (signed)")
+			log.Println("   PUT  /admin/maintenance      - Toggle maintenance mode (signed)")
+			log.Println("   POST /admin/logs/export      - Export old logs to S3 (signed)")
+			log.Println("   POST /admin/pricing/sync     - Sync model pricing from the source (signed)")
+			log.Println("   GET  /admin/stats/latency    - Latency percentiles across every key (signed)")
+			log.Println("   GET  /admin/stats/errors     - Failed requests by error type (signed)")
+			log.Println("   GET  /admin/stats/totals     - Gateway-wide daily request totals (signed)")
+			log.Println("   POST /v1/cache/warm       - Pre-fill the bearer key's cache (API key and admin signature)")
+		}
 		log.Println("")
 		log.Println("Ready to accept requests!")
 
@@ -120,5 +334,13 @@ func main() {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
+	// Drain buffered request logs before the database closes
+	logWriter.Close()
+
+	// Flush pending spans
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Tracing shutdown error: %v", err)
+	}
+
 	log.Println("Server stopped")
 }
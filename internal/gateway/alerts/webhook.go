@@ -0,0 +1,120 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventFailover      = "failover"
+	EventProviderError = "provider_error"
+)
+
+// Event is the JSON payload POSTed to the webhook
+type Event struct {
+	Type           string    `json:"type"`
+	Model          string    `json:"model"`
+	Provider       string    `json:"provider,omitempty"`
+	ServedModel    string    `json:"served_model,omitempty"`
+	ServedProvider string    `json:"served_provider,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// Notifier sends alert events to a webhook, debounced per event type and model
+type Notifier struct {
+	url         string
+	minInterval time.Duration
+	httpClient  *http.Client
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// New creates a new webhook notifier. An empty URL disables notifications.
+func New(url string, minInterval time.Duration) *Notifier {
+	return &Notifier{
+		url:         url,
+		minInterval: minInterval,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Enabled reports whether a webhook URL is configured
+func (n *Notifier) Enabled() bool {
+	return n.url != ""
+}
+
+// Notify sends an event asynchronously unless an identical event type for the
+// same model was sent within the debounce interval
+func (n *Notifier) Notify(event Event) {
+	if !n.Enabled() {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	if !n.allow(event.Type + ":" + event.Model) {
+		return
+	}
+
+	go func() {
+		if err := n.send(event); err != nil {
+			log.Printf("Failed to send %s alert webhook: %v", event.Type, err)
+		}
+	}()
+}
+
+// allow checks and records the debounce window for a key
+func (n *Notifier) allow(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := n.lastSent[key]; ok && now.Sub(last) < n.minInterval {
+		return false
+	}
+	n.lastSent[key] = now
+	return true
+}
+
+// send POSTs the event to the webhook
+func (n *Notifier) send(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// webhookReceiver collects the JSON payloads POSTed to it
+func webhookReceiver(t *testing.T) (*httptest.Server, chan map[string]interface{}) {
+	t.Helper()
+	received := make(chan map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func TestFailoverEventPayload(t *testing.T) {
+	srv, received := webhookReceiver(t)
+	n := New(srv.URL, time.Minute)
+
+	n.Notify(Event{
+		Type:           EventFailover,
+		Model:          "gpt-4o",
+		Provider:       "openai",
+		ServedModel:    "claude-sonnet-4-5-20250929",
+		ServedProvider: "anthropic",
+	})
+
+	select {
+	case payload := <-received:
+		for field, want := range map[string]interface{}{
+			"type":            "failover",
+			"model":           "gpt-4o",
+			"provider":        "openai",
+			"served_model":    "claude-sonnet-4-5-20250929",
+			"served_provider": "anthropic",
+		} {
+			if payload[field] != want {
+				t.Errorf("%s = %v, want %v", field, payload[field], want)
+			}
+		}
+		if _, ok := payload["error"]; ok {
+			t.Errorf("failover payload has an error: %v", payload["error"])
+		}
+		if ts, _ := payload["timestamp"].(string); ts == "" {
+			t.Error("payload has no timestamp")
+		} else if _, err := time.Parse(time.RFC3339, ts); err != nil {
+			t.Errorf("timestamp %q: %v", ts, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no webhook received")
+	}
+}
+
+func TestNotifyDebouncesPerTypeAndModel(t *testing.T) {
+	srv, received := webhookReceiver(t)
+	n := New(srv.URL, time.Minute)
+
+	n.Notify(Event{Type: EventFailover, Model: "gpt-4o"})
+	n.Notify(Event{Type: EventFailover, Model: "gpt-4o"})
+	n.Notify(Event{Type: EventProviderError, Model: "gpt-4o", Error: "boom"})
+	n.Notify(Event{Type: EventFailover, Model: "gpt-4o-mini"})
+
+	seen := map[string]int{}
+	for i := 0; i < 3; i++ {
+		select {
+		case payload := <-received:
+			seen[payload["type"].(string)+":"+payload["model"].(string)]++
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 webhooks, got %v", seen)
+		}
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("debounced event sent: %v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if seen["failover:gpt-4o"] != 1 || seen["provider_error:gpt-4o"] != 1 || seen["failover:gpt-4o-mini"] != 1 {
+		t.Errorf("unexpected webhooks %v", seen)
+	}
+}
+
+func TestNotifyWithoutURLIsDisabled(t *testing.T) {
+	n := New("", time.Minute)
+	if n.Enabled() {
+		t.Error("expected a notifier without a URL to be disabled")
+	}
+	n.Notify(Event{Type: EventFailover, Model: "gpt-4o"})
+}
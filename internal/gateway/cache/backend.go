@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// Backend stores serialized cache entries
+type Backend interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Locker is implemented by backends that can coordinate cache fills, so only
+// one caller computes a missing entry at a time
+type Locker interface {
+	AcquireLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	ReleaseLock(ctx context.Context, key string, token string) error
+	LockHeld(ctx context.Context, key string) (bool, error)
+}
+
+// RedisBackend stores cache entries in Redis
+type RedisBackend struct {
+	redis *redis.Client
+}
+
+// NewRedisBackend creates a Redis-backed cache backend
+func NewRedisBackend(redisClient *redis.Client) *RedisBackend {
+	return &RedisBackend{redis: redisClient}
+}
+
+// Get retrieves a value by key
+func (b *RedisBackend) Get(ctx context.Context, key string) (string, error) {
+	return b.redis.Get(ctx, key)
+}
+
+// Set stores a value with TTL
+func (b *RedisBackend) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return b.redis.Set(ctx, key, value, ttl)
+}
+
+// Delete removes a key
+func (b *RedisBackend) Delete(ctx context.Context, key string) error {
+	return b.redis.Del(ctx, key)
+}
+
+// AcquireLock takes a lock across all gateway instances
+func (b *RedisBackend) AcquireLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return b.redis.AcquireLock(ctx, key, token, ttl)
+}
+
+// ReleaseLock releases a lock taken with AcquireLock
+func (b *RedisBackend) ReleaseLock(ctx context.Context, key string, token string) error {
+	return b.redis.ReleaseLock(ctx, key, token)
+}
+
+// LockHeld reports whether anyone holds a lock
+func (b *RedisBackend) LockHeld(ctx context.Context, key string) (bool, error) {
+	return b.redis.Exists(ctx, key)
+}
@@ -2,46 +2,157 @@ package cache
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
-	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+	"github.com/sashabaranov/go-openai"
 )
 
 type Cache struct {
-	redis *redis.Client
+	backend Backend
 }
 
-// New creates a new cache instance
-func New(redisClient *redis.Client) *Cache {
-	return &Cache{redis: redisClient}
+// New creates a new cache instance on top of a storage backend
+func New(backend Backend) *Cache {
+	return &Cache{backend: backend}
+}
+
+// cacheKeyFields are the request fields that affect the model's output. Pointers
+// and maps are encoded by value (map keys sorted), so equal requests always hash
+// the same. New output-affecting request fields must be added here.
+type cacheKeyFields struct {
+	Model       string                         `json:"model"`
+	Messages    []openai.ChatCompletionMessage `json:"messages"`
+	Temperature *float32                       `json:"temperature"`
+	TopP        *float32                       `json:"top_p"`
+	MaxTokens   *int                           `json:"max_tokens"`
+	LogitBias   map[string]int                 `json:"logit_bias"`
+	Seed        *int                           `json:"seed"`
+	Reasoning   string                         `json:"reasoning_effort"`
+	Thinking    *providers.ThinkingConfig      `json:"thinking"`
+	Stop        []string                       `json:"stop,omitempty"`
+	Tools       []openai.Tool                  `json:"tools,omitempty"`
+	ToolChoice  interface{}                    `json:"tool_choice,omitempty"`
+
+	ResponseFormat *providers.ResponseFormat `json:"response_format"`
+	AutoContinue   bool                      `json:"auto_continue,omitempty"`
+	SafetySettings []providers.SafetySetting `json:"safety_settings,omitempty"`
+
+	// Normalized messages get their own slots, so a key without normalization
+	// never gets a reply cached for a differently spaced or cased prompt
+	Normalization *providers.CacheNormalization `json:"normalization,omitempty"`
+
+	// A client-chosen key stands in for the messages
+	ClientKey string `json:"cache_key,omitempty"`
+	Scope     string `json:"scope,omitempty"`
 }
 
 // generateCacheKey generates a hash of the request for caching
 func (c *Cache) generateCacheKey(req providers.ChatRequest) string {
-	// Create a deterministic key from the request
-	keyData := fmt.Sprintf("%s:%v:%v:%v:%v",
-		req.Model,
-		req.Messages,
-		req.Temperature,
-		req.MaxTokens,
-		req.TopP,
-	)
-
-	hash := sha256.Sum256([]byte(keyData))
+	// max_completion_tokens is an alias - key on whichever was sent
+	maxTokens := req.MaxTokens
+	if maxTokens == nil {
+		maxTokens = req.MaxCompletionTokens
+	}
+	logitBias := req.LogitBias
+	if len(logitBias) == 0 {
+		logitBias = nil
+	}
+
+	messages := normalizeMessages(req.Messages, req.CacheNormalization)
+	var norm *providers.CacheNormalization
+	if req.CacheNormalization.Whitespace || req.CacheNormalization.Lowercase {
+		norm = &req.CacheNormalization
+	}
+	if req.CacheKey != "" {
+		messages, norm = nil, nil
+	}
+
+	keyData, err := json.Marshal(cacheKeyFields{
+		Model:       req.Model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   maxTokens,
+		LogitBias:   logitBias,
+		Seed:        req.Seed,
+		Reasoning:   req.ReasoningEffort,
+		Thinking:    req.Thinking,
+		Stop:        req.Stop,
+		Tools:       req.Tools,
+		ToolChoice:  req.ToolChoice,
+
+		ResponseFormat: req.ResponseFormat,
+		AutoContinue:   req.AutoContinue,
+		SafetySettings: req.SafetySettings,
+		Normalization:  norm,
+
+		ClientKey: req.CacheKey,
+		Scope:     req.CacheKeyScope,
+	})
+	if err != nil {
+		// Only messages with both content and multi-content fail to encode, which a
+		// decoded request can't have; fall back to a key that simply won't be shared
+		keyData = []byte(fmt.Sprintf("%#v", req))
+	}
+
+	hash := sha256.Sum256(keyData)
 	return "cache:exact:" + hex.EncodeToString(hash[:])
 }
 
+// normalizeMessages returns messages with their text normalized for the cache
+// key. Text containing a code fence is left alone, as whitespace and case are
+// significant in code.
+func normalizeMessages(messages []openai.ChatCompletionMessage, norm providers.CacheNormalization) []openai.ChatCompletionMessage {
+	if !norm.Whitespace && !norm.Lowercase {
+		return messages
+	}
+
+	normalized := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		msg.Content = normalizeText(msg.Content, norm)
+		if len(msg.MultiContent) > 0 {
+			parts := make([]openai.ChatMessagePart, len(msg.MultiContent))
+			for j, part := range msg.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					part.Text = normalizeText(part.Text, norm)
+				}
+				parts[j] = part
+			}
+			msg.MultiContent = parts
+		}
+		normalized[i] = msg
+	}
+	return normalized
+}
+
+// normalizeText applies norm to text, unless it contains code
+func normalizeText(text string, norm providers.CacheNormalization) string {
+	if strings.Contains(text, "```") {
+		return text
+	}
+	if norm.Whitespace {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	if norm.Lowercase {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
 // Get retrieves a cached response
 func (c *Cache) Get(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
 	key := c.generateCacheKey(req)
 
-	// Get from Redis
-	val, err := c.redis.Get(ctx, key)
+	// Get from the backend
+	val, err := c.backend.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +176,97 @@ func (c *Cache) Set(ctx context.Context, req providers.ChatRequest, resp *provid
 		return fmt.Errorf("failed to serialize response: %w", err)
 	}
 
-	// Store in Redis
-	return c.redis.Set(ctx, key, string(data), ttl)
+	// Store in the backend
+	return c.backend.Set(ctx, key, string(data), ttl)
+}
+
+// fillLockTTL bounds how long a crashed or stuck fill can hold the lock
+const fillLockTTL = 60 * time.Second
+
+// fillPollInterval is how often waiters re-check the cache while a fill is in progress
+const fillPollInterval = 100 * time.Millisecond
+
+// AcquireFill tries to become the single caller that computes and stores a missing
+// entry. Returns a release function and true if acquired; if another caller holds
+// the fill, returns false and the caller should WaitForFill. Backends without
+// locking always grant the fill.
+func (c *Cache) AcquireFill(ctx context.Context, req providers.ChatRequest) (func(), bool) {
+	locker, ok := c.backend.(Locker)
+	if !ok {
+		return func() {}, true
+	}
+
+	lockKey := fillLockKey(c.generateCacheKey(req))
+	token := newLockToken()
+
+	acquired, err := locker.AcquireLock(ctx, lockKey, token, fillLockTTL)
+	if err != nil {
+		// Locking is an optimization - on backend errors, just let the caller through
+		return func() {}, true
+	}
+	if !acquired {
+		return func() {}, false
+	}
+
+	return func() {
+		locker.ReleaseLock(context.Background(), lockKey, token)
+	}, true
+}
+
+// errFillAbandoned is returned to waiters when the fill holder let go of the
+// lock without storing a response, e.g. because its provider call failed
+var errFillAbandoned = errors.New("cache fill abandoned")
+
+// fillLockKey names the lock guarding the fill of the entry at key
+func fillLockKey(key string) string {
+	return key + ":lock"
+}
+
+// WaitForFill polls the cache until another caller's fill lands, the holder
+// gives up the fill without storing anything, or timeout passes
+func (c *Cache) WaitForFill(ctx context.Context, req providers.ChatRequest, timeout time.Duration) (*providers.ChatResponse, error) {
+	locker, _ := c.backend.(Locker)
+	lockKey := fillLockKey(c.generateCacheKey(req))
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(fillPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			return nil, fmt.Errorf("timed out waiting for cache fill")
+		case <-ticker.C:
+			if resp, err := c.Get(ctx, req); err == nil {
+				return resp, nil
+			}
+			if locker == nil {
+				continue
+			}
+			// The lock is released after the response is stored, so check the cache
+			// once more before giving up on a fill that's gone
+			if held, err := locker.LockHeld(ctx, lockKey); err == nil && !held {
+				if resp, err := c.Get(ctx, req); err == nil {
+					return resp, nil
+				}
+				return nil, errFillAbandoned
+			}
+		}
+	}
+}
+
+// newLockToken returns a random token identifying a lock holder
+func newLockToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Delete removes a cached response
+func (c *Cache) Delete(ctx context.Context, req providers.ChatRequest) error {
+	return c.backend.Delete(ctx, c.generateCacheKey(req))
 }
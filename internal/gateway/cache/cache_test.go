@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+func baseRequest() providers.ChatRequest {
+	return providers.ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Weather in Paris?"}},
+	}
+}
+
+func weatherTool(name string) openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:       name,
+			Parameters: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+		},
+	}
+}
+
+func TestCacheKeyDistinguishesOutputAffectingFields(t *testing.T) {
+	c := New(NewMemoryBackend(0))
+	base := c.generateCacheKey(baseRequest())
+
+	for name, mutate := range map[string]func(*providers.ChatRequest){
+		"tools":       func(r *providers.ChatRequest) { r.Tools = []openai.Tool{weatherTool("get_weather")} },
+		"tool_choice": func(r *providers.ChatRequest) { r.ToolChoice = "none" },
+		"stop":        func(r *providers.ChatRequest) { r.Stop = providers.StopSequences{"\n"} },
+		"seed":        func(r *providers.ChatRequest) { seed := 1; r.Seed = &seed },
+		"safety_settings": func(r *providers.ChatRequest) {
+			r.SafetySettings = []providers.SafetySetting{{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_NONE"}}
+		},
+		"reasoning_effort":   func(r *providers.ChatRequest) { r.ReasoningEffort = "high" },
+		"cache_key_scope":    func(r *providers.ChatRequest) { r.CacheKey = "k"; r.CacheKeyScope = "key-1" },
+		"different messages": func(r *providers.ChatRequest) { r.Messages[0].Content = "Weather in Rome?" },
+	} {
+		req := baseRequest()
+		mutate(&req)
+		if c.generateCacheKey(req) == base {
+			t.Errorf("%s: request shares the cache key of one without it", name)
+		}
+	}
+}
+
+func TestCacheKeyToolVariantsDontCollide(t *testing.T) {
+	c := New(NewMemoryBackend(0))
+	keys := make(map[string]string)
+
+	for name, mutate := range map[string]func(*providers.ChatRequest){
+		"weather tool":  func(r *providers.ChatRequest) { r.Tools = []openai.Tool{weatherTool("get_weather")} },
+		"forecast tool": func(r *providers.ChatRequest) { r.Tools = []openai.Tool{weatherTool("get_forecast")} },
+		"both tools": func(r *providers.ChatRequest) {
+			r.Tools = []openai.Tool{weatherTool("get_weather"), weatherTool("get_forecast")}
+		},
+		"required": func(r *providers.ChatRequest) {
+			r.Tools = []openai.Tool{weatherTool("get_weather")}
+			r.ToolChoice = "required"
+		},
+		"named function": func(r *providers.ChatRequest) {
+			r.Tools = []openai.Tool{weatherTool("get_weather")}
+			r.ToolChoice = map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}}
+		},
+		"stop newline": func(r *providers.ChatRequest) { r.Stop = providers.StopSequences{"\n"} },
+		"stop END":     func(r *providers.ChatRequest) { r.Stop = providers.StopSequences{"END"} },
+		"stop both":    func(r *providers.ChatRequest) { r.Stop = providers.StopSequences{"\n", "END"} },
+	} {
+		req := baseRequest()
+		mutate(&req)
+		key := c.generateCacheKey(req)
+		if other, ok := keys[key]; ok {
+			t.Errorf("%s and %s share a cache key", name, other)
+		}
+		keys[key] = name
+	}
+}
+
+func TestCacheKeyStableForEqualRequests(t *testing.T) {
+	c := New(NewMemoryBackend(0))
+
+	var fromString, fromArray providers.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"gpt-4o","stop":"END","tools":[{"type":"function","function":{"name":"f","parameters":{}}}],"tool_choice":{"type":"function","function":{"name":"f"}}}`), &fromString); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"tool_choice":{"function":{"name":"f"},"type":"function"},"tools":[{"type":"function","function":{"name":"f","parameters":{}}}],"stop":["END"],"model":"gpt-4o"}`), &fromArray); err != nil {
+		t.Fatal(err)
+	}
+	if c.generateCacheKey(fromString) != c.generateCacheKey(fromArray) {
+		t.Error("equal requests hash differently")
+	}
+}
+
+func TestCacheMissesAcrossToolsAndStop(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+
+	plain := baseRequest()
+	resp := &providers.ChatResponse{ID: "plain", Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "Sunny"}}}}
+	if err := c.Set(ctx, plain, resp, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	withTools := baseRequest()
+	withTools.Tools = []openai.Tool{weatherTool("get_weather")}
+	if got, err := c.Get(ctx, withTools); err == nil && got != nil {
+		t.Errorf("request with tools got the cached reply of one without: %+v", got)
+	}
+
+	withStop := baseRequest()
+	withStop.Stop = providers.StopSequences{"Sun"}
+	if got, err := c.Get(ctx, withStop); err == nil && got != nil {
+		t.Errorf("request with stop got the cached reply of one without: %+v", got)
+	}
+
+	if got, err := c.Get(ctx, plain); err != nil || got == nil || got.ID != "plain" {
+		t.Errorf("expected a hit for the original request, got %+v, %v", got, err)
+	}
+}
+
+func TestSeededRequestsHitOnlyTheSameSeed(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+	seeded := func(seed int) providers.ChatRequest {
+		req := baseRequest()
+		req.Seed = &seed
+		return req
+	}
+
+	resp := &providers.ChatResponse{ID: "seed-42", SystemFingerprint: "fp_44709d6fcb"}
+	if err := c.Set(ctx, seeded(42), resp, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(ctx, seeded(42))
+	if err != nil || got == nil || got.ID != "seed-42" {
+		t.Fatalf("expected a hit for the same seed, got %+v, %v", got, err)
+	}
+	if got.SystemFingerprint != "fp_44709d6fcb" {
+		t.Errorf("system_fingerprint lost in the cache: %q", got.SystemFingerprint)
+	}
+	for name, req := range map[string]providers.ChatRequest{"another seed": seeded(7), "no seed": baseRequest()} {
+		if got, err := c.Get(ctx, req); err == nil && got != nil {
+			t.Errorf("%s got the reply cached under seed 42", name)
+		}
+	}
+}
+
+func TestNormalizedPromptsShareACacheSlot(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+	prompt := func(content string, norm providers.CacheNormalization) providers.ChatRequest {
+		return providers.ChatRequest{
+			Model:              "gpt-4o",
+			Messages:           []openai.ChatCompletionMessage{{Role: "user", Content: content}},
+			CacheNormalization: norm,
+		}
+	}
+	both := providers.CacheNormalization{Whitespace: true, Lowercase: true}
+
+	resp := &providers.ChatResponse{ID: "paris"}
+	if err := c.Set(ctx, prompt("What is the capital of France?", both), resp, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, variant := range []string{"  What is the capital of France?\n", "what is  the\tcapital of france?", "WHAT IS THE CAPITAL OF FRANCE?"} {
+		if got, err := c.Get(ctx, prompt(variant, both)); err != nil || got == nil || got.ID != "paris" {
+			t.Errorf("%q: expected the normalized prompt to hit, got %+v, %v", variant, got, err)
+		}
+		// Without normalization, the same variant is a different request
+		if got, err := c.Get(ctx, prompt(variant, providers.CacheNormalization{})); err == nil && got != nil {
+			t.Errorf("%q: hit without normalization enabled", variant)
+		}
+	}
+
+	// Each option only covers its own difference
+	spaceOnly := providers.CacheNormalization{Whitespace: true}
+	if c.generateCacheKey(prompt(" Hello  world ", spaceOnly)) != c.generateCacheKey(prompt("Hello world", spaceOnly)) {
+		t.Error("whitespace normalization should ignore extra spaces")
+	}
+	if c.generateCacheKey(prompt("Hello world", spaceOnly)) == c.generateCacheKey(prompt("hello world", spaceOnly)) {
+		t.Error("whitespace normalization shouldn't ignore case")
+	}
+
+	// Multi-part text is normalized too
+	multi := func(text string) providers.ChatRequest {
+		req := prompt("", both)
+		req.Messages[0].MultiContent = []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}
+		return req
+	}
+	if c.generateCacheKey(multi("Describe  this ")) != c.generateCacheKey(multi("describe this")) {
+		t.Error("multi-part text wasn't normalized")
+	}
+}
+
+func TestNormalizedAndPlainKeysDontShareASlot(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+	prompt := func(content string, norm providers.CacheNormalization) providers.ChatRequest {
+		return providers.ChatRequest{
+			Model:              "gpt-4o",
+			Messages:           []openai.ChatCompletionMessage{{Role: "user", Content: content}},
+			CacheNormalization: norm,
+		}
+	}
+	both := providers.CacheNormalization{Whitespace: true, Lowercase: true}
+
+	// An opted-in key caches the reply to "WHAT IS 2+2?" under the normalized text
+	if err := c.Set(ctx, prompt("WHAT IS 2+2?", both), &providers.ChatResponse{ID: "shouted"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// A key without normalization sending the normalized text verbatim must miss
+	if got, err := c.Get(ctx, prompt("what is 2+2?", providers.CacheNormalization{})); err == nil && got != nil {
+		t.Errorf("plain key got the reply cached by a normalizing key: %+v", got)
+	}
+	if c.generateCacheKey(prompt("hello world", both)) == c.generateCacheKey(prompt("hello world", providers.CacheNormalization{Lowercase: true})) {
+		t.Error("different normalization options should key separately")
+	}
+}
+
+func TestNormalizationLeavesCodeAlone(t *testing.T) {
+	c := New(NewMemoryBackend(0))
+	both := providers.CacheNormalization{Whitespace: true, Lowercase: true}
+	code := func(content string) providers.ChatRequest {
+		return providers.ChatRequest{
+			Model:              "gpt-4o",
+			Messages:           []openai.ChatCompletionMessage{{Role: "user", Content: content}},
+			CacheNormalization: both,
+		}
+	}
+
+	// Indentation and case are significant in code
+	if c.generateCacheKey(code("Fix this:\n```python\nif x:\n    return X\n```")) == c.generateCacheKey(code("Fix this:\n```python\nif x:\nreturn x\n```")) {
+		t.Error("prompts with code shouldn't be normalized")
+	}
+}
+
+func TestClientCacheKeyReplacesTheContentHash(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+	keyed := func(content, cacheKey, scope string) providers.ChatRequest {
+		req := baseRequest()
+		req.Messages[0].Content = content
+		req.CacheKey, req.CacheKeyScope = cacheKey, scope
+		return req
+	}
+
+	if err := c.Set(ctx, keyed("Refund policy for order 1?", "faq:refunds", "key-1"), &providers.ChatResponse{ID: "refunds"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Get(ctx, keyed("Refund policy for order 2?", "faq:refunds", "key-1")); err != nil || got == nil || got.ID != "refunds" {
+		t.Errorf("expected a shared cache_key to hit, got %+v, %v", got, err)
+	}
+	for name, req := range map[string]providers.ChatRequest{
+		"another cache_key": keyed("Refund policy for order 1?", "faq:shipping", "key-1"),
+		"another API key":   keyed("Refund policy for order 1?", "faq:refunds", "key-2"),
+		"no cache_key":      keyed("Refund policy for order 1?", "", ""),
+	} {
+		if got, err := c.Get(ctx, req); err == nil && got != nil {
+			t.Errorf("%s got the faq:refunds entry", name)
+		}
+	}
+
+	// Parameters still separate entries under one cache_key
+	hot := keyed("Refund policy for order 1?", "faq:refunds", "key-1")
+	temperature := float32(1.5)
+	hot.Temperature = &temperature
+	if got, err := c.Get(ctx, hot); err == nil && got != nil {
+		t.Error("a different temperature got the faq:refunds entry")
+	}
+}
+
+func TestWaitForFillEndsWhenTheHolderGivesUp(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryBackend(0))
+	release, acquired := c.AcquireFill(ctx, baseRequest())
+	if !acquired {
+		t.Fatal("expected to take the fill lock")
+	}
+
+	// The holder's call fails, so it releases the lock without storing anything
+	time.AfterFunc(50*time.Millisecond, release)
+	start := time.Now()
+	if _, err := c.WaitForFill(ctx, baseRequest(), 5*time.Second); !errors.Is(err, errFillAbandoned) {
+		t.Errorf("expected the abandoned fill reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the wait to end with the lock, took %s", elapsed)
+	}
+
+	// A fill that lands before the lock goes is still returned
+	release, _ = c.AcquireFill(ctx, baseRequest())
+	time.AfterFunc(50*time.Millisecond, func() {
+		c.Set(ctx, baseRequest(), &providers.ChatResponse{ID: "filled"}, time.Minute)
+		release()
+	})
+	if got, err := c.WaitForFill(ctx, baseRequest(), 5*time.Second); err != nil || got.ID != "filled" {
+		t.Errorf("expected the fill, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryBackend is an in-process LRU cache bounded by entry count, with per-entry TTL.
+// Entries are not shared between gateway instances.
+type MemoryBackend struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+	locks   map[string]memoryLock
+}
+
+// memoryLock is a fill lock held by token until expiresAt
+type memoryLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// memoryEntry is a single cached value
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time // zero = no expiry
+}
+
+// NewMemoryBackend creates an in-memory backend holding at most maxEntries
+func NewMemoryBackend(maxEntries int) *MemoryBackend {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &MemoryBackend{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		locks:      make(map[string]memoryLock),
+	}
+}
+
+// Get retrieves a value by key, dropping it if expired
+func (b *MemoryBackend) Get(ctx context.Context, key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elem, ok := b.entries[key]
+	if !ok {
+		return "", fmt.Errorf("key not found")
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		b.removeElement(elem)
+		return "", fmt.Errorf("key not found")
+	}
+
+	b.order.MoveToFront(elem)
+	return entry.value, nil
+}
+
+// Set stores a value with TTL, evicting the least recently used entries when full
+func (b *MemoryBackend) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if elem, ok := b.entries[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		b.order.MoveToFront(elem)
+		return nil
+	}
+
+	b.entries[key] = b.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for b.order.Len() > b.maxEntries {
+		b.removeElement(b.order.Back())
+	}
+	return nil
+}
+
+// Delete removes a key
+func (b *MemoryBackend) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elem, ok := b.entries[key]; ok {
+		b.removeElement(elem)
+	}
+	return nil
+}
+
+// AcquireLock takes an in-process lock held until ttl expires or ReleaseLock is called
+func (b *MemoryBackend) AcquireLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lock, ok := b.locks[key]; ok && time.Now().Before(lock.expiresAt) {
+		return false, nil
+	}
+	b.locks[key] = memoryLock{token: token, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLock releases a lock if it's still held with token
+func (b *MemoryBackend) ReleaseLock(ctx context.Context, key string, token string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lock, ok := b.locks[key]; ok && lock.token == token {
+		delete(b.locks, key)
+	}
+	return nil
+}
+
+// LockHeld reports whether anyone holds an unexpired lock
+func (b *MemoryBackend) LockHeld(ctx context.Context, key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lock, ok := b.locks[key]
+	return ok && time.Now().Before(lock.expiresAt), nil
+}
+
+// Len returns the number of stored entries, including any not yet expired lazily
+func (b *MemoryBackend) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.order.Len()
+}
+
+// removeElement drops an entry; callers must hold mu
+func (b *MemoryBackend) removeElement(elem *list.Element) {
+	b.order.Remove(elem)
+	delete(b.entries, elem.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(10)
+	b.Set(ctx, "short", "a", 20*time.Millisecond)
+	b.Set(ctx, "long", "b", time.Hour)
+	b.Set(ctx, "forever", "c", 0)
+
+	if got, err := b.Get(ctx, "short"); err != nil || got != "a" {
+		t.Fatalf("expected a hit before the TTL, got %q, %v", got, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := b.Get(ctx, "short"); err == nil {
+		t.Error("expected the entry to expire after its TTL")
+	}
+	for key, want := range map[string]string{"long": "b", "forever": "c"} {
+		if got, err := b.Get(ctx, key); err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q, %v", key, want, got, err)
+		}
+	}
+	if b.Len() != 2 {
+		t.Errorf("expected the expired entry dropped, %d entries left", b.Len())
+	}
+
+	// Setting an entry again restarts its TTL
+	b.Set(ctx, "short", "a", 100*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	b.Set(ctx, "short", "a2", 100*time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if got, err := b.Get(ctx, "short"); err != nil || got != "a2" {
+		t.Errorf("expected the refreshed entry, got %q, %v", got, err)
+	}
+}
+
+func TestMemoryBackendEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(3)
+	for _, key := range []string{"a", "b", "c"} {
+		b.Set(ctx, key, key, time.Hour)
+	}
+
+	// Reading a and rewriting b leaves c the least recently used
+	b.Get(ctx, "a")
+	b.Set(ctx, "b", "b2", time.Hour)
+	b.Set(ctx, "d", "d", time.Hour)
+
+	if b.Len() != 3 {
+		t.Errorf("expected the backend bounded at 3 entries, got %d", b.Len())
+	}
+	if _, err := b.Get(ctx, "c"); err == nil {
+		t.Error("expected c evicted")
+	}
+	for key, want := range map[string]string{"a": "a", "b": "b2", "d": "d"} {
+		if got, err := b.Get(ctx, key); err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q, %v", key, want, got, err)
+		}
+	}
+
+	b.Delete(ctx, "a")
+	if _, err := b.Get(ctx, "a"); err == nil || b.Len() != 2 {
+		t.Errorf("expected a deleted, %d entries left", b.Len())
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/logexport"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/pricingsync"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// AdminHandler handles signed key-management and operational requests
+type AdminHandler struct {
+	db         *database.DB
+	redis      *redis.Client
+	middleware *Middleware
+	exporter   *logexport.Exporter // nil = log export not configured
+	pricing    *pricingsync.Syncer // nil = pricing sync not configured
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(db *database.DB, redis *redis.Client, middleware *Middleware, exporter *logexport.Exporter, pricing *pricingsync.Syncer) *AdminHandler {
+	return &AdminHandler{
+		db:         db,
+		redis:      redis,
+		middleware: middleware,
+		exporter:   exporter,
+		pricing:    pricing,
+	}
+}
+
+// HandleRevokeKey handles POST /admin/keys/{id}/revoke
+func (h *AdminHandler) HandleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	keyID := chi.URLParam(r, "id")
+
+	keyHash, err := h.db.RevokeAPIKey(ctx, keyID)
+	if err == database.ErrInvalidAPIKey {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrMalformedID {
+		http.Error(w, "key ID must be a UUID", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to revoke key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Make the revocation take effect now rather than after API_KEY_CACHE_TTL
+	if err := h.middleware.InvalidateAPIKey(ctx, keyHash); err != nil {
+		log.Printf("Failed to invalidate cached API key %s: %v", keyID, err)
+	}
+
+	log.Printf("Revoked API key %s", keyID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      keyID,
+		"revoked": true,
+	})
+}
+
+// redisNamespaces are the gateway's Redis key prefixes, and whether purging
+// one is harmless (the data is rebuilt on demand)
+var redisNamespaces = map[string]bool{
+	"cache:exact":    true, // response cache and fill locks
+	"apikey":         true, // API key lookups
+	"region_latency": true,
+	"ratelimit":      false, // per-key and per-IP (ratelimit:ip:) windows
+	"concurrency":    false,
+	"logtotals":      false,
+	"lastused":       false,
+	"maintenance":    false, // a single key, the maintenance mode flag
+	"admin_nonce":    false, // purging would allow signed request replays
+}
+
+// redisNamespaceNames lists the keys of redisNamespaces
+func redisNamespaceNames() []string {
+	namespaces := make([]string, 0, len(redisNamespaces))
+	for namespace := range redisNamespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+// keyspaceSamples is how many keys per namespace are measured with MEMORY USAGE
+const keyspaceSamples = 50
+
+// HandleRedisUsage handles GET /admin/redis, reporting key counts and
+// approximate memory per Redis namespace. It SCANs the whole keyspace.
+func (h *AdminHandler) HandleRedisUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.redis.KeyspaceUsage(r.Context(), redisNamespaceNames(), keyspaceSamples)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("redis error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]*models.NamespaceUsage, 0, len(usage))
+	var totalKeys, totalBytes int64
+	for _, u := range usage {
+		rows = append(rows, u)
+		totalKeys += u.Keys
+		totalBytes += u.ApproxBytes
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ApproxBytes > rows[j].ApproxBytes })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys":         totalKeys,
+		"approx_bytes": totalBytes,
+		"namespaces":   rows,
+	})
+}
+
+// HandlePurgeNamespace handles POST /admin/redis/{namespace}/purge, deleting
+// every Redis key in a namespace that is safe to rebuild (e.g. cache:exact)
+func (h *AdminHandler) HandlePurgeNamespace(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+
+	purgeable, known := redisNamespaces[namespace]
+	if !known {
+		http.Error(w, fmt.Sprintf("unknown namespace %q", namespace), http.StatusNotFound)
+		return
+	}
+	if !purgeable {
+		http.Error(w, fmt.Sprintf("namespace %q can't be purged", namespace), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.redis.PurgeNamespace(r.Context(), namespace)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to purge %s after %d keys: %v", namespace, deleted, err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Purged %d Redis keys in namespace %s", deleted, namespace)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"namespace": namespace,
+		"deleted":   deleted,
+	})
+}
+
+// exportRequest is the body of POST /admin/logs/export
+type exportRequest struct {
+	Before *time.Time `json:"before"` // RFC 3339; defaults to now minus LOG_EXPORT_RETENTION
+}
+
+// HandleExportLogs handles POST /admin/logs/export. The export runs in the
+// background; progress and failures are logged.
+func (h *AdminHandler) HandleExportLogs(w http.ResponseWriter, r *http.Request) {
+	if h.exporter == nil {
+		http.Error(w, "log export is not configured (set LOG_EXPORT_BUCKET)", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	before := time.Now().Add(-h.exporter.Retention())
+	if req.Before != nil {
+		before = *req.Before
+	}
+
+	if err := h.exporter.RunInBackground(before); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"started": true,
+		"before":  before,
+	})
+}
+
+// HandleSyncPricing handles POST /admin/pricing/sync, applying the pricing
+// source now and returning what changed
+func (h *AdminHandler) HandleSyncPricing(w http.ResponseWriter, r *http.Request) {
+	if h.pricing == nil {
+		http.Error(w, "pricing sync is not configured (set PRICING_SYNC_SOURCE)", http.StatusServiceUnavailable)
+		return
+	}
+
+	result, err := h.pricing.Run(r.Context())
+	if errors.Is(err, pricingsync.ErrRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("pricing sync failed: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("Pricing synced via admin API: %d inserted, %d updated", result.Inserted, result.Updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
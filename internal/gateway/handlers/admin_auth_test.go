@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+const testSigningSecret = "admin-secret"
+
+// testRedis connects to an in-memory Redis for the test
+func testRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client, err := redis.New(context.Background(), redis.Options{URL: "redis://" + srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, srv
+}
+
+// signedRequest builds an admin request signed at ts with nonce
+func signedRequest(method, path, body, nonce string, ts time.Time) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set("X-Admin-Timestamp", timestamp)
+	req.Header.Set("X-Admin-Nonce", nonce)
+	req.Header.Set("X-Admin-Signature", hex.EncodeToString(adminSignature(testSigningSecret, timestamp, nonce, method, req.URL.RequestURI(), []byte(body))))
+	return req
+}
+
+func adminMiddleware(t *testing.T) *Middleware {
+	client, _ := testRedis(t)
+	return &Middleware{
+		cfg:   &config.Config{AdminSigningSecret: testSigningSecret, AdminSignatureMaxAge: 5 * time.Minute},
+		redis: client,
+	}
+}
+
+// signedOK answers 200 to whatever gets past the middleware
+var signedOK = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestAdminSignatureAcceptsAValidRequest(t *testing.T) {
+	handler := adminMiddleware(t).AdminSignatureMiddleware(signedOK)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("PUT", "/admin/maintenance?x=1", `{"enabled":true}`, "n-1", time.Now()))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminSignatureRejectsBadRequests(t *testing.T) {
+	handler := adminMiddleware(t).AdminSignatureMiddleware(signedOK)
+
+	tampered := signedRequest("PUT", "/admin/maintenance", `{"enabled":true}`, "n-2", time.Now())
+	tampered.Body = httptest.NewRequest("PUT", "/", strings.NewReader(`{"enabled":false}`)).Body
+
+	otherPath := signedRequest("POST", "/admin/keys/a/revoke", "", "n-3", time.Now())
+	otherPath.URL.Path = "/admin/keys/b/revoke"
+
+	otherQuery := signedRequest("GET", "/admin/stats/errors?provider=openai", "", "n-6", time.Now())
+	otherQuery.URL.RawQuery = "provider=anthropic"
+
+	for name, req := range map[string]*http.Request{
+		"expired":     signedRequest("POST", "/admin/keys/a/revoke", "", "n-4", time.Now().Add(-10*time.Minute)),
+		"future":      signedRequest("POST", "/admin/keys/a/revoke", "", "n-5", time.Now().Add(10*time.Minute)),
+		"tampered":    tampered,
+		"other path":  otherPath,
+		"other query": otherQuery,
+		"unsigned":    httptest.NewRequest("POST", "/admin/keys/a/revoke", nil),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+	}
+}
+
+func TestAdminSignatureRejectsReplayedNonces(t *testing.T) {
+	handler := adminMiddleware(t).AdminSignatureMiddleware(signedOK)
+	now := time.Now()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("POST", "/admin/keys/a/revoke", "", "once", now))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first use: expected 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("POST", "/admin/keys/a/revoke", "", "once", now))
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "nonce already used") {
+		t.Errorf("replay: expected 401 for the reused nonce, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminSignatureRejectsOversizedBodies(t *testing.T) {
+	handler := adminMiddleware(t).AdminSignatureMiddleware(signedOK)
+	body := `{"before":"` + strings.Repeat("x", maxAdminBodyBytes) + `"}`
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("POST", "/admin/logs/export", body, "big", time.Now()))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rec.Code)
+	}
+}
+
+func TestRevokeKeyRejectsMalformedIDs(t *testing.T) {
+	db, mock := mockDB(t)
+	mock.ExpectQuery("UPDATE api_keys SET is_active = false").WithArgs("not-a-uuid").
+		WillReturnError(&pq.Error{Code: "22P02", Message: `invalid input syntax for type uuid: "not-a-uuid"`})
+	mock.ExpectQuery("UPDATE api_keys SET is_active = false").WithArgs("00000000-0000-0000-0000-000000000000").
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}))
+	h := &AdminHandler{db: db}
+
+	router := chi.NewRouter()
+	router.Post("/admin/keys/{id}/revoke", h.HandleRevokeKey)
+
+	// In the order the queries are expected
+	for _, tc := range []struct {
+		id   string
+		want int
+	}{
+		{"not-a-uuid", http.StatusBadRequest},
+		{"00000000-0000-0000-0000-000000000000", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/keys/"+tc.id+"/revoke", nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d: %s", tc.id, tc.want, rec.Code, rec.Body)
+		}
+		if strings.Contains(rec.Body.String(), "invalid input syntax") {
+			t.Errorf("%s: database error leaked: %s", tc.id, rec.Body)
+		}
+	}
+}
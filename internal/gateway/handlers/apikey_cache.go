@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// invalidKeyMarker is cached for keys that don't exist or are inactive
+const invalidKeyMarker = "invalid"
+
+// apiKeyCacheKey returns the Redis key for a hashed API key
+func apiKeyCacheKey(keyHash string) string {
+	return "apikey:" + keyHash
+}
+
+// lookupAPIKey resolves a raw key through the Redis cache, falling back to the database.
+// Unknown keys are negatively cached so repeated guesses don't reach the database.
+func (m *Middleware) lookupAPIKey(ctx context.Context, rawKey string) (*models.APIKey, error) {
+	if m.cfg.APIKeyCacheTTL <= 0 && m.cfg.APIKeyNegativeCacheTTL <= 0 {
+		return m.db.GetAPIKey(ctx, rawKey)
+	}
+
+	cacheKey := apiKeyCacheKey(database.HashAPIKey(rawKey))
+
+	if cached, err := m.redis.Get(ctx, cacheKey); err == nil {
+		if cached == invalidKeyMarker {
+			return nil, database.ErrInvalidAPIKey
+		}
+
+		var apiKey models.APIKey
+		if err := json.Unmarshal([]byte(cached), &apiKey); err == nil {
+			return &apiKey, nil
+		}
+	}
+
+	apiKey, err := m.db.GetAPIKey(ctx, rawKey)
+	if err == database.ErrInvalidAPIKey {
+		if m.cfg.APIKeyNegativeCacheTTL > 0 {
+			if err := m.redis.Set(ctx, cacheKey, invalidKeyMarker, m.cfg.APIKeyNegativeCacheTTL); err != nil {
+				log.Printf("Failed to cache invalid API key: %v", err)
+			}
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.cfg.APIKeyCacheTTL > 0 {
+		data, _ := json.Marshal(apiKey)
+		if err := m.redis.Set(ctx, cacheKey, string(data), m.cfg.APIKeyCacheTTL); err != nil {
+			log.Printf("Failed to cache API key: %v", err)
+		}
+	}
+
+	return apiKey, nil
+}
+
+// InvalidateAPIKey drops a cached key lookup so a revocation or limit change
+// takes effect immediately instead of after the cache TTL
+func (m *Middleware) InvalidateAPIKey(ctx context.Context, keyHash string) error {
+	return m.redis.Del(ctx, apiKeyCacheKey(keyHash))
+}
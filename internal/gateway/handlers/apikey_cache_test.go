@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+)
+
+func TestAPIKeyLookupCachedWithinTTL(t *testing.T) {
+	db, mock := mockDB(t)
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: authConfig(30*time.Second, 0), db: db, redis: client}
+
+	// One lookup serves both requests
+	expectAPIKey(mock, "key-1", testAPIKey)
+	for i := 0; i < 2; i++ {
+		if code, keyID := authenticate(m, testAPIKey); code != http.StatusOK || keyID != "key-1" {
+			t.Fatalf("request %d: got %d for %q", i, code, keyID)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the TTL passes the key is looked up again
+	srv.FastForward(31 * time.Second)
+	expectAPIKey(mock, "key-1", testAPIKey)
+	if code, _ := authenticate(m, testAPIKey); code != http.StatusOK {
+		t.Errorf("expected 200 after the TTL, got %d", code)
+	}
+}
+
+func TestRevokeInvalidatesTheCachedKey(t *testing.T) {
+	db, mock := mockDB(t)
+	client, _ := testRedis(t)
+	m := &Middleware{cfg: authConfig(time.Hour, 0), db: db, redis: client}
+	admin := &AdminHandler{db: db, redis: client, middleware: m}
+	router := chi.NewRouter()
+	router.Post("/admin/keys/{id}/revoke", admin.HandleRevokeKey)
+	keyID := "6f1c2b9e-3d4a-4e5f-8a7b-0c1d2e3f4a5b"
+
+	expectAPIKey(mock, keyID, testAPIKey)
+	if code, _ := authenticate(m, testAPIKey); code != http.StatusOK {
+		t.Fatalf("expected the key to authenticate, got %d", code)
+	}
+
+	mock.ExpectQuery("UPDATE api_keys SET is_active = false").WithArgs(keyID).
+		WillReturnRows(sqlmock.NewRows([]string{"key_hash"}).AddRow(database.HashAPIKey(testAPIKey)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/admin/keys/"+keyID+"/revoke", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Well within the hour-long TTL, the revoked key is looked up and refused
+	mock.ExpectQuery(selectAPIKey).WithArgs(database.HashAPIKey(testAPIKey)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if code, _ := authenticate(m, testAPIKey); code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked key refused, got %d", code)
+	}
+}
+
+func TestUnknownKeysAreNegativelyCached(t *testing.T) {
+	db, mock := mockDB(t)
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: authConfig(30*time.Second, 10*time.Second), db: db, redis: client}
+	guess := "gw_live_guessguessguess"
+
+	// Repeated guesses cost one lookup per negative TTL
+	mock.ExpectQuery(selectAPIKey).WithArgs(database.HashAPIKey(guess)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	for i := 0; i < 5; i++ {
+		if code, _ := authenticate(m, guess); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expected 401, got %d", i, code)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := srv.TTL(apiKeyCacheKey(database.HashAPIKey(guess))); ttl != 10*time.Second {
+		t.Errorf("negative entry TTL = %s, want 10s", ttl)
+	}
+
+	srv.FastForward(11 * time.Second)
+	mock.ExpectQuery(selectAPIKey).WithArgs(database.HashAPIKey(guess)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	authenticate(m, guess)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// transcriptionEndpoint is the route transcriptions are logged under
+const transcriptionEndpoint = "/v1/audio/transcriptions"
+
+type AudioHandler struct {
+	cfg         *config.Config
+	providerMgr *providers.Manager
+	db          *database.DB
+	logs        *database.LogWriter
+}
+
+func NewAudioHandler(cfg *config.Config, providerMgr *providers.Manager, db *database.DB, logs *database.LogWriter) *AudioHandler {
+	return &AudioHandler{
+		cfg:         cfg,
+		providerMgr: providerMgr,
+		db:          db,
+		logs:        logs,
+	}
+}
+
+// HandleTranscription handles POST /v1/audio/transcriptions. It takes the same
+// multipart form as OpenAI (file, model, prompt, language, temperature,
+// response_format) and supports the json, verbose_json and text formats.
+func (h *AudioHandler) HandleTranscription(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	startTime := time.Now()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.cfg.AudioMaxUploadMB)<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("audio file exceeds %d MB", h.cfg.AudioMaxUploadMB), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid multipart body", http.StatusBadRequest)
+		return
+	}
+
+	req := providers.TranscriptionRequest{
+		Model:    r.FormValue("model"),
+		Prompt:   r.FormValue("prompt"),
+		Language: r.FormValue("language"),
+	}
+	if req.Model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	org, err := keyOrganization(apiKey, r.Header.Get("OpenAI-Organization"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Organization = org
+	if temp := r.FormValue("temperature"); temp != "" {
+		parsed, err := strconv.ParseFloat(temp, 32)
+		if err != nil || parsed < 0 || parsed > 1 {
+			http.Error(w, "temperature must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		req.Temperature = float32(parsed)
+	}
+
+	format := r.FormValue("response_format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "verbose_json", "text":
+	default:
+		http.Error(w, fmt.Sprintf("unsupported response_format %q (use json, verbose_json or text)", format), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	req.FileName = header.Filename
+	if req.Audio, err = io.ReadAll(file); err != nil {
+		http.Error(w, "failed to read audio file", http.StatusBadRequest)
+		return
+	}
+
+	resp, providerName, err := h.providerMgr.Transcribe(ctx, req)
+	if err != nil {
+		h.logTranscription(ctx, apiKey, req, nil, providerName, 0, time.Since(startTime), err)
+		if errors.Is(err, providers.ErrTranscriptionNotSupported) {
+			http.Error(w, fmt.Sprintf("model %s does not support transcription", req.Model), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, fmt.Sprintf("provider error: %v", err), chatErrorStatus(err))
+		return
+	}
+
+	cost := h.transcriptionCost(ctx, providerName, req.Model, resp)
+	totalLatency := time.Since(startTime)
+	h.logTranscription(ctx, apiKey, req, resp, providerName, cost, totalLatency, nil)
+
+	w.Header().Set("X-Cost-USD", fmt.Sprintf("%.6f", cost))
+	w.Header().Set("X-Provider", providerName)
+	w.Header().Set("X-Latency-Ms", fmt.Sprintf("%d", totalLatency.Milliseconds()))
+	if resp.Duration > 0 {
+		w.Header().Set("X-Audio-Duration-Seconds", fmt.Sprintf("%.2f", resp.Duration))
+	}
+
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, resp.Text)
+	case "verbose_json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"text": resp.Text})
+	}
+}
+
+// transcriptionCost prices a transcription by its token usage if the model
+// reported one (gpt-4o-transcribe), else by audio duration (whisper). Returns
+// 0 if the model has no pricing or reported neither.
+func (h *AudioHandler) transcriptionCost(ctx context.Context, provider, model string, resp *providers.TranscriptionResponse) float64 {
+	pricing, err := h.db.GetModelPricing(ctx, provider, model)
+	if err != nil {
+		return 0
+	}
+	if usage := resp.Usage; usage != nil {
+		return float64(usage.InputTokens)/1000*pricing.InputPer1kTokens + float64(usage.OutputTokens)/1000*pricing.OutputPer1kTokens
+	}
+	return resp.Duration / 60 * pricing.PricePerMinute
+}
+
+// logTranscription logs a transcription request
+func (h *AudioHandler) logTranscription(ctx context.Context, apiKey *models.APIKey, req providers.TranscriptionRequest, resp *providers.TranscriptionResponse, provider string, cost float64, duration time.Duration, err error) {
+	log := &models.GatewayLog{
+		APIKeyID:   &apiKey.ID,
+		Method:     "POST",
+		Endpoint:   transcriptionEndpoint,
+		Model:      req.Model,
+		Provider:   provider,
+		CostUSD:    cost,
+		LatencyMs:  int(duration.Milliseconds()),
+		StatusCode: 200,
+	}
+	if req.Organization != "" {
+		log.Organization = &req.Organization
+	}
+	if ip := clientIPFromContext(ctx); ip != "" {
+		log.ClientIP = &ip
+	}
+
+	if err != nil {
+		log.StatusCode = chatErrorStatus(err)
+		if errors.Is(err, providers.ErrTranscriptionNotSupported) {
+			log.StatusCode = http.StatusBadRequest
+		}
+		errMsg := err.Error()
+		log.ErrorMessage = &errMsg
+		errType := classifyError(err)
+		log.ErrorType = &errType
+	}
+
+	h.logs.Enqueue(log)
+	h.logs.TouchAPIKey(apiKey.ID)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// transcriptionReply answers every transcription with body, recording the
+// response_format it was asked for
+func transcriptionReply(body string, format *string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.ParseMultipartForm(1 << 20)
+		*format = r.FormValue("response_format")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+// transcriptionRequest builds an authenticated multipart upload for model
+func transcriptionRequest(t *testing.T, model, format string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("model", model)
+	if format != "" {
+		form.WriteField("response_format", format)
+	}
+	file, _ := form.CreateFormFile("file", "clip.mp3")
+	file.Write([]byte("ID3 not really audio"))
+	form.Close()
+
+	req := httptest.NewRequest("POST", transcriptionEndpoint, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req.WithContext(context.WithValue(req.Context(), "api_key", &models.APIKey{ID: "key-1"}))
+}
+
+func TestTranscriptionIsPricedByDurationForWhisper(t *testing.T) {
+	var format string
+	cfg := &config.Config{AudioMaxUploadMB: 1}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+		"openai": transcriptionReply(`{"task":"transcribe","language":"english","duration":90,"text":"Hello there."}`, &format),
+	})
+	db, mock := mockDB(t)
+	expectAudioPricing(mock, "whisper-1", 0, 0, 0.006)
+	h := &AudioHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleTranscription(rec, transcriptionRequest(t, "whisper-1", ""))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if format != "verbose_json" {
+		t.Errorf("whisper asked for %q, want verbose_json for the duration", format)
+	}
+	if got := rec.Header().Get("X-Cost-USD"); got != "0.009000" {
+		t.Errorf("X-Cost-USD = %s, want 1.5 minutes at $0.006", got)
+	}
+	if got := rec.Header().Get("X-Audio-Duration-Seconds"); got != "90.00" {
+		t.Errorf("X-Audio-Duration-Seconds = %s", got)
+	}
+	if strings.TrimSpace(rec.Body.String()) != `{"text":"Hello there."}` {
+		t.Errorf("body %s", rec.Body)
+	}
+}
+
+func TestTranscriptionIsPricedByTokensForGPT4oTranscribe(t *testing.T) {
+	var format string
+	cfg := &config.Config{AudioMaxUploadMB: 1}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+		"openai": transcriptionReply(`{"text":"Hello there.","usage":{"type":"tokens","input_tokens":1500,"input_token_details":{"text_tokens":0,"audio_tokens":1500},"output_tokens":200,"total_tokens":1700}}`, &format),
+	})
+	db, mock := mockDB(t)
+	expectAudioPricing(mock, "gpt-4o-transcribe", 0.006, 0.01, 0)
+	h := &AudioHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleTranscription(rec, transcriptionRequest(t, "gpt-4o-transcribe", "text"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if format != "json" {
+		t.Errorf("gpt-4o-transcribe asked for %q, want json", format)
+	}
+	// 1.5k input tokens at $0.006 + 0.2k output tokens at $0.01
+	if got := rec.Header().Get("X-Cost-USD"); got != "0.011000" {
+		t.Errorf("X-Cost-USD = %s, want 0.011000", got)
+	}
+	if rec.Body.String() != "Hello there." {
+		t.Errorf("body %q", rec.Body)
+	}
+}
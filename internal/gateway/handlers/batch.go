@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/priority"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// BatchHandler handles batched chat completion requests
+type BatchHandler struct {
+	cfg   *config.Config
+	chat  *ChatHandler
+	redis *redis.Client
+}
+
+// NewBatchHandler creates a new batch handler
+func NewBatchHandler(cfg *config.Config, chat *ChatHandler, redis *redis.Client) *BatchHandler {
+	return &BatchHandler{
+		cfg:   cfg,
+		chat:  chat,
+		redis: redis,
+	}
+}
+
+// batchResult is the outcome of one request in a batch
+type batchResult struct {
+	Index    int                     `json:"index"`
+	Status   int                     `json:"status"`
+	Response *providers.ChatResponse `json:"response,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+	CostUSD  float64                 `json:"cost_usd"`
+	CacheHit bool                    `json:"cache_hit"`
+}
+
+// HandleBatchChatCompletion handles POST /v1/chat/completions/batch. The body is a
+// JSON array of chat requests; each is processed independently with bounded
+// concurrency and gets its own status in the results.
+func (h *BatchHandler) HandleBatchChatCompletion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var reqs []providers.ChatRequest
+	if err := decodeJSONBody(r, &reqs); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if len(reqs) == 0 {
+		http.Error(w, "batch must contain at least one request", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > h.cfg.BatchMaxSize {
+		http.Error(w, fmt.Sprintf("batch exceeds the maximum of %d requests", h.cfg.BatchMaxSize), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, len(reqs))
+	sem := make(chan struct{}, h.concurrency(apiKey))
+	slots := h.itemSlots(apiKey)
+	var wg sync.WaitGroup
+
+	for i := range reqs {
+		req := &reqs[i]
+		if req.Stream {
+			results[i] = batchResult{Index: i, Status: http.StatusBadRequest, Error: "streaming is not supported in batches"}
+			continue
+		}
+		if req.ConversationID != "" {
+			results[i] = batchResult{Index: i, Status: http.StatusBadRequest, Error: "conversation_id is not supported in batches"}
+			continue
+		}
+		// Batch items yield to interactive traffic unless they say otherwise
+		if req.Priority == "" && r.Header.Get("X-Priority") == "" {
+			req.Priority = priority.Batch.String()
+		}
+		if err := h.chat.prepareRequest(w, r, apiKey, req); err != nil {
+			results[i] = batchResult{Index: i, Status: http.StatusBadRequest, Error: err.Error()}
+			continue
+		}
+
+		// The rate limit middleware already counted the HTTP request as the first item
+		if i > 0 && !h.allowItem(r, apiKey) {
+			results[i] = batchResult{Index: i, Status: http.StatusTooManyRequests, Error: "rate limit exceeded"}
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.runItem(r, apiKey, i, reqs[i], slots)
+		}(i)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
+
+// runItem runs a batch entry under its own deadline and retry budget, holding
+// one of the key's concurrency slots
+func (h *BatchHandler) runItem(r *http.Request, apiKey *models.APIKey, index int, req providers.ChatRequest, slots *itemSlots) batchResult {
+	ctx, cancel := itemContext(r, requestTimeout(h.cfg, r))
+	defer cancel()
+	ctx = providers.WithRetryBudget(ctx, keyRetryBudget(h.cfg, apiKey))
+
+	release, ok := slots.acquire(ctx)
+	if !ok {
+		return batchResult{Index: index, Status: http.StatusTooManyRequests, Error: "concurrency limit exceeded"}
+	}
+	defer release()
+
+	return h.processItem(ctx, r, apiKey, index, req)
+}
+
+// processItem runs a single prepared batch entry through the regular completion path
+func (h *BatchHandler) processItem(ctx context.Context, r *http.Request, apiKey *models.APIKey, index int, req providers.ChatRequest) batchResult {
+	result := h.chat.completeChat(ctx, r, apiKey, req)
+	if result.err != nil {
+		return batchResult{Index: index, Status: chatErrorStatus(result.err), Error: result.err.Error()}
+	}
+
+	return batchResult{
+		Index:    index,
+		Status:   http.StatusOK,
+		Response: h.chat.echoModel(req, result.resp),
+		CostUSD:  result.resp.CostUSD,
+		CacheHit: result.cacheHit,
+	}
+}
+
+// concurrency returns how many batch items may run at once: the configured
+// batch concurrency, capped by the key's concurrent request limit
+func (h *BatchHandler) concurrency(apiKey *models.APIKey) int {
+	limit := h.cfg.BatchConcurrency
+	if apiKey.MaxConcurrentRequests > 0 && apiKey.MaxConcurrentRequests < limit {
+		limit = apiKey.MaxConcurrentRequests
+	}
+	if limit <= 0 {
+		limit = 1
+	}
+	return limit
+}
+
+// itemContext gives a batch item the full request timeout of its own, rather
+// than a share of the batch request's deadline. It is still cancelled if the
+// client goes away.
+func itemContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	parent := r.Context()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), timeout)
+	stop := context.AfterFunc(parent, func() {
+		if errors.Is(parent.Err(), context.Canceled) {
+			cancel()
+		}
+	})
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// itemSlots hands batch items the key's concurrency slots. One item at a time
+// runs on the slot ConcurrencyMiddleware holds for the batch request itself;
+// the others reserve their own.
+type itemSlots struct {
+	held    chan struct{}
+	reserve func(ctx context.Context) (bool, error) // nil = no concurrency limit
+	free    func()
+}
+
+// itemSlots returns the slot source for a key's batch items
+func (h *BatchHandler) itemSlots(apiKey *models.APIKey) *itemSlots {
+	slots := &itemSlots{held: make(chan struct{}, 1)}
+	slots.held <- struct{}{}
+
+	if apiKey.MaxConcurrentRequests > 0 && h.redis != nil {
+		slots.reserve = func(ctx context.Context) (bool, error) {
+			acquired, _, err := h.redis.AcquireConcurrencySlot(ctx, apiKey.ID, apiKey.MaxConcurrentRequests)
+			return acquired, err
+		}
+		slots.free = func() {
+			h.redis.ReleaseConcurrencySlot(context.Background(), apiKey.ID)
+		}
+	}
+	return slots
+}
+
+// acquire takes a slot for one item, returning false if the key is at its
+// limit. Redis errors let the item through, as in ConcurrencyMiddleware.
+func (s *itemSlots) acquire(ctx context.Context) (release func(), ok bool) {
+	select {
+	case <-s.held:
+		return func() { s.held <- struct{}{} }, true
+	default:
+	}
+
+	if s.reserve == nil {
+		return func() {}, true
+	}
+	acquired, err := s.reserve(ctx)
+	if err != nil {
+		return func() {}, true
+	}
+	if !acquired {
+		return nil, false
+	}
+	return s.free, true
+}
+
+// allowItem counts a batch item against the key's rate limit
+func (h *BatchHandler) allowItem(r *http.Request, apiKey *models.APIKey) bool {
+	limit := apiKey.RateLimitPerMinute
+	if limit <= 0 {
+		limit = 100 // fallback default, as in RateLimitMiddleware
+	}
+
+	exceeded, _, err := checkRateLimit(r.Context(), h.cfg, h.redis, apiKey.ID, limit)
+	if err != nil {
+		return !h.cfg.RateLimitFailClosed // same fail mode as the rate limit middleware
+	}
+	return !exceeded
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSlots counts a key's in-flight requests against limit, with the batch
+// request itself already holding one
+func fakeSlots(limit int) (*itemSlots, *int) {
+	var mu sync.Mutex
+	inFlight := 1
+	slots := &itemSlots{held: make(chan struct{}, 1)}
+	slots.held <- struct{}{}
+	slots.reserve = func(context.Context) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if inFlight >= limit {
+			return false, nil
+		}
+		inFlight++
+		return true, nil
+	}
+	slots.free = func() {
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}
+	return slots, &inFlight
+}
+
+func TestItemSlotsReuseTheRequestSlotFirst(t *testing.T) {
+	slots, inFlight := fakeSlots(2)
+	ctx := context.Background()
+
+	first, ok := slots.acquire(ctx)
+	if !ok || *inFlight != 1 {
+		t.Fatalf("first item should run on the request's slot, in flight %d", *inFlight)
+	}
+	second, ok := slots.acquire(ctx)
+	if !ok || *inFlight != 2 {
+		t.Fatalf("second item should reserve a slot, in flight %d", *inFlight)
+	}
+	if _, ok := slots.acquire(ctx); ok {
+		t.Fatal("third item should be refused at the key's limit of 2")
+	}
+
+	second()
+	first()
+	if *inFlight != 1 {
+		t.Errorf("releasing should leave only the request's slot, in flight %d", *inFlight)
+	}
+	if _, ok := slots.acquire(ctx); !ok {
+		t.Error("the request's slot should be reusable after release")
+	}
+}
+
+func TestItemSlotsBoundConcurrentItems(t *testing.T) {
+	const limit = 3
+	slots, _ := fakeSlots(limit)
+
+	var mu sync.Mutex
+	running, peak, refused := 0, 0, 0
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8) // more workers than the key allows
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			release, ok := slots.acquire(context.Background())
+			mu.Lock()
+			if !ok {
+				refused++
+				mu.Unlock()
+				return
+			}
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > limit {
+		t.Errorf("%d items ran at once, over the key's limit of %d", peak, limit)
+	}
+	if refused == 0 {
+		t.Error("expected some items refused with 8 workers against a limit of 3")
+	}
+}
+
+func TestItemSlotsWithoutLimitOrOnRedisError(t *testing.T) {
+	unlimited := &itemSlots{held: make(chan struct{}, 1)}
+	for i := 0; i < 3; i++ {
+		if _, ok := unlimited.acquire(context.Background()); !ok {
+			t.Fatal("keys without a concurrency limit should never be refused")
+		}
+	}
+
+	broken := &itemSlots{
+		held:    make(chan struct{}, 1),
+		reserve: func(context.Context) (bool, error) { return false, errors.New("redis down") },
+	}
+	if _, ok := broken.acquire(context.Background()); !ok {
+		t.Error("a Redis error should let the item through")
+	}
+}
+
+func TestItemContextOutlivesTheBatchDeadline(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	r := httptest.NewRequest("POST", "/v1/chat/completions/batch", nil).WithContext(parent)
+
+	ctx, stop := itemContext(r, time.Minute)
+	defer stop()
+	<-parent.Done()
+	time.Sleep(5 * time.Millisecond)
+
+	if ctx.Err() != nil {
+		t.Fatalf("item was cancelled with the batch deadline: %v", ctx.Err())
+	}
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) < 50*time.Second {
+		t.Errorf("item should get its own full timeout, deadline in %s", time.Until(deadline))
+	}
+}
+
+func TestItemContextCancelledWhenClientGoes(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("POST", "/v1/chat/completions/batch", nil).WithContext(parent)
+
+	ctx, stop := itemContext(r, time.Minute)
+	defer stop()
+	cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("item should be cancelled when the client disconnects")
+	}
+}
+
+func TestItemContextsHaveIndependentDeadlines(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions/batch", nil)
+
+	first, stopFirst := itemContext(r, 20*time.Millisecond)
+	defer stopFirst()
+	<-first.Done()
+
+	second, stopSecond := itemContext(r, 20*time.Millisecond)
+	defer stopSecond()
+	if second.Err() != nil {
+		t.Error("a later item shouldn't inherit an earlier item's expired deadline")
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestRetryBudgetMiddlewareAttachesTheKeysBudget(t *testing.T) {
+	m := &Middleware{cfg: &config.Config{RetryMaxAttempts: 4, RetryMaxDuration: 10 * time.Second}}
+
+	for _, tc := range []struct {
+		name string
+		key  *models.APIKey
+		want providers.RetryBudget
+	}{
+		{"default", &models.APIKey{}, providers.RetryBudget{MaxAttempts: 4, MaxDuration: 10 * time.Second}},
+		{"key override", &models.APIKey{Features: map[string]interface{}{
+			models.FeatureRetryMaxAttempts:   float64(2),
+			models.FeatureRetryMaxDurationMs: float64(1500),
+		}}, providers.RetryBudget{MaxAttempts: 2, MaxDuration: 1500 * time.Millisecond}},
+	} {
+		var got providers.RetryBudget
+		var ok bool
+		handler := m.RetryBudgetMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok = providers.RetryBudgetFrom(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "api_key", tc.key))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if !ok || got != tc.want {
+			t.Errorf("%s: budget %+v (attached %v), want %+v", tc.name, got, ok, tc.want)
+		}
+	}
+}
+
+func TestRetryBudgetMiddlewareSkipsUnauthenticatedRequests(t *testing.T) {
+	m := &Middleware{cfg: &config.Config{RetryMaxAttempts: 4}}
+	called := false
+	handler := m.RetryBudgetMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := providers.RetryBudgetFrom(r.Context()); ok {
+			t.Error("no key, so no budget should be attached")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/capabilities", nil))
+	if !called {
+		t.Error("the request should pass through")
+	}
+}
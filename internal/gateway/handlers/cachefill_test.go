@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/alerts"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestCacheStampedeMakesOneProviderCall(t *testing.T) {
+	const callers = 10
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600, CacheFillWait: 5 * time.Second}
+	var upstreamCalls int32
+	reply := openAIReply("gpt-4o", "Paris.", "stop", 14, 2)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		time.Sleep(200 * time.Millisecond) // long enough for every caller to miss
+		reply(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	// The filler prices the completion and looks up its cache TTL and context
+	// window; each waiter looks the model up once
+	for i := 0; i < 3+callers-1; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	var wg sync.WaitGroup
+	codes := make([]int, callers)
+	hits := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.HandleChatCompletion(rec, chatRequest(body, key))
+			codes[i] = rec.Code
+			hits[i] = rec.Header().Get("X-Cache-Hit")
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&upstreamCalls); n != 1 {
+		t.Errorf("expected exactly one provider call, got %d", n)
+	}
+	served := 0
+	for i := range codes {
+		if codes[i] != http.StatusOK {
+			t.Errorf("caller %d: expected 200, got %d", i, codes[i])
+		}
+		if hits[i] == "true" {
+			served++
+		}
+	}
+	if served != callers-1 {
+		t.Errorf("expected %d callers served from the fill, got %d", callers-1, served)
+	}
+}
+
+func TestStuckFillHolderFallsBackToTheProvider(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600, CacheFillWait: 150 * time.Millisecond}
+	var upstreamCalls int32
+	reply := openAIReply("gpt-4o", "Paris.", "stop", 14, 2)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		reply(w, r)
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	c := cache.New(cache.NewMemoryBackend(0))
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: c}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	// Another caller holds the fill and never finishes it
+	var held providers.ChatRequest
+	if err := json.Unmarshal([]byte(body), &held); err != nil {
+		t.Fatal(err)
+	}
+	if _, acquired := c.AcquireFill(context.Background(), held); !acquired {
+		t.Fatal("expected to take the fill lock")
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(body, key))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if n := atomic.LoadInt32(&upstreamCalls); n != 1 {
+		t.Errorf("expected the waiter to call the provider itself, got %d calls", n)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.CacheFillWait || elapsed > 2*time.Second {
+		t.Errorf("expected to give up on the fill after %s, took %s", cfg.CacheFillWait, elapsed)
+	}
+}
+
+func TestFailedFillReleasesWaitersAtOnce(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600, CacheFillWait: 5 * time.Second}
+	var upstreamCalls int32
+	reply := openAIReply("gpt-4o", "Paris.", "stop", 14, 2)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		// The fill holder's call fails; the waiter's own call succeeds
+		if atomic.AddInt32(&upstreamCalls, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"invalid request","type":"invalid_request_error"}}`))
+			return
+		}
+		reply(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	// The waiter prices its completion and looks up its cache TTL; the holder
+	// looks the model up once
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), alerts: alerts.New("", 0), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	holder := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(body, key))
+		holder <- rec.Code
+	}()
+	time.Sleep(50 * time.Millisecond) // the holder has the fill lock
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(body, key))
+	if code := <-holder; code == http.StatusOK {
+		t.Error("expected the holder's call to fail")
+	}
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache-Hit") == "true" {
+		t.Fatalf("expected the waiter served by its own call, got %d (cache hit %q): %s", rec.Code, rec.Header().Get("X-Cache-Hit"), rec.Body)
+	}
+	if n := atomic.LoadInt32(&upstreamCalls); n != 2 {
+		t.Errorf("expected 2 provider calls, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the waiter to stop waiting when the fill failed, took %s", elapsed)
+	}
+}
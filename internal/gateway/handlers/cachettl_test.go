@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// expectModelTTL expects one model_pricing lookup whose cache_ttl_seconds is ttl (nil = unset)
+func expectModelTTL(mock sqlmock.Sqlmock, ttl interface{}) {
+	now := time.Now()
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", "openai", "gpt-4o", 0.0025, 0.01, 128000, true, ttl, 0.0, now, now))
+}
+
+func TestCacheTTLPrecedence(t *testing.T) {
+	skip := struct{}{}
+	cfg := &config.Config{CacheTTLSeconds: 3600, CacheTTLMaxSeconds: 86400}
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		model  interface{} // model_pricing.cache_ttl_seconds; sql.ErrNoRows = no pricing row, skip = not looked up
+		key    int
+		want   time.Duration
+	}{
+		{"request wins", "30", skip, 120, 30 * time.Second},
+		{"request 0 disables", "0", skip, 120, 0},
+		{"request clamped", "31536000", skip, 120, 86400 * time.Second},
+		{"invalid header ignored", "soon", 600, 120, 600 * time.Second},
+		{"negative header ignored", "-5", 600, 120, 600 * time.Second},
+		{"model over key", "", 600, 120, 600 * time.Second},
+		{"model 0 disables", "", 0, 120, 0},
+		{"key over global", "", nil, 120, 120 * time.Second},
+		{"global", "", nil, 0, 3600 * time.Second},
+		{"no pricing row", "", sql.ErrNoRows, 120, 120 * time.Second},
+	} {
+		db, mock := mockDB(t)
+		switch tc.model {
+		case skip:
+		case sql.ErrNoRows:
+			mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o").WillReturnError(sql.ErrNoRows)
+		default:
+			expectModelTTL(mock, tc.model)
+		}
+		h := &ChatHandler{cfg: cfg, db: db}
+
+		r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if tc.header != "" {
+			r.Header.Set("X-Cache-TTL", tc.header)
+		}
+		if got := h.cacheTTL(context.Background(), r, &models.APIKey{CacheTTLSeconds: tc.key}, "openai", "gpt-4o"); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/priority"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// cacheWarmEndpoint is the route cache-warming calls are logged under
+const cacheWarmEndpoint = "/v1/cache/warm"
+
+// Outcomes of warming one request
+const (
+	warmStored    = "stored"     // completed and written to the cache
+	warmCached    = "cached"     // already in the cache; no provider call
+	warmNotStored = "not_stored" // completed, but its cache TTL is 0
+)
+
+// warmResult is the outcome of one request in a warm-up; no completion is returned
+type warmResult struct {
+	Index   int     `json:"index"`
+	Status  int     `json:"status"`
+	Result  string  `json:"result,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// HandleWarmCache handles POST /v1/cache/warm. The request is signed as an
+// admin request and carries the bearer key whose cache is warmed. The body is a
+// JSON array of chat requests, which are completed as batch items and stored in
+// that key's cache so later identical requests hit it. Completions aren't returned.
+func (h *BatchHandler) HandleWarmCache(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !apiKey.CacheEnabled {
+		http.Error(w, "caching is disabled for this key", http.StatusBadRequest)
+		return
+	}
+
+	var reqs []providers.ChatRequest
+	if err := decodeJSONBody(r, &reqs); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if len(reqs) == 0 {
+		http.Error(w, "warm-up must contain at least one request", http.StatusBadRequest)
+		return
+	}
+	if len(reqs) > h.cfg.BatchMaxSize {
+		http.Error(w, fmt.Sprintf("warm-up exceeds the maximum of %d requests", h.cfg.BatchMaxSize), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]warmResult, len(reqs))
+	sem := make(chan struct{}, h.concurrency(apiKey))
+	var wg sync.WaitGroup
+
+	for i := range reqs {
+		req := &reqs[i]
+		if req.Stream {
+			results[i] = warmResult{Index: i, Status: http.StatusBadRequest, Error: "streaming is not supported when warming the cache"}
+			continue
+		}
+		if req.ConversationID != "" {
+			results[i] = warmResult{Index: i, Status: http.StatusBadRequest, Error: "conversation_id is not supported when warming the cache"}
+			continue
+		}
+		if req.Priority == "" && r.Header.Get("X-Priority") == "" {
+			req.Priority = priority.Batch.String()
+		}
+		if err := h.chat.prepareRequest(w, r, apiKey, req); err != nil {
+			results[i] = warmResult{Index: i, Status: prepareErrorStatus(err), Error: err.Error()}
+			continue
+		}
+		req.Endpoint = cacheWarmEndpoint
+
+		// The rate limit middleware already counted the HTTP request as the first item
+		if i > 0 && !h.allowItem(r, apiKey) {
+			results[i] = warmResult{Index: i, Status: http.StatusTooManyRequests, Error: "rate limit exceeded"}
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.warmItem(r, apiKey, i, reqs[i])
+		}(i)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
+
+// warmItem completes a prepared request through the regular path, which
+// stores it in the cache, and reports whether it was stored
+func (h *BatchHandler) warmItem(r *http.Request, apiKey *models.APIKey, index int, req providers.ChatRequest) warmResult {
+	ctx := providers.WithRetryBudget(r.Context(), keyRetryBudget(h.cfg, apiKey))
+	result := h.chat.completeChat(ctx, r, apiKey, req)
+	if result.err != nil {
+		return warmResult{Index: index, Status: chatErrorStatus(result.err), Error: result.err.Error()}
+	}
+
+	outcome := warmStored
+	if result.cacheHit {
+		outcome = warmCached
+	} else if h.chat.cacheTTL(r.Context(), r, apiKey, result.providerName, req.Model) <= 0 {
+		outcome = warmNotStored
+	}
+	return warmResult{
+		Index:   index,
+		Status:  http.StatusOK,
+		Result:  outcome,
+		CostUSD: result.resp.CostUSD,
+	}
+}
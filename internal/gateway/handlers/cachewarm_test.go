@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestWarmCacheReportsPrepareErrorsPerItem(t *testing.T) {
+	cfg := &config.Config{BatchMaxSize: 10, BatchConcurrency: 2}
+	h := &BatchHandler{cfg: cfg, chat: &ChatHandler{cfg: cfg}}
+
+	body := `[{"model":"gpt-4o","priority":"urgent","messages":[{"role":"user","content":"hi"}]},
+		{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}]`
+	req := httptest.NewRequest(http.MethodPost, "/v1/cache/warm", bytes.NewBufferString(body))
+	req = req.WithContext(context.WithValue(req.Context(), "api_key", &models.APIKey{ID: "key-1", CacheEnabled: true}))
+	rec := httptest.NewRecorder()
+
+	h.HandleWarmCache(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var out struct {
+		Results []warmResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", out.Results)
+	}
+	for i, res := range out.Results {
+		if res.Index != i || res.Status != http.StatusBadRequest || res.Error == "" || res.Result != "" {
+			t.Errorf("item %d: expected a 400 with an error and no result, got %+v", i, res)
+		}
+	}
+}
+
+func TestWarmCacheRequiresCachingEnabled(t *testing.T) {
+	cfg := &config.Config{BatchMaxSize: 10}
+	h := &BatchHandler{cfg: cfg, chat: &ChatHandler{cfg: cfg}}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/cache/warm", bytes.NewBufferString(`[]`))
+	req = req.WithContext(context.WithValue(req.Context(), "api_key", &models.APIKey{ID: "key-1"}))
+	rec := httptest.NewRecorder()
+
+	h.HandleWarmCache(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a key without caching, got %d", rec.Code)
+	}
+}
+
+func TestPrepareErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{database.ErrConversationNotFound, http.StatusNotFound},
+		{fmt.Errorf("%w: connection refused", errConversationStore), http.StatusInternalServerError},
+		{errors.New("temperature must be between 0 and 2"), http.StatusBadRequest},
+	} {
+		if got := prepareErrorStatus(tc.err); got != tc.want {
+			t.Errorf("%v: got %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleCapabilities handles GET /v1/capabilities
+func (h *ChatHandler) HandleCapabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"providers": h.providerMgr.Capabilities(),
+	})
+}
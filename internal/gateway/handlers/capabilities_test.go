@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+)
+
+func TestCapabilitiesListConfiguredProviders(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+		"openai":    statusReply(http.StatusOK),
+		"anthropic": statusReply(http.StatusOK),
+		"cohere":    statusReply(http.StatusOK),
+	})
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr}
+
+	rec := httptest.NewRecorder()
+	h.HandleCapabilities(rec, httptest.NewRequest("GET", "/v1/capabilities", nil))
+
+	var body struct {
+		Providers map[string]providers.Capabilities `json:"providers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]providers.Capabilities{
+		"openai":    {Streaming: true, Tools: true, JSONMode: true, Vision: true},
+		"anthropic": {Streaming: true, Tools: true, Vision: true},
+		"cohere":    {Streaming: true, Tools: true},
+	}
+	if !reflect.DeepEqual(body.Providers, want) {
+		t.Errorf("got %+v, want %+v", body.Providers, want)
+	}
+}
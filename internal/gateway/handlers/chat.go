@@ -3,29 +3,53 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/alerts"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/jsonrepair"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/postprocess"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/priority"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tracing"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ChatHandler struct {
-	providerMgr *providers.Manager
-	cache       *cache.Cache
-	db          *database.DB
+	cfg           *config.Config
+	providerMgr   *providers.Manager
+	cache         *cache.Cache
+	db            *database.DB
+	logs          *database.LogWriter
+	alerts        *alerts.Notifier
+	queue         *priority.Queue // nil = no worker limit
+	postprocessor *postprocess.Client
 }
 
-func NewChatHandler(providerMgr *providers.Manager, cache *cache.Cache, db *database.DB) *ChatHandler {
+func NewChatHandler(cfg *config.Config, providerMgr *providers.Manager, cache *cache.Cache, db *database.DB, logs *database.LogWriter, alerts *alerts.Notifier, queue *priority.Queue, postprocessor *postprocess.Client) *ChatHandler {
 	return &ChatHandler{
-		providerMgr: providerMgr,
-		cache:       cache,
-		db:          db,
+		cfg:           cfg,
+		providerMgr:   providerMgr,
+		cache:         cache,
+		db:            db,
+		logs:          logs,
+		alerts:        alerts,
+		queue:         queue,
+		postprocessor: postprocessor,
 	}
 }
 
@@ -43,82 +67,587 @@ func (h *ChatHandler) HandleChatCompletion(w http.ResponseWriter, r *http.Reques
 
 	// Parse request
 	var req providers.ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if err := decodeJSONBody(r, &req); err != nil {
+		writeBodyError(w, err)
 		return
 	}
 
-	// Handle streaming separately
-	if req.Stream {
-		h.handleStreamingChat(w, r, apiKey, req)
+	if err := h.prepareRequest(w, r, apiKey, &req); err != nil {
+		http.Error(w, err.Error(), prepareErrorStatus(err))
 		return
 	}
 
-	// Check cache if enabled
-	var cacheHit bool
-	var resp *providers.ChatResponse
-	if apiKey.CacheEnabled {
-		cachedResp, err := h.cache.Get(ctx, req)
-		if err == nil {
-			resp = cachedResp
-			resp.CostUSD = 0 // Cache hits are free
-			cacheHit = true
+	// Handle streaming separately, unless the client asked for a single aggregated body
+	if req.Stream {
+		format, aggregate := negotiateStream(r)
+		if !aggregate && !bufferStreams(apiKey) {
+			h.handleStreamingChat(w, r, apiKey, req, format)
+			return
 		}
-	}
-
-	// If not cached, call provider
-	var providerName string
-	var failoverUsed bool
-	if !cacheHit {
-		var err error
-		resp, providerName, failoverUsed, err = h.providerMgr.ChatCompletion(ctx, req)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("provider error: %v", err), http.StatusInternalServerError)
-			h.logRequest(ctx, apiKey, req, nil, providerName, time.Since(startTime), false, failoverUsed, err)
+		if req.N > 1 {
+			http.Error(w, "n > 1 requires a streamed response", http.StatusBadRequest)
 			return
 		}
+		req.Stream = false
+		req.BufferStream = bufferStreams(apiKey)
+	}
 
-		// Calculate cost
-		cost, _ := h.calculateCost(ctx, providerName, req.Model, resp.Usage)
-		resp.CostUSD = cost
+	result := h.completeChat(ctx, r, apiKey, req)
+	if result.err != nil {
+		h.writeChatError(ctx, w, req, result.err)
+		return
+	}
+	resp := h.finishCompletion(w, r, req, result, startTime)
 
-		// Cache the response if enabled
-		if apiKey.CacheEnabled {
-			ttl := time.Duration(apiKey.CacheTTLSeconds) * time.Second
-			h.cache.Set(ctx, req, resp, ttl)
-		}
+	// Return response
+	json.NewEncoder(w).Encode(resp)
+}
+
+// finishCompletion applies JSON repair, stores conversation turns and sets the
+// response headers for a successful non-streaming completion
+func (h *ChatHandler) finishCompletion(w http.ResponseWriter, r *http.Request, req providers.ChatRequest, result chatResult, startTime time.Time) *providers.ChatResponse {
+	ctx := r.Context()
+	resp := result.resp
+
+	// Fix up malformed JSON-mode output if the client opted in
+	if req.WantsJSON() && (req.RepairJSON || r.Header.Get("X-JSON-Repair") == "true") && repairJSONContent(resp) {
+		w.Header().Set("X-JSON-Repaired", "true")
 	}
 
 	totalLatency := int(time.Since(startTime).Milliseconds())
 	resp.LatencyMs = totalLatency
+	h.saveConversationTurns(ctx, req, resp)
 
 	// Set headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Cache-Hit", fmt.Sprintf("%v", cacheHit))
+	w.Header().Set("X-Cache-Hit", fmt.Sprintf("%v", result.cacheHit))
 	w.Header().Set("X-Cost-USD", fmt.Sprintf("%.6f", resp.CostUSD))
-	w.Header().Set("X-Provider", providerName)
+	w.Header().Set("X-Cache-Savings-USD", fmt.Sprintf("%.6f", resp.CacheSavingsUSD))
+	w.Header().Set("X-Provider", result.providerName)
+	w.Header().Set("X-Original-Model", req.Model)
+	w.Header().Set("X-Served-Model", resp.Model)
 	w.Header().Set("X-Latency-Ms", fmt.Sprintf("%d", totalLatency))
-	if failoverUsed {
+	if result.failoverUsed {
 		w.Header().Set("X-Failover", "true")
 	}
+	if result.raceUsed {
+		w.Header().Set("X-Race-Mode", "true")
+	}
+	if result.downgraded {
+		w.Header().Set("X-Model-Downgraded", "true")
+	}
+	if result.postprocess != "" {
+		w.Header().Set("X-Postprocess", result.postprocess)
+	}
+	if result.continued > 0 {
+		w.Header().Set("X-Auto-Continued", fmt.Sprintf("%d", result.continued))
+	}
+	setSchemaHeaders(w, result)
+	if req.BufferStream {
+		w.Header().Set("X-Stream-Buffered", "true")
+	}
+	if resp.UsageEstimated {
+		w.Header().Set("X-Usage-Estimated", "true")
+	}
+	setUpstreamRateLimitHeaders(w, resp.RateLimit)
+	if window := h.setContextHeaders(ctx, w, req); window > 0 {
+		w.Header().Set("X-Context-Used", fmt.Sprintf("%d", resp.Usage.TotalTokens))
+	}
+	return h.echoModel(req, resp)
+}
+
+// echoModel returns resp reporting the requested model when ECHO_REQUESTED_MODEL
+// is set. It returns a copy, so cached and logged responses keep the served model.
+func (h *ChatHandler) echoModel(req providers.ChatRequest, resp *providers.ChatResponse) *providers.ChatResponse {
+	if !h.cfg.EchoRequestedModel || resp.Model == req.Model {
+		return resp
+	}
+	echoed := *resp
+	echoed.Model = req.Model
+	return &echoed
+}
+
+// streamModel returns the model streamed chunks should report in place of
+// the served one, or "" to leave them unchanged
+func (h *ChatHandler) streamModel(req providers.ChatRequest) string {
+	if !h.cfg.EchoRequestedModel {
+		return ""
+	}
+	return req.Model
+}
+
+// maxCacheKeyLength bounds client-supplied cache keys
+const maxCacheKeyLength = 256
+
+// maxOrganizationLength bounds the OpenAI-Organization header, as logged
+const maxOrganizationLength = 255
+
+// maxUserLength bounds the client's end-user ID, as logged
+const maxUserLength = 255
+
+// keyOrganization returns the OpenAI organization to bill: the one the client
+// selected with the OpenAI-Organization header, which must be the key's own
+// or one of its openai_organizations, or else the key's own
+func keyOrganization(apiKey *models.APIKey, header string) (string, error) {
+	if header == "" {
+		return apiKey.OpenAIOrganization, nil
+	}
+	if len(header) > maxOrganizationLength {
+		return "", fmt.Errorf("OpenAI-Organization must be at most %d characters", maxOrganizationLength)
+	}
+	if header == apiKey.OpenAIOrganization {
+		return header, nil
+	}
+	for _, org := range apiKey.GetStrings(models.FeatureOpenAIOrganizations) {
+		if header == org {
+			return header, nil
+		}
+	}
+	return "", fmt.Errorf("OpenAI-Organization is not one of the organizations configured for this API key")
+}
+
+// prepareRequest applies per-key and per-request settings to a decoded request
+// and renders its template. Returned errors are the client's fault (400),
+// except conversation lookups (see prepareErrorStatus).
+func (h *ChatHandler) prepareRequest(w http.ResponseWriter, r *http.Request, apiKey *models.APIKey, req *providers.ChatRequest) error {
+	// OpenAI organization: per-request header overrides the key's default
+	org, err := keyOrganization(apiKey, r.Header.Get("OpenAI-Organization"))
+	if err != nil {
+		return err
+	}
+	req.Organization = org
+
+	if len(req.User) > maxUserLength {
+		return fmt.Errorf("user must be at most %d characters", maxUserLength)
+	}
+
+	// Apply the key's output token cap
+	requestedMaxTokens := req.MaxTokens
+	if req.MaxTokens == nil {
+		requestedMaxTokens = req.MaxCompletionTokens
+	}
+	if req.NormalizeMaxTokens(apiKey.MaxOutputTokens) {
+		log.Printf("Clamped max_tokens for key %s from %d to %d", apiKey.KeyPrefix, *requestedMaxTokens, apiKey.MaxOutputTokens)
+		w.Header().Set("X-MaxTokens-Clamped", "true")
+	}
+
+	// Reject (or clamp) sampling parameters some providers would refuse
+	clamped, err := req.NormalizeSampling(h.cfg.ClampSamplingParams)
+	if err != nil {
+		return err
+	}
+	if len(clamped) > 0 {
+		w.Header().Set("X-Params-Clamped", strings.Join(clamped, ","))
+	}
+	if err := req.ValidateReasoningEffort(); err != nil {
+		return err
+	}
+	if err := req.ValidateMetadata(); err != nil {
+		return err
+	}
+	if err := req.ValidateChoices(); err != nil {
+		return err
+	}
+	if err := req.ValidateTools(); err != nil {
+		return err
+	}
+	if err := req.ValidateStop(); err != nil {
+		return err
+	}
+	if err := req.ApplySafetySettings(apiKey.GeminiSafetySettings); err != nil {
+		return err
+	}
+
+	// QoS class: body field, then X-Priority header
+	if req.Priority == "" {
+		req.Priority = r.Header.Get("X-Priority")
+	}
+	class, err := priority.ParseClass(req.Priority, priority.Interactive)
+	if err != nil {
+		return err
+	}
+	req.Priority = class.String()
+
+	// Client-chosen cache key: body field, then X-Cache-Key header
+	if req.CacheKey == "" {
+		req.CacheKey = r.Header.Get("X-Cache-Key")
+	}
+	if len(req.CacheKey) > maxCacheKeyLength {
+		return fmt.Errorf("cache_key must be at most %d characters", maxCacheKeyLength)
+	}
+	if req.CacheKey != "" {
+		req.CacheKeyScope = apiKey.ID
+	}
+
+	// Cache key normalization is opt-in per key
+	req.CacheNormalization = providers.CacheNormalization{
+		Whitespace: apiKey.GetBool(models.FeatureCacheNormalizeSpace, false),
+		Lowercase:  apiKey.GetBool(models.FeatureCacheNormalizeCase, false),
+	}
+
+	// Auto-continue: body field, X-Auto-Continue header or key config
+	req.AutoContinue = req.AutoContinue || r.Header.Get("X-Auto-Continue") == "true" || apiKey.GetBool(models.FeatureAutoContinue, false)
+	req.SchemaRetry = req.SchemaRetry || r.Header.Get("X-Schema-Retry") == "true"
+
+	// Provider-native prompt caching can be requested per request or enabled per key
+	req.PromptCaching = req.PromptCaching || apiKey.PromptCachingEnabled
+
+	// Render prompt template if provided
+	if err := req.RenderTemplate(); err != nil {
+		return err
+	}
+
+	// Continue a stored conversation
+	if req.ConversationID != "" {
+		if err := h.continueConversation(r.Context(), apiKey, req); err != nil {
+			return err
+		}
+	}
+
+	// Add the key's standard system prompt; the cache sees the result
+	req.ApplyPrelude(apiKey.PromptPrelude, apiKey.PromptSuffix, apiKey.PromptPreludeOverride)
+
+	h.truncateContext(w, r, apiKey, req)
+	return nil
+}
+
+// truncateContext drops the oldest turns of an over-long conversation when the
+// key or request opts in, leaving room for the requested output tokens
+func (h *ChatHandler) truncateContext(w http.ResponseWriter, r *http.Request, apiKey *models.APIKey, req *providers.ChatRequest) {
+	if !apiKey.GetBool(models.FeatureTruncateContext, false) && r.Header.Get("X-Context-Truncate") != "true" {
+		return
+	}
+
+	providerName := h.providerMgr.DetectProvider(req.Model)
+	pricing, err := h.db.GetModelPricing(r.Context(), providerName, req.Model)
+	if err != nil || pricing.ContextWindow <= 0 {
+		return
+	}
+	budget := pricing.ContextWindow
+	if req.MaxTokens != nil {
+		budget -= *req.MaxTokens
+	}
+
+	kept, dropped := tokenizer.TruncateMessages(tokenizer.ForModel(providerName, req.Model), req.Messages, budget)
+	if dropped == 0 {
+		return
+	}
+	log.Printf("Truncated %d messages for %s to fit its %d token context window", dropped, req.Model, pricing.ContextWindow)
+	req.Messages = kept
+	w.Header().Set("X-Context-Truncated", "true")
+	w.Header().Set("X-Context-Dropped-Messages", fmt.Sprintf("%d", dropped))
+}
+
+// keyRetryBudget returns the key's retry budget, or the configured default
+func keyRetryBudget(cfg *config.Config, apiKey *models.APIKey) providers.RetryBudget {
+	maxDurationMs := apiKey.GetInt(models.FeatureRetryMaxDurationMs, int(cfg.RetryMaxDuration/time.Millisecond))
+	return providers.RetryBudget{
+		MaxAttempts: apiKey.GetInt(models.FeatureRetryMaxAttempts, cfg.RetryMaxAttempts),
+		MaxDuration: time.Duration(maxDurationMs) * time.Millisecond,
+	}
+}
+
+// acquireWorker waits for a provider worker slot in the request's priority class
+func (h *ChatHandler) acquireWorker(ctx context.Context, req providers.ChatRequest) (func(), error) {
+	class, _ := priority.ParseClass(req.Priority, priority.Interactive)
+	return h.queue.Acquire(ctx, class)
+}
+
+// chatResult is the outcome of a non-streaming completion
+type chatResult struct {
+	resp         *providers.ChatResponse
+	providerName string
+	cacheHit     bool
+	failoverUsed bool
+	raceUsed     bool
+	downgraded   bool
+	postprocess  string // "applied" or "skipped" when the key has a post-processing webhook
+	continued    int    // auto-continue calls stitched onto the completion
+	err          error
+
+	schemaErrors  []string // json_schema violations in the returned completion
+	schemaRetried bool     // a schema_retry call was made
+}
+
+// completeChat serves a non-streaming request from cache or the providers,
+// computing cost, populating the cache, alerting and logging along the way
+func (h *ChatHandler) completeChat(ctx context.Context, r *http.Request, apiKey *models.APIKey, req providers.ChatRequest) chatResult {
+	startTime := time.Now()
+	var result chatResult
+
+	// Check cache if enabled
+	if apiKey.CacheEnabled {
+		cachedResp, err := h.cacheGet(ctx, req)
+		if err == nil {
+			result.resp = cachedResp
+			markCacheHit(result.resp)
+			result.cacheHit = true
+		} else if h.cfg.CacheFillWait > 0 {
+			// Single-flight: only one of many identical misses calls the provider
+			release, acquired := h.cache.AcquireFill(ctx, req)
+			defer release()
+			if !acquired {
+				if filled, err := h.cache.WaitForFill(ctx, req, h.cfg.CacheFillWait); err == nil {
+					result.resp = filled
+					markCacheHit(result.resp)
+					result.cacheHit = true
+				}
+			}
+		}
+	}
+
+	// If not cached, call provider
+	if !result.cacheHit {
+		req.Model, result.downgraded = h.downgradeModel(apiKey, req.Model)
+		race := apiKey.GetBool(models.FeatureRaceMode, false) || r.Header.Get("X-Race-Mode") == "true"
+		var release func()
+		if release, result.err = h.acquireWorker(ctx, req); result.err == nil {
+			defer release()
+			if race {
+				result.resp, result.providerName, result.failoverUsed, result.raceUsed, result.err = h.providerMgr.RaceChatCompletion(ctx, req)
+			} else if req.BufferStream {
+				result.resp, result.providerName, result.err = h.bufferStream(ctx, req)
+			} else {
+				result.resp, result.providerName, result.failoverUsed, result.err = h.providerMgr.ChatCompletion(ctx, req)
+			}
+		}
+		if result.err != nil {
+			// Only genuine provider faults alert - safety blocks, over-long prompts
+			// and the caller's own timeouts are the request's doing
+			if status := chatErrorStatus(result.err); status == http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				h.alerts.Notify(alerts.Event{
+					Type:     alerts.EventProviderError,
+					Model:    req.Model,
+					Provider: result.providerName,
+					Error:    result.err.Error(),
+				})
+			}
+			h.logRequest(ctx, apiKey, req, nil, result.providerName, time.Since(startTime), false, result.failoverUsed, result.raceUsed, result.err)
+			result.resp = nil
+			return result
+		}
+
+		if result.failoverUsed && !result.raceUsed {
+			h.alerts.Notify(alerts.Event{
+				Type:           alerts.EventFailover,
+				Model:          req.Model,
+				Provider:       h.providerMgr.DetectProvider(req.Model),
+				ServedModel:    result.resp.Model,
+				ServedProvider: result.providerName,
+			})
+		}
+
+		// Calculate cost at the prices of the model that served it
+		cost, _ := h.calculateCost(ctx, result.providerName, servedModel(result.resp, req.Model), result.resp)
+		result.resp.CostUSD = cost
+		if loser := result.resp.RaceLoser; loser != nil {
+			h.logRaceLoser(ctx, apiKey, req, loser, time.Since(startTime))
+		}
+
+		// Stitch on continuations of a length-truncated completion; they and
+		// schema retries add their own cost
+		result.continued = h.autoContinue(ctx, req, result.resp)
+		result.schemaErrors, result.schemaRetried = h.validateSchema(ctx, r, req, result.resp)
+
+		// Output that doesn't match its schema is never cached, and fails
+		// the request if the client asked for a retry
+		if len(result.schemaErrors) > 0 && req.SchemaRetry {
+			result.err = &schemaValidationError{Violations: result.schemaErrors}
+			h.logRequest(ctx, apiKey, req, result.resp, result.providerName, time.Since(startTime), false, result.failoverUsed, result.raceUsed, result.err)
+			result.resp = nil
+			return result
+		}
+
+		// Cache the response if enabled
+		if apiKey.CacheEnabled && len(result.schemaErrors) == 0 {
+			if ttl := h.cacheTTL(ctx, r, apiKey, result.providerName, req.Model); ttl > 0 {
+				h.cache.Set(ctx, req, result.resp, ttl)
+			}
+		}
+	}
+
+	// Let the key's webhook rewrite the completion; the cache keeps the original
+	if result.postprocess, result.err = h.postprocessCompletion(ctx, apiKey, req, result.resp); result.err != nil {
+		h.logRequest(ctx, apiKey, req, result.resp, result.providerName, time.Since(startTime), result.cacheHit, result.failoverUsed, result.raceUsed, result.err)
+		result.resp = nil
+		return result
+	}
 
 	// Log request
-	h.logRequest(ctx, apiKey, req, resp, providerName, time.Since(startTime), cacheHit, failoverUsed, nil)
+	h.logRequest(ctx, apiKey, req, result.resp, result.providerName, time.Since(startTime), result.cacheHit, result.failoverUsed, result.raceUsed, nil)
 
-	// Return response
-	json.NewEncoder(w).Encode(resp)
+	return result
+}
+
+// postprocessCompletion runs the key's post-processing webhook, if any, on
+// resp. A failed webhook leaves resp unchanged ("skipped") unless the key
+// fails closed, in which case the error is returned.
+func (h *ChatHandler) postprocessCompletion(ctx context.Context, apiKey *models.APIKey, req providers.ChatRequest, resp *providers.ChatResponse) (string, error) {
+	if apiKey.PostprocessURL == "" {
+		return "", nil
+	}
+
+	if err := h.postprocessor.Transform(ctx, apiKey.PostprocessURL, req, resp); err != nil {
+		if apiKey.PostprocessFailClosed {
+			return "", fmt.Errorf("%w: %v", postprocess.ErrFailed, err)
+		}
+		log.Printf("Post-processing webhook failed for key %s, returning the original completion: %v", apiKey.KeyPrefix, err)
+		return "skipped", nil
+	}
+	return "applied", nil
+}
+
+// allowUnprocessedStream handles streaming for a key with a post-processing
+// webhook, which streams can't go through. A key that requires it gets a 400
+// and false; a fail-open key streams the original completion, flagged with
+// X-Postprocess: skipped.
+func allowUnprocessedStream(w http.ResponseWriter, apiKey *models.APIKey) bool {
+	if apiKey.PostprocessURL == "" {
+		return true
+	}
+	if apiKey.PostprocessFailClosed {
+		http.Error(w, "streaming is unavailable for this key because completions must be post-processed; retry with \"stream\": false", http.StatusBadRequest)
+		return false
+	}
+	log.Printf("Streaming for key %s without its post-processing webhook", apiKey.KeyPrefix)
+	w.Header().Set("X-Postprocess", "skipped")
+	return true
+}
+
+// downgradeModel swaps in the model's cheaper sibling while it's being
+// rate-limited upstream, if the key allows it
+func (h *ChatHandler) downgradeModel(apiKey *models.APIKey, model string) (string, bool) {
+	if !apiKey.GetBool(models.FeatureAutoDowngrade, false) {
+		return model, false
+	}
+	sibling, ok := h.providerMgr.Downgrade(model)
+	if !ok {
+		return model, false
+	}
+	log.Printf("Downgrading %s to %s for key %s: upstream is rate limiting", model, sibling, apiKey.KeyPrefix)
+	return sibling, true
+}
+
+// chatErrorStatus maps a completion error to the HTTP status returned for it
+func chatErrorStatus(err error) int {
+	var blockedErr *providers.ContentBlockedError
+	if errors.As(err, &blockedErr) {
+		return http.StatusUnprocessableEntity
+	}
+	var ctxErr *providers.ContextLengthError
+	if errors.As(err, &ctxErr) {
+		return http.StatusBadRequest
+	}
+	var rlErr *providers.RateLimitError
+	if errors.As(err, &rlErr) {
+		return http.StatusTooManyRequests
+	}
+	if errors.Is(err, priority.ErrQueueFull) || errors.Is(err, providers.ErrProviderBusy) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.Is(err, postprocess.ErrFailed) {
+		return http.StatusBadGateway
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, errClientCancelled) || errors.Is(err, errRaceLost) {
+		return statusClientClosedRequest
+	}
+	var schemaErr *schemaValidationError
+	if errors.As(err, &schemaErr) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// classifyError returns the gateway_logs.error_type for a failed request
+func classifyError(err error) string {
+	if errors.Is(err, priority.ErrQueueFull) || errors.Is(err, providers.ErrProviderBusy) {
+		return "capacity"
+	}
+	if errors.Is(err, postprocess.ErrFailed) {
+		return "postprocess"
+	}
+	if errors.Is(err, errClientCancelled) {
+		return "client_cancelled"
+	}
+	if errors.Is(err, errRaceLost) {
+		return "race_lost"
+	}
+	var schemaErr *schemaValidationError
+	if errors.As(err, &schemaErr) {
+		return "schema_validation"
+	}
+	return providers.ClassifyError(err)
+}
+
+// writeChatError writes the error response for a failed completion
+func (h *ChatHandler) writeChatError(ctx context.Context, w http.ResponseWriter, req providers.ChatRequest, err error) {
+	var blockedErr *providers.ContentBlockedError
+	if errors.As(err, &blockedErr) {
+		writeContentBlocked(w, blockedErr)
+		return
+	}
+	var ctxErr *providers.ContextLengthError
+	if errors.As(err, &ctxErr) {
+		h.writeContextLengthExceeded(ctx, w, req, ctxErr)
+		return
+	}
+	var schemaErr *schemaValidationError
+	if errors.As(err, &schemaErr) {
+		writeSchemaValidationFailed(w, schemaErr)
+		return
+	}
+	var rlErr *providers.RateLimitError
+	if errors.As(err, &rlErr) {
+		setUpstreamRateLimitHeaders(w, rlErr.RateLimit)
+		if rl := rlErr.RateLimit; rl != nil && rl.RetryAfter > 0 {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(rl.RetryAfter.Seconds()))))
+		}
+		http.Error(w, fmt.Sprintf("provider rate limited: %v", err), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, priority.ErrQueueFull) || errors.Is(err, providers.ErrProviderBusy) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, postprocess.ErrFailed) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if chatErrorStatus(err) == http.StatusGatewayTimeout {
+		// The caller's own X-Request-Timeout ran out - not a provider fault
+		http.Error(w, fmt.Sprintf("request timed out: %v", err), http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, fmt.Sprintf("provider error: %v", err), http.StatusInternalServerError)
 }
 
 // handleStreamingChat handles streaming chat completions
-func (h *ChatHandler) handleStreamingChat(w http.ResponseWriter, r *http.Request, apiKey *models.APIKey, req providers.ChatRequest) {
+func (h *ChatHandler) handleStreamingChat(w http.ResponseWriter, r *http.Request, apiKey *models.APIKey, req providers.ChatRequest, format streamFormat) {
 	ctx := r.Context()
 	startTime := time.Now()
+	echoModel := h.streamModel(req) // before any downgrade
 
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
+	if !allowUnprocessedStream(w, apiKey) {
+		return
+	}
+
+	// Models flagged non-streaming in model_pricing would only fail upstream
+	if pricing, err := h.db.GetModelPricing(ctx, h.providerMgr.DetectProvider(req.Model), req.Model); err == nil && !pricing.SupportsStreaming {
+		http.Error(w, fmt.Sprintf("model %s does not support streaming; retry with \"stream\": false", req.Model), http.StatusBadRequest)
+		return
+	}
+
+	// Set streaming headers
+	w.Header().Set("Content-Type", format.contentType())
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no")
+	w.Header().Set("Trailer", usageTrailers)
 
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -126,101 +655,478 @@ func (h *ChatHandler) handleStreamingChat(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Replay from cache if enabled; n > 1 streams are never cached
+	if apiKey.CacheEnabled && req.N <= 1 {
+		if cachedResp, err := h.cacheGet(ctx, req); err == nil {
+			markCacheHit(cachedResp)
+			w.Header().Set("X-Cache-Hit", "true")
+			h.setContextHeaders(ctx, w, req)
+
+			out := newSSEWriter(w, flusher, format, 0, 0)
+			out.model = echoModel
+			h.replayCachedStream(ctx, out, cachedResp)
+			setUsageTrailers(w, cachedResp)
+			h.saveConversationTurns(ctx, req, cachedResp)
+			h.logRequest(ctx, apiKey, req, cachedResp, "", time.Since(startTime), true, false, false, nil)
+			return
+		}
+	}
+
 	// Get provider
-	provider, providerName, err := h.providerMgr.GetProvider(req.Model)
+	var downgraded bool
+	req.Model, downgraded = h.downgradeModel(apiKey, req.Model)
+
+	w.Header().Set("X-Cache-Hit", "false")
+	if downgraded {
+		w.Header().Set("X-Model-Downgraded", "true")
+	}
+	h.setContextHeaders(ctx, w, req)
+
+	// Hold a worker slot for the life of the stream
+	release, err := h.acquireWorker(ctx, req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("provider error: %v", err), http.StatusInternalServerError)
+		h.writeChatError(ctx, w, req, err)
 		return
 	}
+	defer release()
 
-	// Create stream
-	stream, err := provider.ChatCompletionStream(ctx, req)
+	// Create stream, or one per choice for n > 1
+	var stream providers.StreamReader
+	var providerName string
+	if req.N > 1 {
+		stream, providerName, err = h.openChoiceStreams(ctx, req)
+	} else {
+		stream, providerName, err = h.providerMgr.ChatCompletionStream(ctx, req)
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("streaming error: %v", err), http.StatusInternalServerError)
+		h.writeChatError(ctx, w, req, err)
+		h.logRequest(ctx, apiKey, req, nil, providerName, time.Since(startTime), false, false, false, err)
 		return
 	}
-	defer stream.Close()
 
-	// Stream chunks
-	var totalTokens int
-	for {
-		chunk, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
+	if reporter, ok := stream.(providers.RateLimitReporter); ok {
+		setUpstreamRateLimitHeaders(w, reporter.RateLimit())
+	}
+
+	// Stream chunks, accumulating the full response so it can be cached
+	coalesceChars, coalesceDelay := streamCoalescing(r, apiKey)
+	out := newSSEWriter(w, flusher, format, coalesceChars, coalesceDelay)
+	out.model = echoModel
+	defer out.Close()
+
+	acc := &streamAccumulator{}
+	streamErr := pumpStream(out, stream, acc, false)
+	stream.Close()
+
+	// Resume mid-stream failures from where the output stopped
+	maxResumes := apiKey.GetInt(models.FeatureStreamResumeRetries, h.cfg.StreamResumeMaxRetries)
+	if req.N > 1 {
+		maxResumes = 0 // a resume can only continue a single choice
+	}
+	for attempt := 0; streamErr != nil && acc.content.Len() > 0 && ctx.Err() == nil && attempt < maxResumes; attempt++ {
+		log.Printf("Stream for %s failed after %d chars, resuming (attempt %d): %v", req.Model, acc.content.Len(), attempt+1, streamErr)
+
+		resumed, resumedProvider, resumedModel, err := h.resumeStream(ctx, req, acc.content.String(), attempt)
 		if err != nil {
-			fmt.Fprintf(w, "data: {\"error\": \"%s\"}\n\n", err.Error())
-			flusher.Flush()
-			return
+			streamErr = err
+			continue
 		}
+		providerName = resumedProvider
+		acc.servedModel = resumedModel
+		streamErr = pumpStream(out, resumed, acc, true)
+		resumed.Close()
+	}
+
+	if streamErr != nil && isStreamTimeout(streamErr) && acc.content.Len() > 0 && req.N <= 1 {
+		h.finishPartialStream(ctx, out, apiKey, req, acc, providerName, startTime, streamErr)
+		return
+	}
+	if streamErr != nil {
+		out.WriteError(streamErr)
+		h.logFailedStream(ctx, apiKey, req, acc, providerName, startTime, streamErr)
+		return
+	}
+
+	acc.estimateUsage(providerName, req.Model, req.Messages)
+	resp := acc.response(req.Model)
+	cost, _ := h.calculateCost(ctx, providerName, servedModel(resp, req.Model), resp)
+	resp.CostUSD = cost
+
+	// Send the final usage chunk, then [DONE], then the usage trailers
+	out.Write(usageChunk(resp))
+	out.Done()
+	setUsageTrailers(w, resp)
+	h.saveConversationTurns(ctx, req, resp)
 
-		// Track usage
-		if chunk.Usage != nil {
-			totalTokens = chunk.Usage.TotalTokens
+	// Cache the completed stream so later requests can be replayed
+	if apiKey.CacheEnabled && acc.content.Len() > 0 && req.N <= 1 {
+		if ttl := h.cacheTTL(ctx, r, apiKey, providerName, req.Model); ttl > 0 {
+			h.cache.Set(ctx, req, resp, ttl)
 		}
+	}
+
+	// Log request
+	h.logRequest(ctx, apiKey, req, resp, providerName, time.Since(startTime), false, false, false, nil)
+}
+
+// finishPartialStream ends a stream that timed out after producing output: the
+// client gets a "length" finish chunk, usage and [DONE] instead of an error, so
+// it keeps what was generated. The partial response is logged but not cached,
+// and isn't saved to a conversation: stored history only holds complete
+// replies, so the conversation is left as it was and the turn can be retried.
+func (h *ChatHandler) finishPartialStream(ctx context.Context, out *sseWriter, apiKey *models.APIKey, req providers.ChatRequest, acc *streamAccumulator, providerName string, startTime time.Time, streamErr error) {
+	log.Printf("Stream for %s timed out after %d chars, returning partial response: %v", req.Model, acc.content.Len(), streamErr)
+
+	// The request context has likely expired; pricing lookups still need to run
+	ctx = context.WithoutCancel(ctx)
+
+	acc.finishReason = openai.FinishReasonLength
+	acc.estimateUsage(providerName, req.Model, req.Messages)
+	resp := acc.response(req.Model)
+	cost, _ := h.calculateCost(ctx, providerName, servedModel(resp, req.Model), resp)
+	resp.CostUSD = cost
+
+	out.Write(providers.StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+		ID:      acc.id,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionStreamChoice{
+			{Index: 0, FinishReason: openai.FinishReasonLength},
+		},
+	}})
+	out.Write(usageChunk(resp))
+	out.Done()
+	setUsageTrailers(out.w, resp)
 
-		// Send chunk
-		data, _ := json.Marshal(chunk)
-		fmt.Fprintf(w, "data: %s\n\n", string(data))
-		flusher.Flush()
+	h.logRequest(ctx, apiKey, req, resp, providerName, time.Since(startTime), false, false, false, streamErr)
+}
+
+// logFailedStream logs a stream that broke off, billing the tokens consumed
+// before it did. A stream the client walked away from is logged as
+// client_cancelled with status 499.
+func (h *ChatHandler) logFailedStream(ctx context.Context, apiKey *models.APIKey, req providers.ChatRequest, acc *streamAccumulator, providerName string, startTime time.Time, streamErr error) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		streamErr = fmt.Errorf("%w: %v", errClientCancelled, streamErr)
 	}
 
-	// Send [DONE]
-	fmt.Fprintf(w, "data: [DONE]\n\n")
-	flusher.Flush()
+	// The request context is gone after a disconnect; pricing lookups still need to run
+	ctx = context.WithoutCancel(ctx)
 
-	// Log request
-	usage := openai.Usage{TotalTokens: totalTokens}
-	resp := &providers.ChatResponse{Usage: usage}
-	cost, _ := h.calculateCost(ctx, providerName, req.Model, usage)
+	acc.estimateUsage(providerName, req.Model, req.Messages)
+	resp := acc.response(req.Model)
+	cost, _ := h.calculateCost(ctx, providerName, servedModel(resp, req.Model), resp)
 	resp.CostUSD = cost
 
-	h.logRequest(ctx, apiKey, req, resp, providerName, time.Since(startTime), false, false, nil)
+	h.logRequest(ctx, apiKey, req, resp, providerName, time.Since(startTime), false, false, false, streamErr)
+}
+
+// isStreamTimeout reports whether a stream failed because a deadline passed,
+// either the request's own or the upstream client's
+func isStreamTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// cacheGet looks up a cached response inside a tracing span
+func (h *ChatHandler) cacheGet(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "cache.get")
+	defer span.End()
+
+	resp, err := h.cache.Get(ctx, req)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	return resp, err
+}
+
+// cacheTTL resolves how long to cache a response: the X-Cache-TTL header (seconds,
+// clamped to the configured max), then the model's default in model_pricing, then
+// the key's, then the global default. Zero means don't store this response.
+func (h *ChatHandler) cacheTTL(ctx context.Context, r *http.Request, apiKey *models.APIKey, provider, model string) time.Duration {
+	if header := r.Header.Get("X-Cache-TTL"); header != "" {
+		if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+			if seconds > h.cfg.CacheTTLMaxSeconds {
+				seconds = h.cfg.CacheTTLMaxSeconds
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	if pricing, err := h.db.GetModelPricing(ctx, provider, model); err == nil && pricing.CacheTTLSeconds != nil {
+		return time.Duration(*pricing.CacheTTLSeconds) * time.Second
+	}
+
+	if apiKey.CacheTTLSeconds > 0 {
+		return time.Duration(apiKey.CacheTTLSeconds) * time.Second
+	}
+	return time.Duration(h.cfg.CacheTTLSeconds) * time.Second
+}
+
+// streamCoalescing returns the chunk coalescing settings from the
+// X-Stream-Coalesce-Chars / X-Stream-Coalesce-Ms headers, falling back to the key's
+func streamCoalescing(r *http.Request, apiKey *models.APIKey) (int, time.Duration) {
+	chars := apiKey.StreamCoalesceChars
+	delayMs := apiKey.StreamCoalesceMs
+
+	if header := r.Header.Get("X-Stream-Coalesce-Chars"); header != "" {
+		if value, err := strconv.Atoi(header); err == nil && value >= 0 {
+			chars = value
+		}
+	}
+	if header := r.Header.Get("X-Stream-Coalesce-Ms"); header != "" {
+		if value, err := strconv.Atoi(header); err == nil && value >= 0 {
+			delayMs = value
+		}
+	}
+
+	return chars, time.Duration(delayMs) * time.Millisecond
+}
+
+// writeContentBlocked writes a structured 422 for a provider safety block
+func writeContentBlocked(w http.ResponseWriter, blockedErr *providers.ContentBlockedError) {
+	categories := blockedErr.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"type":       "content_blocked",
+			"message":    blockedErr.Error(),
+			"provider":   blockedErr.Provider,
+			"reason":     blockedErr.Reason,
+			"categories": categories,
+		},
+	})
+}
+
+// writeContextLengthExceeded writes a structured 400 with the model's context
+// window (when known) and the estimated prompt size
+func (h *ChatHandler) writeContextLengthExceeded(ctx context.Context, w http.ResponseWriter, req providers.ChatRequest, ctxErr *providers.ContextLengthError) {
+	details := map[string]interface{}{
+		"type":                    "context_length_exceeded",
+		"message":                 ctxErr.Error(),
+		"provider":                ctxErr.Provider,
+		"model":                   ctxErr.Model,
+		"estimated_prompt_tokens": tokenizer.ForModel(ctxErr.Provider, ctxErr.Model).CountMessages(req.Messages),
+	}
+	if pricing, err := h.db.GetModelPricing(ctx, ctxErr.Provider, ctxErr.Model); err == nil && pricing.ContextWindow > 0 {
+		details["context_window"] = pricing.ContextWindow
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": details})
+}
+
+// setContextHeaders sets the model's context window and the context remaining
+// after the prompt. Returns the window, or 0 if it's unknown.
+func (h *ChatHandler) setContextHeaders(ctx context.Context, w http.ResponseWriter, req providers.ChatRequest) int {
+	providerName := h.providerMgr.DetectProvider(req.Model)
+	pricing, err := h.db.GetModelPricing(ctx, providerName, req.Model)
+	if err != nil || pricing.ContextWindow <= 0 {
+		return 0
+	}
+
+	promptTokens := tokenizer.ForModel(providerName, req.Model).CountMessages(req.Messages)
+	remaining := pricing.ContextWindow - promptTokens
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	w.Header().Set("X-Context-Window", fmt.Sprintf("%d", pricing.ContextWindow))
+	w.Header().Set("X-Context-Remaining", fmt.Sprintf("%d", remaining))
+
+	return pricing.ContextWindow
+}
+
+// setUpstreamRateLimitHeaders passes the provider's rate-limit state on to the
+// client under X-Upstream-* so it isn't confused with the gateway's own limits
+func setUpstreamRateLimitHeaders(w http.ResponseWriter, rl *providers.UpstreamRateLimit) {
+	if rl == nil {
+		return
+	}
+	for name, value := range map[string]string{
+		"X-Upstream-RateLimit-Limit":            rl.Limit,
+		"X-Upstream-RateLimit-Remaining":        rl.Remaining,
+		"X-Upstream-RateLimit-Reset":            rl.Reset,
+		"X-Upstream-RateLimit-Remaining-Tokens": rl.RemainingTokens,
+	} {
+		if value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	if rl.RetryAfter > 0 {
+		w.Header().Set("X-Upstream-Retry-After", fmt.Sprintf("%d", int(math.Ceil(rl.RetryAfter.Seconds()))))
+	}
+}
+
+// Anthropic prompt cache pricing relative to the base input rate
+const (
+	promptCacheReadMultiplier  = 0.1
+	promptCacheWriteMultiplier = 1.25
+)
+
+// servedModel is the model that produced resp, which failover may have
+// changed from the requested one
+func servedModel(resp *providers.ChatResponse, requested string) string {
+	if resp.ServedModel != "" {
+		return resp.ServedModel
+	}
+	return requested
+}
+
+// addCallCost adds the cost of a follow-up call (a continuation or retry)
+// merged into resp, at the prices of the model that served it
+func (h *ChatHandler) addCallCost(ctx context.Context, resp, next *providers.ChatResponse, providerName, requested string) {
+	cost, _ := h.calculateCost(ctx, providerName, servedModel(next, requested), next)
+	resp.CostUSD += cost
 }
 
 // calculateCost calculates the cost of a request
-func (h *ChatHandler) calculateCost(ctx context.Context, provider, model string, usage openai.Usage) (float64, error) {
+func (h *ChatHandler) calculateCost(ctx context.Context, provider, model string, resp *providers.ChatResponse) (float64, error) {
 	pricing, err := h.db.GetModelPricing(ctx, provider, model)
 	if err != nil {
 		return 0, err
 	}
 
-	inputCost := float64(usage.PromptTokens) / 1000.0 * pricing.InputPer1kTokens
+	usage := resp.Usage
+	inputTokens := float64(usage.PromptTokens)
+
+	// Anthropic bills prompt cache reads and writes at different rates
+	if provider == "anthropic" {
+		var cachedTokens int
+		if usage.PromptTokensDetails != nil {
+			cachedTokens = usage.PromptTokensDetails.CachedTokens
+		}
+		uncachedTokens := usage.PromptTokens - cachedTokens - resp.CacheWriteTokens
+		inputTokens = float64(uncachedTokens) +
+			float64(cachedTokens)*promptCacheReadMultiplier +
+			float64(resp.CacheWriteTokens)*promptCacheWriteMultiplier
+	}
+
+	inputCost := inputTokens / 1000.0 * pricing.InputPer1kTokens
 	outputCost := float64(usage.CompletionTokens) / 1000.0 * pricing.OutputPer1kTokens
 
 	return inputCost + outputCost, nil
 }
 
+// repairJSONContent repairs the JSON in each choice's content, leaving content
+// that can't be recovered as it was. Returns true if anything was changed.
+func repairJSONContent(resp *providers.ChatResponse) bool {
+	repaired := false
+	for i := range resp.Choices {
+		fixed, changed, err := jsonrepair.Repair(resp.Choices[i].Message.Content)
+		if err != nil {
+			log.Printf("JSON repair failed for %s choice %d: %v", resp.Model, i, err)
+			continue
+		}
+		if changed {
+			resp.Choices[i].Message.Content = fixed
+			repaired = true
+		}
+	}
+	return repaired
+}
+
+// markCacheHit zeroes the charge on a cached response and records what the
+// provider call would have cost. The cached entry carries the cost computed when it was stored.
+func markCacheHit(resp *providers.ChatResponse) {
+	resp.CacheSavingsUSD = resp.CostUSD
+	resp.CostUSD = 0 // Cache hits are free
+}
+
+// logRaceLoser logs the race candidate cancelled in favour of the winner, so
+// its spend shows up alongside the provider's invoice. A loser cancelled before
+// answering is billed for its prompt, as counted by the model's tokenizer.
+func (h *ChatHandler) logRaceLoser(ctx context.Context, apiKey *models.APIKey, req providers.ChatRequest, loser *providers.RaceAttempt, duration time.Duration) {
+	resp := loser.Resp
+	if resp == nil {
+		promptTokens := tokenizer.ForModel(loser.ProviderName, loser.Model).CountMessages(req.Messages)
+		resp = &providers.ChatResponse{
+			Model:          loser.Model,
+			Usage:          openai.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens},
+			UsageEstimated: true,
+		}
+	}
+	resp.CostUSD, _ = h.calculateCost(ctx, loser.ProviderName, loser.Model, resp)
+
+	req.Model = loser.Model
+	h.logRequest(ctx, apiKey, req, resp, loser.ProviderName, duration, false, false, true, errRaceLost)
+}
+
 // logRequest logs the request to the database
-func (h *ChatHandler) logRequest(ctx context.Context, apiKey *models.APIKey, req providers.ChatRequest, resp *providers.ChatResponse, provider string, duration time.Duration, cacheHit bool, failoverUsed bool, err error) {
+func (h *ChatHandler) logRequest(ctx context.Context, apiKey *models.APIKey, req providers.ChatRequest, resp *providers.ChatResponse, provider string, duration time.Duration, cacheHit bool, failoverUsed bool, raceUsed bool, err error) {
+	_, span := tracing.Tracer().Start(ctx, "db.log_request", trace.WithAttributes(
+		attribute.Bool("db.async", true),
+	))
+	defer span.End()
+
+	endpoint := req.Endpoint
+	if endpoint == "" {
+		endpoint = "/v1/chat/completions"
+	}
+
 	log := &models.GatewayLog{
 		APIKeyID:     &apiKey.ID,
 		Method:       "POST",
-		Endpoint:     "/v1/chat/completions",
+		Endpoint:     endpoint,
 		Model:        req.Model,
 		Provider:     provider,
 		LatencyMs:    int(duration.Milliseconds()),
 		CacheHit:     cacheHit,
 		FailoverUsed: failoverUsed,
+		RaceUsed:     raceUsed,
 		StatusCode:   200,
 	}
 
+	if failoverUsed {
+		originalProvider := h.providerMgr.DetectProvider(req.Model)
+		log.OriginalProvider = &originalProvider
+		log.OriginalModel = &req.Model
+		if resp != nil {
+			log.ServedModel = &resp.Model
+		}
+	}
+
+	if req.User != "" {
+		log.EndUser = &req.User
+	}
+	if req.Organization != "" {
+		log.Organization = &req.Organization
+	}
+	if ip := clientIPFromContext(ctx); ip != "" {
+		log.ClientIP = &ip
+	}
+	log.Metadata = req.Metadata
+
 	if resp != nil {
 		log.CostUSD = resp.CostUSD
+		log.CacheSavingsUSD = resp.CacheSavingsUSD
 		log.PromptTokens = resp.Usage.PromptTokens
 		log.CompletionTokens = resp.Usage.CompletionTokens
 		log.TotalTokens = resp.Usage.TotalTokens
+		if len(resp.Choices) > 0 && resp.Choices[0].FinishReason != "" {
+			finishReason := string(resp.Choices[0].FinishReason)
+			log.FinishReason = &finishReason
+		}
 	}
 
 	if err != nil {
-		log.StatusCode = 500
+		log.StatusCode = chatErrorStatus(err)
 		errMsg := err.Error()
 		log.ErrorMessage = &errMsg
+		errType := classifyError(err)
+		log.ErrorType = &errType
 	}
 
 	// Log asynchronously to avoid blocking
-	go h.db.LogRequest(context.Background(), log)
+	h.logs.Enqueue(log)
 
-	// Update API key last used
-	go h.db.UpdateAPIKeyLastUsed(context.Background(), apiKey.ID)
+	// Update API key last used (debounced by the log writer)
+	h.logs.TouchAPIKey(apiKey.ID)
 }
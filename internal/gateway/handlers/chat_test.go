@@ -0,0 +1,1104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/alerts"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/priority"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// completion builds a one-choice completion with its usage
+func completion(model, content string, finishReason openai.FinishReason, promptTokens, completionTokens int) *providers.ChatResponse {
+	return &providers.ChatResponse{
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: content}, FinishReason: finishReason}},
+		Usage:   openai.Usage{PromptTokens: promptTokens, CompletionTokens: completionTokens, TotalTokens: promptTokens + completionTokens},
+	}
+}
+
+// chatRequest builds a chat completion request authenticated as key
+func chatRequest(body string, key *models.APIKey) *http.Request {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req.WithContext(context.WithValue(req.Context(), "api_key", key))
+}
+
+func TestLogRequestStoresTheEndUser(t *testing.T) {
+	db, mock, logs, rows := mockLoggingDB(t)
+	expectLogFlush(mock)
+	cfg := &config.Config{}
+	h := &ChatHandler{cfg: cfg, providerMgr: testManager(t, cfg, nil), db: db, logs: logs}
+	key := &models.APIKey{ID: "key-1"}
+
+	h.logRequest(context.Background(), key, providers.ChatRequest{Model: "gpt-4o", User: "user-42"}, completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2), "openai", time.Millisecond, false, false, false, nil)
+	h.logRequest(context.Background(), key, providers.ChatRequest{Model: "gpt-4o"}, completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2), "openai", time.Millisecond, false, false, false, nil)
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(logged))
+	}
+	if logged[0]["end_user"] != "user-42" {
+		t.Errorf("expected end_user user-42, got %v", logged[0]["end_user"])
+	}
+	if logged[1]["end_user"] != nil {
+		t.Errorf("expected no end_user, got %v", logged[1]["end_user"])
+	}
+}
+
+func TestOversizedUserIsRejected(t *testing.T) {
+	var calls int
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		openAIReply("gpt-4o", "Paris.", "stop", 14, 2)(w, r)
+	}})
+	db, _ := mockDB(t)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	// end_user is a VARCHAR(255), so a longer ID would fail the log write
+	body := `{"model":"gpt-4o","user":"` + strings.Repeat("u", maxUserLength+1) + `","messages":[{"role":"user","content":"Hi"}]}`
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(body, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "user must be at most 255 characters") {
+		t.Errorf("expected 400 for the oversized user, got %d: %s", rec.Code, rec.Body)
+	}
+	if calls != 0 {
+		t.Errorf("expected no upstream call, got %d", calls)
+	}
+}
+
+func TestLogRequestStoresTheFinishReason(t *testing.T) {
+	db, mock, logs, rows := mockLoggingDB(t)
+	expectLogFlush(mock)
+	cfg := &config.Config{}
+	h := &ChatHandler{cfg: cfg, providerMgr: testManager(t, cfg, nil), db: db, logs: logs}
+	key := &models.APIKey{ID: "key-1"}
+
+	reasons := []openai.FinishReason{openai.FinishReasonStop, openai.FinishReasonLength, openai.FinishReasonContentFilter, openai.FinishReasonToolCalls}
+	for _, reason := range reasons {
+		h.logRequest(context.Background(), key, providers.ChatRequest{Model: "gemini-2.5-flash"}, completion("gemini-2.5-flash", "Hi", reason, 10, 2), "google", time.Millisecond, false, false, false, nil)
+	}
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != len(reasons) {
+		t.Fatalf("expected %d rows, got %d", len(reasons), len(logged))
+	}
+	for i, reason := range reasons {
+		if logged[i]["finish_reason"] != string(reason) {
+			t.Errorf("row %d: finish_reason = %v, want %s", i, logged[i]["finish_reason"], reason)
+		}
+	}
+}
+
+func TestLogRequestStoresTheErrorType(t *testing.T) {
+	db, mock, logs, rows := mockLoggingDB(t)
+	expectLogFlush(mock)
+	cfg := &config.Config{}
+	h := &ChatHandler{cfg: cfg, providerMgr: testManager(t, cfg, nil), db: db, logs: logs}
+	key := &models.APIKey{ID: "key-1"}
+
+	for _, err := range []error{
+		nil,
+		&providers.ProviderError{Provider: "Anthropic", StatusCode: 401, Body: "invalid x-api-key"},
+		&openai.APIError{HTTPStatusCode: 503, Message: "overloaded"},
+		context.DeadlineExceeded,
+		priority.ErrQueueFull,
+	} {
+		var resp *providers.ChatResponse
+		if err == nil {
+			resp = completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2)
+		}
+		h.logRequest(context.Background(), key, providers.ChatRequest{Model: "gpt-4o"}, resp, "openai", time.Millisecond, false, false, false, err)
+	}
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(logged))
+	}
+	for i, want := range []interface{}{nil, "auth", "server", "timeout", "capacity"} {
+		if logged[i]["error_type"] != want {
+			t.Errorf("row %d: error_type = %v, want %v", i, logged[i]["error_type"], want)
+		}
+	}
+	if logged[1]["error_message"] != "Anthropic API error (status 401): invalid x-api-key" {
+		t.Errorf("the raw message should be kept next to the type, got %v", logged[1]["error_message"])
+	}
+}
+
+func TestContextHeadersReflectWindowAndPromptTokens(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAIReply("gpt-4o", "Paris.", "stop", 14, 2)})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01) // cost
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01) // context window
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	messages := []openai.ChatCompletionMessage{{Role: "system", Content: "Answer in one word."}, {Role: "user", Content: "What is the capital of France?"}}
+	promptTokens := tokenizer.ForModel("openai", "gpt-4o").CountMessages(messages)
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","messages":[{"role":"system","content":"Answer in one word."},{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	for header, want := range map[string]string{
+		"X-Context-Window":    "128000",
+		"X-Context-Remaining": fmt.Sprint(128000 - promptTokens),
+		"X-Context-Used":      "16",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestContextHeadersForOverflowAndUnpricedModels(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, nil)
+	db, mock := mockDB(t)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db}
+	now := time.Now()
+	long := providers.ChatRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: strings.Repeat("word ", 200)}}}
+
+	// A prompt beyond the window leaves nothing
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", "openai", "gpt-4o", 0.0025, 0.01, 100, true, nil, 0.0, now, now))
+	rec := httptest.NewRecorder()
+	if window := h.setContextHeaders(context.Background(), rec, long); window != 100 || rec.Header().Get("X-Context-Remaining") != "0" {
+		t.Errorf("overflowing prompt: window %d, remaining %q", window, rec.Header().Get("X-Context-Remaining"))
+	}
+
+	// An unpriced model gets no headers
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o").WillReturnError(sql.ErrNoRows)
+	rec = httptest.NewRecorder()
+	if window := h.setContextHeaders(context.Background(), rec, long); window != 0 || rec.Header().Get("X-Context-Window") != "" {
+		t.Errorf("unpriced model: window %d, header %q", window, rec.Header().Get("X-Context-Window"))
+	}
+}
+
+func TestOrganizationForwardedUpstreamAndLogged(t *testing.T) {
+	var sent []string
+	reply := openAIReply("gpt-4o", "Paris.", "stop", 14, 2)
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("OpenAI-Organization"))
+		reply(w, r)
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01) // cost
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01) // context window
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+	key := &models.APIKey{ID: "key-1", OpenAIOrganization: "org-default", Features: map[string]interface{}{
+		models.FeatureOpenAIOrganizations: []interface{}{"org-billing"},
+	}}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	for _, tc := range []struct {
+		header string
+		key    *models.APIKey
+	}{
+		{header: "org-billing", key: key},
+		{key: key},
+		{key: &models.APIKey{ID: "key-2"}},
+	} {
+		req := chatRequest(body, tc.key)
+		if tc.header != "" {
+			req.Header.Set("OpenAI-Organization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	logs.Close()
+
+	want := []string{"org-billing", "org-default", ""}
+	if strings.Join(sent, ",") != strings.Join(want, ",") {
+		t.Errorf("upstream saw organizations %q, want %q", sent, want)
+	}
+	logged := rows.logged()
+	if len(logged) != 3 {
+		t.Fatalf("expected 3 logged rows, got %d", len(logged))
+	}
+	for i, org := range want {
+		var got interface{}
+		if org != "" {
+			got = org
+		}
+		if logged[i]["organization"] != got {
+			t.Errorf("row %d: organization = %v, want %v", i, logged[i]["organization"], got)
+		}
+	}
+
+	// Only organizations configured for the key can be selected
+	for name, tc := range map[string]struct {
+		header string
+		key    *models.APIKey
+	}{
+		"unlisted org":     {header: "org-other", key: key},
+		"key without orgs": {header: "org-billing", key: &models.APIKey{ID: "key-2"}},
+		"oversized header": {header: strings.Repeat("o", maxOrganizationLength+1), key: key},
+	} {
+		req := chatRequest(body, tc.key)
+		req.Header.Set("OpenAI-Organization", tc.header)
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "OpenAI-Organization") {
+			t.Errorf("%s: expected 400 naming the header, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if len(sent) != 3 {
+		t.Errorf("expected no upstream calls for rejected organizations, got %d", len(sent)-3)
+	}
+}
+
+func TestFailoverRecordsAndReturnsOriginalAndServedModel(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+		"openai":    statusReply(http.StatusServiceUnavailable),
+		"anthropic": anthropicReply("claude-sonnet-4-5-20250929", "Paris.", "end_turn", 14, 2),
+	})
+	db, mock, logs, rows := mockLoggingDB(t)
+	mock.MatchExpectationsInOrder(false)
+	expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015) // cost
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)                        // context window
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs, alerts: alerts.New("", 0)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+	logs.Close()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("X-Failover") != "true" || rec.Header().Get("X-Original-Model") != "gpt-4o" || rec.Header().Get("X-Served-Model") != "claude-sonnet-4-5-20250929" {
+		t.Errorf("unexpected headers: failover %q, original %q, served %q",
+			rec.Header().Get("X-Failover"), rec.Header().Get("X-Original-Model"), rec.Header().Get("X-Served-Model"))
+	}
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	row := logged[0]
+	if row["original_provider"] != "openai" || row["original_model"] != "gpt-4o" || row["served_model"] != "claude-sonnet-4-5-20250929" || row["provider"] != "anthropic" {
+		t.Errorf("logged original %v/%v, served %v by %v", row["original_provider"], row["original_model"], row["served_model"], row["provider"])
+	}
+}
+
+func TestRaceLoserIsLoggedWithItsPromptCost(t *testing.T) {
+	cfg := &config.Config{}
+	done := make(chan struct{})
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+		// The primary is still working when the failover answers
+		"openai": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		},
+		"anthropic": anthropicReply("claude-sonnet-4-5-20250929", "Paris.", "end_turn", 14, 2),
+	})
+	t.Cleanup(func() { close(done) })
+	db, mock, logs, rows := mockLoggingDB(t)
+	mock.MatchExpectationsInOrder(false)
+	expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015) // winner's cost
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)                        // loser's cost
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)                        // context window
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs, alerts: alerts.New("", 0)}
+
+	req := chatRequest(`{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"})
+	req.Header.Set("X-Race-Mode", "true")
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, req)
+	logs.Close()
+
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Race-Mode") != "true" {
+		t.Fatalf("expected a raced 200, got %d: %s", rec.Code, rec.Body)
+	}
+	logged := rows.logged()
+	if len(logged) != 2 {
+		t.Fatalf("expected rows for the loser and the winner, got %d", len(logged))
+	}
+	loser, winner := logged[0], logged[1]
+	if winner["provider"] != "anthropic" || winner["status_code"] != int64(200) {
+		t.Errorf("unexpected winner row: %v", winner)
+	}
+	if loser["provider"] != "openai" || loser["model"] != "gpt-4o" || loser["status_code"] != int64(statusClientClosedRequest) || loser["error_type"] != "race_lost" {
+		t.Errorf("unexpected loser row: %v", loser)
+	}
+	// Cancelled before answering, the loser is billed for its estimated prompt
+	promptTokens, _ := loser["prompt_tokens"].(int64)
+	if cost, _ := loser["cost_usd"].(float64); promptTokens <= 0 || math.Abs(cost-float64(promptTokens)/1000*0.0025) > 1e-12 {
+		t.Errorf("expected the loser billed for its prompt, got %d tokens for $%v", promptTokens, loser["cost_usd"])
+	}
+}
+
+func TestCacheSavingsOnHitsAndBypasses(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAIReply("gpt-4o", "Paris.", "stop", 14, 2)})
+	db, mock, logs, rows := mockLoggingDB(t)
+	// The fresh completion is priced and its cache TTL and context window
+	// looked up; the hit only looks up the window, the bypass is priced too
+	for i := 0; i < 6; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs, cache: cache.New(cache.NewMemoryBackend(0))}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+	// 14 prompt and 2 completion tokens
+	const cost = 14.0/1000*0.0025 + 2.0/1000*0.01
+
+	for _, tc := range []struct {
+		name          string
+		key           *models.APIKey
+		cost, savings float64
+	}{
+		{"miss", &models.APIKey{ID: "key-1", CacheEnabled: true}, cost, 0},
+		{"hit", &models.APIKey{ID: "key-1", CacheEnabled: true}, 0, cost},
+		{"bypass", &models.APIKey{ID: "key-2"}, cost, 0}, // the entry is cached, but this key doesn't read it
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(body, tc.key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.name, rec.Code, rec.Body)
+		}
+		var resp providers.ChatResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%.6f/%.6f", resp.CostUSD, resp.CacheSavingsUSD) != fmt.Sprintf("%.6f/%.6f", tc.cost, tc.savings) {
+			t.Errorf("%s: cost %.6f, savings %.6f; want %.6f, %.6f", tc.name, resp.CostUSD, resp.CacheSavingsUSD, tc.cost, tc.savings)
+		}
+		if got := rec.Header().Get("X-Cache-Savings-USD"); got != fmt.Sprintf("%.6f", tc.savings) {
+			t.Errorf("%s: X-Cache-Savings-USD %q, want %.6f", tc.name, got, tc.savings)
+		}
+	}
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 3 {
+		t.Fatalf("expected 3 logged rows, got %d", len(logged))
+	}
+	for i, want := range []float64{0, cost, 0} {
+		if fmt.Sprintf("%.6f", logged[i]["cache_savings_usd"]) != fmt.Sprintf("%.6f", want) {
+			t.Errorf("row %d: cache_savings_usd = %v, want %.6f", i, logged[i]["cache_savings_usd"], want)
+		}
+	}
+}
+
+func TestGeminiSafetyBlockReturns422(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"google": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[
+			{"category":"HARM_CATEGORY_HARASSMENT","probability":"HIGH","blocked":true},
+			{"category":"HARM_CATEGORY_HATE_SPEECH","probability":"NEGLIGIBLE"}]},
+			"usageMetadata":{"promptTokenCount":9,"totalTokenCount":9}}`))
+	}})
+	db, _ := mockDB(t)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"..."}]}`, &models.APIKey{ID: "key-1"}))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Error struct {
+			Type       string   `json:"type"`
+			Provider   string   `json:"provider"`
+			Reason     string   `json:"reason"`
+			Categories []string `json:"categories"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Type != "content_blocked" || body.Error.Provider != "google" || body.Error.Reason != "SAFETY" ||
+		len(body.Error.Categories) != 1 || body.Error.Categories[0] != "HARM_CATEGORY_HARASSMENT" {
+		t.Errorf("unexpected error body: %+v", body.Error)
+	}
+}
+
+func TestContextExceededReturns400WithoutFailover(t *testing.T) {
+	estimate := tokenizer.ForModel("openai", "gpt-4o").CountMessages([]openai.ChatCompletionMessage{{Role: "user", Content: "a very long prompt"}})
+	for _, stream := range []bool{false, true} {
+		cfg := &config.Config{}
+		var fallbackCalls int32
+		mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+			"openai": func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"This model's maximum context length is 128000 tokens. However, your messages resulted in 131072 tokens.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`))
+			},
+			"anthropic": func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&fallbackCalls, 1)
+				anthropicReply("claude-sonnet-4-5-20250929", "Hi", "end_turn", 10, 2)(w, r)
+			},
+		})
+		db, mock := mockDB(t)
+		// The error's context window; a stream also checks the model streams
+		// and sets the context headers before calling the provider
+		lookups := 1
+		if stream {
+			lookups = 3
+		}
+		for i := 0; i < lookups; i++ {
+			expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+		}
+		h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(fmt.Sprintf(`{"model":"gpt-4o","stream":%t,"messages":[{"role":"user","content":"a very long prompt"}]}`, stream), &models.APIKey{ID: "key-1"}))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("stream %t: expected 400, got %d: %s", stream, rec.Code, rec.Body)
+		}
+		var body struct {
+			Error struct {
+				Type                  string `json:"type"`
+				Provider              string `json:"provider"`
+				Model                 string `json:"model"`
+				ContextWindow         int    `json:"context_window"`
+				EstimatedPromptTokens int    `json:"estimated_prompt_tokens"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Error.Type != "context_length_exceeded" || body.Error.Provider != "openai" || body.Error.Model != "gpt-4o" ||
+			body.Error.ContextWindow != 128000 || body.Error.EstimatedPromptTokens != estimate {
+			t.Errorf("stream %t: unexpected error body: %+v", stream, body.Error)
+		}
+		if n := atomic.LoadInt32(&fallbackCalls); n != 0 {
+			t.Errorf("stream %t: expected no failover, anthropic called %d times", stream, n)
+		}
+	}
+}
+
+func TestStreamToNonStreamingModelReturns400(t *testing.T) {
+	cfg := &config.Config{}
+	var upstreamCalls int32
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		openAIReply("gpt-4o-batch", "Hi", "stop", 10, 2)(w, r)
+	}})
+	db, mock := mockDB(t)
+	now := time.Now()
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o-batch").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", "openai", "gpt-4o-batch", 0.0025, 0.01, 128000, false, nil, 0.0, now, now))
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o-batch","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, &models.APIKey{ID: "key-1"}))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "does not support streaming") || !strings.Contains(body, `"stream": false`) {
+		t.Errorf("expected the error to suggest a non-stream request, got %q", body)
+	}
+	if ct := rec.Header().Get("Content-Type"); strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("the rejection was sent as a stream: %s", ct)
+	}
+	if n := atomic.LoadInt32(&upstreamCalls); n != 0 {
+		t.Errorf("expected no upstream call, got %d", n)
+	}
+}
+
+func TestJSONRepairOnMalformedAndUnrecoverableOutput(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, body string
+		wantContent         string
+		wantRepaired        bool
+	}{
+		{"recoverable", "```json\n{\"city\": \"Paris\",}\n``` Hope that helps!", `"repair_json":true`, `{"city": "Paris"}`, true},
+		{"unrecoverable", "Sorry, I can't produce that as JSON.", `"repair_json":true`, "Sorry, I can't produce that as JSON.", false},
+		{"valid", `{"city": "Paris"}`, `"repair_json":true`, `{"city": "Paris"}`, false},
+		{"not opted in", "```json\n{\"city\": \"Paris\"}\n```", `"repair_json":false`, "```json\n{\"city\": \"Paris\"}\n```", false},
+	} {
+		cfg := &config.Config{}
+		mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAIReply("gpt-4o", tc.content, "stop", 10, 8)})
+		db, mock := mockDB(t)
+		mock.MatchExpectationsInOrder(false)
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+		h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","response_format":{"type":"json_object"},`+tc.body+`,"messages":[{"role":"user","content":"Capital of France as JSON"}]}`, &models.APIKey{ID: "key-1"}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.name, rec.Code, rec.Body)
+		}
+		var resp providers.ChatResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Choices[0].Message.Content; got != tc.wantContent {
+			t.Errorf("%s: content %q, want %q", tc.name, got, tc.wantContent)
+		}
+		if repaired := rec.Header().Get("X-JSON-Repaired") == "true"; repaired != tc.wantRepaired {
+			t.Errorf("%s: X-JSON-Repaired %t, want %t", tc.name, repaired, tc.wantRepaired)
+		}
+	}
+}
+
+func TestSeedKeysTheCacheAndKeepsTheFingerprint(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	var seeds []string
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Seed *int `json:"seed"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		seed := "none"
+		if body.Seed != nil {
+			seed = fmt.Sprint(*body.Seed)
+		}
+		seeds = append(seeds, seed)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-%d","model":"gpt-4o","system_fingerprint":"fp_44709d6fcb","choices":[{"index":0,"message":{"role":"assistant","content":"Roll: %s"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":3,"total_tokens":13}}`, len(seeds), seed)
+	}})
+	db, mock := mockDB(t)
+	// Three fresh completions and one hit
+	for i := 0; i < 10; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+
+	for _, tc := range []struct {
+		seed    string
+		hit     bool
+		content string
+	}{
+		{`,"seed":42`, false, "Roll: 42"},
+		{`,"seed":42`, true, "Roll: 42"},
+		{`,"seed":7`, false, "Roll: 7"},
+		{``, false, "Roll: none"},
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o"`+tc.seed+`,"messages":[{"role":"user","content":"Roll a die."}]}`, key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("seed %q: expected 200, got %d: %s", tc.seed, rec.Code, rec.Body)
+		}
+		var resp providers.ChatResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if hit := rec.Header().Get("X-Cache-Hit") == "true"; hit != tc.hit {
+			t.Errorf("seed %q: cache hit %t, want %t", tc.seed, hit, tc.hit)
+		}
+		if resp.Choices[0].Message.Content != tc.content || resp.SystemFingerprint != "fp_44709d6fcb" {
+			t.Errorf("seed %q: got %q with fingerprint %q", tc.seed, resp.Choices[0].Message.Content, resp.SystemFingerprint)
+		}
+	}
+	if strings.Join(seeds, ",") != "42,7,none" {
+		t.Errorf("expected one upstream call per distinct seed, got %v", seeds)
+	}
+}
+
+func TestCacheNormalizationIsOptInPerKey(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	var upstreamCalls int32
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		openAIReply("gpt-4o", "Paris.", "stop", 14, 2)(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	// Three fresh completions and one hit
+	for i := 0; i < 10; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	normalizing := &models.APIKey{ID: "key-1", CacheEnabled: true, Features: map[string]interface{}{
+		models.FeatureCacheNormalizeSpace: true,
+		models.FeatureCacheNormalizeCase:  true,
+	}}
+	exact := &models.APIKey{ID: "key-2", CacheEnabled: true}
+
+	for _, tc := range []struct {
+		key     *models.APIKey
+		content string
+		hit     bool
+	}{
+		{normalizing, "What is the capital of France?", false},
+		{normalizing, "  what is the  capital of France? ", true},
+		{exact, "What is the capital of France?", false}, // the normalized entry isn't this key's slot
+		{exact, "  what is the  capital of France? ", false},
+	} {
+		rec := httptest.NewRecorder()
+		body, _ := json.Marshal(map[string]interface{}{"model": "gpt-4o", "messages": []map[string]string{{"role": "user", "content": tc.content}}})
+		h.HandleChatCompletion(rec, chatRequest(string(body), tc.key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %q: expected 200, got %d: %s", tc.key.ID, tc.content, rec.Code, rec.Body)
+		}
+		if hit := rec.Header().Get("X-Cache-Hit") == "true"; hit != tc.hit {
+			t.Errorf("%s %q: cache hit %t, want %t", tc.key.ID, tc.content, hit, tc.hit)
+		}
+	}
+	if n := atomic.LoadInt32(&upstreamCalls); n != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", n)
+	}
+}
+
+func TestSharedCacheKeyHits(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	var upstreamCalls int32
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		openAIReply("gpt-4o", "Refunds are issued within 14 days.", "stop", 900, 8)(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	// Three fresh completions and one hit
+	for i := 0; i < 10; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	tenantA := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	tenantB := &models.APIKey{ID: "key-2", CacheEnabled: true}
+	ask := func(question, extra string) string {
+		return `{"model":"gpt-4o"` + extra + `,"messages":[{"role":"system","content":"<policy documents>"},{"role":"user","content":"` + question + `"}]}`
+	}
+
+	for _, tc := range []struct {
+		name   string
+		key    *models.APIKey
+		body   string
+		header string
+		hit    bool
+	}{
+		{"first", tenantA, ask("How do refunds work?", `,"cache_key":"faq:refunds"`), "", false},
+		{"same cache_key, other wording", tenantA, ask("what's the refund policy", `,"cache_key":"faq:refunds"`), "", true},
+		{"other API key", tenantB, ask("How do refunds work?", `,"cache_key":"faq:refunds"`), "", false},
+		{"header, other parameters", tenantA, ask("How do refunds work?", `,"temperature":0.2`), "faq:refunds", false},
+	} {
+		req := chatRequest(tc.body, tc.key)
+		if tc.header != "" {
+			req.Header.Set("X-Cache-Key", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.name, rec.Code, rec.Body)
+		}
+		if hit := rec.Header().Get("X-Cache-Hit") == "true"; hit != tc.hit {
+			t.Errorf("%s: cache hit %t, want %t", tc.name, hit, tc.hit)
+		}
+	}
+	if n := atomic.LoadInt32(&upstreamCalls); n != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", n)
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(ask("How do refunds work?", `,"cache_key":"`+strings.Repeat("k", maxCacheKeyLength+1)+`"`), tenantA))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected an over-long cache_key rejected, got %d", rec.Code)
+	}
+}
+
+func TestCalculateCostPricesAnthropicPromptCache(t *testing.T) {
+	db, mock := mockDB(t)
+	expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015)
+	h := &ChatHandler{db: db}
+
+	resp := completion("claude-sonnet-4-5-20250929", "Clause 3 limits liability.", openai.FinishReasonStop, 1820, 8)
+	resp.Usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: 1500}
+	resp.CacheWriteTokens = 300
+
+	cost, err := h.calculateCost(context.Background(), "anthropic", "claude-sonnet-4-5-20250929", resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20 uncached + 1500 reads at 0.1x + 300 writes at 1.25x = 545 input tokens
+	want := 545.0/1000*0.003 + 8.0/1000*0.015
+	if fmt.Sprintf("%.6f", cost) != fmt.Sprintf("%.6f", want) {
+		t.Errorf("cost = %.6f, want %.6f", cost, want)
+	}
+}
+
+func TestMaxTokensClampedToTheKeyCap(t *testing.T) {
+	var sent []int
+	reply := anthropicReply("claude-sonnet-4-5-20250929", "Paris.", "end_turn", 14, 2)
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"anthropic": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			MaxTokens int `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body.MaxTokens)
+		reply(w, r)
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015) // cost
+		expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015) // context window
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	key := &models.APIKey{ID: "key-1", KeyPrefix: "gw_live_abc", MaxOutputTokens: 256}
+
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range []struct {
+		maxTokens string
+		clamped   bool
+	}{
+		{`"max_tokens":4000,`, true},
+		{`"max_completion_tokens":100,`, false},
+		{"", false}, // the provider's default would exceed the cap
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(`{"model":"claude-sonnet-4-5-20250929",`+tc.maxTokens+`"messages":[{"role":"user","content":"Capital of France?"}]}`, key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("X-MaxTokens-Clamped") == "true"; got != tc.clamped {
+			t.Errorf("%q: X-MaxTokens-Clamped %v, want %v", tc.maxTokens, got, tc.clamped)
+		}
+	}
+
+	if fmt.Sprint(sent) != "[256 100 256]" {
+		t.Errorf("upstream max_tokens %v, want [256 100 256]", sent)
+	}
+	if strings.Count(logged.String(), "Clamped max_tokens for key gw_live_abc from 4000 to 256") != 1 {
+		t.Errorf("expected the clamp logged once, got:\n%s", logged.String())
+	}
+}
+
+func TestOutOfRangeSamplingRejectedOrClamped(t *testing.T) {
+	// Gemini is one of the providers that errors on out-of-range values
+	var sent []string
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"google": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			GenerationConfig struct {
+				Temperature *float32 `json:"temperature"`
+				TopP        *float32 `json:"topP"`
+			} `json:"generationConfig"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if c := body.GenerationConfig; c.Temperature != nil && c.TopP != nil {
+			sent = append(sent, fmt.Sprintf("%g/%g", *c.Temperature, *c.TopP))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"Paris."}]},"finishReason":"STOP","index":0}],
+			"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":2,"totalTokenCount":11}}`))
+	}})
+	db, mock := mockDB(t)
+	expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025) // cost
+	expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025) // context window
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	body := `{"model":"gemini-2.5-flash","temperature":5,"top_p":-0.5,"messages":[{"role":"user","content":"Capital of France?"}]}`
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(body, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "temperature must be between 0 and 2") {
+		t.Errorf("expected a 400 naming temperature, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(sent) != 0 {
+		t.Fatalf("the rejected request reached the provider: %v", sent)
+	}
+
+	cfg.ClampSamplingParams = true
+	rec = httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(body, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 when clamping, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Params-Clamped"); got != "temperature,top_p" {
+		t.Errorf("X-Params-Clamped %q", got)
+	}
+	if fmt.Sprint(sent) != "[2/0]" {
+		t.Errorf("upstream got temperature/top_p %v, want [2/0]", sent)
+	}
+}
+
+func TestEveryResponseCarriesUsage(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	completions := openAIReply("gpt-4o", "Paris.", "stop", 14, 2)
+	stream := openAITokenStream([]string{"Par", "is."})
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if bytes.Contains(body, []byte(`"stream":true`)) {
+			stream(w, r)
+			return
+		}
+		completions(w, r)
+	}})
+	db, mock := mockDB(t)
+	// The fresh completion is priced, its cache TTL and context window looked
+	// up; the hit prices its savings and looks up the window; the stream checks
+	// the model streams, looks up the window and prices it
+	for i := 0; i < 8; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	complete := func() providers.ChatResponse {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(body, key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp providers.ChatResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	fresh := complete()
+	if fresh.Usage.PromptTokens != 14 || fresh.Usage.CompletionTokens != 2 || fresh.Usage.TotalTokens != 16 || fresh.CostUSD == 0 {
+		t.Errorf("fresh response: usage %+v, cost %v", fresh.Usage, fresh.CostUSD)
+	}
+
+	cached := complete()
+	if cached.Usage != fresh.Usage {
+		t.Errorf("cache hit usage %+v, want the original %+v", cached.Usage, fresh.Usage)
+	}
+	if cached.CostUSD != 0 || cached.CacheSavingsUSD != fresh.CostUSD {
+		t.Errorf("cache hit cost %v and savings %v, want 0 and %v", cached.CostUSD, cached.CacheSavingsUSD, fresh.CostUSD)
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Capital of France?"}]}`, key))
+	events := sseEvents(t, rec.Body.String())
+	if len(events) < 2 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("expected the stream to end with [DONE], got %q", events)
+	}
+	var last providers.StreamChunk
+	if err := json.Unmarshal([]byte(events[len(events)-2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Usage == nil || last.Usage.PromptTokens != 10 || last.Usage.CompletionTokens != 60 || last.CostUSD == nil {
+		t.Errorf("expected a usage chunk with the cost right before [DONE], got %s", events[len(events)-2])
+	}
+}
+
+func TestLogRequestStoresTheMetadata(t *testing.T) {
+	db, mock, logs, rows := mockLoggingDB(t)
+	expectLogFlush(mock)
+	cfg := &config.Config{}
+	h := &ChatHandler{cfg: cfg, providerMgr: testManager(t, cfg, nil), db: db, logs: logs}
+	key := &models.APIKey{ID: "key-1"}
+
+	tagged := providers.ChatRequest{Model: "gpt-4o", Metadata: map[string]string{"team": "search", "feature": "autocomplete", "env": "prod"}}
+	h.logRequest(context.Background(), key, tagged, completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2), "openai", time.Millisecond, false, false, false, nil)
+	h.logRequest(context.Background(), key, providers.ChatRequest{Model: "gpt-4o"}, completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2), "openai", time.Millisecond, false, false, false, nil)
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(logged))
+	}
+	if got := logged[0]["metadata"]; got != `{"env":"prod","feature":"autocomplete","team":"search"}` {
+		t.Errorf("expected the metadata as JSON, got %v", got)
+	}
+	if logged[1]["metadata"] != nil {
+		t.Errorf("expected NULL metadata for an untagged request, got %v", logged[1]["metadata"])
+	}
+}
+
+func TestMetadataOverTheLimitsIsRejected(t *testing.T) {
+	h := &ChatHandler{cfg: &config.Config{}}
+	tooMany := make([]string, 17)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf(`"k%d":"v"`, i)
+	}
+	for name, metadata := range map[string]string{
+		"17 keys":        "{" + strings.Join(tooMany, ",") + "}",
+		"empty key":      `{"":"v"}`,
+		"long key":       `{"` + strings.Repeat("k", 65) + `":"v"}`,
+		"long value":     `{"team":"` + strings.Repeat("v", 513) + `"}`,
+		"non-string tag": `{"team":7}`,
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","metadata":`+metadata+`,"messages":[{"role":"user","content":"Hi"}]}`, &models.APIKey{ID: "key-1"}))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "metadata") {
+			t.Errorf("%s: expected a 400 naming metadata, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestPromptPreludeIsSentAndCachedPerEffectiveRequest(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	var mu sync.Mutex
+	var systems []string
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		var system []string
+		for _, message := range body.Messages {
+			if message.Role == openai.ChatMessageRoleSystem {
+				system = append(system, message.Content)
+			}
+		}
+		mu.Lock()
+		systems = append(systems, strings.Join(system, " | "))
+		mu.Unlock()
+		openAIReply("gpt-4o", "Paris.", "stop", 20, 2)(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	// Three fresh completions and one hit
+	for i := 0; i < 10; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	acme := &models.APIKey{ID: "key-1", CacheEnabled: true, PromptPrelude: "You work for Acme.", PromptSuffix: "Never share secrets."}
+	override := &models.APIKey{ID: "key-2", CacheEnabled: true, PromptPrelude: "You work for Globex.", PromptPreludeOverride: true}
+	plain := &models.APIKey{ID: "key-3", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Capital of France?"}]}`
+
+	// The same client request is a different effective request under each key
+	for _, tc := range []struct {
+		key *models.APIKey
+		hit bool
+	}{
+		{acme, false},
+		{acme, true},
+		{override, false},
+		{plain, false},
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(body, tc.key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", tc.key.ID, rec.Code, rec.Body)
+		}
+		if hit := rec.Header().Get("X-Cache-Hit") == "true"; hit != tc.hit {
+			t.Errorf("%s: cache hit %t, want %t", tc.key.ID, hit, tc.hit)
+		}
+	}
+
+	want := []string{
+		"You work for Acme. | Be brief. | Never share secrets.",
+		"You work for Globex.",
+		"Be brief.",
+	}
+	if strings.Join(systems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("upstream system prompts:\n%s\nwant:\n%s", strings.Join(systems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEchoRequestedModelAfterFailover(t *testing.T) {
+	for _, echo := range []bool{true, false} {
+		cfg := &config.Config{EchoRequestedModel: echo}
+		mgr := testManager(t, cfg, map[string]http.HandlerFunc{
+			"openai":    statusReply(http.StatusServiceUnavailable),
+			"anthropic": anthropicReply("claude-sonnet-4-5-20250929", "Paris.", "end_turn", 14, 2),
+		})
+		db, mock, logs, rows := mockLoggingDB(t)
+		mock.MatchExpectationsInOrder(false)
+		expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015)
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+		expectLogFlush(mock)
+		h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs, alerts: alerts.New("", 0)}
+
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+		logs.Close()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("echo %t: expected 200, got %d: %s", echo, rec.Code, rec.Body)
+		}
+
+		var resp providers.ChatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		want := "claude-sonnet-4-5-20250929"
+		if echo {
+			want = "gpt-4o"
+		}
+		if resp.Model != want {
+			t.Errorf("echo %t: response model %q, want %q", echo, resp.Model, want)
+		}
+		// The served model is still reported and logged
+		if rec.Header().Get("X-Served-Model") != "claude-sonnet-4-5-20250929" {
+			t.Errorf("echo %t: X-Served-Model %q", echo, rec.Header().Get("X-Served-Model"))
+		}
+		if logged := rows.logged(); len(logged) != 1 || logged[0]["served_model"] != "claude-sonnet-4-5-20250929" {
+			t.Errorf("echo %t: logged %v", echo, logged)
+		}
+	}
+}
+
+func TestKeySafetySettingsReachGemini(t *testing.T) {
+	var sent []json.RawMessage
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"google": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SafetySettings json.RawMessage `json:"safetySettings"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body.SafetySettings)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":1,"totalTokenCount":6}}`)
+	}})
+	db, mock := mockDB(t)
+	expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025)
+	expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	key := &models.APIKey{ID: "key-1", GeminiSafetySettings: map[string]string{"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_ONLY_HIGH"}}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gemini-2.5-flash","safety_settings":[{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}],"messages":[{"role":"user","content":"Dosage of ibuprofen for adults?"}]}`, key))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(sent) != 1 || string(sent[0]) != `[{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","threshold":"BLOCK_ONLY_HIGH"},{"category":"HARM_CATEGORY_HARASSMENT","threshold":"BLOCK_NONE"}]` {
+		t.Errorf("unexpected safetySettings sent: %s", sent)
+	}
+
+	// Unknown names are rejected before any upstream call
+	rec = httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gemini-2.5-flash","safety_settings":[{"category":"HARM_CATEGORY_MEDICAL","threshold":"BLOCK_NONE"}],"messages":[{"role":"user","content":"Hi"}]}`, key))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "HARM_CATEGORY_MEDICAL") {
+		t.Errorf("expected 400 naming the category, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(sent) != 1 {
+		t.Errorf("expected no upstream call for the invalid request, got %d calls", len(sent))
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// openChoiceStreams serves an n > 1 stream by opening one upstream stream per
+// choice, concurrently, and multiplexing them. Each fails over on its own; the
+// first choice's provider is the one reported. With a seed, choice i uses
+// seed+i so the choices differ but stay reproducible.
+func (h *ChatHandler) openChoiceStreams(ctx context.Context, req providers.ChatRequest) (providers.StreamReader, string, error) {
+	streams := make([]providers.StreamReader, req.N)
+	names := make([]string, req.N)
+	errs := make([]error, req.N)
+
+	var wg sync.WaitGroup
+	for i := 0; i < req.N; i++ {
+		single := req
+		single.N = 0
+		if req.Seed != nil {
+			seed := *req.Seed + i
+			single.Seed = &seed
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			streams[i], names[i], errs[i] = h.providerMgr.ChatCompletionStream(ctx, single)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			for _, stream := range streams {
+				if stream != nil {
+					stream.Close()
+				}
+			}
+			return nil, names[i], err
+		}
+	}
+	return newChoiceStream(streams), names[0], nil
+}
+
+// choiceChunk is one chunk (or the error ending the stream) read from choice index
+type choiceChunk struct {
+	index int
+	chunk providers.StreamChunk
+	err   error
+}
+
+// choiceStream multiplexes one upstream stream per choice into a single
+// stream. Chunks are forwarded as they arrive, tagged with their stream's choice
+// index under one completion ID. Each stream's usage is held back and the sum
+// sent in a final usage-only chunk once every choice has finished.
+type choiceStream struct {
+	streams []providers.StreamReader
+	chunks  chan choiceChunk
+	stop    chan struct{}
+	once    sync.Once
+
+	open  int             // streams that haven't reached EOF
+	id    string          // completion ID reported for every chunk
+	usage []*openai.Usage // last usage each stream reported
+}
+
+// newChoiceStream starts reading each stream; stream i becomes choice i
+func newChoiceStream(streams []providers.StreamReader) *choiceStream {
+	s := &choiceStream{
+		streams: streams,
+		chunks:  make(chan choiceChunk),
+		stop:    make(chan struct{}),
+		open:    len(streams),
+		usage:   make([]*openai.Usage, len(streams)),
+	}
+	for i, stream := range streams {
+		go s.read(i, stream)
+	}
+	return s
+}
+
+// read forwards one stream's chunks until it ends or the multiplexer closes
+func (s *choiceStream) read(index int, stream providers.StreamReader) {
+	for {
+		chunk, err := stream.Recv()
+		select {
+		case s.chunks <- choiceChunk{index: index, chunk: chunk, err: err}:
+		case <-s.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *choiceStream) Recv() (providers.StreamChunk, error) {
+	for s.open > 0 {
+		next := <-s.chunks
+		if next.err == io.EOF {
+			s.open--
+			continue
+		}
+		if next.err != nil {
+			return providers.StreamChunk{}, fmt.Errorf("choice %d: %w", next.index, next.err)
+		}
+
+		chunk := next.chunk
+		if chunk.Usage != nil {
+			s.usage[next.index] = chunk.Usage
+			chunk.Usage = nil
+		}
+		if s.id == "" {
+			s.id = chunk.ID
+		}
+		chunk.ID = s.id
+		for i := range chunk.Choices {
+			chunk.Choices[i].Index = next.index
+		}
+		return chunk, nil
+	}
+
+	// All choices are done: report their combined usage once, then EOF
+	var total *openai.Usage
+	for i, usage := range s.usage {
+		if usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &openai.Usage{}
+		}
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.TotalTokens += usage.TotalTokens
+		s.usage[i] = nil
+	}
+	if total != nil {
+		return providers.StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+			ID:      s.id,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   total,
+		}}, nil
+	}
+	return providers.StreamChunk{}, io.EOF
+}
+
+// Close stops the readers and closes every upstream stream
+func (s *choiceStream) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	var firstErr error
+	for _, stream := range s.streams {
+		if err := stream.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
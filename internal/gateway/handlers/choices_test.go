@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// chanStream is a stream fed by the test one chunk at a time; closing chunks ends it
+type chanStream struct {
+	chunks chan providers.StreamChunk
+	closed bool
+}
+
+func (s *chanStream) Recv() (providers.StreamChunk, error) {
+	chunk, ok := <-s.chunks
+	if !ok {
+		return providers.StreamChunk{}, io.EOF
+	}
+	return chunk, nil
+}
+
+func (s *chanStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestChoiceStreamTagsInterleavedChunksByIndex(t *testing.T) {
+	first := &chanStream{chunks: make(chan providers.StreamChunk)}
+	second := &chanStream{chunks: make(chan providers.StreamChunk)}
+	s := newChoiceStream([]providers.StreamReader{first, second})
+
+	usageChunk := func(prompt, completion int) providers.StreamChunk {
+		chunk := deltaChunk(openai.ChatCompletionStreamChoiceDelta{}, "")
+		chunk.Choices = nil
+		chunk.Usage = &openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+		return chunk
+	}
+	// Each upstream numbers its own choice 0 and has its own completion ID
+	second0 := deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "Ly"}, "")
+	second0.ID = "chatcmpl-2"
+
+	for _, step := range []struct {
+		stream *chanStream
+		chunk  providers.StreamChunk
+		index  int
+	}{
+		{first, deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "Par"}, ""), 0},
+		{second, second0, 1},
+		{second, deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "on."}, openai.FinishReasonStop), 1},
+		{first, deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "is."}, openai.FinishReasonStop), 0},
+	} {
+		step.stream.chunks <- step.chunk
+		got, err := s.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != "chatcmpl-1" || len(got.Choices) != 1 || got.Choices[0].Index != step.index || got.Choices[0].Delta.Content != step.chunk.Choices[0].Delta.Content {
+			t.Errorf("expected %q as choice %d of chatcmpl-1, got %+v", step.chunk.Choices[0].Delta.Content, step.index, got)
+		}
+	}
+
+	// Usage is held back until every choice has finished, then summed
+	for _, step := range []struct {
+		stream *chanStream
+		chunk  providers.StreamChunk
+	}{{second, usageChunk(10, 2)}, {first, usageChunk(10, 3)}} {
+		step.stream.chunks <- step.chunk
+		got, err := s.Recv()
+		if err != nil || got.Usage != nil {
+			t.Errorf("expected a choice's usage held back, got %+v, %v", got, err)
+		}
+		close(step.stream.chunks)
+	}
+	got, err := s.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Choices) != 0 || got.Usage == nil || *got.Usage != (openai.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25}) {
+		t.Errorf("expected one combined usage chunk, got %+v", got)
+	}
+	if _, err := s.Recv(); err != io.EOF {
+		t.Errorf("expected EOF after the usage, got %v", err)
+	}
+
+	s.Close()
+	if !first.closed || !second.closed {
+		t.Error("expected every upstream stream closed")
+	}
+}
+
+func TestMultipleChoicesStreamConcurrently(t *testing.T) {
+	// Each choice is its own upstream call, told apart by its seed. Neither
+	// answers until both have arrived, so a sequential fan-out would stall.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	replies := map[int][]string{7: {"Par", "is."}, 8: {"Ly", "on."}}
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Seed int  `json:"seed"`
+			N    *int `json:"n"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.N != nil {
+			t.Errorf("n forwarded upstream: %d", *body.N)
+		}
+		arrived.Done()
+		done := make(chan struct{})
+		go func() { arrived.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("the choices' upstream calls weren't made concurrently")
+		}
+		openAITokenStream(replies[body.Seed])(w, r)
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"n":2,"seed":7,"messages":[{"role":"user","content":"Name a French city."}]}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	events := sseEvents(t, rec.Body.String())
+	if strings.Count(rec.Body.String(), "[DONE]") != 1 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("expected one [DONE] after every choice, got %v", events)
+	}
+	content := map[int]string{}
+	finishes := map[int]openai.FinishReason{}
+	var usage *openai.Usage
+	for _, data := range events[:len(events)-1] {
+		var chunk providers.StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		if chunk.ID != "c" {
+			t.Errorf("expected one completion ID, got %q", chunk.ID)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content[choice.Index] += choice.Delta.Content
+			if choice.FinishReason != "" {
+				finishes[choice.Index] = choice.FinishReason
+			}
+		}
+	}
+	if len(content) != 2 || content[0] != "Paris." || content[1] != "Lyon." {
+		t.Errorf("expected choice 0 Paris. and choice 1 Lyon., got %q", content)
+	}
+	if finishes[0] != openai.FinishReasonStop || finishes[1] != openai.FinishReasonStop {
+		t.Errorf("expected each choice to finish, got %v", finishes)
+	}
+	if usage == nil || usage.PromptTokens != 20 || usage.CompletionTokens != 120 || usage.TotalTokens != 140 {
+		t.Errorf("expected the usage of both calls, got %+v", usage)
+	}
+}
+
+func TestMultipleChoicesRequireStreaming(t *testing.T) {
+	h := &ChatHandler{cfg: &config.Config{}}
+	for body, want := range map[string]string{
+		`{"model":"gpt-4o","n":2,"messages":[{"role":"user","content":"Hi"}]}`:               "only supported with",
+		`{"model":"gpt-4o","stream":true,"n":9,"messages":[{"role":"user","content":"Hi"}]}`: "n must be between 1 and 8",
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(body, &models.APIKey{ID: "key-1"}))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: expected 400 with %q, got %d: %s", body, want, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIPMiddleware resolves the real client IP once and stores it in the request context
+func (m *Middleware) ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "client_ip", clientIP(r, m.cfg.TrustedProxies))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIPFromContext returns the IP stored by ClientIPMiddleware, or "" if unset
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value("client_ip").(string)
+	return ip
+}
+
+// clientIP returns the address of the client that sent the request. X-Forwarded-For
+// and X-Real-IP are only honoured when the immediate peer is a trusted proxy;
+// X-Forwarded-For is then walked right to left, skipping trusted hops, so a client
+// can't spoof its address by prepending entries.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	peer := remoteIP(r.RemoteAddr)
+	if !isTrustedProxy(peer, trusted) {
+		return peer
+	}
+
+	header := r.Header.Get("X-Forwarded-For")
+	if header == "" {
+		// Proxies like nginx may only set X-Real-IP
+		if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return peer
+	}
+
+	forwarded := strings.Split(header, ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			// Garbage in the chain - stop at the last address we could trust
+			break
+		}
+		if !isTrustedProxy(hop, trusted) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer
+}
+
+// remoteIP strips the port from a RemoteAddr
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// isTrustedProxy reports whether ip falls within one of the trusted networks
+func isTrustedProxy(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range trusted {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
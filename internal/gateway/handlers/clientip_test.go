@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// trustedNets parses CIDRs for TrustedProxies
+func trustedNets(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// fromPeer builds a request arriving from peer with the given forwarding headers
+func fromPeer(peer, forwardedFor, realIP string) *http.Request {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	r.RemoteAddr = peer + ":54321"
+	if forwardedFor != "" {
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	if realIP != "" {
+		r.Header.Set("X-Real-IP", realIP)
+	}
+	return r
+}
+
+func TestClientIPBehindTrustedProxies(t *testing.T) {
+	trusted := trustedNets(t, "10.0.0.0/8", "192.168.1.1/32")
+
+	for _, tc := range []struct {
+		name                       string
+		peer, forwardedFor, realIP string
+		want                       string
+	}{
+		{"direct client", "203.0.113.7", "", "", "203.0.113.7"},
+		{"one trusted hop", "10.0.0.5", "203.0.113.7", "", "203.0.113.7"},
+		{"chain of trusted hops", "10.0.0.5", "203.0.113.7, 192.168.1.1, 10.1.2.3", "", "203.0.113.7"},
+		{"trusted peer without headers", "10.0.0.5", "", "", "10.0.0.5"},
+		{"every hop trusted", "10.0.0.5", "10.9.9.9, 192.168.1.1", "", "10.9.9.9"},
+		{"garbage stops the walk", "10.0.0.5", "203.0.113.7, not-an-ip, 10.1.2.3", "", "10.1.2.3"},
+		{"IPv6 client", "10.0.0.5", "2001:db8::1", "", "2001:db8::1"},
+	} {
+		if got := clientIP(fromPeer(tc.peer, tc.forwardedFor, tc.realIP), trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIPRateLimitCapsEachClientIP(t *testing.T) {
+	client, _ := testRedis(t)
+	m := &Middleware{cfg: &config.Config{IPRateLimit: 3, TrustedProxies: trustedNets(t, "10.0.0.0/8")}, redis: client}
+	handler := m.ClientIPMiddleware(m.IPRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	send := func(r *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// Two clients behind the same load balancer are capped separately
+	for i := 0; i < 3; i++ {
+		if code := send(fromPeer("10.0.0.5", "203.0.113.7", "")); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, fromPeer("10.0.0.5", "203.0.113.7", ""))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the cap, got %d", rec.Code)
+	}
+	if code := send(fromPeer("10.0.0.5", "198.51.100.1", "")); code != http.StatusOK {
+		t.Errorf("another client behind the proxy was limited: %d", code)
+	}
+
+	// The cap applies without a key, before auth
+	if code := send(fromPeer("203.0.113.7", "", "")); code != http.StatusTooManyRequests {
+		t.Errorf("the same client connecting directly should share its cap, got %d", code)
+	}
+}
+
+func TestIPRateLimitDisabledAtZero(t *testing.T) {
+	m := &Middleware{cfg: &config.Config{}}
+	handler := m.IPRateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, fromPeer("203.0.113.7", "", ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected no limit, got %d", rec.Code)
+		}
+	}
+}
+
+func TestSpoofedForwardingHeaders(t *testing.T) {
+	trusted := trustedNets(t, "10.0.0.0/8")
+
+	for _, tc := range []struct {
+		name                       string
+		peer, forwardedFor, realIP string
+		want                       string
+	}{
+		{"untrusted peer, spoofed X-Forwarded-For", "203.0.113.7", "198.51.100.1", "", "203.0.113.7"},
+		{"untrusted peer, spoofed X-Real-IP", "203.0.113.7", "", "198.51.100.1", "203.0.113.7"},
+		{"untrusted peer claiming a trusted hop", "203.0.113.7", "198.51.100.1, 10.0.0.5", "", "203.0.113.7"},
+		{"trusted peer, client prepends a spoof", "10.0.0.5", "198.51.100.1, 203.0.113.7", "", "203.0.113.7"},
+		{"trusted peer, X-Real-IP", "10.0.0.5", "", "203.0.113.7", "203.0.113.7"},
+		{"trusted peer, X-Forwarded-For wins over X-Real-IP", "10.0.0.5", "203.0.113.7", "198.51.100.1", "203.0.113.7"},
+		{"trusted peer, garbage X-Real-IP", "10.0.0.5", "", "not-an-ip", "10.0.0.5"},
+	} {
+		if got := clientIP(fromPeer(tc.peer, tc.forwardedFor, tc.realIP), trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// Without TRUSTED_PROXIES, forwarding headers are never believed
+	if got := clientIP(fromPeer("10.0.0.5", "203.0.113.7", "203.0.113.7"), nil); got != "10.0.0.5" {
+		t.Errorf("no trusted proxies: got %q", got)
+	}
+}
+
+func TestClientIPStoredInGatewayLogs(t *testing.T) {
+	db, mock, logs, rows := mockLoggingDB(t)
+	expectLogFlush(mock)
+	cfg := &config.Config{TrustedProxies: trustedNets(t, "10.0.0.0/8")}
+	h := &ChatHandler{cfg: cfg, providerMgr: testManager(t, cfg, nil), db: db, logs: logs}
+	m := &Middleware{cfg: cfg}
+
+	for _, r := range []*http.Request{
+		fromPeer("10.0.0.5", "198.51.100.1, 203.0.113.7", ""),
+		fromPeer("203.0.113.9", "198.51.100.1", ""),
+	} {
+		m.ClientIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.logRequest(r.Context(), &models.APIKey{ID: "key-1"}, providers.ChatRequest{Model: "gpt-4o"}, completion("gpt-4o", "Hi", openai.FinishReasonStop, 10, 2), "openai", time.Millisecond, false, false, false, nil)
+		})).ServeHTTP(httptest.NewRecorder(), r)
+	}
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 logged rows, got %d", len(logged))
+	}
+	for i, want := range []string{"203.0.113.7", "203.0.113.9"} {
+		if logged[i]["client_ip"] != want {
+			t.Errorf("row %d: client_ip = %v, want %s", i, logged[i]["client_ip"], want)
+		}
+	}
+}
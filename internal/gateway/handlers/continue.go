@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// autoContinue re-requests a completion cut off by the token limit, asking the
+// model to carry on from its partial output, until it stops naturally or
+// AUTO_CONTINUE_MAX continuations have run. The pieces are stitched into resp
+// and their usage summed, and each call's cost is added at the prices of the
+// model that served it. Returns the
+// number of continuations made; a failed continuation keeps what was produced.
+func (h *ChatHandler) autoContinue(ctx context.Context, req providers.ChatRequest, resp *providers.ChatResponse) int {
+	if !req.AutoContinue || len(resp.Choices) == 0 {
+		return 0
+	}
+
+	continuations := 0
+	for continuations < h.cfg.AutoContinueMax && resp.Choices[0].FinishReason == openai.FinishReasonLength {
+		contReq := req
+		contReq.Messages = append(append([]openai.ChatCompletionMessage{}, req.Messages...),
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: resp.Choices[0].Message.Content},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: resumePrompt},
+		)
+
+		next, providerName, _, err := h.providerMgr.ChatCompletion(ctx, contReq)
+		if err != nil {
+			log.Printf("Auto-continue for %s failed after %d continuations, returning truncated output: %v", req.Model, continuations, err)
+			break
+		}
+		if len(next.Choices) == 0 {
+			break
+		}
+		continuations++
+
+		resp.Choices[0].Message.Content += next.Choices[0].Message.Content
+		resp.Choices[0].FinishReason = next.Choices[0].FinishReason
+		addUsage(resp, next)
+		h.addCallCost(ctx, resp, next, providerName, contReq.Model)
+	}
+	return continuations
+}
+
+// addUsage adds next's token counts to resp's
+func addUsage(resp, next *providers.ChatResponse) {
+	resp.Usage.PromptTokens += next.Usage.PromptTokens
+	resp.Usage.CompletionTokens += next.Usage.CompletionTokens
+	resp.Usage.TotalTokens += next.Usage.TotalTokens
+	resp.CacheWriteTokens += next.CacheWriteTokens
+	resp.UsageEstimated = resp.UsageEstimated || next.UsageEstimated
+
+	if next.Usage.PromptTokensDetails != nil {
+		if resp.Usage.PromptTokensDetails == nil {
+			resp.Usage.PromptTokensDetails = &openai.PromptTokensDetails{}
+		}
+		resp.Usage.PromptTokensDetails.CachedTokens += next.Usage.PromptTokensDetails.CachedTokens
+	}
+	if next.Usage.CompletionTokensDetails != nil {
+		if resp.Usage.CompletionTokensDetails == nil {
+			resp.Usage.CompletionTokensDetails = &openai.CompletionTokensDetails{}
+		}
+		resp.Usage.CompletionTokensDetails.ReasoningTokens += next.Usage.CompletionTokensDetails.ReasoningTokens
+	}
+}
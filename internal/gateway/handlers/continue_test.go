@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// truncatingUpstream answers the first truncate calls with a "length" finish and
+// the rest with a natural stop, recording the messages of each call
+func truncatingUpstream(truncate int) (http.HandlerFunc, func() [][]openai.ChatCompletionMessage) {
+	var mu sync.Mutex
+	var calls [][]openai.ChatCompletionMessage
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls = append(calls, body.Messages)
+		n := len(calls)
+		mu.Unlock()
+		if n <= truncate {
+			openAIReply("gpt-4o", "The quick brown", "length", 20, 3)(w, r)
+			return
+		}
+		openAIReply("gpt-4o", " fox jumps.", "stop", 30, 4)(w, r)
+	}
+	return handler, func() [][]openai.ChatCompletionMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestAutoContinueStitchesATruncatedCompletion(t *testing.T) {
+	cfg := &config.Config{AutoContinueMax: 3}
+	upstream, calls := truncatingUpstream(1)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","auto_continue":true,"max_tokens":3,"messages":[{"role":"user","content":"Finish the pangram."}]}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0]; got.Message.Content != "The quick brown fox jumps." || got.FinishReason != openai.FinishReasonStop {
+		t.Errorf("expected the stitched completion, got %q (%s)", got.Message.Content, got.FinishReason)
+	}
+	if rec.Header().Get("X-Auto-Continued") != "1" {
+		t.Errorf("expected X-Auto-Continued 1, got %q", rec.Header().Get("X-Auto-Continued"))
+	}
+
+	// Usage and cost cover both calls
+	if resp.Usage.PromptTokens != 50 || resp.Usage.CompletionTokens != 7 || resp.Usage.TotalTokens != 57 {
+		t.Errorf("expected summed usage 50/7/57, got %+v", resp.Usage)
+	}
+	if rec.Header().Get("X-Cost-USD") != "0.000195" {
+		t.Errorf("expected the cost of both calls, got %s", rec.Header().Get("X-Cost-USD"))
+	}
+
+	// The continuation carries the partial output and asks the model to go on
+	sent := calls()
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", len(sent))
+	}
+	cont := sent[1]
+	if len(cont) != 3 || cont[1].Role != openai.ChatMessageRoleAssistant || cont[1].Content != "The quick brown" || cont[2].Content != resumePrompt {
+		t.Errorf("unexpected continuation messages: %+v", cont)
+	}
+}
+
+func TestAutoContinueStopsAtTheCap(t *testing.T) {
+	cfg := &config.Config{AutoContinueMax: 2}
+	upstream, calls := truncatingUpstream(10)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	req := chatRequest(`{"model":"gpt-4o","messages":[{"role":"user","content":"Finish the pangram."}]}`, &models.APIKey{ID: "key-1"})
+	req.Header.Set("X-Auto-Continue", "true")
+	h.HandleChatCompletion(rec, req)
+
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls()) != 3 || rec.Header().Get("X-Auto-Continued") != "2" {
+		t.Errorf("expected the first call and 2 continuations, got %d calls (%q)", len(calls()), rec.Header().Get("X-Auto-Continued"))
+	}
+	if got := resp.Choices[0]; got.FinishReason != openai.FinishReasonLength || got.Message.Content != "The quick brownThe quick brownThe quick brown" {
+		t.Errorf("expected the capped output still truncated, got %q (%s)", got.Message.Content, got.FinishReason)
+	}
+	if resp.Usage.PromptTokens != 60 || resp.Usage.CompletionTokens != 9 {
+		t.Errorf("expected usage of all 3 calls, got %+v", resp.Usage)
+	}
+}
+
+func TestAutoContinueIsOptIn(t *testing.T) {
+	cfg := &config.Config{AutoContinueMax: 3}
+	upstream, calls := truncatingUpstream(1)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","messages":[{"role":"user","content":"Finish the pangram."}]}`, &models.APIKey{ID: "key-1"}))
+
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls()) != 1 || rec.Header().Get("X-Auto-Continued") != "" || resp.Choices[0].FinishReason != openai.FinishReasonLength {
+		t.Errorf("expected the truncated completion returned as-is, got %d calls", len(calls()))
+	}
+}
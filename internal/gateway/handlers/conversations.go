@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// errConversationStore marks a failure to read stored history, as opposed to a bad request
+var errConversationStore = errors.New("conversation storage unavailable")
+
+// ConversationHandler handles server-side conversations
+type ConversationHandler struct {
+	db *database.DB
+}
+
+// NewConversationHandler creates a new conversation handler
+func NewConversationHandler(db *database.DB) *ConversationHandler {
+	return &ConversationHandler{db: db}
+}
+
+// createConversationRequest is the optional body of POST /v1/conversations
+type createConversationRequest struct {
+	Messages []openai.ChatCompletionMessage `json:"messages"` // e.g. a system prompt
+}
+
+// conversationResponse describes a conversation and its stored messages
+type conversationResponse struct {
+	ID        string                         `json:"id"`
+	Object    string                         `json:"object"`
+	Messages  []openai.ChatCompletionMessage `json:"messages"`
+	CreatedAt time.Time                      `json:"created_at"`
+}
+
+// HandleCreateConversation handles POST /v1/conversations, optionally seeded with messages
+func (h *ConversationHandler) HandleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional
+	var req createConversationRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		var bodyErr *bodyError
+		if !errors.As(err, &bodyErr) || bodyErr.Reason != bodyEmpty {
+			writeBodyError(w, err)
+			return
+		}
+	}
+
+	conversation, err := h.db.CreateConversation(ctx, apiKey.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(req.Messages) > 0 {
+		if err := appendConversation(ctx, h.db, conversation.ID, req.Messages); err != nil {
+			http.Error(w, fmt.Sprintf("failed to store messages: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	messages := req.Messages
+	if messages == nil {
+		messages = []openai.ChatCompletionMessage{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(conversationResponse{
+		ID:        conversation.ID,
+		Object:    "conversation",
+		Messages:  messages,
+		CreatedAt: conversation.CreatedAt,
+	})
+}
+
+// HandleGetConversation handles GET /v1/conversations/{id}
+func (h *ConversationHandler) HandleGetConversation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	messages, err := loadConversation(ctx, h.db, id, apiKey.ID)
+	if errors.Is(err, database.ErrConversationNotFound) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []openai.ChatCompletionMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversationResponse{
+		ID:       id,
+		Object:   "conversation",
+		Messages: messages,
+	})
+}
+
+// loadConversation reads a key's stored conversation history
+func loadConversation(ctx context.Context, db *database.DB, conversationID, apiKeyID string) ([]openai.ChatCompletionMessage, error) {
+	stored, err := db.GetConversationMessages(ctx, conversationID, apiKeyID)
+	if errors.Is(err, database.ErrConversationNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errConversationStore, err)
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(stored))
+	for _, entry := range stored {
+		var message openai.ChatCompletionMessage
+		if err := json.Unmarshal([]byte(entry.Message), &message); err != nil {
+			return nil, fmt.Errorf("%w: corrupt message: %v", errConversationStore, err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// appendConversation stores messages at the end of a conversation
+func appendConversation(ctx context.Context, db *database.DB, conversationID string, messages []openai.ChatCompletionMessage) error {
+	encoded := make([]string, 0, len(messages))
+	for _, message := range messages {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		encoded = append(encoded, string(body))
+	}
+	return db.AppendConversationMessages(ctx, conversationID, encoded)
+}
+
+// continueConversation prepends a stored conversation's history to the
+// request, keeping the client's new turns aside to be saved with the reply
+func (h *ChatHandler) continueConversation(ctx context.Context, apiKey *models.APIKey, req *providers.ChatRequest) error {
+	history, err := loadConversation(ctx, h.db, req.ConversationID, apiKey.ID)
+	if err != nil {
+		return err
+	}
+	req.ConversationTurns = req.Messages
+	req.Messages = append(history, req.Messages...)
+	return nil
+}
+
+// saveConversationTurns stores the request's new turns and the assistant's
+// reply. A failure is logged; the client already has its response.
+func (h *ChatHandler) saveConversationTurns(ctx context.Context, req providers.ChatRequest, resp *providers.ChatResponse) {
+	if req.ConversationID == "" || resp == nil || len(resp.Choices) == 0 {
+		return
+	}
+
+	turns := append(append([]openai.ChatCompletionMessage{}, req.ConversationTurns...), resp.Choices[0].Message)
+	if err := appendConversation(context.WithoutCancel(ctx), h.db, req.ConversationID, turns); err != nil {
+		log.Printf("Failed to save turns for conversation %s: %v", req.ConversationID, err)
+	}
+}
+
+// prepareErrorStatus maps a prepareRequest error to its HTTP status
+func prepareErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrConversationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errConversationStore):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
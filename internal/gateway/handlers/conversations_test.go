@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	selectConversation     = regexp.QuoteMeta("SELECT 1 FROM conversations WHERE id = $1 AND api_key_id = $2")
+	selectConversationMsgs = regexp.QuoteMeta("SELECT message, created_at FROM conversation_messages")
+	insertConversationMsg  = regexp.QuoteMeta("INSERT INTO conversation_messages (conversation_id, message) VALUES ($1, $2)")
+	touchConversation      = regexp.QuoteMeta("UPDATE conversations SET updated_at = NOW() WHERE id = $1")
+)
+
+func TestConversationContinuesWithStoredHistory(t *testing.T) {
+	db, mock := mockDB(t)
+	h := &ChatHandler{db: db}
+	apiKey := &models.APIKey{ID: "key-1"}
+
+	mock.ExpectQuery(selectConversation).WithArgs("conv-1", "key-1").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+	mock.ExpectQuery(selectConversationMsgs).WithArgs("conv-1").WillReturnRows(sqlmock.NewRows([]string{"message", "created_at"}).
+		AddRow(`{"role":"user","content":"My name is Ada."}`, time.Now()).
+		AddRow(`{"role":"assistant","content":"Hello Ada!"}`, time.Now()))
+
+	req := providers.ChatRequest{
+		Model:          "gpt-4o",
+		ConversationID: "conv-1",
+		Messages:       []openai.ChatCompletionMessage{{Role: "user", Content: "What's my name?"}},
+	}
+	if err := h.continueConversation(context.Background(), apiKey, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	var roles []string
+	for _, m := range req.Messages {
+		roles = append(roles, m.Role+":"+m.Content)
+	}
+	if got := strings.Join(roles, "|"); got != "user:My name is Ada.|assistant:Hello Ada!|user:What's my name?" {
+		t.Errorf("history not prepended: %s", got)
+	}
+	if len(req.ConversationTurns) != 1 || req.ConversationTurns[0].Content != "What's my name?" {
+		t.Errorf("only the new turn should be kept aside for saving, got %+v", req.ConversationTurns)
+	}
+
+	// The new turn and the reply are appended together
+	mock.ExpectBegin()
+	mock.ExpectExec(insertConversationMsg).WithArgs("conv-1", `{"role":"user","content":"What's my name?"}`).WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec(insertConversationMsg).WithArgs("conv-1", `{"role":"assistant","content":"Ada."}`).WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectExec(touchConversation).WithArgs("conv-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	h.saveConversationTurns(context.Background(), req, &providers.ChatResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "Ada."}}},
+	})
+}
+
+func TestConversationOwnedByAnotherKeyIsNotFound(t *testing.T) {
+	db, mock := mockDB(t)
+	h := &ChatHandler{db: db}
+
+	mock.ExpectQuery(selectConversation).WithArgs("conv-1", "key-2").WillReturnError(sql.ErrNoRows)
+
+	req := providers.ChatRequest{ConversationID: "conv-1", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hi"}}}
+	err := h.continueConversation(context.Background(), &models.APIKey{ID: "key-2"}, &req)
+	if !errors.Is(err, database.ErrConversationNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if prepareErrorStatus(err) != http.StatusNotFound {
+		t.Errorf("expected a 404, got %d", prepareErrorStatus(err))
+	}
+	if len(req.Messages) != 1 {
+		t.Errorf("another key's history leaked into the request: %+v", req.Messages)
+	}
+}
+
+func TestPartialStreamIsNotSavedToTheConversation(t *testing.T) {
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	cfg := &config.Config{}
+	h := &ChatHandler{cfg: cfg, db: db, logs: idleLogs(db), providerMgr: testManager(t, cfg, nil)}
+
+	// Any attempt to append would fail against the mock and be logged
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	rec := httptest.NewRecorder()
+	out := newSSEWriter(rec, rec, formatSSE, 0, 0)
+	acc := &streamAccumulator{id: "chatcmpl-1"}
+	acc.content.WriteString("Once upon a")
+	req := providers.ChatRequest{
+		Model:             "gpt-4o",
+		ConversationID:    "conv-1",
+		Messages:          []openai.ChatCompletionMessage{{Role: "user", Content: "Tell a story"}},
+		ConversationTurns: []openai.ChatCompletionMessage{{Role: "user", Content: "Tell a story"}},
+	}
+
+	h.finishPartialStream(context.Background(), out, &models.APIKey{ID: "key-1"}, req, acc, "openai", time.Now(), context.DeadlineExceeded)
+
+	if strings.Contains(logged.String(), "Failed to save turns") {
+		t.Errorf("the partial reply was saved to the conversation: %s", logged.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"finish_reason":"length"`) || !strings.Contains(rec.Body.String(), "[DONE]") {
+		t.Errorf("the client should still get the partial reply, got %s", rec.Body)
+	}
+}
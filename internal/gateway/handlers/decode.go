@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Reasons a request body is rejected, reported in the 400's error.reason
+const (
+	bodyEmpty     = "empty_body"
+	bodyMalformed = "malformed_json"
+	bodyWrongType = "wrong_type"
+	bodyInvalid   = "invalid_body"
+)
+
+// bodyError describes why a request body couldn't be decoded
+type bodyError struct {
+	Reason  string
+	Message string
+	Field   string // dotted path of the offending field, for wrong_type
+	Offset  int64  // byte offset in the body where decoding failed, -1 if unknown
+}
+
+// messagePartsType is what a message's content decodes to when it isn't a string
+var messagePartsType = reflect.TypeOf([]openai.ChatMessagePart{})
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (e *bodyError) Error() string {
+	return e.Message
+}
+
+// decodeJSONBody decodes the request body into v, returning a *bodyError that
+// tells an empty body, malformed JSON and a wrongly-shaped value apart
+func decodeJSONBody(r *http.Request, v interface{}) error {
+	body := &countingReader{r: r.Body}
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(v); err != nil {
+		return describeDecodeError(err, body.n)
+	}
+	if dec.More() {
+		return &bodyError{
+			Reason:  bodyMalformed,
+			Message: fmt.Sprintf("unexpected data after the JSON value at offset %d", dec.InputOffset()),
+			Offset:  dec.InputOffset(),
+		}
+	}
+	return nil
+}
+
+// describeDecodeError turns an encoding/json error into a bodyError; read is
+// how much of the body had been consumed
+func describeDecodeError(err error, read int64) *bodyError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &bodyError{Reason: bodyEmpty, Message: "request body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &bodyError{
+			Reason:  bodyMalformed,
+			Message: fmt.Sprintf("request body ends unexpectedly after %d bytes (truncated JSON)", read),
+			Offset:  read,
+		}
+	case errors.As(err, &syntaxErr):
+		return &bodyError{
+			Reason:  bodyMalformed,
+			Message: fmt.Sprintf("malformed JSON at offset %d: %v", syntaxErr.Offset, syntaxErr),
+			Offset:  syntaxErr.Offset,
+		}
+	case errors.As(err, &typeErr):
+		// Messages decode themselves into anonymous structs, so the path and
+		// offset are relative to the message
+		if typeErr.Type == messagePartsType {
+			return &bodyError{
+				Reason:  bodyWrongType,
+				Message: fmt.Sprintf("message content must be a string or an array of content parts, got %s", typeErr.Value),
+				Field:   "messages.content",
+				Offset:  -1,
+			}
+		}
+		if typeErr.Struct == "" && typeErr.Field != "" {
+			return &bodyError{
+				Reason:  bodyWrongType,
+				Message: fmt.Sprintf("message field %q must be %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value),
+				Field:   "messages." + typeErr.Field,
+				Offset:  -1,
+			}
+		}
+		if typeErr.Field == "" {
+			return &bodyError{
+				Reason:  bodyWrongType,
+				Message: fmt.Sprintf("request body must be %s, got %s", jsonTypeName(typeErr.Type), typeErr.Value),
+				Offset:  typeErr.Offset,
+			}
+		}
+		return &bodyError{
+			Reason:  bodyWrongType,
+			Message: fmt.Sprintf("field %q must be %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value),
+			Field:   typeErr.Field,
+			Offset:  typeErr.Offset,
+		}
+	default:
+		// Custom unmarshalers (e.g. message content) report their own problems
+		return &bodyError{
+			Reason:  bodyInvalid,
+			Message: fmt.Sprintf("invalid request body: %v", err),
+			Offset:  -1,
+		}
+	}
+}
+
+// jsonTypeName names the JSON type a Go type decodes from, e.g. "an array"
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return t.String()
+	}
+}
+
+// writeBodyError writes a structured 400 for a body decodeJSONBody rejected
+func writeBodyError(w http.ResponseWriter, err error) {
+	var bodyErr *bodyError
+	if !errors.As(err, &bodyErr) {
+		bodyErr = &bodyError{Reason: bodyInvalid, Message: err.Error(), Offset: -1}
+	}
+
+	details := map[string]interface{}{
+		"type":    "invalid_request_body",
+		"reason":  bodyErr.Reason,
+		"message": bodyErr.Message,
+	}
+	if bodyErr.Field != "" {
+		details["field"] = bodyErr.Field
+	}
+	if bodyErr.Reason != bodyEmpty && bodyErr.Offset >= 0 {
+		details["offset"] = bodyErr.Offset
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": details})
+}
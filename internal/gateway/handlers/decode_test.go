@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestMalformedBodiesGetSpecificErrors(t *testing.T) {
+	h := &ChatHandler{cfg: &config.Config{}}
+	for _, tc := range []struct {
+		name, body, reason, field, message string
+		offset                             float64 // -1 = not reported
+	}{
+		{"empty", ``, bodyEmpty, "", "request body is empty", -1},
+		{"truncated", `{"model":"gpt-4o",`, bodyMalformed, "", "request body ends unexpectedly after 18 bytes (truncated JSON)", 18},
+		{"syntax error", `{"model": gpt}`, bodyMalformed, "", "malformed JSON at offset 11: invalid character 'g' looking for beginning of value", 11},
+		{"trailing data", `{"model":"gpt-4o"} {"x":1}`, bodyMalformed, "", "unexpected data after the JSON value at offset 19", 19},
+		{"not an object", `[1,2]`, bodyWrongType, "", "request body must be an object, got array", 1},
+		{"number for string", `{"model":42}`, bodyWrongType, "model", `field "model" must be a string, got number`, 11},
+		{"string for integer", `{"max_tokens":"100"}`, bodyWrongType, "max_tokens", `field "max_tokens" must be an integer, got string`, 19},
+		{"object for array", `{"messages":{"role":"user"}}`, bodyWrongType, "messages", `field "messages" must be an array, got object`, 13},
+		{"numeric content", `{"messages":[{"role":"user","content":5}]}`, bodyWrongType, "messages.content", "message content must be a string or an array of content parts, got number", -1},
+		{"numeric role", `{"messages":[{"role":7,"content":"hi"}]}`, bodyWrongType, "messages.role", `message field "role" must be a string, got number`, -1},
+	} {
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, chatRequest(tc.body, &models.APIKey{ID: "key-1"}))
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected a JSON 400, got %d (%s)", tc.name, rec.Code, rec.Header().Get("Content-Type"))
+			continue
+		}
+
+		var body struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		e := body.Error
+		if e["type"] != "invalid_request_body" || e["reason"] != tc.reason || e["message"] != tc.message {
+			t.Errorf("%s: got %v", tc.name, e)
+		}
+		if field, _ := e["field"].(string); field != tc.field {
+			t.Errorf("%s: field %q, want %q", tc.name, field, tc.field)
+		}
+		offset, ok := e["offset"].(float64)
+		if !ok {
+			offset = -1
+		}
+		if offset != tc.offset {
+			t.Errorf("%s: offset %v, want %v", tc.name, offset, tc.offset)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/health"
+)
+
+// HealthHandler handles provider health requests
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// HandleProviderHealth handles GET /v1/health/providers
+func (h *HealthHandler) HandleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"providers": h.checker.Statuses(),
+	})
+}
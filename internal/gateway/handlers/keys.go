@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// KeysHandler handles API key self-introspection
+type KeysHandler struct {
+	redis *redis.Client
+}
+
+// NewKeysHandler creates a new keys handler
+func NewKeysHandler(redis *redis.Client) *KeysHandler {
+	return &KeysHandler{redis: redis}
+}
+
+// keyInfo describes the caller's own key. It deliberately has no hash or ID.
+type keyInfo struct {
+	Name      string                 `json:"name"`
+	KeyPrefix string                 `json:"key_prefix"`
+	RateLimit rateLimitInfo          `json:"rate_limit"`
+	Limits    keyLimitsInfo          `json:"limits"`
+	Cache     keyCacheInfo           `json:"cache"`
+	Features  keyFeatureInfo         `json:"features"`
+	Flags     map[string]interface{} `json:"flags,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type rateLimitInfo struct {
+	PerMinute      int `json:"per_minute"`
+	Remaining      int `json:"remaining"`
+	ResetsInMs     int `json:"resets_in_ms"`
+	MaxWaitSeconds int `json:"max_wait_seconds"`
+}
+
+type keyLimitsInfo struct {
+	MaxConcurrentRequests int `json:"max_concurrent_requests"` // 0 = unlimited
+	InFlight              int `json:"in_flight"`
+	MaxOutputTokens       int `json:"max_output_tokens"` // 0 = unlimited
+}
+
+type keyCacheInfo struct {
+	Enabled    bool `json:"enabled"`
+	TTLSeconds int  `json:"ttl_seconds"`
+}
+
+type keyFeatureInfo struct {
+	RaceMode      bool `json:"race_mode"`
+	PromptCaching bool `json:"prompt_caching"`
+	AutoDowngrade bool `json:"auto_downgrade"`
+}
+
+// HandleKeyInfo handles GET /v1/keys/me
+func (h *KeysHandler) HandleKeyInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := apiKey.RateLimitPerMinute
+	if limit <= 0 {
+		limit = 100 // fallback default, as in RateLimitMiddleware
+	}
+
+	info := keyInfo{
+		Name:      apiKey.Name,
+		KeyPrefix: apiKey.KeyPrefix,
+		RateLimit: rateLimitInfo{
+			PerMinute:      limit,
+			Remaining:      limit,
+			MaxWaitSeconds: apiKey.RateLimitWaitSeconds,
+		},
+		Limits: keyLimitsInfo{
+			MaxConcurrentRequests: apiKey.MaxConcurrentRequests,
+			MaxOutputTokens:       apiKey.MaxOutputTokens,
+		},
+		Cache: keyCacheInfo{
+			Enabled:    apiKey.CacheEnabled,
+			TTLSeconds: apiKey.CacheTTLSeconds,
+		},
+		Features: keyFeatureInfo{
+			RaceMode:      apiKey.GetBool(models.FeatureRaceMode, false),
+			PromptCaching: apiKey.PromptCachingEnabled,
+			AutoDowngrade: apiKey.GetBool(models.FeatureAutoDowngrade, false),
+		},
+		Flags:     apiKey.Features,
+		CreatedAt: apiKey.CreatedAt,
+	}
+
+	// Live counters; on a Redis error the static limits are still useful
+	if count, err := h.redis.RateLimitCount(ctx, apiKey.ID); err == nil {
+		if info.RateLimit.Remaining = limit - count; info.RateLimit.Remaining < 0 {
+			info.RateLimit.Remaining = 0
+		}
+	}
+	if reset, err := h.redis.RateLimitReset(ctx, apiKey.ID); err == nil && reset > 0 {
+		info.RateLimit.ResetsInMs = int(reset.Milliseconds())
+	}
+	if inFlight, err := h.redis.ConcurrencyInFlight(ctx, apiKey.ID); err == nil {
+		info.Limits.InFlight = inFlight
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// keyInfoRequest builds a GET /v1/keys/me authenticated as key
+func keyInfoRequest(key *models.APIKey) *http.Request {
+	req := httptest.NewRequest("GET", "/v1/keys/me", nil)
+	return req.WithContext(context.WithValue(req.Context(), "api_key", key))
+}
+
+func TestKeyInfoReturnsLimitsAndLiveUsage(t *testing.T) {
+	client, srv := testRedis(t)
+	srv.Set("ratelimit:key-1", "7")
+	srv.SetTTL("ratelimit:key-1", 30*time.Second)
+	srv.Set("concurrency:key-1", "2")
+	h := NewKeysHandler(client)
+	key := &models.APIKey{
+		ID:                    "key-1",
+		KeyHash:               "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+		KeyPrefix:             "gw_live_abc",
+		Name:                  "billing service",
+		RateLimitPerMinute:    60,
+		RateLimitWaitSeconds:  5,
+		MaxConcurrentRequests: 4,
+		MaxOutputTokens:       1024,
+		CacheEnabled:          true,
+		CacheTTLSeconds:       600,
+		PromptCachingEnabled:  true,
+		Features:              map[string]interface{}{models.FeatureRaceMode: true},
+		CreatedAt:             time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	rec := httptest.NewRecorder()
+	h.HandleKeyInfo(rec, keyInfoRequest(key))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+
+	var info keyInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "billing service" || info.KeyPrefix != "gw_live_abc" || !info.CreatedAt.Equal(key.CreatedAt) {
+		t.Errorf("identity: %+v", info)
+	}
+	if r := info.RateLimit; r.PerMinute != 60 || r.Remaining != 53 || r.MaxWaitSeconds != 5 || r.ResetsInMs <= 0 || r.ResetsInMs > 30000 {
+		t.Errorf("rate limit: %+v", r)
+	}
+	if l := info.Limits; l.MaxConcurrentRequests != 4 || l.InFlight != 2 || l.MaxOutputTokens != 1024 {
+		t.Errorf("limits: %+v", l)
+	}
+	if c := info.Cache; !c.Enabled || c.TTLSeconds != 600 {
+		t.Errorf("cache: %+v", c)
+	}
+	if f := info.Features; !f.RaceMode || !f.PromptCaching || f.AutoDowngrade {
+		t.Errorf("features: %+v", f)
+	}
+
+	for _, secret := range []string{key.KeyHash, "key_hash", key.ID} {
+		if strings.Contains(body, secret) {
+			t.Errorf("response leaks %q: %s", secret, body)
+		}
+	}
+}
+
+func TestKeyInfoWithoutRedisReturnsStaticLimits(t *testing.T) {
+	client, srv := testRedis(t)
+	srv.Close()
+	h := NewKeysHandler(client)
+
+	rec := httptest.NewRecorder()
+	h.HandleKeyInfo(rec, keyInfoRequest(&models.APIKey{ID: "key-1", Name: "batch"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var info keyInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	// The default limit, with nothing known to be used
+	if info.RateLimit.PerMinute != 100 || info.RateLimit.Remaining != 100 {
+		t.Errorf("rate limit: %+v", info.RateLimit)
+	}
+}
+
+func TestKeyInfoRequiresAKey(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewKeysHandler(nil).HandleKeyInfo(rec, httptest.NewRequest("GET", "/v1/keys/me", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maintenanceKey is the Redis key holding the maintenance state; absent = serving normally
+const maintenanceKey = "maintenance"
+
+// defaultMaintenanceMessage is returned when maintenance is enabled without a message
+const defaultMaintenanceMessage = "The gateway is temporarily down for maintenance. Please retry later."
+
+// maintenanceState is what's stored under maintenanceKey while maintenance is on
+type maintenanceState struct {
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// MaintenanceMiddleware fast-fails requests with a 503 while maintenance mode is on.
+// The flag lives in Redis so every instance flips together without a restart.
+func (m *Middleware) MaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := m.redis.Get(r.Context(), maintenanceKey)
+		if err != nil {
+			// Not set, or Redis is down - keep serving
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var state maintenanceState
+		if err := json.Unmarshal([]byte(raw), &state); err != nil {
+			log.Printf("Invalid maintenance state in Redis: %v", err)
+		}
+		if state.Message == "" {
+			state.Message = defaultMaintenanceMessage
+		}
+		if state.RetryAfterSeconds <= 0 {
+			state.RetryAfterSeconds = 60
+		}
+
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", state.RetryAfterSeconds))
+		http.Error(w, state.Message, http.StatusServiceUnavailable)
+	})
+}
+
+// maintenanceRequest is the body of PUT /admin/maintenance
+type maintenanceRequest struct {
+	Enabled           bool   `json:"enabled"`
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	DurationSeconds   int    `json:"duration_seconds"` // turn off automatically after this long (0 = until disabled)
+}
+
+// HandleSetMaintenance handles PUT /admin/maintenance
+func (h *AdminHandler) HandleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !req.Enabled {
+		if err := h.redis.Del(ctx, maintenanceKey); err != nil {
+			http.Error(w, fmt.Sprintf("failed to disable maintenance mode: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Println("Maintenance mode disabled")
+	} else {
+		data, _ := json.Marshal(maintenanceState{Message: req.Message, RetryAfterSeconds: req.RetryAfterSeconds})
+		ttl := time.Duration(req.DurationSeconds) * time.Second
+		if err := h.redis.Set(ctx, maintenanceKey, string(data), ttl); err != nil {
+			http.Error(w, fmt.Sprintf("failed to enable maintenance mode: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Maintenance mode enabled (duration: %v)", ttl)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"maintenance": req.Enabled,
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// MetricsHandler serves GET /metrics in the Prometheus text format. Redis
+// usage is refreshed in the background, since measuring it SCANs the whole
+// keyspace; scrapes read the last snapshot.
+type MetricsHandler struct {
+	redis    *redis.Client
+	interval time.Duration
+
+	mu          sync.RWMutex
+	usage       map[string]*models.NamespaceUsage
+	refreshedAt time.Time
+}
+
+// NewMetricsHandler creates a metrics handler refreshing Redis usage every interval
+func NewMetricsHandler(redis *redis.Client, interval time.Duration) *MetricsHandler {
+	return &MetricsHandler{redis: redis, interval: interval}
+}
+
+// Start refreshes Redis usage now and every interval until ctx is done
+func (h *MetricsHandler) Start(ctx context.Context) {
+	go func() {
+		h.refresh(ctx)
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.refresh(ctx)
+			}
+		}
+	}()
+}
+
+// refresh measures Redis usage, keeping the previous snapshot on failure
+func (h *MetricsHandler) refresh(ctx context.Context) {
+	usage, err := h.redis.KeyspaceUsage(ctx, redisNamespaceNames(), keyspaceSamples)
+	if err != nil {
+		log.Printf("Failed to measure Redis usage for metrics: %v", err)
+		return
+	}
+	h.mu.Lock()
+	h.usage = usage
+	h.refreshedAt = time.Now()
+	h.mu.Unlock()
+}
+
+// HandleMetrics handles GET /metrics
+func (h *MetricsHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	usage, refreshedAt := h.usage, h.refreshedAt
+	h.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(formatRedisMetrics(usage, refreshedAt)))
+}
+
+// formatRedisMetrics renders usage as Prometheus gauges, one series per
+// namespace in name order. Nothing is rendered before the first refresh.
+func formatRedisMetrics(usage map[string]*models.NamespaceUsage, refreshedAt time.Time) string {
+	if usage == nil {
+		return ""
+	}
+	namespaces := make([]string, 0, len(usage))
+	for namespace := range usage {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var b strings.Builder
+	gauge := func(name, help string, value func(*models.NamespaceUsage) int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, namespace := range namespaces {
+			fmt.Fprintf(&b, "%s{namespace=%q} %d\n", name, namespace, value(usage[namespace]))
+		}
+	}
+	gauge("gateway_redis_keys", "Keys in each Redis namespace.",
+		func(u *models.NamespaceUsage) int64 { return u.Keys })
+	gauge("gateway_redis_approx_bytes", "Approximate memory used by each Redis namespace, scaled from sampled MEMORY USAGE.",
+		func(u *models.NamespaceUsage) int64 { return u.ApproxBytes })
+
+	fmt.Fprintf(&b, "# HELP gateway_redis_usage_refreshed_timestamp_seconds When the Redis usage figures were measured.\n")
+	fmt.Fprintf(&b, "# TYPE gateway_redis_usage_refreshed_timestamp_seconds gauge\n")
+	fmt.Fprintf(&b, "gateway_redis_usage_refreshed_timestamp_seconds %d\n", refreshedAt.Unix())
+	return b.String()
+}
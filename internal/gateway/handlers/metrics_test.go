@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExportRedisUsagePerNamespace(t *testing.T) {
+	client, srv := testRedis(t)
+	for _, key := range []string{"cache:exact:a", "cache:exact:b", "ratelimit:k:minute", "stray"} {
+		srv.Set(key, "v")
+	}
+
+	h := NewMetricsHandler(client, time.Hour)
+	rec := httptest.NewRecorder()
+	h.HandleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no series before the first refresh, got %q", rec.Body.String())
+	}
+
+	h.refresh(context.Background())
+	rec = httptest.NewRecorder()
+	h.HandleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE gateway_redis_keys gauge",
+		`gateway_redis_keys{namespace="cache:exact"} 2`,
+		`gateway_redis_keys{namespace="ratelimit"} 1`,
+		`gateway_redis_keys{namespace="apikey"} 0`,
+		`gateway_redis_keys{namespace="other"} 1`,
+		"# TYPE gateway_redis_approx_bytes gauge",
+		`gateway_redis_approx_bytes{namespace="cache:exact"} `,
+		"gateway_redis_usage_refreshed_timestamp_seconds ",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics missing %q:\n%s", line, body)
+		}
+	}
+}
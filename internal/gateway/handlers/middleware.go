@@ -3,26 +3,117 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/retry"
 )
 
 type Middleware struct {
+	cfg   *config.Config
 	db    *database.DB
 	redis *redis.Client
+	logs  *database.LogWriter
 }
 
-func NewMiddleware(db *database.DB, redis *redis.Client) *Middleware {
+func NewMiddleware(cfg *config.Config, db *database.DB, redis *redis.Client, logs *database.LogWriter) *Middleware {
 	return &Middleware{
+		cfg:   cfg,
 		db:    db,
 		redis: redis,
+		logs:  logs,
 	}
 }
 
+// LogHealthMiddleware refuses requests while request logs can't be written,
+// which only happens with LOG_WRITE_FAIL_CLOSED set
+func (m *Middleware) LogHealthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.logs != nil && m.logs.Failing() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "request logging unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UpstreamHeadersMiddleware makes the request's headers available for
+// provider passthrough; only names in PROVIDER_HEADER_PASSTHROUGH are forwarded
+func (m *Middleware) UpstreamHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.cfg.PassthroughHeaders) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := providers.WithRequestHeaders(r.Context(), r.Header)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkRateLimit runs a rate limit check, retrying transient Redis errors
+func checkRateLimit(ctx context.Context, cfg *config.Config, client *redis.Client, id string, limit int) (exceeded bool, remaining int, err error) {
+	policy := retry.Policy{Retries: cfg.RateLimitRetries, Backoff: cfg.RateLimitRetryBackoff}
+	err = retry.Do(ctx, policy, func() error {
+		var checkErr error
+		exceeded, remaining, checkErr = client.CheckRateLimit(ctx, id, limit)
+		return checkErr
+	})
+	if err != nil {
+		log.Printf("Rate limit check for %s failed: %v", id, err)
+	}
+	return exceeded, remaining, err
+}
+
+// rateLimitUnavailable handles a rate limit check that failed after retries:
+// the request proceeds, or gets a 503 with RATE_LIMIT_FAIL_CLOSED set
+func (m *Middleware) rateLimitUnavailable(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if m.cfg.RateLimitFailClosed {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "rate limiter unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// IPRateLimitMiddleware caps requests per client IP. It runs before auth so
+// clients without a valid key can't hammer key lookups.
+func (m *Middleware) IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.cfg.IPRateLimit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIPFromContext(r.Context())
+		if ip == "" {
+			ip = clientIP(r, m.cfg.TrustedProxies)
+		}
+		exceeded, _, err := checkRateLimit(r.Context(), m.cfg, m.redis, "ip:"+ip, m.cfg.IPRateLimit)
+		if err != nil {
+			m.rateLimitUnavailable(w, r, next)
+			return
+		}
+
+		if exceeded {
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // AuthMiddleware validates API keys
 func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -42,8 +133,14 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 
 		apiKeyValue := parts[1]
 
+		// Reject malformed keys before hashing and hitting the database
+		if !m.validKeyFormat(apiKeyValue) {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+
 		// Validate API key
-		apiKey, err := m.db.GetAPIKey(r.Context(), apiKeyValue)
+		apiKey, err := m.lookupAPIKey(r.Context(), apiKeyValue)
 		if err != nil {
 			http.Error(w, "invalid API key", http.StatusUnauthorized)
 			return
@@ -55,6 +152,24 @@ func (m *Middleware) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// validKeyFormat checks the configured prefix, length bounds and character set
+func (m *Middleware) validKeyFormat(key string) bool {
+	if !strings.HasPrefix(key, m.cfg.APIKeyPrefix) {
+		return false
+	}
+	if len(key) < m.cfg.APIKeyMinLength || len(key) > m.cfg.APIKeyMaxLength {
+		return false
+	}
+
+	for _, c := range key {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
 // RateLimitMiddleware enforces rate limits
 func (m *Middleware) RateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -69,12 +184,25 @@ func (m *Middleware) RateLimitMiddleware(next http.Handler) http.Handler {
 			limit = 100 // fallback default
 		}
 
-		exceeded, remaining, err := m.redis.CheckRateLimit(r.Context(), apiKey.ID, limit)
+		exceeded, remaining, err := checkRateLimit(r.Context(), m.cfg, m.redis, apiKey.ID, limit)
 		if err != nil {
-			next.ServeHTTP(w, r)
+			m.rateLimitUnavailable(w, r, next)
 			return
 		}
 
+		// Optionally queue until the window resets instead of rejecting
+		if exceeded {
+			if maxWait := m.rateLimitWait(r, apiKey); maxWait > 0 {
+				waitStart := time.Now()
+				exceeded, remaining, err = m.waitForRateLimit(r.Context(), apiKey.ID, limit, maxWait)
+				if err != nil {
+					m.rateLimitUnavailable(w, r, next)
+					return
+				}
+				w.Header().Set("X-RateLimit-Waited-Ms", fmt.Sprintf("%d", time.Since(waitStart).Milliseconds()))
+			}
+		}
+
 		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", limit))
 		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
 
@@ -88,12 +216,178 @@ func (m *Middleware) RateLimitMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// rateLimitWait returns how long a rate-limited request may queue, from the
+// X-RateLimit-Wait header (seconds) or the key's setting, capped by config
+func (m *Middleware) rateLimitWait(r *http.Request, apiKey *models.APIKey) time.Duration {
+	wait := time.Duration(apiKey.RateLimitWaitSeconds) * time.Second
+	if header := r.Header.Get("X-RateLimit-Wait"); header != "" {
+		if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if wait > m.cfg.RateLimitMaxWait {
+		wait = m.cfg.RateLimitMaxWait
+	}
+	return wait
+}
+
+// waitForRateLimit blocks until the rate limit window frees capacity or maxWait
+// elapses, returning the final rate limit state
+func (m *Middleware) waitForRateLimit(ctx context.Context, apiKeyID string, limit int, maxWait time.Duration) (bool, int, error) {
+	deadline := time.Now().Add(maxWait)
+
+	for {
+		// Sleep until the window resets (or the deadline, whichever is sooner)
+		sleep, err := m.redis.RateLimitReset(ctx, apiKeyID)
+		if err != nil {
+			return false, 0, err
+		}
+		if sleep <= 0 {
+			sleep = 50 * time.Millisecond
+		}
+		if untilDeadline := time.Until(deadline); sleep > untilDeadline {
+			sleep = untilDeadline
+		}
+
+		select {
+		case <-ctx.Done():
+			return true, 0, nil
+		case <-time.After(sleep):
+		}
+
+		exceeded, remaining, err := checkRateLimit(ctx, m.cfg, m.redis, apiKeyID, limit)
+		if err != nil || !exceeded || !time.Now().Before(deadline) {
+			return exceeded, remaining, err
+		}
+	}
+}
+
+// RetryBudgetMiddleware gives each request the key's retry budget, shared by
+// every provider call made while serving it. Runs after AuthMiddleware.
+func (m *Middleware) RetryBudgetMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := r.Context().Value("api_key").(*models.APIKey)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := providers.WithRetryBudget(r.Context(), keyRetryBudget(m.cfg, apiKey))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestTimeoutMiddleware sets the request's deadline from the X-Request-Timeout
+// header (seconds), clamped to the configured max, or the default timeout.
+// Responds 504 if the deadline passes before the handler writes anything.
+func (m *Middleware) RequestTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := requestTimeout(m.cfg, r)
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		tw := &writeTracker{ResponseWriter: w}
+		defer func() {
+			cancel()
+			if ctx.Err() == context.DeadlineExceeded && !tw.wrote {
+				http.Error(w, "request timed out", http.StatusGatewayTimeout)
+			}
+		}()
+
+		next.ServeHTTP(tw, r.WithContext(ctx))
+	})
+}
+
+// writeTracker records whether anything was written to the response
+type writeTracker struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *writeTracker) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *writeTracker) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming working through the wrapper
+func (w *writeTracker) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wrote = true
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *writeTracker) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestTimeout returns the deadline for a request
+func requestTimeout(cfg *config.Config, r *http.Request) time.Duration {
+	timeout := cfg.RequestTimeout
+	if header := r.Header.Get("X-Request-Timeout"); header != "" {
+		if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if timeout > cfg.RequestTimeoutMax {
+		timeout = cfg.RequestTimeoutMax
+	}
+	return timeout
+}
+
+// ConcurrencyMiddleware caps simultaneous in-flight requests per API key
+func (m *Middleware) ConcurrencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, ok := r.Context().Value("api_key").(*models.APIKey)
+		if !ok || apiKey.MaxConcurrentRequests <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		acquired, inFlight, err := m.redis.AcquireConcurrencySlot(r.Context(), apiKey.ID, apiKey.MaxConcurrentRequests)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Concurrency-Limit", fmt.Sprintf("%d", apiKey.MaxConcurrentRequests))
+
+		if !acquired {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, fmt.Sprintf("concurrency limit exceeded (%d in flight)", inFlight), http.StatusTooManyRequests)
+			return
+		}
+
+		// Release even if the client disconnected or the handler panicked -
+		// the request context may already be cancelled at this point
+		defer m.redis.ReleaseConcurrencySlot(context.Background(), apiKey.ID)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CompressionMiddleware gzips JSON responses for clients that accept it.
+// Only JSON is compressed - SSE streams must stay uncompressed so flushes
+// reach the client.
+func (m *Middleware) CompressionMiddleware(next http.Handler) http.Handler {
+	if !m.cfg.CompressionEnabled {
+		return next
+	}
+	return chimiddleware.Compress(5, "application/json")(next)
+}
+
 // CORSMiddleware handles CORS
 func (m *Middleware) CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Race-Mode, X-RateLimit-Wait, X-Request-Timeout, X-Priority, X-JSON-Repair, X-Context-Truncate, X-Cache-TTL, X-Cache-Key, X-Stream-Coalesce-Chars, X-Stream-Coalesce-Ms, X-Stream-Aggregate, X-Auto-Continue, X-Schema-Retry, OpenAI-Organization")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
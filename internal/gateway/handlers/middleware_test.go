@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// slowReply holds every request until release is closed
+func slowReply(release <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		statusReply(http.StatusOK)(w, r)
+	}
+}
+
+func TestRequestTimeoutHeaderCancelsASlowProvider(t *testing.T) {
+	cfg := &config.Config{RequestTimeout: time.Minute, RequestTimeoutMax: 2 * time.Minute}
+	release := make(chan struct{})
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": slowReply(release)})
+	t.Cleanup(func() { close(release) }) // before the upstream shuts down
+	m := &Middleware{cfg: cfg}
+
+	var callErr error
+	handler := m.RequestTimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Write nothing on failure, so the middleware answers
+		_, _, _, callErr = mgr.ChatCompletion(r.Context(), providers.ChatRequest{
+			Model:    "gpt-4o",
+			Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}},
+		})
+	}))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set("X-Request-Timeout", "0.1")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("provider call ran for %s despite a 100ms timeout", elapsed)
+	}
+	if callErr == nil {
+		t.Error("expected the provider call to fail")
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", rec.Code)
+	}
+}
+
+// statusRecorder records every explicit WriteHeader call
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.statuses = append(r.statuses, status)
+	r.ResponseRecorder.WriteHeader(status)
+}
+
+func TestRequestTimeoutDoesntOverwriteAStartedResponse(t *testing.T) {
+	cfg := &config.Config{RequestTimeout: 50 * time.Millisecond, RequestTimeoutMax: time.Minute}
+	m := &Middleware{cfg: cfg}
+
+	handler := m.RequestTimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: partial\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+
+	rec := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/v1/chat/completions", nil))
+
+	if len(rec.statuses) != 0 {
+		t.Errorf("status %v written after the response started", rec.statuses)
+	}
+	if strings.Contains(rec.Body.String(), "timed out") {
+		t.Errorf("timeout error appended to the response: %q", rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Error("flush didn't reach the underlying writer")
+	}
+}
+
+func TestRequestTimeoutIsClampedToTheMax(t *testing.T) {
+	cfg := &config.Config{RequestTimeout: 60 * time.Second, RequestTimeoutMax: 120 * time.Second}
+	for header, want := range map[string]time.Duration{
+		"":      60 * time.Second,
+		"5":     5 * time.Second,
+		"0.5":   500 * time.Millisecond,
+		"600":   120 * time.Second,
+		"-1":    60 * time.Second,
+		"soon":  60 * time.Second,
+		"120.0": 120 * time.Second,
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		if header != "" {
+			req.Header.Set("X-Request-Timeout", header)
+		}
+		if got := requestTimeout(cfg, req); got != want {
+			t.Errorf("X-Request-Timeout %q: got %s, want %s", header, got, want)
+		}
+	}
+}
+
+// keyRequest builds a request authenticated as key
+func keyRequest(key *models.APIKey) *http.Request {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	return req.WithContext(context.WithValue(req.Context(), "api_key", key))
+}
+
+func TestConcurrencyLimitRejectsRequestsOverTheCap(t *testing.T) {
+	client, srv := testRedis(t)
+	m := &Middleware{redis: client}
+	key := &models.APIKey{ID: "key-1", MaxConcurrentRequests: 2}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := m.ConcurrencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, keyRequest(key))
+			codes[i] = rec.Code
+		}(i)
+		<-entered
+	}
+
+	// Both slots are taken, so a third request is turned away
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, keyRequest(key))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After over the cap, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "2 in flight") {
+		t.Errorf("unexpected body %q", rec.Body)
+	}
+
+	close(release)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("expected the requests within the cap to succeed, got %v", codes)
+	}
+	if srv.Exists("concurrency:key-1") {
+		t.Error("expected every slot released")
+	}
+}
+
+func TestConcurrencySlotReleasedWhenTheHandlerPanics(t *testing.T) {
+	client, srv := testRedis(t)
+	m := &Middleware{redis: client}
+	handler := m.ConcurrencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), keyRequest(&models.APIKey{ID: "key-1", MaxConcurrentRequests: 1}))
+	}()
+	if srv.Exists("concurrency:key-1") {
+		t.Error("expected the slot released after a panic")
+	}
+}
+
+func TestCompressionGzipsLargeJSON(t *testing.T) {
+	body := `{"content":"` + strings.Repeat("Paris is sunny today. ", 500) + `"}`
+	m := &Middleware{cfg: &config.Config{CompressionEnabled: true}}
+	handler := m.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/analytics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if rec.Body.Len() >= len(body) {
+		t.Errorf("compressed body is %d bytes, the original %d", rec.Body.Len(), len(body))
+	}
+	reader, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := io.ReadAll(reader); err != nil || string(decoded) != body {
+		t.Errorf("body doesn't decompress to the original: %v", err)
+	}
+
+	// Without Accept-Encoding, or with compression off, the body is sent as is
+	for name, tc := range map[string]struct {
+		enabled        bool
+		acceptEncoding string
+	}{
+		"not accepted": {enabled: true},
+		"disabled":     {enabled: false, acceptEncoding: "gzip"},
+	} {
+		m.cfg.CompressionEnabled = tc.enabled
+		handler := m.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/v1/analytics", nil)
+		req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != body {
+			t.Errorf("%s: response was compressed", name)
+		}
+	}
+}
+
+func TestCompressionNeverAppliesToStreams(t *testing.T) {
+	m := &Middleware{cfg: &config.Config{CompressionEnabled: true}}
+	handler := m.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 200; i++ {
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Paris \"}}]}\n\n")
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, "data: [DONE]\n\n")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("stream was compressed with %q", got)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "data: ") || !strings.HasSuffix(rec.Body.String(), "data: [DONE]\n\n") {
+		t.Errorf("stream body isn't plain SSE: %.60q", rec.Body.String())
+	}
+	if !rec.Flushed {
+		t.Error("stream flushes didn't reach the client")
+	}
+}
+
+func TestRateLimitWaitSucceedsWhenTheWindowResets(t *testing.T) {
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: &config.Config{RateLimitMaxWait: 5 * time.Second}, redis: client}
+	key := &models.APIKey{ID: "key-1", RateLimitPerMinute: 3}
+	srv.Set("ratelimit:key-1", "3")
+	srv.SetTTL("ratelimit:key-1", 150*time.Millisecond)
+
+	// miniredis only expires keys when told to, so end the window from here
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv.FastForward(150 * time.Millisecond)
+	}()
+
+	handler := m.RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := keyRequest(key)
+	req.Header.Set("X-RateLimit-Wait", "2")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the request to proceed after the window reset, got %d", rec.Code)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond || waited > time.Second {
+		t.Errorf("expected to wait for the window reset, waited %s", waited)
+	}
+	if rec.Header().Get("X-RateLimit-Waited-Ms") == "" || rec.Header().Get("X-RateLimit-Remaining") != "2" {
+		t.Errorf("unexpected headers %v", rec.Header())
+	}
+}
+
+func TestRateLimitWaitGivesUpAfterTheMaxWait(t *testing.T) {
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: &config.Config{RateLimitMaxWait: 200 * time.Millisecond}, redis: client}
+	key := &models.APIKey{ID: "key-1", RateLimitPerMinute: 3}
+	srv.Set("ratelimit:key-1", "3")
+	srv.SetTTL("ratelimit:key-1", time.Minute)
+	handler := m.RateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// The header asks for longer than the configured cap
+	req := keyRequest(key)
+	req.Header.Set("X-RateLimit-Wait", "30")
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 once the wait ran out, got %d", rec.Code)
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond || waited > 2*time.Second {
+		t.Errorf("expected to wait the capped 200ms, waited %s", waited)
+	}
+
+	// Without opting in, the request is rejected at once
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, keyRequest(key))
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("X-RateLimit-Waited-Ms") != "" {
+		t.Errorf("expected an immediate 429, got %d with %v", rec.Code, rec.Header())
+	}
+}
+
+const testAPIKey = "gw_live_0123456789abcdef"
+
+var selectAPIKey = regexp.QuoteMeta("FROM api_keys\n\t\tWHERE key_hash = $1 AND is_active = true")
+
+// expectAPIKey expects one api_keys lookup for rawKey, answered with an active key
+func expectAPIKey(mock sqlmock.Sqlmock, id, rawKey string) {
+	now := time.Now()
+	mock.ExpectQuery(selectAPIKey).WithArgs(database.HashAPIKey(rawKey)).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "key_hash", "key_prefix", "name", "rate_limit_per_minute", "rate_limit_wait_seconds",
+		"max_concurrent_requests", "max_output_tokens", "cache_enabled", "cache_ttl_seconds",
+		"prompt_caching_enabled", "stream_coalesce_chars", "stream_coalesce_ms", "openai_organization",
+		"postprocess_webhook_url", "postprocess_fail_closed", "prompt_prelude", "prompt_suffix",
+		"prompt_prelude_override", "gemini_safety_settings", "features", "is_active", "last_used_at", "created_at", "updated_at",
+	}).AddRow(
+		id, database.HashAPIKey(rawKey), rawKey[:11], "test", 60, 0,
+		0, 0, true, 3600,
+		false, 0, 0, "",
+		"", false, "", "",
+		false, []byte("{}"), []byte("{}"), true, nil, now, now,
+	))
+}
+
+// authConfig is the default key format, with API key caching as given
+func authConfig(cacheTTL, negativeTTL time.Duration) *config.Config {
+	return &config.Config{APIKeyPrefix: "gw_", APIKeyMinLength: 12, APIKeyMaxLength: 128, APIKeyCacheTTL: cacheTTL, APIKeyNegativeCacheTTL: negativeTTL}
+}
+
+// authenticate sends a request with the given bearer token through
+// AuthMiddleware, returning the status and the ID of the key it resolved
+func authenticate(m *Middleware, token string) (int, string) {
+	handler := m.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Context().Value("api_key").(*models.APIKey).ID)
+	}))
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestAuthRejectsMalformedKeysWithoutALookup(t *testing.T) {
+	db, mock := mockDB(t)
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: authConfig(30*time.Second, 0), db: db, redis: client}
+
+	for name, token := range map[string]string{
+		"wrong prefix":  "sk-0123456789abcdef",
+		"too short":     "gw_123",
+		"too long":      "gw_" + strings.Repeat("a", 200),
+		"bad character": "gw_live_0123'; DROP TABLE--",
+		"unicode":       "gw_live_01234567ü",
+	} {
+		if code, _ := authenticate(m, token); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, code)
+		}
+	}
+	if keys := srv.Keys(); len(keys) != 0 {
+		t.Errorf("malformed keys reached the cache: %v", keys)
+	}
+
+	// Only a well-formed key is looked up
+	expectAPIKey(mock, "key-1", testAPIKey)
+	if code, keyID := authenticate(m, testAPIKey); code != http.StatusOK || keyID != "key-1" {
+		t.Errorf("expected the well-formed key looked up, got %d for %q", code, keyID)
+	}
+}
+
+func TestAuthServesCachedKeysWithoutALookup(t *testing.T) {
+	db, _ := mockDB(t)
+	client, srv := testRedis(t)
+	m := &Middleware{cfg: authConfig(30*time.Second, 0), db: db, redis: client}
+	srv.Set(apiKeyCacheKey(database.HashAPIKey(testAPIKey)), `{"ID":"key-cached","RateLimitPerMinute":60}`)
+
+	if code, keyID := authenticate(m, testAPIKey); code != http.StatusOK || keyID != "key-cached" {
+		t.Errorf("expected the cached key, got %d for %q", code, keyID)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// streamFormat is the wire format of a streamed response
+type streamFormat int
+
+const (
+	formatSSE       streamFormat = iota // text/event-stream, OpenAI-compatible
+	formatNDJSON                        // application/x-ndjson, one chunk per line
+	formatResponses                     // text/event-stream of named Responses API events
+)
+
+// contentType returns the Content-Type header for the format
+func (f streamFormat) contentType() string {
+	if f == formatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/event-stream"
+}
+
+// negotiateStream picks the response format for a stream:true request from the
+// Accept header: the stream media type with the highest q-value wins, earlier
+// entries breaking ties, and anything else (including no header, */* or a bare
+// application/json, which the OpenAI SDKs always send) gets SSE. aggregate is
+// true only when the client opts in with X-Stream-Aggregate: true, in which
+// case a single non-streamed response is sent.
+func negotiateStream(r *http.Request) (format streamFormat, aggregate bool) {
+	aggregate = r.Header.Get("X-Stream-Aggregate") == "true"
+
+	format = formatSSE
+	bestQ := 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var candidate streamFormat
+		switch mediaType {
+		case "text/event-stream":
+			candidate = formatSSE
+		case "application/x-ndjson":
+			candidate = formatNDJSON
+		default:
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			format, bestQ = candidate, q
+		}
+	}
+	return format, aggregate
+}
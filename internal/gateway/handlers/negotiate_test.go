@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNegotiateStream(t *testing.T) {
+	for _, tc := range []struct {
+		accept    string
+		aggregate string
+		format    streamFormat
+		wantAgg   bool
+	}{
+		{"", "", formatSSE, false},
+		{"*/*", "", formatSSE, false},
+		{"text/event-stream", "", formatSSE, false},
+		{"application/x-ndjson", "", formatNDJSON, false},
+		{"application/json", "", formatSSE, false}, // OpenAI SDK default
+		{"application/json, text/event-stream", "", formatSSE, false},
+		{"application/json, application/x-ndjson", "", formatNDJSON, false},
+		{"application/x-ndjson;q=0.5, text/event-stream", "", formatSSE, false},
+		{"text/event-stream;q=0.2, application/x-ndjson;q=0.9", "", formatNDJSON, false},
+		{"application/x-ndjson;q=0, text/event-stream;q=0.1", "", formatSSE, false},
+		{"application/x-ndjson, text/event-stream", "", formatNDJSON, false}, // tie: first wins
+		{"application/json", "true", formatSSE, true},
+		{"application/x-ndjson", "true", formatNDJSON, true},
+		{"", "yes", formatSSE, false},
+	} {
+		r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		if tc.aggregate != "" {
+			r.Header.Set("X-Stream-Aggregate", tc.aggregate)
+		}
+
+		format, aggregate := negotiateStream(r)
+		if format != tc.format || aggregate != tc.wantAgg {
+			t.Errorf("Accept %q, X-Stream-Aggregate %q: got format %d aggregate %v, want %d %v",
+				tc.accept, tc.aggregate, format, aggregate, tc.format, tc.wantAgg)
+		}
+	}
+}
+
+func TestStreamFormatContentType(t *testing.T) {
+	if got := formatNDJSON.contentType(); got != "application/x-ndjson" {
+		t.Errorf("ndjson content type %q", got)
+	}
+	if got := formatSSE.contentType(); got != "text/event-stream" {
+		t.Errorf("sse content type %q", got)
+	}
+}
+
+func TestStreamWriterFormats(t *testing.T) {
+	chunk := deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "Hi"}, "")
+
+	rec := httptest.NewRecorder()
+	sse := newSSEWriter(rec, rec, formatSSE, 0, 0)
+	sse.Write(chunk)
+	sse.Done()
+	if body := rec.Body.String(); !strings.HasPrefix(body, "data: {") || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("unexpected SSE body %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	ndjson := newSSEWriter(rec, rec, formatNDJSON, 0, 0)
+	ndjson.Write(chunk)
+	ndjson.Write(chunk)
+	ndjson.Done()
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 NDJSON lines, got %q", rec.Body.String())
+	}
+	for _, line := range lines {
+		var decoded providers.StreamChunk
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil || decoded.Choices[0].Delta.Content != "Hi" {
+			t.Errorf("bad NDJSON line %q: %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/postprocess"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+func postprocessedReply() *providers.ChatResponse {
+	return &providers.ChatResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "original"}}}}
+}
+
+func TestPostprocessCompletion(t *testing.T) {
+	transformer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"scrubbed"}}]}`))
+	}))
+	defer transformer.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	}))
+	defer slow.Close()
+	h := &ChatHandler{postprocessor: postprocess.New(50 * time.Millisecond)}
+
+	for _, tc := range []struct {
+		name    string
+		key     models.APIKey
+		outcome string
+		content string
+		failed  bool
+	}{
+		{"no webhook", models.APIKey{}, "", "original", false},
+		{"applied", models.APIKey{PostprocessURL: transformer.URL}, "applied", "scrubbed", false},
+		{"timeout fails open", models.APIKey{PostprocessURL: slow.URL}, "skipped", "original", false},
+		{"timeout fails closed", models.APIKey{PostprocessURL: slow.URL, PostprocessFailClosed: true}, "", "original", true},
+	} {
+		resp := postprocessedReply()
+		outcome, err := h.postprocessCompletion(context.Background(), &tc.key, providers.ChatRequest{}, resp)
+		if outcome != tc.outcome || resp.Choices[0].Message.Content != tc.content {
+			t.Errorf("%s: got %q with %q, want %q with %q", tc.name, outcome, resp.Choices[0].Message.Content, tc.outcome, tc.content)
+		}
+		if failed := errors.Is(err, postprocess.ErrFailed); failed != tc.failed {
+			t.Errorf("%s: error %v", tc.name, err)
+		}
+	}
+}
+
+func TestAllowUnprocessedStream(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		key    models.APIKey
+		allow  bool
+		header string
+		status int
+	}{
+		{"no webhook", models.APIKey{}, true, "", http.StatusOK},
+		{"fail open", models.APIKey{PostprocessURL: "http://scrubber"}, true, "skipped", http.StatusOK},
+		{"fail closed", models.APIKey{PostprocessURL: "http://scrubber", PostprocessFailClosed: true}, false, "", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		if got := allowUnprocessedStream(rec, &tc.key); got != tc.allow {
+			t.Errorf("%s: allowed = %v", tc.name, got)
+		}
+		if got := rec.Header().Get("X-Postprocess"); got != tc.header {
+			t.Errorf("%s: X-Postprocess = %q, want %q", tc.name, got, tc.header)
+		}
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.status)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultQuoteCompletionTokens is the output size quoted when a request sets no max_tokens
+const defaultQuoteCompletionTokens = 256
+
+// providerQuote is the estimated cost of a request on one candidate model
+type providerQuote struct {
+	Provider          string  `json:"provider"`
+	Model             string  `json:"model"`
+	InputCostUSD      float64 `json:"input_cost_usd"`
+	OutputCostUSD     float64 `json:"output_cost_usd"`
+	CostUSD           float64 `json:"cost_usd"`
+	ContextWindow     int     `json:"context_window,omitempty"`
+	FitsContext       bool    `json:"fits_context"`
+	Requested         bool    `json:"requested,omitempty"` // the model the request named
+	PromptTokens      int     `json:"prompt_tokens"`       // estimated with the candidate provider's tokenizer
+	InputPer1kTokens  float64 `json:"input_per_1k_tokens"`
+	OutputPer1kTokens float64 `json:"output_per_1k_tokens"`
+	Error             string  `json:"error,omitempty"` // set when the model has no pricing
+}
+
+// HandleQuote handles GET /v1/quote?model=&prompt_tokens=&completion_tokens= and
+// POST /v1/quote with a chat completion body. It estimates what the request would
+// cost on its model and each equivalent on the configured providers (its
+// failover chain and the rest of its tier), cheapest first, without calling
+// any provider. Prompt-cache discounts aren't included.
+func (h *ChatHandler) HandleQuote(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var model string
+	var promptTokens, completionTokens int
+	var messages []openai.ChatCompletionMessage // set for POST, so each candidate is counted with its own tokenizer
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		model = query.Get("model")
+		var err error
+		if promptTokens, err = quoteTokens(query.Get("prompt_tokens"), 0); err != nil {
+			http.Error(w, "prompt_tokens "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if completionTokens, err = quoteTokens(query.Get("completion_tokens"), defaultQuoteCompletionTokens); err != nil {
+			http.Error(w, "completion_tokens "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var req providers.ChatRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		// Quote the request as it would be sent: prelude, template, history and token cap applied
+		if err := h.prepareRequest(w, r, apiKey, &req); err != nil {
+			http.Error(w, err.Error(), prepareErrorStatus(err))
+			return
+		}
+		model = req.Model
+		messages = req.Messages
+		promptTokens = tokenizer.ForModel(h.providerMgr.DetectProvider(model), model).CountMessages(messages)
+		completionTokens = defaultQuoteCompletionTokens
+		if req.MaxTokens != nil && *req.MaxTokens > 0 {
+			completionTokens = *req.MaxTokens
+		}
+	}
+	if model == "" {
+		http.Error(w, "model is required", http.StatusBadRequest)
+		return
+	}
+
+	candidates := append([]string{model}, h.providerMgr.EquivalentModels(model)...)
+	quotes := make([]providerQuote, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for i, candidate := range candidates {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+
+		quote := providerQuote{
+			Provider:     h.providerMgr.DetectProvider(candidate),
+			Model:        candidate,
+			Requested:    i == 0,
+			PromptTokens: promptTokens,
+		}
+		if messages != nil {
+			quote.PromptTokens = tokenizer.ForModel(quote.Provider, candidate).CountMessages(messages)
+		}
+		pricing, err := h.db.GetModelPricing(ctx, quote.Provider, candidate)
+		if err != nil {
+			quote.Error = fmt.Sprintf("no pricing for %s", candidate)
+			quotes = append(quotes, quote)
+			continue
+		}
+
+		quote.InputPer1kTokens = pricing.InputPer1kTokens
+		quote.OutputPer1kTokens = pricing.OutputPer1kTokens
+		quote.InputCostUSD = float64(quote.PromptTokens) / 1000.0 * pricing.InputPer1kTokens
+		quote.OutputCostUSD = float64(completionTokens) / 1000.0 * pricing.OutputPer1kTokens
+		quote.CostUSD = quote.InputCostUSD + quote.OutputCostUSD
+		quote.ContextWindow = pricing.ContextWindow
+		quote.FitsContext = pricing.ContextWindow <= 0 || quote.PromptTokens+completionTokens <= pricing.ContextWindow
+		quotes = append(quotes, quote)
+	}
+
+	// Cheapest first; unpriced models last
+	sort.SliceStable(quotes, func(i, j int) bool {
+		if (quotes[i].Error == "") != (quotes[j].Error == "") {
+			return quotes[i].Error == ""
+		}
+		return quotes[i].CostUSD < quotes[j].CostUSD
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object":            "quote",
+		"model":             model,
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"quotes":            quotes,
+	})
+}
+
+// quoteTokens parses a token count query parameter, returning def when it's empty
+func quoteTokens(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New("must be a non-negative integer")
+	}
+	return n, nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+type quoteBody struct {
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	Quotes           []providerQuote `json:"quotes"`
+}
+
+// quoteHandler serves every provider but cohere, with prices for three of
+// gpt-4o's equivalents
+func quoteHandler(t *testing.T) *ChatHandler {
+	t.Helper()
+	cfg := &config.Config{}
+	ok := openAIReply("gpt-4o", "", "stop", 0, 0)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": ok, "anthropic": ok, "google": ok})
+
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "anthropic", "claude-sonnet-4-5-20250929", 0.003, 0.015)
+	expectPricing(mock, "google", "gemini-2.5-pro", 0.00125, 0.01)
+	for _, unpriced := range []struct{ provider, model string }{
+		{"openai", "gpt-4"}, {"openai", "gpt-4-turbo"}, {"anthropic", "claude-opus-4-5-20251101"},
+	} {
+		mock.ExpectQuery(selectModelPricing).WithArgs(unpriced.provider, unpriced.model).WillReturnError(sql.ErrNoRows)
+	}
+	return &ChatHandler{cfg: cfg, providerMgr: mgr, db: db}
+}
+
+func serveQuote(t *testing.T, h *ChatHandler, r *http.Request) quoteBody {
+	t.Helper()
+	r = r.WithContext(context.WithValue(r.Context(), "api_key", &models.APIKey{ID: "key-1"}))
+	rec := httptest.NewRecorder()
+	h.HandleQuote(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var body quoteBody
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestQuoteEstimatesEachProvidersEquivalent(t *testing.T) {
+	h := quoteHandler(t)
+	body := serveQuote(t, h, httptest.NewRequest(http.MethodGet, "/v1/quote?model=gpt-4o&prompt_tokens=1000&completion_tokens=500", nil))
+
+	want := []struct {
+		provider, model string
+		cost            float64
+	}{
+		{"google", "gemini-2.5-pro", 0.00125 + 0.005},
+		{"openai", "gpt-4o", 0.0025 + 0.005},
+		{"anthropic", "claude-sonnet-4-5-20250929", 0.003 + 0.0075},
+		{"openai", "gpt-4", 0},
+		{"openai", "gpt-4-turbo", 0},
+		{"anthropic", "claude-opus-4-5-20251101", 0},
+	}
+	if len(body.Quotes) != len(want) {
+		t.Fatalf("expected %d quotes, got %+v", len(want), body.Quotes)
+	}
+	for i, w := range want {
+		q := body.Quotes[i]
+		if q.Provider != w.provider || q.Model != w.model || math.Abs(q.CostUSD-w.cost) > 1e-9 {
+			t.Errorf("quote %d: got %s/%s $%.6f, want %s/%s $%.6f", i, q.Provider, q.Model, q.CostUSD, w.provider, w.model, w.cost)
+		}
+		if priced := w.cost > 0; priced != (q.Error == "") {
+			t.Errorf("quote %d: error %q", i, q.Error)
+		}
+		if q.Requested != (w.model == "gpt-4o") {
+			t.Errorf("quote %d: requested = %v", i, q.Requested)
+		}
+	}
+}
+
+func TestQuoteCountsPromptTokensPerCandidate(t *testing.T) {
+	h := quoteHandler(t)
+	req := httptest.NewRequest(http.MethodPost, "/v1/quote", bytes.NewBufferString(
+		`{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"Summarise the quarterly report in three bullet points, please."}]}`))
+	body := serveQuote(t, h, req)
+
+	if body.CompletionTokens != 100 {
+		t.Errorf("output should be quoted at max_tokens, got %d", body.CompletionTokens)
+	}
+	tokens := map[string]int{}
+	for _, q := range body.Quotes {
+		tokens[q.Model] = q.PromptTokens
+		if q.Error == "" && math.Abs(q.InputCostUSD-float64(q.PromptTokens)/1000*q.InputPer1kTokens) > 1e-12 {
+			t.Errorf("%s: input cost doesn't match its own token count", q.Model)
+		}
+	}
+	if tokens["gpt-4o"] != body.PromptTokens {
+		t.Errorf("requested model counted %d, top-level %d", tokens["gpt-4o"], body.PromptTokens)
+	}
+	if tokens["claude-sonnet-4-5-20250929"] == tokens["gpt-4o"] {
+		t.Error("each candidate should be counted with its own provider's tokenizer")
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+var recordedRateLimit = &providers.UpstreamRateLimit{
+	Limit:           "500",
+	Remaining:       "12",
+	Reset:           "6m0s",
+	RemainingTokens: "29000",
+	RetryAfter:      2500 * time.Millisecond,
+}
+
+func TestUpstreamRateLimitHeadersOnResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	setUpstreamRateLimitHeaders(rec, recordedRateLimit)
+
+	for name, want := range map[string]string{
+		"X-Upstream-RateLimit-Limit":            "500",
+		"X-Upstream-RateLimit-Remaining":        "12",
+		"X-Upstream-RateLimit-Reset":            "6m0s",
+		"X-Upstream-RateLimit-Remaining-Tokens": "29000",
+		"X-Upstream-Retry-After":                "3",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	setUpstreamRateLimitHeaders(rec, nil)
+	if len(rec.Header()) != 0 {
+		t.Errorf("expected no headers without upstream rate limits, got %v", rec.Header())
+	}
+}
+
+func TestUpstreamRateLimitErrorResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	err := &providers.RateLimitError{RateLimit: recordedRateLimit, Err: errors.New("OpenAI API error: rate limited")}
+
+	(&ChatHandler{}).writeChatError(context.Background(), rec, providers.ChatRequest{Model: "gpt-4o"}, err)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After = %q, want 3", got)
+	}
+	if got := rec.Header().Get("X-Upstream-RateLimit-Remaining"); got != "12" {
+		t.Errorf("X-Upstream-RateLimit-Remaining = %q, want 12", got)
+	}
+}
+
+func TestUpstreamRateLimitOnStreamOpen(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "3")
+		w.Header().Set("x-ratelimit-remaining-requests", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+	}})
+	db, mock := mockDB(t)
+	// The streaming check and the context headers
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, &models.APIKey{ID: "key-1"}))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After = %q, want 3", got)
+	}
+	if got := rec.Header().Get("X-Upstream-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-Upstream-RateLimit-Remaining = %q, want 0", got)
+	}
+}
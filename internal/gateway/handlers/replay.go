@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// replayCachedStream replays a cached response as word-sized stream deltas so
+// typewriter-style clients render it the same way as a live stream
+func (h *ChatHandler) replayCachedStream(ctx context.Context, out *sseWriter, resp *providers.ChatResponse) {
+	var content string
+	var toolCalls []openai.ToolCall
+	var finishReason openai.FinishReason = openai.FinishReasonStop
+	if len(resp.Choices) > 0 {
+		content = resp.Choices[0].Message.Content
+		toolCalls = resp.Choices[0].Message.ToolCalls
+		if resp.Choices[0].FinishReason != "" {
+			finishReason = resp.Choices[0].FinishReason
+		}
+	}
+
+	newChunk := func(delta openai.ChatCompletionStreamChoiceDelta) providers.StreamChunk {
+		return providers.StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{Index: 0, Delta: delta},
+			},
+			SystemFingerprint: resp.SystemFingerprint,
+		}}
+	}
+
+	out.Write(newChunk(openai.ChatCompletionStreamChoiceDelta{Role: "assistant"}))
+
+	if resp.Reasoning != "" {
+		reasoningChunk := newChunk(openai.ChatCompletionStreamChoiceDelta{})
+		reasoningChunk.Reasoning = resp.Reasoning
+		out.Write(reasoningChunk)
+	}
+
+	for _, piece := range splitForReplay(content) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.cfg.StreamReplayDelay):
+		}
+
+		out.Write(newChunk(openai.ChatCompletionStreamChoiceDelta{Content: piece}))
+	}
+
+	if len(toolCalls) > 0 {
+		deltas := make([]openai.ToolCall, len(toolCalls))
+		for i, call := range toolCalls {
+			index := i
+			call.Index = &index
+			deltas[i] = call
+		}
+		out.Write(newChunk(openai.ChatCompletionStreamChoiceDelta{ToolCalls: deltas}))
+	}
+
+	final := newChunk(openai.ChatCompletionStreamChoiceDelta{})
+	final.Choices[0].FinishReason = finishReason
+	out.Write(final)
+	out.Write(usageChunk(resp))
+	out.Done()
+}
+
+// splitForReplay splits content into word-sized pieces, keeping the trailing
+// whitespace with each word so the pieces concatenate back to the original
+func splitForReplay(content string) []string {
+	var pieces []string
+	for _, piece := range strings.SplitAfter(content, " ") {
+		if piece != "" {
+			pieces = append(pieces, piece)
+		}
+	}
+	return pieces
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// sseEvents splits an SSE body into its data payloads
+func sseEvents(t *testing.T, body string) []string {
+	t.Helper()
+	var events []string
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		if !strings.HasPrefix(event, "data: ") {
+			t.Fatalf("unexpected SSE event %q", event)
+		}
+		events = append(events, strings.TrimPrefix(event, "data: "))
+	}
+	return events
+}
+
+// streamedContent decodes stream chunks, concatenating their content deltas
+func streamedContent(t *testing.T, events []string) (content string, contentChunks int) {
+	t.Helper()
+	for _, data := range events {
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk providers.StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content += choice.Delta.Content
+				contentChunks++
+			}
+		}
+	}
+	return content, contentChunks
+}
+
+func TestCachedStreamIsReplayedInChunks(t *testing.T) {
+	cfg := &config.Config{StreamReplayDelay: 5 * time.Millisecond, CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	upstreamCalls := 0
+	reply := openAIReply("gpt-4o", "The capital of France is Paris.", "stop", 14, 7)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		reply(w, r)
+	}})
+	db, mock := mockDB(t)
+	// The completion is priced, its cache TTL and context window looked up;
+	// the stream checks the model streams and looks up its context window
+	for i := 0; i < 5; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"What is the capital of France?"}]}`
+
+	// Fill the cache with a regular completion, then stream the same request
+	h.HandleChatCompletion(httptest.NewRecorder(), chatRequest(body, key))
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.HandleChatCompletion(rec, chatRequest(strings.Replace(body, "{", `{"stream":true,`, 1), key))
+	elapsed := time.Since(start)
+
+	if upstreamCalls != 1 {
+		t.Fatalf("expected the stream served from cache, got %d upstream calls", upstreamCalls)
+	}
+	if rec.Header().Get("X-Cache-Hit") != "true" {
+		t.Errorf("X-Cache-Hit = %q", rec.Header().Get("X-Cache-Hit"))
+	}
+	events := sseEvents(t, rec.Body.String())
+	if events[len(events)-1] != "[DONE]" {
+		t.Errorf("expected the replay to end with [DONE], got %q", events[len(events)-1])
+	}
+	content, chunks := streamedContent(t, events)
+	if content != "The capital of France is Paris." || chunks != 6 {
+		t.Errorf("replayed %q in %d chunks, want the cached content word by word", content, chunks)
+	}
+	if elapsed < 6*cfg.StreamReplayDelay {
+		t.Errorf("replay took %s, expected the configured delay between chunks", elapsed)
+	}
+}
+
+func TestSplitForReplayConcatenatesBack(t *testing.T) {
+	for _, content := range []string{"", "one", "two words", "trailing space ", "  leading and  double"} {
+		if got := strings.Join(splitForReplay(content), ""); got != content {
+			t.Errorf("%q split and joined as %q", content, got)
+		}
+	}
+}
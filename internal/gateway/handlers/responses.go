@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// responsesEndpoint is the route Responses API requests are logged under
+const responsesEndpoint = "/v1/responses"
+
+// responsesRequest is the body of POST /v1/responses (OpenAI's Responses API).
+// It is mapped onto a ChatRequest and served by the normal chat pipeline.
+type responsesRequest struct {
+	Model           string            `json:"model"`
+	Input           json.RawMessage   `json:"input"` // string or array of message items
+	Instructions    string            `json:"instructions,omitempty"`
+	MaxOutputTokens *int              `json:"max_output_tokens,omitempty"`
+	Temperature     *float32          `json:"temperature,omitempty"`
+	TopP            *float32          `json:"top_p,omitempty"`
+	Stream          bool              `json:"stream,omitempty"`
+	User            string            `json:"user,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	Reasoning       *struct {
+		Effort string `json:"effort,omitempty"`
+	} `json:"reasoning,omitempty"`
+	Text *struct {
+		Format *responsesTextFormat `json:"format,omitempty"`
+	} `json:"text,omitempty"`
+	PreviousResponseID string `json:"previous_response_id,omitempty"` // not supported; use conversation_id
+	ConversationID     string `json:"conversation_id,omitempty"`      // gateway extension, as on chat completions
+}
+
+// responsesTextFormat is text.format: "text", "json_object" or a flattened "json_schema"
+type responsesTextFormat struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// responsesInputItem is one entry of an input array. Only message items are supported.
+type responsesInputItem struct {
+	Type    string          `json:"type,omitempty"` // "message" (default)
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // string or array of content parts
+}
+
+// responsesContentPart is one part of an input message's content
+type responsesContentPart struct {
+	Type     string `json:"type"` // "input_text", "output_text" or "input_image"
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// chatRequest maps the body onto a ChatRequest
+func (rr *responsesRequest) chatRequest() (providers.ChatRequest, error) {
+	req := providers.ChatRequest{
+		Model:          rr.Model,
+		MaxTokens:      rr.MaxOutputTokens,
+		Temperature:    rr.Temperature,
+		TopP:           rr.TopP,
+		Stream:         rr.Stream,
+		User:           rr.User,
+		Metadata:       rr.Metadata,
+		ConversationID: rr.ConversationID,
+		Endpoint:       responsesEndpoint,
+	}
+	if rr.PreviousResponseID != "" {
+		return req, errors.New("previous_response_id is not supported; use conversation_id for server-side history")
+	}
+	if rr.Reasoning != nil {
+		req.ReasoningEffort = rr.Reasoning.Effort
+	}
+	if rr.Text != nil && rr.Text.Format != nil {
+		format := rr.Text.Format
+		req.ResponseFormat = &providers.ResponseFormat{Type: format.Type}
+		if format.Type == "json_schema" {
+			req.ResponseFormat.JSONSchema = &providers.JSONSchemaFormat{
+				Name:        format.Name,
+				Description: format.Description,
+				Schema:      format.Schema,
+				Strict:      format.Strict,
+			}
+		}
+	}
+
+	if rr.Instructions != "" {
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: rr.Instructions})
+	}
+	messages, err := responsesInputMessages(rr.Input)
+	if err != nil {
+		return req, err
+	}
+	req.Messages = append(req.Messages, messages...)
+	return req, nil
+}
+
+// responsesInputMessages converts input, a string or an array of message
+// items, into chat messages
+func responsesInputMessages(input json.RawMessage) ([]openai.ChatCompletionMessage, error) {
+	if len(input) == 0 || string(input) == "null" {
+		return nil, errors.New("input is required")
+	}
+
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: text}}, nil
+	}
+
+	var items []responsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, errors.New("input must be a string or an array of message items")
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(items))
+	for i, item := range items {
+		if item.Type != "" && item.Type != "message" {
+			return nil, fmt.Errorf("input[%d]: item type %q is not supported", i, item.Type)
+		}
+		msg := openai.ChatCompletionMessage{Role: item.Role}
+		switch item.Role {
+		case openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant, openai.ChatMessageRoleSystem:
+		case "developer":
+			msg.Role = openai.ChatMessageRoleSystem
+		default:
+			return nil, fmt.Errorf("input[%d]: invalid role %q", i, item.Role)
+		}
+		if err := setResponsesContent(&msg, item.Content); err != nil {
+			return nil, fmt.Errorf("input[%d]: %w", i, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// setResponsesContent fills a message from string or content-part content.
+// Text-only parts are joined into plain content so every provider can read them.
+func setResponsesContent(msg *openai.ChatCompletionMessage, content json.RawMessage) error {
+	if err := json.Unmarshal(content, &msg.Content); err == nil {
+		return nil
+	}
+
+	var parts []responsesContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return errors.New("content must be a string or an array of content parts")
+	}
+
+	var texts []string
+	var multi []openai.ChatMessagePart
+	hasImage := false
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			texts = append(texts, part.Text)
+			multi = append(multi, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: part.Text})
+		case "input_image":
+			if part.ImageURL == "" {
+				return errors.New("input_image requires image_url")
+			}
+			hasImage = true
+			multi = append(multi, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: part.ImageURL, Detail: openai.ImageURLDetail(part.Detail)},
+			})
+		default:
+			return fmt.Errorf("content part type %q is not supported", part.Type)
+		}
+	}
+	if hasImage {
+		msg.MultiContent = multi
+	} else {
+		msg.Content = strings.Join(texts, "\n")
+	}
+	return nil
+}
+
+// responsesResponse is a Responses API response object
+type responsesResponse struct {
+	ID                string               `json:"id"`
+	Object            string               `json:"object"`
+	CreatedAt         int64                `json:"created_at"`
+	Status            string               `json:"status"` // "in_progress", "completed" or "incomplete"
+	IncompleteDetails *responsesIncomplete `json:"incomplete_details"`
+	Model             string               `json:"model"`
+	Output            []responsesOutput    `json:"output"`
+	Usage             *responsesUsage      `json:"usage"`
+	CostUSD           float64              `json:"cost_usd"`
+}
+
+// responsesIncomplete says why a response stopped early
+type responsesIncomplete struct {
+	Reason string `json:"reason"` // "max_output_tokens" or "content_filter"
+}
+
+// responsesOutput is an output item: an assistant message or a reasoning summary
+type responsesOutput struct {
+	Type    string                  `json:"type"` // "message" or "reasoning"
+	ID      string                  `json:"id"`
+	Status  string                  `json:"status,omitempty"`
+	Role    string                  `json:"role,omitempty"`
+	Content []responsesOutputText   `json:"content,omitempty"`
+	Summary []responsesReasoningSum `json:"summary,omitempty"`
+}
+
+// responsesOutputText is an output_text content part
+type responsesOutputText struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// responsesReasoningSum is a reasoning item's summary_text part
+type responsesReasoningSum struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// responsesUsage is token usage in Responses API terms
+type responsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	TotalTokens        int `json:"total_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+}
+
+// newResponsesUsage converts chat usage
+func newResponsesUsage(usage openai.Usage) *responsesUsage {
+	out := &responsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+	if usage.PromptTokensDetails != nil {
+		out.InputTokensDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		out.OutputTokensDetails.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return out
+}
+
+// responsesStatus maps a chat finish reason to a response status
+func responsesStatus(finishReason openai.FinishReason) (string, *responsesIncomplete) {
+	switch finishReason {
+	case openai.FinishReasonLength:
+		return "incomplete", &responsesIncomplete{Reason: "max_output_tokens"}
+	case openai.FinishReasonContentFilter:
+		return "incomplete", &responsesIncomplete{Reason: "content_filter"}
+	}
+	return "completed", nil
+}
+
+// newResponsesMessage builds the assistant message output item
+func newResponsesMessage(id, status, text string) responsesOutput {
+	return responsesOutput{
+		Type:    "message",
+		ID:      "msg_" + id,
+		Status:  status,
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: []responsesOutputText{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+	}
+}
+
+// newResponsesResponse converts a chat completion into a response object
+func newResponsesResponse(resp *providers.ChatResponse) responsesResponse {
+	out := responsesResponse{
+		ID:        "resp_" + resp.ID,
+		Object:    "response",
+		CreatedAt: resp.Created,
+		Model:     resp.Model,
+		Output:    []responsesOutput{},
+		Usage:     newResponsesUsage(resp.Usage),
+		CostUSD:   resp.CostUSD,
+	}
+
+	var text string
+	var finishReason openai.FinishReason
+	if len(resp.Choices) > 0 {
+		text = resp.Choices[0].Message.Content
+		finishReason = resp.Choices[0].FinishReason
+	}
+	out.Status, out.IncompleteDetails = responsesStatus(finishReason)
+
+	if resp.Reasoning != "" {
+		out.Output = append(out.Output, responsesOutput{
+			Type:    "reasoning",
+			ID:      "rs_" + resp.ID,
+			Summary: []responsesReasoningSum{{Type: "summary_text", Text: resp.Reasoning}},
+		})
+	}
+	out.Output = append(out.Output, newResponsesMessage(resp.ID, out.Status, text))
+	return out
+}
+
+// HandleResponses handles POST /v1/responses, an OpenAI Responses API-shaped
+// front end to the chat completions pipeline
+func (h *ChatHandler) HandleResponses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	startTime := time.Now()
+
+	apiKey, ok := ctx.Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body responsesRequest
+	if err := decodeJSONBody(r, &body); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	req, err := body.chatRequest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.prepareRequest(w, r, apiKey, &req); err != nil {
+		http.Error(w, err.Error(), prepareErrorStatus(err))
+		return
+	}
+
+	if req.Stream {
+		if _, aggregate := negotiateStream(r); !aggregate && !bufferStreams(apiKey) {
+			h.handleStreamingChat(w, r, apiKey, req, formatResponses)
+			return
+		}
+		req.Stream = false
+		req.BufferStream = bufferStreams(apiKey)
+	}
+
+	result := h.completeChat(ctx, r, apiKey, req)
+	if result.err != nil {
+		h.writeChatError(ctx, w, req, result.err)
+		return
+	}
+	resp := h.finishCompletion(w, r, req, result, startTime)
+
+	json.NewEncoder(w).Encode(newResponsesResponse(resp))
+}
+
+// responsesStream translates chat stream chunks into Responses API events:
+// response.created, then output item and content part events around the
+// output_text deltas, then response.completed with usage
+type responsesStream struct {
+	seq      int
+	started  bool
+	finished bool
+
+	id      string
+	model   string
+	created int64
+	text    strings.Builder
+
+	finishReason openai.FinishReason
+}
+
+// write translates one sseWriter event, a StreamChunk or an error map
+func (e *responsesStream) write(w io.Writer, event interface{}) {
+	switch ev := event.(type) {
+	case providers.StreamChunk:
+		e.chunk(w, ev)
+	case map[string]string:
+		e.emit(w, "error", map[string]interface{}{"message": ev["error"]})
+	}
+}
+
+// chunk emits the events for one chat chunk
+func (e *responsesStream) chunk(w io.Writer, chunk providers.StreamChunk) {
+	if e.finished {
+		return
+	}
+	if !e.started {
+		e.start(w, chunk)
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			e.text.WriteString(choice.Delta.Content)
+			e.emit(w, "response.output_text.delta", map[string]interface{}{
+				"item_id":       "msg_" + e.id,
+				"output_index":  0,
+				"content_index": 0,
+				"delta":         choice.Delta.Content,
+			})
+		}
+		if choice.FinishReason != "" {
+			e.finishReason = choice.FinishReason
+		}
+	}
+
+	// The gateway's final usage chunk closes the response
+	if chunk.Usage != nil {
+		cost := 0.0
+		if chunk.CostUSD != nil {
+			cost = *chunk.CostUSD
+		}
+		if chunk.Model != "" {
+			e.model = chunk.Model
+		}
+		e.finish(w, newResponsesUsage(*chunk.Usage), cost)
+	}
+}
+
+// start emits response.created and opens the message item and its text part
+func (e *responsesStream) start(w io.Writer, chunk providers.StreamChunk) {
+	e.started = true
+	e.id = chunk.ID
+	e.model = chunk.Model
+	e.created = chunk.Created
+	if e.created == 0 {
+		e.created = time.Now().Unix()
+	}
+
+	e.emit(w, "response.created", map[string]interface{}{"response": e.response("in_progress", nil, nil, nil, 0)})
+	item := newResponsesMessage(e.id, "in_progress", "")
+	item.Content = []responsesOutputText{}
+	e.emit(w, "response.output_item.added", map[string]interface{}{"output_index": 0, "item": item})
+	e.emit(w, "response.content_part.added", map[string]interface{}{
+		"item_id":       "msg_" + e.id,
+		"output_index":  0,
+		"content_index": 0,
+		"part":          responsesOutputText{Type: "output_text", Text: "", Annotations: []interface{}{}},
+	})
+}
+
+// finish closes the text part and message item and emits response.completed
+// (or response.incomplete after a length or content-filter stop)
+func (e *responsesStream) finish(w io.Writer, usage *responsesUsage, cost float64) {
+	e.finished = true
+	status, incomplete := responsesStatus(e.finishReason)
+	text := e.text.String()
+	item := newResponsesMessage(e.id, status, text)
+
+	e.emit(w, "response.output_text.done", map[string]interface{}{
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+		"text":          text,
+	})
+	e.emit(w, "response.content_part.done", map[string]interface{}{
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+		"part":          item.Content[0],
+	})
+	e.emit(w, "response.output_item.done", map[string]interface{}{"output_index": 0, "item": item})
+
+	eventType := "response.completed"
+	if status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	e.emit(w, eventType, map[string]interface{}{"response": e.response(status, incomplete, []responsesOutput{item}, usage, cost)})
+}
+
+// response builds the response object carried by lifecycle events
+func (e *responsesStream) response(status string, incomplete *responsesIncomplete, output []responsesOutput, usage *responsesUsage, cost float64) responsesResponse {
+	if output == nil {
+		output = []responsesOutput{}
+	}
+	return responsesResponse{
+		ID:                "resp_" + e.id,
+		Object:            "response",
+		CreatedAt:         e.created,
+		Status:            status,
+		IncompleteDetails: incomplete,
+		Model:             e.model,
+		Output:            output,
+		Usage:             usage,
+		CostUSD:           cost,
+	}
+}
+
+// emit writes a named SSE event; fields gain the type and a sequence number
+func (e *responsesStream) emit(w io.Writer, eventType string, fields map[string]interface{}) {
+	fields["type"] = eventType
+	fields["sequence_number"] = e.seq
+	e.seq++
+	data, _ := json.Marshal(fields)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data)
+}
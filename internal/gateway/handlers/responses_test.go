@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResponsesRequestMapsToChatRequest(t *testing.T) {
+	var body responsesRequest
+	if err := json.Unmarshal([]byte(`{
+		"model": "gpt-4o",
+		"instructions": "You are a travel agent.",
+		"input": [
+			{"role": "developer", "content": "Prices in EUR."},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Plan a trip"}, {"type": "input_text", "text": "to Lisbon."}]},
+			{"role": "assistant", "content": [{"type": "output_text", "text": "For how long?"}]},
+			{"role": "user", "content": [{"type": "input_text", "text": "This one:"}, {"type": "input_image", "image_url": "https://example.com/flyer.png", "detail": "low"}]}
+		],
+		"max_output_tokens": 500,
+		"temperature": 0.2,
+		"user": "user-42",
+		"metadata": {"team": "travel"},
+		"reasoning": {"effort": "low"},
+		"text": {"format": {"type": "json_schema", "name": "itinerary", "schema": {"type": "object"}, "strict": true}}
+	}`), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := body.chatRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != "gpt-4o" || *req.MaxTokens != 500 || *req.Temperature != 0.2 || req.User != "user-42" || req.Metadata["team"] != "travel" || req.ReasoningEffort != "low" {
+		t.Errorf("unexpected fields: %+v", req)
+	}
+	if req.Endpoint != responsesEndpoint {
+		t.Errorf("expected the request logged under %s, got %q", responsesEndpoint, req.Endpoint)
+	}
+	if f := req.ResponseFormat; f == nil || f.Type != "json_schema" || f.JSONSchema.Name != "itinerary" || !f.JSONSchema.Strict || string(f.JSONSchema.Schema) != `{"type": "object"}` {
+		t.Errorf("unexpected response format: %+v", req.ResponseFormat)
+	}
+
+	// Instructions lead as a system message; developer messages become system;
+	// text parts are joined and images keep their parts
+	msgs := req.Messages
+	if len(msgs) != 5 {
+		t.Fatalf("expected 5 messages, got %+v", msgs)
+	}
+	for i, want := range []openai.ChatCompletionMessage{
+		{Role: "system", Content: "You are a travel agent."},
+		{Role: "system", Content: "Prices in EUR."},
+		{Role: "user", Content: "Plan a trip\nto Lisbon."},
+		{Role: "assistant", Content: "For how long?"},
+	} {
+		if msgs[i].Role != want.Role || msgs[i].Content != want.Content {
+			t.Errorf("message %d: got %s %q, want %s %q", i, msgs[i].Role, msgs[i].Content, want.Role, want.Content)
+		}
+	}
+	parts := msgs[4].MultiContent
+	if len(parts) != 2 || parts[0].Text != "This one:" || parts[1].ImageURL == nil || parts[1].ImageURL.URL != "https://example.com/flyer.png" || parts[1].ImageURL.Detail != openai.ImageURLDetailLow {
+		t.Errorf("unexpected image message: %+v", msgs[4])
+	}
+}
+
+func TestResponsesStringInputIsOneUserMessage(t *testing.T) {
+	body := responsesRequest{Model: "gpt-4o", Input: json.RawMessage(`"Hello"`)}
+	req, err := body.chatRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content != "Hello" || req.ResponseFormat != nil {
+		t.Errorf("got %+v", req)
+	}
+}
+
+func TestResponsesRequestRejectsUnsupportedInput(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body, want string
+	}{
+		"no input":             {`{"model":"gpt-4o"}`, "input is required"},
+		"previous response":    {`{"model":"gpt-4o","input":"Hi","previous_response_id":"resp_1"}`, "previous_response_id is not supported"},
+		"wrong input shape":    {`{"model":"gpt-4o","input":42}`, "input must be a string or an array"},
+		"function call item":   {`{"model":"gpt-4o","input":[{"type":"function_call_output","call_id":"c1"}]}`, `input[0]: item type "function_call_output" is not supported`},
+		"unknown role":         {`{"model":"gpt-4o","input":[{"role":"tool","content":"42"}]}`, `input[0]: invalid role "tool"`},
+		"file part":            {`{"model":"gpt-4o","input":[{"role":"user","content":[{"type":"input_file","file_id":"f1"}]}]}`, `content part type "input_file" is not supported`},
+		"image without a URL":  {`{"model":"gpt-4o","input":[{"role":"user","content":[{"type":"input_image"}]}]}`, "input_image requires image_url"},
+		"numeric item content": {`{"model":"gpt-4o","input":[{"role":"user","content":5}]}`, "content must be a string or an array of content parts"},
+	} {
+		var body responsesRequest
+		if err := json.Unmarshal([]byte(tc.body), &body); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := body.chatRequest(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected %q, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestChatResponseMapsToAResponseObject(t *testing.T) {
+	resp := completion("gpt-4o-2024-08-06", "Day 1: Alfama.", openai.FinishReasonLength, 120, 40)
+	resp.ID, resp.Created, resp.CostUSD = "chatcmpl-9", 1751328000, 0.0007
+	resp.Reasoning = "Start with the old town."
+	resp.Usage.PromptTokensDetails = &openai.PromptTokensDetails{CachedTokens: 100}
+	resp.Usage.CompletionTokensDetails = &openai.CompletionTokensDetails{ReasoningTokens: 12}
+
+	out := newResponsesResponse(resp)
+	if out.ID != "resp_chatcmpl-9" || out.Object != "response" || out.CreatedAt != 1751328000 || out.Model != "gpt-4o-2024-08-06" || out.CostUSD != 0.0007 {
+		t.Errorf("unexpected response: %+v", out)
+	}
+	// A length stop is an incomplete response
+	if out.Status != "incomplete" || out.IncompleteDetails == nil || out.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("expected incomplete for max_output_tokens, got %s %+v", out.Status, out.IncompleteDetails)
+	}
+	if u := out.Usage; u.InputTokens != 120 || u.OutputTokens != 40 || u.TotalTokens != 160 || u.InputTokensDetails.CachedTokens != 100 || u.OutputTokensDetails.ReasoningTokens != 12 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+	if len(out.Output) != 2 || out.Output[0].Type != "reasoning" || out.Output[0].Summary[0].Text != "Start with the old town." {
+		t.Fatalf("expected a reasoning item then the message, got %+v", out.Output)
+	}
+	if msg := out.Output[1]; msg.Type != "message" || msg.ID != "msg_chatcmpl-9" || msg.Role != "assistant" || msg.Status != "incomplete" || msg.Content[0].Type != "output_text" || msg.Content[0].Text != "Day 1: Alfama." {
+		t.Errorf("unexpected message item: %+v", msg)
+	}
+
+	stopped := newResponsesResponse(completion("gpt-4o", "Done.", openai.FinishReasonStop, 1, 1))
+	if stopped.Status != "completed" || stopped.IncompleteDetails != nil || len(stopped.Output) != 1 {
+		t.Errorf("expected a completed response with one item, got %+v", stopped)
+	}
+}
+
+func TestHandleResponsesServesThroughTheChatPipeline(t *testing.T) {
+	cfg := &config.Config{}
+	var mu sync.Mutex
+	var sent []openai.ChatCompletionMessage
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = body.Messages
+		mu.Unlock()
+		openAIReply("gpt-4o", "Hola.", "stop", 12, 3)(w, r)
+	}})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleResponses(rec, chatRequest(`{"model":"gpt-4o","instructions":"Reply in Spanish.","input":"Hello"}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(sent) != 2 || sent[0].Role != "system" || sent[0].Content != "Reply in Spanish." || sent[1].Content != "Hello" {
+		t.Errorf("unexpected upstream messages: %+v", sent)
+	}
+
+	var out responsesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Object != "response" || out.Status != "completed" || len(out.Output) != 1 || out.Output[0].Content[0].Text != "Hola." {
+		t.Errorf("unexpected response: %+v", out)
+	}
+	if out.Usage.InputTokens != 12 || out.Usage.OutputTokens != 3 || rec.Header().Get("X-Cost-USD") != "0.000060" {
+		t.Errorf("unexpected usage %+v or cost %s", out.Usage, rec.Header().Get("X-Cost-USD"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.HandleResponses(rec, chatRequest(`{"model":"gpt-4o","input":"Hi","previous_response_id":"resp_1"}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for previous_response_id, got %d", rec.Code)
+	}
+}
+
+// responsesEvent is one named event of a Responses API stream
+type responsesEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+func responsesEvents(t *testing.T, body string) []responsesEvent {
+	t.Helper()
+	var events []responsesEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		name, data, ok := strings.Cut(block, "\n")
+		if !ok || !strings.HasPrefix(name, "event: ") || !strings.HasPrefix(data, "data: ") {
+			t.Fatalf("unexpected event %q", block)
+		}
+		ev := responsesEvent{name: strings.TrimPrefix(name, "event: ")}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &ev.data); err != nil {
+			t.Fatalf("bad event data %q: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestHandleResponsesStreamsResponsesEvents(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAITokenStream([]string{"Hola", ", ", "mundo."})})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleResponses(rec, chatRequest(`{"model":"gpt-4o","stream":true,"input":"Say hello in Spanish."}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d (%s): %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "[DONE]") {
+		t.Error("Responses API streams end without [DONE]")
+	}
+
+	events := responsesEvents(t, rec.Body.String())
+	var names, deltas []string
+	for i, ev := range events {
+		names = append(names, ev.name)
+		if ev.data["type"] != ev.name || ev.data["sequence_number"] != float64(i) {
+			t.Errorf("event %d: type %v, sequence %v", i, ev.data["type"], ev.data["sequence_number"])
+		}
+		if ev.name == "response.output_text.delta" {
+			deltas = append(deltas, ev.data["delta"].(string))
+		}
+	}
+	want := []string{
+		"response.created", "response.output_item.added", "response.content_part.added",
+		"response.output_text.delta", "response.output_text.delta", "response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.completed",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events:\n%s\nwant:\n%s", strings.Join(names, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Join(deltas, "") != "Hola, mundo." || events[6].data["text"] != "Hola, mundo." {
+		t.Errorf("unexpected text %v / %v", deltas, events[6].data["text"])
+	}
+
+	// The final event carries the whole response with usage and cost
+	var final responsesResponse
+	raw, _ := json.Marshal(events[len(events)-1].data["response"])
+	if err := json.Unmarshal(raw, &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.ID != "resp_c" || final.Status != "completed" || final.Model != "gpt-4o" || final.Output[0].Content[0].Text != "Hola, mundo." {
+		t.Errorf("unexpected final response: %+v", final)
+	}
+	if final.Usage == nil || final.Usage.InputTokens != 10 || final.Usage.OutputTokens != 60 || fmt.Sprintf("%.6f", final.CostUSD) != "0.000625" {
+		t.Errorf("unexpected usage %+v or cost %v", final.Usage, final.CostUSD)
+	}
+}
+
+func TestResponsesStreamReportsAnIncompleteStop(t *testing.T) {
+	rec := httptest.NewRecorder()
+	e := &responsesStream{}
+	for _, data := range []string{
+		`{"id":"c","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Once upon"}}]}`,
+		`{"id":"c","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+		`{"id":"c","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+		// Anything after the final event is dropped
+		`{"id":"c","choices":[{"index":0,"delta":{"content":"late"}}]}`,
+	} {
+		var chunk providers.StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		e.write(rec, chunk)
+	}
+
+	events := responsesEvents(t, rec.Body.String())
+	last := events[len(events)-1]
+	if last.name != "response.incomplete" || strings.Contains(rec.Body.String(), "late") {
+		t.Fatalf("expected the stream to end with response.incomplete, got %s", last.name)
+	}
+	response := last.data["response"].(map[string]interface{})
+	if details := response["incomplete_details"].(map[string]interface{}); details["reason"] != "max_output_tokens" {
+		t.Errorf("unexpected incomplete details %v", details)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/jsonrepair"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/jsonschema"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// schemaRetryPrompt asks the model to fix output that didn't match the response schema
+const schemaRetryPrompt = "Your previous response did not match the required JSON schema:\n%s\nReply again with only JSON that conforms to the schema."
+
+// maxSchemaErrorsHeader bounds the X-Schema-Errors header
+const maxSchemaErrorsHeader = 1024
+
+// schemaValidationError is returned when a completion still doesn't match its
+// json_schema after the schema_retry attempt
+type schemaValidationError struct {
+	Violations []string
+}
+
+func (e *schemaValidationError) Error() string {
+	return "completion does not match the response schema: " + strings.Join(e.Violations, "; ")
+}
+
+// schemaViolations checks the first choice of a json_schema completion against
+// the request's schema, after JSON repair when it's requested. Returns nil when
+// there is no schema or the output conforms.
+func schemaViolations(req providers.ChatRequest, resp *providers.ChatResponse, repair bool) []string {
+	format := req.ResponseFormat
+	if format == nil || format.Type != "json_schema" || format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 || len(resp.Choices) == 0 {
+		return nil
+	}
+
+	content := resp.Choices[0].Message.Content
+	if repair {
+		if fixed, _, err := jsonrepair.Repair(content); err == nil {
+			content = fixed
+		}
+	}
+
+	violations, err := jsonschema.Validate(format.JSONSchema.Schema, []byte(content))
+	if errors.Is(err, jsonschema.ErrInvalidJSON) {
+		return []string{err.Error()}
+	}
+	if err != nil {
+		log.Printf("Skipping schema validation for %s: %v", req.Model, err)
+		return nil
+	}
+	return violations
+}
+
+// validateSchema checks a json_schema completion when SCHEMA_VALIDATION is on.
+// With schema_retry, nonconforming output is re-requested once with the
+// violations quoted back to the model, and the reply replaces it; the retry's
+// usage and cost are added so both calls are accounted for. Returns the violations that remain
+// and whether a retry was made.
+func (h *ChatHandler) validateSchema(ctx context.Context, r *http.Request, req providers.ChatRequest, resp *providers.ChatResponse) ([]string, bool) {
+	if !h.cfg.SchemaValidation {
+		return nil, false
+	}
+	repair := req.RepairJSON || r.Header.Get("X-JSON-Repair") == "true"
+	violations := schemaViolations(req, resp, repair)
+	if len(violations) == 0 || !req.SchemaRetry {
+		return violations, false
+	}
+
+	retryReq := req
+	retryReq.Messages = append(append([]openai.ChatCompletionMessage{}, req.Messages...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: resp.Choices[0].Message.Content},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf(schemaRetryPrompt, "- "+strings.Join(violations, "\n- "))},
+	)
+
+	next, providerName, _, err := h.providerMgr.ChatCompletion(ctx, retryReq)
+	if err != nil || len(next.Choices) == 0 {
+		log.Printf("Schema retry for %s failed: %v", req.Model, err)
+		return violations, true
+	}
+	resp.Choices = next.Choices
+	addUsage(resp, next)
+	h.addCallCost(ctx, resp, next, providerName, retryReq.Model)
+	return schemaViolations(req, resp, repair), true
+}
+
+// setSchemaHeaders reports a schema check on a returned completion
+func setSchemaHeaders(w http.ResponseWriter, result chatResult) {
+	if result.schemaRetried {
+		w.Header().Set("X-Schema-Retried", "true")
+	}
+	if len(result.schemaErrors) == 0 {
+		return
+	}
+	w.Header().Set("X-Schema-Valid", "false")
+	errs := strings.ReplaceAll(strings.Join(result.schemaErrors, "; "), "\n", " ")
+	if len(errs) > maxSchemaErrorsHeader {
+		errs = errs[:maxSchemaErrorsHeader]
+	}
+	w.Header().Set("X-Schema-Errors", errs)
+}
+
+// writeSchemaValidationFailed writes a structured 422 listing the violations
+func writeSchemaValidationFailed(w http.ResponseWriter, schemaErr *schemaValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"type":       "schema_validation_failed",
+			"message":    schemaErr.Error(),
+			"violations": schemaErr.Violations,
+		},
+	})
+}
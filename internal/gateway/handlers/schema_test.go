@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// schemaRequest asks for a city in json_schema format
+const schemaRequest = `{"model":"gpt-4o","messages":[{"role":"user","content":"Name a French city."}],
+	"response_format":{"type":"json_schema","json_schema":{"name":"city","schema":{"type":"object","properties":{"city":{"type":"string"},"population":{"type":"integer"}},"required":["city","population"],"additionalProperties":false}}}}`
+
+// replyingUpstream answers each call with the next of replies, recording the
+// messages it was sent
+func replyingUpstream(replies ...string) (http.HandlerFunc, func() [][]openai.ChatCompletionMessage) {
+	var mu sync.Mutex
+	var calls [][]openai.ChatCompletionMessage
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls = append(calls, body.Messages)
+		reply := replies[(len(calls)-1)%len(replies)]
+		mu.Unlock()
+		openAIReply("gpt-4o", reply, "stop", 20, 10)(w, r)
+	}
+	return handler, func() [][]openai.ChatCompletionMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+func TestSchemaConformingOutputPasses(t *testing.T) {
+	cfg := &config.Config{SchemaValidation: true}
+	upstream, calls := replyingUpstream(`{"city": "Lyon", "population": 522000}`)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(schemaRequest, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	for _, header := range []string{"X-Schema-Valid", "X-Schema-Errors", "X-Schema-Retried"} {
+		if rec.Header().Get(header) != "" {
+			t.Errorf("unexpected %s: %q", header, rec.Header().Get(header))
+		}
+	}
+	if len(calls()) != 1 {
+		t.Errorf("expected 1 upstream call, got %d", len(calls()))
+	}
+}
+
+func TestSchemaNonConformingOutputIsFlagged(t *testing.T) {
+	cfg := &config.Config{SchemaValidation: true}
+	upstream, calls := replyingUpstream(`{"city": "Lyon", "population": "about half a million"}`)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	// Without schema_retry, the output is returned with its violations
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(schemaRequest, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("X-Schema-Valid") != "false" || rec.Header().Get("X-Schema-Errors") != "$.population: expected integer, got string" {
+		t.Errorf("unexpected schema headers: valid %q, errors %q", rec.Header().Get("X-Schema-Valid"), rec.Header().Get("X-Schema-Errors"))
+	}
+	if rec.Header().Get("X-Schema-Retried") != "" || len(calls()) != 1 {
+		t.Errorf("expected no retry, got %d calls", len(calls()))
+	}
+}
+
+func TestSchemaRetryCorrectsTheOutput(t *testing.T) {
+	cfg := &config.Config{SchemaValidation: true}
+	upstream, calls := replyingUpstream(`{"city": "Lyon"}`, `{"city": "Lyon", "population": 522000}`)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	req := chatRequest(schemaRequest, &models.APIKey{ID: "key-1"})
+	req.Header.Set("X-Schema-Retry", "true")
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != `{"city": "Lyon", "population": 522000}` {
+		t.Errorf("expected the corrected output, got %q", resp.Choices[0].Message.Content)
+	}
+	if rec.Header().Get("X-Schema-Retried") != "true" || rec.Header().Get("X-Schema-Valid") != "" {
+		t.Errorf("unexpected schema headers: retried %q, valid %q", rec.Header().Get("X-Schema-Retried"), rec.Header().Get("X-Schema-Valid"))
+	}
+	// Usage covers both calls
+	if resp.Usage.PromptTokens != 40 || resp.Usage.CompletionTokens != 20 {
+		t.Errorf("expected the usage of both calls, got %+v", resp.Usage)
+	}
+
+	// The retry quotes the bad output and its violations back to the model
+	sent := calls()
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 upstream calls, got %d", len(sent))
+	}
+	retry := sent[1]
+	if len(retry) != 3 || retry[1].Role != openai.ChatMessageRoleAssistant || retry[1].Content != `{"city": "Lyon"}` {
+		t.Fatalf("unexpected retry messages %+v", retry)
+	}
+	if !strings.Contains(retry[2].Content, `- $: missing required property "population"`) {
+		t.Errorf("expected the violations in the retry prompt, got %q", retry[2].Content)
+	}
+}
+
+func TestSchemaRetryFailureReturns422(t *testing.T) {
+	cfg := &config.Config{SchemaValidation: true}
+	upstream, calls := replyingUpstream(`Lyon, population 522000`)
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": upstream})
+	db, mock := mockDB(t)
+	expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(strings.Replace(schemaRequest, `"model":"gpt-4o"`, `"model":"gpt-4o","schema_retry":true`, 1), &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Error struct {
+			Type       string   `json:"type"`
+			Violations []string `json:"violations"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Type != "schema_validation_failed" || len(body.Error.Violations) != 1 || body.Error.Violations[0] != "output is not valid JSON" {
+		t.Errorf("unexpected error body %+v", body.Error)
+	}
+	if len(calls()) != 2 {
+		t.Errorf("expected the one retry, got %d calls", len(calls()))
+	}
+}
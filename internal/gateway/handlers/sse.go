@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+)
+
+// defaultCoalesceDelay bounds how long buffered text waits when coalescing is
+// configured by size only
+const defaultCoalesceDelay = 100 * time.Millisecond
+
+// sseWriter writes chunks to a streaming response, as SSE events, NDJSON lines
+// or Responses API events.
+// When coalescing is enabled, consecutive content-only deltas are merged and
+// flushed once they reach maxChars or have waited maxDelay, reducing the number
+// of events clients render.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	format  streamFormat
+
+	responses *responsesStream // chunk translation for formatResponses
+	model     string           // reported in every chunk instead of the served model, if set
+
+	maxChars int
+	maxDelay time.Duration
+
+	mu      sync.Mutex
+	pending *providers.StreamChunk
+	timer   *time.Timer
+	done    bool // Done has been called; later writes are dropped
+}
+
+// newSSEWriter creates a stream writer; maxChars and maxDelay of 0 disable coalescing
+func newSSEWriter(w http.ResponseWriter, flusher http.Flusher, format streamFormat, maxChars int, maxDelay time.Duration) *sseWriter {
+	if maxChars > 0 && maxDelay <= 0 {
+		maxDelay = defaultCoalesceDelay
+	}
+	s := &sseWriter{
+		w:        w,
+		flusher:  flusher,
+		format:   format,
+		maxChars: maxChars,
+		maxDelay: maxDelay,
+	}
+	if format == formatResponses {
+		s.responses = &responsesStream{}
+	}
+	return s
+}
+
+// coalescing reports whether chunks are being merged
+func (s *sseWriter) coalescing() bool {
+	return s.maxChars > 0 || s.maxDelay > 0
+}
+
+// Write sends a chunk, buffering it if it's a content-only delta and coalescing is on
+func (s *sseWriter) Write(chunk providers.StreamChunk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+	if s.model != "" {
+		chunk.Model = s.model
+	}
+	if !s.coalescing() || !isContentOnly(chunk) {
+		s.flushPendingLocked()
+		s.writeLocked(chunk)
+		return
+	}
+	// Deltas for different choices of an n > 1 stream are never merged
+	if s.pending != nil && s.pending.Choices[0].Index != chunk.Choices[0].Index {
+		s.flushPendingLocked()
+	}
+
+	if s.pending == nil {
+		pending := chunk
+		pending.Choices = append(pending.Choices[:0:0], chunk.Choices...)
+		s.pending = &pending
+		if s.maxDelay > 0 {
+			s.timer = time.AfterFunc(s.maxDelay, s.flushPending)
+		}
+	} else {
+		s.pending.Choices[0].Delta.Content += chunk.Choices[0].Delta.Content
+	}
+
+	if s.maxChars > 0 && len(s.pending.Choices[0].Delta.Content) >= s.maxChars {
+		s.flushPendingLocked()
+	}
+}
+
+// WriteError sends an error event
+func (s *sseWriter) WriteError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+	s.flushPendingLocked()
+	s.writeLocked(map[string]string{"error": err.Error()})
+}
+
+// Done flushes anything buffered and sends the [DONE] terminator, once. NDJSON
+// and Responses API streams simply end.
+func (s *sseWriter) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return
+	}
+	s.done = true
+	s.flushPendingLocked()
+	if s.format == formatSSE {
+		fmt.Fprintf(s.w, "data: [DONE]\n\n")
+	}
+	s.flusher.Flush()
+}
+
+// Close flushes anything buffered and stops the coalescing timer
+func (s *sseWriter) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushPendingLocked()
+}
+
+// flushPending is the coalescing timer callback
+func (s *sseWriter) flushPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flushPendingLocked()
+}
+
+// flushPendingLocked writes the buffered chunk; callers must hold mu
+func (s *sseWriter) flushPendingLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.pending == nil {
+		return
+	}
+
+	s.writeLocked(*s.pending)
+	s.pending = nil
+}
+
+// writeLocked writes a single event in the stream's format and flushes it; callers must hold mu
+func (s *sseWriter) writeLocked(event interface{}) {
+	if s.responses != nil {
+		s.responses.write(s.w, event)
+		s.flusher.Flush()
+		return
+	}
+
+	data, _ := json.Marshal(event)
+	if s.format == formatNDJSON {
+		fmt.Fprintf(s.w, "%s\n", data)
+	} else {
+		fmt.Fprintf(s.w, "data: %s\n\n", data)
+	}
+	s.flusher.Flush()
+}
+
+// isContentOnly reports whether a chunk carries nothing but a text delta
+func isContentOnly(chunk providers.StreamChunk) bool {
+	if len(chunk.Choices) != 1 || chunk.Usage != nil || chunk.Reasoning != "" {
+		return false
+	}
+	choice := chunk.Choices[0]
+	return choice.Delta.Content != "" &&
+		choice.Delta.Role == "" &&
+		choice.FinishReason == "" &&
+		choice.Delta.FunctionCall == nil &&
+		len(choice.Delta.ToolCalls) == 0
+}
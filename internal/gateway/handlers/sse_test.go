@@ -0,0 +1,674 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// openAITokenStream streams tokens as fast as possible, one per chunk
+func openAITokenStream(tokens []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n")
+		for _, token := range tokens {
+			fmt.Fprintf(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":%q}}]}`+"\n\n", token)
+		}
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":60,"total_tokens":70}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}
+}
+
+func TestStreamCoalescingReducesEvents(t *testing.T) {
+	var tokens []string
+	for i := 0; i < 60; i++ {
+		tokens = append(tokens, fmt.Sprintf("w%02d ", i))
+	}
+	want := strings.Join(tokens, "")
+
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAITokenStream(tokens)})
+	db, mock := mockDB(t)
+	// Each stream checks the model streams, looks up its context window and prices it
+	for i := 0; i < 6; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	body := `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Count."}]}`
+
+	stream := func(key *models.APIKey, chars string) []string {
+		req := chatRequest(body, key)
+		if chars != "" {
+			req.Header.Set("X-Stream-Coalesce-Chars", chars)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleChatCompletion(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		return sseEvents(t, rec.Body.String())
+	}
+
+	plain := stream(&models.APIKey{ID: "key-1"}, "")
+	if content, chunks := streamedContent(t, plain); content != want || chunks != len(tokens) {
+		t.Fatalf("uncoalesced stream sent %q in %d chunks, want every token", content, chunks)
+	}
+
+	for name, events := range map[string][]string{
+		"header": stream(&models.APIKey{ID: "key-1"}, "40"),
+		"key":    stream(&models.APIKey{ID: "key-1", StreamCoalesceChars: 40}, ""),
+	} {
+		content, chunks := streamedContent(t, events)
+		if content != want {
+			t.Errorf("%s: coalesced content %q differs from the stream", name, content)
+		}
+		// 60 4-char tokens at 40 chars per event
+		if chunks > 7 || len(events) >= len(plain)/4 {
+			t.Errorf("%s: coalescing sent %d content chunks in %d events, without it %d events", name, chunks, len(events), len(plain))
+		}
+		if events[len(events)-1] != "[DONE]" {
+			t.Errorf("%s: expected the stream to end with [DONE]", name)
+		}
+	}
+}
+
+func TestCoalescingNeverMergesRoleOrFinishChunks(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := newSSEWriter(rec, rec, formatSSE, 1000, 0)
+	out.Write(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Role: "assistant"}, ""))
+	out.Write(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: "Hello"}, ""))
+	out.Write(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: ", world"}, ""))
+	out.Write(deltaChunk(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop))
+	out.Done()
+
+	events := sseEvents(t, rec.Body.String())
+	if len(events) != 4 {
+		t.Fatalf("expected role, merged content, finish and [DONE], got %q", events)
+	}
+	if content, chunks := streamedContent(t, events); content != "Hello, world" || chunks != 1 {
+		t.Errorf("got %q in %d chunks", content, chunks)
+	}
+	if !strings.Contains(events[2], `"finish_reason":"stop"`) {
+		t.Errorf("finish chunk was not sent on its own: %s", events[2])
+	}
+}
+
+func TestStalledStreamEndsWithThePartialResponse(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Once upon"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":" a time"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		// Stall well past the caller's deadline
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	// The stream checks the model streams, looks up its context window and
+	// prices the partial output
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+
+	req := chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Tell me a story."}]}`, &models.APIKey{ID: "key-1"})
+	// Load the tokenizer first, so the deadline only has the stream to cover
+	tokenizer.ForModel("openai", "gpt-4o").CountText("warm up")
+	ctx, cancel := context.WithTimeout(req.Context(), 500*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.HandleChatCompletion(rec, req.WithContext(ctx))
+	logs.Close()
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("the stall wasn't cut off at the deadline: %s", elapsed)
+	}
+	events := sseEvents(t, rec.Body.String())
+	if content, _ := streamedContent(t, events); content != "Once upon a time" {
+		t.Errorf("expected the partial content kept, got %q", content)
+	}
+	if len(events) < 3 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("expected the stream closed with [DONE], got %v", events)
+	}
+	var finish, usage providers.StreamChunk
+	if err := json.Unmarshal([]byte(events[len(events)-3]), &finish); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(events[len(events)-2]), &usage); err != nil {
+		t.Fatal(err)
+	}
+	if len(finish.Choices) != 1 || finish.Choices[0].FinishReason != openai.FinishReasonLength {
+		t.Errorf("expected a length finish chunk, got %s", events[len(events)-3])
+	}
+	if usage.Usage == nil || usage.Usage.CompletionTokens == 0 || usage.Usage.PromptTokens == 0 {
+		t.Errorf("expected the partial usage, got %s", events[len(events)-2])
+	}
+	for _, event := range events {
+		if strings.Contains(event, `"error"`) {
+			t.Errorf("unexpected error event %s", event)
+		}
+	}
+
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	if logged[0]["completion_tokens"] != int64(usage.Usage.CompletionTokens) || logged[0]["error_message"] == nil {
+		t.Errorf("expected the partial usage logged with the timeout, got %v", logged[0])
+	}
+}
+
+// geminiStreamWithoutUsage is a recorded streamGenerateContent transcript whose
+// chunks carry no usageMetadata
+const geminiStreamWithoutUsage = `data: {"candidates":[{"content":{"parts":[{"text":"The capital of France"}],"role":"model"},"index":0}]}
+
+data: {"candidates":[{"content":{"parts":[{"text":" is Paris, which is also its largest city."}],"role":"model"},"index":0}]}
+
+data: {"candidates":[{"content":{"parts":[{"text":""}],"role":"model"},"finishReason":"STOP","index":0}]}
+
+`
+
+func TestStreamWithoutUsageIsEstimated(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: "You are a concise geography tutor."},
+		{Role: "user", Content: "What is the capital of France?"},
+	}
+	tok := tokenizer.ForModel("google", "gemini-2.5-flash")
+	wantPrompt := tok.CountMessages(messages)
+	wantCompletion := tok.CountText("The capital of France is Paris, which is also its largest city.")
+
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"google": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, geminiStreamWithoutUsage)
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+
+	body, _ := json.Marshal(map[string]interface{}{"model": "gemini-2.5-flash", "stream": true, "messages": messages})
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(string(body), &models.APIKey{ID: "key-1"}))
+	logs.Close()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	events := sseEvents(t, rec.Body.String())
+	var final providers.StreamChunk
+	if err := json.Unmarshal([]byte(events[len(events)-2]), &final); err != nil || final.Usage == nil {
+		t.Fatalf("expected a usage chunk before [DONE], got %s", events[len(events)-2])
+	}
+	if final.Usage.PromptTokens != wantPrompt || final.Usage.CompletionTokens != wantCompletion || final.Usage.TotalTokens != wantPrompt+wantCompletion {
+		t.Errorf("estimated usage %+v, want %d prompt and %d completion tokens", final.Usage, wantPrompt, wantCompletion)
+	}
+	wantCost := float64(wantPrompt)/1000*0.0003 + float64(wantCompletion)/1000*0.0025
+	if !final.UsageEstimated || final.CostUSD == nil || fmt.Sprintf("%.8f", *final.CostUSD) != fmt.Sprintf("%.8f", wantCost) {
+		t.Errorf("expected an estimated, priced usage chunk, got estimated %t, cost %v", final.UsageEstimated, final.CostUSD)
+	}
+	if got := rec.Result().Trailer.Get("X-Usage-Estimated"); got != "true" {
+		t.Errorf("X-Usage-Estimated trailer = %q", got)
+	}
+
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	if logged[0]["prompt_tokens"] != int64(wantPrompt) || logged[0]["completion_tokens"] != int64(wantCompletion) {
+		t.Errorf("logged %v prompt and %v completion tokens, want %d and %d", logged[0]["prompt_tokens"], logged[0]["completion_tokens"], wantPrompt, wantCompletion)
+	}
+}
+
+func TestReportedStreamUsageIsNotEstimated(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAITokenStream([]string{"Hello", " there"})})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, &models.APIKey{ID: "key-1"}))
+
+	events := sseEvents(t, rec.Body.String())
+	var final providers.StreamChunk
+	if err := json.Unmarshal([]byte(events[len(events)-2]), &final); err != nil || final.Usage == nil {
+		t.Fatalf("expected a usage chunk before [DONE], got %s", events[len(events)-2])
+	}
+	if final.UsageEstimated || final.Usage.PromptTokens != 10 || final.Usage.CompletionTokens != 60 {
+		t.Errorf("expected the provider's usage, got %+v (estimated %t)", final.Usage, final.UsageEstimated)
+	}
+	if got := rec.Result().Trailer.Get("X-Usage-Estimated"); got != "" {
+		t.Errorf("X-Usage-Estimated trailer = %q", got)
+	}
+}
+
+func TestStreamTrailersCarryTheFinalCostAndTokens(t *testing.T) {
+	cfg := &config.Config{CacheTTLSeconds: 60, CacheTTLMaxSeconds: 3600}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAITokenStream([]string{"Paris", " is", " the", " capital."})})
+	db, mock := mockDB(t)
+	// The fresh stream checks the model streams, looks up its window and cache
+	// TTL and prices it; the replay only looks up the window
+	for i := 0; i < 5; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db), cache: cache.New(cache.NewMemoryBackend(0))}
+	key := &models.APIKey{ID: "key-1", CacheEnabled: true}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleChatCompletion(w, r.WithContext(context.WithValue(r.Context(), "api_key", key)))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name string
+		cost string
+	}{
+		{"fresh", "0.000625"}, // 10 prompt and 60 completion tokens
+		{"cached", "0.000000"},
+	} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Capital of France?"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The client lists the declared trailers before their values arrive
+		for _, name := range []string{"X-Cost-USD", "X-Total-Tokens"} {
+			if _, declared := resp.Trailer[http.CanonicalHeaderKey(name)]; !declared {
+				t.Errorf("%s: %s not declared up front: %v", tc.name, name, resp.Trailer)
+			}
+		}
+		if resp.Header.Get("X-Cost-USD") != "" {
+			t.Errorf("%s: cost sent before the stream finished", tc.name)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// Trailers are only readable once the body is consumed
+		if got := resp.Trailer.Get("X-Cost-USD"); got != tc.cost {
+			t.Errorf("%s: X-Cost-USD trailer %q, want %s", tc.name, got, tc.cost)
+		}
+		if got := resp.Trailer.Get("X-Total-Tokens"); got != "70" {
+			t.Errorf("%s: X-Total-Tokens trailer %q, want 70", tc.name, got)
+		}
+
+		// Clients that can't read trailers get the same totals in the last chunk
+		events := sseEvents(t, string(body))
+		var final providers.StreamChunk
+		if err := json.Unmarshal([]byte(events[len(events)-2]), &final); err != nil || final.Usage == nil || final.CostUSD == nil {
+			t.Fatalf("%s: expected a usage chunk before [DONE], got %s", tc.name, events[len(events)-2])
+		}
+		if fmt.Sprintf("%.6f", *final.CostUSD) != tc.cost || final.Usage.TotalTokens != 70 {
+			t.Errorf("%s: usage chunk has cost %.6f and %d tokens", tc.name, *final.CostUSD, final.Usage.TotalTokens)
+		}
+	}
+}
+
+func TestForceNonStreamReturnsBufferedJSON(t *testing.T) {
+	cfg := &config.Config{}
+	var upstreamStreamed atomic.Bool
+	tokens := []string{"The capital", " of France", " is Paris."}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstreamStreamed.Store(strings.Contains(string(body), `"stream":true`))
+		openAITokenStream(tokens)(w, r)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	key := &models.APIKey{ID: "key-1", Features: map[string]interface{}{models.FeatureForceNonStream: true}}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Capital of France?"}]}`, key))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if !upstreamStreamed.Load() {
+		t.Error("expected the provider call to stream")
+	}
+	if ct := rec.Header().Get("Content-Type"); strings.HasPrefix(ct, "text/event-stream") || rec.Header().Get("X-Stream-Buffered") != "true" {
+		t.Errorf("expected a buffered JSON response, got %s (X-Stream-Buffered %q)", ct, rec.Header().Get("X-Stream-Buffered"))
+	}
+
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("expected one JSON completion: %v", err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "The capital of France is Paris." || resp.Choices[0].FinishReason != openai.FinishReasonStop {
+		t.Errorf("unexpected choices: %+v", resp.Choices)
+	}
+	if resp.Usage.PromptTokens != 10 || resp.Usage.CompletionTokens != 60 || resp.Usage.TotalTokens != 70 || resp.UsageEstimated {
+		t.Errorf("expected the stream's full usage, got %+v (estimated %t)", resp.Usage, resp.UsageEstimated)
+	}
+	if fmt.Sprintf("%.6f", resp.CostUSD) != "0.000625" || rec.Header().Get("X-Cost-USD") != "0.000625" {
+		t.Errorf("expected the cost of the usage, got %v (%s)", resp.CostUSD, rec.Header().Get("X-Cost-USD"))
+	}
+}
+
+func TestForceNonStreamLeavesOtherKeysStreaming(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": openAITokenStream([]string{"Paris."})})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Capital of France?"}]}`, &models.APIKey{ID: "key-2"}))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") || rec.Header().Get("X-Stream-Buffered") != "" {
+		t.Errorf("expected an SSE stream without the policy, got %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestForceNonStreamEstimatesMissingUsage(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"google": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, geminiStreamWithoutUsage)
+	}})
+	db, mock := mockDB(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		expectPricing(mock, "google", "gemini-2.5-flash", 0.0003, 0.0025)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+	key := &models.APIKey{ID: "key-1", Features: map[string]interface{}{models.FeatureForceNonStream: true}}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gemini-2.5-flash","stream":true,"messages":[{"role":"user","content":"What is the capital of France?"}]}`, key))
+	var resp providers.ChatResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("expected one JSON completion: %v (%s)", err, rec.Body)
+	}
+	if !resp.UsageEstimated || resp.Usage.PromptTokens == 0 || resp.Usage.CompletionTokens == 0 || rec.Header().Get("X-Usage-Estimated") != "true" {
+		t.Errorf("expected estimated usage, got %+v (estimated %t)", resp.Usage, resp.UsageEstimated)
+	}
+}
+
+// noisyOpenAIStream repeats the role chunk and mixes in empty deltas and
+// keep-alive chunks around the content
+const noisyOpenAIStream = `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Par"}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":""}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"is."}}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}
+
+data: [DONE]
+
+`
+
+// noisyGeminiStream has empty text parts and a stray [DONE] before trailing junk
+const noisyGeminiStream = `data: {"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"index":0}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Par"}]},"index":0}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"index":0}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"is."}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2,"totalTokenCount":12}}
+
+data: [DONE]
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":" late"}]},"index":0}]}
+
+`
+
+func TestNoisyStreamsReachTheClientClean(t *testing.T) {
+	for _, tc := range []struct {
+		provider, model, transcript string
+	}{
+		{"openai", "gpt-4o", noisyOpenAIStream},
+		{"google", "gemini-2.5-flash", noisyGeminiStream},
+	} {
+		t.Run(tc.provider, func(t *testing.T) {
+			cfg := &config.Config{}
+			mgr := testManager(t, cfg, map[string]http.HandlerFunc{tc.provider: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, tc.transcript)
+			}})
+			db, mock := mockDB(t)
+			for i := 0; i < 3; i++ {
+				expectPricing(mock, tc.provider, tc.model, 0.0025, 0.01)
+			}
+			h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+			rec := httptest.NewRecorder()
+			h.HandleChatCompletion(rec, chatRequest(`{"model":"`+tc.model+`","stream":true,"messages":[{"role":"user","content":"Capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+			}
+
+			events := sseEvents(t, rec.Body.String())
+			if strings.Count(rec.Body.String(), "[DONE]") != 1 || events[len(events)-1] != "[DONE]" {
+				t.Fatalf("expected exactly one trailing [DONE], got %v", events)
+			}
+			roles, finishes := 0, 0
+			for _, data := range events[:len(events)-1] {
+				var chunk providers.StreamChunk
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("bad chunk %q: %v", data, err)
+				}
+				if chunk.Usage == nil && isEmptyChunk(chunk) {
+					t.Errorf("blank chunk forwarded: %s", data)
+				}
+				for _, choice := range chunk.Choices {
+					if choice.Delta.Role != "" {
+						roles++
+					}
+					if choice.FinishReason != "" {
+						finishes++
+					}
+					if choice.Delta.Role == "" && choice.Delta.Content == "" && choice.FinishReason == "" {
+						t.Errorf("empty delta forwarded: %s", data)
+					}
+				}
+			}
+			if roles > 1 || finishes != 1 {
+				t.Errorf("expected at most one role chunk and one finish, got %d and %d", roles, finishes)
+			}
+			if content, _ := streamedContent(t, events); content != "Paris." {
+				t.Errorf("content %q, want %q", content, "Paris.")
+			}
+		})
+	}
+}
+
+func TestEchoRequestedModelInStreamedChunks(t *testing.T) {
+	// Streams don't fail over, but the upstream may still report another
+	// model, such as the dated snapshot behind an alias
+	cfg := &config.Config{EchoRequestedModel: true}
+	upstream := openAITokenStream([]string{"Par", "is."})
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		upstream(rec, r)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.ReplaceAll(rec.Body.String(), `"model":"gpt-4o"`, `"model":"gpt-4o-2024-08-06"`))
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	events := sseEvents(t, rec.Body.String())
+	for _, data := range events[:len(events)-1] {
+		var chunk providers.StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		if chunk.Model != "gpt-4o" {
+			t.Errorf("chunk reports model %q: %s", chunk.Model, data)
+		}
+	}
+	if content, _ := streamedContent(t, events); content != "Paris." {
+		t.Errorf("content %q", content)
+	}
+}
+
+// cancellingRecorder cancels the request once the client has received the given text
+type cancellingRecorder struct {
+	*httptest.ResponseRecorder
+	after  string
+	cancel context.CancelFunc
+}
+
+func (r *cancellingRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseRecorder.Write(b)
+	if strings.Contains(string(b), r.after) {
+		r.cancel()
+	}
+	return n, err
+}
+
+func TestClientCancelLogsPartialUsage(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"The capital of France is"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		// The rest never comes: the client hangs up first
+		<-r.Context().Done()
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+
+	req := chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"})
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	rec := &cancellingRecorder{ResponseRecorder: httptest.NewRecorder(), after: "The capital of France is", cancel: cancel}
+	h.HandleChatCompletion(rec, req.WithContext(ctx))
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	row := logged[0]
+	if row["error_type"] != "client_cancelled" || row["status_code"] != int64(statusClientClosedRequest) {
+		t.Errorf("expected a client_cancelled 499, got %v / %v", row["error_type"], row["status_code"])
+	}
+	prompt, _ := row["prompt_tokens"].(int64)
+	completion, _ := row["completion_tokens"].(int64)
+	if prompt == 0 || completion == 0 {
+		t.Errorf("expected non-zero partial usage, got %d prompt and %d completion tokens", prompt, completion)
+	}
+	if cost, _ := row["cost_usd"].(float64); cost <= 0 {
+		t.Errorf("expected the partial usage billed, got cost %v", row["cost_usd"])
+	}
+}
+
+func TestBrokenStreamLogsPartialUsage(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"c","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"The capital of France is"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler) // drop the connection mid-stream
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 3; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"What is the capital of France?"}]}`, &models.APIKey{ID: "key-1"}))
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	row := logged[0]
+	if row["error_message"] == nil || row["error_type"] == "client_cancelled" {
+		t.Errorf("expected an upstream stream error, got %v / %v", row["error_type"], row["error_message"])
+	}
+	if completion, _ := row["completion_tokens"].(int64); completion == 0 {
+		t.Errorf("expected the partial completion logged, got %v", row["completion_tokens"])
+	}
+	if cost, _ := row["cost_usd"].(float64); cost <= 0 {
+		t.Errorf("expected the partial usage billed, got cost %v", row["cost_usd"])
+	}
+}
+
+func TestFailedStreamOpenIsLogged(t *testing.T) {
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+	}})
+	db, mock, logs, rows := mockLoggingDB(t)
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 2; i++ {
+		expectPricing(mock, "openai", "gpt-4o", 0.0025, 0.01)
+	}
+	expectLogFlush(mock)
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: logs}
+
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, &models.APIKey{ID: "key-1"}))
+	logs.Close()
+
+	logged := rows.logged()
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 logged row, got %d", len(logged))
+	}
+	row := logged[0]
+	if row["status_code"] != int64(http.StatusTooManyRequests) || row["error_message"] == nil {
+		t.Errorf("expected the 429 logged with its error, got %v / %v", row["status_code"], row["error_message"])
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+)
+
+// defaultStatsWindow is the lookback used when no start time is given
+const defaultStatsWindow = 24 * time.Hour
+
+// StatsHandler handles historical stats requests
+type StatsHandler struct {
+	db    *database.DB
+	redis *redis.Client
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(db *database.DB, redis *redis.Client) *StatsHandler {
+	return &StatsHandler{db: db, redis: redis}
+}
+
+// latencyStatsResponse is a single row of GET /v1/stats/latency and /admin/stats/latency
+type latencyStatsResponse struct {
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	RequestCount int     `json:"request_count"`
+	AvgMs        float64 `json:"avg_ms"`
+	P50Ms        float64 `json:"p50_ms"`
+	P90Ms        float64 `json:"p90_ms"`
+	P99Ms        float64 `json:"p99_ms"`
+}
+
+// HandleKeyLatencyStats handles GET /v1/stats/latency?provider=&model=&metadata=&start=&end=,
+// over the calling key's requests only.
+// start and end are RFC 3339 timestamps; the default window is the last 24 hours.
+// metadata=key:value (repeatable) counts only requests tagged with every pair.
+func (h *StatsHandler) HandleKeyLatencyStats(w http.ResponseWriter, r *http.Request) {
+	apiKey, ok := r.Context().Value("api_key").(*models.APIKey)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.writeLatencyStats(w, r, apiKey.ID)
+}
+
+// HandleLatencyStats handles GET /admin/stats/latency, which takes the same
+// parameters as /v1/stats/latency but covers every key's requests
+func (h *StatsHandler) HandleLatencyStats(w http.ResponseWriter, r *http.Request) {
+	h.writeLatencyStats(w, r, "")
+}
+
+// writeLatencyStats writes latency percentiles for apiKeyID's requests, or
+// every key's when it's empty
+func (h *StatsHandler) writeLatencyStats(w http.ResponseWriter, r *http.Request, apiKeyID string) {
+	query := r.URL.Query()
+
+	start, end, err := statsWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metadata, err := metadataFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.db.GetLatencyStats(r.Context(), apiKeyID, query.Get("provider"), query.Get("model"), metadata, start, end)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]latencyStatsResponse, 0, len(stats))
+	for _, s := range stats {
+		rows = append(rows, latencyStatsResponse{
+			Provider:     s.Provider,
+			Model:        s.Model,
+			RequestCount: s.RequestCount,
+			AvgMs:        s.AvgMs,
+			P50Ms:        s.P50Ms,
+			P90Ms:        s.P90Ms,
+			P99Ms:        s.P99Ms,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start": start,
+		"end":   end,
+		"stats": rows,
+	})
+}
+
+// errorStatsResponse is a single row of GET /admin/stats/errors
+type errorStatsResponse struct {
+	Provider  string `json:"provider"`
+	Model     string `json:"model"`
+	ErrorType string `json:"error_type"`
+	Count     int    `json:"count"`
+}
+
+// HandleErrorStats handles GET /admin/stats/errors?provider=&model=&metadata=&start=&end=,
+// counting every key's failed requests by error type (rate_limit, timeout, auth, ...)
+func (h *StatsHandler) HandleErrorStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	start, end, err := statsWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metadata, err := metadataFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.db.GetErrorStats(r.Context(), query.Get("provider"), query.Get("model"), metadata, start, end)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]errorStatsResponse, 0, len(stats))
+	totals := make(map[string]int)
+	for _, s := range stats {
+		rows = append(rows, errorStatsResponse{
+			Provider:  s.Provider,
+			Model:     s.Model,
+			ErrorType: s.ErrorType,
+			Count:     s.Count,
+		})
+		totals[s.ErrorType] += s.Count
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"start":  start,
+		"end":    end,
+		"totals": totals,
+		"stats":  rows,
+	})
+}
+
+// maxTotalsDays is how far back GET /admin/stats/totals can look
+const maxTotalsDays = 90
+
+// totalsResponse is a single day of GET /admin/stats/totals
+type totalsResponse struct {
+	Date string `json:"date"`
+	models.LogTotals
+}
+
+// HandleTotals handles GET /admin/stats/totals?days=, returning request totals per
+// UTC day (newest first) across every key, so it's admin-only. Totals are only
+// kept while log sampling is enabled.
+func (h *StatsHandler) HandleTotals(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTotalsDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxTotalsDays), http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	now := time.Now().UTC()
+	rows := make([]totalsResponse, 0, days)
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		totals, err := h.redis.GetLogTotals(r.Context(), day)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("redis error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		rows = append(rows, totalsResponse{Date: day.Format("2006-01-02"), LogTotals: totals})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days": rows,
+	})
+}
+
+// statsWindow parses the start and end query parameters (RFC 3339). end
+// defaults to now and start to defaultStatsWindow before end.
+func statsWindow(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+
+	end := time.Now()
+	if value := query.Get("end"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("end must be an RFC 3339 timestamp")
+		}
+		end = parsed
+	}
+
+	start := end.Add(-defaultStatsWindow)
+	if value := query.Get("start"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("start must be an RFC 3339 timestamp")
+		}
+		start = parsed
+	}
+	return start, end, nil
+}
+
+// metadataFilter parses repeated metadata=key:value query parameters
+func metadataFilter(r *http.Request) (map[string]string, error) {
+	var filter map[string]string
+	for _, pair := range r.URL.Query()["metadata"] {
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("metadata filter %q must be key:value", pair)
+		}
+		if filter == nil {
+			filter = make(map[string]string)
+		}
+		filter[key] = value
+	}
+	return filter, nil
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestStatsFilterByMetadataTags(t *testing.T) {
+	db, mock := mockDB(t)
+	h := NewStatsHandler(db, nil)
+	mock.ExpectQuery(regexp.QuoteMeta(`metadata @> $5::jsonb`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "openai", "", `{"env":"prod","team":"search"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "error_type", "count"}).AddRow("openai", "gpt-4o", "timeout", 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`metadata @> $5::jsonb`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "", "", `{"url":"https://example.com/a:b"}`, "").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "count", "avg", "p50", "p90", "p99"}))
+
+	rec := httptest.NewRecorder()
+	h.HandleErrorStats(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/errors?provider=openai&metadata=team:search&metadata=env:prod", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Only the first colon separates the key from the value
+	rec = httptest.NewRecorder()
+	h.HandleLatencyStats(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/latency?metadata=url:https://example.com/a:b", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, filter := range []string{"team", ":search"} {
+		rec = httptest.NewRecorder()
+		h.HandleErrorStats(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/errors?metadata="+filter, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("metadata=%s: expected 400, got %d", filter, rec.Code)
+		}
+	}
+}
+
+func TestKeyLatencyStatsCoverOnlyTheCallingKey(t *testing.T) {
+	db, mock := mockDB(t)
+	h := NewStatsHandler(db, nil)
+	mock.ExpectQuery(regexp.QuoteMeta(`api_key_id::text = $6`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "openai", "", nil, "key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "count", "avg", "p50", "p90", "p99"}).
+			AddRow("openai", "gpt-4o", 3, 120.0, 100.0, 180.0, 198.0))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/stats/latency?provider=openai", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "api_key", &models.APIKey{ID: "key-1"}))
+	rec := httptest.NewRecorder()
+	h.HandleKeyLatencyStats(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Stats []latencyStatsResponse `json:"stats"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Stats) != 1 || body.Stats[0].RequestCount != 3 || body.Stats[0].P99Ms != 198 {
+		t.Errorf("unexpected stats: %+v", body.Stats)
+	}
+
+	// Without a key there's nothing to scope to
+	rec = httptest.NewRecorder()
+	h.HandleKeyLatencyStats(rec, httptest.NewRequest(http.MethodGet, "/v1/stats/latency", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// errClientCancelled marks a stream the client disconnected from mid-way
+var errClientCancelled = errors.New("client cancelled the request")
+
+// errRaceLost marks the race candidate cancelled because the other answered first
+var errRaceLost = errors.New("cancelled: another race candidate answered first")
+
+// statusClientClosedRequest is logged for client_cancelled streams and race
+// losers (nginx's 499)
+const statusClientClosedRequest = 499
+
+// resumePrompt asks the model to pick up a response that was cut off mid-stream
+// or by the token limit
+const resumePrompt = "Your previous response was interrupted. Continue exactly where it stopped, without repeating any text."
+
+// streamAccumulator collects a streamed response so it can be cached, logged,
+// and resumed after a mid-stream failure
+type streamAccumulator struct {
+	id           string
+	content      strings.Builder
+	reasoning    strings.Builder
+	finishReason openai.FinishReason
+	usage        openai.Usage
+	toolCalls    []openai.ToolCall // assembled from tool call deltas, by index
+	fingerprint  string            // system_fingerprint, kept so cached replays report it
+	estimated    bool              // usage was counted locally rather than reported
+	servedModel  string            // model a resume switched to, if any; the stream is priced at it
+	roleSent     bool              // the opening role chunk has been forwarded
+
+	// Choices 1..n-1 of an n > 1 stream; the fields above hold choice 0
+	choices []*streamAccumulator
+}
+
+// choice returns the accumulator for a choice index, growing the list as
+// new choices appear
+func (a *streamAccumulator) choice(index int) *streamAccumulator {
+	if index <= 0 {
+		return a
+	}
+	for len(a.choices) < index {
+		a.choices = append(a.choices, &streamAccumulator{})
+	}
+	return a.choices[index-1]
+}
+
+// addToolCallDeltas merges streamed tool call fragments into complete calls
+func (a *streamAccumulator) addToolCallDeltas(deltas []openai.ToolCall) {
+	for _, delta := range deltas {
+		index := len(a.toolCalls)
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		for len(a.toolCalls) <= index {
+			a.toolCalls = append(a.toolCalls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+
+		call := &a.toolCalls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+// addUsage adds the usage reported by one upstream stream
+func (a *streamAccumulator) addUsage(usage *openai.Usage) {
+	if usage == nil {
+		return
+	}
+	a.usage.PromptTokens += usage.PromptTokens
+	a.usage.CompletionTokens += usage.CompletionTokens
+	a.usage.TotalTokens += usage.TotalTokens
+}
+
+// response builds a complete chat response from the accumulated stream
+func (a *streamAccumulator) response(model string) *providers.ChatResponse {
+	resp := &providers.ChatResponse{
+		ID:      a.id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index: 0,
+				Message: openai.ChatCompletionMessage{
+					Role:      "assistant",
+					Content:   a.content.String(),
+					ToolCalls: a.toolCalls,
+				},
+				FinishReason: a.finishReason,
+			},
+		},
+		Usage:             a.usage,
+		SystemFingerprint: a.fingerprint,
+		Reasoning:         a.reasoning.String(),
+		UsageEstimated:    a.estimated,
+		ServedModel:       a.servedModel,
+	}
+	for i, c := range a.choices {
+		resp.Choices = append(resp.Choices, openai.ChatCompletionChoice{
+			Index: i + 1,
+			Message: openai.ChatCompletionMessage{
+				Role:      "assistant",
+				Content:   c.content.String(),
+				ToolCalls: c.toolCalls,
+			},
+			FinishReason: c.finishReason,
+		})
+	}
+	return resp
+}
+
+// estimateUsage counts whichever of the prompt and completion tokens the
+// provider didn't report, using the model's tokenizer. Each choice of an
+// n > 1 stream was a separate upstream call, so the prompt counts once per choice.
+func (a *streamAccumulator) estimateUsage(providerName, model string, messages []openai.ChatCompletionMessage) {
+	if a.servedModel != "" {
+		model = a.servedModel
+	}
+	tok := tokenizer.ForModel(providerName, model)
+	if a.usage.PromptTokens == 0 {
+		a.usage.PromptTokens = tok.CountMessages(messages) * (1 + len(a.choices))
+		a.estimated = true
+	}
+	output := a.reasoning.String() + a.content.String()
+	for _, c := range a.choices {
+		output += c.content.String()
+	}
+	if a.usage.CompletionTokens == 0 && output != "" {
+		a.usage.CompletionTokens = tok.CountText(output)
+		a.estimated = true
+	}
+	if a.estimated {
+		a.usage.TotalTokens = a.usage.PromptTokens + a.usage.CompletionTokens
+	}
+}
+
+// usageTrailers are declared on every stream and set once it completes, since
+// cost and token counts aren't known when the headers are sent
+const usageTrailers = "X-Cost-USD, X-Total-Tokens, X-Usage-Estimated"
+
+// setUsageTrailers sets a completed stream's trailer values
+func setUsageTrailers(w http.ResponseWriter, resp *providers.ChatResponse) {
+	w.Header().Set("X-Cost-USD", fmt.Sprintf("%.6f", resp.CostUSD))
+	w.Header().Set("X-Total-Tokens", fmt.Sprintf("%d", resp.Usage.TotalTokens))
+	if resp.UsageEstimated {
+		w.Header().Set("X-Usage-Estimated", "true")
+	}
+}
+
+// usageChunk builds the final chunk sent before [DONE], carrying the
+// response's usage and cost the same way for live and replayed streams
+func usageChunk(resp *providers.ChatResponse) providers.StreamChunk {
+	usage := resp.Usage
+	cost := resp.CostUSD
+	return providers.StreamChunk{
+		ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+			Usage:   &usage,
+		},
+		CostUSD:        &cost,
+		UsageEstimated: resp.UsageEstimated,
+	}
+}
+
+// chunkWriter receives the chunks pumpStream forwards, e.g. an *sseWriter
+type chunkWriter interface {
+	Write(chunk providers.StreamChunk)
+}
+
+// discardChunks drops forwarded chunks, for streams that are only accumulated
+type discardChunks struct{}
+
+func (discardChunks) Write(providers.StreamChunk) {}
+
+// bufferStreams reports whether the key answers stream:true requests with a
+// single buffered response
+func bufferStreams(apiKey *models.APIKey) bool {
+	return apiKey.GetBool(models.FeatureForceNonStream, false)
+}
+
+// bufferStream streams a completion from the providers and assembles it into
+// a single response, so clients that can't read SSE still get streaming's
+// time to first token upstream
+func (h *ChatHandler) bufferStream(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, string, error) {
+	stream, providerName, err := h.providerMgr.ChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, providerName, err
+	}
+	defer stream.Close()
+
+	acc := &streamAccumulator{}
+	if err := pumpStream(discardChunks{}, stream, acc, false); err != nil {
+		return nil, providerName, err
+	}
+	acc.estimateUsage(providerName, req.Model, req.Messages)
+
+	resp := acc.response(req.Model)
+	if reporter, ok := stream.(providers.RateLimitReporter); ok {
+		resp.RateLimit = reporter.RateLimit()
+	}
+	return resp, providerName, nil
+}
+
+// pumpStream forwards chunks from an upstream stream to the client until EOF
+// (returns nil) or an error. When resuming, the continuation's opening role
+// chunk is dropped and chunk IDs are rewritten so the client sees a single
+// uninterrupted stream.
+func pumpStream(out chunkWriter, stream providers.StreamReader, acc *streamAccumulator, resumed bool) error {
+	var usage *openai.Usage
+	defer func() { acc.addUsage(usage) }()
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if acc.id == "" {
+			acc.id = chunk.ID
+		}
+		if chunk.SystemFingerprint != "" {
+			acc.fingerprint = chunk.SystemFingerprint
+		}
+		if resumed {
+			chunk.ID = acc.id
+		}
+
+		acc.reasoning.WriteString(chunk.Reasoning)
+		if len(chunk.Choices) > 0 {
+			choice := chunk.Choices[0]
+			target := acc.choice(choice.Index)
+			if isRoleOnly(chunk) && (resumed || target.roleSent) {
+				continue
+			}
+			// Only the first delta of a choice carries the role, as OpenAI sends it;
+			// providers that repeat it on every chunk would otherwise leak it through
+			if choice.Delta.Role != "" {
+				if resumed || target.roleSent {
+					chunk.Choices[0].Delta.Role = ""
+				} else {
+					target.roleSent = true
+				}
+			}
+			target.content.WriteString(choice.Delta.Content)
+			target.addToolCallDeltas(choice.Delta.ToolCalls)
+			if choice.FinishReason != "" {
+				target.finishReason = choice.FinishReason
+			}
+		}
+
+		// Track usage; providers report it in a final usage chunk, and if one
+		// repeats it, the last (cumulative) value wins rather than being summed
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			chunk.Usage = nil
+		}
+		if isEmptyChunk(chunk) {
+			continue
+		}
+
+		// Send chunk
+		out.Write(chunk)
+	}
+}
+
+// isRoleOnly reports whether a chunk only announces the assistant role. Only
+// the first is forwarded; providers that repeat it would otherwise show up
+// as blank chunks.
+func isRoleOnly(chunk providers.StreamChunk) bool {
+	if len(chunk.Choices) != 1 || chunk.Reasoning != "" {
+		return false
+	}
+	choice := chunk.Choices[0]
+	return choice.Delta.Role != "" &&
+		choice.Delta.Content == "" &&
+		choice.FinishReason == "" &&
+		choice.Delta.FunctionCall == nil &&
+		len(choice.Delta.ToolCalls) == 0
+}
+
+// isEmptyChunk reports whether a chunk carries nothing for the client: no
+// reasoning and no choice with a delta or finish reason
+func isEmptyChunk(chunk providers.StreamChunk) bool {
+	if chunk.Reasoning != "" {
+		return false
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		if delta.Role != "" || delta.Content != "" || delta.Refusal != "" || delta.FunctionCall != nil || len(delta.ToolCalls) > 0 || choice.FinishReason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// resumeStream restarts a stream that failed mid-way, asking the model to
+// continue from the partial output. Successive attempts alternate between the
+// original model and its failover chain. Returns the stream, its provider and
+// the model it runs on.
+func (h *ChatHandler) resumeStream(ctx context.Context, req providers.ChatRequest, partial string, attempt int) (providers.StreamReader, string, string, error) {
+	candidates := append([]string{req.Model}, h.providerMgr.GetFailoverChain(req.Model)...)
+	model := candidates[attempt%len(candidates)]
+
+	resumeReq := req
+	resumeReq.Model = model
+	resumeReq.Messages = append(append([]openai.ChatCompletionMessage{}, req.Messages...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: partial},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: resumePrompt},
+	)
+
+	stream, providerName, err := h.providerMgr.ChatCompletionStream(ctx, resumeReq)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return stream, providerName, model, nil
+}
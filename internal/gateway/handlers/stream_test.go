@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// sliceStream replays chunks, then returns err (io.EOF if nil)
+type sliceStream struct {
+	chunks []providers.StreamChunk
+	err    error
+	closed bool
+}
+
+func (s *sliceStream) Recv() (providers.StreamChunk, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return providers.StreamChunk{}, s.err
+		}
+		return providers.StreamChunk{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *sliceStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+// collectChunks records forwarded chunks
+type collectChunks struct {
+	chunks []providers.StreamChunk
+}
+
+func (c *collectChunks) Write(chunk providers.StreamChunk) {
+	c.chunks = append(c.chunks, chunk)
+}
+
+// deltaChunk builds a single-choice chunk
+func deltaChunk(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) providers.StreamChunk {
+	return providers.StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+		ID:      "chatcmpl-1",
+		Object:  "chat.completion.chunk",
+		Choices: []openai.ChatCompletionStreamChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}}
+}
+
+func toolDelta(index int, id, name, arguments string) openai.ChatCompletionStreamChoiceDelta {
+	call := openai.ToolCall{Index: &index, ID: id, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+	if id != "" {
+		call.Type = openai.ToolTypeFunction
+	}
+	return openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{call}}
+}
+
+func TestPumpStreamForwardsAndAssemblesToolCalls(t *testing.T) {
+	stream := &sliceStream{chunks: []providers.StreamChunk{
+		deltaChunk(openai.ChatCompletionStreamChoiceDelta{Role: "assistant"}, ""),
+		deltaChunk(toolDelta(0, "call_1", "get_weather", ""), ""),
+		deltaChunk(toolDelta(1, "call_2", "get_time", ""), ""),
+		deltaChunk(toolDelta(0, "", "", `{"city":`), ""),
+		deltaChunk(toolDelta(1, "", "", `{"tz":"CET"}`), ""),
+		deltaChunk(toolDelta(0, "", "", `"Paris"}`), ""),
+		deltaChunk(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonToolCalls),
+	}}
+	out := &collectChunks{}
+	acc := &streamAccumulator{}
+
+	if err := pumpStream(out, stream, acc, false); err != nil {
+		t.Fatal(err)
+	}
+
+	forwarded := 0
+	for _, chunk := range out.chunks {
+		forwarded += len(chunk.Choices[0].Delta.ToolCalls)
+	}
+	if forwarded != 5 {
+		t.Errorf("expected all 5 tool call deltas forwarded, got %d", forwarded)
+	}
+
+	resp := acc.response("gpt-4o")
+	want := []openai.ToolCall{
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+		{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_time", Arguments: `{"tz":"CET"}`}},
+	}
+	got := resp.Choices[0].Message.ToolCalls
+	if len(got) != len(want) {
+		t.Fatalf("assembled %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tool call %d: assembled %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if resp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("expected finish_reason tool_calls, got %q", resp.Choices[0].FinishReason)
+	}
+}
+
+func TestPumpStreamKeepsTheLastCumulativeUsage(t *testing.T) {
+	withUsage := func(chunk providers.StreamChunk, prompt, completion int) providers.StreamChunk {
+		chunk.Usage = &openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+		return chunk
+	}
+	stream := &sliceStream{chunks: []providers.StreamChunk{
+		withUsage(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: "The capital"}, ""), 9, 2),
+		withUsage(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: " of France"}, ""), 9, 4),
+		withUsage(deltaChunk(openai.ChatCompletionStreamChoiceDelta{Content: " is Paris."}, openai.FinishReasonStop), 9, 7),
+	}}
+	out := &collectChunks{}
+	acc := &streamAccumulator{}
+
+	if err := pumpStream(out, stream, acc, false); err != nil {
+		t.Fatal(err)
+	}
+	want := openai.Usage{PromptTokens: 9, CompletionTokens: 7, TotalTokens: 16}
+	if got := acc.response("gemini-2.5-flash").Usage; got != want {
+		t.Errorf("usage %+v, want %+v", got, want)
+	}
+	for i, chunk := range out.chunks {
+		if chunk.Usage != nil {
+			t.Errorf("chunk %d forwarded usage %+v mid-stream", i, chunk.Usage)
+		}
+	}
+}
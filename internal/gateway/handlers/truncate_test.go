@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tokenizer"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// expectContextWindow expects one gpt-4o pricing lookup reporting the given window
+func expectContextWindow(mock sqlmock.Sqlmock, window int) {
+	now := time.Now()
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", "gpt-4o").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", "openai", "gpt-4o", 0.0025, 0.01, window, true, nil, 0.0, now, now))
+}
+
+// toolHistory is a system prompt, then turns that each call a tool, then a final question
+func toolHistory(turns int) []openai.ChatCompletionMessage {
+	filler := strings.Repeat("lorem ipsum ", 40)
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You are a travel assistant."}}
+	for i := 0; i < turns; i++ {
+		id := fmt.Sprintf("call_%d", i)
+		messages = append(messages,
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("Question %d: %s", i, filler)},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "search", Arguments: `{"q":"paris"}`}}}},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: id, Content: filler},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: fmt.Sprintf("Answer %d.", i)},
+		)
+	}
+	return append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "And the best time to visit?"})
+}
+
+func TestContextTruncationFitsTheWindow(t *testing.T) {
+	const window, maxTokens = 500, 100
+	var sent []openai.ChatCompletionMessage
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = body.Messages
+		openAIReply("gpt-4o", "Spring.", "stop", 300, 2)(w, r)
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 3; i++ {
+		expectContextWindow(mock, window)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	history := toolHistory(6)
+	tok := tokenizer.ForModel("openai", "gpt-4o")
+	if tok.CountMessages(history) <= window {
+		t.Fatalf("the history should overflow the window, it's %d tokens", tok.CountMessages(history))
+	}
+	body, _ := json.Marshal(map[string]interface{}{"model": "gpt-4o", "max_tokens": maxTokens, "messages": history})
+	req := chatRequest(string(body), &models.APIKey{ID: "key-1"})
+	req.Header.Set("X-Context-Truncate", "true")
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec.Header().Get("X-Context-Truncated") != "true" {
+		t.Errorf("expected X-Context-Truncated, got headers %v", rec.Header())
+	}
+	if got := tok.CountMessages(sent); got > window-maxTokens {
+		t.Errorf("forwarded %d prompt tokens, over the %d left for the prompt", got, window-maxTokens)
+	}
+	if dropped := fmt.Sprintf("%d", len(history)-len(sent)); rec.Header().Get("X-Context-Dropped-Messages") != dropped {
+		t.Errorf("X-Context-Dropped-Messages %q, want %s", rec.Header().Get("X-Context-Dropped-Messages"), dropped)
+	}
+	if sent[0].Role != openai.ChatMessageRoleSystem || sent[len(sent)-1].Content != "And the best time to visit?" {
+		t.Errorf("expected the system prompt and latest question kept, got %+v", sent)
+	}
+
+	// Every tool reply still follows the call it answers, and every call keeps its reply
+	calls := map[string]bool{}
+	replies := map[string]bool{}
+	for _, msg := range sent {
+		for _, call := range msg.ToolCalls {
+			calls[call.ID] = true
+		}
+		if msg.Role == openai.ChatMessageRoleTool {
+			if !calls[msg.ToolCallID] {
+				t.Errorf("tool reply %s forwarded without its call", msg.ToolCallID)
+			}
+			replies[msg.ToolCallID] = true
+		}
+	}
+	for id := range calls {
+		if !replies[id] {
+			t.Errorf("tool call %s forwarded without its reply", id)
+		}
+	}
+	if len(calls) == 0 {
+		t.Error("expected some of the recent tool turns to fit")
+	}
+}
+
+func TestContextTruncationIsOptIn(t *testing.T) {
+	var sent int
+	cfg := &config.Config{}
+	mgr := testManager(t, cfg, map[string]http.HandlerFunc{"openai": func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sent = len(body.Messages)
+		openAIReply("gpt-4o", "Spring.", "stop", 300, 2)(w, r)
+	}})
+	db, mock := mockDB(t)
+	for i := 0; i < 2; i++ {
+		expectContextWindow(mock, 500)
+	}
+	h := &ChatHandler{cfg: cfg, providerMgr: mgr, db: db, logs: idleLogs(db)}
+
+	history := toolHistory(6)
+	body, _ := json.Marshal(map[string]interface{}{"model": "gpt-4o", "messages": history})
+	rec := httptest.NewRecorder()
+	h.HandleChatCompletion(rec, chatRequest(string(body), &models.APIKey{ID: "key-1"}))
+	if rec.Header().Get("X-Context-Truncated") != "" || sent != len(history) {
+		t.Errorf("expected the history forwarded whole, sent %d of %d messages", sent, len(history))
+	}
+}
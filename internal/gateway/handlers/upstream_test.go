@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+)
+
+// testManager builds a provider manager whose providers call the given fake
+// upstreams, keyed by provider name ("openai", "anthropic", ...)
+func testManager(t *testing.T, cfg *config.Config, upstreams map[string]http.HandlerFunc) *providers.Manager {
+	t.Helper()
+	cfg.ProviderRegions = make(map[string][]string)
+	for name, handler := range upstreams {
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+
+		baseURL := srv.URL
+		switch name {
+		case "openai":
+			cfg.OpenAIAPIKey = "sk-test"
+			baseURL += "/v1"
+		case "anthropic":
+			cfg.AnthropicAPIKey = "sk-ant-test"
+		case "google":
+			cfg.GeminiAPIKey = "gemini-test"
+		case "cohere":
+			cfg.CohereAPIKey = "cohere-test"
+		}
+		cfg.ProviderRegions[name] = []string{baseURL}
+	}
+	return providers.NewManager(cfg, nil)
+}
+
+// openAIReply answers every chat completion with one choice
+func openAIReply(model, content string, finishReason string, promptTokens, completionTokens int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "chatcmpl-1",
+			"object": "chat.completion",
+			"model":  model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": content},
+				"finish_reason": finishReason,
+			}},
+			"usage": map[string]int{"prompt_tokens": promptTokens, "completion_tokens": completionTokens, "total_tokens": promptTokens + completionTokens},
+		})
+	}
+}
+
+// anthropicReply answers every message request with one text block
+func anthropicReply(model, content, stopReason string, inputTokens, outputTokens int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":          "msg_1",
+			"type":        "message",
+			"role":        "assistant",
+			"model":       model,
+			"content":     []map[string]string{{"type": "text", "text": content}},
+			"stop_reason": stopReason,
+			"usage":       map[string]int{"input_tokens": inputTokens, "output_tokens": outputTokens},
+		})
+	}
+}
+
+// statusReply fails every request with status
+func statusReply(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"message":"upstream unavailable","type":"server_error"}}`))
+	}
+}
+
+// mockDB returns a database backed by sqlmock, checking expectations at cleanup
+func mockDB(t *testing.T) (*database.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return database.FromConn(conn), mock
+}
+
+var selectModelPricing = regexp.QuoteMeta("FROM model_pricing\n\t\tWHERE provider = $1 AND model = $2")
+
+// expectPricing expects one model_pricing lookup, answered with the given prices
+func expectPricing(mock sqlmock.Sqlmock, provider, model string, inputPer1k, outputPer1k float64) {
+	now := time.Now()
+	mock.ExpectQuery(selectModelPricing).WithArgs(provider, model).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", provider, model, inputPer1k, outputPer1k, 128000, true, nil, 0.0, now, now))
+}
+
+// expectAudioPricing expects one model_pricing lookup for an OpenAI audio model
+func expectAudioPricing(mock sqlmock.Sqlmock, model string, inputPer1k, outputPer1k, perMinute float64) {
+	now := time.Now()
+	mock.ExpectQuery(selectModelPricing).WithArgs("openai", model).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+			AddRow("p-1", "openai", model, inputPer1k, outputPer1k, 0, false, nil, perMinute, now, now))
+}
+
+// idleLogs returns a log writer that buffers entries without writing them
+// during the test
+func idleLogs(db *database.DB) *database.LogWriter {
+	return database.NewLogWriter(db, database.LogWriterConfig{Workers: 1, FlushInterval: time.Hour})
+}
+
+// loggedRows captures the gateway_logs rows written through a mock database,
+// by column. It sees each query's arguments as database/sql converts them,
+// then the query itself as sqlmock matches it.
+type loggedRows struct {
+	mu      sync.Mutex
+	pending []driver.Value
+	rows    []map[string]driver.Value
+}
+
+func (l *loggedRows) ConvertValue(v interface{}) (driver.Value, error) {
+	value, err := driver.DefaultParameterConverter.ConvertValue(v)
+	l.mu.Lock()
+	l.pending = append(l.pending, value)
+	l.mu.Unlock()
+	return value, err
+}
+
+func (l *loggedRows) Match(expectedSQL, actualSQL string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	args := l.pending
+	l.pending = nil
+
+	if err := sqlmock.QueryMatcherRegexp.Match(expectedSQL, actualSQL); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.TrimSpace(actualSQL), "INSERT INTO gateway_logs (") {
+		return nil
+	}
+	list := actualSQL[strings.Index(actualSQL, "(")+1 : strings.Index(actualSQL, ")")]
+	columns := strings.Split(list, ", ")
+	// sqlmock converts the previous expectation's WithArgs after matching
+	// it, so leftovers may precede the row values
+	args = args[len(args)%len(columns):]
+	for len(args) >= len(columns) {
+		row := make(map[string]driver.Value, len(columns))
+		for i, column := range columns {
+			row[column] = args[i]
+		}
+		l.rows = append(l.rows, row)
+		args = args[len(columns):]
+	}
+	return nil
+}
+
+// logged returns the rows written so far
+func (l *loggedRows) logged() []map[string]driver.Value {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rows
+}
+
+// mockLoggingDB is mockDB with a log writer that writes every row, captured
+// in the returned loggedRows once the writer is closed. Expect the writes
+// with expectLogFlush after the queries that precede them.
+func mockLoggingDB(t *testing.T) (*database.DB, sqlmock.Sqlmock, *database.LogWriter, *loggedRows) {
+	t.Helper()
+	rows := &loggedRows{}
+	conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(rows), sqlmock.ValueConverterOption(rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	db := database.FromConn(conn)
+	logs := database.NewLogWriter(db, database.LogWriterConfig{Workers: 1, FlushInterval: time.Hour, SampleRate: 1, CacheHitSampleRate: 1})
+	return db, mock, logs, rows
+}
+
+// expectLogFlush expects what a log writer writes on Close: one batch of
+// gateway_logs rows, then the keys' last_used_at
+func expectLogFlush(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO gateway_logs")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys AS k SET last_used_at")).WillReturnResult(sqlmock.NewResult(0, 1))
+}
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+)
+
+// Provider statuses
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	StatusUnknown   = "unknown"
+)
+
+// probeTimeout bounds a single health probe
+const probeTimeout = 15 * time.Second
+
+// ProviderStatus is the last known health of a provider
+type ProviderStatus struct {
+	Provider    string     `json:"provider"`
+	Status      string     `json:"status"`
+	LatencyMs   int        `json:"latency_ms,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+}
+
+// Checker periodically probes each configured provider by listing its models,
+// which costs nothing, rather than running a completion
+type Checker struct {
+	providers map[string]providers.Provider
+	interval  time.Duration
+
+	mu       sync.RWMutex
+	statuses map[string]ProviderStatus
+}
+
+// New creates a new health checker for the given providers
+func New(providerSet map[string]providers.Provider, interval time.Duration) *Checker {
+	c := &Checker{
+		providers: providerSet,
+		interval:  interval,
+		statuses:  make(map[string]ProviderStatus, len(providerSet)),
+	}
+
+	for name := range providerSet {
+		c.statuses[name] = ProviderStatus{
+			Provider: name,
+			Status:   StatusUnknown,
+		}
+	}
+
+	return c
+}
+
+// Start runs a check immediately and then every interval until ctx is done.
+// A zero interval disables background checks.
+func (c *Checker) Start(ctx context.Context) {
+	if c.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.CheckAll(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.CheckAll(ctx)
+			}
+		}
+	}()
+}
+
+// CheckAll probes every provider concurrently and records the results
+func (c *Checker) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, provider := range c.providers {
+		wg.Add(1)
+		go func(name string, provider providers.Provider) {
+			defer wg.Done()
+
+			status := c.check(ctx, name, provider)
+			if status.Status == StatusUnhealthy {
+				log.Printf("Health check failed for %s: %s", name, status.Error)
+			}
+
+			c.mu.Lock()
+			c.statuses[name] = status
+			c.mu.Unlock()
+		}(name, provider)
+	}
+	wg.Wait()
+}
+
+// check issues a single probe request, the models-list call Warm makes
+func (c *Checker) check(ctx context.Context, name string, provider providers.Provider) ProviderStatus {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := provider.Warm(ctx)
+	checkedAt := time.Now()
+
+	status := ProviderStatus{
+		Provider:    name,
+		Status:      StatusHealthy,
+		LatencyMs:   int(checkedAt.Sub(start).Milliseconds()),
+		LastChecked: &checkedAt,
+	}
+	if err != nil {
+		status.Status = StatusUnhealthy
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// Status returns the last known health of a provider
+func (c *Checker) Status(provider string) (ProviderStatus, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status, ok := c.statuses[provider]
+	return status, ok
+}
+
+// Healthy reports whether a provider passed its last check; unchecked providers count as healthy
+func (c *Checker) Healthy(provider string) bool {
+	status, ok := c.Status(provider)
+	return !ok || status.Status != StatusUnhealthy
+}
+
+// Statuses returns the last known health of every provider, sorted by name
+func (c *Checker) Statuses() []ProviderStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make([]ProviderStatus, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Provider < statuses[j].Provider
+	})
+
+	return statuses
+}
@@ -0,0 +1,88 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+)
+
+// probeProvider fails Warm with warmErr and counts paid calls
+type probeProvider struct {
+	name      string
+	warmErr   error
+	warms     atomic.Int32
+	completes atomic.Int32
+}
+
+func (p *probeProvider) ChatCompletion(ctx context.Context, req providers.ChatRequest) (*providers.ChatResponse, error) {
+	p.completes.Add(1)
+	return &providers.ChatResponse{}, nil
+}
+
+func (p *probeProvider) ChatCompletionStream(ctx context.Context, req providers.ChatRequest) (providers.StreamReader, error) {
+	p.completes.Add(1)
+	return nil, errors.New("not implemented")
+}
+
+func (p *probeProvider) Transcribe(ctx context.Context, req providers.TranscriptionRequest) (*providers.TranscriptionResponse, error) {
+	p.completes.Add(1)
+	return nil, errors.New("not implemented")
+}
+
+func (p *probeProvider) ValidateModel(model string) bool      { return true }
+func (p *probeProvider) GetProviderName() string              { return p.name }
+func (p *probeProvider) Capabilities() providers.Capabilities { return providers.Capabilities{} }
+func (p *probeProvider) Warm(ctx context.Context) error       { p.warms.Add(1); return p.warmErr }
+
+func TestCheckAllRecordsHealthyAndUnhealthyProviders(t *testing.T) {
+	up := &probeProvider{name: "openai"}
+	down := &probeProvider{name: "anthropic", warmErr: errors.New("Anthropic API error (status 503)")}
+	c := New(map[string]providers.Provider{"openai": up, "anthropic": down}, 0)
+
+	for _, name := range []string{"openai", "anthropic"} {
+		if status, _ := c.Status(name); status.Status != StatusUnknown || status.LastChecked != nil {
+			t.Errorf("%s before any check: %+v", name, status)
+		}
+		if !c.Healthy(name) {
+			t.Errorf("%s: unchecked providers should count as healthy", name)
+		}
+	}
+
+	c.CheckAll(context.Background())
+
+	if status, _ := c.Status("openai"); status.Status != StatusHealthy || status.LastChecked == nil || status.Error != "" {
+		t.Errorf("openai: %+v", status)
+	}
+	if status, _ := c.Status("anthropic"); status.Status != StatusUnhealthy || status.Error != "Anthropic API error (status 503)" || status.LastChecked == nil {
+		t.Errorf("anthropic: %+v", status)
+	}
+	if !c.Healthy("openai") || c.Healthy("anthropic") {
+		t.Error("Healthy doesn't reflect the last check")
+	}
+	if !c.Healthy("cohere") {
+		t.Error("unknown providers should count as healthy")
+	}
+
+	statuses := c.Statuses()
+	if len(statuses) != 2 || statuses[0].Provider != "anthropic" || statuses[1].Provider != "openai" {
+		t.Errorf("statuses not sorted by provider: %+v", statuses)
+	}
+}
+
+func TestChecksDontRunCompletions(t *testing.T) {
+	p := &probeProvider{name: "openai"}
+	c := New(map[string]providers.Provider{"openai": p}, 0)
+
+	c.CheckAll(context.Background())
+	c.CheckAll(context.Background())
+
+	if p.warms.Load() != 2 {
+		t.Errorf("expected 2 models-list probes, got %d", p.warms.Load())
+	}
+	if p.completes.Load() != 0 {
+		t.Errorf("health checks made %d paid calls", p.completes.Load())
+	}
+}
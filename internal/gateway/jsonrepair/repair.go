@@ -0,0 +1,125 @@
+package jsonrepair
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrUnrecoverable is returned when no valid JSON can be recovered from the text
+var ErrUnrecoverable = errors.New("no recoverable JSON in completion")
+
+// Repair extracts a JSON value from model output: it strips markdown code
+// fences and surrounding prose, drops trailing commas and closes unterminated
+// strings, objects and arrays. Returns the JSON and whether anything was changed.
+func Repair(text string) (string, bool, error) {
+	if json.Valid([]byte(strings.TrimSpace(text))) {
+		return text, false, nil
+	}
+
+	candidate := stripFences(text)
+	start := strings.IndexAny(candidate, "{[")
+	if start < 0 {
+		return text, false, ErrUnrecoverable
+	}
+
+	repaired := balance(candidate[start:])
+	if !json.Valid([]byte(repaired)) {
+		return text, false, ErrUnrecoverable
+	}
+	return repaired, true, nil
+}
+
+// stripFences returns the body of the first ``` code block, or text if there is none
+func stripFences(text string) string {
+	open := strings.Index(text, "```")
+	if open < 0 {
+		return text
+	}
+	body := text[open+3:]
+
+	// Skip the language tag, e.g. ```json
+	if newline := strings.IndexByte(body, '\n'); newline >= 0 && !strings.ContainsAny(body[:newline], "{[") {
+		body = body[newline+1:]
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
+
+// balance copies the first JSON value in text, stopping where it closes (so
+// trailing prose is dropped), removing trailing commas and closing whatever
+// is still open at the end of the input
+func balance(text string) string {
+	var out strings.Builder
+	var stack []byte
+	inString, escaped := false, false
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				continue // stray closer
+			}
+			stack = stack[:len(stack)-1]
+			trimTrailingComma(&out)
+			out.WriteByte(c)
+			if len(stack) == 0 {
+				return out.String()
+			}
+			continue
+		}
+		out.WriteByte(c)
+	}
+
+	// Truncated output: close the open string, then containers innermost first
+	if inString {
+		if escaped {
+			// Drop a dangling backslash so the closing quote isn't escaped
+			trimmed := out.String()
+			out.Reset()
+			out.WriteString(trimmed[:len(trimmed)-1])
+		}
+		out.WriteByte('"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		trimTrailingComma(&out)
+		if strings.HasSuffix(strings.TrimRight(out.String(), " \t\r\n"), ":") {
+			out.WriteString("null")
+		}
+		out.WriteByte(stack[i])
+	}
+	return out.String()
+}
+
+// trimTrailingComma removes a comma (and whitespace after it) at the end of out
+func trimTrailingComma(out *strings.Builder) {
+	s := strings.TrimRight(out.String(), " \t\r\n")
+	if !strings.HasSuffix(s, ",") {
+		return
+	}
+	out.Reset()
+	out.WriteString(s[:len(s)-1])
+}
@@ -0,0 +1,56 @@
+package jsonrepair
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRepairRecoversMalformedJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name, text, want string
+	}{
+		{"code fence", "```json\n{\"city\": \"Paris\"}\n```", `{"city": "Paris"}`},
+		{"bare fence", "```\n[1, 2]\n```", `[1, 2]`},
+		{"surrounding prose", `Sure! Here it is: {"city": "Paris"} Let me know if you need more.`, `{"city": "Paris"}`},
+		{"trailing commas", `{"tags": ["a", "b",], "n": 1,}`, `{"tags": ["a", "b"], "n": 1}`},
+		{"truncated object", `{"city": "Paris", "population": 2100000`, `{"city": "Paris", "population": 2100000}`},
+		{"truncated string", `{"summary": "The capital of Fra`, `{"summary": "The capital of Fra"}`},
+		{"dangling escape", `{"path": "C:\`, `{"path": "C:"}`},
+		{"dangling key", `{"city": "Paris", "country":`, `{"city": "Paris", "country":null}`},
+		{"truncated nesting", `{"cities": [{"name": "Paris"}, {"name": "Lyon"`, `{"cities": [{"name": "Paris"}, {"name": "Lyon"}]}`},
+		{"braces inside strings", "```json\n{\"note\": \"use } and ] freely\"}\n```", `{"note": "use } and ] freely"}`},
+	} {
+		got, changed, err := Repair(tc.text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !changed || got != tc.want {
+			t.Errorf("%s: got %q (changed %t), want %q", tc.name, got, changed, tc.want)
+		}
+	}
+}
+
+func TestRepairLeavesValidJSONAlone(t *testing.T) {
+	text := `{"city": "Paris"}`
+	if got, changed, err := Repair(text); err != nil || changed || got != text {
+		t.Errorf("got %q, %t, %v", got, changed, err)
+	}
+}
+
+func TestRepairRejectsUnrecoverableOutput(t *testing.T) {
+	for _, text := range []string{
+		"I'm sorry, I can't help with that.",
+		"",
+		`{"city": Paris}`,
+		"```json\n{'city': 'Paris'}\n```",
+	} {
+		got, changed, err := Repair(text)
+		if !errors.Is(err, ErrUnrecoverable) {
+			t.Errorf("%q: expected ErrUnrecoverable, got %v", text, err)
+		}
+		if changed || got != text {
+			t.Errorf("%q: expected the text back unchanged, got %q", text, got)
+		}
+	}
+}
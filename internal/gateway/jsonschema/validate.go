@@ -0,0 +1,357 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidJSON is returned when the document being validated isn't JSON
+var ErrInvalidJSON = errors.New("output is not valid JSON")
+
+// maxViolations caps how many violations Validate reports
+const maxViolations = 20
+
+// Validate checks a JSON document against a JSON Schema and returns the
+// violations found, each prefixed with the path of the offending value (e.g.
+// "$.items[2].name"). It supports the subset of the spec used for structured
+// outputs: type, enum, const, properties, required, additionalProperties,
+// items, min/maxItems, min/maxLength, pattern, minimum/maximum (and the
+// exclusive forms), anyOf, oneOf, allOf and local $refs into $defs or
+// definitions. Unknown keywords are ignored.
+func Validate(schema json.RawMessage, document []byte) ([]string, error) {
+	var root interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimSpace(document)))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return nil, ErrInvalidJSON
+	}
+
+	v := &validator{root: root}
+	v.validate(root, value, "$", 0)
+	return v.violations, nil
+}
+
+// maxDepth bounds $ref recursion
+const maxDepth = 64
+
+type validator struct {
+	root       interface{}
+	violations []string
+}
+
+// fail records a violation at path
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if len(v.violations) < maxViolations {
+		v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+// validate checks value against schema, recording violations under path
+func (v *validator) validate(schema interface{}, value interface{}, path string, depth int) {
+	if depth > maxDepth {
+		v.fail(path, "schema nesting too deep")
+		return
+	}
+
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, value, path, depth)
+	}
+}
+
+func (v *validator) validateObjectSchema(s map[string]interface{}, value interface{}, path string, depth int) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.validate(target, value, path, depth+1)
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, value) {
+		v.fail(path, "expected %s, got %s", describeType(t), typeOf(value))
+		return
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && !containsValue(enum, value) {
+		v.fail(path, "value is not one of the allowed values")
+	}
+	if c, ok := s["const"]; ok && !equal(c, value) {
+		v.fail(path, "value does not equal the required constant")
+	}
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, val, path, depth)
+	case []interface{}:
+		v.validateArray(s, val, path, depth)
+	case string:
+		v.validateString(s, val, path)
+	case json.Number:
+		v.validateNumber(s, val, path)
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, path, depth+1)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok && v.countMatches(anyOf, value, depth) == 0 {
+		v.fail(path, "value matches none of the anyOf schemas")
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		if n := v.countMatches(oneOf, value, depth); n != 1 {
+			v.fail(path, "value matches %d of the oneOf schemas, expected exactly 1", n)
+		}
+	}
+}
+
+// countMatches returns how many of the schemas value satisfies
+func (v *validator) countMatches(schemas []interface{}, value interface{}, depth int) int {
+	matches := 0
+	for _, sub := range schemas {
+		probe := &validator{root: v.root}
+		probe.validate(sub, value, "$", depth+1)
+		if len(probe.violations) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+func (v *validator) validateObject(s map[string]interface{}, obj map[string]interface{}, path string, depth int) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := obj[key]; !present {
+					v.fail(path, "missing required property %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if sub, ok := properties[key]; ok {
+			v.validate(sub, obj[key], childPath, depth+1)
+			continue
+		}
+		switch additional := s["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "unexpected property %q", key)
+			}
+		case map[string]interface{}:
+			v.validate(additional, obj[key], childPath, depth+1)
+		}
+	}
+}
+
+func (v *validator) validateArray(s map[string]interface{}, arr []interface{}, path string, depth int) {
+	if min, ok := number(s["minItems"]); ok && float64(len(arr)) < min {
+		v.fail(path, "expected at least %v items, got %d", min, len(arr))
+	}
+	if max, ok := number(s["maxItems"]); ok && float64(len(arr)) > max {
+		v.fail(path, "expected at most %v items, got %d", max, len(arr))
+	}
+	if items, ok := s["items"]; ok {
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s[%d]", path, i), depth+1)
+		}
+	}
+}
+
+func (v *validator) validateString(s map[string]interface{}, str string, path string) {
+	length := float64(len([]rune(str)))
+	if min, ok := number(s["minLength"]); ok && length < min {
+		v.fail(path, "expected at least %v characters, got %v", min, length)
+	}
+	if max, ok := number(s["maxLength"]); ok && length > max {
+		v.fail(path, "expected at most %v characters, got %v", max, length)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "schema pattern %q is not a valid regular expression", pattern)
+		} else if !re.MatchString(str) {
+			v.fail(path, "value does not match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]interface{}, num json.Number, path string) {
+	n, err := num.Float64()
+	if err != nil {
+		return
+	}
+	if min, ok := number(s["minimum"]); ok && n < min {
+		v.fail(path, "expected a value >= %v, got %v", min, n)
+	}
+	if max, ok := number(s["maximum"]); ok && n > max {
+		v.fail(path, "expected a value <= %v, got %v", max, n)
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && n <= min {
+		v.fail(path, "expected a value > %v, got %v", min, n)
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && n >= max {
+		v.fail(path, "expected a value < %v, got %v", max, n)
+	}
+}
+
+// resolve follows a local reference such as "#/$defs/item"
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q (only local references are supported)", ref)
+	}
+
+	node := v.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if node, ok = obj[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// matchesType reports whether value has the schema type t (a name or a list of names)
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && isType(s, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := num.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+// typeOf names a decoded value's JSON type
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func describeType(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			parts = append(parts, fmt.Sprint(name))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if equal(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// equal compares a schema value (numbers as float64) with a document value
+// (numbers as json.Number)
+func equal(schemaValue, value interface{}) bool {
+	if num, ok := value.(json.Number); ok {
+		f, err := num.Float64()
+		s, isNum := schemaValue.(float64)
+		return err == nil && isNum && f == s
+	}
+	a, _ := json.Marshal(schemaValue)
+	b, _ := json.Marshal(normalize(value))
+	return bytes.Equal(a, b)
+}
+
+// normalize converts json.Numbers to float64 so values marshal as the schema's do
+func normalize(value interface{}) interface{} {
+	switch val := value.(type) {
+	case json.Number:
+		f, _ := val.Float64()
+		return f
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for key, item := range val {
+			out[key] = normalize(item)
+		}
+		return out
+	}
+	return value
+}
+
+// number reads a numeric schema keyword
+func number(value interface{}) (float64, bool) {
+	f, ok := value.(float64)
+	return f, ok
+}
@@ -0,0 +1,80 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const citySchema = `{
+	"type": "object",
+	"properties": {
+		"city": {"type": "string", "minLength": 1},
+		"country": {"$ref": "#/$defs/code"},
+		"population": {"type": "integer", "minimum": 0},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+		"size": {"enum": ["small", "large"]}
+	},
+	"required": ["city", "country"],
+	"additionalProperties": false,
+	"$defs": {"code": {"type": "string", "pattern": "^[A-Z]{2}$"}}
+}`
+
+func TestValidateAcceptsConformingOutput(t *testing.T) {
+	for _, doc := range []string{
+		`{"city": "Paris", "country": "FR", "population": 2100000, "tags": ["capital"], "size": "large"}`,
+		` {"city": "Lyon", "country": "FR"}` + "\n",
+	} {
+		violations, err := Validate(json.RawMessage(citySchema), []byte(doc))
+		if err != nil || len(violations) != 0 {
+			t.Errorf("%s: got %v, %v", doc, violations, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryViolationWithItsPath(t *testing.T) {
+	doc := `{"city": "", "country": "France", "population": -5, "tags": ["a", 2, "c"], "size": "medium", "mayor": "Hidalgo"}`
+	violations, err := Validate(json.RawMessage(citySchema), []byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`$.city: expected at least 1 characters, got 0`,
+		`$.country: value does not match pattern "^[A-Z]{2}$"`,
+		`$: unexpected property "mayor"`,
+		`$.population: expected a value >= 0, got -5`,
+		`$.size: value is not one of the allowed values`,
+		`$.tags: expected at most 2 items, got 3`,
+		`$.tags[1]: expected string, got number`,
+	}
+	if strings.Join(violations, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(violations, "\n"), strings.Join(want, "\n"))
+	}
+
+	violations, _ = Validate(json.RawMessage(citySchema), []byte(`{"city": "Paris"}`))
+	if len(violations) != 1 || violations[0] != `$: missing required property "country"` {
+		t.Errorf("got %v", violations)
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	schema := json.RawMessage(`{"oneOf": [{"type": "string"}, {"type": "number", "maximum": 10}], "anyOf": [{"const": 3}, {"type": "string"}]}`)
+	for doc, want := range map[string]int{`"x"`: 0, `3`: 0, `4`: 1, `42`: 2, `null`: 2} {
+		violations, err := Validate(schema, []byte(doc))
+		if err != nil || len(violations) != want {
+			t.Errorf("%s: expected %d violations, got %v, %v", doc, want, violations, err)
+		}
+	}
+}
+
+func TestValidateRejectsNonJSONOutput(t *testing.T) {
+	for _, doc := range []string{"Sure! Here is the JSON:", `{"city": "Paris"`, `{"city": "Paris"} {"city": "Lyon"}`} {
+		if _, err := Validate(json.RawMessage(citySchema), []byte(doc)); !errors.Is(err, ErrInvalidJSON) {
+			t.Errorf("%q: expected ErrInvalidJSON, got %v", doc, err)
+		}
+	}
+	if _, err := Validate(json.RawMessage(`{"type":`), []byte(`{}`)); err == nil || errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("expected an invalid schema error, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package logexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// ErrRunning is returned when an export is started while another is in progress
+var ErrRunning = errors.New("a log export is already running")
+
+// Uploader stores exported objects, e.g. S3Uploader
+type Uploader interface {
+	Upload(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// LogStore is the log storage being exported from, e.g. *database.DB
+type LogStore interface {
+	ExportLogs(ctx context.Context, before time.Time, pageSize int, fn func(page []*models.GatewayLog) error) error
+	DeleteLogs(ctx context.Context, ids []string) (int64, error)
+}
+
+// Config controls what is exported and where
+type Config struct {
+	Prefix      string        // object key prefix, e.g. "gateway-logs"
+	PageSize    int           // rows per exported object
+	Retention   time.Duration // scheduled runs export rows older than this
+	Interval    time.Duration // time between scheduled runs (0 = admin-triggered only)
+	DeleteAfter bool          // delete rows from Postgres once their object is uploaded
+}
+
+// Result summarizes an export run
+type Result struct {
+	Before  time.Time `json:"before"`
+	Rows    int       `json:"rows"`
+	Objects int       `json:"objects"`
+	Deleted int64     `json:"deleted"`
+}
+
+// Exporter offloads old gateway logs to object storage as gzipped JSONL
+type Exporter struct {
+	store    LogStore
+	uploader Uploader
+	config   Config
+
+	running sync.Mutex
+}
+
+// New creates an exporter
+func New(store LogStore, uploader Uploader, config Config) *Exporter {
+	if config.PageSize <= 0 {
+		config.PageSize = 10000
+	}
+	return &Exporter{store: store, uploader: uploader, config: config}
+}
+
+// Start runs scheduled exports every Interval until ctx is cancelled
+func (e *Exporter) Start(ctx context.Context) {
+	if e.config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(e.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := e.Run(ctx, time.Now().Add(-e.config.Retention))
+				logResult(result, err)
+			}
+		}
+	}()
+}
+
+// Retention returns how old rows must be for scheduled exports
+func (e *Exporter) Retention() time.Duration {
+	return e.config.Retention
+}
+
+// RunInBackground starts an export of logs created before `before` and returns
+// without waiting for it, or ErrRunning if one is already in progress
+func (e *Exporter) RunInBackground(before time.Time) error {
+	if !e.running.TryLock() {
+		return ErrRunning
+	}
+
+	go func() {
+		defer e.running.Unlock()
+		logResult(e.run(context.Background(), before))
+	}()
+	return nil
+}
+
+// Run exports every log created before `before`, one object per page. With
+// DeleteAfter, a page's rows are deleted only after its upload succeeds, so a
+// failed run leaves the remaining rows in place to be exported next time.
+func (e *Exporter) Run(ctx context.Context, before time.Time) (Result, error) {
+	if !e.running.TryLock() {
+		return Result{}, ErrRunning
+	}
+	defer e.running.Unlock()
+
+	return e.run(ctx, before)
+}
+
+// run performs an export; callers hold e.running
+func (e *Exporter) run(ctx context.Context, before time.Time) (Result, error) {
+	result := Result{Before: before}
+	runID := time.Now().UTC().Format("20060102T150405Z")
+
+	err := e.store.ExportLogs(ctx, before, e.config.PageSize, func(page []*models.GatewayLog) error {
+		body, err := encodePage(page)
+		if err != nil {
+			return err
+		}
+
+		key := e.objectKey(before, runID, result.Objects)
+		if err := e.uploader.Upload(ctx, key, body, "application/gzip"); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", key, err)
+		}
+		result.Objects++
+		result.Rows += len(page)
+
+		if !e.config.DeleteAfter {
+			return nil
+		}
+		ids := make([]string, len(page))
+		for i, entry := range page {
+			ids[i] = entry.ID
+		}
+		deleted, err := e.store.DeleteLogs(ctx, ids)
+		result.Deleted += deleted
+		return err
+	})
+	return result, err
+}
+
+// logResult logs the outcome of an export run
+func logResult(result Result, err error) {
+	if err != nil {
+		log.Printf("Log export before %s failed after %d rows: %v", result.Before.Format(time.RFC3339), result.Rows, err)
+		return
+	}
+	log.Printf("Exported %d log rows before %s in %d objects (%d deleted)", result.Rows, result.Before.Format(time.RFC3339), result.Objects, result.Deleted)
+}
+
+// objectKey names a page's object: prefix/YYYY/MM/DD/<run>-<page>.jsonl.gz, dated by the cutoff
+func (e *Exporter) objectKey(before time.Time, runID string, page int) string {
+	return path.Join(e.config.Prefix, before.UTC().Format("2006/01/02"), fmt.Sprintf("%s-%05d.jsonl.gz", runID, page))
+}
+
+// encodePage writes a page of logs as gzipped JSON lines
+func encodePage(page []*models.GatewayLog) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, entry := range page {
+		if err := enc.Encode(database.LogRecord(entry)); err != nil {
+			return nil, fmt.Errorf("failed to encode log %s: %w", entry.ID, err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress logs: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,240 @@
+package logexport
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// fakeStore holds logs in memory, oldest first, paging and deleting like the database
+type fakeStore struct {
+	mu      sync.Mutex
+	logs    []*models.GatewayLog
+	deleted [][]string
+}
+
+func (s *fakeStore) ExportLogs(ctx context.Context, before time.Time, pageSize int, fn func(page []*models.GatewayLog) error) error {
+	var cursor time.Time
+	for {
+		s.mu.Lock()
+		var page []*models.GatewayLog
+		for _, entry := range s.logs {
+			if entry.CreatedAt.Before(before) && entry.CreatedAt.After(cursor) && len(page) < pageSize {
+				page = append(page, entry)
+			}
+		}
+		s.mu.Unlock()
+		if len(page) == 0 {
+			return nil
+		}
+		cursor = page[len(page)-1].CreatedAt
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+	}
+}
+
+func (s *fakeStore) DeleteLogs(ctx context.Context, ids []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, ids)
+	remove := make(map[string]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := s.logs[:0]
+	for _, entry := range s.logs {
+		if !remove[entry.ID] {
+			kept = append(kept, entry)
+		}
+	}
+	n := len(s.logs) - len(kept)
+	s.logs = kept
+	return int64(n), nil
+}
+
+// fakeUploader records uploads in place of S3, failing from the failAt'th on (1-based, 0 = never)
+type fakeUploader struct {
+	keys   []string
+	bodies [][]byte
+	failAt int
+}
+
+func (u *fakeUploader) Upload(ctx context.Context, key string, body []byte, contentType string) error {
+	if contentType != "application/gzip" {
+		return fmt.Errorf("unexpected content type %s", contentType)
+	}
+	if u.failAt > 0 && len(u.keys)+1 >= u.failAt {
+		return errors.New("s3: 503 SlowDown")
+	}
+	u.keys = append(u.keys, key)
+	u.bodies = append(u.bodies, body)
+	return nil
+}
+
+// oldLogs returns n logs created an hour apart, ending a day before now
+func oldLogs(n int, now time.Time) []*models.GatewayLog {
+	logs := make([]*models.GatewayLog, n)
+	for i := range logs {
+		logs[i] = &models.GatewayLog{
+			ID:        fmt.Sprintf("log-%d", i+1),
+			Model:     "gpt-4o",
+			Provider:  "openai",
+			CreatedAt: now.Add(-24*time.Hour - time.Duration(n-i)*time.Hour),
+		}
+	}
+	return logs
+}
+
+// decodeObject reads the IDs from an exported gzipped JSONL object
+func decodeObject(t *testing.T, body []byte) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("bad JSONL line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, record["id"].(string))
+	}
+	return ids
+}
+
+func TestExportWritesOneObjectPerPage(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{logs: oldLogs(5, now)}
+	uploader := &fakeUploader{}
+	before := now.Add(-24 * time.Hour)
+	e := New(store, uploader, Config{Prefix: "gateway-logs", PageSize: 2})
+
+	result, err := e.Run(context.Background(), before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows != 5 || result.Objects != 3 || result.Deleted != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(store.deleted) != 0 {
+		t.Errorf("rows deleted without DeleteAfter: %v", store.deleted)
+	}
+
+	var exported []string
+	for i, key := range uploader.keys {
+		if !strings.HasPrefix(key, "gateway-logs/"+before.UTC().Format("2006/01/02")+"/") || !strings.HasSuffix(key, fmt.Sprintf("-%05d.jsonl.gz", i)) {
+			t.Errorf("object %d: unexpected key %s", i, key)
+		}
+		exported = append(exported, decodeObject(t, uploader.bodies[i])...)
+	}
+	if strings.Join(exported, ",") != "log-1,log-2,log-3,log-4,log-5" {
+		t.Errorf("exported %v", exported)
+	}
+}
+
+func TestExportDeletesOnlyUploadedPages(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{logs: oldLogs(5, now)}
+	uploader := &fakeUploader{failAt: 2}
+	e := New(store, uploader, Config{PageSize: 2, DeleteAfter: true})
+
+	result, err := e.Run(context.Background(), now.Add(-24*time.Hour))
+	if err == nil {
+		t.Fatal("expected the upload error")
+	}
+	if result.Objects != 1 || result.Rows != 2 || result.Deleted != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(store.deleted) != 1 || strings.Join(store.deleted[0], ",") != "log-1,log-2" {
+		t.Errorf("expected only the uploaded page deleted, got %v", store.deleted)
+	}
+	if len(store.logs) != 3 {
+		t.Errorf("expected the unexported rows kept, %d left", len(store.logs))
+	}
+
+	// The next run picks up where the failed one stopped
+	uploader.failAt = 0
+	result, err = e.Run(context.Background(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rows != 3 || result.Deleted != 3 || len(store.logs) != 0 {
+		t.Errorf("unexpected retry: %+v, %d left", result, len(store.logs))
+	}
+}
+
+func TestExportLeavesNewerRowsAlone(t *testing.T) {
+	now := time.Now()
+	store := &fakeStore{logs: append(oldLogs(2, now), &models.GatewayLog{ID: "recent", CreatedAt: now.Add(-time.Minute)})}
+	e := New(store, &fakeUploader{}, Config{PageSize: 10, DeleteAfter: true})
+
+	if result, err := e.Run(context.Background(), now.Add(-24*time.Hour)); err != nil || result.Rows != 2 {
+		t.Fatalf("got %+v, %v", result, err)
+	}
+	if len(store.logs) != 1 || store.logs[0].ID != "recent" {
+		t.Errorf("expected the recent row kept, got %v", store.logs)
+	}
+}
+
+func TestExportRunsOneAtATime(t *testing.T) {
+	e := New(&fakeStore{}, &fakeUploader{}, Config{})
+	e.running.Lock()
+	if err := e.RunInBackground(time.Now()); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning, got %v", err)
+	}
+	if _, err := e.Run(context.Background(), time.Now()); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning, got %v", err)
+	}
+	e.running.Unlock()
+}
+
+func TestS3UploaderSignsPathStylePuts(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	u := NewS3Uploader(srv.URL, "llm-logs", "us-east-1", "AKIDEXAMPLE", "secret", "session-token")
+	if err := u.Upload(context.Background(), "gateway-logs/2026/07/01/run-00000.jsonl.gz", []byte("gz"), "application/gzip"); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPut || got.URL.Path != "/llm-logs/gateway-logs/2026/07/01/run-00000.jsonl.gz" || string(body) != "gz" {
+		t.Errorf("unexpected request: %s %s %q", got.Method, got.URL.Path, body)
+	}
+	if auth := got.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("unexpected Authorization: %s", auth)
+	}
+	if got.Header.Get("X-Amz-Security-Token") != "session-token" || got.Header.Get("X-Amz-Content-Sha256") == "" {
+		t.Errorf("missing signing headers: %v", got.Header)
+	}
+
+	// S3 errors fail the upload
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+	})
+	if err := u.Upload(context.Background(), "key", []byte("gz"), "application/gzip"); err == nil {
+		t.Error("expected a 403 to fail the upload")
+	}
+}
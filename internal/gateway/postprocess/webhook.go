@@ -0,0 +1,92 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ErrFailed wraps webhook failures for keys that fail closed
+var ErrFailed = errors.New("post-processing webhook failed")
+
+// maxResponseBytes caps how much of the webhook's reply is read
+const maxResponseBytes = 10 << 20
+
+// Request is the JSON payload POSTed to the webhook
+type Request struct {
+	Model      string                         `json:"model"`
+	Messages   []openai.ChatCompletionMessage `json:"messages"`
+	User       string                         `json:"user,omitempty"`
+	Completion *providers.ChatResponse        `json:"completion"`
+}
+
+// Response is the webhook's reply. Only the choices are applied, so usage and
+// cost stay as the gateway computed them.
+type Response struct {
+	Choices []openai.ChatCompletionChoice `json:"choices"`
+}
+
+// Client calls per-key post-processing webhooks
+type Client struct {
+	httpClient *http.Client
+}
+
+// New creates a client whose calls give up after timeout
+func New(timeout time.Duration) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+// Transform sends a completion to the webhook at url and replaces its choices
+// with the ones returned. A 204 leaves the completion unchanged.
+func (c *Client) Transform(ctx context.Context, url string, req providers.ChatRequest, resp *providers.ChatResponse) error {
+	body, err := json.Marshal(Request{
+		Model:      req.Model,
+		Messages:   req.Messages,
+		User:       req.User,
+		Completion: resp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("webhook returned status %d", httpResp.StatusCode)
+	}
+
+	var transformed Response
+	if err := json.NewDecoder(io.LimitReader(httpResp.Body, maxResponseBytes)).Decode(&transformed); err != nil {
+		return fmt.Errorf("invalid webhook response: %w", err)
+	}
+	if len(transformed.Choices) == 0 {
+		return errors.New("webhook returned no choices")
+	}
+
+	resp.Choices = transformed.Choices
+	return nil
+}
@@ -0,0 +1,90 @@
+package postprocess
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/sashabaranov/go-openai"
+)
+
+func completion(content string) *providers.ChatResponse {
+	return &providers.ChatResponse{
+		Model:   "gpt-4o",
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: content}}},
+		Usage:   openai.Usage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12},
+		CostUSD: 0.01,
+	}
+}
+
+func TestTransformReplacesChoices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("webhook got invalid JSON: %v", err)
+		}
+		// Scrub the email address from the completion
+		choices := req.Completion.Choices
+		choices[0].Message.Content = strings.ReplaceAll(choices[0].Message.Content, "ann@example.com", "[redacted]")
+		json.NewEncoder(w).Encode(Response{Choices: choices})
+	}))
+	defer srv.Close()
+
+	resp := completion("Write to ann@example.com")
+	req := providers.ChatRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Who do I email?"}}}
+	if err := New(time.Second).Transform(context.Background(), srv.URL, req, resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Write to [redacted]" {
+		t.Errorf("content = %q", got)
+	}
+	if resp.Usage.TotalTokens != 12 || resp.CostUSD != 0.01 {
+		t.Errorf("usage and cost should be kept, got %+v and %v", resp.Usage, resp.CostUSD)
+	}
+}
+
+func TestTransformNoContentLeavesCompletion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	resp := completion("unchanged")
+	if err := New(time.Second).Transform(context.Background(), srv.URL, providers.ChatRequest{}, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "unchanged" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestTransformFailures(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"timeout": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+		},
+		"server error": func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+		"no choices":   func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{"choices":[]}`)) },
+		"bad json":     func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`not json`)) },
+	} {
+		srv := httptest.NewServer(handler)
+		resp := completion("original")
+		err := New(50*time.Millisecond).Transform(context.Background(), srv.URL, providers.ChatRequest{}, resp)
+		srv.Close()
+
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if resp.Choices[0].Message.Content != "original" {
+			t.Errorf("%s: a failed webhook changed the completion to %q", name, resp.Choices[0].Message.Content)
+		}
+	}
+}
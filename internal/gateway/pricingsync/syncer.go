@@ -0,0 +1,208 @@
+package pricingsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// ErrRunning is returned when a sync is started while another is in progress
+var ErrRunning = errors.New("a pricing sync is already running")
+
+// maxSourceBytes caps how much of the pricing source is read
+const maxSourceBytes = 10 << 20
+
+// Store is the pricing storage being synced into, e.g. *database.DB
+type Store interface {
+	SyncModelPricing(ctx context.Context, prices []models.PricingUpdate, source string) (inserted, updated int, err error)
+}
+
+// Document is the pricing source format
+type Document struct {
+	Models []Entry `json:"models"`
+}
+
+// Entry is one model's pricing in the source. Optional fields that are
+// omitted keep their current value.
+type Entry struct {
+	Provider          string   `json:"provider"`
+	Model             string   `json:"model"`
+	InputPer1kTokens  *float64 `json:"input_per_1k_tokens"`
+	OutputPer1kTokens *float64 `json:"output_per_1k_tokens"`
+	ContextWindow     *int     `json:"context_window,omitempty"`
+	SupportsStreaming *bool    `json:"supports_streaming,omitempty"`
+	PricePerMinute    *float64 `json:"price_per_minute,omitempty"`
+}
+
+// Result summarizes a sync run
+type Result struct {
+	Source    string `json:"source"`
+	Models    int    `json:"models"`
+	Inserted  int    `json:"inserted"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+}
+
+// Syncer keeps model_pricing in line with a JSON pricing source
+type Syncer struct {
+	store      Store
+	source     string // http(s) URL or file path
+	interval   time.Duration
+	httpClient *http.Client
+
+	running sync.Mutex
+}
+
+// New creates a syncer for source, an http(s) URL or a file path
+func New(store Store, source string, interval time.Duration) *Syncer {
+	return &Syncer{
+		store:      store,
+		source:     source,
+		interval:   interval,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Start syncs once now and then every interval until ctx is cancelled
+func (s *Syncer) Start(ctx context.Context) {
+	go func() {
+		logResult(s.Run(ctx))
+		if s.interval <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				logResult(s.Run(ctx))
+			}
+		}
+	}()
+}
+
+// Run fetches and validates the source, then applies it in one transaction.
+// An invalid document changes nothing.
+func (s *Syncer) Run(ctx context.Context) (Result, error) {
+	if !s.running.TryLock() {
+		return Result{}, ErrRunning
+	}
+	defer s.running.Unlock()
+
+	result := Result{Source: s.source}
+
+	body, err := s.fetch(ctx)
+	if err != nil {
+		return result, err
+	}
+	prices, err := Parse(body)
+	if err != nil {
+		return result, fmt.Errorf("invalid pricing source %s: %w", s.source, err)
+	}
+
+	result.Models = len(prices)
+	result.Inserted, result.Updated, err = s.store.SyncModelPricing(ctx, prices, s.source)
+	if err != nil {
+		return result, err
+	}
+	result.Unchanged = result.Models - result.Inserted - result.Updated
+	return result, nil
+}
+
+// fetch reads the source from its URL or file
+func (s *Syncer) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		body, err := os.ReadFile(s.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pricing source: %w", err)
+		}
+		return body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pricing source: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch pricing source (status %d)", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSourceBytes))
+}
+
+// Parse decodes and validates a pricing document. Unknown fields, missing or
+// negative prices and duplicate models are rejected.
+func Parse(body []byte) ([]models.PricingUpdate, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Models) == 0 {
+		return nil, errors.New("no models")
+	}
+
+	seen := make(map[string]bool, len(doc.Models))
+	prices := make([]models.PricingUpdate, 0, len(doc.Models))
+	for i, entry := range doc.Models {
+		if entry.Provider == "" || entry.Model == "" {
+			return nil, fmt.Errorf("models[%d]: provider and model are required", i)
+		}
+		name := entry.Provider + "/" + entry.Model
+		if seen[name] {
+			return nil, fmt.Errorf("models[%d]: duplicate entry for %s", i, name)
+		}
+		seen[name] = true
+
+		if entry.InputPer1kTokens == nil || entry.OutputPer1kTokens == nil {
+			return nil, fmt.Errorf("%s: input_per_1k_tokens and output_per_1k_tokens are required", name)
+		}
+		if *entry.InputPer1kTokens < 0 || *entry.OutputPer1kTokens < 0 ||
+			(entry.PricePerMinute != nil && *entry.PricePerMinute < 0) ||
+			(entry.ContextWindow != nil && *entry.ContextWindow < 0) {
+			return nil, fmt.Errorf("%s: prices and context_window must not be negative", name)
+		}
+
+		prices = append(prices, models.PricingUpdate{
+			Provider:          entry.Provider,
+			Model:             entry.Model,
+			InputPer1kTokens:  *entry.InputPer1kTokens,
+			OutputPer1kTokens: *entry.OutputPer1kTokens,
+			ContextWindow:     entry.ContextWindow,
+			SupportsStreaming: entry.SupportsStreaming,
+			PricePerMinute:    entry.PricePerMinute,
+		})
+	}
+	return prices, nil
+}
+
+// logResult logs the outcome of a sync run
+func logResult(result Result, err error) {
+	if err != nil {
+		log.Printf("Pricing sync from %s failed: %v", result.Source, err)
+		return
+	}
+	log.Printf("Synced pricing for %d models from %s (%d inserted, %d updated)", result.Models, result.Source, result.Inserted, result.Updated)
+}
@@ -0,0 +1,103 @@
+package pricingsync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// fakeStore records what a sync would apply
+type fakeStore struct {
+	prices []models.PricingUpdate
+	source string
+}
+
+func (s *fakeStore) SyncModelPricing(ctx context.Context, prices []models.PricingUpdate, source string) (int, int, error) {
+	s.prices, s.source = prices, source
+	return len(prices), 0, nil
+}
+
+func TestParseLeavesOmittedFieldsUnset(t *testing.T) {
+	prices, err := Parse([]byte(`{"models": [
+		{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 0.0025, "output_per_1k_tokens": 0.01},
+		{"provider": "openai", "model": "whisper-1", "input_per_1k_tokens": 0, "output_per_1k_tokens": 0,
+		 "context_window": 0, "supports_streaming": false, "price_per_minute": 0.006}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	omitted := prices[0]
+	if omitted.ContextWindow != nil || omitted.SupportsStreaming != nil || omitted.PricePerMinute != nil {
+		t.Errorf("omitted fields should stay nil, got %+v", omitted)
+	}
+	given := prices[1]
+	if given.ContextWindow == nil || *given.ContextWindow != 0 ||
+		given.SupportsStreaming == nil || *given.SupportsStreaming ||
+		given.PricePerMinute == nil || *given.PricePerMinute != 0.006 {
+		t.Errorf("explicit values, zeros included, should be kept, got %+v", given)
+	}
+}
+
+func TestParseRejectsInvalidDocuments(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty":            `{"models": []}`,
+		"unknown field":    `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 1, "output_per_1k_tokens": 1, "currency": "EUR"}]}`,
+		"missing price":    `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 1}]}`,
+		"negative price":   `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": -1, "output_per_1k_tokens": 1}]}`,
+		"negative window":  `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 1, "output_per_1k_tokens": 1, "context_window": -5}]}`,
+		"negative minute":  `{"models": [{"provider": "openai", "model": "whisper-1", "input_per_1k_tokens": 0, "output_per_1k_tokens": 0, "price_per_minute": -1}]}`,
+		"missing model":    `{"models": [{"provider": "openai", "input_per_1k_tokens": 1, "output_per_1k_tokens": 1}]}`,
+		"duplicate models": `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 1, "output_per_1k_tokens": 1}, {"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 2, "output_per_1k_tokens": 2}]}`,
+	} {
+		if _, err := Parse([]byte(body)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunFromURLAndFile(t *testing.T) {
+	doc := `{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": 0.0025, "output_per_1k_tokens": 0.01}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(file, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{srv.URL, file} {
+		store := &fakeStore{}
+		result, err := New(store, source, time.Hour).Run(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		if result.Models != 1 || result.Inserted != 1 || len(store.prices) != 1 || store.source != source {
+			t.Errorf("%s: got %+v, store saw %d models from %q", source, result, len(store.prices), store.source)
+		}
+	}
+}
+
+func TestRunAppliesNothingFromAnInvalidSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"models": [{"provider": "openai", "model": "gpt-4o", "input_per_1k_tokens": -1, "output_per_1k_tokens": 1}]}`))
+	}))
+	defer srv.Close()
+
+	store := &fakeStore{}
+	_, err := New(store, srv.URL, time.Hour).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid pricing source") {
+		t.Errorf("expected an invalid source error, got %v", err)
+	}
+	if store.prices != nil {
+		t.Error("an invalid document must not reach the store")
+	}
+}
@@ -0,0 +1,145 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Class is a request's QoS class. Lower classes are dispatched first.
+type Class int
+
+const (
+	Interactive Class = iota
+	Batch
+
+	numClasses
+)
+
+// ErrQueueFull is returned when every worker is busy and the wait queue is at capacity
+var ErrQueueFull = errors.New("gateway is at capacity, try again shortly")
+
+// String returns the class name as sent by clients
+func (c Class) String() string {
+	if c == Batch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// ParseClass parses a class name, returning def for ""
+func ParseClass(name string, def Class) (Class, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		return def, nil
+	case "interactive":
+		return Interactive, nil
+	case "batch":
+		return Batch, nil
+	default:
+		return 0, fmt.Errorf("invalid priority %q (use interactive or batch)", name)
+	}
+}
+
+// Queue hands out a fixed number of worker slots. When all are busy, callers
+// wait in a bounded queue and freed slots go to the highest class first, then
+// in arrival order.
+type Queue struct {
+	mu        sync.Mutex
+	free      int
+	maxQueued int
+	queued    int
+	waiting   [numClasses][]*waiter
+}
+
+// waiter is a caller blocked in Acquire
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// New creates a queue with workers slots and room for maxQueued waiters.
+// Returns nil (no limit) if workers is 0.
+func New(workers, maxQueued int) *Queue {
+	if workers <= 0 {
+		return nil
+	}
+	return &Queue{free: workers, maxQueued: maxQueued}
+}
+
+// Acquire takes a worker slot for class, waiting while none is free. The
+// returned release must be called once the work is done. A nil queue never waits.
+func (q *Queue) Acquire(ctx context.Context, class Class) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	q.mu.Lock()
+	if q.free > 0 {
+		q.free--
+		q.mu.Unlock()
+		return q.releaser(), nil
+	}
+	if q.queued >= q.maxQueued {
+		q.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{ready: make(chan struct{})}
+	q.waiting[class] = append(q.waiting[class], w)
+	q.queued++
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.releaser(), nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if w.granted {
+			// Handed a slot as we gave up - pass it on
+			q.mu.Unlock()
+			q.release()
+			return nil, ctx.Err()
+		}
+		q.remove(class, w)
+		q.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns a release func that is safe to call more than once
+func (q *Queue) releaser() func() {
+	var once sync.Once
+	return func() { once.Do(q.release) }
+}
+
+// release gives a slot to the next waiter, or back to the pool
+func (q *Queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for class := range q.waiting {
+		if len(q.waiting[class]) == 0 {
+			continue
+		}
+		w := q.waiting[class][0]
+		q.waiting[class] = q.waiting[class][1:]
+		q.queued--
+		w.granted = true
+		close(w.ready)
+		return
+	}
+	q.free++
+}
+
+// remove drops a waiter that gave up. Callers hold q.mu.
+func (q *Queue) remove(class Class, w *waiter) {
+	for i, candidate := range q.waiting[class] {
+		if candidate == w {
+			q.waiting[class] = append(q.waiting[class][:i], q.waiting[class][i+1:]...)
+			q.queued--
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued blocks until n callers are waiting in q
+func waitQueued(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		queued := q.queued
+		q.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d queued, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInteractiveDispatchedBeforeQueuedBatch(t *testing.T) {
+	q := New(1, 10)
+	release, err := q.Acquire(context.Background(), Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Batch work queues first, then interactive arrives behind it
+	dispatched := make(chan string, 4)
+	enqueue := func(name string, class Class, n int) {
+		go func() {
+			release, err := q.Acquire(context.Background(), class)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			dispatched <- name
+			release()
+		}()
+		waitQueued(t, q, n)
+	}
+	enqueue("batch-1", Batch, 1)
+	enqueue("batch-2", Batch, 2)
+	enqueue("interactive-1", Interactive, 3)
+	enqueue("interactive-2", Interactive, 4)
+
+	release()
+	var order []string
+	for i := 0; i < 4; i++ {
+		select {
+		case name := <-dispatched:
+			order = append(order, name)
+		case <-time.After(time.Second):
+			t.Fatalf("dispatch stalled after %v", order)
+		}
+	}
+	want := []string{"interactive-1", "interactive-2", "batch-1", "batch-2"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("dispatched %v, want %v", order, want)
+		}
+	}
+}
+
+func TestQueueRejectsPastItsBound(t *testing.T) {
+	q := New(1, 1)
+	release, _ := q.Acquire(context.Background(), Interactive)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Acquire(ctx, Batch)
+	waitQueued(t, q, 1)
+
+	if _, err := q.Acquire(context.Background(), Interactive); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestAbandonedWaiterGivesUpItsPlace(t *testing.T) {
+	q := New(1, 10)
+	release, _ := q.Acquire(context.Background(), Interactive)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := q.Acquire(ctx, Interactive); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline, got %v", err)
+	}
+	waitQueued(t, q, 0)
+
+	// The slot goes back to the pool rather than to the caller that left,
+	// and releasing twice doesn't mint a second one
+	release()
+	release()
+	if _, err := q.Acquire(context.Background(), Batch); err != nil {
+		t.Fatal(err)
+	}
+	q.mu.Lock()
+	free := q.free
+	q.mu.Unlock()
+	if free != 0 {
+		t.Errorf("expected no free slots, got %d", free)
+	}
+}
+
+func TestParseClass(t *testing.T) {
+	for name, want := range map[string]Class{"": Batch, "interactive": Interactive, " Batch ": Batch, "INTERACTIVE": Interactive} {
+		if got, err := ParseClass(name, Batch); err != nil || got != want {
+			t.Errorf("ParseClass(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseClass("urgent", Interactive); err == nil {
+		t.Error("expected an unknown class to be rejected")
+	}
+
+	// A nil queue never limits
+	release, err := (*Queue)(nil).Acquire(context.Background(), Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -16,55 +17,122 @@ import (
 
 // AnthropicProvider handles Anthropic Claude API requests
 type AnthropicProvider struct {
+	noTranscription
+
 	apiKey     string
+	baseURL    string
 	httpClient *http.Client
 }
 
+// anthropicBaseURL is the default Anthropic API endpoint
+const anthropicBaseURL = "https://api.anthropic.com"
+
 // AnthropicRequest represents a request to Anthropic's Messages API
 type AnthropicRequest struct {
-	Model       string             `json:"model"`
-	Messages    []AnthropicMessage `json:"messages"`
-	MaxTokens   int                `json:"max_tokens"`
-	Temperature *float32           `json:"temperature,omitempty"`
-	System      string             `json:"system,omitempty"`
-	Stream      bool               `json:"stream,omitempty"`
+	Model       string                  `json:"model"`
+	Messages    []AnthropicMessage      `json:"messages"`
+	MaxTokens   int                     `json:"max_tokens"`
+	Temperature *float32                `json:"temperature,omitempty"`
+	System      []AnthropicContentBlock `json:"system,omitempty"`
+	Stream      bool                    `json:"stream,omitempty"`
+	Thinking    *AnthropicThinking      `json:"thinking,omitempty"`
+	Metadata    *AnthropicMetadata      `json:"metadata,omitempty"`
+	Tools       []AnthropicTool         `json:"tools,omitempty"`
+	ToolChoice  *AnthropicToolChoice    `json:"tool_choice,omitempty"`
+	Stop        []string                `json:"stop_sequences,omitempty"`
+}
+
+// AnthropicTool declares a tool the model may call
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// AnthropicToolChoice controls tool use: "auto", "any", "tool" (with Name) or "none"
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// AnthropicMetadata identifies the end user; Anthropic rejects any other key
+type AnthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// AnthropicThinking configures extended thinking
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
 // AnthropicMessage represents a message in Anthropic format
 type AnthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string                  `json:"role"`
+	Content []AnthropicContentBlock `json:"content"`
 }
 
 // AnthropicResponse represents a response from Anthropic's API
 type AnthropicResponse struct {
-	ID      string                  `json:"id"`
-	Type    string                  `json:"type"`
-	Role    string                  `json:"role"`
-	Content []AnthropicContentBlock `json:"content"`
-	Model   string                  `json:"model"`
-	Usage   AnthropicUsage          `json:"usage"`
+	ID         string                  `json:"id"`
+	Type       string                  `json:"type"`
+	Role       string                  `json:"role"`
+	Content    []AnthropicContentBlock `json:"content"`
+	Model      string                  `json:"model"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      AnthropicUsage          `json:"usage"`
 }
 
 // AnthropicContentBlock represents a content block
 type AnthropicContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	Thinking     string                 `json:"thinking,omitempty"`
+	ID           string                 `json:"id,omitempty"`          // tool_use
+	Name         string                 `json:"name,omitempty"`        // tool_use
+	Input        json.RawMessage        `json:"input,omitempty"`       // tool_use
+	ToolUseID    string                 `json:"tool_use_id,omitempty"` // tool_result
+	Content      string                 `json:"content,omitempty"`     // tool_result
+	Source       *AnthropicImageSource  `json:"source,omitempty"`      // image
+	CacheControl *AnthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+// AnthropicImageSource is an image given inline ("base64") or by "url"
+type AnthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"` // base64
+	Data      string `json:"data,omitempty"`       // base64
+	URL       string `json:"url,omitempty"`        // url
+}
+
+// AnthropicCacheControl marks a prompt caching breakpoint
+type AnthropicCacheControl struct {
+	Type string `json:"type"` // "ephemeral"
 }
 
 // AnthropicUsage represents token usage
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
+// promptCacheMinChars is roughly Anthropic's 1024-token minimum cacheable
+// prefix; shorter messages aren't worth a breakpoint
+const promptCacheMinChars = 4096
+
 // NewAnthropicProvider creates a new Anthropic provider
-func NewAnthropicProvider(apiKey string) *AnthropicProvider {
+func NewAnthropicProvider(apiKey string, transport http.RoundTripper) *AnthropicProvider {
+	return newAnthropicProvider(apiKey, anthropicBaseURL, transport)
+}
+
+// newAnthropicProvider creates an Anthropic provider for a specific endpoint
+func newAnthropicProvider(apiKey, baseURL string, transport http.RoundTripper) *AnthropicProvider {
 	return &AnthropicProvider{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		httpClient: newUpstreamClient(upstreamTimeout, transport),
 	}
 }
 
@@ -73,14 +141,11 @@ func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req ChatRequest)
 	startTime := time.Now()
 
 	// Convert to Anthropic format
-	anthropicReq, systemPrompt := p.convertRequest(req)
-	if systemPrompt != "" {
-		anthropicReq.System = systemPrompt
-	}
+	anthropicReq := p.convertRequest(req)
 
 	// Make HTTP request
 	reqBody, _ := json.Marshal(anthropicReq)
-	httpReq, _ := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewReader(reqBody))
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", p.apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
@@ -94,7 +159,14 @@ func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req ChatRequest)
 	respBody, _ := io.ReadAll(httpResp.Body)
 
 	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Anthropic API error (status %d): %s", httpResp.StatusCode, string(respBody))
+		if ctxErr := detectContextLengthError("anthropic", req.Model, httpResp.StatusCode, string(respBody)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Anthropic", StatusCode: httpResp.StatusCode, Body: string(respBody)}
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(httpResp.Header, err)
+		}
+		return nil, err
 	}
 
 	var anthropicResp AnthropicResponse
@@ -104,19 +176,18 @@ func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req ChatRequest)
 
 	latencyMs := int(time.Since(startTime).Milliseconds())
 
-	return p.convertResponse(anthropicResp, latencyMs), nil
+	chatResp := p.convertResponse(anthropicResp, latencyMs)
+	chatResp.RateLimit = parseUpstreamRateLimit(httpResp.Header)
+	return chatResp, nil
 }
 
 // ChatCompletionStream makes a streaming request
 func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
-	anthropicReq, systemPrompt := p.convertRequest(req)
+	anthropicReq := p.convertRequest(req)
 	anthropicReq.Stream = true
-	if systemPrompt != "" {
-		anthropicReq.System = systemPrompt
-	}
 
 	reqBody, _ := json.Marshal(anthropicReq)
-	httpReq, _ := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(reqBody))
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/messages", bytes.NewReader(reqBody))
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", p.apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
@@ -129,7 +200,14 @@ func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req ChatRe
 	if httpResp.StatusCode != http.StatusOK {
 		defer httpResp.Body.Close()
 		respBody, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("Anthropic API error (status %d): %s", httpResp.StatusCode, string(respBody))
+		if ctxErr := detectContextLengthError("anthropic", req.Model, httpResp.StatusCode, string(respBody)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Anthropic", StatusCode: httpResp.StatusCode, Body: string(respBody)}
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(httpResp.Header, err)
+		}
+		return nil, err
 	}
 
 	return &AnthropicStreamReader{
@@ -142,14 +220,17 @@ func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req ChatRe
 type AnthropicStreamReader struct {
 	reader *bufio.Reader
 	resp   *http.Response
+
+	// Anthropic content block index -> OpenAI tool call index
+	toolCalls map[int]int
 }
 
 // Recv reads the next streaming chunk
-func (r *AnthropicStreamReader) Recv() (openai.ChatCompletionStreamResponse, error) {
+func (r *AnthropicStreamReader) Recv() (StreamChunk, error) {
 	for {
 		line, err := r.reader.ReadString('\n')
 		if err != nil {
-			return openai.ChatCompletionStreamResponse{}, err
+			return StreamChunk{}, err
 		}
 
 		line = strings.TrimSpace(line)
@@ -159,20 +240,79 @@ func (r *AnthropicStreamReader) Recv() (openai.ChatCompletionStreamResponse, err
 
 		if strings.HasPrefix(line, "data:") {
 			dataStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if dataStr == streamDoneSentinel {
+				return StreamChunk{}, io.EOF
+			}
 
 			var event map[string]interface{}
 			if err := json.Unmarshal([]byte(dataStr), &event); err != nil {
 				continue
 			}
 
-			chunk := openai.ChatCompletionStreamResponse{
+			chunk := StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
 				Object:  "chat.completion.chunk",
 				Choices: []openai.ChatCompletionStreamChoice{},
-			}
+			}}
 
 			eventType, _ := event["type"].(string)
-			if eventType == "content_block_delta" {
+			blockIndex, _ := event["index"].(float64)
+			if eventType == "content_block_start" {
+				// A tool_use block opens a tool call; its arguments follow as input_json_delta
+				if block, ok := event["content_block"].(map[string]interface{}); ok && block["type"] == "tool_use" {
+					id, _ := block["id"].(string)
+					name, _ := block["name"].(string)
+
+					if r.toolCalls == nil {
+						r.toolCalls = make(map[int]int)
+					}
+					toolIndex := len(r.toolCalls)
+					r.toolCalls[int(blockIndex)] = toolIndex
+
+					chunk.Choices = []openai.ChatCompletionStreamChoice{
+						{
+							Index: 0,
+							Delta: openai.ChatCompletionStreamChoiceDelta{
+								ToolCalls: []openai.ToolCall{{
+									Index:    &toolIndex,
+									ID:       id,
+									Type:     openai.ToolTypeFunction,
+									Function: openai.FunctionCall{Name: name},
+								}},
+							},
+						},
+					}
+					return chunk, nil
+				}
+			} else if eventType == "content_block_delta" {
 				if delta, ok := event["delta"].(map[string]interface{}); ok {
+					if partial, ok := delta["partial_json"].(string); ok && partial != "" {
+						toolIndex, ok := r.toolCalls[int(blockIndex)]
+						if !ok {
+							continue
+						}
+						chunk.Choices = []openai.ChatCompletionStreamChoice{
+							{
+								Index: 0,
+								Delta: openai.ChatCompletionStreamChoiceDelta{
+									ToolCalls: []openai.ToolCall{{
+										Index:    &toolIndex,
+										Function: openai.FunctionCall{Arguments: partial},
+									}},
+								},
+							},
+						}
+						return chunk, nil
+					}
+					if thinking, ok := delta["thinking"].(string); ok && thinking != "" {
+						chunk.Reasoning = thinking
+						chunk.Choices = []openai.ChatCompletionStreamChoice{
+							{
+								Index: 0,
+								Delta: openai.ChatCompletionStreamChoiceDelta{},
+							},
+						}
+						return chunk, nil
+					}
 					if text, ok := delta["text"].(string); ok && text != "" {
 						chunk.Choices = []openai.ChatCompletionStreamChoice{
 							{
@@ -195,11 +335,32 @@ func (r *AnthropicStreamReader) Recv() (openai.ChatCompletionStreamResponse, err
 					},
 				}
 				return chunk, nil
+			} else if eventType == "message_delta" {
+				if delta, ok := event["delta"].(map[string]interface{}); ok {
+					if stopReason, ok := delta["stop_reason"].(string); ok && stopReason != "" {
+						chunk.Choices = []openai.ChatCompletionStreamChoice{
+							{
+								Index:        0,
+								Delta:        openai.ChatCompletionStreamChoiceDelta{},
+								FinishReason: convertAnthropicStopReason(stopReason),
+							},
+						}
+						return chunk, nil
+					}
+				}
 			}
 		}
 	}
 }
 
+// RateLimit returns the rate-limit headers Anthropic sent with the stream
+func (r *AnthropicStreamReader) RateLimit() *UpstreamRateLimit {
+	if r.resp == nil {
+		return nil
+	}
+	return parseUpstreamRateLimit(r.resp.Header)
+}
+
 // Close closes the stream
 func (r *AnthropicStreamReader) Close() error {
 	if r.resp != nil && r.resp.Body != nil {
@@ -208,40 +369,278 @@ func (r *AnthropicStreamReader) Close() error {
 	return nil
 }
 
+// anthropicThinkingModels are the Claude models that accept extended thinking
+var anthropicThinkingModels = map[string]bool{
+	"claude-opus-4-5-20251101":   true,
+	"claude-opus-4-5":            true,
+	"claude-sonnet-4-5-20250929": true,
+	"claude-sonnet-4-5":          true,
+	"claude-haiku-4-5-20251001":  true,
+	"claude-haiku-4-5":           true,
+	"claude-opus-4-1-20250805":   true,
+	"claude-opus-4-20250514":     true,
+	"claude-sonnet-4-20250514":   true,
+	"claude-3-7-sonnet-20250219": true,
+	"claude-3-7-sonnet-latest":   true,
+}
+
+// Anthropic's thinking budget floor, and the room reasoning_effort leaves for
+// the answer on top of the budget
+const (
+	anthropicMinThinkingBudget = 1024
+	anthropicAnswerTokens      = 4096
+)
+
+// anthropicThinkingBudget fits a thinking budget under max_tokens, which must
+// exceed it. max_tokens is raised to leave room for the answer, but never past
+// the key's cap (limit); under a tight cap the budget shrinks to half of it
+// instead. Returns false if the cap can't fit the minimum budget.
+func anthropicThinkingBudget(maxTokens, budget, limit int) (int, int, bool) {
+	if maxTokens <= budget {
+		maxTokens = budget + anthropicAnswerTokens
+	}
+	if limit > 0 && maxTokens > limit {
+		maxTokens = limit
+	}
+	if budget >= maxTokens {
+		budget = maxTokens / 2
+	}
+	if budget < anthropicMinThinkingBudget {
+		return 0, 0, false
+	}
+	return maxTokens, budget, true
+}
+
 // convertRequest converts to Anthropic format
-func (p *AnthropicProvider) convertRequest(req ChatRequest) (AnthropicRequest, string) {
+func (p *AnthropicProvider) convertRequest(req ChatRequest) AnthropicRequest {
 	anthropicReq := AnthropicRequest{
 		Model:       req.Model,
 		Messages:    []AnthropicMessage{},
 		MaxTokens:   4096,
 		Temperature: req.Temperature,
+		Stop:        req.Stop,
 	}
 
 	if req.MaxTokens != nil && *req.MaxTokens > 0 {
 		anthropicReq.MaxTokens = *req.MaxTokens
 	}
 
+	if userID := req.Metadata["user_id"]; userID != "" {
+		anthropicReq.Metadata = &AnthropicMetadata{UserID: userID}
+	}
+
+	if req.Thinking != nil {
+		anthropicReq.Thinking = &AnthropicThinking{
+			Type:         req.Thinking.Type,
+			BudgetTokens: req.Thinking.BudgetTokens,
+		}
+	} else if budget := req.reasoningBudget(); budget > 0 {
+		if !anthropicThinkingModels[req.Model] {
+			log.Printf("Warning: reasoning_effort is not supported by this Claude model, ignoring for model %s", req.Model)
+		} else if maxTokens, budget, ok := anthropicThinkingBudget(anthropicReq.MaxTokens, budget, req.MaxTokensLimit); ok {
+			anthropicReq.Thinking = &AnthropicThinking{Type: "enabled", BudgetTokens: budget}
+			anthropicReq.MaxTokens = maxTokens
+		} else {
+			log.Printf("Warning: max_tokens cap of %d is too small for reasoning_effort, ignoring for model %s", req.MaxTokensLimit, req.Model)
+		}
+	}
+
+	if len(req.LogitBias) > 0 {
+		log.Printf("Warning: logit_bias is not supported by Anthropic, ignoring for model %s", req.Model)
+	}
+	if req.Seed != nil {
+		log.Printf("Warning: seed is not supported by Anthropic, ignoring for model %s", req.Model)
+	}
+
+	for _, tool := range req.Tools {
+		anthropicReq.Tools = append(anthropicReq.Tools, AnthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: toolParameters(tool.Function),
+		})
+	}
+	anthropicReq.ToolChoice = convertAnthropicToolChoice(req)
+
 	var systemPrompt string
 	for _, msg := range req.Messages {
-		if msg.Role == "system" {
+		switch msg.Role {
+		case "system":
 			systemPrompt = msg.Content
-		} else {
+
+		case "tool", "function":
+			// Tool results go back as user tool_result blocks; consecutive
+			// results must share one user message
+			block := AnthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}
+			if msg.Role == "function" {
+				block.ToolUseID = msg.Name
+			}
+
+			if n := len(anthropicReq.Messages); n > 0 && isToolResultMessage(anthropicReq.Messages[n-1]) {
+				anthropicReq.Messages[n-1].Content = append(anthropicReq.Messages[n-1].Content, block)
+			} else {
+				anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+					Role:    "user",
+					Content: []AnthropicContentBlock{block},
+				})
+			}
+
+		case "assistant":
+			anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
+				Role:    "assistant",
+				Content: convertAssistantBlocks(msg),
+			})
+
+		default:
 			anthropicReq.Messages = append(anthropicReq.Messages, AnthropicMessage{
 				Role:    msg.Role,
-				Content: msg.Content,
+				Content: convertUserBlocks(msg),
 			})
 		}
 	}
 
-	return anthropicReq, systemPrompt
+	if systemPrompt != "" {
+		anthropicReq.System = []AnthropicContentBlock{{Type: "text", Text: systemPrompt}}
+	}
+
+	if req.PromptCaching {
+		applyPromptCaching(&anthropicReq)
+	}
+
+	return anthropicReq
+}
+
+// convertUserBlocks converts a user message's content, with any image parts
+// as image blocks
+func convertUserBlocks(msg openai.ChatCompletionMessage) []AnthropicContentBlock {
+	if len(msg.MultiContent) == 0 {
+		return []AnthropicContentBlock{{Type: "text", Text: msg.Content}}
+	}
+
+	blocks := make([]AnthropicContentBlock, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		switch {
+		case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			source := &AnthropicImageSource{Type: "url", URL: part.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				source = &AnthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+			}
+			blocks = append(blocks, AnthropicContentBlock{Type: "image", Source: source})
+		case part.Text != "":
+			blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: part.Text})
+		}
+	}
+	return blocks
+}
+
+// convertAnthropicToolChoice maps tool_choice to Anthropic's, or nil for its default (auto)
+func convertAnthropicToolChoice(req ChatRequest) *AnthropicToolChoice {
+	if len(req.Tools) == 0 {
+		return nil
+	}
+
+	mode, name, _ := req.toolChoice()
+	switch mode {
+	case toolChoiceNone:
+		return &AnthropicToolChoice{Type: "none"}
+	case toolChoiceRequired:
+		return &AnthropicToolChoice{Type: "any"}
+	case toolChoiceFunction:
+		return &AnthropicToolChoice{Type: "tool", Name: name}
+	}
+	return nil
+}
+
+// convertAssistantBlocks converts an assistant message, including any tool calls, to content blocks
+func convertAssistantBlocks(msg openai.ChatCompletionMessage) []AnthropicContentBlock {
+	var blocks []AnthropicContentBlock
+	if msg.Content != "" {
+		blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: msg.Content})
+	}
+
+	for _, call := range msg.ToolCalls {
+		blocks = append(blocks, AnthropicContentBlock{
+			Type:  "tool_use",
+			ID:    call.ID,
+			Name:  call.Function.Name,
+			Input: toolArguments(call.Function.Arguments),
+		})
+	}
+
+	// Legacy function calls have no id, so the function name links call and result
+	if msg.FunctionCall != nil {
+		blocks = append(blocks, AnthropicContentBlock{
+			Type:  "tool_use",
+			ID:    msg.FunctionCall.Name,
+			Name:  msg.FunctionCall.Name,
+			Input: toolArguments(msg.FunctionCall.Arguments),
+		})
+	}
+
+	if len(blocks) == 0 {
+		blocks = append(blocks, AnthropicContentBlock{Type: "text", Text: msg.Content})
+	}
+	return blocks
+}
+
+// isToolResultMessage reports whether a message holds only tool_result blocks
+func isToolResultMessage(msg AnthropicMessage) bool {
+	if msg.Role != "user" || len(msg.Content) == 0 {
+		return false
+	}
+	for _, block := range msg.Content {
+		if block.Type != "tool_result" {
+			return false
+		}
+	}
+	return true
+}
+
+// toolArguments returns tool call arguments as a JSON object, defaulting to {}
+func toolArguments(arguments string) json.RawMessage {
+	if !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// applyPromptCaching adds cache_control breakpoints to the system prompt and
+// the last long message, so the static prefix is billed at the cached rate
+func applyPromptCaching(req *AnthropicRequest) {
+	ephemeral := &AnthropicCacheControl{Type: "ephemeral"}
+
+	if len(req.System) > 0 {
+		req.System[len(req.System)-1].CacheControl = ephemeral
+	}
+
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		blocks := req.Messages[i].Content
+		if len(blocks) > 0 && len(blocks[len(blocks)-1].Text) >= promptCacheMinChars {
+			blocks[len(blocks)-1].CacheControl = ephemeral
+			return
+		}
+	}
 }
 
 // convertResponse converts Anthropic response to standard format
 func (p *AnthropicProvider) convertResponse(resp AnthropicResponse, latencyMs int) *ChatResponse {
-	var content string
+	var content, reasoning string
+	var toolCalls []openai.ToolCall
 	for _, block := range resp.Content {
-		if block.Type == "text" {
+		switch block.Type {
+		case "text":
 			content += block.Text
+		case "thinking":
+			reasoning += block.Thinking
+		case "tool_use":
+			toolCalls = append(toolCalls, openai.ToolCall{
+				ID:       block.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: block.Name, Arguments: string(toolArguments(string(block.Input)))},
+			})
 		}
 	}
 
@@ -254,19 +653,63 @@ func (p *AnthropicProvider) convertResponse(resp AnthropicResponse, latencyMs in
 			{
 				Index: 0,
 				Message: openai.ChatCompletionMessage{
-					Role:    "assistant",
-					Content: content,
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
 				},
-				FinishReason: "stop",
+				FinishReason: convertAnthropicStopReason(resp.StopReason),
 			},
 		},
-		Usage: openai.Usage{
-			PromptTokens:     resp.Usage.InputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		},
-		LatencyMs: latencyMs,
+		Usage:            convertAnthropicUsage(resp.Usage),
+		CacheWriteTokens: resp.Usage.CacheCreationInputTokens,
+		LatencyMs:        latencyMs,
+		Reasoning:        reasoning,
+	}
+}
+
+// convertAnthropicUsage maps Anthropic usage to OpenAI's. Anthropic's
+// input_tokens excludes cached tokens, so they're added back into prompt
+// tokens with cache reads reported as cached tokens.
+func convertAnthropicUsage(usage AnthropicUsage) openai.Usage {
+	promptTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+
+	converted := openai.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      promptTokens + usage.OutputTokens,
+	}
+	if usage.CacheReadInputTokens > 0 {
+		converted.PromptTokensDetails = &openai.PromptTokensDetails{
+			CachedTokens: usage.CacheReadInputTokens,
+		}
+	}
+
+	return converted
+}
+
+// convertAnthropicStopReason maps Anthropic stop reasons to OpenAI finish reasons
+func convertAnthropicStopReason(reason string) openai.FinishReason {
+	switch reason {
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "refusal":
+		return openai.FinishReasonContentFilter
+	default: // end_turn, stop_sequence, pause_turn
+		return openai.FinishReasonStop
+	}
+}
+
+// Warm lists models to open a connection to the API ahead of the first request
+func (p *AnthropicProvider) Warm(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1/models", nil)
+	if err != nil {
+		return err
 	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	return warmRequest(p.httpClient, httpReq, "Anthropic")
 }
 
 // ValidateModel checks if a model is valid
@@ -284,3 +727,13 @@ func (p *AnthropicProvider) ValidateModel(model string) bool {
 func (p *AnthropicProvider) GetProviderName() string {
 	return "anthropic"
 }
+
+// Capabilities returns the features supported for this provider
+func (p *AnthropicProvider) Capabilities() Capabilities {
+	// No native JSON mode: response_format isn't translated
+	return Capabilities{
+		Streaming: true,
+		Tools:     true,
+		Vision:    true,
+	}
+}
@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func cachingRequest(promptCaching bool) ChatRequest {
+	return ChatRequest{
+		Model:         "claude-sonnet-4-5-20250929",
+		PromptCaching: promptCaching,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: "You are a contract reviewer."},
+			{Role: "user", Content: "Here is the contract:\n" + strings.Repeat("The party of the first part agrees. ", 200)},
+			{Role: "assistant", Content: "Understood."},
+			{Role: "user", Content: "Summarize clause 3."},
+		},
+	}
+}
+
+func TestPromptCachingMarksSystemAndLongContext(t *testing.T) {
+	converted := (&AnthropicProvider{}).convertRequest(cachingRequest(true))
+
+	if len(converted.System) != 1 || converted.System[0].CacheControl == nil || converted.System[0].CacheControl.Type != "ephemeral" {
+		t.Errorf("expected an ephemeral breakpoint on the system prompt, got %+v", converted.System)
+	}
+	var marked []int
+	for i, msg := range converted.Messages {
+		for _, block := range msg.Content {
+			if block.CacheControl != nil {
+				marked = append(marked, i)
+			}
+		}
+	}
+	if len(marked) != 1 || marked[0] != 0 {
+		t.Errorf("expected only the long context message marked, got messages %v", marked)
+	}
+
+	body, err := json.Marshal(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(body), `"cache_control":{"type":"ephemeral"}`); got != 2 {
+		t.Errorf("expected 2 cache_control breakpoints in the request, got %d", got)
+	}
+}
+
+func TestPromptCachingOffLeavesRequestUnmarked(t *testing.T) {
+	body, err := json.Marshal((&AnthropicProvider{}).convertRequest(cachingRequest(false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "cache_control") {
+		t.Errorf("request without prompt caching has breakpoints: %s", body)
+	}
+}
+
+func TestAnthropicParsesPromptCacheUsage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929",
+			"content":[{"type":"text","text":"Clause 3 limits liability."}],"stop_reason":"end_turn",
+			"usage":{"input_tokens":20,"cache_creation_input_tokens":300,"cache_read_input_tokens":1500,"output_tokens":8}}`)
+	}))
+	defer srv.Close()
+
+	resp, err := newAnthropicProvider("test", srv.URL, http.DefaultTransport).ChatCompletion(context.Background(), cachingRequest(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Usage.PromptTokens != 1820 || resp.Usage.CompletionTokens != 8 || resp.Usage.TotalTokens != 1828 {
+		t.Errorf("usage = %+v, want 1820 prompt tokens including the cache", resp.Usage)
+	}
+	if resp.Usage.PromptTokensDetails == nil || resp.Usage.PromptTokensDetails.CachedTokens != 1500 {
+		t.Errorf("cached tokens = %+v, want 1500", resp.Usage.PromptTokensDetails)
+	}
+	if resp.CacheWriteTokens != 300 {
+		t.Errorf("cache write tokens = %d, want 300", resp.CacheWriteTokens)
+	}
+}
+
+func TestMetadataForwardsOnlyTheUserID(t *testing.T) {
+	req := cachingRequest(false)
+	req.Metadata = map[string]string{"team": "search", "user_id": "user-42"}
+	body, err := json.Marshal((&AnthropicProvider{}).convertRequest(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"metadata":{"user_id":"user-42"}`) || strings.Contains(string(body), "search") {
+		t.Errorf("expected only user_id forwarded, got %s", body)
+	}
+
+	// Tags without a user ID send no metadata, which Anthropic would reject
+	req.Metadata = map[string]string{"team": "search"}
+	if body, _ := json.Marshal((&AnthropicProvider{}).convertRequest(req)); strings.Contains(string(body), "metadata") {
+		t.Errorf("expected no metadata, got %s", body)
+	}
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTranscriptionNotSupported is returned by providers without a transcription API
+var ErrTranscriptionNotSupported = errors.New("audio transcription is not supported by this provider")
+
+// TranscriptionRequest is an audio transcription request. The audio is held in
+// memory so a failed upload can be retried against another region.
+type TranscriptionRequest struct {
+	Model       string
+	Audio       []byte
+	FileName    string // original upload name; its extension tells the provider the format
+	Prompt      string
+	Language    string
+	Temperature float32
+
+	// OpenAI organization to bill, from the OpenAI-Organization header or key config
+	Organization string
+}
+
+// TranscriptionResponse is the transcribed text. Duration is 0 when the model
+// doesn't report it.
+type TranscriptionResponse struct {
+	Text      string                 `json:"text"`
+	Language  string                 `json:"language,omitempty"`
+	Duration  float64                `json:"duration,omitempty"` // seconds of audio
+	Segments  []TranscriptionSegment `json:"segments,omitempty"`
+	Usage     *TranscriptionUsage    `json:"usage,omitempty"` // token-billed models
+	LatencyMs int                    `json:"-"`
+}
+
+// TranscriptionUsage is the token usage of a token-billed transcription model
+type TranscriptionUsage struct {
+	Type         string `json:"type"` // "tokens"
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	TotalTokens  int    `json:"total_tokens"`
+}
+
+// TranscriptionSegment is a timed span of the transcript
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// noTranscription is embedded by providers that have no transcription API
+type noTranscription struct{}
+
+// Transcribe always fails with ErrTranscriptionNotSupported
+func (noTranscription) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	return nil, ErrTranscriptionNotSupported
+}
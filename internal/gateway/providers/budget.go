@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted wraps the last provider error once a request has
+// used up its retry budget
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryBudget caps the provider attempts one call may make across region
+// fallbacks, unknown-model probing and failover, and how long after the first
+// attempt new ones may still start. Zero values are unlimited.
+type RetryBudget struct {
+	MaxAttempts int
+	MaxDuration time.Duration
+}
+
+type retryTrackerKey struct{}
+
+// WithRetryBudget starts a retry budget, e.g. one per request from per-key
+// config. Every manager call made with the returned context draws on it, so
+// follow-up calls (continuations, schema retries) share the request's attempts
+// instead of each getting their own.
+func WithRetryBudget(ctx context.Context, budget RetryBudget) context.Context {
+	return context.WithValue(ctx, retryTrackerKey{}, &retryTracker{budget: budget})
+}
+
+// RetryBudgetFrom returns the budget attached to ctx with WithRetryBudget
+func RetryBudgetFrom(ctx context.Context) (RetryBudget, bool) {
+	tracker, ok := ctx.Value(retryTrackerKey{}).(*retryTracker)
+	if !ok {
+		return RetryBudget{}, false
+	}
+	return tracker.budget, true
+}
+
+// retryTracker counts the attempts made against one budget
+type retryTracker struct {
+	budget RetryBudget
+	start  time.Time // first attempt
+
+	mu       sync.Mutex
+	attempts int
+}
+
+// withRetryTracker returns ctx unchanged if it carries a budget from
+// WithRetryBudget, and otherwise starts one from the manager's default for
+// this call. Region fallbacks inside the call draw on it.
+func (m *Manager) withRetryTracker(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(retryTrackerKey{}).(*retryTracker); ok {
+		return ctx
+	}
+	return WithRetryBudget(ctx, m.retryBudget)
+}
+
+// spendAttempt records an attempt against the context's budget and reports
+// whether it may go ahead. The first attempt is always allowed; contexts
+// without a budget are unlimited.
+func spendAttempt(ctx context.Context) bool {
+	return spendAttempts(ctx, 1)
+}
+
+// spendAttempts records n attempts that start together, e.g. race candidates,
+// if the budget allows all of them, and otherwise records none
+func spendAttempts(ctx context.Context, n int) bool {
+	tracker, ok := ctx.Value(retryTrackerKey{}).(*retryTracker)
+	if !ok {
+		return true
+	}
+	return tracker.spend(n)
+}
+
+func (t *retryTracker) spend(n int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.budget.MaxAttempts > 0 && t.attempts+n > t.budget.MaxAttempts {
+		return false
+	}
+	if t.attempts == 0 {
+		t.start = time.Now()
+	} else if t.budget.MaxDuration > 0 && time.Since(t.start) >= t.budget.MaxDuration {
+		return false
+	}
+	t.attempts += n
+	return true
+}
+
+// exhausted wraps lastErr to say the budget stopped further attempts
+func (t *retryTracker) exhausted(lastErr error) error {
+	t.mu.Lock()
+	attempts := t.attempts
+	t.mu.Unlock()
+	return fmt.Errorf("%w after %d attempts in %s: %w", ErrRetryBudgetExhausted, attempts, time.Since(t.start).Round(time.Millisecond), lastErr)
+}
+
+// budgetExhausted wraps lastErr for the context's budget, or returns it
+// unchanged when there is none
+func budgetExhausted(ctx context.Context, lastErr error) error {
+	tracker, ok := ctx.Value(retryTrackerKey{}).(*retryTracker)
+	if !ok {
+		return lastErr
+	}
+	return tracker.exhausted(lastErr)
+}
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var errOverloaded = &ProviderError{Provider: "Test", StatusCode: http.StatusServiceUnavailable, Body: "overloaded"}
+
+// failingChain builds a manager whose gpt-4o fails over to claude and then
+// gemini, with every provider returning 503
+func failingChain() (*Manager, []*stubProvider) {
+	stubs := []*stubProvider{
+		{name: "openai", reply: failWith(errOverloaded)},
+		{name: "anthropic", reply: failWith(errOverloaded)},
+		{name: "google", reply: failWith(errOverloaded)},
+	}
+	m := newTestManager(stubs...)
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929", "gemini-2.5-pro"}
+	return m, stubs
+}
+
+func totalCalls(stubs []*stubProvider) int {
+	n := 0
+	for _, stub := range stubs {
+		n += len(stub.called())
+	}
+	return n
+}
+
+func TestRetryBudgetStopsFailoverAtMaxAttempts(t *testing.T) {
+	m, stubs := failingChain()
+	ctx := WithRetryBudget(context.Background(), RetryBudget{MaxAttempts: 2})
+
+	_, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	if !errors.Is(err, ErrRetryBudgetExhausted) || !errors.Is(err, errOverloaded) {
+		t.Errorf("expected the exhausted budget wrapping the last error, got %v", err)
+	}
+	if calls := totalCalls(stubs); calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+	if len(stubs[2].called()) != 0 {
+		t.Error("the budget should stop the chain before gemini")
+	}
+}
+
+func TestRetryBudgetStopsFailoverAfterMaxDuration(t *testing.T) {
+	m, stubs := failingChain()
+	stubs[0].reply = func(ChatRequest) (*ChatResponse, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, errOverloaded
+	}
+	ctx := WithRetryBudget(context.Background(), RetryBudget{MaxDuration: 10 * time.Millisecond})
+
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("expected the budget to run out, got %v", err)
+	}
+	if calls := totalCalls(stubs); calls != 1 {
+		t.Errorf("no failover should start after the budget's duration, got %d attempts", calls)
+	}
+}
+
+func TestRetryBudgetIsSharedAcrossCallsInARequest(t *testing.T) {
+	m, stubs := failingChain()
+	ctx := WithRetryBudget(context.Background(), RetryBudget{MaxAttempts: 3})
+
+	m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}) // primary + 2 failovers
+	if calls := totalCalls(stubs); calls != 3 {
+		t.Fatalf("expected the first call to use all 3 attempts, got %d", calls)
+	}
+
+	// A follow-up call (e.g. a continuation) still gets its primary attempt,
+	// but no failover: the request's budget is spent
+	_, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("expected the shared budget to be exhausted, got %v", err)
+	}
+	if calls := totalCalls(stubs); calls != 4 {
+		t.Errorf("expected only the follow-up's primary attempt, got %d attempts in total", calls)
+	}
+}
+
+func TestManagerDefaultBudgetAppliesPerCall(t *testing.T) {
+	m, stubs := failingChain()
+	m.retryBudget = RetryBudget{MaxAttempts: 2}
+
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); !errors.Is(err, ErrRetryBudgetExhausted) {
+			t.Errorf("call %d: expected the default budget to stop failover, got %v", i, err)
+		}
+	}
+	if calls := totalCalls(stubs); calls != 4 {
+		t.Errorf("without a request budget each call gets the default, expected 4 attempts, got %d", calls)
+	}
+}
+
+func TestRetryBudgetFrom(t *testing.T) {
+	if _, ok := RetryBudgetFrom(context.Background()); ok {
+		t.Error("a bare context has no budget")
+	}
+	budget := RetryBudget{MaxAttempts: 3, MaxDuration: time.Second}
+	if got, ok := RetryBudgetFrom(WithRetryBudget(context.Background(), budget)); !ok || got != budget {
+		t.Errorf("got %+v, %v", got, ok)
+	}
+}
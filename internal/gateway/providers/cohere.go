@@ -0,0 +1,501 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// CohereProvider handles Cohere Command API requests
+type CohereProvider struct {
+	noTranscription
+
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// cohereBaseURL is the default Cohere API endpoint
+const cohereBaseURL = "https://api.cohere.com"
+
+// CohereRequest represents a request to Cohere's v2 Chat API
+type CohereRequest struct {
+	Model       string          `json:"model"`
+	Messages    []CohereMessage `json:"messages"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+	P           *float32        `json:"p,omitempty"`
+	Seed        *int            `json:"seed,omitempty"`
+	Stop        []string        `json:"stop_sequences,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Tools       []CohereTool    `json:"tools,omitempty"`
+	ToolChoice  string          `json:"tool_choice,omitempty"` // "REQUIRED" or "NONE"; unset = the model decides
+}
+
+// CohereTool declares a function the model may call
+type CohereTool struct {
+	Type     string         `json:"type"` // "function"
+	Function CohereFunction `json:"function"`
+}
+
+// CohereFunction describes one callable function
+type CohereFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// CohereMessage represents a message in Cohere format; tool calls and
+// results use OpenAI's shape
+type CohereMessage struct {
+	Role       string            `json:"role"`
+	Content    string            `json:"content,omitempty"`
+	ToolCalls  []openai.ToolCall `json:"tool_calls,omitempty"`   // assistant
+	ToolCallID string            `json:"tool_call_id,omitempty"` // tool
+}
+
+// CohereResponse represents a response from Cohere's v2 Chat API
+type CohereResponse struct {
+	ID           string            `json:"id"`
+	FinishReason string            `json:"finish_reason"`
+	Message      CohereResponseMsg `json:"message"`
+	Usage        CohereUsage       `json:"usage"`
+}
+
+// CohereResponseMsg represents the assistant message in a response
+type CohereResponseMsg struct {
+	Role      string               `json:"role"`
+	Content   []CohereContentBlock `json:"content"`
+	ToolCalls []openai.ToolCall    `json:"tool_calls,omitempty"`
+}
+
+// CohereContentBlock represents a content block
+type CohereContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// CohereUsage represents token usage
+type CohereUsage struct {
+	BilledUnits CohereTokens `json:"billed_units"`
+	Tokens      CohereTokens `json:"tokens"`
+}
+
+// CohereTokens represents input/output token counts
+type CohereTokens struct {
+	InputTokens  float64 `json:"input_tokens"`
+	OutputTokens float64 `json:"output_tokens"`
+}
+
+// CohereStreamEvent represents a single SSE event from Cohere
+type CohereStreamEvent struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Index int    `json:"index"` // tool call index, for tool-call-* events
+	Delta struct {
+		Message struct {
+			Role string `json:"role"`
+			// An object on content-delta and tool-call-* events, but empty
+			// arrays on message-start, so decoded per event type
+			Content   json.RawMessage `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"` // one call per event, opened by tool-call-start
+		} `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+		Usage        CohereUsage `json:"usage"`
+	} `json:"delta"`
+}
+
+// NewCohereProvider creates a new Cohere provider
+func NewCohereProvider(apiKey string, transport http.RoundTripper) *CohereProvider {
+	return newCohereProvider(apiKey, cohereBaseURL, transport)
+}
+
+// newCohereProvider creates a Cohere provider for a specific endpoint
+func newCohereProvider(apiKey, baseURL string, transport http.RoundTripper) *CohereProvider {
+	return &CohereProvider{
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		httpClient: newUpstreamClient(upstreamTimeout, transport),
+	}
+}
+
+// ChatCompletion makes a chat completion request to Cohere
+func (p *CohereProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	startTime := time.Now()
+
+	cohereReq := p.convertRequest(req)
+
+	reqBody, _ := json.Marshal(cohereReq)
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v2/chat", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Cohere API error: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, _ := io.ReadAll(httpResp.Body)
+
+	if httpResp.StatusCode != http.StatusOK {
+		if ctxErr := detectContextLengthError("cohere", req.Model, httpResp.StatusCode, string(respBody)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Cohere", StatusCode: httpResp.StatusCode, Body: string(respBody)}
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(httpResp.Header, err)
+		}
+		return nil, err
+	}
+
+	var cohereResp CohereResponse
+	if err := json.Unmarshal(respBody, &cohereResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	latencyMs := int(time.Since(startTime).Milliseconds())
+
+	chatResp := p.convertResponse(cohereResp, req.Model, latencyMs)
+	chatResp.RateLimit = parseUpstreamRateLimit(httpResp.Header)
+	return chatResp, nil
+}
+
+// ChatCompletionStream makes a streaming request
+func (p *CohereProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	cohereReq := p.convertRequest(req)
+	cohereReq.Stream = true
+
+	reqBody, _ := json.Marshal(cohereReq)
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v2/chat", bytes.NewReader(reqBody))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Cohere streaming API error: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		respBody, _ := io.ReadAll(httpResp.Body)
+		if ctxErr := detectContextLengthError("cohere", req.Model, httpResp.StatusCode, string(respBody)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Cohere", StatusCode: httpResp.StatusCode, Body: string(respBody)}
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(httpResp.Header, err)
+		}
+		return nil, err
+	}
+
+	return &CohereStreamReader{
+		reader: bufio.NewReader(httpResp.Body),
+		resp:   httpResp,
+		model:  req.Model,
+	}, nil
+}
+
+// CohereStreamReader wraps the HTTP response for streaming
+type CohereStreamReader struct {
+	reader *bufio.Reader
+	resp   *http.Response
+	model  string
+	id     string
+}
+
+// Recv reads the next streaming chunk
+func (r *CohereStreamReader) Recv() (StreamChunk, error) {
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return StreamChunk{}, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "event:") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		dataStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if dataStr == streamDoneSentinel {
+			return StreamChunk{}, io.EOF
+		}
+
+		var event CohereStreamEvent
+		if err := json.Unmarshal([]byte(dataStr), &event); err != nil {
+			continue
+		}
+
+		chunk := StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+			ID:      r.id,
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   r.model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+		}}
+
+		switch event.Type {
+		case "message-start":
+			r.id = event.ID
+			chunk.ID = event.ID
+			chunk.Choices = []openai.ChatCompletionStreamChoice{
+				{
+					Index: 0,
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						Role: "assistant",
+					},
+				},
+			}
+			return chunk, nil
+
+		case "content-delta":
+			var content struct {
+				Text string `json:"text"`
+			}
+			json.Unmarshal(event.Delta.Message.Content, &content)
+			if text := content.Text; text != "" {
+				chunk.Choices = []openai.ChatCompletionStreamChoice{
+					{
+						Index: 0,
+						Delta: openai.ChatCompletionStreamChoiceDelta{
+							Content: text,
+						},
+					},
+				}
+				return chunk, nil
+			}
+
+		case "tool-call-start", "tool-call-delta":
+			// The start event names the call; its arguments follow in deltas
+			var call openai.ToolCall
+			json.Unmarshal(event.Delta.Message.ToolCalls, &call)
+			index := event.Index
+			delta := openai.ToolCall{
+				Index:    &index,
+				Function: openai.FunctionCall{Arguments: call.Function.Arguments},
+			}
+			if event.Type == "tool-call-start" {
+				delta.ID = call.ID
+				delta.Type = openai.ToolTypeFunction
+				delta.Function.Name = call.Function.Name
+			} else if delta.Function.Arguments == "" {
+				continue
+			}
+			chunk.Choices = []openai.ChatCompletionStreamChoice{
+				{
+					Index: 0,
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						ToolCalls: []openai.ToolCall{delta},
+					},
+				},
+			}
+			return chunk, nil
+
+		case "message-end":
+			chunk.Choices = []openai.ChatCompletionStreamChoice{
+				{
+					Index:        0,
+					Delta:        openai.ChatCompletionStreamChoiceDelta{},
+					FinishReason: convertCohereFinishReason(event.Delta.FinishReason),
+				},
+			}
+			usage := convertCohereUsage(event.Delta.Usage)
+			chunk.Usage = &usage
+			return chunk, nil
+		}
+	}
+}
+
+// RateLimit returns the rate-limit headers Cohere sent with the stream
+func (r *CohereStreamReader) RateLimit() *UpstreamRateLimit {
+	if r.resp == nil {
+		return nil
+	}
+	return parseUpstreamRateLimit(r.resp.Header)
+}
+
+// Close closes the stream
+func (r *CohereStreamReader) Close() error {
+	if r.resp != nil && r.resp.Body != nil {
+		return r.resp.Body.Close()
+	}
+	return nil
+}
+
+// convertRequest converts to Cohere format
+func (p *CohereProvider) convertRequest(req ChatRequest) CohereRequest {
+	cohereReq := CohereRequest{
+		Model:       req.Model,
+		Messages:    make([]CohereMessage, 0, len(req.Messages)),
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		P:           req.TopP,
+		Seed:        req.Seed,
+		Stop:        req.Stop,
+	}
+
+	if len(req.LogitBias) > 0 {
+		log.Printf("Warning: logit_bias is not supported by Cohere, ignoring for model %s", req.Model)
+	}
+	if req.ReasoningEffort != "" {
+		log.Printf("Warning: reasoning_effort is not supported by Cohere, ignoring for model %s", req.Model)
+	}
+
+	// Cohere v2 accepts system, user, assistant and tool roles directly
+	for _, msg := range req.Messages {
+		cohereMsg := CohereMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+		switch msg.Role {
+		case "tool":
+			cohereMsg.ToolCallID = msg.ToolCallID
+		case "function":
+			// Legacy function calls have no id, so the function name links call and result
+			cohereMsg.Role = "tool"
+			cohereMsg.ToolCallID = msg.Name
+		case "assistant":
+			cohereMsg.ToolCalls = msg.ToolCalls
+			if msg.FunctionCall != nil {
+				cohereMsg.ToolCalls = append(cohereMsg.ToolCalls, openai.ToolCall{
+					ID:       msg.FunctionCall.Name,
+					Type:     openai.ToolTypeFunction,
+					Function: *msg.FunctionCall,
+				})
+			}
+		}
+		cohereReq.Messages = append(cohereReq.Messages, cohereMsg)
+	}
+
+	// Cohere can't force one particular function, so a named tool_choice
+	// offers only that function and requires a call
+	mode, name, _ := req.toolChoice()
+	for _, tool := range req.Tools {
+		if mode == toolChoiceFunction && tool.Function.Name != name {
+			continue
+		}
+		cohereReq.Tools = append(cohereReq.Tools, CohereTool{
+			Type: "function",
+			Function: CohereFunction{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  toolParameters(tool.Function),
+			},
+		})
+	}
+	if len(cohereReq.Tools) > 0 {
+		switch mode {
+		case toolChoiceNone:
+			cohereReq.ToolChoice = "NONE"
+		case toolChoiceRequired, toolChoiceFunction:
+			cohereReq.ToolChoice = "REQUIRED"
+		}
+	}
+
+	return cohereReq
+}
+
+// convertResponse converts Cohere response to standard format
+func (p *CohereProvider) convertResponse(resp CohereResponse, model string, latencyMs int) *ChatResponse {
+	var content string
+	for _, block := range resp.Message.Content {
+		if block.Type == "text" {
+			content += block.Text
+		}
+	}
+
+	return &ChatResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index: 0,
+				Message: openai.ChatCompletionMessage{
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: resp.Message.ToolCalls,
+				},
+				FinishReason: convertCohereFinishReason(resp.FinishReason),
+			},
+		},
+		Usage:     convertCohereUsage(resp.Usage),
+		LatencyMs: latencyMs,
+	}
+}
+
+// convertCohereUsage maps Cohere's billed units to OpenAI usage
+func convertCohereUsage(usage CohereUsage) openai.Usage {
+	promptTokens := int(usage.BilledUnits.InputTokens)
+	completionTokens := int(usage.BilledUnits.OutputTokens)
+
+	return openai.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+// convertCohereFinishReason maps Cohere finish reasons to OpenAI's
+func convertCohereFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "MAX_TOKENS":
+		return openai.FinishReasonLength
+	case "TOOL_CALL":
+		return openai.FinishReasonToolCalls
+	default: // COMPLETE, STOP_SEQUENCE, ERROR
+		return openai.FinishReasonStop
+	}
+}
+
+// Warm lists models to open a connection to the API ahead of the first request
+func (p *CohereProvider) Warm(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return warmRequest(p.httpClient, httpReq, "Cohere")
+}
+
+// ValidateModel checks if a model is valid
+func (p *CohereProvider) ValidateModel(model string) bool {
+	validModels := map[string]bool{
+		"command-a-03-2025":      true,
+		"command-r-plus-08-2024": true,
+		"command-r-08-2024":      true,
+		"command-r7b-12-2024":    true,
+		"command-r-plus":         true,
+		"command-r":              true,
+	}
+	return validModels[model]
+}
+
+// GetProviderName returns the provider name
+func (p *CohereProvider) GetProviderName() string {
+	return "cohere"
+}
+
+// Capabilities returns the features supported for this provider
+func (p *CohereProvider) Capabilities() Capabilities {
+	// Message content is sent as text only, and response_format isn't translated
+	return Capabilities{
+		Streaming: true,
+		Tools:     true,
+	}
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fixture reads a recorded upstream payload from testdata
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// cohereUpstream serves body as contentType, checking each request is an
+// authenticated /v2/chat call
+func cohereUpstream(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/chat" || r.Header.Get("Authorization") != "Bearer cohere-test" {
+			t.Errorf("unexpected request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCohereRequestConversion(t *testing.T) {
+	temperature, topP, maxTokens := float32(0.3), float32(0.9), 256
+	req := ChatRequest{
+		Model: "command-r-plus-08-2024",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: "You are a concise assistant."},
+			{Role: "user", Content: "What is the capital of France?"},
+			{Role: "assistant", Content: "Paris."},
+			{Role: "user", Content: "And of Italy?"},
+		},
+		Temperature: &temperature,
+		TopP:        &topP,
+		MaxTokens:   &maxTokens,
+		Stop:        StopSequences{"\n\n"},
+	}
+
+	converted, _ := json.Marshal((&CohereProvider{}).convertRequest(req))
+	var got, want interface{}
+	json.Unmarshal(converted, &got)
+	if err := json.Unmarshal([]byte(fixture(t, "cohere_request.json")), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("converted request\n%s\ndoesn't match the fixture", converted)
+	}
+}
+
+func TestCohereResponseConversion(t *testing.T) {
+	srv := cohereUpstream(t, "application/json", fixture(t, "cohere_response.json"))
+	p := newCohereProvider("cohere-test", srv.URL, http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "command-r-plus-08-2024", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "And of Italy?"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "c14c80c3-18eb-4519-9460-6c92edd8cfb4" || resp.Model != "command-r-plus-08-2024" || resp.Object != "chat.completion" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Role != "assistant" || choice.Message.Content != "The capital of Italy is Rome." || choice.FinishReason != openai.FinishReasonStop {
+		t.Errorf("unexpected choice %+v", choice)
+	}
+	// Usage is what Cohere bills, not the raw token counts
+	if resp.Usage.PromptTokens != 31 || resp.Usage.CompletionTokens != 8 || resp.Usage.TotalTokens != 39 {
+		t.Errorf("expected usage from billed_units, got %+v", resp.Usage)
+	}
+}
+
+func TestCohereStreamConversion(t *testing.T) {
+	srv := cohereUpstream(t, "text/event-stream", fixture(t, "cohere_stream.txt"))
+	p := newCohereProvider("cohere-test", srv.URL, http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), ChatRequest{Model: "command-r-plus-08-2024", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "And of Italy?"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var role, content string
+	var finishReason openai.FinishReason
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.ID != "29f14a5a-11de-4cae-9800-25e4747408ea" || chunk.Object != "chat.completion.chunk" || chunk.Model != "command-r-plus-08-2024" {
+			t.Errorf("unexpected chunk %+v", chunk.ChatCompletionStreamResponse)
+		}
+		for _, choice := range chunk.Choices {
+			role += choice.Delta.Role
+			content += choice.Delta.Content
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+
+	if role != "assistant" || content != "The capital of Italy is Rome." || finishReason != openai.FinishReasonLength {
+		t.Errorf("streamed role %q, content %q, finish_reason %q", role, content, finishReason)
+	}
+	if usage == nil || usage.PromptTokens != 31 || usage.CompletionTokens != 8 || usage.TotalTokens != 39 {
+		t.Errorf("expected usage from billed_units, got %+v", usage)
+	}
+}
+
+func TestCommandModelsRouteToCohere(t *testing.T) {
+	m := newTestManager(&stubProvider{name: "cohere"})
+	for _, model := range []string{"command-r", "command-r-plus-08-2024", "command-a-03-2025"} {
+		if _, providerName, err := m.GetProvider(model); err != nil || providerName != "cohere" {
+			t.Errorf("%s: routed to %q (%v)", model, providerName, err)
+		}
+	}
+}
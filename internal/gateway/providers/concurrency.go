@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrProviderBusy is returned when a provider's concurrency cap stays full for
+// longer than the queue wait. It triggers failover like an upstream 429.
+var ErrProviderBusy = errors.New("provider concurrency limit reached")
+
+// limitedProvider caps the calls in flight to a provider so bursts can't trip
+// its account-wide limits. Streams hold their slot until closed.
+type limitedProvider struct {
+	Provider
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// withConcurrencyLimit wraps a provider with a semaphore of limit slots; calls
+// wait up to wait for a free slot
+func withConcurrencyLimit(provider Provider, limit int, wait time.Duration) Provider {
+	return &limitedProvider{
+		Provider: provider,
+		slots:    make(chan struct{}, limit),
+		wait:     wait,
+	}
+}
+
+// acquire takes a slot, waiting up to p.wait, and returns its release func
+func (p *limitedProvider) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-p.slots }
+
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if p.wait <= 0 {
+		return nil, fmt.Errorf("%s: %w (%d in flight)", p.GetProviderName(), ErrProviderBusy, cap(p.slots))
+	}
+
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: %w (%d in flight)", p.GetProviderName(), ErrProviderBusy, cap(p.slots))
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ChatCompletion makes a chat completion request once a slot is free
+func (p *limitedProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return p.Provider.ChatCompletion(ctx, req)
+}
+
+// ChatCompletionStream opens a stream once a slot is free; the slot is held
+// until the stream is closed
+func (p *limitedProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := p.Provider.ChatCompletionStream(ctx, req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedStream{StreamReader: stream, release: release}, nil
+}
+
+// Transcribe makes a transcription request once a slot is free
+func (p *limitedProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	release, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return p.Provider.Transcribe(ctx, req)
+}
+
+// limitedStream releases its provider slot when closed
+type limitedStream struct {
+	StreamReader
+	release func()
+	once    sync.Once
+}
+
+// Close closes the stream and frees its slot
+func (s *limitedStream) Close() error {
+	err := s.StreamReader.Close()
+	s.once.Do(s.release)
+	return err
+}
+
+// RateLimit passes through the wrapped stream's rate-limit headers
+func (s *limitedStream) RateLimit() *UpstreamRateLimit {
+	if reporter, ok := s.StreamReader.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingReply holds every call until release is closed, signalling entered as each arrives
+func blockingReply(entered chan<- string, release <-chan struct{}) func(ChatRequest) (*ChatResponse, error) {
+	return func(req ChatRequest) (*ChatResponse, error) {
+		entered <- req.Model
+		<-release
+		return stubResponse(req.Model), nil
+	}
+}
+
+// emptyStream ends immediately
+type emptyStream struct{}
+
+func (emptyStream) Recv() (StreamChunk, error) { return StreamChunk{}, io.EOF }
+func (emptyStream) Close() error               { return nil }
+
+func TestRequestBeyondTheCapQueuesForASlot(t *testing.T) {
+	entered, release := make(chan string, 3), make(chan struct{})
+	stub := &stubProvider{name: "openai", reply: blockingReply(entered, release)}
+	m := newTestManager(stub)
+	m.providers["openai"] = withConcurrencyLimit(stub, 2, time.Second)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+			errs <- err
+		}()
+	}
+
+	<-entered
+	<-entered
+	select {
+	case <-entered:
+		t.Fatal("the third request reached the provider past its cap of 2")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Freeing the slots lets the queued request through
+	close(release)
+	select {
+	case <-entered:
+	case <-time.After(time.Second):
+		t.Fatal("the queued request never got a slot")
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected every request served, got %v", err)
+		}
+	}
+	if n := len(stub.called()); n != 3 {
+		t.Errorf("expected 3 calls to the capped provider, got %d", n)
+	}
+}
+
+func TestRequestBeyondTheCapFailsOver(t *testing.T) {
+	entered, release := make(chan string, 1), make(chan struct{})
+	defer close(release)
+	openaiStub := &stubProvider{name: "openai", reply: blockingReply(entered, release)}
+	anthropicStub := &stubProvider{name: "anthropic"}
+	m := newTestManager(openaiStub, anthropicStub)
+	m.providers["openai"] = withConcurrencyLimit(openaiStub, 1, 10*time.Millisecond)
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929"}
+
+	go m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	<-entered
+
+	resp, providerName, failover, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if providerName != "anthropic" || !failover || resp.Model != "claude-sonnet-4-5-20250929" {
+		t.Errorf("expected the second request served by the failover, got %s (failover %t, model %s)", providerName, failover, resp.Model)
+	}
+	if n := len(openaiStub.called()); n != 1 {
+		t.Errorf("expected only the first request to reach the capped provider, got %d", n)
+	}
+}
+
+func TestFullCapWithoutFailoverReturnsBusy(t *testing.T) {
+	entered, release := make(chan string, 1), make(chan struct{})
+	defer close(release)
+	stub := &stubProvider{name: "openai", reply: blockingReply(entered, release)}
+	m := newTestManager(stub)
+	m.providers["openai"] = withConcurrencyLimit(stub, 1, 0)
+
+	go m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	<-entered
+
+	if _, _, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); !errors.Is(err, ErrProviderBusy) {
+		t.Errorf("expected ErrProviderBusy, got %v", err)
+	}
+}
+
+func TestStreamHoldsItsSlotUntilClosed(t *testing.T) {
+	stub := &stubProvider{name: "openai", stream: func(ChatRequest) (StreamReader, error) { return emptyStream{}, nil }}
+	p := withConcurrencyLimit(stub, 1, 0)
+	ctx := context.Background()
+
+	stream, err := p.ChatCompletionStream(ctx, ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); !errors.Is(err, ErrProviderBusy) {
+		t.Errorf("expected the open stream to hold the only slot, got %v", err)
+	}
+
+	stream.Close()
+	stream.Close() // a second close frees nothing more
+	if _, err := p.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Errorf("expected the slot freed on close, got %v", err)
+	}
+	if _, err := p.ChatCompletionStream(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Errorf("expected one slot after a double close, got %v", err)
+	}
+}
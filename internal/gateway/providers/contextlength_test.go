@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// badRequestUpstream returns a provider named name whose upstream fails every
+// call with a 400 carrying body
+func badRequestUpstream(t *testing.T, name, body string) Provider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	switch name {
+	case "openai":
+		return newOpenAIProvider("sk-test", srv.URL, http.DefaultTransport)
+	case "anthropic":
+		return newAnthropicProvider("sk-ant-test", srv.URL, http.DefaultTransport)
+	case "google":
+		return newGeminiProvider("test", srv.URL, http.DefaultTransport)
+	default:
+		return newCohereProvider("test", srv.URL, http.DefaultTransport)
+	}
+}
+
+// Each provider's real context-exceeded response
+var contextExceeded = map[string]struct{ model, body string }{
+	"openai":    {"gpt-4o", `{"error":{"message":"This model's maximum context length is 128000 tokens. However, your messages resulted in 131072 tokens.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`},
+	"anthropic": {"claude-sonnet-4-5-20250929", `{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210345 tokens > 200000 maximum"}}`},
+	"google":    {"gemini-2.5-flash", `{"error":{"code":400,"message":"The input token count (1200000) exceeds the maximum number of tokens allowed (1048576).","status":"INVALID_ARGUMENT"}}`},
+	"cohere":    {"command-r-plus", `{"message":"too many tokens: total number of tokens in the prompt cannot exceed 128000 - received 131072. Try using a shorter prompt, or enabling prompt truncating."}`},
+}
+
+func TestContextExceededMapsToContextLengthError(t *testing.T) {
+	for name, tc := range contextExceeded {
+		p := badRequestUpstream(t, name, tc.body)
+		req := ChatRequest{Model: tc.model, Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "a very long prompt"}}}
+
+		_, err := p.ChatCompletion(context.Background(), req)
+		_, streamErr := p.ChatCompletionStream(context.Background(), req)
+		for call, err := range map[string]error{"completion": err, "stream": streamErr} {
+			var ctxErr *ContextLengthError
+			if !errors.As(err, &ctxErr) {
+				t.Errorf("%s %s: expected a ContextLengthError, got %v", name, call, err)
+				continue
+			}
+			if ctxErr.Provider != name || ctxErr.Model != tc.model {
+				t.Errorf("%s %s: got provider %q, model %q", name, call, ctxErr.Provider, ctxErr.Model)
+			}
+			if isRetryableError(err) {
+				t.Errorf("%s %s: a context length error must not fail over", name, call)
+			}
+			if got := ClassifyError(err); got != ErrorTypeContextLength {
+				t.Errorf("%s %s: classified as %q", name, call, got)
+			}
+		}
+	}
+}
+
+func TestOtherBadRequestsAreNotContextLengthErrors(t *testing.T) {
+	for name, body := range map[string]string{
+		"openai":    `{"error":{"message":"Invalid value for 'temperature'","type":"invalid_request_error","param":"temperature","code":"invalid_value"}}`,
+		"anthropic": `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: field required"}}`,
+		"google":    `{"error":{"code":400,"message":"Invalid JSON payload received.","status":"INVALID_ARGUMENT"}}`,
+		"cohere":    `{"message":"invalid request: message must not be empty"}`,
+	} {
+		p := badRequestUpstream(t, name, body)
+		_, err := p.ChatCompletion(context.Background(), ChatRequest{Model: contextExceeded[name].model})
+		var ctxErr *ContextLengthError
+		if err == nil || errors.As(err, &ctxErr) {
+			t.Errorf("%s: expected a plain provider error, got %v", name, err)
+		}
+	}
+
+	// Only a 400 is a context failure, whatever the message says
+	if err := detectContextLengthError("anthropic", "claude-sonnet-4-5-20250929", http.StatusInternalServerError, "prompt is too long"); err != nil {
+		t.Errorf("a 500 was mapped: %v", err)
+	}
+}
+
+func TestContextLengthErrorDoesNotFailOver(t *testing.T) {
+	tooLong := &ContextLengthError{Provider: "openai", Model: "gpt-4o", Message: "context_length_exceeded"}
+	openaiStub := &stubProvider{name: "openai", reply: failWith(tooLong)}
+	anthropicStub := &stubProvider{name: "anthropic"}
+	m := newTestManager(openaiStub, anthropicStub)
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929"}
+
+	_, _, failoverUsed, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if !errors.Is(err, tooLong) {
+		t.Errorf("expected the context length error, got %v", err)
+	}
+	if failoverUsed || len(anthropicStub.called()) != 0 {
+		t.Errorf("expected no failover, anthropic called %v", anthropicStub.called())
+	}
+}
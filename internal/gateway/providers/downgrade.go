@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleTracker counts upstream 429s per model over a fixed window
+type throttleTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu      sync.Mutex
+	models  map[string]*throttleWindow
+	backoff map[string]time.Time // model -> end of the provider's Retry-After
+}
+
+// throttleWindow is one model's 429 count since start
+type throttleWindow struct {
+	start time.Time
+	count int
+}
+
+// newThrottleTracker creates a tracker that reports a model as throttled after
+// threshold 429s within window
+func newThrottleTracker(threshold int, window time.Duration) *throttleTracker {
+	return &throttleTracker{
+		threshold: threshold,
+		window:    window,
+		models:    make(map[string]*throttleWindow),
+		backoff:   make(map[string]time.Time),
+	}
+}
+
+// record counts a 429 for a model. A provider's Retry-After keeps the model
+// throttled until it elapses, whatever the count.
+func (t *throttleTracker) record(model string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if retryAfter > 0 {
+		t.backoff[model] = now.Add(retryAfter)
+	}
+	w, ok := t.models[model]
+	if !ok || now.Sub(w.start) > t.window {
+		w = &throttleWindow{start: now}
+		t.models[model] = w
+	}
+	w.count++
+}
+
+// throttled reports whether a model has hit the threshold in the current window
+func (t *throttleTracker) throttled(model string) bool {
+	if t.threshold <= 0 {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until, ok := t.backoff[model]; ok {
+		if time.Now().Before(until) {
+			return true
+		}
+		delete(t.backoff, model)
+	}
+
+	w, ok := t.models[model]
+	return ok && time.Since(w.start) <= t.window && w.count >= t.threshold
+}
+
+// isRateLimitError checks if an error is an upstream 429
+func isRateLimitError(err error) bool {
+	var rlErr *RateLimitError
+	if errors.As(err, &rlErr) {
+		return true
+	}
+
+	errStr := err.Error()
+	return strings.Contains(errStr, "429") || strings.Contains(errStr, "rate limit")
+}
+
+// Downgrade returns the cheaper sibling to serve instead of model while model is
+// being rate-limited upstream, or false if no downgrade applies
+func (m *Manager) Downgrade(model string) (string, bool) {
+	sibling, ok := m.downgrades[model]
+	if !ok || !m.throttle.throttled(model) {
+		return "", false
+	}
+	if _, _, err := m.GetProvider(sibling); err != nil {
+		return "", false
+	}
+	return sibling, true
+}
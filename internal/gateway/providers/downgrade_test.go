@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errThrottled = &RateLimitError{Err: errors.New("status 429: rate limit exceeded")}
+
+// throttledManager serves gpt-4o (always 429) with gpt-4o-mini as its sibling,
+// downgrading after threshold 429s a minute
+func throttledManager(threshold int) (*Manager, *stubProvider) {
+	openai := &stubProvider{name: "openai", reply: failWith(errThrottled)}
+	openai.stream = func(ChatRequest) (StreamReader, error) { return nil, errThrottled }
+	m := newTestManager(openai)
+	m.throttle = newThrottleTracker(threshold, time.Minute)
+	m.downgrades = map[string]string{"gpt-4o": "gpt-4o-mini"}
+	return m, openai
+}
+
+func TestSustained429sTriggerDowngrade(t *testing.T) {
+	m, _ := throttledManager(3)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, ok := m.Downgrade("gpt-4o"); ok {
+			t.Fatalf("downgraded after only %d 429s", i)
+		}
+		m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	}
+	if sibling, ok := m.Downgrade("gpt-4o"); !ok || sibling != "gpt-4o-mini" {
+		t.Errorf("expected a downgrade to gpt-4o-mini, got %q, %v", sibling, ok)
+	}
+	if _, ok := m.Downgrade("gpt-4o-mini"); ok {
+		t.Error("a model without a sibling can't be downgraded")
+	}
+}
+
+func TestStreaming429sCountTowardsDowngrade(t *testing.T) {
+	m, _ := throttledManager(2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := m.ChatCompletionStream(ctx, ChatRequest{Model: "gpt-4o", Stream: true}); !errors.Is(err, errThrottled) {
+			t.Fatalf("expected the 429, got %v", err)
+		}
+	}
+	if _, ok := m.Downgrade("gpt-4o"); !ok {
+		t.Error("sustained streaming 429s should trigger the downgrade")
+	}
+}
+
+func TestRetryAfterThrottlesImmediately(t *testing.T) {
+	tracker := newThrottleTracker(5, time.Minute)
+	tracker.record("gpt-4o", 50*time.Millisecond)
+	if !tracker.throttled("gpt-4o") {
+		t.Error("a Retry-After should throttle the model before the threshold")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if tracker.throttled("gpt-4o") {
+		t.Error("the model should recover once Retry-After elapses")
+	}
+}
+
+func TestThrottleWindowExpires(t *testing.T) {
+	tracker := newThrottleTracker(2, 30*time.Millisecond)
+	tracker.record("gpt-4o", 0)
+	tracker.record("gpt-4o", 0)
+	if !tracker.throttled("gpt-4o") {
+		t.Fatal("expected throttled at the threshold")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if tracker.throttled("gpt-4o") {
+		t.Error("429s outside the window shouldn't count")
+	}
+}
+
+func TestDowngradeDisabledWithoutThreshold(t *testing.T) {
+	m, _ := throttledManager(0)
+	for i := 0; i < 10; i++ {
+		m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	}
+	if _, ok := m.Downgrade("gpt-4o"); ok {
+		t.Error("DOWNGRADE_AFTER_429S=0 should disable downgrades")
+	}
+}
@@ -0,0 +1,114 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Error types recorded in gateway_logs.error_type
+const (
+	ErrorTypeRateLimit      = "rate_limit"
+	ErrorTypeTimeout        = "timeout"
+	ErrorTypeContextLength  = "context_length"
+	ErrorTypeContentBlocked = "content_blocked"
+	ErrorTypeAuth           = "auth"
+	ErrorTypeInvalidRequest = "invalid_request"
+	ErrorTypeServer         = "server"
+	ErrorTypeNetwork        = "network"
+	ErrorTypeCanceled       = "canceled"
+	ErrorTypeOther          = "other"
+)
+
+// ProviderError is a non-success HTTP response from a provider's API
+type ProviderError struct {
+	Provider   string // display name, e.g. "Anthropic"
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// ClassifyError returns the error type for a failed provider call, or "" for nil
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var ctxErr *ContextLengthError
+	var blockedErr *ContentBlockedError
+	var rlErr *RateLimitError
+	switch {
+	case errors.As(err, &ctxErr):
+		return ErrorTypeContextLength
+	case errors.As(err, &blockedErr):
+		return ErrorTypeContentBlocked
+	case errors.As(err, &rlErr):
+		return ErrorTypeRateLimit
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorTypeCanceled
+	case errors.Is(err, ErrTranscriptionNotSupported):
+		return ErrorTypeInvalidRequest
+	}
+
+	if status := errorStatusCode(err); status != 0 {
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			return ErrorTypeAuth
+		case status == http.StatusTooManyRequests:
+			return ErrorTypeRateLimit
+		case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+			return ErrorTypeTimeout
+		case status >= 500:
+			return ErrorTypeServer
+		case status >= 400:
+			return ErrorTypeInvalidRequest
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTypeTimeout
+		}
+		return ErrorTypeNetwork
+	}
+
+	// Errors without a typed cause, e.g. from regional or streaming wrappers
+	errStr := strings.ToLower(err.Error())
+	switch {
+	case isRateLimitError(err):
+		return ErrorTypeRateLimit
+	case strings.Contains(errStr, "timeout"):
+		return ErrorTypeTimeout
+	case strings.Contains(errStr, "status 5"):
+		return ErrorTypeServer
+	}
+	return ErrorTypeOther
+}
+
+// errorStatusCode returns the HTTP status of a provider error, or 0 if unknown
+func errorStatusCode(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// timeoutError is a net.Error that timed out, like a dial or read deadline
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyErrorMapsSampleErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no error", nil, ""},
+		{"context length", &ContextLengthError{Provider: "openai", Model: "gpt-4o"}, ErrorTypeContextLength},
+		{"safety block", &ContentBlockedError{Provider: "google", Reason: "SAFETY"}, ErrorTypeContentBlocked},
+		{"upstream 429", newRateLimitError(http.Header{"Retry-After": {"2"}}, &ProviderError{Provider: "Anthropic", StatusCode: 429, Body: "rate_limit_error"}), ErrorTypeRateLimit},
+		{"deadline", fmt.Errorf("all providers failed: %w", context.DeadlineExceeded), ErrorTypeTimeout},
+		{"client went away", context.Canceled, ErrorTypeCanceled},
+		{"no transcription", ErrTranscriptionNotSupported, ErrorTypeInvalidRequest},
+		{"Anthropic 401", &ProviderError{Provider: "Anthropic", StatusCode: 401, Body: "invalid x-api-key"}, ErrorTypeAuth},
+		{"Cohere 403", &ProviderError{Provider: "Cohere", StatusCode: 403}, ErrorTypeAuth},
+		{"Gemini 400", &ProviderError{Provider: "Gemini", StatusCode: 400, Body: "Invalid JSON payload"}, ErrorTypeInvalidRequest},
+		{"Gemini 503", &ProviderError{Provider: "Gemini", StatusCode: 503, Body: "overloaded"}, ErrorTypeServer},
+		{"upstream 504", &ProviderError{Provider: "Cohere", StatusCode: 504}, ErrorTypeTimeout},
+		{"OpenAI 500", &openai.APIError{HTTPStatusCode: 500, Message: "server error"}, ErrorTypeServer},
+		{"OpenAI 429 without headers", &openai.APIError{HTTPStatusCode: 429, Message: "Rate limit reached"}, ErrorTypeRateLimit},
+		{"OpenAI bad gateway body", &openai.RequestError{HTTPStatusCode: 502, Err: errors.New("bad gateway")}, ErrorTypeServer},
+		{"wrapped provider error", fmt.Errorf("region us-east: %w", &ProviderError{Provider: "Anthropic", StatusCode: 529}), ErrorTypeServer},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, ErrorTypeNetwork},
+		{"read timeout", &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, ErrorTypeTimeout},
+		{"untyped 5xx", errors.New("stream error: status 502"), ErrorTypeServer},
+		{"untyped timeout", errors.New("upstream timeout waiting for headers"), ErrorTypeTimeout},
+		{"anything else", errors.New("unexpected EOF"), ErrorTypeOther},
+	} {
+		if got := ClassifyError(tc.err); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
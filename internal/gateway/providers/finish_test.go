@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestProviderFinishReasonMappings(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		convert  func(string) openai.FinishReason
+		reasons  map[string]openai.FinishReason
+	}{
+		{"anthropic", convertAnthropicStopReason, map[string]openai.FinishReason{
+			"end_turn":      openai.FinishReasonStop,
+			"stop_sequence": openai.FinishReasonStop,
+			"max_tokens":    openai.FinishReasonLength,
+			"tool_use":      openai.FinishReasonToolCalls,
+			"refusal":       openai.FinishReasonContentFilter,
+		}},
+		{"gemini", convertGeminiFinishReason, map[string]openai.FinishReason{
+			"STOP":               openai.FinishReasonStop,
+			"OTHER":              openai.FinishReasonStop,
+			"MAX_TOKENS":         openai.FinishReasonLength,
+			"SAFETY":             openai.FinishReasonContentFilter,
+			"RECITATION":         openai.FinishReasonContentFilter,
+			"BLOCKLIST":          openai.FinishReasonContentFilter,
+			"PROHIBITED_CONTENT": openai.FinishReasonContentFilter,
+			"SPII":               openai.FinishReasonContentFilter,
+		}},
+		{"cohere", convertCohereFinishReason, map[string]openai.FinishReason{
+			"COMPLETE":      openai.FinishReasonStop,
+			"STOP_SEQUENCE": openai.FinishReasonStop,
+			"MAX_TOKENS":    openai.FinishReasonLength,
+			"TOOL_CALL":     openai.FinishReasonToolCalls,
+		}},
+	} {
+		for reason, want := range tc.reasons {
+			if got := tc.convert(reason); got != want {
+				t.Errorf("%s %s: mapped to %q, want %q", tc.provider, reason, got, want)
+			}
+		}
+	}
+}
+
+func TestGeminiResponseFinishReasons(t *testing.T) {
+	p := newGeminiProvider("test", "http://unused", http.DefaultTransport)
+	for _, tc := range []struct {
+		name   string
+		reason string
+		part   GeminiPart
+		want   openai.FinishReason
+	}{
+		{"truncated", "MAX_TOKENS", GeminiPart{Text: "Once upon"}, openai.FinishReasonLength},
+		{"blocked", "SAFETY", GeminiPart{}, openai.FinishReasonContentFilter},
+		{"function call", "STOP", GeminiPart{FunctionCall: &GeminiFunctionCall{Name: "get_weather", Args: json.RawMessage(`{"city":"Paris"}`)}}, openai.FinishReasonToolCalls},
+		{"done", "STOP", GeminiPart{Text: "Sunny."}, openai.FinishReasonStop},
+	} {
+		resp := GeminiResponse{Candidates: []GeminiCandidate{{Content: GeminiContent{Role: "model", Parts: []GeminiPart{tc.part}}, FinishReason: tc.reason}}}
+		if got := p.convertResponse(resp, "gemini-2.5-flash", 0).Choices[0].FinishReason; got != tc.want {
+			t.Errorf("%s: finish_reason %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStreamFinishReasons(t *testing.T) {
+	anthropicStream := newFakeStream(t, `
+event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Once upon"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}
+
+event: message_stop
+data: {"type":"message_stop"}`)
+	geminiStream := newFakeStream(t, `
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Once upon"}]},"index":0}]}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"SAFETY","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":2,"totalTokenCount":12}}`)
+
+	for _, tc := range []struct {
+		name     string
+		provider Provider
+		model    string
+		want     openai.FinishReason
+	}{
+		{"anthropic", newAnthropicProvider("test", anthropicStream.URL, http.DefaultTransport), "claude-sonnet-4-5-20250929", openai.FinishReasonLength},
+		{"gemini", newGeminiProvider("test", geminiStream.URL, http.DefaultTransport), "gemini-2.5-flash", openai.FinishReasonContentFilter},
+	} {
+		stream, err := tc.provider.ChatCompletionStream(context.Background(), ChatRequest{Model: tc.model})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := streamedToolCalls(t, stream); got != tc.want {
+			t.Errorf("%s: streamed finish_reason %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
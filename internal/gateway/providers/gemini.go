@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -16,14 +17,47 @@ import (
 
 // GeminiProvider handles Google Gemini API requests
 type GeminiProvider struct {
+	noTranscription
+
 	apiKey     string
+	baseURL    string
 	httpClient *http.Client
 }
 
+// geminiBaseURL is the default Gemini API endpoint
+const geminiBaseURL = "https://generativelanguage.googleapis.com"
+
 // GeminiRequest represents a request to Gemini's API
 type GeminiRequest struct {
 	Contents         []GeminiContent         `json:"contents"`
 	GenerationConfig *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	SafetySettings   []SafetySetting         `json:"safetySettings,omitempty"` // unset = Gemini's default thresholds
+	Tools            []GeminiTool            `json:"tools,omitempty"`
+	ToolConfig       *GeminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+// GeminiTool declares the functions the model may call
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// GeminiFunctionDeclaration describes one callable function
+type GeminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// GeminiToolConfig controls function calling
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+// GeminiFunctionCallingConfig sets the mode ("AUTO", "ANY" or "NONE") and,
+// for ANY, optionally the functions the model must choose from
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
 }
 
 // GeminiContent represents content in Gemini format
@@ -34,7 +68,37 @@ type GeminiContent struct {
 
 // GeminiPart represents a part of the content
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *GeminiBlob             `json:"inlineData,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+}
+
+// GeminiBlob is inline media, base64 encoded
+type GeminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// GeminiFileData references media by URI
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// GeminiFunctionCall represents a function call made by the model
+type GeminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// GeminiFunctionResponse represents the result of a function call
+type GeminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
 }
 
 // GeminiGenerationConfig represents generation parameters
@@ -42,19 +106,43 @@ type GeminiGenerationConfig struct {
 	Temperature     *float32 `json:"temperature,omitempty"`
 	TopP            *float32 `json:"topP,omitempty"`
 	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+
+	ThinkingConfig *GeminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// GeminiThinkingConfig sets the thinking token budget (Gemini 2.5 models)
+type GeminiThinkingConfig struct {
+	ThinkingBudget int `json:"thinkingBudget"`
 }
 
 // GeminiResponse represents a response from Gemini API
 type GeminiResponse struct {
-	Candidates    []GeminiCandidate `json:"candidates"`
-	UsageMetadata GeminiUsage       `json:"usageMetadata"`
+	Candidates     []GeminiCandidate     `json:"candidates"`
+	PromptFeedback *GeminiPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  GeminiUsage           `json:"usageMetadata"`
 }
 
 // GeminiCandidate represents a candidate response
 type GeminiCandidate struct {
-	Content      GeminiContent `json:"content"`
-	FinishReason string        `json:"finishReason"`
-	Index        int           `json:"index"`
+	Content       GeminiContent        `json:"content"`
+	FinishReason  string               `json:"finishReason"`
+	Index         int                  `json:"index"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
+}
+
+// GeminiPromptFeedback reports why a prompt was blocked
+type GeminiPromptFeedback struct {
+	BlockReason   string               `json:"blockReason,omitempty"`
+	SafetyRatings []GeminiSafetyRating `json:"safetyRatings,omitempty"`
+}
+
+// GeminiSafetyRating represents a safety rating for a harm category
+type GeminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked,omitempty"`
 }
 
 // GeminiUsage represents token usage
@@ -65,12 +153,16 @@ type GeminiUsage struct {
 }
 
 // NewGeminiProvider creates a new Gemini provider
-func NewGeminiProvider(apiKey string) *GeminiProvider {
+func NewGeminiProvider(apiKey string, transport http.RoundTripper) *GeminiProvider {
+	return newGeminiProvider(apiKey, geminiBaseURL, transport)
+}
+
+// newGeminiProvider creates a Gemini provider for a specific endpoint
+func newGeminiProvider(apiKey, baseURL string, transport http.RoundTripper) *GeminiProvider {
 	return &GeminiProvider{
-		apiKey: apiKey,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		httpClient: newUpstreamClient(upstreamTimeout, transport),
 	}
 }
 
@@ -80,12 +172,12 @@ func (p *GeminiProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*
 
 	geminiReq := p.convertRequest(req)
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		req.Model, p.apiKey)
+	url := fmt.Sprintf("%s/v1beta/models/%s:generateContent", p.baseURL, req.Model)
 
 	reqBody, _ := json.Marshal(geminiReq)
 	httpReq, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
 
 	resp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -96,7 +188,14 @@ func (p *GeminiProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(body))
+		if ctxErr := detectContextLengthError("google", req.Model, resp.StatusCode, string(body)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Gemini", StatusCode: resp.StatusCode, Body: string(body)}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(resp.Header, err)
+		}
+		return nil, err
 	}
 
 	var geminiResp GeminiResponse
@@ -104,21 +203,27 @@ func (p *GeminiProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	if blockedErr := detectGeminiBlock(geminiResp); blockedErr != nil {
+		return nil, blockedErr
+	}
+
 	latencyMs := int(time.Since(startTime).Milliseconds())
 
-	return p.convertResponse(geminiResp, req.Model, latencyMs), nil
+	chatResp := p.convertResponse(geminiResp, req.Model, latencyMs)
+	chatResp.RateLimit = parseUpstreamRateLimit(resp.Header)
+	return chatResp, nil
 }
 
 // ChatCompletionStream makes a streaming request
 func (p *GeminiProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
 	geminiReq := p.convertRequest(req)
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?key=%s&alt=sse",
-		req.Model, p.apiKey)
+	url := fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", p.baseURL, req.Model)
 
 	reqBody, _ := json.Marshal(geminiReq)
 	httpReq, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
 
 	httpResp, err := p.httpClient.Do(httpReq)
 	if err != nil {
@@ -128,7 +233,14 @@ func (p *GeminiProvider) ChatCompletionStream(ctx context.Context, req ChatReque
 	if httpResp.StatusCode != http.StatusOK {
 		defer httpResp.Body.Close()
 		body, _ := io.ReadAll(httpResp.Body)
-		return nil, fmt.Errorf("Gemini API error (status %d): %s", httpResp.StatusCode, string(body))
+		if ctxErr := detectContextLengthError("google", req.Model, httpResp.StatusCode, string(body)); ctxErr != nil {
+			return nil, ctxErr
+		}
+		err := &ProviderError{Provider: "Gemini", StatusCode: httpResp.StatusCode, Body: string(body)}
+		if httpResp.StatusCode == http.StatusTooManyRequests {
+			return nil, newRateLimitError(httpResp.Header, err)
+		}
+		return nil, err
 	}
 
 	return &GeminiStreamReader{
@@ -140,17 +252,33 @@ func (p *GeminiProvider) ChatCompletionStream(ctx context.Context, req ChatReque
 
 // GeminiStreamReader wraps the HTTP response for streaming
 type GeminiStreamReader struct {
-	reader *bufio.Reader
-	resp   *http.Response
-	model  string
+	reader    *bufio.Reader
+	resp      *http.Response
+	model     string
+	toolCalls int // function calls emitted so far
+
+	// Gemini repeats cumulative usage on every chunk; only the latest is kept
+	// and emitted once, in a final usage-only chunk at the end of the stream
+	usage *openai.Usage
+	done  bool // a [DONE] line was read; anything after it is ignored
 }
 
 // Recv reads the next streaming chunk
-func (r *GeminiStreamReader) Recv() (openai.ChatCompletionStreamResponse, error) {
+func (r *GeminiStreamReader) Recv() (StreamChunk, error) {
 	for {
+		if r.done {
+			if r.usage != nil {
+				return r.usageChunk(), nil
+			}
+			return StreamChunk{}, io.EOF
+		}
+
 		line, err := r.reader.ReadString('\n')
+		if err == io.EOF && r.usage != nil {
+			return r.usageChunk(), nil
+		}
 		if err != nil {
-			return openai.ChatCompletionStreamResponse{}, err
+			return StreamChunk{}, err
 		}
 
 		line = strings.TrimSpace(line)
@@ -160,6 +288,10 @@ func (r *GeminiStreamReader) Recv() (openai.ChatCompletionStreamResponse, error)
 
 		if strings.HasPrefix(line, "data: ") {
 			dataStr := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if dataStr == streamDoneSentinel {
+				r.done = true
+				continue
+			}
 
 			var geminiResp GeminiResponse
 			if err := json.Unmarshal([]byte(dataStr), &geminiResp); err != nil {
@@ -167,11 +299,64 @@ func (r *GeminiStreamReader) Recv() (openai.ChatCompletionStreamResponse, error)
 			}
 
 			chunk := r.convertChunkToOpenAI(geminiResp)
-			return chunk, nil
+			return StreamChunk{ChatCompletionStreamResponse: chunk}, nil
 		}
 	}
 }
 
+// usageChunk returns the final usage-only chunk and clears the pending usage
+func (r *GeminiStreamReader) usageChunk() StreamChunk {
+	usage := r.usage
+	r.usage = nil
+	return StreamChunk{ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+		ID:      fmt.Sprintf("gemini-stream-%d", time.Now().UnixNano()),
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   r.model,
+		Choices: []openai.ChatCompletionStreamChoice{},
+		Usage:   usage,
+	}}
+}
+
+// convertFunctionCall converts a streamed Gemini function call to an OpenAI tool call delta
+func (r *GeminiStreamReader) convertFunctionCall(call GeminiFunctionCall) openai.ToolCall {
+	index := r.toolCalls
+	r.toolCalls++
+
+	toolCall := convertGeminiFunctionCall(call, index)
+	toolCall.Index = &index
+	return toolCall
+}
+
+// convertGeminiFunctionCall converts the index'th Gemini function call of a reply
+// to an OpenAI tool call. Gemini doesn't always send call ids, so missing ones
+// are numbered.
+func convertGeminiFunctionCall(call GeminiFunctionCall, index int) openai.ToolCall {
+	id := call.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%d", index)
+	}
+
+	arguments := string(call.Args)
+	if arguments == "" {
+		arguments = "{}"
+	}
+
+	return openai.ToolCall{
+		ID:       id,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: call.Name, Arguments: arguments},
+	}
+}
+
+// RateLimit returns the rate-limit headers Gemini sent with the stream
+func (r *GeminiStreamReader) RateLimit() *UpstreamRateLimit {
+	if r.resp == nil {
+		return nil
+	}
+	return parseUpstreamRateLimit(r.resp.Header)
+}
+
 // Close closes the stream
 func (r *GeminiStreamReader) Close() error {
 	if r.resp != nil && r.resp.Body != nil {
@@ -192,16 +377,20 @@ func (r *GeminiStreamReader) convertChunkToOpenAI(resp GeminiResponse) openai.Ch
 
 	if len(resp.Candidates) > 0 {
 		candidate := resp.Candidates[0]
-		var content string
-		for _, part := range candidate.Content.Parts {
-			content += part.Text
-		}
-
 		choice := openai.ChatCompletionStreamChoice{
 			Index: candidate.Index,
 			Delta: openai.ChatCompletionStreamChoiceDelta{},
 		}
 
+		// Gemini sends each function call whole, so it becomes a single complete delta
+		var content string
+		for _, part := range candidate.Content.Parts {
+			content += part.Text
+			if part.FunctionCall != nil {
+				choice.Delta.ToolCalls = append(choice.Delta.ToolCalls, r.convertFunctionCall(*part.FunctionCall))
+			}
+		}
+
 		if candidate.Content.Role != "" {
 			choice.Delta.Role = "assistant"
 		}
@@ -211,14 +400,17 @@ func (r *GeminiStreamReader) convertChunkToOpenAI(resp GeminiResponse) openai.Ch
 		}
 
 		if candidate.FinishReason != "" {
-			choice.FinishReason = openai.FinishReason("stop")
+			choice.FinishReason = convertGeminiFinishReason(candidate.FinishReason)
+			if r.toolCalls > 0 && choice.FinishReason == openai.FinishReasonStop {
+				choice.FinishReason = openai.FinishReasonToolCalls
+			}
 		}
 
 		chunk.Choices = []openai.ChatCompletionStreamChoice{choice}
 	}
 
 	if resp.UsageMetadata.TotalTokenCount > 0 {
-		chunk.Usage = &openai.Usage{
+		r.usage = &openai.Usage{
 			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
 			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
 			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
@@ -234,39 +426,191 @@ func (p *GeminiProvider) convertRequest(req ChatRequest) GeminiRequest {
 		Contents: make([]GeminiContent, 0),
 	}
 
+	// Gemini keys function responses by name, so remember which call id used which function
+	callNames := make(map[string]string)
+
 	for _, msg := range req.Messages {
-		role := msg.Role
-		if role == "assistant" {
-			role = "model"
-		}
-		if role == "system" {
-			role = "user"
+		switch msg.Role {
+		case "tool", "function":
+			name := msg.Name
+			if name == "" {
+				name = callNames[msg.ToolCallID]
+			}
+			part := GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+				ID:       msg.ToolCallID,
+				Name:     name,
+				Response: functionResponseBody(msg.Content),
+			}}
+
+			// Responses to parallel calls belong in a single content
+			if n := len(geminiReq.Contents); n > 0 && isFunctionResponseContent(geminiReq.Contents[n-1]) {
+				geminiReq.Contents[n-1].Parts = append(geminiReq.Contents[n-1].Parts, part)
+			} else {
+				geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
+					Role:  "user",
+					Parts: []GeminiPart{part},
+				})
+			}
+
+		case "assistant":
+			var parts []GeminiPart
+			if msg.Content != "" {
+				parts = append(parts, GeminiPart{Text: msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				callNames[call.ID] = call.Function.Name
+				parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+					ID:   call.ID,
+					Name: call.Function.Name,
+					Args: toolArguments(call.Function.Arguments),
+				}})
+			}
+			if msg.FunctionCall != nil {
+				parts = append(parts, GeminiPart{FunctionCall: &GeminiFunctionCall{
+					Name: msg.FunctionCall.Name,
+					Args: toolArguments(msg.FunctionCall.Arguments),
+				}})
+			}
+			if len(parts) == 0 {
+				parts = append(parts, GeminiPart{Text: msg.Content})
+			}
+			geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
+				Role:  "model",
+				Parts: parts,
+			})
+
+		default:
+			// Gemini has no system role here, so system prompts are sent as user content
+			geminiReq.Contents = append(geminiReq.Contents, GeminiContent{
+				Role:  "user",
+				Parts: convertUserParts(msg),
+			})
 		}
+	}
 
-		content := GeminiContent{
-			Role:  role,
-			Parts: []GeminiPart{{Text: msg.Content}},
+	if len(req.LogitBias) > 0 {
+		log.Printf("Warning: logit_bias is not supported by Gemini, ignoring for model %s", req.Model)
+	}
+	geminiReq.SafetySettings = req.SafetySettings
+
+	if len(req.Tools) > 0 {
+		var declarations []GeminiFunctionDeclaration
+		for _, tool := range req.Tools {
+			declarations = append(declarations, GeminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  toolParameters(tool.Function),
+			})
+		}
+		geminiReq.Tools = []GeminiTool{{FunctionDeclarations: declarations}}
+	}
+	geminiReq.ToolConfig = convertGeminiToolConfig(req)
+
+	var thinking *GeminiThinkingConfig
+	if budget := req.reasoningBudget(); budget > 0 {
+		if strings.HasPrefix(req.Model, "gemini-2.5-") {
+			thinking = &GeminiThinkingConfig{ThinkingBudget: budget}
+		} else {
+			log.Printf("Warning: reasoning_effort is not supported by this Gemini model, ignoring for model %s", req.Model)
 		}
-		geminiReq.Contents = append(geminiReq.Contents, content)
 	}
 
-	if req.Temperature != nil || req.MaxTokens != nil || req.TopP != nil {
+	if req.Temperature != nil || req.MaxTokens != nil || req.TopP != nil || req.Seed != nil || len(req.Stop) > 0 || thinking != nil {
 		geminiReq.GenerationConfig = &GeminiGenerationConfig{
 			Temperature:     req.Temperature,
 			TopP:            req.TopP,
 			MaxOutputTokens: req.MaxTokens,
+			Seed:            req.Seed,
+			StopSequences:   req.Stop,
+			ThinkingConfig:  thinking,
 		}
 	}
 
 	return geminiReq
 }
 
+// convertGeminiToolConfig maps tool_choice to Gemini's function calling mode,
+// or nil for its default (AUTO)
+func convertGeminiToolConfig(req ChatRequest) *GeminiToolConfig {
+	if len(req.Tools) == 0 {
+		return nil
+	}
+
+	mode, name, _ := req.toolChoice()
+	switch mode {
+	case toolChoiceNone:
+		return &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "NONE"}}
+	case toolChoiceRequired:
+		return &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "ANY"}}
+	case toolChoiceFunction:
+		return &GeminiToolConfig{FunctionCallingConfig: GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{name}}}
+	}
+	return nil
+}
+
+// convertUserParts converts a user message's content, with data URL images
+// inline and other image URLs as file data
+func convertUserParts(msg openai.ChatCompletionMessage) []GeminiPart {
+	if len(msg.MultiContent) == 0 {
+		return []GeminiPart{{Text: msg.Content}}
+	}
+
+	parts := make([]GeminiPart, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		switch {
+		case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			if mediaType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+				parts = append(parts, GeminiPart{InlineData: &GeminiBlob{MimeType: mediaType, Data: data}})
+			} else {
+				parts = append(parts, GeminiPart{FileData: &GeminiFileData{MimeType: imageMediaType(part.ImageURL.URL), FileURI: part.ImageURL.URL}})
+			}
+		case part.Text != "":
+			parts = append(parts, GeminiPart{Text: part.Text})
+		}
+	}
+	return parts
+}
+
+// isFunctionResponseContent reports whether a content holds only function responses
+func isFunctionResponseContent(content GeminiContent) bool {
+	if content.Role != "user" || len(content.Parts) == 0 {
+		return false
+	}
+	for _, part := range content.Parts {
+		if part.FunctionResponse == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// functionResponseBody returns a tool result as a JSON object; Gemini rejects
+// bare strings and arrays, so anything else is wrapped as {"content": ...}
+func functionResponseBody(content string) json.RawMessage {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+
+	wrapped, _ := json.Marshal(map[string]string{"content": content})
+	return wrapped
+}
+
 // convertResponse converts Gemini response to standard format
 func (p *GeminiProvider) convertResponse(resp GeminiResponse, model string, latencyMs int) *ChatResponse {
 	var content string
+	var toolCalls []openai.ToolCall
+	finishReason := openai.FinishReasonStop
 	if len(resp.Candidates) > 0 {
 		for _, part := range resp.Candidates[0].Content.Parts {
 			content += part.Text
+			if part.FunctionCall != nil {
+				toolCalls = append(toolCalls, convertGeminiFunctionCall(*part.FunctionCall, len(toolCalls)))
+			}
+		}
+		finishReason = convertGeminiFinishReason(resp.Candidates[0].FinishReason)
+		if len(toolCalls) > 0 && finishReason == openai.FinishReasonStop {
+			finishReason = openai.FinishReasonToolCalls
 		}
 	}
 
@@ -279,10 +623,11 @@ func (p *GeminiProvider) convertResponse(resp GeminiResponse, model string, late
 			{
 				Index: 0,
 				Message: openai.ChatCompletionMessage{
-					Role:    "assistant",
-					Content: content,
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
 				},
-				FinishReason: "stop",
+				FinishReason: finishReason,
 			},
 		},
 		Usage: openai.Usage{
@@ -294,6 +639,61 @@ func (p *GeminiProvider) convertResponse(resp GeminiResponse, model string, late
 	}
 }
 
+// detectGeminiBlock returns an error if Gemini blocked the prompt or the
+// response for safety reasons, or nil otherwise
+func detectGeminiBlock(resp GeminiResponse) *ContentBlockedError {
+	if len(resp.Candidates) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return &ContentBlockedError{
+			Provider:   "google",
+			Reason:     resp.PromptFeedback.BlockReason,
+			Categories: flaggedGeminiCategories(resp.PromptFeedback.SafetyRatings),
+		}
+	}
+
+	if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason == "SAFETY" {
+		return &ContentBlockedError{
+			Provider:   "google",
+			Reason:     "SAFETY",
+			Categories: flaggedGeminiCategories(resp.Candidates[0].SafetyRatings),
+		}
+	}
+
+	return nil
+}
+
+// flaggedGeminiCategories returns the harm categories that were blocked or rated MEDIUM/HIGH
+func flaggedGeminiCategories(ratings []GeminiSafetyRating) []string {
+	var categories []string
+	for _, rating := range ratings {
+		if rating.Blocked || rating.Probability == "MEDIUM" || rating.Probability == "HIGH" {
+			categories = append(categories, rating.Category)
+		}
+	}
+	return categories
+}
+
+// convertGeminiFinishReason maps Gemini finish reasons to OpenAI finish reasons
+func convertGeminiFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "MAX_TOKENS":
+		return openai.FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return openai.FinishReasonContentFilter
+	default: // STOP, FINISH_REASON_UNSPECIFIED, OTHER
+		return openai.FinishReasonStop
+	}
+}
+
+// Warm lists models to open a connection to the API ahead of the first request
+func (p *GeminiProvider) Warm(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/v1beta/models", nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+	return warmRequest(p.httpClient, httpReq, "Gemini")
+}
+
 // ValidateModel checks if a model is valid
 func (p *GeminiProvider) ValidateModel(model string) bool {
 	validModels := map[string]bool{
@@ -309,3 +709,13 @@ func (p *GeminiProvider) ValidateModel(model string) bool {
 func (p *GeminiProvider) GetProviderName() string {
 	return "google"
 }
+
+// Capabilities returns the features supported for this provider
+func (p *GeminiProvider) Capabilities() Capabilities {
+	// response_format isn't translated to responseMimeType, so no JSON mode
+	return Capabilities{
+		Streaming: true,
+		Tools:     true,
+		Vision:    true,
+	}
+}
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// geminiUpstream answers every generateContent call with body
+func geminiUpstream(t *testing.T, body string) *GeminiProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return newGeminiProvider("test", srv.URL, http.DefaultTransport)
+}
+
+func TestGeminiBlockedResponsesReturnContentBlocked(t *testing.T) {
+	for _, tc := range []struct {
+		fixture    string
+		reason     string
+		categories string
+	}{
+		{"gemini_blocked_prompt.json", "SAFETY", "HARM_CATEGORY_HARASSMENT"},
+		{"gemini_blocked_response.json", "SAFETY", "HARM_CATEGORY_DANGEROUS_CONTENT"},
+	} {
+		p := geminiUpstream(t, fixture(t, tc.fixture))
+		resp, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gemini-2.5-flash"})
+
+		var blockedErr *ContentBlockedError
+		if !errors.As(err, &blockedErr) {
+			t.Errorf("%s: expected a ContentBlockedError, got %+v, %v", tc.fixture, resp, err)
+			continue
+		}
+		if blockedErr.Provider != "google" || blockedErr.Reason != tc.reason || strings.Join(blockedErr.Categories, ",") != tc.categories {
+			t.Errorf("%s: got %+v, want reason %s and categories %s", tc.fixture, blockedErr, tc.reason, tc.categories)
+		}
+		if got := ClassifyError(err); got != ErrorTypeContentBlocked {
+			t.Errorf("%s: classified as %q", tc.fixture, got)
+		}
+	}
+}
+
+func TestGeminiTruncatedResponseIsNotBlocked(t *testing.T) {
+	p := geminiUpstream(t, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Once upon"}]},"finishReason":"MAX_TOKENS","index":0}]}`)
+	resp, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gemini-2.5-flash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "Once upon" {
+		t.Errorf("content = %q", resp.Choices[0].Message.Content)
+	}
+}
+
+// geminiCumulativeUsage is a streamed reply whose every chunk repeats the
+// running usage, as Gemini does
+const geminiCumulativeUsage = `
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"The capital"}]},"index":0}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":2,"totalTokenCount":11}}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":" of France"}]},"index":0}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":4,"totalTokenCount":13}}
+
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":" is Paris."}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":7,"totalTokenCount":16}}`
+
+func TestGeminiStreamReportsFinalCumulativeUsageOnce(t *testing.T) {
+	srv := newFakeStream(t, geminiCumulativeUsage)
+	p := newGeminiProvider("test", srv.URL, http.DefaultTransport)
+	stream, err := p.ChatCompletionStream(context.Background(), ChatRequest{Model: "gemini-2.5-flash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var content strings.Builder
+	var usages []openai.Usage
+	usageLast := false
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		usageLast = chunk.Usage != nil
+		if chunk.Usage != nil {
+			usages = append(usages, *chunk.Usage)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+
+	if content.String() != "The capital of France is Paris." {
+		t.Errorf("content = %q", content.String())
+	}
+	want := openai.Usage{PromptTokens: 9, CompletionTokens: 7, TotalTokens: 16}
+	if len(usages) != 1 || usages[0] != want || !usageLast {
+		t.Errorf("expected one final usage chunk with %+v, got %+v (last %v)", want, usages, usageLast)
+	}
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+)
+
+// upstreamHeadersKey carries the extra headers for a provider's HTTP requests
+type upstreamHeadersKey struct{}
+
+// requestHeadersKey carries the client's safelisted headers for passthrough
+type requestHeadersKey struct{}
+
+// WithRequestHeaders attaches a client's incoming headers to ctx. Only the
+// names safelisted for a provider are forwarded to it.
+func WithRequestHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, requestHeadersKey{}, headers)
+}
+
+// protectedHeaders are never forwarded from clients, even if allowlisted: they
+// carry credentials or billing, or describe the gateway's own request
+var protectedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Host":                true,
+	"X-Api-Key":           true,
+	"X-Goog-Api-Key":      true,
+	"Api-Key":             true,
+	"Openai-Organization": true,
+	"Openai-Project":      true,
+	"Content-Type":        true,
+	"Content-Length":      true,
+	"Content-Encoding":    true,
+	"Transfer-Encoding":   true,
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Upgrade":             true,
+}
+
+// passthroughHeaders returns the client headers a provider may receive:
+// FORWARD_HEADERS plus its PROVIDER_HEADER_PASSTHROUGH entry, minus protected names
+func passthroughHeaders(cfg *config.Config, name string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, header := range append(append([]string{}, cfg.ForwardHeaders...), cfg.PassthroughHeaders[name]...) {
+		header = http.CanonicalHeaderKey(header)
+		if protectedHeaders[header] {
+			log.Printf("Not forwarding client header %s to %s: it is never passed through", header, name)
+			continue
+		}
+		if !seen[header] {
+			seen[header] = true
+			names = append(names, header)
+		}
+	}
+	return names
+}
+
+// headerProvider wraps a provider so its upstream requests carry configured
+// headers, overridden by safelisted client headers
+type headerProvider struct {
+	Provider
+	static      http.Header
+	passthrough []string
+}
+
+// withHeaders wraps a provider with static headers and a passthrough safelist
+func withHeaders(provider Provider, static http.Header, passthrough []string) Provider {
+	if len(static) == 0 && len(passthrough) == 0 {
+		return provider
+	}
+	return &headerProvider{Provider: provider, static: static, passthrough: passthrough}
+}
+
+// ChatCompletion makes a chat completion request with the extra headers
+func (p *headerProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return p.Provider.ChatCompletion(p.withContext(ctx), req)
+}
+
+// ChatCompletionStream opens a stream with the extra headers
+func (p *headerProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	return p.Provider.ChatCompletionStream(p.withContext(ctx), req)
+}
+
+// Transcribe makes a transcription request with the extra headers
+func (p *headerProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	return p.Provider.Transcribe(p.withContext(ctx), req)
+}
+
+// Warm makes the warm-up request with the extra headers
+func (p *headerProvider) Warm(ctx context.Context) error {
+	return p.Provider.Warm(p.withContext(ctx))
+}
+
+// withContext merges the configured headers with the client's safelisted ones
+func (p *headerProvider) withContext(ctx context.Context) context.Context {
+	headers := p.static.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	if incoming, ok := ctx.Value(requestHeadersKey{}).(http.Header); ok {
+		for _, name := range p.passthrough {
+			if values := incoming.Values(name); len(values) > 0 {
+				headers[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+	}
+	return context.WithValue(ctx, upstreamHeadersKey{}, headers)
+}
+
+// headerTransport adds the headers attached by headerProvider to each request
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sets the extra headers on a copy of the request
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if headers, ok := req.Context().Value(upstreamHeadersKey{}).(http.Header); ok && len(headers) > 0 {
+		req = req.Clone(req.Context())
+		for name, values := range headers {
+			req.Header[name] = values
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newUpstreamClient returns the HTTP client used for provider API calls, sending
+// through transport (see newProxyTransport)
+func newUpstreamClient(timeout time.Duration, transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: headerTransport{base: transport},
+	}
+}
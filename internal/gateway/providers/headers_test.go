@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+)
+
+// headerUpstreams starts fake OpenAI and Anthropic APIs that record the headers
+// of each request, and points cfg at them
+func headerUpstreams(t *testing.T, cfg *config.Config) func(provider string) []http.Header {
+	t.Helper()
+	var mu sync.Mutex
+	seen := make(map[string][]http.Header)
+	record := func(provider string, reply string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen[provider] = append(seen[provider], r.Header.Clone())
+			mu.Unlock()
+			if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), `"stream":true`) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, reply)
+		}
+	}
+
+	openaiSrv := httptest.NewServer(record("openai", `{"id":"c","model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	anthropicSrv := httptest.NewServer(record("anthropic", `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":1}}`))
+	t.Cleanup(openaiSrv.Close)
+	t.Cleanup(anthropicSrv.Close)
+
+	cfg.OpenAIAPIKey, cfg.AnthropicAPIKey = "sk-test", "sk-ant-test"
+	cfg.ProviderRegions = map[string][]string{"openai": {openaiSrv.URL + "/v1"}, "anthropic": {anthropicSrv.URL}}
+	return func(provider string) []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen[provider]
+	}
+}
+
+func TestConfiguredBetaHeadersReachTheUpstream(t *testing.T) {
+	cfg := &config.Config{ProviderHeaders: map[string]http.Header{
+		"anthropic": {"Anthropic-Beta": {"prompt-caching-2024-07-31"}},
+		"openai":    {"Openai-Beta": {"assistants=v2"}},
+	}}
+	sent := headerUpstreams(t, cfg)
+	m := NewManager(cfg, nil)
+	ctx := context.Background()
+
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := m.providers["anthropic"].ChatCompletionStream(ctx, ChatRequest{Model: "claude-sonnet-4-5-20250929", Stream: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	anthropic, openaiSent := sent("anthropic"), sent("openai")
+	if len(anthropic) != 2 || len(openaiSent) != 1 {
+		t.Fatalf("expected 2 Anthropic and 1 OpenAI requests, got %d and %d", len(anthropic), len(openaiSent))
+	}
+	for i, h := range anthropic {
+		if h.Get("Anthropic-Beta") != "prompt-caching-2024-07-31" || h.Get("X-Api-Key") != "sk-ant-test" {
+			t.Errorf("Anthropic request %d: headers %v", i, h)
+		}
+		if h.Get("Openai-Beta") != "" {
+			t.Errorf("Anthropic request %d got OpenAI's headers", i)
+		}
+	}
+	if h := openaiSent[0]; h.Get("Openai-Beta") != "assistants=v2" || h.Get("Authorization") != "Bearer sk-test" || h.Get("Anthropic-Beta") != "" {
+		t.Errorf("OpenAI request headers %v", h)
+	}
+}
+
+func TestSafelistedClientHeadersOverrideConfigured(t *testing.T) {
+	cfg := &config.Config{
+		ProviderHeaders:    map[string]http.Header{"anthropic": {"Anthropic-Beta": {"prompt-caching-2024-07-31"}}},
+		PassthroughHeaders: map[string][]string{"anthropic": {"anthropic-beta"}},
+	}
+	sent := headerUpstreams(t, cfg)
+	m := NewManager(cfg, nil)
+
+	incoming := http.Header{}
+	incoming.Set("Anthropic-Beta", "output-128k-2025-02-19")
+	incoming.Set("X-Debug", "1")
+	incoming.Set("Openai-Beta", "assistants=v2")
+	ctx := WithRequestHeaders(context.Background(), incoming)
+
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := sent("anthropic")[0]; h.Get("Anthropic-Beta") != "output-128k-2025-02-19" || h.Get("X-Debug") != "" {
+		t.Errorf("expected only the safelisted header passed through, got %v", h)
+	}
+	// The safelist is per provider
+	if h := sent("openai")[0]; h.Get("Anthropic-Beta") != "" || h.Get("Openai-Beta") != "" {
+		t.Errorf("OpenAI received unlisted client headers: %v", h)
+	}
+
+	// Without the client header, the configured value is sent
+	if _, _, _, err := m.ChatCompletion(WithRequestHeaders(context.Background(), http.Header{}), ChatRequest{Model: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatal(err)
+	}
+	if h := sent("anthropic")[1]; h.Get("Anthropic-Beta") != "prompt-caching-2024-07-31" {
+		t.Errorf("expected the configured beta header, got %v", h)
+	}
+}
+
+func TestForwardHeadersAllowlistSkipsProtectedNames(t *testing.T) {
+	cfg := &config.Config{
+		ForwardHeaders:     []string{"traceparent", "X-Tenant-ID", "Authorization", "host", "X-Api-Key"},
+		PassthroughHeaders: map[string][]string{"anthropic": {"anthropic-beta", "x-tenant-id"}},
+	}
+	if got := passthroughHeaders(cfg, "anthropic"); strings.Join(got, ",") != "Traceparent,X-Tenant-Id,Anthropic-Beta" {
+		t.Errorf("anthropic passthrough %v", got)
+	}
+	if got := passthroughHeaders(cfg, "openai"); strings.Join(got, ",") != "Traceparent,X-Tenant-Id" {
+		t.Errorf("openai passthrough %v", got)
+	}
+
+	sent := headerUpstreams(t, cfg)
+	m := NewManager(cfg, nil)
+
+	incoming := http.Header{}
+	incoming.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set("X-Tenant-Id", "acme")
+	incoming.Set("Authorization", "Bearer llm0-client-key")
+	incoming.Set("X-Api-Key", "client-key")
+	incoming.Set("Cookie", "session=1")
+	incoming.Set("X-Internal-Debug", "1")
+	ctx := WithRequestHeaders(context.Background(), incoming)
+
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for provider, auth := range map[string][2]string{
+		"openai":    {"Authorization", "Bearer sk-test"},
+		"anthropic": {"X-Api-Key", "sk-ant-test"},
+	} {
+		h := sent(provider)[0]
+		if h.Get("Traceparent") != incoming.Get("Traceparent") || h.Get("X-Tenant-Id") != "acme" {
+			t.Errorf("%s: allowlisted headers not forwarded: %v", provider, h)
+		}
+		if h.Get("X-Internal-Debug") != "" || h.Get("Cookie") != "" {
+			t.Errorf("%s: unlisted client headers forwarded: %v", provider, h)
+		}
+		if h.Get(auth[0]) != auth[1] {
+			t.Errorf("%s: expected the gateway's %s, got %q", provider, auth[0], h.Get(auth[0]))
+		}
+	}
+	if h := sent("openai")[0]; h.Get("X-Api-Key") != "" {
+		t.Errorf("client X-Api-Key reached OpenAI: %v", h)
+	}
+	if h := sent("anthropic")[0]; h.Get("Authorization") != "" {
+		t.Errorf("client Authorization reached Anthropic: %v", h)
+	}
+}
@@ -0,0 +1,36 @@
+package providers
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// parseDataURL splits a base64 data URL ("data:image/png;base64,...") into
+// its media type and payload
+func parseDataURL(dataURL string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(dataURL, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(header, ";base64")
+	if !found || mediaType == "" {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
+
+// imageMediaType guesses an image URL's media type from its extension, or "" if unknown
+func imageMediaType(imageURL string) string {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return ""
+	}
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(parsed.Path)), ";")
+	return mediaType
+}
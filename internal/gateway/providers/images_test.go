@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func imageMessage(url string) ChatRequest {
+	return ChatRequest{Model: "m", Messages: []openai.ChatCompletionMessage{{
+		Role: "user",
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "What is this?"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: url}},
+		},
+	}}}
+}
+
+func TestParseDataURL(t *testing.T) {
+	mediaType, data, ok := parseDataURL("data:image/png;base64,iVBORw0KGgo=")
+	if !ok || mediaType != "image/png" || data != "iVBORw0KGgo=" {
+		t.Errorf("got %q, %q, %v", mediaType, data, ok)
+	}
+	for _, url := range []string{"https://example.com/cat.png", "data:image/png,raw", "data:;base64,AAAA", "data:image/png;base64"} {
+		if _, _, ok := parseDataURL(url); ok {
+			t.Errorf("%q parsed as a base64 data URL", url)
+		}
+	}
+}
+
+func TestAnthropicSendsImageParts(t *testing.T) {
+	p := &AnthropicProvider{}
+
+	blocks := p.convertRequest(imageMessage("data:image/png;base64,iVBORw0KGgo=")).Messages[0].Content
+	if len(blocks) != 2 || blocks[0].Type != "text" || blocks[0].Text != "What is this?" {
+		t.Fatalf("got %+v", blocks)
+	}
+	if src := blocks[1].Source; blocks[1].Type != "image" || src == nil || *src != (AnthropicImageSource{Type: "base64", MediaType: "image/png", Data: "iVBORw0KGgo="}) {
+		t.Errorf("inline image sent as %+v", blocks[1])
+	}
+
+	blocks = p.convertRequest(imageMessage("https://example.com/cat.jpg")).Messages[0].Content
+	if src := blocks[1].Source; src == nil || *src != (AnthropicImageSource{Type: "url", URL: "https://example.com/cat.jpg"}) {
+		t.Errorf("image URL sent as %+v", blocks[1])
+	}
+}
+
+func TestGeminiSendsImageParts(t *testing.T) {
+	p := &GeminiProvider{}
+
+	parts := p.convertRequest(imageMessage("data:image/webp;base64,UklGRg==")).Contents[0].Parts
+	if len(parts) != 2 || parts[0].Text != "What is this?" {
+		t.Fatalf("got %+v", parts)
+	}
+	if blob := parts[1].InlineData; blob == nil || *blob != (GeminiBlob{MimeType: "image/webp", Data: "UklGRg=="}) {
+		t.Errorf("inline image sent as %+v", parts[1])
+	}
+
+	parts = p.convertRequest(imageMessage("https://example.com/cat.jpg?size=large")).Contents[0].Parts
+	if file := parts[1].FileData; file == nil || *file != (GeminiFileData{MimeType: "image/jpeg", FileURI: "https://example.com/cat.jpg?size=large"}) {
+		t.Errorf("image URL sent as %+v", parts[1])
+	}
+}
+
+func TestPlainMessagesStayText(t *testing.T) {
+	req := ChatRequest{Model: "m", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}}
+	if blocks := (&AnthropicProvider{}).convertRequest(req).Messages[0].Content; len(blocks) != 1 || blocks[0].Text != "Hi" || blocks[0].Source != nil {
+		t.Errorf("anthropic: %+v", blocks)
+	}
+	if parts := (&GeminiProvider{}).convertRequest(req).Contents[0].Parts; len(parts) != 1 || parts[0].Text != "Hi" || parts[0].InlineData != nil {
+		t.Errorf("gemini: %+v", parts)
+	}
+}
@@ -2,8 +2,13 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"path"
 	"strings"
+	"sync"
 
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
 )
@@ -12,24 +17,91 @@ import (
 type Manager struct {
 	providers map[string]Provider
 	failover  map[string][]string // model -> [fallback models]
+	routes    []config.RoutingRule
+	tierRules []config.TierRule
+
+	// Automatic downgrade while a model is rate-limited upstream
+	downgrades map[string]string
+	throttle   *throttleTracker
+
+	// Providers tried in order for unrecognised models, and which one accepted each
+	unknownOrder []string
+	learnedMu    sync.RWMutex
+	learned      map[string]string
+
+	// Default cap on attempts per call, overridable with WithRetryBudget
+	retryBudget RetryBudget
+}
+
+// modelTiers groups roughly equivalent models across providers. A model with no
+// explicit failover chain falls back to the first model of its tier on each other provider.
+var modelTiers = map[string][]string{
+	"flagship": {
+		"gpt-4o", "claude-sonnet-4-5-20250929", "gemini-2.5-pro", "command-a-03-2025",
+		"gpt-4", "gpt-4-turbo", "claude-opus-4-5-20251101", "command-r-plus-08-2024", "command-r-plus",
+	},
+	"fast": {
+		"gpt-4o-mini", "claude-haiku-4-5-20251001", "gemini-2.5-flash", "command-r-08-2024",
+		"gpt-3.5-turbo", "command-r7b-12-2024", "command-r",
+	},
 }
 
-// NewManager creates a new provider manager
-func NewManager(cfg *config.Config) *Manager {
+// NewManager creates a new provider manager. latency stores per-region latency
+// for providers configured with several regions and may be nil.
+func NewManager(cfg *config.Config, latency LatencyStore) *Manager {
 	m := &Manager{
-		providers: make(map[string]Provider),
-		failover:  make(map[string][]string),
+		providers:  make(map[string]Provider),
+		failover:   make(map[string][]string),
+		routes:     cfg.RoutingRules,
+		tierRules:  cfg.ModelTiers,
+		downgrades: cfg.ModelDowngrades,
+		throttle:   newThrottleTracker(cfg.DowngradeAfter429s, cfg.DowngradeWindow),
+
+		unknownOrder: cfg.UnknownModelProviders,
+		learned:      make(map[string]string),
+
+		retryBudget: RetryBudget{MaxAttempts: cfg.RetryMaxAttempts, MaxDuration: cfg.RetryMaxDuration},
 	}
 
 	// Initialize providers based on available API keys
 	if cfg.OpenAIAPIKey != "" {
-		m.providers["openai"] = NewOpenAIProvider(cfg.OpenAIAPIKey)
+		m.providers["openai"] = NewOpenAIProvider(cfg.OpenAIAPIKey, providerTransport(cfg, "openai"))
 	}
 	if cfg.AnthropicAPIKey != "" {
-		m.providers["anthropic"] = NewAnthropicProvider(cfg.AnthropicAPIKey)
+		m.providers["anthropic"] = NewAnthropicProvider(cfg.AnthropicAPIKey, providerTransport(cfg, "anthropic"))
 	}
 	if cfg.GeminiAPIKey != "" {
-		m.providers["google"] = NewGeminiProvider(cfg.GeminiAPIKey)
+		m.providers["google"] = NewGeminiProvider(cfg.GeminiAPIKey, providerTransport(cfg, "google"))
+	}
+	if cfg.CohereAPIKey != "" {
+		m.providers["cohere"] = NewCohereProvider(cfg.CohereAPIKey, providerTransport(cfg, "cohere"))
+	}
+
+	// Spread providers with regional endpoints across their regions
+	for name, baseURLs := range cfg.ProviderRegions {
+		if _, ok := m.providers[name]; !ok || len(baseURLs) == 0 {
+			continue
+		}
+		m.providers[name] = newRegionalProvider(name, baseURLs, latency, regionFactory(name, cfg))
+		log.Printf("Provider %s using %d regions", name, len(baseURLs))
+	}
+
+	// Cap calls in flight per provider, across all of its regions
+	for name, limit := range cfg.ProviderConcurrency {
+		if provider, ok := m.providers[name]; ok && limit > 0 {
+			m.providers[name] = withConcurrencyLimit(provider, limit, cfg.ProviderQueueWait)
+			log.Printf("Provider %s limited to %d concurrent requests", name, limit)
+		}
+	}
+
+	// Add configured and passed-through headers to upstream requests
+	for name, provider := range m.providers {
+		m.providers[name] = withHeaders(provider, cfg.ProviderHeaders[name], passthroughHeaders(cfg, name))
+	}
+
+	// Trace every upstream call
+	for name, provider := range m.providers {
+		m.providers[name] = withTracing(provider)
 	}
 
 	// Setup failover chains
@@ -38,6 +110,23 @@ func NewManager(cfg *config.Config) *Manager {
 	return m
 }
 
+// regionFactory returns a constructor for the named provider at a given base URL
+func regionFactory(name string, cfg *config.Config) func(baseURL string) Provider {
+	transport := providerTransport(cfg, name) // regions share one connection pool
+	return func(baseURL string) Provider {
+		switch name {
+		case "openai":
+			return newOpenAIProvider(cfg.OpenAIAPIKey, baseURL, transport)
+		case "anthropic":
+			return newAnthropicProvider(cfg.AnthropicAPIKey, baseURL, transport)
+		case "google":
+			return newGeminiProvider(cfg.GeminiAPIKey, baseURL, transport)
+		default: // cohere
+			return newCohereProvider(cfg.CohereAPIKey, baseURL, transport)
+		}
+	}
+}
+
 // setupFailoverChains defines which models to fall back to
 func (m *Manager) setupFailoverChains() {
 	// OpenAI failover chains
@@ -52,6 +141,11 @@ func (m *Manager) setupFailoverChains() {
 	// Gemini failover chains
 	m.failover["gemini-2.5-flash"] = []string{"gpt-4o-mini", "claude-haiku-4-5-20251001"}
 	m.failover["gemini-2.5-pro"] = []string{"gpt-4o", "claude-sonnet-4-5-20250929"}
+
+	// Cohere failover chains
+	m.failover["command-a-03-2025"] = []string{"gpt-4o", "claude-sonnet-4-5-20250929"}
+	m.failover["command-r-plus-08-2024"] = []string{"gpt-4o", "claude-sonnet-4-5-20250929"}
+	m.failover["command-r-08-2024"] = []string{"gpt-4o-mini", "claude-haiku-4-5-20251001"}
 }
 
 // GetProvider returns the provider for a given model
@@ -70,9 +164,36 @@ func (m *Manager) GetProvider(model string) (Provider, string, error) {
 	return provider, providerName, nil
 }
 
+// Providers returns the configured providers by name
+func (m *Manager) Providers() map[string]Provider {
+	providers := make(map[string]Provider, len(m.providers))
+	for name, provider := range m.providers {
+		providers[name] = provider
+	}
+	return providers
+}
+
+// Capabilities returns the capabilities of each configured provider
+func (m *Manager) Capabilities() map[string]Capabilities {
+	caps := make(map[string]Capabilities, len(m.providers))
+	for name, provider := range m.providers {
+		caps[name] = provider.Capabilities()
+	}
+	return caps
+}
+
+// DetectProvider returns the provider name a model routes to, or "" if unknown
+func (m *Manager) DetectProvider(model string) string {
+	return m.detectProvider(model)
+}
+
 // detectProvider determines which provider a model belongs to
 func (m *Manager) detectProvider(model string) string {
-	if strings.HasPrefix(model, "gpt-") {
+	if providerName := m.routeProvider(model); providerName != "" {
+		return providerName
+	}
+
+	if strings.HasPrefix(model, "gpt-") || strings.HasPrefix(model, "whisper-") {
 		return "openai"
 	}
 	if strings.HasPrefix(model, "claude-") {
@@ -81,6 +202,98 @@ func (m *Manager) detectProvider(model string) string {
 	if strings.HasPrefix(model, "gemini-") {
 		return "google"
 	}
+	if strings.HasPrefix(model, "command-") {
+		return "cohere"
+	}
+	return m.learnedProvider(model)
+}
+
+// learnedProvider returns the provider that accepted an unrecognised model, or ""
+func (m *Manager) learnedProvider(model string) string {
+	m.learnedMu.RLock()
+	defer m.learnedMu.RUnlock()
+	return m.learned[model]
+}
+
+// probeUnknownModel tries an unrecognised model on each UNKNOWN_MODEL_PROVIDERS
+// entry in order (those whose ValidateModel accepts it first) until call
+// succeeds. The accepting provider is remembered, so later requests for the
+// model - streams and pricing lookups included - route straight to it.
+func (m *Manager) probeUnknownModel(ctx context.Context, model string, call func(Provider) error) (string, error) {
+	var accepting, others []string
+	for _, name := range m.unknownOrder {
+		provider, ok := m.providers[name]
+		switch {
+		case !ok:
+			continue
+		case provider.ValidateModel(model):
+			accepting = append(accepting, name)
+		default:
+			others = append(others, name)
+		}
+	}
+	candidates := append(accepting, others...)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("unknown model: %s", model)
+	}
+
+	var lastErr error
+	for _, name := range candidates {
+		if !spendAttempt(ctx) {
+			return "", budgetExhausted(ctx, lastErr)
+		}
+		err := call(m.providers[name])
+		if err == nil {
+			m.learnedMu.Lock()
+			m.learned[model] = name
+			m.learnedMu.Unlock()
+			log.Printf("Unknown model %s accepted by %s", model, name)
+			return name, nil
+		}
+		if ctx.Err() != nil || !isModelRejection(err) {
+			// The provider took the model but the request itself failed
+			return name, err
+		}
+		lastErr = err
+	}
+	return "", fmt.Errorf("unknown model %s: no provider accepted it: %w", model, lastErr)
+}
+
+// isModelRejection reports whether err says the provider doesn't serve the
+// model: a 404, or a 400 that names the model. Rate limits, server errors and
+// timeouts say nothing about the model, so probing stops on them.
+func isModelRejection(err error) bool {
+	var ctxErr *ContextLengthError
+	var blockedErr *ContentBlockedError
+	if errors.As(err, &ctxErr) || errors.As(err, &blockedErr) {
+		return false
+	}
+	if errors.Is(err, ErrTranscriptionNotSupported) {
+		return true
+	}
+
+	switch errorStatusCode(err) {
+	case http.StatusNotFound:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(strings.ToLower(err.Error()), "model")
+	}
+	return false
+}
+
+// routeProvider returns the provider from the routing table, or "" if no rule
+// matches. Exact model rules take precedence over patterns.
+func (m *Manager) routeProvider(model string) string {
+	for _, rule := range m.routes {
+		if rule.Pattern == model {
+			return rule.Provider
+		}
+	}
+	for _, rule := range m.routes {
+		if matched, _ := path.Match(rule.Pattern, model); matched {
+			return rule.Provider
+		}
+	}
 	return ""
 }
 
@@ -88,7 +301,7 @@ func (m *Manager) detectProvider(model string) string {
 func (m *Manager) GetFailoverChain(model string) []string {
 	chain, ok := m.failover[model]
 	if !ok {
-		return []string{}
+		chain = m.tierChain(model)
 	}
 
 	// Filter out models whose providers aren't configured
@@ -103,22 +316,129 @@ func (m *Manager) GetFailoverChain(model string) []string {
 	return available
 }
 
-// ChatCompletion makes a chat completion request with automatic failover
+// EquivalentModels returns the models interchangeable with model across every
+// configured provider: its failover chain, then the rest of its tier (built-in
+// tier members and MODEL_TIERS entries naming an exact model). The model itself
+// isn't included.
+func (m *Manager) EquivalentModels(model string) []string {
+	equivalents := m.GetFailoverChain(model)
+	tier := m.modelTier(model)
+	if tier == "" {
+		return equivalents
+	}
+
+	members := append([]string(nil), modelTiers[tier]...)
+	for _, rule := range m.tierRules {
+		if rule.Tier == tier && !strings.ContainsAny(rule.Pattern, "*?[") {
+			members = append(members, rule.Pattern)
+		}
+	}
+
+	seen := map[string]bool{model: true}
+	for _, candidate := range equivalents {
+		seen[candidate] = true
+	}
+	for _, candidate := range members {
+		if seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		// A MODEL_TIERS rule may have moved a built-in member to another tier
+		if m.modelTier(candidate) != tier {
+			continue
+		}
+		if _, ok := m.providers[m.detectProvider(candidate)]; ok {
+			equivalents = append(equivalents, candidate)
+		}
+	}
+	return equivalents
+}
+
+// tierChain derives a failover chain from the model's tier: the first model of
+// that tier on every other provider, in tier order
+func (m *Manager) tierChain(model string) []string {
+	tier := m.modelTier(model)
+	if tier == "" {
+		return nil
+	}
+
+	ownProvider := m.detectProvider(model)
+	seen := map[string]bool{ownProvider: true}
+
+	var chain []string
+	for _, candidate := range modelTiers[tier] {
+		providerName := m.detectProvider(candidate)
+		if seen[providerName] {
+			continue
+		}
+		seen[providerName] = true
+		chain = append(chain, candidate)
+	}
+	return chain
+}
+
+// modelTier returns the tier for a model from the configured rules (exact
+// names before globs), then the built-in tiers, or "" if none applies
+func (m *Manager) modelTier(model string) string {
+	for _, rule := range m.tierRules {
+		if rule.Pattern == model {
+			return rule.Tier
+		}
+	}
+	for _, rule := range m.tierRules {
+		if matched, _ := path.Match(rule.Pattern, model); matched {
+			return rule.Tier
+		}
+	}
+
+	for tier, models := range modelTiers {
+		for _, candidate := range models {
+			if candidate == model {
+				return tier
+			}
+		}
+	}
+	return ""
+}
+
+// ChatCompletion makes a chat completion request with automatic failover. The
+// attempts made, region fallbacks included, are capped by the retry budget;
+// once it runs out the last error is returned.
 func (m *Manager) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, string, bool, error) {
+	ctx = m.withRetryTracker(ctx)
 	originalModel := req.Model
 	originalProvider := m.detectProvider(originalModel)
 	failoverUsed := false
 
+	if originalProvider == "" && len(m.unknownOrder) > 0 {
+		var resp *ChatResponse
+		providerName, err := m.probeUnknownModel(ctx, originalModel, func(provider Provider) (err error) {
+			resp, err = provider.ChatCompletion(ctx, req)
+			return err
+		})
+		if err == nil {
+			resp.ServedModel = originalModel
+		}
+		return resp, providerName, false, err
+	}
+
 	// Try the primary model first
 	provider, providerName, err := m.GetProvider(req.Model)
 	if err != nil {
 		return nil, "", false, err
 	}
 
+	// The primary attempt always goes ahead, even on a budget an earlier call
+	// in the request used up; the budget only caps what follows it
+	spendAttempt(ctx)
 	resp, err := provider.ChatCompletion(ctx, req)
 	if err == nil {
+		resp.ServedModel = originalModel
 		return resp, providerName, failoverUsed, nil
 	}
+	if isRateLimitError(err) {
+		m.throttle.record(originalModel, RetryAfter(err))
+	}
 
 	// Check if error is retryable (rate limit, timeout, server error)
 	if !isRetryableError(err) {
@@ -126,6 +446,7 @@ func (m *Manager) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatRes
 	}
 
 	// Try failover chain
+	lastErr := err
 	failoverChain := m.GetFailoverChain(originalModel)
 	for _, fallbackModel := range failoverChain {
 		req.Model = fallbackModel
@@ -133,19 +454,165 @@ func (m *Manager) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatRes
 		if err != nil {
 			continue
 		}
+		if !spendAttempt(ctx) {
+			log.Printf("Retry budget for %s exhausted before failover to %s", originalModel, fallbackModel)
+			return nil, originalProvider, false, budgetExhausted(ctx, lastErr)
+		}
 
 		resp, err := provider.ChatCompletion(ctx, req)
 		if err == nil {
 			failoverUsed = true
+			resp.ServedModel = fallbackModel
 			return resp, providerName, failoverUsed, nil
 		}
+		if isRateLimitError(err) {
+			m.throttle.record(fallbackModel, RetryAfter(err))
+		}
+		lastErr = err
 	}
 
-	return nil, originalProvider, false, fmt.Errorf("all providers failed for model %s", originalModel)
+	return nil, originalProvider, false, fmt.Errorf("all providers failed for model %s: %w", originalModel, lastErr)
+}
+
+// RaceChatCompletion dispatches the request to the primary model and its first
+// failover concurrently, returning whichever succeeds first and cancelling the
+// other, which is reported in the response's RaceLoser. raced reports whether
+// two candidates were dispatched; with nothing to race against, or no retry
+// budget left for both, the request is served as a regular one.
+func (m *Manager) RaceChatCompletion(ctx context.Context, req ChatRequest) (resp *ChatResponse, providerName string, failover bool, raced bool, err error) {
+	ctx = m.withRetryTracker(ctx)
+	originalModel := req.Model
+
+	type candidate struct {
+		model        string
+		provider     Provider
+		providerName string
+	}
+	var candidates []candidate
+	if provider, name, err := m.GetProvider(originalModel); err == nil {
+		candidates = append(candidates, candidate{originalModel, provider, name})
+	}
+	if failoverChain := m.GetFailoverChain(originalModel); len(candidates) == 1 && len(failoverChain) > 0 {
+		if provider, name, err := m.GetProvider(failoverChain[0]); err == nil {
+			candidates = append(candidates, candidate{failoverChain[0], provider, name})
+		}
+	}
+	if len(candidates) < 2 {
+		// Nothing to race against - behave like a regular request
+		resp, providerName, failover, err = m.ChatCompletion(ctx, req)
+		return resp, providerName, failover, false, err
+	}
+	if !spendAttempts(ctx, len(candidates)) {
+		log.Printf("Retry budget for %s can't cover a race, sending a regular request", originalModel)
+		resp, providerName, failover, err = m.ChatCompletion(ctx, req)
+		return resp, providerName, failover, false, err
+	}
+	log.Printf("Racing %s against %s", candidates[0].model, candidates[1].model)
+
+	type raceResult struct {
+		resp         *ChatResponse
+		providerName string
+		model        string
+		failover     bool
+		err          error
+	}
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so the loser never blocks after we've returned
+	results := make(chan raceResult, len(candidates))
+	for i, c := range candidates {
+		go func(c candidate, failover bool) {
+			raceReq := req
+			raceReq.Model = c.model
+
+			resp, err := c.provider.ChatCompletion(raceCtx, raceReq)
+			if err != nil && isRateLimitError(err) {
+				m.throttle.record(c.model, RetryAfter(err))
+			}
+			results <- raceResult{resp: resp, providerName: c.providerName, model: c.model, failover: failover, err: err}
+		}(c, i > 0)
+	}
+
+	var lastErr error
+	for i := range candidates {
+		result := <-results
+		if result.err == nil {
+			cancel() // Stop the slower request
+			log.Printf("Race for %s won by %s (%s)", originalModel, result.model, result.providerName)
+			result.resp.ServedModel = result.model
+			if i == 0 {
+				// Wait out the cancellation so whatever the loser used is known
+				loser := <-results
+				result.resp.RaceLoser = &RaceAttempt{Model: loser.model, ProviderName: loser.providerName, Resp: loser.resp}
+			}
+			return result.resp, result.providerName, result.failover, true, nil
+		}
+		lastErr = result.err
+	}
+
+	return nil, m.detectProvider(originalModel), false, true, fmt.Errorf("all race candidates failed for model %s: %w", originalModel, lastErr)
+}
+
+// ChatCompletionStream opens a stream with the model's provider, probing
+// UNKNOWN_MODEL_PROVIDERS for unrecognised models
+func (m *Manager) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, string, error) {
+	ctx = m.withRetryTracker(ctx)
+	if m.detectProvider(req.Model) == "" && len(m.unknownOrder) > 0 {
+		var stream StreamReader
+		providerName, err := m.probeUnknownModel(ctx, req.Model, func(provider Provider) (err error) {
+			stream, err = provider.ChatCompletionStream(ctx, req)
+			return err
+		})
+		return stream, providerName, err
+	}
+
+	provider, providerName, err := m.GetProvider(req.Model)
+	if err != nil {
+		return nil, "", err
+	}
+	// As in ChatCompletion, the primary attempt always goes ahead
+	spendAttempt(ctx)
+	stream, err := provider.ChatCompletionStream(ctx, req)
+	if err != nil && isRateLimitError(err) {
+		m.throttle.record(req.Model, RetryAfter(err))
+	}
+	return stream, providerName, err
+}
+
+// Transcribe transcribes audio with the model's provider. There is no failover:
+// other providers' audio models aren't interchangeable.
+func (m *Manager) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, string, error) {
+	provider, providerName, err := m.GetProvider(req.Model)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := provider.Transcribe(ctx, req)
+	return resp, providerName, err
 }
 
 // isRetryableError checks if an error should trigger failover
 func isRetryableError(err error) bool {
+	// The budget that stopped one loop stops every other
+	if errors.Is(err, ErrRetryBudgetExhausted) {
+		return false
+	}
+	// Every model in the chain would reject an over-long prompt the same way
+	var ctxErr *ContextLengthError
+	if errors.As(err, &ctxErr) {
+		return false
+	}
+	// Another provider may have room when this one is at its concurrency cap
+	if errors.Is(err, ErrProviderBusy) {
+		return true
+	}
+	// go-openai's errors say "status code: 503", which the checks below miss
+	if code := errorStatusCode(err); code == http.StatusTooManyRequests || code >= http.StatusInternalServerError {
+		return true
+	}
+
 	errStr := err.Error()
 	return strings.Contains(errStr, "429") ||
 		strings.Contains(errStr, "rate limit") ||
@@ -0,0 +1,299 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+// stubProvider answers chat completions with reply, recording the models asked for
+type stubProvider struct {
+	name   string
+	models []string // models ValidateModel accepts
+	reply  func(req ChatRequest) (*ChatResponse, error)
+	stream func(req ChatRequest) (StreamReader, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *stubProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, req.Model)
+	p.mu.Unlock()
+	if p.reply == nil {
+		return stubResponse(req.Model), nil
+	}
+	return p.reply(req)
+}
+
+func (p *stubProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, req.Model)
+	p.mu.Unlock()
+	if p.stream == nil {
+		return nil, errors.New("streaming not stubbed")
+	}
+	return p.stream(req)
+}
+
+func (p *stubProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	return nil, ErrTranscriptionNotSupported
+}
+
+func (p *stubProvider) ValidateModel(model string) bool {
+	for _, m := range p.models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *stubProvider) GetProviderName() string        { return p.name }
+func (p *stubProvider) Capabilities() Capabilities     { return Capabilities{} }
+func (p *stubProvider) Warm(ctx context.Context) error { return nil }
+
+func (p *stubProvider) called() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.calls...)
+}
+
+func stubResponse(model string) *ChatResponse {
+	return &ChatResponse{
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "ok"}}},
+	}
+}
+
+// failWith returns a reply func that always fails with err
+func failWith(err error) func(ChatRequest) (*ChatResponse, error) {
+	return func(ChatRequest) (*ChatResponse, error) { return nil, err }
+}
+
+// newTestManager builds a manager over stub providers, keyed by their names
+func newTestManager(providers ...*stubProvider) *Manager {
+	m := &Manager{
+		providers: make(map[string]Provider),
+		failover:  make(map[string][]string),
+		throttle:  newThrottleTracker(0, 0),
+		learned:   make(map[string]string),
+	}
+	for _, p := range providers {
+		m.providers[p.name] = p
+	}
+	return m
+}
+
+func TestUnknownModelServedByFirstAcceptingProvider(t *testing.T) {
+	notFound := &ProviderError{Provider: "Anthropic", StatusCode: http.StatusNotFound, Body: `{"type":"not_found_error","message":"model: acme-1"}`}
+	openaiStub := &stubProvider{name: "openai", reply: failWith(&openai.APIError{HTTPStatusCode: 404, Code: "model_not_found", Message: "The model `acme-1` does not exist"})}
+	anthropicStub := &stubProvider{name: "anthropic", reply: failWith(notFound)}
+	cohereStub := &stubProvider{name: "cohere"}
+	m := newTestManager(openaiStub, anthropicStub, cohereStub)
+	m.unknownOrder = []string{"openai", "anthropic", "cohere"}
+
+	resp, providerName, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "acme-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if providerName != "cohere" || resp.Model != "acme-1" {
+		t.Errorf("expected cohere to serve acme-1, got %s", providerName)
+	}
+	if m.DetectProvider("acme-1") != "cohere" {
+		t.Errorf("the accepting provider should be remembered, got %q", m.DetectProvider("acme-1"))
+	}
+
+	// Later requests go straight to it
+	m.ChatCompletion(context.Background(), ChatRequest{Model: "acme-1"})
+	if len(openaiStub.called()) != 1 || len(cohereStub.called()) != 2 {
+		t.Errorf("expected one probe of openai and two cohere calls, got %v and %v", openaiStub.called(), cohereStub.called())
+	}
+}
+
+func TestUnknownModelTriesValidatingProvidersFirst(t *testing.T) {
+	openaiStub := &stubProvider{name: "openai"}
+	googleStub := &stubProvider{name: "google", models: []string{"acme-1"}}
+	m := newTestManager(openaiStub, googleStub)
+	m.unknownOrder = []string{"openai", "google"}
+
+	if _, providerName, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "acme-1"}); err != nil || providerName != "google" {
+		t.Fatalf("expected google, whose ValidateModel accepts the model, got %s, %v", providerName, err)
+	}
+	if len(openaiStub.called()) != 0 {
+		t.Errorf("openai shouldn't be tried once google accepted, got %v", openaiStub.called())
+	}
+}
+
+func TestUnknownModelProbingStopsOnNonRejections(t *testing.T) {
+	for name, err := range map[string]error{
+		"rate limit":   &RateLimitError{Err: &openai.APIError{HTTPStatusCode: 429, Message: "slow down"}},
+		"server error": &ProviderError{Provider: "OpenAI", StatusCode: http.StatusBadGateway, Body: "upstream model host down"},
+		"timeout":      context.DeadlineExceeded,
+		"auth":         &ProviderError{Provider: "OpenAI", StatusCode: http.StatusUnauthorized, Body: "invalid api key"},
+	} {
+		first := &stubProvider{name: "openai", reply: failWith(err)}
+		second := &stubProvider{name: "cohere"}
+		m := newTestManager(first, second)
+		m.unknownOrder = []string{"openai", "cohere"}
+
+		_, providerName, _, gotErr := m.ChatCompletion(context.Background(), ChatRequest{Model: "acme-1"})
+		if gotErr == nil || providerName != "openai" {
+			t.Errorf("%s: expected openai's error back, got %s, %v", name, providerName, gotErr)
+		}
+		if len(second.called()) != 0 {
+			t.Errorf("%s: probing should stop instead of trying cohere", name)
+		}
+		if m.DetectProvider("acme-1") != "" {
+			t.Errorf("%s: nothing should be learned", name)
+		}
+	}
+}
+
+func TestIsModelRejection(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&ProviderError{Provider: "Gemini", StatusCode: 404, Body: "models/acme-1 is not found"}, true},
+		{&openai.APIError{HTTPStatusCode: 404, Code: "model_not_found"}, true},
+		{&ProviderError{Provider: "Cohere", StatusCode: 400, Body: `{"message":"invalid model: acme-1"}`}, true},
+		{fmt.Errorf("wrapped: %w", &ProviderError{Provider: "Anthropic", StatusCode: 404, Body: "not_found_error"}), true},
+		{ErrTranscriptionNotSupported, true},
+		{&ProviderError{Provider: "Cohere", StatusCode: 400, Body: `{"message":"messages must not be empty"}`}, false},
+		{&ProviderError{Provider: "Gemini", StatusCode: 429, Body: "quota exceeded for model"}, false},
+		{&ProviderError{Provider: "Gemini", StatusCode: 503, Body: "model overloaded"}, false},
+		{&ContextLengthError{Provider: "openai", Model: "acme-1"}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("connection refused"), false},
+	} {
+		if got := isModelRejection(tc.err); got != tc.want {
+			t.Errorf("isModelRejection(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestFailoverRecordsTheServedModel(t *testing.T) {
+	m, stubs := failingChain()
+	stubs[2].reply = func(req ChatRequest) (*ChatResponse, error) { return stubResponse("gemini-2.5-pro-002"), nil }
+	ctx := WithRetryBudget(context.Background(), RetryBudget{MaxAttempts: 5})
+
+	resp, providerName, failover, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !failover || providerName != "google" || resp.ServedModel != "gemini-2.5-pro" {
+		t.Errorf("expected gemini-2.5-pro served through failover, got %s/%q (failover %v)", providerName, resp.ServedModel, failover)
+	}
+
+	stubs[0].reply = nil
+	resp, _, _, err = m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	if err != nil || resp.ServedModel != "gpt-4o" {
+		t.Errorf("expected the requested model served, got %+v, %v", resp, err)
+	}
+}
+
+func TestOpenAIServerErrorsAreRetryable(t *testing.T) {
+	for _, err := range []error{
+		&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "overloaded"},
+		&openai.RequestError{HTTPStatusCode: http.StatusBadGateway},
+		&openai.APIError{HTTPStatusCode: http.StatusTooManyRequests},
+	} {
+		if !isRetryableError(fmt.Errorf("OpenAI API error: %w", err)) {
+			t.Errorf("%v should fail over", err)
+		}
+	}
+	if isRetryableError(fmt.Errorf("OpenAI API error: %w", &openai.APIError{HTTPStatusCode: http.StatusBadRequest})) {
+		t.Error("a 400 shouldn't fail over")
+	}
+}
+
+func TestEquivalentModelsSpanConfiguredProviders(t *testing.T) {
+	m := newTestManager(&stubProvider{name: "openai"}, &stubProvider{name: "anthropic"}, &stubProvider{name: "google"})
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929", "gemini-2.5-pro"}
+	m.tierRules = []config.TierRule{
+		{Pattern: "gpt-4.1", Tier: "flagship"},
+		{Pattern: "gpt-4-turbo", Tier: "fast"},
+		{Pattern: "claude-*", Tier: "flagship"},
+	}
+
+	got := strings.Join(m.EquivalentModels("gpt-4o"), ",")
+	// Failover chain first, then the rest of the tier; cohere isn't configured,
+	// gpt-4-turbo was moved to another tier and globs can't be enumerated
+	want := "claude-sonnet-4-5-20250929,gemini-2.5-pro,gpt-4,claude-opus-4-5-20251101,gpt-4.1"
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+	if got := m.EquivalentModels("acme-1"); len(got) != 0 {
+		t.Errorf("a model without a chain or tier has no equivalents, got %v", got)
+	}
+}
+
+func TestRoutingRulesOverridePrefixDetection(t *testing.T) {
+	openaiStub := &stubProvider{name: "openai"}
+	azureStub := &stubProvider{name: "azure"}
+	m := newTestManager(openaiStub, azureStub, &stubProvider{name: "anthropic"})
+	m.routes = []config.RoutingRule{
+		{Pattern: "claude-*", Provider: "azure"},
+		{Pattern: "gpt-4o", Provider: "azure"},
+		{Pattern: "claude-3-haiku-20240307", Provider: "anthropic"},
+	}
+
+	for model, want := range map[string]string{
+		"gpt-4o":                     "azure",     // exact rule wins over the gpt- prefix
+		"gpt-4o-mini":                "openai",    // no rule: prefix detection
+		"claude-sonnet-4-5-20250929": "azure",     // glob rule
+		"claude-3-haiku-20240307":    "anthropic", // exact rule wins over a glob
+	} {
+		if got := m.DetectProvider(model); got != want {
+			t.Errorf("%s: routed to %q, want %q", model, got, want)
+		}
+	}
+
+	_, providerName, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if providerName != "azure" || len(azureStub.called()) != 1 || len(openaiStub.called()) != 0 {
+		t.Errorf("gpt-4o served by %q; azure called %v, openai %v", providerName, azureStub.called(), openaiStub.called())
+	}
+}
+
+func TestUnmappedModelFailsOverWithinItsTier(t *testing.T) {
+	unavailable := failWith(&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "overloaded"})
+	openaiStub := &stubProvider{name: "openai", reply: unavailable}
+	anthropicStub := &stubProvider{name: "anthropic"}
+	m := newTestManager(openaiStub, anthropicStub)
+	m.tierRules = []config.TierRule{{Pattern: "gpt-4.1*", Tier: "fast"}}
+
+	for model, want := range map[string]string{
+		"gpt-4-turbo":   "claude-sonnet-4-5-20250929", // built-in flagship tier
+		"gpt-3.5-turbo": "claude-haiku-4-5-20251001",  // built-in fast tier
+		"gpt-4.1-nano":  "claude-haiku-4-5-20251001",  // MODEL_TIERS annotation
+	} {
+		if _, ok := m.failover[model]; ok {
+			t.Fatalf("%s has an explicit chain", model)
+		}
+		resp, providerName, failoverUsed, err := m.ChatCompletion(context.Background(), ChatRequest{Model: model})
+		if err != nil {
+			t.Errorf("%s: expected a failover, got %v", model, err)
+			continue
+		}
+		if providerName != "anthropic" || !failoverUsed || resp.Model != want {
+			t.Errorf("%s: served %s by %s (failover %v), want %s", model, resp.Model, providerName, failoverUsed, want)
+		}
+	}
+
+	// A model without a tier has nowhere to go
+	if _, _, _, err := m.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-acme"}); err == nil {
+		t.Error("expected the error for a model without a tier")
+	}
+}
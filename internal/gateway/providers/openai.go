@@ -1,8 +1,16 @@
 package providers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
@@ -10,14 +18,59 @@ import (
 
 // OpenAIProvider handles OpenAI API requests
 type OpenAIProvider struct {
-	client *openai.Client
+	apiKey    string
+	baseURL   string // empty = the library's default endpoint
+	transport http.RoundTripper
+	client    *openai.Client
+
+	// Clients for requests billed to a specific organization, created on demand
+	mu         sync.Mutex
+	orgClients map[string]*openai.Client
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
-func NewOpenAIProvider(apiKey string) *OpenAIProvider {
-	return &OpenAIProvider{
-		client: openai.NewClient(apiKey),
+func NewOpenAIProvider(apiKey string, transport http.RoundTripper) *OpenAIProvider {
+	return newOpenAIProvider(apiKey, "", transport)
+}
+
+// newOpenAIProvider creates an OpenAI provider for a specific endpoint (e.g. "https://api.openai.com/v1")
+func newOpenAIProvider(apiKey, baseURL string, transport http.RoundTripper) *OpenAIProvider {
+	p := &OpenAIProvider{
+		apiKey:     apiKey,
+		baseURL:    baseURL,
+		transport:  transport,
+		orgClients: make(map[string]*openai.Client),
+	}
+	p.client = openai.NewClientWithConfig(p.clientConfig(""))
+	return p
+}
+
+// clientConfig builds the client config for an organization ("" = key's default)
+func (p *OpenAIProvider) clientConfig(org string) openai.ClientConfig {
+	config := openai.DefaultConfig(p.apiKey)
+	if p.baseURL != "" {
+		config.BaseURL = p.baseURL
+	}
+	config.OrgID = org
+	config.HTTPClient = newUpstreamClient(0, captureTransport{base: p.transport})
+	return config
+}
+
+// clientFor returns the client for an organization, or the default client
+func (p *OpenAIProvider) clientFor(org string) *openai.Client {
+	if org == "" {
+		return p.client
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client, ok := p.orgClients[org]
+	if !ok {
+		client = openai.NewClientWithConfig(p.clientConfig(org))
+		p.orgClients[org] = client
 	}
+	return client
 }
 
 // ChatCompletion makes a chat completion request to OpenAI
@@ -25,25 +78,13 @@ func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*
 	startTime := time.Now()
 
 	// Build OpenAI request
-	openaiReq := openai.ChatCompletionRequest{
-		Model:    req.Model,
-		Messages: req.Messages,
-	}
-
-	if req.Temperature != nil {
-		openaiReq.Temperature = *req.Temperature
-	}
-	if req.MaxTokens != nil {
-		openaiReq.MaxTokens = *req.MaxTokens
-	}
-	if req.TopP != nil {
-		openaiReq.TopP = *req.TopP
-	}
+	openaiReq := p.convertRequest(req)
 
 	// Make request
-	resp, err := p.client.CreateChatCompletion(ctx, openaiReq)
+	ctx, header := withResponseHeaders(ctx)
+	resp, err := p.clientFor(req.Organization).CreateChatCompletion(ctx, openaiReq)
 	if err != nil {
-		return nil, fmt.Errorf("OpenAI API error: %w", err)
+		return nil, openAIError(req.Model, "OpenAI API error", err, *header)
 	}
 
 	latencyMs := int(time.Since(startTime).Milliseconds())
@@ -58,43 +99,163 @@ func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*
 		Usage:             resp.Usage,
 		SystemFingerprint: resp.SystemFingerprint,
 		LatencyMs:         latencyMs,
+		RateLimit:         parseUpstreamRateLimit(resp.Header()),
 	}, nil
 }
 
-// ChatCompletionStream creates a streaming chat completion request
-func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
-	openaiReq := openai.ChatCompletionRequest{
-		Model:    req.Model,
-		Messages: req.Messages,
-		Stream:   true,
+// Transcribe transcribes audio with OpenAI's transcription endpoint
+func (p *OpenAIProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	startTime := time.Now()
+
+	// Only whisper reports the audio duration, which billing needs; the
+	// gpt-4o transcribe models report token usage instead
+	format := openai.AudioResponseFormatJSON
+	if strings.HasPrefix(req.Model, "whisper-") {
+		format = openai.AudioResponseFormatVerboseJSON
 	}
 
-	if req.Temperature != nil {
-		openaiReq.Temperature = *req.Temperature
+	ctx, header := withResponseHeaders(ctx)
+	ctx, body := withResponseBody(ctx)
+	resp, err := p.clientFor(req.Organization).CreateTranscription(ctx, openai.AudioRequest{
+		Model:       req.Model,
+		FilePath:    req.FileName,
+		Reader:      bytes.NewReader(req.Audio),
+		Prompt:      req.Prompt,
+		Language:    req.Language,
+		Temperature: req.Temperature,
+		Format:      format,
+	})
+	if err != nil {
+		return nil, openAIError(req.Model, "OpenAI transcription error", err, *header)
 	}
-	if req.MaxTokens != nil {
-		openaiReq.MaxTokens = *req.MaxTokens
+
+	out := &TranscriptionResponse{
+		Text:      resp.Text,
+		Language:  resp.Language,
+		Duration:  resp.Duration,
+		LatencyMs: int(time.Since(startTime).Milliseconds()),
 	}
-	if req.TopP != nil {
-		openaiReq.TopP = *req.TopP
+	var withUsage struct {
+		Usage *TranscriptionUsage `json:"usage"`
+	}
+	if json.Unmarshal(*body, &withUsage) == nil && withUsage.Usage != nil && withUsage.Usage.Type == "tokens" {
+		out.Usage = withUsage.Usage
+	}
+	for _, seg := range resp.Segments {
+		out.Segments = append(out.Segments, TranscriptionSegment{ID: seg.ID, Start: seg.Start, End: seg.End, Text: seg.Text})
 	}
+	return out, nil
+}
 
-	stream, err := p.client.CreateChatCompletionStream(ctx, openaiReq)
+// ChatCompletionStream creates a streaming chat completion request
+func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	openaiReq := p.convertRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	ctx, header := withResponseHeaders(ctx)
+	stream, err := p.clientFor(req.Organization).CreateChatCompletionStream(ctx, openaiReq)
 	if err != nil {
-		return nil, fmt.Errorf("OpenAI streaming API error: %w", err)
+		return nil, openAIError(req.Model, "OpenAI streaming API error", err, *header)
 	}
 
 	return &OpenAIStreamReader{stream: stream}, nil
 }
 
+// openAIError maps a failed OpenAI call: context_length_exceeded becomes a
+// ContextLengthError and a 429 a RateLimitError carrying the response headers;
+// anything else is wrapped with prefix
+func openAIError(model, prefix string, err error, header http.Header) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if ctxErr := detectContextLengthError("openai", model, apiErr.HTTPStatusCode, fmt.Sprintf("%v: %s", apiErr.Code, apiErr.Message)); ctxErr != nil {
+			return ctxErr
+		}
+	}
+
+	wrapped := fmt.Errorf("%s: %w", prefix, err)
+	if openAIStatusCode(err) == http.StatusTooManyRequests {
+		return newRateLimitError(header, wrapped)
+	}
+	return wrapped
+}
+
+// openAIStatusCode returns the HTTP status of a failed go-openai call, or 0
+func openAIStatusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// responseHeadersKey carries the *http.Header captureTransport fills in, since
+// go-openai's errors don't keep the response headers
+type responseHeadersKey struct{}
+
+// withResponseHeaders returns a context whose OpenAI requests record their
+// response headers in the returned header
+func withResponseHeaders(ctx context.Context) (context.Context, *http.Header) {
+	header := new(http.Header)
+	return context.WithValue(ctx, responseHeadersKey{}, header), header
+}
+
+// responseBodyKey carries the *[]byte captureTransport fills in, for fields
+// go-openai doesn't decode (transcription usage)
+type responseBodyKey struct{}
+
+// withResponseBody returns a context whose OpenAI requests record their
+// response body in the returned slice
+func withResponseBody(ctx context.Context) (context.Context, *[]byte) {
+	body := new([]byte)
+	return context.WithValue(ctx, responseBodyKey{}, body), body
+}
+
+// captureTransport records each response's headers for withResponseHeaders,
+// and its body for withResponseBody
+type captureTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the request and stores the response headers and body, if asked to
+func (t captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if header, ok := req.Context().Value(responseHeadersKey{}).(*http.Header); ok {
+		*header = resp.Header
+	}
+	if body, ok := req.Context().Value(responseBodyKey{}).(*[]byte); ok {
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		*body = data
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return resp, nil
+}
+
 // OpenAIStreamReader wraps OpenAI's stream
 type OpenAIStreamReader struct {
 	stream *openai.ChatCompletionStream
 }
 
+// RateLimit returns the rate-limit headers OpenAI sent with the stream
+func (r *OpenAIStreamReader) RateLimit() *UpstreamRateLimit {
+	return parseUpstreamRateLimit(r.stream.Header())
+}
+
 // Recv reads the next chunk
-func (r *OpenAIStreamReader) Recv() (openai.ChatCompletionStreamResponse, error) {
-	return r.stream.Recv()
+func (r *OpenAIStreamReader) Recv() (StreamChunk, error) {
+	chunk, err := r.stream.Recv()
+	return StreamChunk{ChatCompletionStreamResponse: chunk}, err
 }
 
 // Close closes the stream
@@ -103,6 +264,71 @@ func (r *OpenAIStreamReader) Close() error {
 	return nil
 }
 
+// convertRequest converts to OpenAI format
+func (p *OpenAIProvider) convertRequest(req ChatRequest) openai.ChatCompletionRequest {
+	openaiReq := openai.ChatCompletionRequest{
+		Model:     req.Model,
+		Messages:  req.Messages,
+		User:      req.User,
+		LogitBias: req.LogitBias,
+		Seed:      req.Seed,
+		Tools:     req.Tools,
+		Stop:      req.Stop,
+	}
+	if len(req.Tools) > 0 {
+		openaiReq.ToolChoice = req.ToolChoice
+	}
+
+	if req.Temperature != nil {
+		openaiReq.Temperature = *req.Temperature
+	}
+	if req.MaxTokens != nil {
+		openaiReq.MaxTokens = *req.MaxTokens
+	}
+	if req.TopP != nil {
+		openaiReq.TopP = *req.TopP
+	}
+	if req.ReasoningEffort != "" {
+		if isOpenAIReasoningModel(req.Model) {
+			openaiReq.ReasoningEffort = req.ReasoningEffort
+		} else {
+			log.Printf("Warning: reasoning_effort is not supported by this OpenAI model, ignoring for model %s", req.Model)
+		}
+	}
+	if req.ResponseFormat != nil {
+		openaiReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatType(req.ResponseFormat.Type),
+		}
+		if schema := req.ResponseFormat.JSONSchema; schema != nil {
+			openaiReq.ResponseFormat.JSONSchema = &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        schema.Name,
+				Description: schema.Description,
+				Schema:      schema.Schema,
+				Strict:      schema.Strict,
+			}
+		}
+	}
+
+	return openaiReq
+}
+
+// isOpenAIReasoningModel reports whether a model accepts reasoning_effort
+// (o-series and gpt-5); other models reject the parameter
+func isOpenAIReasoningModel(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Warm lists models to open a connection to the API ahead of the first request
+func (p *OpenAIProvider) Warm(ctx context.Context) error {
+	_, err := p.client.ListModels(ctx)
+	return err
+}
+
 // ValidateModel checks if a model is valid for chat completions
 func (p *OpenAIProvider) ValidateModel(model string) bool {
 	validModels := map[string]bool{
@@ -120,3 +346,14 @@ func (p *OpenAIProvider) ValidateModel(model string) bool {
 func (p *OpenAIProvider) GetProviderName() string {
 	return "openai"
 }
+
+// Capabilities returns the features supported for this provider
+func (p *OpenAIProvider) Capabilities() Capabilities {
+	// Messages are forwarded as-is, so image content parts pass through
+	return Capabilities{
+		Streaming: true,
+		Tools:     true,
+		JSONMode:  true,
+		Vision:    true,
+	}
+}
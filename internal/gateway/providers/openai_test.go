@@ -0,0 +1,176 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRateLimitedUpstream answers every request with a 429 and OpenAI's rate-limit headers
+func newRateLimitedUpstream(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.Header().Set("x-ratelimit-limit-requests", "500")
+		w.Header().Set("x-ratelimit-remaining-requests", "0")
+		w.Header().Set("x-ratelimit-reset-requests", "7s")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func assertOpenAIRateLimit(t *testing.T, err error) {
+	t.Helper()
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("expected a RateLimitError, got %T: %v", err, err)
+	}
+	if rlErr.RateLimit == nil || rlErr.RateLimit.Limit != "500" || rlErr.RateLimit.Remaining != "0" || rlErr.RateLimit.Reset != "7s" {
+		t.Errorf("rate-limit headers not captured: %+v", rlErr.RateLimit)
+	}
+	if got := RetryAfter(err); got != 7*time.Second {
+		t.Errorf("expected Retry-After 7s, got %s", got)
+	}
+	if got := ClassifyError(err); got != ErrorTypeRateLimit {
+		t.Errorf("expected error type %s, got %s", ErrorTypeRateLimit, got)
+	}
+}
+
+func TestOpenAIRateLimitError(t *testing.T) {
+	for name, body := range map[string]string{
+		"api error":   `{"error":{"message":"Rate limit reached for gpt-4o","type":"requests","code":"rate_limit_exceeded"}}`,
+		"plain 429":   `Too Many Requests`,
+		"empty error": `{}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRateLimitedUpstream(t, body)
+			p := newOpenAIProvider("test", srv.URL+"/v1", http.DefaultTransport)
+			req := ChatRequest{Model: "gpt-4o", Messages: toolRequest("gpt-4o").Messages}
+
+			_, err := p.ChatCompletion(context.Background(), req)
+			assertOpenAIRateLimit(t, err)
+
+			_, err = p.ChatCompletionStream(context.Background(), req)
+			assertOpenAIRateLimit(t, err)
+		})
+	}
+}
+
+func TestOpenAIOtherErrorsAreNotRateLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":{"message":"boom","type":"server_error"}}`)
+	}))
+	defer srv.Close()
+	p := newOpenAIProvider("test", srv.URL+"/v1", http.DefaultTransport)
+
+	_, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	var rlErr *RateLimitError
+	if err == nil || errors.As(err, &rlErr) {
+		t.Fatalf("expected a plain error, got %v", err)
+	}
+}
+
+func TestOpenAIRateLimitHeadersOnSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-remaining-requests", "499")
+		w.Header().Set("x-ratelimit-remaining-tokens", "29000")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"c","choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer srv.Close()
+	p := newOpenAIProvider("test", srv.URL+"/v1", http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RateLimit == nil || resp.RateLimit.Remaining != "499" || resp.RateLimit.RemainingTokens != "29000" {
+		t.Errorf("rate-limit headers not captured: %+v", resp.RateLimit)
+	}
+}
+
+// sentToOpenAI runs req through the OpenAI provider and returns the upstream
+// request it made, with its decoded JSON body
+func sentToOpenAI(t *testing.T, req ChatRequest) (*http.Request, map[string]json.RawMessage) {
+	t.Helper()
+	var sent *http.Request
+	var body map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Clone(context.Background())
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"c","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	if _, err := newOpenAIProvider("test", srv.URL+"/v1", http.DefaultTransport).ChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	return sent, body
+}
+
+func TestOpenAIForwardsUser(t *testing.T) {
+	_, body := sentToOpenAI(t, ChatRequest{Model: "gpt-4o", User: "user-42"})
+	if string(body["user"]) != `"user-42"` {
+		t.Errorf("expected user forwarded, got %s", body["user"])
+	}
+
+	_, body = sentToOpenAI(t, ChatRequest{Model: "gpt-4o"})
+	if _, ok := body["user"]; ok {
+		t.Errorf("expected no user without one, got %s", body["user"])
+	}
+}
+
+func TestOpenAIForwardsOrganization(t *testing.T) {
+	sent, _ := sentToOpenAI(t, ChatRequest{Model: "gpt-4o", Organization: "org-billing"})
+	if got := sent.Header.Get("OpenAI-Organization"); got != "org-billing" {
+		t.Errorf("OpenAI-Organization = %q, want org-billing", got)
+	}
+
+	sent, _ = sentToOpenAI(t, ChatRequest{Model: "gpt-4o"})
+	if got := sent.Header.Get("OpenAI-Organization"); got != "" {
+		t.Errorf("expected no organization without one, got %q", got)
+	}
+}
+
+func TestLogitBiasReachesOpenAIUnchanged(t *testing.T) {
+	bias := map[string]int{"50256": -100, "1734": 5}
+	req := ChatRequest{Model: "gpt-4o", LogitBias: bias}
+
+	if got := (&OpenAIProvider{}).convertRequest(req).LogitBias; len(got) != 2 || got["50256"] != -100 || got["1734"] != 5 {
+		t.Errorf("converted logit_bias %v, want %v", got, bias)
+	}
+	_, body := sentToOpenAI(t, req)
+	var sent map[string]int
+	if err := json.Unmarshal(body["logit_bias"], &sent); err != nil || len(sent) != 2 || sent["50256"] != -100 || sent["1734"] != 5 {
+		t.Errorf("sent logit_bias %s, want %v", body["logit_bias"], bias)
+	}
+}
+
+func TestLogitBiasIgnoredByOtherProviders(t *testing.T) {
+	req := ChatRequest{Model: "m", Messages: toolRequest("m").Messages, LogitBias: map[string]int{"50256": -100}}
+	for name, converted := range map[string]interface{}{
+		"anthropic": (&AnthropicProvider{}).convertRequest(req),
+		"google":    (&GeminiProvider{}).convertRequest(req),
+		"cohere":    (&CohereProvider{}).convertRequest(req),
+	} {
+		body, err := json.Marshal(converted)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.Contains(string(body), "50256") {
+			t.Errorf("%s: logit_bias forwarded: %s", name, body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ApplyPrelude adds a key's standard system prompt to the request. The prelude
+// becomes the first message and the suffix follows the client's leading system
+// messages. With override, the client's system messages are dropped and the
+// prelude and suffix form the only system message.
+func (r *ChatRequest) ApplyPrelude(prelude, suffix string, override bool) {
+	if prelude == "" && suffix == "" {
+		return
+	}
+
+	if override {
+		messages := make([]openai.ChatCompletionMessage, 0, len(r.Messages)+1)
+		messages = append(messages, systemMessage(joinNonEmpty(prelude, suffix)))
+		for _, message := range r.Messages {
+			if message.Role != openai.ChatMessageRoleSystem {
+				messages = append(messages, message)
+			}
+		}
+		r.Messages = messages
+		return
+	}
+
+	// End of the client's leading system messages, where the suffix goes
+	leading := 0
+	for leading < len(r.Messages) && r.Messages[leading].Role == openai.ChatMessageRoleSystem {
+		leading++
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(r.Messages)+2)
+	if prelude != "" {
+		messages = append(messages, systemMessage(prelude))
+	}
+	messages = append(messages, r.Messages[:leading]...)
+	if suffix != "" {
+		messages = append(messages, systemMessage(suffix))
+	}
+	r.Messages = append(messages, r.Messages[leading:]...)
+}
+
+// systemMessage returns a system message with the given text
+func systemMessage(content string) openai.ChatCompletionMessage {
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: content}
+}
+
+// joinNonEmpty joins the non-empty parts with blank lines
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "\n\n")
+}
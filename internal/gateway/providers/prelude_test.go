@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// transcript renders messages as "role: content" lines
+func transcript(messages []openai.ChatCompletionMessage) string {
+	lines := make([]string, len(messages))
+	for i, message := range messages {
+		lines[i] = message.Role + ": " + message.Content
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestApplyPreludeMergesOrOverrides(t *testing.T) {
+	client := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "Answer in French."},
+		{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "Bonjour"},
+		{Role: openai.ChatMessageRoleUser, Content: "Bye"},
+	}
+	for _, tc := range []struct {
+		name, prelude, suffix string
+		override              bool
+		want                  string
+	}{
+		{"none", "", "", false, "system: Answer in French.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+		{"prelude", "You work for Acme.", "", false, "system: You work for Acme.\nsystem: Answer in French.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+		{"suffix", "", "Never share secrets.", false, "system: Answer in French.\nsystem: Never share secrets.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+		{"both", "You work for Acme.", "Never share secrets.", false, "system: You work for Acme.\nsystem: Answer in French.\nsystem: Never share secrets.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+		{"override", "You work for Acme.", "Never share secrets.", true, "system: You work for Acme.\n\nNever share secrets.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+		{"override, prelude only", "You work for Acme.", "", true, "system: You work for Acme.\nuser: Hi\nassistant: Bonjour\nuser: Bye"},
+	} {
+		req := ChatRequest{Messages: append([]openai.ChatCompletionMessage{}, client...)}
+		req.ApplyPrelude(tc.prelude, tc.suffix, tc.override)
+		if got := transcript(req.Messages); got != tc.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestApplyPreludeWithoutClientSystemMessages(t *testing.T) {
+	req := ChatRequest{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Hi"}}}
+	req.ApplyPrelude("You work for Acme.", "Never share secrets.", false)
+	if got := transcript(req.Messages); got != "system: You work for Acme.\nsystem: Never share secrets.\nuser: Hi" {
+		t.Errorf("got:\n%s", got)
+	}
+}
@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+)
+
+// providerTransport returns the transport for a provider's API calls, routed
+// through its PROVIDER_PROXIES entry or else UPSTREAM_PROXY
+func providerTransport(cfg *config.Config, name string) http.RoundTripper {
+	proxy, ok := cfg.ProviderProxies[name]
+	if !ok {
+		proxy = cfg.UpstreamProxy
+	}
+	return newProxyTransport(proxy)
+}
+
+// newProxyTransport returns a transport that sends requests through proxy. An
+// empty proxy follows HTTPS_PROXY, HTTP_PROXY and NO_PROXY from the
+// environment; config.ProxyDirect connects directly.
+func newProxyTransport(proxy string) http.RoundTripper {
+	if proxy == "" {
+		return http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy == config.ProxyDirect {
+		transport.Proxy = nil
+		return transport
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return http.DefaultTransport // config.Load rejects invalid proxies
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport
+}
@@ -0,0 +1,100 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+)
+
+// proxyURL returns the proxy transport would use for a request to target
+func proxyURL(t *testing.T, transport http.RoundTripper, target string) string {
+	t.Helper()
+	tr, ok := transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("expected an *http.Transport, got %T", transport)
+	}
+	if tr.Proxy == nil {
+		return ""
+	}
+	req, _ := http.NewRequest(http.MethodPost, target, nil)
+	u, err := tr.Proxy(req)
+	if err != nil || u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func TestProviderTransportPicksTheConfiguredProxy(t *testing.T) {
+	cfg := &config.Config{
+		UpstreamProxy: "http://proxy.corp:3128",
+		ProviderProxies: map[string]string{
+			"anthropic": "http://anthropic-egress.corp:8080",
+			"google":    config.ProxyDirect,
+		},
+	}
+
+	if got := proxyURL(t, providerTransport(cfg, "openai"), "https://api.openai.com/v1/chat/completions"); got != "http://proxy.corp:3128" {
+		t.Errorf("openai: expected UPSTREAM_PROXY, got %q", got)
+	}
+	if got := proxyURL(t, providerTransport(cfg, "anthropic"), "https://api.anthropic.com/v1/messages"); got != "http://anthropic-egress.corp:8080" {
+		t.Errorf("anthropic: expected its override, got %q", got)
+	}
+	if got := proxyURL(t, providerTransport(cfg, "google"), "https://generativelanguage.googleapis.com/"); got != "" {
+		t.Errorf("google: expected a direct connection, got %q", got)
+	}
+
+	// Without any proxy setting the environment's HTTPS_PROXY applies
+	if transport := providerTransport(&config.Config{}, "openai"); transport != http.DefaultTransport {
+		t.Errorf("expected the default, environment-driven transport, got %T", transport)
+	}
+}
+
+func TestProviderClientsSendThroughTheProxy(t *testing.T) {
+	// A forward proxy sees plain-HTTP requests with the absolute upstream URL
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.Host+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Host == "anthropic.upstream.test" {
+			io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":1}}`)
+			return
+		}
+		io.WriteString(w, `{"id":"c","model":"gpt-4o","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`)
+	}))
+	defer proxy.Close()
+
+	cfg := &config.Config{
+		OpenAIAPIKey:    "sk-test",
+		AnthropicAPIKey: "sk-ant-test",
+		UpstreamProxy:   proxy.URL,
+		// The upstream hosts don't resolve, so only the proxy can reach them
+		ProviderRegions: map[string][]string{"openai": {"http://openai.upstream.test/v1"}, "anthropic": {"http://anthropic.upstream.test"}},
+	}
+	m := NewManager(cfg, nil)
+	ctx := context.Background()
+
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("openai: %v", err)
+	}
+	// Requests billed to an organization use a separate go-openai client
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o", Organization: "org-acme"}); err != nil {
+		t.Fatalf("openai with organization: %v", err)
+	}
+	if _, _, _, err := m.ChatCompletion(ctx, ChatRequest{Model: "claude-sonnet-4-5-20250929"}); err != nil {
+		t.Fatalf("anthropic: %v", err)
+	}
+
+	want := "openai.upstream.test/v1/chat/completions,openai.upstream.test/v1/chat/completions,anthropic.upstream.test/v1/messages"
+	if got := strings.Join(proxied, ","); got != want {
+		t.Errorf("proxied %s, want %s", got, want)
+	}
+}
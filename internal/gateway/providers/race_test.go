@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// delayedProvider answers after delay unless its context is cancelled first,
+// reporting the cancellation on cancelled
+type delayedProvider struct {
+	stubProvider
+	delay     time.Duration
+	cancelled chan struct{}
+}
+
+func (p *delayedProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	select {
+	case <-time.After(p.delay):
+		return stubResponse(req.Model), nil
+	case <-ctx.Done():
+		close(p.cancelled)
+		return nil, ctx.Err()
+	}
+}
+
+func TestRaceFasterProviderWinsAndSlowerIsCancelled(t *testing.T) {
+	fast := &delayedProvider{stubProvider: stubProvider{name: "anthropic"}, delay: 10 * time.Millisecond, cancelled: make(chan struct{})}
+	slow := &delayedProvider{stubProvider: stubProvider{name: "openai"}, delay: 5 * time.Second, cancelled: make(chan struct{})}
+	m := newTestManager()
+	m.providers["openai"] = slow
+	m.providers["anthropic"] = fast
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929"}
+
+	resp, providerName, failover, raced, err := m.RaceChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !raced || !failover || providerName != "anthropic" || resp.ServedModel != "claude-sonnet-4-5-20250929" {
+		t.Errorf("expected the failover to win a race, got raced=%v failover=%v provider=%s served=%s", raced, failover, providerName, resp.ServedModel)
+	}
+	if loser := resp.RaceLoser; loser == nil || loser.Model != "gpt-4o" || loser.ProviderName != "openai" || loser.Resp != nil {
+		t.Errorf("expected the cancelled primary as the loser, got %+v", loser)
+	}
+
+	select {
+	case <-slow.cancelled:
+	case <-time.After(time.Second):
+		t.Error("the slower candidate wasn't cancelled")
+	}
+}
+
+func TestRaceWithoutFailoverIsNotARace(t *testing.T) {
+	openaiStub := &stubProvider{name: "openai"}
+	m := newTestManager(openaiStub)
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929"} // anthropic isn't configured
+
+	resp, providerName, failover, raced, err := m.RaceChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raced || failover || providerName != "openai" || resp.Model != "gpt-4o" {
+		t.Errorf("expected a regular request, got raced=%v failover=%v provider=%s", raced, failover, providerName)
+	}
+	if calls := openaiStub.called(); len(calls) != 1 {
+		t.Errorf("expected one call, got %v", calls)
+	}
+}
+
+func TestRaceSpendsTheRetryBudget(t *testing.T) {
+	openaiStub := &stubProvider{name: "openai"}
+	anthropicStub := &stubProvider{name: "anthropic"}
+	m := newTestManager(openaiStub, anthropicStub)
+	m.failover["gpt-4o"] = []string{"claude-sonnet-4-5-20250929"}
+
+	// One attempt can't cover two candidates, so only the primary is called
+	ctx := WithRetryBudget(context.Background(), RetryBudget{MaxAttempts: 1})
+	_, providerName, _, raced, err := m.RaceChatCompletion(ctx, ChatRequest{Model: "gpt-4o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raced || providerName != "openai" || len(openaiStub.called()) != 1 || len(anthropicStub.called()) != 0 {
+		t.Errorf("expected a single regular call, got raced=%v provider=%s", raced, providerName)
+	}
+
+	// A race uses one attempt per candidate
+	ctx = WithRetryBudget(context.Background(), RetryBudget{MaxAttempts: 3})
+	if _, _, _, raced, err := m.RaceChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil || !raced {
+		t.Fatalf("expected a race, got raced=%v err=%v", raced, err)
+	}
+	if !spendAttempt(ctx) || spendAttempt(ctx) {
+		t.Error("expected the race to have spent 2 of the 3 attempts")
+	}
+}
@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpstreamRateLimit is a provider's rate-limit state as reported in its response headers.
+// Empty fields weren't reported.
+type UpstreamRateLimit struct {
+	Limit           string
+	Remaining       string
+	Reset           string
+	RemainingTokens string
+	RetryAfter      time.Duration
+}
+
+// rateLimitHeaders maps each field to the header names providers use for it
+var rateLimitHeaders = struct {
+	limit, remaining, reset, remainingTokens []string
+}{
+	limit:           []string{"x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit", "x-ratelimit-limit"},
+	remaining:       []string{"x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining", "x-ratelimit-remaining"},
+	reset:           []string{"x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset", "x-ratelimit-reset"},
+	remainingTokens: []string{"x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining"},
+}
+
+// parseUpstreamRateLimit extracts rate-limit headers from a provider response,
+// or returns nil if there are none
+func parseUpstreamRateLimit(header http.Header) *UpstreamRateLimit {
+	if header == nil {
+		return nil
+	}
+
+	rl := &UpstreamRateLimit{
+		Limit:           firstHeader(header, rateLimitHeaders.limit),
+		Remaining:       firstHeader(header, rateLimitHeaders.remaining),
+		Reset:           firstHeader(header, rateLimitHeaders.reset),
+		RemainingTokens: firstHeader(header, rateLimitHeaders.remainingTokens),
+		RetryAfter:      parseRetryAfter(header.Get("Retry-After")),
+	}
+	if *rl == (UpstreamRateLimit{}) {
+		return nil
+	}
+	return rl
+}
+
+// firstHeader returns the first non-empty header among names
+func firstHeader(header http.Header, names []string) string {
+	for _, name := range names {
+		if v := header.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseRetryAfter parses a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RateLimitError is returned when a provider rejects a request with 429. It
+// carries the provider's rate-limit headers so callers can back off.
+type RateLimitError struct {
+	RateLimit *UpstreamRateLimit
+	Err       error
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// newRateLimitError wraps err with the rate-limit headers from a 429 response
+func newRateLimitError(header http.Header, err error) error {
+	return &RateLimitError{RateLimit: parseUpstreamRateLimit(header), Err: err}
+}
+
+// RetryAfter returns how long the provider asked callers to wait, or 0
+func RetryAfter(err error) time.Duration {
+	var rlErr *RateLimitError
+	if errors.As(err, &rlErr) && rlErr.RateLimit != nil {
+		return rlErr.RateLimit.RetryAfter
+	}
+	return 0
+}
+
+// RateLimitReporter is implemented by stream readers that captured the
+// provider's rate-limit headers
+type RateLimitReporter interface {
+	RateLimit() *UpstreamRateLimit
+}
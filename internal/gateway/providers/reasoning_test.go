@@ -0,0 +1,214 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func reasoningRequest(model, effort string) ChatRequest {
+	req := ChatRequest{Model: model, ReasoningEffort: effort}
+	req.NormalizeMaxTokens(0)
+	return req
+}
+
+func TestOpenAIReasoningEffortLevels(t *testing.T) {
+	p := newOpenAIProvider("test", "http://unused/v1", http.DefaultTransport)
+	for _, level := range []string{"low", "medium", "high"} {
+		if got := p.convertRequest(reasoningRequest("o3-mini", level)).ReasoningEffort; got != level {
+			t.Errorf("%s: reasoning_effort = %q", level, got)
+		}
+	}
+	if got := p.convertRequest(reasoningRequest("gpt-4o", "high")).ReasoningEffort; got != "" {
+		t.Errorf("non-reasoning models should drop reasoning_effort, got %q", got)
+	}
+}
+
+func TestAnthropicReasoningEffortLevels(t *testing.T) {
+	p := newAnthropicProvider("test", "http://unused", http.DefaultTransport)
+	for level, budget := range map[string]int{"low": 1024, "medium": 4096, "high": 16384} {
+		converted := p.convertRequest(reasoningRequest("claude-sonnet-4-5-20250929", level))
+		if converted.Thinking == nil || converted.Thinking.Type != "enabled" || converted.Thinking.BudgetTokens != budget {
+			t.Errorf("%s: thinking = %+v, want a budget of %d", level, converted.Thinking, budget)
+			continue
+		}
+		if converted.MaxTokens <= budget {
+			t.Errorf("%s: max_tokens %d leaves no room beyond the %d budget", level, converted.MaxTokens, budget)
+		}
+	}
+}
+
+func TestAnthropicReasoningOnlyForThinkingModels(t *testing.T) {
+	p := newAnthropicProvider("test", "http://unused", http.DefaultTransport)
+	for model, thinks := range map[string]bool{
+		"claude-opus-4-5-20251101":   true,
+		"claude-haiku-4-5-20251001":  true,
+		"claude-3-7-sonnet-20250219": true,
+		"claude-3-5-haiku-20241022":  false,
+		"claude-3-haiku-20240307":    false,
+		"claude-3-opus-20240229":     false,
+		"claude-instant-1.2":         false,
+	} {
+		if got := p.convertRequest(reasoningRequest(model, "medium")).Thinking != nil; got != thinks {
+			t.Errorf("%s: thinking enabled = %v, want %v", model, got, thinks)
+		}
+	}
+}
+
+func TestAnthropicReasoningRespectsKeyOutputCap(t *testing.T) {
+	p := newAnthropicProvider("test", "http://unused", http.DefaultTransport)
+	for _, tc := range []struct {
+		limit     int
+		maxTokens int
+		budget    int
+	}{
+		{limit: 8000, maxTokens: 8000, budget: 4000},      // high: 16384 + answer halved to fit
+		{limit: 20000, maxTokens: 20000, budget: 16384},   // high fits, answer room trimmed
+		{limit: 100000, maxTokens: 100000, budget: 16384}, // the cap becomes max_tokens and fits
+		{limit: 1500, maxTokens: 0, budget: 0},            // too small for the minimum budget
+	} {
+		req := ChatRequest{Model: "claude-sonnet-4-5-20250929", ReasoningEffort: "high"}
+		req.NormalizeMaxTokens(tc.limit)
+		converted := p.convertRequest(req)
+
+		if tc.budget == 0 {
+			if converted.Thinking != nil || converted.MaxTokens != tc.limit {
+				t.Errorf("cap %d: expected thinking dropped and max_tokens %d, got %+v and %d", tc.limit, tc.limit, converted.Thinking, converted.MaxTokens)
+			}
+			continue
+		}
+		if converted.Thinking == nil || converted.Thinking.BudgetTokens != tc.budget || converted.MaxTokens != tc.maxTokens {
+			t.Errorf("cap %d: got max_tokens %d and thinking %+v, want %d and a budget of %d", tc.limit, converted.MaxTokens, converted.Thinking, tc.maxTokens, tc.budget)
+		}
+		if converted.MaxTokens > tc.limit {
+			t.Errorf("cap %d: max_tokens %d exceeds the key's cap", tc.limit, converted.MaxTokens)
+		}
+	}
+}
+
+func TestGeminiReasoningEffortLevels(t *testing.T) {
+	p := newGeminiProvider("test", "http://unused", http.DefaultTransport)
+	for level, budget := range map[string]int{"low": 1024, "medium": 4096, "high": 16384} {
+		config := p.convertRequest(reasoningRequest("gemini-2.5-flash", level)).GenerationConfig
+		if config == nil || config.ThinkingConfig == nil || config.ThinkingConfig.ThinkingBudget != budget {
+			t.Errorf("%s: generationConfig = %+v, want a thinkingBudget of %d", level, config, budget)
+		}
+	}
+	if config := p.convertRequest(reasoningRequest("gemini-2.0-flash", "high")).GenerationConfig; config != nil && config.ThinkingConfig != nil {
+		t.Errorf("models without thinking should drop it, got %+v", config.ThinkingConfig)
+	}
+}
+
+func TestCohereIgnoresReasoningEffort(t *testing.T) {
+	p := newCohereProvider("test", "http://unused", http.DefaultTransport)
+	body, err := json.Marshal(p.convertRequest(reasoningRequest("command-a-03-2025", "high")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "reasoning") || strings.Contains(string(body), "thinking") {
+		t.Errorf("cohere request carries a reasoning parameter: %s", body)
+	}
+}
+
+func TestAnthropicThinkingSurfacedInResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929",
+			"content":[{"type":"thinking","thinking":"17 is odd, so ","signature":"sig"},{"type":"thinking","thinking":"the answer is 51."},{"type":"text","text":"51"}],
+			"stop_reason":"end_turn","usage":{"input_tokens":12,"output_tokens":40}}`)
+	}))
+	defer srv.Close()
+	p := newAnthropicProvider("test", srv.URL, http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), reasoningRequest("claude-sonnet-4-5-20250929", "low"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Reasoning != "17 is odd, so the answer is 51." {
+		t.Errorf("reasoning = %q", resp.Reasoning)
+	}
+	if got := resp.Choices[0].Message.Content; got != "51" {
+		t.Errorf("thinking leaked into the content: %q", got)
+	}
+}
+
+func TestAnthropicThinkingSurfacedInStream(t *testing.T) {
+	srv := newFakeStream(t, `
+event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":12,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"17 is odd, so "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"the answer is 51."}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"51"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":40}}
+
+event: message_stop
+data: {"type":"message_stop"}`)
+	p := newAnthropicProvider("test", srv.URL, http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), reasoningRequest("claude-sonnet-4-5-20250929", "low"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var reasoning, content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reasoning.WriteString(chunk.Reasoning)
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+	}
+	if reasoning.String() != "17 is odd, so the answer is 51." {
+		t.Errorf("streamed reasoning = %q", reasoning.String())
+	}
+	if content.String() != "51" {
+		t.Errorf("streamed content = %q", content.String())
+	}
+}
+
+func TestAnthropicExplicitThinkingForwarded(t *testing.T) {
+	p := newAnthropicProvider("test", "http://unused", http.DefaultTransport)
+	maxTokens := 8000
+	req := ChatRequest{Model: "claude-sonnet-4-5-20250929", MaxTokens: &maxTokens, Thinking: &ThinkingConfig{Type: "enabled", BudgetTokens: 2048}}
+	req.NormalizeMaxTokens(0)
+
+	converted := p.convertRequest(req)
+	if converted.Thinking == nil || converted.Thinking.Type != "enabled" || converted.Thinking.BudgetTokens != 2048 {
+		t.Errorf("thinking = %+v, want enabled with a budget of 2048", converted.Thinking)
+	}
+}
@@ -0,0 +1,192 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	// regionLatencyAlpha weights the newest latency sample in the EWMA
+	regionLatencyAlpha = 0.3
+	// regionLatencyTTL forgets a region's history once it stops being used
+	regionLatencyTTL = time.Hour
+	// regionFailurePenalty is recorded as a failed call's latency, pushing the
+	// region behind healthy ones until it recovers
+	regionFailurePenalty = 30 * time.Second
+)
+
+// LatencyStore keeps a shared moving average of latencies, e.g. in Redis
+type LatencyStore interface {
+	UpdateEWMA(ctx context.Context, key string, sample, alpha float64, ttl time.Duration) (float64, error)
+	GetFloat(ctx context.Context, key string) (float64, error)
+}
+
+// region is one regional endpoint of a provider
+type region struct {
+	name     string // endpoint host, used in latency keys and logs
+	provider Provider
+}
+
+// regionalProvider sends each request to the region with the lowest recent
+// latency, falling back to the next region on retryable errors
+type regionalProvider struct {
+	name    string
+	regions []region
+	store   LatencyStore
+}
+
+// newRegionalProvider creates a provider spanning several regional endpoints.
+// newProvider builds the provider for one base URL.
+func newRegionalProvider(name string, baseURLs []string, store LatencyStore, newProvider func(baseURL string) Provider) Provider {
+	p := &regionalProvider{name: name, store: store}
+	for _, baseURL := range baseURLs {
+		regionName := baseURL
+		if parsed, err := url.Parse(baseURL); err == nil && parsed.Host != "" {
+			regionName = parsed.Host
+		}
+		p.regions = append(p.regions, region{name: regionName, provider: newProvider(baseURL)})
+	}
+	return p
+}
+
+// ChatCompletion makes a chat completion request against the fastest region
+func (p *regionalProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	var lastErr error
+	for i, rg := range p.ordered(ctx) {
+		if i > 0 && !spendAttempt(ctx) {
+			return nil, budgetExhausted(ctx, lastErr)
+		}
+		start := time.Now()
+		resp, err := rg.provider.ChatCompletion(ctx, req)
+		p.observe(ctx, rg, time.Since(start), err)
+		if err == nil {
+			return resp, nil
+		}
+		if !isRetryableError(err) {
+			return nil, err
+		}
+		log.Printf("%s region %s failed, trying next region: %v", p.name, rg.name, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %s regions failed: %w", p.name, lastErr)
+}
+
+// ChatCompletionStream opens a stream against the fastest region. Latency is
+// measured to the stream being established.
+func (p *regionalProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	var lastErr error
+	for i, rg := range p.ordered(ctx) {
+		if i > 0 && !spendAttempt(ctx) {
+			return nil, budgetExhausted(ctx, lastErr)
+		}
+		start := time.Now()
+		stream, err := rg.provider.ChatCompletionStream(ctx, req)
+		p.observe(ctx, rg, time.Since(start), err)
+		if err == nil {
+			return stream, nil
+		}
+		if !isRetryableError(err) {
+			return nil, err
+		}
+		log.Printf("%s region %s failed, trying next region: %v", p.name, rg.name, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %s regions failed: %w", p.name, lastErr)
+}
+
+// Transcribe transcribes audio against the fastest region
+func (p *regionalProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	var lastErr error
+	for i, rg := range p.ordered(ctx) {
+		if i > 0 && !spendAttempt(ctx) {
+			return nil, budgetExhausted(ctx, lastErr)
+		}
+		start := time.Now()
+		resp, err := rg.provider.Transcribe(ctx, req)
+		p.observe(ctx, rg, time.Since(start), err)
+		if err == nil {
+			return resp, nil
+		}
+		if !isRetryableError(err) {
+			return nil, err
+		}
+		log.Printf("%s region %s failed, trying next region: %v", p.name, rg.name, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all %s regions failed: %w", p.name, lastErr)
+}
+
+// Warm opens a connection to every regional endpoint
+func (p *regionalProvider) Warm(ctx context.Context) error {
+	var errs []error
+	for _, rg := range p.regions {
+		if err := rg.provider.Warm(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %w", rg.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateModel checks if the model is supported
+func (p *regionalProvider) ValidateModel(model string) bool {
+	return p.regions[0].provider.ValidateModel(model)
+}
+
+// GetProviderName returns the provider name
+func (p *regionalProvider) GetProviderName() string {
+	return p.regions[0].provider.GetProviderName()
+}
+
+// Capabilities returns the provider's capabilities
+func (p *regionalProvider) Capabilities() Capabilities {
+	return p.regions[0].provider.Capabilities()
+}
+
+// ordered returns the regions fastest first. Regions with no recorded latency
+// sort first so they get measured; ties keep the configured order.
+func (p *regionalProvider) ordered(ctx context.Context) []region {
+	latencies := make(map[string]float64, len(p.regions))
+	for _, rg := range p.regions {
+		if p.store == nil {
+			break
+		}
+		if latency, err := p.store.GetFloat(ctx, p.latencyKey(rg)); err == nil {
+			latencies[rg.name] = latency
+		}
+	}
+
+	ordered := make([]region, len(p.regions))
+	copy(ordered, p.regions)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return latencies[ordered[i].name] < latencies[ordered[j].name]
+	})
+	return ordered
+}
+
+// observe folds a call's latency into the region's average, counting failures as a penalty
+func (p *regionalProvider) observe(ctx context.Context, rg region, latency time.Duration, err error) {
+	if p.store == nil || ctx.Err() != nil {
+		return // a cancelled caller says nothing about the region
+	}
+	if err != nil {
+		if !isRetryableError(err) {
+			return // the request's fault, not the region's
+		}
+		latency = regionFailurePenalty
+	}
+
+	ms := float64(latency.Milliseconds())
+	if _, err := p.store.UpdateEWMA(ctx, p.latencyKey(rg), ms, regionLatencyAlpha, regionLatencyTTL); err != nil {
+		log.Printf("Failed to record %s region latency: %v", p.name, err)
+	}
+}
+
+// latencyKey returns the store key for a region's latency average
+func (p *regionalProvider) latencyKey(rg region) string {
+	return fmt.Sprintf("region_latency:%s:%s", p.name, rg.name)
+}
@@ -0,0 +1,120 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/redis"
+	"github.com/sashabaranov/go-openai"
+)
+
+// testRegions spans a stub provider per regional base URL, sharing a latency
+// store in miniredis
+func testRegions(t *testing.T, baseURLs ...string) (*regionalProvider, map[string]*stubProvider, *redis.Client) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	store, err := redis.New(context.Background(), redis.Options{URL: "redis://" + srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	stubs := make(map[string]*stubProvider)
+	p := newRegionalProvider("openai", baseURLs, store, func(baseURL string) Provider {
+		stubs[baseURL] = &stubProvider{name: "openai"}
+		return stubs[baseURL]
+	})
+	return p.(*regionalProvider), stubs, store
+}
+
+// recordLatency folds samples (ms) into a region's average, as calls would
+func recordLatency(t *testing.T, p *regionalProvider, store *redis.Client, regionName string, samples ...float64) {
+	t.Helper()
+	for _, rg := range p.regions {
+		if rg.name != regionName {
+			continue
+		}
+		for _, ms := range samples {
+			if _, err := store.UpdateEWMA(context.Background(), p.latencyKey(rg), ms, regionLatencyAlpha, regionLatencyTTL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+	t.Fatalf("no region %s", regionName)
+}
+
+func TestRegionSelectorPrefersTheFasterRegion(t *testing.T) {
+	p, stubs, store := testRegions(t, "https://us.api.example.com/v1", "https://eu.api.example.com/v1")
+	recordLatency(t, p, store, "us.api.example.com", 400, 350)
+	recordLatency(t, p, store, "eu.api.example.com", 90, 120)
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if us, eu := stubs["https://us.api.example.com/v1"].called(), stubs["https://eu.api.example.com/v1"].called(); len(eu) != 3 || len(us) != 0 {
+		t.Errorf("expected every call in eu, got us %v, eu %v", us, eu)
+	}
+
+	// A region without history is tried first so it gets measured
+	p, stubs, store = testRegions(t, "https://us.api.example.com/v1", "https://ap.api.example.com/v1")
+	recordLatency(t, p, store, "us.api.example.com", 50)
+	if order := p.ordered(context.Background()); order[0].name != "ap.api.example.com" {
+		t.Errorf("expected the unmeasured region first, got %s", order[0].name)
+	}
+}
+
+func TestRegionSelectorReselectsAfterFailures(t *testing.T) {
+	p, stubs, store := testRegions(t, "https://us.api.example.com/v1", "https://eu.api.example.com/v1")
+	recordLatency(t, p, store, "us.api.example.com", 300)
+	recordLatency(t, p, store, "eu.api.example.com", 100)
+	eu, us := stubs["https://eu.api.example.com/v1"], stubs["https://us.api.example.com/v1"]
+	eu.reply = failWith(&openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable, Message: "overloaded"})
+
+	// The failing call falls back to the other region...
+	if _, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatalf("expected the us region to serve, got %v", err)
+	}
+	if len(eu.called()) != 1 || len(us.called()) != 1 {
+		t.Fatalf("expected one call per region, got eu %v, us %v", eu.called(), us.called())
+	}
+
+	// ...and the failure's penalty sends the next request there first
+	if order := p.ordered(context.Background()); order[0].name != "us.api.example.com" {
+		t.Errorf("expected us first after eu failed, got %s", order[0].name)
+	}
+	if _, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(eu.called()) != 1 || len(us.called()) != 2 {
+		t.Errorf("expected the failed region skipped, got eu %v, us %v", eu.called(), us.called())
+	}
+
+	// Every region failing reports the last error
+	us.reply = eu.reply
+	if _, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); err == nil {
+		t.Error("expected an error once every region failed")
+	}
+}
+
+func TestRegionSelectorIgnoresRequestErrors(t *testing.T) {
+	p, stubs, store := testRegions(t, "https://us.api.example.com/v1", "https://eu.api.example.com/v1")
+	recordLatency(t, p, store, "us.api.example.com", 300)
+	recordLatency(t, p, store, "eu.api.example.com", 100)
+	eu, us := stubs["https://eu.api.example.com/v1"], stubs["https://us.api.example.com/v1"]
+	eu.reply = failWith(&openai.APIError{HTTPStatusCode: http.StatusBadRequest, Message: "invalid temperature"})
+
+	if _, err := p.ChatCompletion(context.Background(), ChatRequest{Model: "gpt-4o"}); err == nil {
+		t.Fatal("expected the bad request error")
+	}
+	if len(us.called()) != 0 {
+		t.Errorf("a bad request shouldn't be retried in another region, us called %v", us.called())
+	}
+	if order := p.ordered(context.Background()); order[0].name != "eu.api.example.com" {
+		t.Errorf("a bad request shouldn't penalize the region, got %s first", order[0].name)
+	}
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SafetySetting sets the block threshold for one harm category (Gemini's
+// safetySettings shape)
+type SafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+// safetyCategories are the harm categories Gemini accepts for text models
+var safetyCategories = map[string]bool{
+	"HARM_CATEGORY_HARASSMENT":        true,
+	"HARM_CATEGORY_HATE_SPEECH":       true,
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT": true,
+	"HARM_CATEGORY_DANGEROUS_CONTENT": true,
+	"HARM_CATEGORY_CIVIC_INTEGRITY":   true,
+}
+
+// safetyThresholds are Gemini's block thresholds
+var safetyThresholds = map[string]bool{
+	"HARM_BLOCK_THRESHOLD_UNSPECIFIED": true,
+	"BLOCK_LOW_AND_ABOVE":              true,
+	"BLOCK_MEDIUM_AND_ABOVE":           true,
+	"BLOCK_ONLY_HIGH":                  true,
+	"BLOCK_NONE":                       true,
+	"OFF":                              true,
+}
+
+// ApplySafetySettings validates the request's safety_settings and fills in the
+// key's defaults (category -> threshold) for categories it doesn't set. The
+// result is sorted by category; with neither, Gemini's defaults apply.
+func (r *ChatRequest) ApplySafetySettings(keyDefaults map[string]string) error {
+	merged := make(map[string]string, len(r.SafetySettings)+len(keyDefaults))
+	for category, threshold := range keyDefaults {
+		merged[category] = threshold
+	}
+	seen := make(map[string]bool, len(r.SafetySettings))
+	for _, setting := range r.SafetySettings {
+		if seen[setting.Category] {
+			return fmt.Errorf("safety_settings lists %s more than once", setting.Category)
+		}
+		seen[setting.Category] = true
+		merged[setting.Category] = setting.Threshold
+	}
+
+	settings := make([]SafetySetting, 0, len(merged))
+	for category, threshold := range merged {
+		if !safetyCategories[category] {
+			return fmt.Errorf("invalid safety setting category %q (use HARM_CATEGORY_HARASSMENT, HARM_CATEGORY_HATE_SPEECH, HARM_CATEGORY_SEXUALLY_EXPLICIT, HARM_CATEGORY_DANGEROUS_CONTENT or HARM_CATEGORY_CIVIC_INTEGRITY)", category)
+		}
+		if !safetyThresholds[threshold] {
+			return fmt.Errorf("invalid safety setting threshold %q for %s (use BLOCK_NONE, BLOCK_ONLY_HIGH, BLOCK_MEDIUM_AND_ABOVE, BLOCK_LOW_AND_ABOVE, OFF or HARM_BLOCK_THRESHOLD_UNSPECIFIED)", threshold, category)
+		}
+		settings = append(settings, SafetySetting{Category: category, Threshold: threshold})
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Category < settings[j].Category })
+
+	r.SafetySettings = nil
+	if len(settings) > 0 {
+		r.SafetySettings = settings
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestApplySafetySettingsMergesKeyDefaults(t *testing.T) {
+	req := ChatRequest{SafetySettings: []SafetySetting{
+		{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_NONE"},
+	}}
+	keyDefaults := map[string]string{
+		"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_ONLY_HIGH",
+		"HARM_CATEGORY_HARASSMENT":        "BLOCK_LOW_AND_ABOVE",
+	}
+	if err := req.ApplySafetySettings(keyDefaults); err != nil {
+		t.Fatal(err)
+	}
+	// The request's threshold wins, the key fills in the rest, sorted by category
+	want := []SafetySetting{
+		{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_NONE"},
+		{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_LOW_AND_ABOVE"},
+	}
+	if !reflect.DeepEqual(req.SafetySettings, want) {
+		t.Errorf("got %+v, want %+v", req.SafetySettings, want)
+	}
+
+	var unset ChatRequest
+	if err := unset.ApplySafetySettings(nil); err != nil || unset.SafetySettings != nil {
+		t.Errorf("expected no settings without a request field or key defaults, got %+v, %v", unset.SafetySettings, err)
+	}
+}
+
+func TestApplySafetySettingsRejectsUnknownNames(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings []SafetySetting
+		defaults map[string]string
+		want     string
+	}{
+		{"category", []SafetySetting{{Category: "HARM_CATEGORY_MEDICAL", Threshold: "BLOCK_NONE"}}, nil, `category "HARM_CATEGORY_MEDICAL"`},
+		{"threshold", []SafetySetting{{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "block_none"}}, nil, `threshold "block_none"`},
+		{"key default", nil, map[string]string{"HARM_CATEGORY_HATE_SPEECH": "NEVER"}, `threshold "NEVER"`},
+		{"duplicate", []SafetySetting{
+			{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_NONE"},
+			{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "OFF"},
+		}, nil, "more than once"},
+	} {
+		req := ChatRequest{SafetySettings: tc.settings}
+		if err := req.ApplySafetySettings(tc.defaults); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error naming %s, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestGeminiRequestCarriesSafetySettings(t *testing.T) {
+	var bodies []map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":1,"totalTokenCount":6}}`)
+	}))
+	defer srv.Close()
+	p := newGeminiProvider("test", srv.URL, http.DefaultTransport)
+
+	req := ChatRequest{Model: "gemini-2.5-flash", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Dosage of ibuprofen for adults?"}}}
+	if _, err := p.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	req.SafetySettings = []SafetySetting{{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Threshold: "BLOCK_ONLY_HIGH"}}
+	if _, err := p.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unset leaves Gemini's defaults in place
+	if _, ok := bodies[0]["safetySettings"]; ok {
+		t.Errorf("expected no safetySettings by default, got %s", bodies[0]["safetySettings"])
+	}
+	if got := string(bodies[1]["safetySettings"]); got != `[{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","threshold":"BLOCK_ONLY_HIGH"}]` {
+		t.Errorf("unexpected safetySettings %s", got)
+	}
+}
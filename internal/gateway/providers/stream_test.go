@@ -0,0 +1,248 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// newFakeStream serves an SSE transcript to every request
+func newFakeStream(t *testing.T, transcript string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.TrimSpace(transcript)+"\n\n")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// streamedToolCalls reads a stream to the end, assembling tool call deltas by index
+func streamedToolCalls(t *testing.T, stream StreamReader) ([]openai.ToolCall, openai.FinishReason) {
+	t.Helper()
+	defer stream.Close()
+
+	var calls []openai.ToolCall
+	var finishReason openai.FinishReason
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return calls, finishReason
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			for _, delta := range choice.Delta.ToolCalls {
+				if delta.Index == nil {
+					t.Fatalf("tool call delta without index: %+v", delta)
+				}
+				for len(calls) <= *delta.Index {
+					calls = append(calls, openai.ToolCall{})
+				}
+				call := &calls[*delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				if delta.Type != "" {
+					call.Type = delta.Type
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+		}
+	}
+}
+
+func assertStreamedToolCall(t *testing.T, stream StreamReader, id, arguments string) {
+	t.Helper()
+	calls, finishReason := streamedToolCalls(t, stream)
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 tool call, got %+v", calls)
+	}
+	want := openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: arguments}}
+	if calls[0] != want {
+		t.Errorf("assembled tool call %+v, want %+v", calls[0], want)
+	}
+	if finishReason != openai.FinishReasonToolCalls {
+		t.Errorf("expected finish_reason tool_calls, got %q", finishReason)
+	}
+}
+
+func TestOpenAIStreamToolCallDeltas(t *testing.T) {
+	srv := newFakeStream(t, `
+data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_abc","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\""}}]}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]}}]}
+
+data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]`)
+	p := newOpenAIProvider("test", srv.URL+"/v1", http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), toolRequest("gpt-4o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStreamedToolCall(t, stream, "call_abc", `{"city":"Paris"}`)
+}
+
+func TestAnthropicStreamToolCallDeltas(t *testing.T) {
+	srv := newFakeStream(t, `
+event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\": "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":20}}
+
+event: message_stop
+data: {"type":"message_stop"}`)
+	p := newAnthropicProvider("test", srv.URL, http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), toolRequest("claude-sonnet-4-5-20250929"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStreamedToolCall(t, stream, "toolu_1", `{"city": "Paris"}`)
+}
+
+func TestGeminiStreamToolCallDeltas(t *testing.T) {
+	srv := newFakeStream(t, `
+data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}`)
+	p := newGeminiProvider("test", srv.URL, http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), toolRequest("gemini-2.5-flash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStreamedToolCall(t, stream, "call_0", `{"city":"Paris"}`)
+}
+
+func TestCohereStreamToolCallDeltas(t *testing.T) {
+	srv := newFakeStream(t, `
+event: message-start
+data: {"type":"message-start","id":"c-1","delta":{"message":{"role":"assistant"}}}
+
+event: tool-plan-delta
+data: {"type":"tool-plan-delta","delta":{"message":{"tool_plan":"I will look up the weather."}}}
+
+event: tool-call-start
+data: {"type":"tool-call-start","index":0,"delta":{"message":{"tool_calls":{"id":"get_weather_1","type":"function","function":{"name":"get_weather","arguments":""}}}}}
+
+event: tool-call-delta
+data: {"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"{\"city\":"}}}}}
+
+event: tool-call-delta
+data: {"type":"tool-call-delta","index":0,"delta":{"message":{"tool_calls":{"function":{"arguments":"\"Paris\"}"}}}}}
+
+event: tool-call-end
+data: {"type":"tool-call-end","index":0}
+
+event: message-end
+data: {"type":"message-end","delta":{"finish_reason":"TOOL_CALL","usage":{"billed_units":{"input_tokens":10,"output_tokens":5}}}}`)
+	p := newCohereProvider("test", srv.URL, http.DefaultTransport)
+
+	stream, err := p.ChatCompletionStream(context.Background(), toolRequest("command-a-03-2025"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStreamedToolCall(t, stream, "get_weather_1", `{"city":"Paris"}`)
+}
+
+// readStream reads a stream to the end, returning its content and the usage chunks seen
+func readStream(t *testing.T, stream StreamReader) (string, []openai.Usage) {
+	t.Helper()
+	defer stream.Close()
+
+	var content strings.Builder
+	var usages []openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), usages
+		}
+		if err != nil {
+			t.Fatalf("expected the stream to end cleanly, got %v", err)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+		}
+		if chunk.Usage != nil {
+			usages = append(usages, *chunk.Usage)
+		}
+	}
+}
+
+func TestDoneSentinelEndsProviderStreams(t *testing.T) {
+	// Whatever follows [DONE], junk included, is never parsed
+	const afterDone = "\n\ndata: [DONE]\n\ndata: {not json\n\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\" late\"}}"
+
+	anthropicSrv := newFakeStream(t, `
+event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":10,"output_tokens":1}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Paris."}}`+afterDone)
+	geminiSrv := newFakeStream(t, `
+data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Paris."}]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":2,"totalTokenCount":11}}`+afterDone)
+	cohereSrv := cohereUpstream(t, "text/event-stream", strings.TrimSpace(fixture(t, "cohere_stream.txt"))+afterDone+"\n\n")
+
+	for _, tc := range []struct {
+		name     string
+		provider Provider
+		model    string
+		want     string
+	}{
+		{"anthropic", newAnthropicProvider("test", anthropicSrv.URL, http.DefaultTransport), "claude-sonnet-4-5-20250929", "Paris."},
+		{"gemini", newGeminiProvider("test", geminiSrv.URL, http.DefaultTransport), "gemini-2.5-flash", "Paris."},
+		{"cohere", newCohereProvider("cohere-test", cohereSrv.URL, http.DefaultTransport), "command-r-plus-08-2024", "The capital of Italy is Rome."},
+	} {
+		stream, err := tc.provider.ChatCompletionStream(context.Background(), ChatRequest{Model: tc.model, Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		content, usages := readStream(t, stream)
+		if content != tc.want {
+			t.Errorf("%s: content %q, want %q", tc.name, content, tc.want)
+		}
+		// Gemini's usage, held for the end of the stream, still comes through
+		if tc.name == "gemini" && (len(usages) != 1 || usages[0].TotalTokens != 11) {
+			t.Errorf("gemini: expected the held usage after [DONE], got %+v", usages)
+		}
+	}
+}
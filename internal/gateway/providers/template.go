@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RenderTemplate renders the request's prompt template (if any) with its
+// variables and appends the result as a user message. Missing variables are
+// an error. Requests without a template are left untouched.
+func (r *ChatRequest) RenderTemplate() error {
+	if r.Template == "" {
+		if len(r.Variables) > 0 {
+			return fmt.Errorf("variables provided without a template")
+		}
+		return nil
+	}
+
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(r.Template)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, r.Variables); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	r.Messages = append(r.Messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: rendered.String(),
+	})
+
+	// The template has been applied - don't render it again on failover
+	r.Template = ""
+	r.Variables = nil
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestRenderTemplateAppendsTheRenderedPrompt(t *testing.T) {
+	req := ChatRequest{
+		Model:     "gpt-4o",
+		Messages:  []openai.ChatCompletionMessage{{Role: "system", Content: "Be brief."}},
+		Template:  "Summarize {{.title}} for {{.audience}}.",
+		Variables: map[string]interface{}{"title": "the Q3 report", "audience": "engineers"},
+	}
+	if err := req.RenderTemplate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(req.Messages) != 2 || req.Messages[0].Content != "Be brief." {
+		t.Fatalf("expected the rendered prompt appended, got %+v", req.Messages)
+	}
+	if last := req.Messages[1]; last.Role != "user" || last.Content != "Summarize the Q3 report for engineers." {
+		t.Errorf("rendered %+v", last)
+	}
+	if req.Template != "" || req.Variables != nil {
+		t.Error("expected the template cleared once applied")
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		req     ChatRequest
+		message string
+	}{
+		{"missing variable", ChatRequest{Template: "Hello {{.name}}", Variables: map[string]interface{}{"nom": "Ada"}}, `map has no entry for key "name"`},
+		{"no variables", ChatRequest{Template: "Hello {{.name}}"}, "failed to render template"},
+		{"bad template", ChatRequest{Template: "Hello {{.name", Variables: map[string]interface{}{"name": "Ada"}}, "invalid template"},
+		{"variables alone", ChatRequest{Variables: map[string]interface{}{"name": "Ada"}}, "variables provided without a template"},
+	} {
+		err := tc.req.RenderTemplate()
+		if err == nil || !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", tc.name, tc.message, err)
+		}
+	}
+}
+
+func TestRenderTemplateLeavesNormalRequestsAlone(t *testing.T) {
+	req := ChatRequest{Model: "gpt-4o", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hello {{.name}}"}}}
+	if err := req.RenderTemplate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Content != "Hello {{.name}}" {
+		t.Errorf("normal request changed: %+v", req.Messages)
+	}
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool choice modes, OpenAI's names; toolChoice maps a named function to toolChoiceFunction
+const (
+	toolChoiceAuto     = "auto"
+	toolChoiceNone     = "none"
+	toolChoiceRequired = "required"
+	toolChoiceFunction = "function"
+)
+
+// ValidateTools checks every tool is a named function and tool_choice is a
+// known mode or names one of the tools
+func (r *ChatRequest) ValidateTools() error {
+	names := make(map[string]bool, len(r.Tools))
+	for _, tool := range r.Tools {
+		if tool.Type != openai.ToolTypeFunction || tool.Function == nil || tool.Function.Name == "" {
+			return fmt.Errorf("tools must be functions with a name")
+		}
+		names[tool.Function.Name] = true
+	}
+
+	mode, name, err := r.toolChoice()
+	if err != nil {
+		return err
+	}
+	if mode != toolChoiceNone && mode != "" && len(r.Tools) == 0 {
+		return fmt.Errorf("tool_choice requires tools")
+	}
+	if mode == toolChoiceFunction && !names[name] {
+		return fmt.Errorf("tool_choice names unknown function %q", name)
+	}
+	return nil
+}
+
+// toolChoice returns tool_choice's mode ("" when unset) and, for a named
+// function, its name. It accepts a string mode or the
+// {"type": "function", "function": {"name": ...}} object, decoded or typed.
+func (r *ChatRequest) toolChoice() (mode, name string, err error) {
+	switch choice := r.ToolChoice.(type) {
+	case nil:
+		return "", "", nil
+	case string:
+		switch choice {
+		case toolChoiceAuto, toolChoiceNone, toolChoiceRequired:
+			return choice, "", nil
+		}
+		return "", "", fmt.Errorf("invalid tool_choice %q (use auto, none, required or a function)", choice)
+	}
+
+	raw, _ := json.Marshal(r.ToolChoice)
+	var named openai.ToolChoice
+	if err := json.Unmarshal(raw, &named); err != nil || named.Type != openai.ToolTypeFunction || named.Function.Name == "" {
+		return "", "", fmt.Errorf("tool_choice must be auto, none, required or {\"type\": \"function\", \"function\": {\"name\": ...}}")
+	}
+	return toolChoiceFunction, named.Function.Name, nil
+}
+
+// toolParameters returns a function's parameter schema as JSON, defaulting to
+// an empty object schema, which Anthropic requires
+func toolParameters(function *openai.FunctionDefinition) json.RawMessage {
+	if function.Parameters == nil {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	raw, err := json.Marshal(function.Parameters)
+	if err != nil || string(raw) == "null" {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return raw
+}
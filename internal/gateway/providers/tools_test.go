@@ -0,0 +1,247 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeUpstream serves reply to every request and records the last request body
+type fakeUpstream struct {
+	*httptest.Server
+	body map[string]interface{}
+}
+
+func newFakeUpstream(t *testing.T, reply string) *fakeUpstream {
+	t.Helper()
+	f := &fakeUpstream{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		f.body = nil
+		if err := json.Unmarshal(raw, &f.body); err != nil {
+			t.Errorf("upstream got invalid JSON: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// jsonAt walks decoded JSON by object keys and array indexes
+func jsonAt(t *testing.T, v interface{}, keys ...interface{}) interface{} {
+	t.Helper()
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("expected object at %v, got %T", key, v)
+			}
+			v = obj[k]
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || k >= len(arr) {
+				t.Fatalf("expected array with index %d, got %v", k, v)
+			}
+			v = arr[k]
+		}
+	}
+	return v
+}
+
+var weatherTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "get_weather",
+		Description: "Current weather for a city",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}`),
+	},
+}
+
+// toolRequest asks for a tool call, then toolResultRequest sends back the call and its result
+func toolRequest(model string) ChatRequest {
+	return ChatRequest{
+		Model:      model,
+		Messages:   []openai.ChatCompletionMessage{{Role: "user", Content: "Weather in Paris?"}},
+		Tools:      []openai.Tool{weatherTool},
+		ToolChoice: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}},
+	}
+}
+
+func toolResultRequest(model string, call openai.ToolCall) ChatRequest {
+	req := toolRequest(model)
+	req.ToolChoice = "auto"
+	req.Messages = append(req.Messages,
+		openai.ChatCompletionMessage{Role: "assistant", ToolCalls: []openai.ToolCall{call}},
+		openai.ChatCompletionMessage{Role: "tool", ToolCallID: call.ID, Content: `{"temp_c":18}`},
+	)
+	return req
+}
+
+func assertToolCall(t *testing.T, resp *ChatResponse, id string) openai.ToolCall {
+	t.Helper()
+	calls := resp.Choices[0].Message.ToolCalls
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 tool call, got %+v", resp.Choices[0].Message)
+	}
+	call := calls[0]
+	if call.ID != id || call.Function.Name != "get_weather" || call.Type != openai.ToolTypeFunction {
+		t.Errorf("unexpected tool call %+v", call)
+	}
+	var args map[string]string
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args["city"] != "Paris" {
+		t.Errorf("unexpected arguments %q", call.Function.Arguments)
+	}
+	if resp.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+		t.Errorf("expected finish_reason tool_calls, got %q", resp.Choices[0].FinishReason)
+	}
+	return call
+}
+
+func TestOpenAIToolRoundTrip(t *testing.T) {
+	upstream := newFakeUpstream(t, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","tool_calls":[{"id":"call_abc","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]}}]}`)
+	p := newOpenAIProvider("test", upstream.URL+"/v1", http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), toolRequest("gpt-4o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := jsonAt(t, upstream.body, "tools", 0, "function", "name"); name != "get_weather" {
+		t.Errorf("tools not forwarded: %v", upstream.body["tools"])
+	}
+	if name := jsonAt(t, upstream.body, "tool_choice", "function", "name"); name != "get_weather" {
+		t.Errorf("tool_choice not forwarded: %v", upstream.body["tool_choice"])
+	}
+	call := assertToolCall(t, resp, "call_abc")
+
+	if _, err := p.ChatCompletion(context.Background(), toolResultRequest("gpt-4o", call)); err != nil {
+		t.Fatal(err)
+	}
+	if id := jsonAt(t, upstream.body, "messages", 1, "tool_calls", 0, "id"); id != "call_abc" {
+		t.Errorf("assistant tool call not forwarded: %v", upstream.body["messages"])
+	}
+	if id := jsonAt(t, upstream.body, "messages", 2, "tool_call_id"); id != "call_abc" {
+		t.Errorf("tool result not forwarded: %v", upstream.body["messages"])
+	}
+}
+
+func TestAnthropicToolRoundTrip(t *testing.T) {
+	upstream := newFakeUpstream(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5-20250929","stop_reason":"tool_use","content":[{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}],"usage":{"input_tokens":10,"output_tokens":5}}`)
+	p := newAnthropicProvider("test", upstream.URL, http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), toolRequest("claude-sonnet-4-5-20250929"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := jsonAt(t, upstream.body, "tools", 0, "name"); name != "get_weather" {
+		t.Errorf("tools not converted: %v", upstream.body["tools"])
+	}
+	if schema := jsonAt(t, upstream.body, "tools", 0, "input_schema", "type"); schema != "object" {
+		t.Errorf("input_schema not converted: %v", upstream.body["tools"])
+	}
+	if choice := jsonAt(t, upstream.body, "tool_choice"); choice.(map[string]interface{})["type"] != "tool" || choice.(map[string]interface{})["name"] != "get_weather" {
+		t.Errorf("tool_choice not converted: %v", choice)
+	}
+	call := assertToolCall(t, resp, "toolu_1")
+
+	if _, err := p.ChatCompletion(context.Background(), toolResultRequest("claude-sonnet-4-5-20250929", call)); err != nil {
+		t.Fatal(err)
+	}
+	if block := jsonAt(t, upstream.body, "messages", 1, "content", 0); block.(map[string]interface{})["type"] != "tool_use" || block.(map[string]interface{})["id"] != "toolu_1" {
+		t.Errorf("assistant tool call not converted: %v", block)
+	}
+	if city := jsonAt(t, upstream.body, "messages", 1, "content", 0, "input", "city"); city != "Paris" {
+		t.Errorf("tool_use input not converted: %v", city)
+	}
+	result := jsonAt(t, upstream.body, "messages", 2).(map[string]interface{})
+	if result["role"] != "user" || jsonAt(t, result, "content", 0, "type") != "tool_result" || jsonAt(t, result, "content", 0, "tool_use_id") != "toolu_1" {
+		t.Errorf("tool result not converted: %v", result)
+	}
+	if _, ok := upstream.body["tool_choice"]; ok {
+		t.Errorf("tool_choice auto should use Anthropic's default, got %v", upstream.body["tool_choice"])
+	}
+}
+
+func TestGeminiToolRoundTrip(t *testing.T) {
+	upstream := newFakeUpstream(t, `{"candidates":[{"index":0,"finishReason":"STOP","content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]}}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}`)
+	p := newGeminiProvider("test", upstream.URL, http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), toolRequest("gemini-2.5-flash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := jsonAt(t, upstream.body, "tools", 0, "functionDeclarations", 0, "name"); name != "get_weather" {
+		t.Errorf("tools not converted: %v", upstream.body["tools"])
+	}
+	config := jsonAt(t, upstream.body, "toolConfig", "functionCallingConfig").(map[string]interface{})
+	if config["mode"] != "ANY" || jsonAt(t, config, "allowedFunctionNames", 0) != "get_weather" {
+		t.Errorf("tool_choice not converted: %v", config)
+	}
+	call := assertToolCall(t, resp, "call_0")
+
+	if _, err := p.ChatCompletion(context.Background(), toolResultRequest("gemini-2.5-flash", call)); err != nil {
+		t.Fatal(err)
+	}
+	if name := jsonAt(t, upstream.body, "contents", 1, "parts", 0, "functionCall", "name"); name != "get_weather" {
+		t.Errorf("assistant tool call not converted: %v", upstream.body["contents"])
+	}
+	response := jsonAt(t, upstream.body, "contents", 2, "parts", 0, "functionResponse").(map[string]interface{})
+	if response["name"] != "get_weather" || response["id"] != "call_0" || jsonAt(t, response, "response", "temp_c") != float64(18) {
+		t.Errorf("tool result not converted: %v", response)
+	}
+}
+
+func TestCohereToolRoundTrip(t *testing.T) {
+	upstream := newFakeUpstream(t, `{"id":"c-1","finish_reason":"TOOL_CALL","message":{"role":"assistant","tool_calls":[{"id":"get_weather_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"usage":{"billed_units":{"input_tokens":10,"output_tokens":5}}}`)
+	p := newCohereProvider("test", upstream.URL, http.DefaultTransport)
+
+	resp, err := p.ChatCompletion(context.Background(), toolRequest("command-a-03-2025"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := jsonAt(t, upstream.body, "tools", 0, "function", "name"); name != "get_weather" {
+		t.Errorf("tools not converted: %v", upstream.body["tools"])
+	}
+	if upstream.body["tool_choice"] != "REQUIRED" {
+		t.Errorf("expected tool_choice REQUIRED, got %v", upstream.body["tool_choice"])
+	}
+	call := assertToolCall(t, resp, "get_weather_1")
+
+	if _, err := p.ChatCompletion(context.Background(), toolResultRequest("command-a-03-2025", call)); err != nil {
+		t.Fatal(err)
+	}
+	if id := jsonAt(t, upstream.body, "messages", 1, "tool_calls", 0, "id"); id != "get_weather_1" {
+		t.Errorf("assistant tool call not converted: %v", upstream.body["messages"])
+	}
+	result := jsonAt(t, upstream.body, "messages", 2).(map[string]interface{})
+	if result["role"] != "tool" || result["tool_call_id"] != "get_weather_1" {
+		t.Errorf("tool result not converted: %v", result)
+	}
+}
+
+func TestValidateTools(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		req     ChatRequest
+		wantErr bool
+	}{
+		{"no tools", ChatRequest{}, false},
+		{"auto", ChatRequest{Tools: []openai.Tool{weatherTool}, ToolChoice: "auto"}, false},
+		{"named", toolRequest("gpt-4o"), false},
+		{"none without tools", ChatRequest{ToolChoice: "none"}, false},
+		{"required without tools", ChatRequest{ToolChoice: "required"}, true},
+		{"unknown mode", ChatRequest{Tools: []openai.Tool{weatherTool}, ToolChoice: "always"}, true},
+		{"unknown function", ChatRequest{Tools: []openai.Tool{weatherTool}, ToolChoice: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "nope"}}}, true},
+		{"unnamed tool", ChatRequest{Tools: []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{}}}}, true},
+	} {
+		if err := tc.req.ValidateTools(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedProvider wraps a provider so every upstream call gets a client span
+type tracedProvider struct {
+	Provider
+}
+
+// withTracing wraps a provider with tracing spans
+func withTracing(provider Provider) Provider {
+	return &tracedProvider{Provider: provider}
+}
+
+// ChatCompletion makes a traced chat completion request
+func (p *tracedProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	ctx, span := p.startSpan(ctx, "provider.chat_completion", req)
+	defer span.End()
+
+	resp, err := p.Provider.ChatCompletion(ctx, req)
+	tracing.RecordError(span, err)
+	if resp != nil {
+		span.SetAttributes(
+			attribute.Int("llm.usage.prompt_tokens", resp.Usage.PromptTokens),
+			attribute.Int("llm.usage.completion_tokens", resp.Usage.CompletionTokens),
+		)
+	}
+	return resp, err
+}
+
+// ChatCompletionStream opens a traced stream; the span covers connection setup
+func (p *tracedProvider) ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error) {
+	ctx, span := p.startSpan(ctx, "provider.chat_completion_stream", req)
+	defer span.End()
+
+	stream, err := p.Provider.ChatCompletionStream(ctx, req)
+	tracing.RecordError(span, err)
+	return stream, err
+}
+
+// Transcribe makes a traced transcription request
+func (p *tracedProvider) Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+	ctx, span := p.startSpan(ctx, "provider.transcribe", ChatRequest{Model: req.Model})
+	defer span.End()
+
+	resp, err := p.Provider.Transcribe(ctx, req)
+	tracing.RecordError(span, err)
+	if resp != nil {
+		span.SetAttributes(attribute.Float64("llm.audio.duration_seconds", resp.Duration))
+	}
+	return resp, err
+}
+
+// startSpan starts a client span tagged with the provider and model
+func (p *tracedProvider) startSpan(ctx context.Context, name string, req ChatRequest) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("llm.provider", p.GetProviderName()),
+			attribute.String("llm.model", req.Model),
+		),
+	)
+}
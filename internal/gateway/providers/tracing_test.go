@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs an in-memory tracer provider for the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestRequestSpanTree(t *testing.T) {
+	recorder := recordSpans(t)
+	upstream := newFakeUpstream(t, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	provider := withTracing(newOpenAIProvider("test", upstream.URL+"/v1", http.DefaultTransport))
+
+	// Mirrors the chat handler: cache lookup, provider call, request logging
+	handler := tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		_, cacheSpan := tracing.Tracer().Start(ctx, "cache.get")
+		cacheSpan.End()
+
+		if _, err := provider.ChatCompletion(ctx, ChatRequest{Model: "gpt-4o"}); err != nil {
+			t.Error(err)
+		}
+
+		_, logSpan := tracing.Tracer().Start(ctx, "db.log_request")
+		logSpan.End()
+	}))
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	server, ok := spans["POST /v1/chat/completions"]
+	if !ok {
+		t.Fatalf("no server span among %v", spans)
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span kind %v", server.SpanKind())
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("server span trace %s, want the incoming %s", got, traceID)
+	}
+	if got := server.Parent().SpanID().String(); got != parentID {
+		t.Errorf("server span parent %s, want the incoming %s", got, parentID)
+	}
+
+	for _, name := range []string{"cache.get", "provider.chat_completion", "db.log_request"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("missing %s span", name)
+			continue
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of the server span", name)
+		}
+	}
+
+	if span, ok := spans["provider.chat_completion"]; ok {
+		attrs := attribute.NewSet(span.Attributes()...)
+		for key, want := range map[attribute.Key]string{"llm.provider": "openai", "llm.model": "gpt-4o"} {
+			if got, _ := attrs.Value(key); got.AsString() != want {
+				t.Errorf("provider span %s = %q, want %q", key, got.AsString(), want)
+			}
+		}
+		if span.SpanKind() != trace.SpanKindClient {
+			t.Errorf("provider span kind %v", span.SpanKind())
+		}
+	}
+}
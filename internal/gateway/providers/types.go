@@ -2,10 +2,19 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 )
 
+// upstreamTimeout is a backstop for provider HTTP calls; the effective
+// deadline comes from the request context (X-Request-Timeout)
+const upstreamTimeout = 5 * time.Minute
+
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
 	Model       string                         `json:"model"`
@@ -14,6 +23,250 @@ type ChatRequest struct {
 	MaxTokens   *int                           `json:"max_tokens,omitempty"`
 	TopP        *float32                       `json:"top_p,omitempty"`
 	Stream      bool                           `json:"stream,omitempty"`
+	User        string                         `json:"user,omitempty"` // End-user identifier for abuse tracking
+	LogitBias   map[string]int                 `json:"logit_bias,omitempty"`
+	Seed        *int                           `json:"seed,omitempty"`     // Best-effort deterministic sampling (not Anthropic)
+	Thinking    *ThinkingConfig                `json:"thinking,omitempty"` // Extended thinking (Anthropic)
+
+	// Function tools the model may call, and tool_choice ("auto", "none", "required"
+	// or a named function); translated into each provider's native tool format
+	Tools      []openai.Tool `json:"tools,omitempty"`
+	ToolChoice interface{}   `json:"tool_choice,omitempty"`
+
+	// Sequences that end generation; a single string or an array, as OpenAI accepts
+	Stop StopSequences `json:"stop,omitempty"`
+
+	// Number of choices; n > 1 is streaming-only and served by the gateway
+	// running one upstream stream per choice, so it's never forwarded
+	N int `json:"n,omitempty"`
+
+	// Provider-neutral reasoning level ("low", "medium" or "high"), mapped to each
+	// provider's native control; an explicit thinking config takes precedence
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+
+	// Structured output (forwarded to OpenAI); RepairJSON fixes up malformed JSON in the reply,
+	// and SchemaRetry re-requests once when it doesn't match the json_schema
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	RepairJSON     bool            `json:"repair_json,omitempty"`
+	SchemaRetry    bool            `json:"schema_retry,omitempty"`
+
+	// Harm-category block thresholds, forwarded to Gemini and ignored elsewhere;
+	// the key's defaults fill in categories the request doesn't set
+	SafetySettings []SafetySetting `json:"safety_settings,omitempty"`
+
+	// OpenAI's newer name for max_tokens; folded into MaxTokens by NormalizeMaxTokens
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+
+	// Re-request after a "length" finish and stitch the output (non-streaming,
+	// capped by AUTO_CONTINUE_MAX); also set by X-Auto-Continue or key config
+	AutoContinue bool `json:"auto_continue,omitempty"`
+
+	// Mark the static prompt prefix for provider-native caching (Anthropic cache_control)
+	PromptCaching bool `json:"prompt_caching,omitempty"`
+
+	// The key's output token cap, recorded by NormalizeMaxTokens so provider
+	// adjustments to max_tokens stay within it (0 = none)
+	MaxTokensLimit int `json:"-"`
+
+	// OpenAI organization to bill, from the OpenAI-Organization header or key config
+	Organization string `json:"-"`
+
+	// Route the request arrived on, for logging (empty = /v1/chat/completions)
+	Endpoint string `json:"-"`
+
+	// Stream from the provider but return one assembled response, for stream:true
+	// requests from keys with force_non_stream
+	BufferStream bool `json:"-"`
+
+	// How message content is normalized for the cache key, from key config
+	CacheNormalization CacheNormalization `json:"-"`
+
+	// Client-chosen cache key (body or X-Cache-Key header). Requests with the same
+	// key and parameters share a cache entry whatever their messages. Entries
+	// are scoped to the API key so clients can't reach each other's.
+	CacheKey      string `json:"cache_key,omitempty"`
+	CacheKeyScope string `json:"-"`
+
+	// Client tags stored with the request log and filterable in stats; forwarded
+	// to Anthropic, which accepts only user_id
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Server-side conversation whose history is prepended; ConversationTurns
+	// holds the client's new messages, stored with the reply
+	ConversationID    string                         `json:"conversation_id,omitempty"`
+	ConversationTurns []openai.ChatCompletionMessage `json:"-"`
+
+	// QoS class ("interactive" or "batch"); interactive requests get free workers first
+	Priority string `json:"priority,omitempty"`
+
+	// Optional prompt template, rendered into a user message before dispatch
+	Template  string                 `json:"template,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// NormalizeMaxTokens folds max_completion_tokens into MaxTokens (max_tokens wins if both
+// are set) and clamps the result to limit. With no requested value the limit is applied
+// directly, so providers' larger defaults can't slip past it. Returns true if clamped.
+func (r *ChatRequest) NormalizeMaxTokens(limit int) bool {
+	if r.MaxTokens == nil {
+		r.MaxTokens = r.MaxCompletionTokens
+	}
+	r.MaxCompletionTokens = nil
+	r.MaxTokensLimit = limit
+
+	if limit <= 0 {
+		return false
+	}
+	if r.MaxTokens == nil || *r.MaxTokens <= 0 {
+		r.MaxTokens = &limit
+		return false
+	}
+	if *r.MaxTokens > limit {
+		r.MaxTokens = &limit
+		return true
+	}
+	return false
+}
+
+// Accepted sampling parameter ranges, matching OpenAI's
+const (
+	maxTemperature = 2
+	maxTopP        = 1
+)
+
+// NormalizeSampling checks temperature (0-2) and top_p (0-1). Out-of-range values
+// are an error unless clamp is set, in which case they're pulled into range and
+// the names of the clamped parameters are returned.
+func (r *ChatRequest) NormalizeSampling(clamp bool) ([]string, error) {
+	var clamped []string
+	for _, param := range []struct {
+		name  string
+		value **float32
+		max   float32
+	}{
+		{"temperature", &r.Temperature, maxTemperature},
+		{"top_p", &r.TopP, maxTopP},
+	} {
+		if *param.value == nil {
+			continue
+		}
+		value := **param.value
+		if value >= 0 && value <= param.max {
+			continue
+		}
+		if !clamp {
+			return nil, fmt.Errorf("%s must be between 0 and %g, got %g", param.name, param.max, value)
+		}
+
+		if value < 0 {
+			value = 0
+		} else {
+			value = param.max
+		}
+		*param.value = &value
+		clamped = append(clamped, param.name)
+	}
+	return clamped, nil
+}
+
+// reasoningBudgets maps each reasoning_effort level to a thinking token budget,
+// for providers that take a budget rather than a level
+var reasoningBudgets = map[string]int{
+	"low":    1024,
+	"medium": 4096,
+	"high":   16384,
+}
+
+// ValidateReasoningEffort checks reasoning_effort is empty or a known level
+func (r *ChatRequest) ValidateReasoningEffort() error {
+	if _, ok := reasoningBudgets[r.ReasoningEffort]; r.ReasoningEffort != "" && !ok {
+		return fmt.Errorf("invalid reasoning_effort %q (use low, medium or high)", r.ReasoningEffort)
+	}
+	return nil
+}
+
+// Limits on request metadata, matching OpenAI's
+const (
+	maxMetadataKeys     = 16
+	maxMetadataKeyLen   = 64
+	maxMetadataValueLen = 512
+)
+
+// ValidateMetadata checks metadata stays within the key count and length limits
+func (r *ChatRequest) ValidateMetadata() error {
+	if len(r.Metadata) > maxMetadataKeys {
+		return fmt.Errorf("metadata must have at most %d keys", maxMetadataKeys)
+	}
+	for key, value := range r.Metadata {
+		if key == "" || len(key) > maxMetadataKeyLen {
+			return fmt.Errorf("metadata keys must be 1-%d characters", maxMetadataKeyLen)
+		}
+		if len(value) > maxMetadataValueLen {
+			return fmt.Errorf("metadata value for %q exceeds %d characters", key, maxMetadataValueLen)
+		}
+	}
+	return nil
+}
+
+// MaxChoices caps n, since each choice is a separate upstream stream
+const MaxChoices = 8
+
+// ValidateChoices checks n is in range and only asks for several choices on a
+// stream, which is the one place the gateway can produce them
+func (r *ChatRequest) ValidateChoices() error {
+	if r.N < 0 || r.N > MaxChoices {
+		return fmt.Errorf("n must be between 1 and %d", MaxChoices)
+	}
+	if r.N <= 1 {
+		return nil
+	}
+	if !r.Stream {
+		return fmt.Errorf("n > 1 is only supported with \"stream\": true")
+	}
+	if r.ConversationID != "" {
+		return fmt.Errorf("n > 1 can't be combined with conversation_id")
+	}
+	return nil
+}
+
+// reasoningBudget returns the thinking token budget for the request's
+// reasoning_effort, or 0 if none was requested
+func (r *ChatRequest) reasoningBudget() int {
+	return reasoningBudgets[r.ReasoningEffort]
+}
+
+// maxStopSequences caps stop, matching OpenAI's limit
+const maxStopSequences = 4
+
+// StopSequences is the stop parameter, decoded from a string or an array of strings
+type StopSequences []string
+
+// UnmarshalJSON accepts a single stop string as well as an array
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = list
+	return nil
+}
+
+// ValidateStop checks stop has at most four non-empty sequences
+func (r *ChatRequest) ValidateStop() error {
+	if len(r.Stop) > maxStopSequences {
+		return fmt.Errorf("stop must have at most %d sequences", maxStopSequences)
+	}
+	for _, seq := range r.Stop {
+		if seq == "" {
+			return fmt.Errorf("stop sequences must not be empty")
+		}
+	}
+	return nil
 }
 
 // ChatResponse represents a chat completion response
@@ -26,19 +279,142 @@ type ChatResponse struct {
 	Usage             openai.Usage                  `json:"usage"`
 	SystemFingerprint string                        `json:"system_fingerprint,omitempty"`
 	LatencyMs         int                           `json:"latency_ms,omitempty"`
-	CostUSD           float64                       `json:"cost_usd,omitempty"`
+	CostUSD           float64                       `json:"cost_usd"`
+	CacheSavingsUSD   float64                       `json:"cache_savings_usd"` // Cost avoided by serving from cache (0 on a miss)
+	Reasoning         string                        `json:"reasoning,omitempty"`
+	CacheWriteTokens  int                           `json:"cache_write_tokens,omitempty"` // Prompt tokens written to the provider's prompt cache
+	UsageEstimated    bool                          `json:"usage_estimated,omitempty"`    // Usage counted by the gateway because the provider reported none
+	RateLimit         *UpstreamRateLimit            `json:"-"`                            // Provider's rate-limit headers, if any
+	ServedModel       string                        `json:"-"`                            // Model the gateway called, which failover may have changed; pricing is looked up by it
+	RaceLoser         *RaceAttempt                  `json:"-"`                            // Candidate cancelled when this response won a race
+}
+
+// RaceAttempt is the race candidate that lost. Its provider has usually
+// charged for the prompt already, so its spend is logged too.
+type RaceAttempt struct {
+	Model        string
+	ProviderName string
+	Resp         *ChatResponse // nil unless it answered before it could be cancelled
+}
+
+// ResponseFormat requests plain text or JSON output
+type ResponseFormat struct {
+	Type       string            `json:"type"` // "text", "json_object" or "json_schema"
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat is the schema for "json_schema" output
+type JSONSchemaFormat struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// WantsJSON reports whether the request asked for JSON output
+func (r *ChatRequest) WantsJSON() bool {
+	return r.ResponseFormat != nil && (r.ResponseFormat.Type == "json_object" || r.ResponseFormat.Type == "json_schema")
+}
+
+// CacheNormalization makes near-identical prompts share a cache entry
+type CacheNormalization struct {
+	Whitespace bool // trim and collapse runs of whitespace
+	Lowercase  bool
+}
+
+// ThinkingConfig enables extended thinking with a token budget
+type ThinkingConfig struct {
+	Type         string `json:"type"` // "enabled"
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
+// StreamChunk is a streaming chunk in OpenAI format, extended with
+// reasoning content that OpenAI's chunk type has no field for
+type StreamChunk struct {
+	openai.ChatCompletionStreamResponse
+	Reasoning string   `json:"reasoning,omitempty"`
+	CostUSD   *float64 `json:"cost_usd,omitempty"` // set on the gateway's final usage chunk
+
+	UsageEstimated bool `json:"usage_estimated,omitempty"` // final usage chunk's counts are the gateway's estimate
+}
+
+// streamDoneSentinel is the OpenAI-style end-of-stream data line, which some
+// providers (or proxies in front of them) send; readers end the stream on it
+const streamDoneSentinel = "[DONE]"
+
 // StreamReader is an interface for streaming responses
 type StreamReader interface {
-	Recv() (openai.ChatCompletionStreamResponse, error)
+	Recv() (StreamChunk, error)
 	Close() error
 }
 
+// Capabilities describes which features the gateway supports for a provider
+type Capabilities struct {
+	Streaming bool `json:"streaming"`
+	Tools     bool `json:"tools"`
+	JSONMode  bool `json:"json_mode"`
+	Vision    bool `json:"vision"`
+}
+
 // Provider is the interface all LLM providers must implement
 type Provider interface {
 	ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error)
 	ChatCompletionStream(ctx context.Context, req ChatRequest) (StreamReader, error)
+	Transcribe(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error)
 	ValidateModel(model string) bool
 	GetProviderName() string
+	Capabilities() Capabilities
+	Warm(ctx context.Context) error // primes the connection pool with a cheap request
+}
+
+// ContentBlockedError is returned when a provider refuses to generate content
+// for safety reasons
+type ContentBlockedError struct {
+	Provider   string
+	Reason     string
+	Categories []string
+}
+
+func (e *ContentBlockedError) Error() string {
+	if len(e.Categories) == 0 {
+		return fmt.Sprintf("%s blocked the request: %s", e.Provider, e.Reason)
+	}
+	return fmt.Sprintf("%s blocked the request: %s (%s)", e.Provider, e.Reason, strings.Join(e.Categories, ", "))
+}
+
+// ContextLengthError is returned when the prompt exceeds the model's context
+// window. Failing over won't help, so it is never retried.
+type ContextLengthError struct {
+	Provider string
+	Model    string
+	Message  string // provider's original error message
+}
+
+func (e *ContextLengthError) Error() string {
+	return fmt.Sprintf("prompt exceeds the context window of %s (%s): %s", e.Model, e.Provider, e.Message)
+}
+
+// contextLengthMarkers are the provider-specific error fragments that signal an
+// over-long prompt
+var contextLengthMarkers = map[string][]string{
+	"openai":    {"context_length_exceeded", "maximum context length"},
+	"anthropic": {"prompt is too long"},
+	"google":    {"exceeds the maximum number of tokens"},
+	"cohere":    {"too many tokens"},
+}
+
+// detectContextLengthError returns a ContextLengthError if a 400 response from
+// the provider is a context length failure, or nil otherwise
+func detectContextLengthError(provider, model string, status int, message string) error {
+	if status != http.StatusBadRequest {
+		return nil
+	}
+
+	lower := strings.ToLower(message)
+	for _, marker := range contextLengthMarkers[provider] {
+		if strings.Contains(lower, marker) {
+			return &ContextLengthError{Provider: provider, Model: model, Message: message}
+		}
+	}
+	return nil
 }
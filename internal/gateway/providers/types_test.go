@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStopSequencesDecoding(t *testing.T) {
+	for body, want := range map[string]StopSequences{
+		`{"stop":"END"}`:        {"END"},
+		`{"stop":["END","\n"]}`: {"END", "\n"},
+		`{"model":"gpt-4o"}`:    nil,
+		`{"stop":[]}`:           {},
+	} {
+		var req ChatRequest
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("%s: %v", body, err)
+		}
+		if !reflect.DeepEqual(req.Stop, want) {
+			t.Errorf("%s: got %#v, want %#v", body, req.Stop, want)
+		}
+	}
+
+	var req ChatRequest
+	if err := json.Unmarshal([]byte(`{"stop":3}`), &req); err == nil {
+		t.Error("expected an error for a numeric stop")
+	}
+}
+
+func TestValidateStop(t *testing.T) {
+	if err := (&ChatRequest{Stop: StopSequences{"a", "b", "c", "d"}}).ValidateStop(); err != nil {
+		t.Errorf("four sequences should be accepted: %v", err)
+	}
+	if err := (&ChatRequest{Stop: StopSequences{"a", "b", "c", "d", "e"}}).ValidateStop(); err == nil {
+		t.Error("five sequences should be rejected")
+	}
+	if err := (&ChatRequest{Stop: StopSequences{""}}).ValidateStop(); err == nil {
+		t.Error("an empty sequence should be rejected")
+	}
+}
+
+func TestStopForwardedToEveryProvider(t *testing.T) {
+	req := ChatRequest{Model: "m", Stop: StopSequences{"END"}}
+	reply := map[string]string{
+		"openai":    `{"id":"c","choices":[{"message":{"role":"assistant","content":"ok"}}]}`,
+		"anthropic": `{"id":"m","content":[{"type":"text","text":"ok"}]}`,
+		"google":    `{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}`,
+		"cohere":    `{"id":"c","message":{"content":[{"type":"text","text":"ok"}]}}`,
+	}
+
+	for name, field := range map[string][]interface{}{
+		"openai":    {"stop", 0},
+		"anthropic": {"stop_sequences", 0},
+		"google":    {"generationConfig", "stopSequences", 0},
+		"cohere":    {"stop_sequences", 0},
+	} {
+		upstream := newFakeUpstream(t, reply[name])
+		var p Provider
+		switch name {
+		case "openai":
+			p = newOpenAIProvider("test", upstream.URL+"/v1", http.DefaultTransport)
+		case "anthropic":
+			p = newAnthropicProvider("test", upstream.URL, http.DefaultTransport)
+		case "google":
+			p = newGeminiProvider("test", upstream.URL, http.DefaultTransport)
+		case "cohere":
+			p = newCohereProvider("test", upstream.URL, http.DefaultTransport)
+		}
+		if _, err := p.ChatCompletion(context.Background(), req); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := jsonAt(t, upstream.body, field...); got != "END" {
+			t.Errorf("%s: stop not forwarded, body %v", name, upstream.body)
+		}
+	}
+}
+
+func TestNormalizeMaxTokensClampsToTheKeyCap(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	for name, tc := range map[string]struct {
+		req     ChatRequest
+		limit   int
+		want    int
+		clamped bool
+	}{
+		"over the cap":          {req: ChatRequest{MaxTokens: intPtr(4000)}, limit: 256, want: 256, clamped: true},
+		"completion over cap":   {req: ChatRequest{MaxCompletionTokens: intPtr(4000)}, limit: 256, want: 256, clamped: true},
+		"under the cap":         {req: ChatRequest{MaxTokens: intPtr(100)}, limit: 256, want: 100},
+		"unset gets the cap":    {req: ChatRequest{}, limit: 256, want: 256},
+		"max_tokens wins":       {req: ChatRequest{MaxTokens: intPtr(100), MaxCompletionTokens: intPtr(4000)}, limit: 256, want: 100},
+		"no cap leaves request": {req: ChatRequest{MaxTokens: intPtr(4000)}, want: 4000},
+	} {
+		req := tc.req
+		clamped := req.NormalizeMaxTokens(tc.limit)
+		if clamped != tc.clamped || req.MaxTokens == nil || *req.MaxTokens != tc.want || req.MaxCompletionTokens != nil {
+			t.Errorf("%s: clamped %v with max_tokens %v, want %v with %d", name, clamped, req.MaxTokens, tc.clamped, tc.want)
+		}
+	}
+}
+
+func TestNormalizeSamplingRejectsOrClampsOutOfRange(t *testing.T) {
+	f := func(v float32) *float32 { return &v }
+	for name, tc := range map[string]struct {
+		temperature, topP *float32
+		err               string   // without clamping
+		clamped           []string // with clamping
+		wantTemp, wantTop float32
+	}{
+		"in range":          {temperature: f(0.7), topP: f(0.9), wantTemp: 0.7, wantTop: 0.9},
+		"bounds":            {temperature: f(2), topP: f(0), wantTemp: 2, wantTop: 0},
+		"unset":             {},
+		"hot temperature":   {temperature: f(5), err: "temperature must be between 0 and 2, got 5", clamped: []string{"temperature"}, wantTemp: 2},
+		"negative temp":     {temperature: f(-1), err: "temperature must be between 0 and 2", clamped: []string{"temperature"}, wantTemp: 0},
+		"top_p over 1":      {topP: f(1.5), err: "top_p must be between 0 and 1, got 1.5", clamped: []string{"top_p"}, wantTop: 1},
+		"both out of range": {temperature: f(3), topP: f(-0.5), err: "temperature", clamped: []string{"temperature", "top_p"}, wantTemp: 2, wantTop: 0},
+	} {
+		req := ChatRequest{Temperature: tc.temperature, TopP: tc.topP}
+		if _, err := req.NormalizeSampling(false); (err == nil) != (tc.err == "") || (err != nil && !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: rejecting got %v, want %q", name, err, tc.err)
+		}
+
+		req = ChatRequest{Temperature: tc.temperature, TopP: tc.topP}
+		clamped, err := req.NormalizeSampling(true)
+		if err != nil || strings.Join(clamped, ",") != strings.Join(tc.clamped, ",") {
+			t.Errorf("%s: clamping got %v, %v; want %v", name, clamped, err, tc.clamped)
+		}
+		if tc.temperature != nil && *req.Temperature != tc.wantTemp {
+			t.Errorf("%s: temperature %g, want %g", name, *req.Temperature, tc.wantTemp)
+		}
+		if tc.topP != nil && *req.TopP != tc.wantTop {
+			t.Errorf("%s: top_p %g, want %g", name, *req.TopP, tc.wantTop)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// knownProviders are the provider names the gateway can configure
+var knownProviders = map[string]bool{"openai": true, "anthropic": true, "google": true, "cohere": true}
+
+// ModelReport lists problems found by ValidateModels
+type ModelReport struct {
+	Errors   []string // typos and models no provider serves
+	Warnings []string // models whose provider isn't configured, skipped at runtime
+}
+
+// ValidateModels checks the failover chains, downgrades and pricing rows
+// against the configured providers
+func (m *Manager) ValidateModels(pricing []models.ModelPricing) ModelReport {
+	var report ModelReport
+
+	for model, chain := range m.failover {
+		if _, ok := m.providers[m.detectProvider(model)]; !ok {
+			continue // chains for unconfigured providers are never used
+		}
+		m.checkModel(&report, "failover source", model)
+		for _, target := range chain {
+			m.checkModel(&report, "failover target for "+model, target)
+		}
+	}
+	for model, sibling := range m.downgrades {
+		m.checkModel(&report, "downgrade source", model)
+		m.checkModel(&report, "downgrade target for "+model, sibling)
+	}
+
+	for _, price := range pricing {
+		name := price.Provider + "/" + price.Model
+		if !knownProviders[price.Provider] {
+			report.Errors = append(report.Errors, fmt.Sprintf("pricing row %s: unknown provider %q", name, price.Provider))
+			continue
+		}
+		if detected := m.detectProvider(price.Model); detected != "" && detected != price.Provider {
+			report.Errors = append(report.Errors, fmt.Sprintf("pricing row %s: model is served by %s", name, detected))
+			continue
+		}
+		provider, ok := m.providers[price.Provider]
+		if !ok || price.PricePerMinute > 0 { // audio models aren't chat-validated
+			continue
+		}
+		if !provider.ValidateModel(price.Model) {
+			report.Errors = append(report.Errors, fmt.Sprintf("pricing row %s: %s doesn't validate this model", name, price.Provider))
+		}
+	}
+
+	sort.Strings(report.Errors)
+	sort.Strings(report.Warnings)
+	return report
+}
+
+// checkModel records a problem if no configured provider serves model
+func (m *Manager) checkModel(report *ModelReport, role, model string) {
+	providerName := m.detectProvider(model)
+	if providerName == "" {
+		if len(m.unknownOrder) > 0 {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %q matches no provider and will be probed on UNKNOWN_MODEL_PROVIDERS", role, model))
+		} else {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s %q matches no provider", role, model))
+		}
+		return
+	}
+
+	provider, ok := m.providers[providerName]
+	if !ok {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s %q needs provider %s, which isn't configured", role, model, providerName))
+		return
+	}
+	if !provider.ValidateModel(model) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s %q isn't validated by %s", role, model, providerName))
+	}
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestValidateModelsReportsAnInconsistentConfig(t *testing.T) {
+	m := newTestManager(
+		&stubProvider{name: "openai", models: []string{"gpt-4o", "gpt-4o-mini", "whisper-1"}},
+		&stubProvider{name: "anthropic", models: []string{"claude-sonnet-4-5"}},
+	)
+	m.failover = map[string][]string{
+		"gpt-4o":         {"gpt-4o-mni", "claude-sonnet-4-5", "gemini-1.5-pro", "mistral-large"},
+		"gemini-1.5-pro": {"gemini-1.5-flsh"}, // google isn't configured, so never used
+	}
+	m.downgrades = map[string]string{"gpt-4o": "gpt-4o-mini", "claude-sonnet-4-5": "claude-haiku-typo"}
+
+	report := m.ValidateModels([]models.ModelPricing{
+		{Provider: "openai", Model: "gpt-4o"},
+		{Provider: "mistral", Model: "mistral-large"},
+		{Provider: "anthropic", Model: "gpt-4o-mini"},
+		{Provider: "openai", Model: "gpt-5-typo"},
+		{Provider: "openai", Model: "whisper-2", PricePerMinute: 0.006},
+		{Provider: "google", Model: "gemini-1.5-pro"},
+	})
+
+	wantErrors := []string{
+		`downgrade target for claude-sonnet-4-5 "claude-haiku-typo" isn't validated by anthropic`,
+		`failover target for gpt-4o "gpt-4o-mni" isn't validated by openai`,
+		`failover target for gpt-4o "mistral-large" matches no provider`,
+		`pricing row anthropic/gpt-4o-mini: model is served by openai`,
+		`pricing row mistral/mistral-large: unknown provider "mistral"`,
+		`pricing row openai/gpt-5-typo: openai doesn't validate this model`,
+	}
+	wantWarnings := []string{
+		`failover target for gpt-4o "gemini-1.5-pro" needs provider google, which isn't configured`,
+	}
+	if got := strings.Join(report.Errors, "\n"); got != strings.Join(wantErrors, "\n") {
+		t.Errorf("errors:\n%s\nwant:\n%s", got, strings.Join(wantErrors, "\n"))
+	}
+	if got := strings.Join(report.Warnings, "\n"); got != strings.Join(wantWarnings, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", got, strings.Join(wantWarnings, "\n"))
+	}
+}
+
+func TestValidateModelsWarnsForProbedModels(t *testing.T) {
+	m := newTestManager(&stubProvider{name: "openai", models: []string{"gpt-4o"}})
+	m.failover = map[string][]string{"gpt-4o": {"acme-1"}}
+	m.unknownOrder = []string{"openai"}
+
+	report := m.ValidateModels(nil)
+	if len(report.Errors) != 0 || len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "UNKNOWN_MODEL_PROVIDERS") {
+		t.Errorf("expected one probing warning, got %+v", report)
+	}
+}
+
+func TestValidateModelsAcceptsAConsistentConfig(t *testing.T) {
+	m := newTestManager(
+		&stubProvider{name: "openai", models: []string{"gpt-4o", "gpt-4o-mini"}},
+		&stubProvider{name: "anthropic", models: []string{"claude-sonnet-4-5"}},
+	)
+	m.failover = map[string][]string{"gpt-4o": {"claude-sonnet-4-5"}, "claude-sonnet-4-5": {"gpt-4o"}}
+	m.downgrades = map[string]string{"gpt-4o": "gpt-4o-mini"}
+
+	report := m.ValidateModels([]models.ModelPricing{
+		{Provider: "openai", Model: "gpt-4o"},
+		{Provider: "openai", Model: "gpt-4o-mini"},
+		{Provider: "anthropic", Model: "claude-sonnet-4-5"},
+	})
+	if len(report.Errors) != 0 || len(report.Warnings) != 0 {
+		t.Errorf("expected no problems, got %+v", report)
+	}
+}
@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// warmTimeout bounds a provider's warm-up request
+const warmTimeout = 10 * time.Second
+
+// WarmUp primes every provider's connection pool concurrently, logging whether
+// each one is ready. It returns once all have finished; failures are only logged.
+func (m *Manager) WarmUp(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, provider := range m.providers {
+		wg.Add(1)
+		go func(name string, provider Provider) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, warmTimeout)
+			defer cancel()
+
+			start := time.Now()
+			if err := provider.Warm(ctx); err != nil {
+				log.Printf("Warm-up for %s failed: %v", name, err)
+				return
+			}
+			log.Printf("✓ %s ready (warmed up in %dms)", name, time.Since(start).Milliseconds())
+		}(name, provider)
+	}
+	wg.Wait()
+}
+
+// warmRequest sends a warm-up request and drains the body so the connection
+// goes back to the pool
+func warmRequest(client *http.Client, req *http.Request, provider string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
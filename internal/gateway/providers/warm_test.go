@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+// recordingUpstream answers every request with body and records what it saw
+type recordingUpstream struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (u *recordingUpstream) serve(t *testing.T, contentType, body string) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		u.mu.Lock()
+		u.requests = append(u.requests, r.Clone(context.Background()))
+		u.mu.Unlock()
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestWarmUpProbesEachConfiguredProviderOnce(t *testing.T) {
+	upstreams := map[string]*recordingUpstream{}
+	cfg := &config.Config{
+		OpenAIAPIKey:    "sk-test",
+		AnthropicAPIKey: "sk-ant-test",
+		GeminiAPIKey:    "gemini-test",
+		CohereAPIKey:    "cohere-test",
+		ProviderRegions: map[string][]string{},
+	}
+	for _, name := range []string{"openai", "anthropic", "google", "cohere"} {
+		upstreams[name] = &recordingUpstream{}
+		baseURL := upstreams[name].serve(t, "application/json", `{"data":[],"models":[],"object":"list"}`)
+		if name == "openai" {
+			baseURL += "/v1"
+		}
+		cfg.ProviderRegions[name] = []string{baseURL}
+	}
+
+	NewManager(cfg, nil).WarmUp(context.Background())
+
+	for name, wantPath := range map[string]string{
+		"openai":    "/v1/models",
+		"anthropic": "/v1/models",
+		"google":    "/v1beta/models",
+		"cohere":    "/v1/models",
+	} {
+		requests := upstreams[name].requests
+		if len(requests) != 1 {
+			t.Errorf("%s: expected 1 probe, got %d", name, len(requests))
+			continue
+		}
+		if r := requests[0]; r.Method != "GET" || r.URL.Path != wantPath {
+			t.Errorf("%s: probed %s %s, want GET %s", name, r.Method, r.URL.Path, wantPath)
+		}
+	}
+}
+
+func TestGeminiSendsTheKeyInAHeader(t *testing.T) {
+	upstream := &recordingUpstream{}
+	reply := `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":1,"candidatesTokenCount":1}}`
+	p := newGeminiProvider("gemini-secret", upstream.serve(t, "application/json", reply), http.DefaultTransport)
+	req := ChatRequest{Model: "gemini-2.5-flash", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}}}
+
+	if _, err := p.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if stream, err := p.ChatCompletionStream(context.Background(), req); err != nil {
+		t.Fatal(err)
+	} else {
+		stream.Close()
+	}
+	if err := p.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(upstream.requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(upstream.requests))
+	}
+	for i, r := range upstream.requests {
+		if got := r.Header.Get("x-goog-api-key"); got != "gemini-secret" {
+			t.Errorf("request %d: x-goog-api-key = %q", i, got)
+		}
+		if strings.Contains(r.URL.RawQuery, "gemini-secret") || r.URL.Query().Has("key") {
+			t.Errorf("request %d: key in the URL: %s", i, r.URL)
+		}
+	}
+	if got := upstream.requests[1].URL.Query().Get("alt"); got != "sse" {
+		t.Errorf("stream request lost alt=sse: %s", upstream.requests[1].URL)
+	}
+}
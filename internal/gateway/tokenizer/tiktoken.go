@@ -0,0 +1,104 @@
+package tokenizer
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	// Use the vocabularies embedded in the binary rather than downloading them
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// OpenAI's chat framing: 3 tokens per message, 1 more for a name, and 3 to
+// prime the reply (see OpenAI's "How to count tokens with tiktoken")
+const (
+	openAITokensPerMessage = 3
+	openAITokensPerName    = 1
+	openAITokensPerReply   = 3
+)
+
+// openAIFallback is used if an encoding can't be loaded
+var openAIFallback = approximation{charsPerToken: 4, tokensPerMessage: openAITokensPerMessage, tokensPerReply: openAITokensPerReply}
+
+// encoding loads a tiktoken vocabulary once, on first use
+type encoding struct {
+	name string
+	once sync.Once
+	enc  *tiktoken.Tiktoken
+}
+
+func (e *encoding) get() *tiktoken.Tiktoken {
+	e.once.Do(func() {
+		enc, err := tiktoken.GetEncoding(e.name)
+		if err != nil {
+			log.Printf("Failed to load tiktoken encoding %s, approximating OpenAI token counts: %v", e.name, err)
+			return
+		}
+		e.enc = enc
+	})
+	return e.enc
+}
+
+var (
+	o200k  = &encoding{name: tiktoken.MODEL_O200K_BASE}
+	cl100k = &encoding{name: tiktoken.MODEL_CL100K_BASE}
+)
+
+// openAI counts tokens exactly with tiktoken. Used on its own it counts with
+// o200k_base, the encoding of current models; ForModel picks by model.
+type openAI struct {
+	enc *encoding
+}
+
+// ForModel returns the tokenizer for the encoding model uses: cl100k_base for
+// GPT-4 and GPT-3.5 Turbo, o200k_base for GPT-4o and everything since
+func (o openAI) ForModel(model string) Tokenizer {
+	if isCL100KModel(model) {
+		return openAI{enc: cl100k}
+	}
+	return openAI{enc: o200k}
+}
+
+func isCL100KModel(model string) bool {
+	return model == "gpt-4" || strings.HasPrefix(model, "gpt-4-") || strings.HasPrefix(model, "gpt-3.5")
+}
+
+func (o openAI) CountText(text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := o.enc.get()
+	if enc == nil {
+		return openAIFallback.CountText(text)
+	}
+	return len(enc.EncodeOrdinary(text))
+}
+
+func (o openAI) CountMessages(messages []openai.ChatCompletionMessage) int {
+	if o.enc.get() == nil {
+		return openAIFallback.CountMessages(messages)
+	}
+	total := openAITokensPerReply
+	for _, msg := range messages {
+		total += openAITokensPerMessage
+		total += o.CountText(msg.Role)
+		total += o.CountText(msg.Content)
+		if msg.Name != "" {
+			total += openAITokensPerName + o.CountText(msg.Name)
+		}
+		for _, part := range msg.MultiContent {
+			total += o.CountText(part.Text)
+		}
+		for _, call := range msg.ToolCalls {
+			total += o.CountText(call.Function.Name)
+			total += o.CountText(call.Function.Arguments)
+		}
+	}
+	return total
+}
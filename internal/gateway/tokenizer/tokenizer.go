@@ -0,0 +1,175 @@
+package tokenizer
+
+import (
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tokenizer counts tokens the way one provider's models do. Counts are used
+// for pre-flight checks, context truncation and usage estimates when a stream
+// doesn't report usage, so they should err slightly high rather than low.
+type Tokenizer interface {
+	// CountText estimates the number of tokens in a string
+	CountText(text string) int
+	// CountMessages estimates the prompt tokens for a list of chat messages,
+	// including the per-message and reply-priming overhead
+	CountMessages(messages []openai.ChatCompletionMessage) int
+}
+
+// ModelTokenizer is implemented by tokenizers whose vocabulary differs
+// between a provider's models
+type ModelTokenizer interface {
+	Tokenizer
+	// ForModel returns the tokenizer for one model
+	ForModel(model string) Tokenizer
+}
+
+// Default is used for providers without a registered tokenizer
+var Default Tokenizer = approximation{charsPerToken: 4, tokensPerMessage: 4, tokensPerReply: 3}
+
+var (
+	mu         sync.RWMutex
+	tokenizers = map[string]Tokenizer{
+		// Exact: tiktoken with the model's encoding
+		"openai": openAI{enc: o200k},
+		// Anthropic and Google don't publish tokenizers for current models; their
+		// only exact counts come from a token-counting API call, so these are
+		// approximations calibrated to each vocabulary. Claude's splits English
+		// slightly finer than OpenAI's.
+		"anthropic": approximation{charsPerToken: 3.5, tokensPerMessage: 5, tokensPerReply: 3},
+		// Gemini's SentencePiece vocabulary, with turn markers around each message
+		"google": approximation{charsPerToken: 4, tokensPerMessage: 5, tokensPerReply: 2},
+	}
+)
+
+// Register sets the tokenizer used for a provider's models, replacing any
+// existing one. Call it at startup, before requests are served.
+func Register(provider string, t Tokenizer) {
+	mu.Lock()
+	defer mu.Unlock()
+	tokenizers[provider] = t
+}
+
+// ForProvider returns the tokenizer for a provider, or Default if it has none
+func ForProvider(provider string) Tokenizer {
+	mu.RLock()
+	defer mu.RUnlock()
+	if t, ok := tokenizers[provider]; ok {
+		return t
+	}
+	return Default
+}
+
+// ForModel returns the tokenizer for a provider's model: the provider's
+// tokenizer, narrowed to the model if it implements ModelTokenizer
+func ForModel(provider, model string) Tokenizer {
+	t := ForProvider(provider)
+	if mt, ok := t.(ModelTokenizer); ok {
+		return mt.ForModel(model)
+	}
+	return t
+}
+
+// wideRune is the first code point of the CJK blocks, where BPE and
+// SentencePiece vocabularies average about one token per character
+const wideRune = 0x2E80
+
+// approximation estimates tokens from character counts, calibrated per provider
+type approximation struct {
+	charsPerToken    float64 // average characters per token for English text
+	tokensPerMessage int     // per-message overhead for role and formatting
+	tokensPerReply   int     // primes the assistant reply
+}
+
+func (a approximation) CountText(text string) int {
+	if text == "" {
+		return 0
+	}
+	narrow, wide := 0, 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if r >= wideRune {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	// Round up so short strings never count as zero tokens
+	tokens := float64(narrow) / a.charsPerToken
+	whole := int(tokens)
+	if tokens > float64(whole) {
+		whole++
+	}
+	return whole + wide
+}
+
+func (a approximation) CountMessages(messages []openai.ChatCompletionMessage) int {
+	total := a.tokensPerReply
+	for _, msg := range messages {
+		total += a.tokensPerMessage
+		total += a.CountText(msg.Role)
+		total += a.CountText(msg.Content)
+		total += a.CountText(msg.Name)
+		for _, part := range msg.MultiContent {
+			total += a.CountText(part.Text)
+		}
+		for _, call := range msg.ToolCalls {
+			total += a.CountText(call.Function.Name)
+			total += a.CountText(call.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// TruncateMessages drops the oldest messages until t's estimate fits within
+// budget tokens. System messages and everything from the last user message on
+// are never dropped, and tool results go together with the call they answer.
+// Returns the kept messages and how many were dropped; the result may still be
+// over budget if only protected messages remain.
+func TruncateMessages(t Tokenizer, messages []openai.ChatCompletionMessage, budget int) ([]openai.ChatCompletionMessage, int) {
+	total := t.CountMessages(messages)
+	if total <= budget {
+		return messages, 0
+	}
+
+	// The latest user turn and anything after it is protected
+	protectFrom := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			protectFrom = i
+			break
+		}
+	}
+
+	// A message's own cost, without the reply overhead counted once per list
+	replyOverhead := t.CountMessages(nil)
+	dropped := make([]bool, len(messages))
+	droppedCount := 0
+	for i := 0; i < protectFrom && total > budget; i++ {
+		if messages[i].Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		dropped[i] = true
+		droppedCount++
+		total -= t.CountMessages(messages[i:i+1]) - replyOverhead
+
+		// Tool results can't outlive the assistant message that called them
+		for i+1 < protectFrom && messages[i+1].Role == openai.ChatMessageRoleTool {
+			i++
+			dropped[i] = true
+			droppedCount++
+			total -= t.CountMessages(messages[i:i+1]) - replyOverhead
+		}
+	}
+
+	kept := make([]openai.ChatCompletionMessage, 0, len(messages)-droppedCount)
+	for i, msg := range messages {
+		if !dropped[i] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept, droppedCount
+}
@@ -0,0 +1,120 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type openAIFixtures struct {
+	Messages     []openai.ChatCompletionMessage `json:"messages"`
+	PromptTokens map[string]int                 `json:"prompt_tokens"`
+	Texts        []struct {
+		Text   string `json:"text"`
+		CL100K int    `json:"cl100k_base"`
+		O200K  int    `json:"o200k_base"`
+	} `json:"texts"`
+}
+
+func loadOpenAIFixtures(t *testing.T) openAIFixtures {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/openai_fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f openAIFixtures
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestOpenAIPromptTokensMatchFixtures(t *testing.T) {
+	f := loadOpenAIFixtures(t)
+	for model, want := range f.PromptTokens {
+		if got := ForModel("openai", model).CountMessages(f.Messages); got != want {
+			t.Errorf("%s: counted %d prompt tokens, the API reports %d", model, got, want)
+		}
+	}
+}
+
+func TestOpenAITextTokensMatchFixtures(t *testing.T) {
+	f := loadOpenAIFixtures(t)
+	for _, tc := range f.Texts {
+		if got := ForModel("openai", "gpt-4").CountText(tc.Text); got != tc.CL100K {
+			t.Errorf("cl100k_base %q: got %d, want %d", tc.Text, got, tc.CL100K)
+		}
+		if got := ForModel("openai", "gpt-4o").CountText(tc.Text); got != tc.O200K {
+			t.Errorf("o200k_base %q: got %d, want %d", tc.Text, got, tc.O200K)
+		}
+	}
+}
+
+func TestForModelPicksOpenAIEncoding(t *testing.T) {
+	for model, want := range map[string]*encoding{
+		"gpt-4":             cl100k,
+		"gpt-4-turbo":       cl100k,
+		"gpt-3.5-turbo":     cl100k,
+		"gpt-4o":            o200k,
+		"gpt-4o-mini":       o200k,
+		"gpt-4.1":           o200k,
+		"o3-mini":           o200k,
+		"gpt-5":             o200k,
+		"some-future-model": o200k,
+	} {
+		got, ok := ForModel("openai", model).(openAI)
+		if !ok || got.enc != want {
+			t.Errorf("%s: expected %s", model, want.name)
+		}
+	}
+}
+
+func TestProvidersWithoutTokenizerUseDefault(t *testing.T) {
+	for _, provider := range []string{"cohere", "unknown"} {
+		if ForModel(provider, "command-a-03-2025") != Default {
+			t.Errorf("%s: expected the default approximation", provider)
+		}
+	}
+	if ForModel("anthropic", "claude-sonnet-4-5") != ForProvider("anthropic") {
+		t.Error("anthropic's tokenizer doesn't vary by model")
+	}
+}
+
+func TestApproximationCountsCJKPerCharacter(t *testing.T) {
+	a := approximation{charsPerToken: 4}
+	if got := a.CountText("天気はどう"); got != 5 {
+		t.Errorf("expected one token per CJK character, got %d", got)
+	}
+	if got := a.CountText("a"); got != 1 {
+		t.Errorf("a non-empty string should count at least one token, got %d", got)
+	}
+	if got := a.CountText(""); got != 0 {
+		t.Errorf("empty string counted %d tokens", got)
+	}
+}
+
+func TestTruncateMessagesKeepsSystemAndLatestTurn(t *testing.T) {
+	long := strings.Repeat("word ", 200)
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "Be brief."},
+		{Role: openai.ChatMessageRoleUser, Content: long},
+		{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{ID: "c1", Function: openai.FunctionCall{Name: "f", Arguments: "{}"}}}},
+		{Role: openai.ChatMessageRoleTool, ToolCallID: "c1", Content: long},
+		{Role: openai.ChatMessageRoleUser, Content: "And now?"},
+	}
+	tok := ForModel("openai", "gpt-4o")
+
+	kept, dropped := TruncateMessages(tok, messages, 50)
+	if dropped != 3 {
+		t.Fatalf("expected 3 dropped, got %d: %+v", dropped, kept)
+	}
+	if len(kept) != 2 || kept[0].Role != openai.ChatMessageRoleSystem || kept[1].Content != "And now?" {
+		t.Errorf("expected the system prompt and latest turn, got %+v", kept)
+	}
+	if got := tok.CountMessages(kept); got > 50 {
+		t.Errorf("kept %d tokens, over the budget", got)
+	}
+}
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestExporterPostsToTracesPath(t *testing.T) {
+	for _, tc := range []struct {
+		suffix string
+		want   string
+	}{
+		{"", "/v1/traces"},
+		{"/", "/v1/traces"},
+		{"/otlp/v1/traces", "/otlp/v1/traces"},
+	} {
+		paths := make(chan string, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case paths <- r.URL.Path:
+			default:
+			}
+		}))
+
+		ctx := context.Background()
+		exporter, err := otlptracehttp.New(ctx, exporterOptions(srv.URL+tc.suffix)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		_, span := provider.Tracer("test").Start(ctx, "span")
+		span.End()
+		if err := provider.Shutdown(ctx); err != nil {
+			t.Errorf("%q: export failed: %v", tc.suffix, err)
+		}
+		srv.Close()
+
+		select {
+		case got := <-paths:
+			if got != tc.want {
+				t.Errorf("endpoint %q: spans posted to %q, want %q", srv.URL+tc.suffix, got, tc.want)
+			}
+		default:
+			t.Errorf("endpoint %q: no spans exported", srv.URL+tc.suffix)
+		}
+	}
+}
@@ -2,8 +2,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,26 +16,205 @@ import (
 // Config holds all configuration for the gateway
 type Config struct {
 	// Server
-	Port string
-	Env  string
+	Port               string
+	Env                string
+	CompressionEnabled bool
+	RequestTimeout     time.Duration // default per-request deadline
+	RequestTimeoutMax  time.Duration // cap on X-Request-Timeout
 
 	// Database
-	DatabaseURL string
+	DatabaseURL       string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	// Request logging
+	LogBufferSize    int
+	LogWorkers       int
+	LogBatchSize     int
+	LogFlushInterval time.Duration
+	LastUsedInterval time.Duration // how often each key's last_used_at is written at most
+
+	// Log write retries; fail closed refuses requests while logs can't be written
+	LogWriteRetries      int
+	LogWriteRetryBackoff time.Duration
+	LogWriteFailClosed   bool
+
+	// Fractions of successful requests and cache hits written to gateway_logs
+	// (errors and failovers are always written)
+	LogSampleRate         float64
+	LogCacheHitSampleRate float64
 
 	// Redis
-	RedisURL string
+	RedisURL              string
+	RedisMode             string   // single, cluster or sentinel
+	RedisAddrs            []string // cluster nodes or sentinels
+	RedisMasterName       string
+	RedisUsername         string
+	RedisPassword         string
+	RedisSentinelPassword string
+	RedisDB               int
+	RedisTLS              bool
 
 	// Provider API Keys
 	OpenAIAPIKey    string
 	AnthropicAPIKey string
 	GeminiAPIKey    string
+	CohereAPIKey    string
+
+	// Routing rules that override model-prefix provider detection
+	RoutingRules []RoutingRule
+
+	// Model tier annotations used to derive failover chains for unmapped models
+	ModelTiers []TierRule
+
+	// Report the requested model in responses even when failover or a
+	// downgrade served another (X-Served-Model and logs keep the real one)
+	EchoRequestedModel bool
+
+	// Cheaper siblings served instead of a model after repeated upstream 429s,
+	// for keys with the auto_downgrade feature flag
+	ModelDowngrades    map[string]string
+	DowngradeAfter429s int
+	DowngradeWindow    time.Duration
+
+	// Regional base URLs per provider; requests go to the lowest-latency region
+	ProviderRegions map[string][]string
+
+	// Extra headers sent on every request to a provider, and the client headers
+	// each provider may receive (overriding the configured value)
+	ProviderHeaders    map[string]http.Header
+	PassthroughHeaders map[string][]string
+
+	// Client headers forwarded to every provider (e.g. traceparent); auth,
+	// host and framing headers are never forwarded
+	ForwardHeaders []string
+
+	// Most calls in flight per provider, and how long a call waits for a slot
+	// before failing over
+	ProviderConcurrency map[string]int
+	ProviderQueueWait   time.Duration
+
+	// Egress proxy for provider calls (empty = HTTPS_PROXY/HTTP_PROXY/NO_PROXY
+	// from the environment, ProxyDirect = none), with per-provider overrides
+	UpstreamProxy   string
+	ProviderProxies map[string]string
+
+	// Retry budget per request across region fallbacks and failover: most
+	// provider attempts, and how long new ones may start (0 = unlimited)
+	RetryMaxAttempts int
+	RetryMaxDuration time.Duration
+
+	// Providers tried in order for models no routing rule or prefix matches
+	UnknownModelProviders []string
+
+	// Refuse to start when failover chains or pricing name models no provider serves
+	StrictModelValidation bool
+
+	// API key format, checked before any database lookup
+	APIKeyPrefix    string
+	APIKeyMinLength int
+	APIKeyMaxLength int
+
+	// Clamp out-of-range temperature/top_p instead of rejecting them with a 400
+	ClampSamplingParams bool
+
+	// API key lookup cache (0 = disabled)
+	APIKeyCacheTTL         time.Duration
+	APIKeyNegativeCacheTTL time.Duration
 
 	// Rate Limiting
 	DefaultRateLimit int
+	RateLimitMaxWait time.Duration
+	IPRateLimit      int // requests per minute per client IP, checked before auth (0 = disabled, the default)
+
+	// Rate limit check retries; fail closed refuses requests while Redis is down
+	RateLimitRetries      int
+	RateLimitRetryBackoff time.Duration
+	RateLimitFailClosed   bool
+
+	// Proxies whose X-Forwarded-For is trusted when resolving the client IP
+	TrustedProxies []*net.IPNet
+
+	// Admin endpoints require HMAC-signed requests (empty secret = admin endpoints disabled)
+	AdminSigningSecret   string
+	AdminSignatureMaxAge time.Duration
 
 	// Caching
-	CacheTTLSeconds int
-	CacheEnabled    bool
+	CacheTTLSeconds       int
+	CacheTTLMaxSeconds    int // upper bound for X-Cache-TTL
+	CacheEnabled          bool
+	CacheBackend          string // "redis" or "memory"
+	CacheMemoryMaxEntries int
+	CacheFillWait         time.Duration // how long identical misses wait for the first to fill (0 = no single-flight)
+
+	// Batch requests
+	BatchMaxSize     int
+	BatchConcurrency int
+
+	// Priority queue for provider calls (0 workers = unbounded)
+	PriorityWorkers   int
+	PriorityQueueSize int
+
+	// Audio transcription
+	AudioMaxUploadMB int
+
+	// Streaming
+	StreamReplayDelay      time.Duration
+	StreamResumeMaxRetries int
+
+	// Auto-continue: most continuations of a length-truncated completion
+	AutoContinueMax int
+
+	// Validate json_schema completions against their schema
+	SchemaValidation bool
+
+	// Provider health checks
+	HealthCheckInterval time.Duration
+	ProviderWarmup      bool // pre-dial each provider on startup
+
+	// Tracing (empty endpoint = disabled)
+	OTLPEndpoint    string
+	OTelServiceName string
+
+	// Alerting
+	AlertWebhookURL       string
+	AlertDebounceInterval time.Duration
+
+	// Log export to S3 (empty bucket = disabled)
+	LogExportBucket    string
+	LogExportRegion    string
+	LogExportEndpoint  string // S3-compatible endpoint; empty = AWS
+	LogExportPrefix    string
+	LogExportRetention time.Duration // export rows older than this
+	LogExportInterval  time.Duration // 0 = only via the admin endpoint
+	LogExportPageSize  int
+	LogExportDelete    bool
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+
+	// Per-key completion post-processing webhooks
+	PostprocessTimeout time.Duration
+
+	// Pricing sync from a JSON source (URL or file; empty = disabled)
+	PricingSyncSource   string
+	PricingSyncInterval time.Duration // 0 = only via the admin endpoint
+
+	// How often GET /metrics refreshes its Redis keyspace figures (0 = not exported)
+	RedisMetricsInterval time.Duration
+}
+
+// RoutingRule routes models matching Pattern (exact name or glob, e.g. "gpt-4o*") to Provider
+type RoutingRule struct {
+	Pattern  string
+	Provider string
+}
+
+// TierRule assigns models matching Pattern (exact name or glob) to a failover tier, e.g. "flagship"
+type TierRule struct {
+	Pattern string
+	Tier    string
 }
 
 // Load loads configuration from environment variables
@@ -39,31 +223,132 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		Port:             getEnv("PORT", "8080"),
-		Env:              getEnv("ENV", "development"),
-		DatabaseURL:      getEnv("DATABASE_URL", ""),
-		RedisURL:         getEnv("REDIS_URL", "redis://localhost:6379"),
-		OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
-		AnthropicAPIKey:  getEnv("ANTHROPIC_API_KEY", ""),
-		GeminiAPIKey:     getEnv("GEMINI_API_KEY", ""),
-		DefaultRateLimit: getEnvInt("DEFAULT_RATE_LIMIT", 100),
-		CacheTTLSeconds:  getEnvInt("CACHE_TTL_SECONDS", 3600),
-		CacheEnabled:     getEnvBool("CACHE_ENABLED", true),
-	}
-
-	// Validate required fields
-	if cfg.DatabaseURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL is required")
+		Port:                   getEnv("PORT", "8080"),
+		Env:                    getEnv("ENV", "development"),
+		CompressionEnabled:     getEnvBool("COMPRESSION_ENABLED", true),
+		RequestTimeout:         getEnvDuration("REQUEST_TIMEOUT", 60*time.Second),
+		RequestTimeoutMax:      getEnvDuration("REQUEST_TIMEOUT_MAX", 120*time.Second),
+		DatabaseURL:            getEnv("DATABASE_URL", ""),
+		DBMaxOpenConns:         getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:         getEnvInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetime:      getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		LogBufferSize:          getEnvInt("LOG_BUFFER_SIZE", 1000),
+		LogWorkers:             getEnvInt("LOG_WORKERS", 2),
+		LogBatchSize:           getEnvInt("LOG_BATCH_SIZE", 100),
+		LogFlushInterval:       getEnvDuration("LOG_FLUSH_INTERVAL", time.Second),
+		LastUsedInterval:       getEnvDuration("LAST_USED_INTERVAL", time.Minute),
+		LogWriteRetries:        getEnvInt("LOG_WRITE_RETRIES", 3),
+		LogWriteRetryBackoff:   getEnvDuration("LOG_WRITE_RETRY_BACKOFF", 200*time.Millisecond),
+		LogWriteFailClosed:     getEnvBool("LOG_WRITE_FAIL_CLOSED", false),
+		LogSampleRate:          getEnvFloat("LOG_SAMPLE_RATE", 1),
+		LogCacheHitSampleRate:  getEnvFloat("LOG_SAMPLE_RATE_CACHE_HITS", 1),
+		RedisURL:               getEnv("REDIS_URL", "redis://localhost:6379"),
+		RedisMode:              getEnv("REDIS_MODE", "single"),
+		RedisAddrs:             getEnvList("REDIS_ADDRS"),
+		RedisMasterName:        getEnv("REDIS_MASTER_NAME", ""),
+		RedisUsername:          getEnv("REDIS_USERNAME", ""),
+		RedisPassword:          getEnv("REDIS_PASSWORD", ""),
+		RedisSentinelPassword:  getEnv("REDIS_SENTINEL_PASSWORD", ""),
+		RedisDB:                getEnvInt("REDIS_DB", 0),
+		RedisTLS:               getEnvBool("REDIS_TLS", false),
+		OpenAIAPIKey:           getEnv("OPENAI_API_KEY", ""),
+		AnthropicAPIKey:        getEnv("ANTHROPIC_API_KEY", ""),
+		GeminiAPIKey:           getEnv("GEMINI_API_KEY", ""),
+		CohereAPIKey:           getEnv("COHERE_API_KEY", ""),
+		RoutingRules:           getEnvRoutingRules("ROUTING_RULES"),
+		ModelTiers:             getEnvTierRules("MODEL_TIERS"),
+		EchoRequestedModel:     getEnvBool("ECHO_REQUESTED_MODEL", false),
+		ModelDowngrades:        getEnvMap("MODEL_DOWNGRADES"),
+		DowngradeAfter429s:     getEnvInt("DOWNGRADE_AFTER_429S", 3),
+		DowngradeWindow:        getEnvDuration("DOWNGRADE_WINDOW", time.Minute),
+		ProviderRegions:        getEnvProviderRegions("PROVIDER_REGIONS"),
+		ProviderHeaders:        getEnvProviderHeaders("PROVIDER_HEADERS"),
+		PassthroughHeaders:     getEnvProviderLists("PROVIDER_HEADER_PASSTHROUGH"),
+		ForwardHeaders:         getEnvList("FORWARD_HEADERS"),
+		ProviderConcurrency:    getEnvIntMap("PROVIDER_CONCURRENCY"),
+		ProviderQueueWait:      getEnvDuration("PROVIDER_QUEUE_WAIT", 100*time.Millisecond),
+		UpstreamProxy:          getEnv("UPSTREAM_PROXY", ""),
+		ProviderProxies:        getEnvMap("PROVIDER_PROXIES"),
+		RetryMaxAttempts:       getEnvInt("RETRY_MAX_ATTEMPTS", 0),
+		RetryMaxDuration:       getEnvDuration("RETRY_MAX_DURATION", 0),
+		UnknownModelProviders:  getEnvList("UNKNOWN_MODEL_PROVIDERS"),
+		StrictModelValidation:  getEnvBool("STRICT_MODEL_VALIDATION", false),
+		APIKeyPrefix:           getEnv("API_KEY_PREFIX", "gw_"),
+		APIKeyMinLength:        getEnvInt("API_KEY_MIN_LENGTH", 12),
+		APIKeyMaxLength:        getEnvInt("API_KEY_MAX_LENGTH", 128),
+		ClampSamplingParams:    getEnvBool("CLAMP_SAMPLING_PARAMS", false),
+		APIKeyCacheTTL:         getEnvDuration("API_KEY_CACHE_TTL", 30*time.Second),
+		APIKeyNegativeCacheTTL: getEnvDuration("API_KEY_NEGATIVE_CACHE_TTL", 10*time.Second),
+		DefaultRateLimit:       getEnvInt("DEFAULT_RATE_LIMIT", 100),
+		RateLimitMaxWait:       getEnvDuration("RATE_LIMIT_MAX_WAIT", 30*time.Second),
+		IPRateLimit:            getEnvInt("IP_RATE_LIMIT", 0),
+		RateLimitRetries:       getEnvInt("RATE_LIMIT_RETRIES", 2),
+		RateLimitRetryBackoff:  getEnvDuration("RATE_LIMIT_RETRY_BACKOFF", 20*time.Millisecond),
+		RateLimitFailClosed:    getEnvBool("RATE_LIMIT_FAIL_CLOSED", false),
+		TrustedProxies:         getEnvCIDRs("TRUSTED_PROXIES"),
+		AdminSigningSecret:     getEnv("ADMIN_SIGNING_SECRET", ""),
+		AdminSignatureMaxAge:   getEnvDuration("ADMIN_SIGNATURE_MAX_AGE", 5*time.Minute),
+		CacheTTLSeconds:        getEnvInt("CACHE_TTL_SECONDS", 3600),
+		CacheTTLMaxSeconds:     getEnvInt("CACHE_TTL_MAX_SECONDS", 86400),
+		CacheEnabled:           getEnvBool("CACHE_ENABLED", true),
+		CacheBackend:           getEnv("CACHE_BACKEND", "redis"),
+		CacheMemoryMaxEntries:  getEnvInt("CACHE_MEMORY_MAX_ENTRIES", 10000),
+		CacheFillWait:          getEnvDuration("CACHE_FILL_WAIT", 10*time.Second),
+		BatchMaxSize:           getEnvInt("BATCH_MAX_SIZE", 100),
+		BatchConcurrency:       getEnvInt("BATCH_CONCURRENCY", 4),
+		PriorityWorkers:        getEnvInt("PRIORITY_WORKERS", 0),
+		PriorityQueueSize:      getEnvInt("PRIORITY_QUEUE_SIZE", 100),
+		AudioMaxUploadMB:       getEnvInt("AUDIO_MAX_UPLOAD_MB", 25),
+		StreamReplayDelay:      getEnvDuration("STREAM_REPLAY_DELAY", 20*time.Millisecond),
+		StreamResumeMaxRetries: getEnvInt("STREAM_RESUME_MAX_RETRIES", 0),
+		AutoContinueMax:        getEnvInt("AUTO_CONTINUE_MAX", 3),
+		SchemaValidation:       getEnvBool("SCHEMA_VALIDATION", true),
+		HealthCheckInterval:    getEnvDuration("HEALTH_CHECK_INTERVAL", 5*time.Minute),
+		ProviderWarmup:         getEnvBool("PROVIDER_WARMUP", false),
+		OTLPEndpoint:           getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		OTelServiceName:        getEnv("OTEL_SERVICE_NAME", "llm0-gateway"),
+		AlertWebhookURL:        getEnv("ALERT_WEBHOOK_URL", ""),
+		AlertDebounceInterval:  getEnvDuration("ALERT_DEBOUNCE_INTERVAL", time.Minute),
+		LogExportBucket:        getEnv("LOG_EXPORT_BUCKET", ""),
+		LogExportRegion:        getEnv("LOG_EXPORT_REGION", "us-east-1"),
+		LogExportEndpoint:      getEnv("LOG_EXPORT_ENDPOINT", ""),
+		LogExportPrefix:        getEnv("LOG_EXPORT_PREFIX", "gateway-logs"),
+		LogExportRetention:     getEnvDuration("LOG_EXPORT_RETENTION", 30*24*time.Hour),
+		LogExportInterval:      getEnvDuration("LOG_EXPORT_INTERVAL", 24*time.Hour),
+		LogExportPageSize:      getEnvInt("LOG_EXPORT_PAGE_SIZE", 10000),
+		LogExportDelete:        getEnvBool("LOG_EXPORT_DELETE", false),
+		AWSAccessKeyID:         getEnv("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey:     getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken:        getEnv("AWS_SESSION_TOKEN", ""),
+		PostprocessTimeout:     getEnvDuration("POSTPROCESS_TIMEOUT", 2*time.Second),
+		PricingSyncSource:      getEnv("PRICING_SYNC_SOURCE", ""),
+		PricingSyncInterval:    getEnvDuration("PRICING_SYNC_INTERVAL", 24*time.Hour),
+		RedisMetricsInterval:   getEnvDuration("REDIS_METRICS_INTERVAL", 5*time.Minute),
 	}
 
-	// At least one provider API key is required
-	if cfg.OpenAIAPIKey == "" && cfg.AnthropicAPIKey == "" && cfg.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("at least one provider API key is required (OPENAI_API_KEY, ANTHROPIC_API_KEY, or GEMINI_API_KEY)")
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
 	return cfg, nil
 }
 
+// ProxyDirect as a proxy setting sends provider calls without any proxy
+const ProxyDirect = "direct"
+
+// validateProxy checks a proxy setting is empty, ProxyDirect or an
+// http(s)/socks5 URL with a host
+func validateProxy(name, proxy string) error {
+	if proxy == "" || proxy == ProxyDirect {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return fmt.Errorf("%s must be an http, https or socks5 proxy URL or %q", name, ProxyDirect)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -88,3 +373,156 @@ func getEnvBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationVal, err := time.ParseDuration(value); err == nil {
+			return durationVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvRoutingRules parses comma-separated "pattern=provider" pairs
+func getEnvRoutingRules(key string) []RoutingRule {
+	var rules []RoutingRule
+	for _, pair := range getEnvPairs(key) {
+		rules = append(rules, RoutingRule{Pattern: pair[0], Provider: pair[1]})
+	}
+	return rules
+}
+
+// getEnvTierRules parses "pattern=tier,pattern=tier" into tier rules
+func getEnvTierRules(key string) []TierRule {
+	var rules []TierRule
+	for _, pair := range getEnvPairs(key) {
+		rules = append(rules, TierRule{Pattern: pair[0], Tier: pair[1]})
+	}
+	return rules
+}
+
+// getEnvMap parses comma-separated "key=value" pairs into a map
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvPairs(key) {
+		values[pair[0]] = pair[1]
+	}
+	return values
+}
+
+// getEnvIntMap parses comma-separated "key=number" pairs, skipping invalid numbers
+func getEnvIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for _, pair := range getEnvPairs(key) {
+		if n, err := strconv.Atoi(pair[1]); err == nil {
+			values[pair[0]] = n
+		}
+	}
+	return values
+}
+
+// getEnvProviderRegions parses "provider=url|url,provider=url" into base URLs per provider
+func getEnvProviderRegions(key string) map[string][]string {
+	regions := make(map[string][]string)
+	for _, pair := range getEnvPairs(key) {
+		for _, baseURL := range strings.Split(pair[1], "|") {
+			if baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/"); baseURL != "" {
+				regions[pair[0]] = append(regions[pair[0]], baseURL)
+			}
+		}
+	}
+	return regions
+}
+
+// getEnvProviderHeaders parses "provider=Name:value|Name:value,provider=Name:value"
+// into headers per provider
+func getEnvProviderHeaders(key string) map[string]http.Header {
+	headers := make(map[string]http.Header)
+	for _, pair := range getEnvPairs(key) {
+		for _, header := range strings.Split(pair[1], "|") {
+			name, value, ok := strings.Cut(header, ":")
+			if name = strings.TrimSpace(name); !ok || name == "" {
+				continue
+			}
+			if headers[pair[0]] == nil {
+				headers[pair[0]] = make(http.Header)
+			}
+			headers[pair[0]].Add(name, strings.TrimSpace(value))
+		}
+	}
+	return headers
+}
+
+// getEnvProviderLists parses "provider=value|value,provider=value" into values per provider
+func getEnvProviderLists(key string) map[string][]string {
+	lists := make(map[string][]string)
+	for _, pair := range getEnvPairs(key) {
+		for _, value := range strings.Split(pair[1], "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				lists[pair[0]] = append(lists[pair[0]], value)
+			}
+		}
+	}
+	return lists
+}
+
+// getEnvList parses a comma-separated list, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvCIDRs parses a comma-separated list of CIDRs or bare IPs, skipping malformed entries
+func getEnvCIDRs(key string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv(key), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// getEnvPairs parses a comma-separated list of key=value pairs, skipping malformed entries
+func getEnvPairs(key string) [][2]string {
+	var pairs [][2]string
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			continue
+		}
+		pairs = append(pairs, [2]string{name, value})
+	}
+	return pairs
+}
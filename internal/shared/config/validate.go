@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/lib/pq"
+)
+
+// Validate checks the configuration for values that would otherwise fail late
+// or silently: required settings, URL formats and numeric ranges. Every problem
+// found is reported, each naming the environment variable to fix.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// Required settings
+	check(c.DatabaseURL != "", "DATABASE_URL is required")
+	check(c.OpenAIAPIKey != "" || c.AnthropicAPIKey != "" || c.GeminiAPIKey != "" || c.CohereAPIKey != "",
+		"at least one provider API key is required (OPENAI_API_KEY, ANTHROPIC_API_KEY, GEMINI_API_KEY, or COHERE_API_KEY)")
+
+	// URLs. These can carry credentials, so messages never repeat the value.
+	if c.DatabaseURL != "" {
+		check(validPostgresDSN(c.DatabaseURL), "DATABASE_URL must be a postgres:// URL or a key=value connection string that lib/pq accepts")
+	}
+	switch c.RedisMode {
+	case "", "single":
+		check(validRedisURL(c.RedisURL), "REDIS_URL must be a redis://, rediss:// or unix:// URL")
+	case "cluster":
+		check(len(c.RedisAddrs) > 0, "REDIS_ADDRS must list the cluster nodes when REDIS_MODE=cluster")
+	case "sentinel":
+		check(len(c.RedisAddrs) > 0, "REDIS_ADDRS must list the sentinels when REDIS_MODE=sentinel")
+		check(c.RedisMasterName != "", "REDIS_MASTER_NAME is required when REDIS_MODE=sentinel")
+	default:
+		check(false, "REDIS_MODE must be single, cluster or sentinel, got %q", c.RedisMode)
+	}
+	if c.AlertWebhookURL != "" {
+		check(validURL(c.AlertWebhookURL, "http", "https"), "ALERT_WEBHOOK_URL must be an http or https URL")
+	}
+	if c.OTLPEndpoint != "" && strings.Contains(c.OTLPEndpoint, "://") {
+		check(validURL(c.OTLPEndpoint, "http", "https"), "OTEL_EXPORTER_OTLP_ENDPOINT must be host:port or an http(s) URL")
+	}
+	if c.LogExportEndpoint != "" {
+		check(validURL(c.LogExportEndpoint, "http", "https"), "LOG_EXPORT_ENDPOINT must be an http or https URL")
+	}
+	if strings.Contains(c.PricingSyncSource, "://") {
+		check(validURL(c.PricingSyncSource, "http", "https"), "PRICING_SYNC_SOURCE must be an http(s) URL or a file path")
+	}
+	if err := validateProxy("UPSTREAM_PROXY", c.UpstreamProxy); err != nil {
+		errs = append(errs, err)
+	}
+	for provider, proxy := range c.ProviderProxies {
+		if err := validateProxy("PROVIDER_PROXIES "+provider, proxy); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Enumerations
+	check(c.CacheBackend == "redis" || c.CacheBackend == "memory", "CACHE_BACKEND must be redis or memory, got %q", c.CacheBackend)
+
+	// Numeric ranges
+	check(c.DefaultRateLimit > 0, "DEFAULT_RATE_LIMIT must be > 0, got %d", c.DefaultRateLimit)
+	check(c.IPRateLimit >= 0, "IP_RATE_LIMIT must be >= 0 (0 disables it), got %d", c.IPRateLimit)
+	check(c.CacheTTLSeconds >= 0, "CACHE_TTL_SECONDS must be >= 0, got %d", c.CacheTTLSeconds)
+	check(c.CacheTTLMaxSeconds > 0, "CACHE_TTL_MAX_SECONDS must be > 0, got %d", c.CacheTTLMaxSeconds)
+	check(c.CacheMemoryMaxEntries > 0 || c.CacheBackend != "memory", "CACHE_MEMORY_MAX_ENTRIES must be > 0, got %d", c.CacheMemoryMaxEntries)
+	check(c.RequestTimeout > 0, "REQUEST_TIMEOUT must be > 0, got %s", c.RequestTimeout)
+	check(c.RequestTimeoutMax >= c.RequestTimeout, "REQUEST_TIMEOUT_MAX (%s) must be >= REQUEST_TIMEOUT (%s)", c.RequestTimeoutMax, c.RequestTimeout)
+	check(c.DBMaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be > 0, got %d", c.DBMaxOpenConns)
+	check(c.DBMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must be >= 0, got %d", c.DBMaxIdleConns)
+	check(c.LogBufferSize > 0, "LOG_BUFFER_SIZE must be > 0, got %d", c.LogBufferSize)
+	check(c.LogWorkers > 0, "LOG_WORKERS must be > 0, got %d", c.LogWorkers)
+	check(c.LogBatchSize > 0, "LOG_BATCH_SIZE must be > 0, got %d", c.LogBatchSize)
+	check(c.LogSampleRate >= 0 && c.LogSampleRate <= 1, "LOG_SAMPLE_RATE must be between 0 and 1, got %v", c.LogSampleRate)
+	check(c.LogCacheHitSampleRate >= 0 && c.LogCacheHitSampleRate <= 1, "LOG_SAMPLE_RATE_CACHE_HITS must be between 0 and 1, got %v", c.LogCacheHitSampleRate)
+	check(c.BatchMaxSize > 0, "BATCH_MAX_SIZE must be > 0, got %d", c.BatchMaxSize)
+	check(c.BatchConcurrency > 0, "BATCH_CONCURRENCY must be > 0, got %d", c.BatchConcurrency)
+	check(c.PriorityWorkers >= 0, "PRIORITY_WORKERS must be >= 0 (0 = unbounded), got %d", c.PriorityWorkers)
+	check(c.AudioMaxUploadMB > 0, "AUDIO_MAX_UPLOAD_MB must be > 0, got %d", c.AudioMaxUploadMB)
+	check(c.APIKeyMinLength > 0 && c.APIKeyMinLength <= c.APIKeyMaxLength,
+		"API_KEY_MIN_LENGTH (%d) must be > 0 and <= API_KEY_MAX_LENGTH (%d)", c.APIKeyMinLength, c.APIKeyMaxLength)
+	check(c.RetryMaxAttempts >= 0, "RETRY_MAX_ATTEMPTS must be >= 0 (0 = unlimited), got %d", c.RetryMaxAttempts)
+	check(c.RetryMaxDuration >= 0, "RETRY_MAX_DURATION must be >= 0 (0 = unlimited), got %s", c.RetryMaxDuration)
+	check(c.HealthCheckInterval >= 0, "HEALTH_CHECK_INTERVAL must be >= 0 (0 disables checks), got %s", c.HealthCheckInterval)
+	check(c.RedisMetricsInterval >= 0, "REDIS_METRICS_INTERVAL must be >= 0 (0 = not exported), got %s", c.RedisMetricsInterval)
+	for provider, limit := range c.ProviderConcurrency {
+		check(limit >= 0, "PROVIDER_CONCURRENCY %s must be >= 0, got %d", provider, limit)
+	}
+
+	return errors.Join(errs...)
+}
+
+// EnabledProviders lists the providers with an API key configured
+func (c *Config) EnabledProviders() []string {
+	var enabled []string
+	for _, p := range []struct {
+		name string
+		key  string
+	}{
+		{"openai", c.OpenAIAPIKey},
+		{"anthropic", c.AnthropicAPIKey},
+		{"google", c.GeminiAPIKey},
+		{"cohere", c.CohereAPIKey},
+	} {
+		if p.key != "" {
+			enabled = append(enabled, p.name)
+		}
+	}
+	return enabled
+}
+
+// EnabledFeatures lists the optional gateway features that are switched on,
+// for the startup summary
+func (c *Config) EnabledFeatures() []string {
+	var enabled []string
+	add := func(on bool, feature string) {
+		if on {
+			enabled = append(enabled, feature)
+		}
+	}
+	add(c.CacheEnabled, fmt.Sprintf("cache (%s, %ds)", c.CacheBackend, c.CacheTTLSeconds))
+	add(c.CompressionEnabled, "compression")
+	add(c.IPRateLimit > 0, fmt.Sprintf("ip rate limit (%d/min)", c.IPRateLimit))
+	add(c.AdminSigningSecret != "", "admin endpoints")
+	add(c.APIKeyCacheTTL > 0, "api key cache")
+	add(c.PriorityWorkers > 0, fmt.Sprintf("priority queue (%d workers)", c.PriorityWorkers))
+	add(len(c.RoutingRules) > 0, "routing rules")
+	add(len(c.ModelDowngrades) > 0, "model downgrades")
+	add(len(c.ProviderRegions) > 0, "regional routing")
+	add(c.UpstreamProxy != "" || len(c.ProviderProxies) > 0, "upstream proxy")
+	add(c.StreamResumeMaxRetries > 0, "stream resume")
+	add(c.SchemaValidation, "schema validation")
+	add(c.EchoRequestedModel, "echo requested model")
+	add(c.ProviderWarmup, "provider warmup")
+	add(c.OTLPEndpoint != "", "tracing")
+	add(c.AlertWebhookURL != "", "alerts")
+	add(c.LogExportBucket != "", "log export")
+	add(c.PricingSyncSource != "", "pricing sync")
+	add(c.LogWriteFailClosed, "log writes fail closed")
+	add(c.RateLimitFailClosed, "rate limits fail closed")
+	return enabled
+}
+
+// validURL checks value parses as a URL with a host and one of the schemes
+func validURL(value string, schemes ...string) bool {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// validPostgresDSN checks value parses as a lib/pq connection string: a
+// postgres:// URL (host optional, e.g. postgres:///db?host=/var/run/postgresql)
+// or key=value pairs. Nothing is dialled.
+func validPostgresDSN(value string) bool {
+	_, err := pq.NewConnector(value)
+	return err == nil
+}
+
+// validRedisURL checks value parses as a go-redis URL (redis://, rediss:// or unix://)
+func validRedisURL(value string) bool {
+	_, err := redis.ParseURL(value)
+	return err == nil
+}
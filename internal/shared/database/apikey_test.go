@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+var selectAPIKey = regexp.QuoteMeta("FROM api_keys\n\t\tWHERE key_hash = $1 AND is_active = true")
+
+// apiKeyRow is an active key row with the given features column
+func apiKeyRow(features string) *sqlmock.Rows {
+	return apiKeyRowWithSafety("{}", features)
+}
+
+// apiKeyRowWithSafety is apiKeyRow with a gemini_safety_settings column too
+func apiKeyRowWithSafety(safetySettings, features string) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows([]string{
+		"id", "key_hash", "key_prefix", "name", "rate_limit_per_minute", "rate_limit_wait_seconds",
+		"max_concurrent_requests", "max_output_tokens", "cache_enabled", "cache_ttl_seconds",
+		"prompt_caching_enabled", "stream_coalesce_chars", "stream_coalesce_ms", "openai_organization",
+		"postprocess_webhook_url", "postprocess_fail_closed", "prompt_prelude", "prompt_suffix",
+		"prompt_prelude_override", "gemini_safety_settings", "features", "is_active", "last_used_at", "created_at", "updated_at",
+	}).AddRow(
+		"key-1", HashAPIKey("gw_test_abc"), "gw_test_abc", "test", 60, 0,
+		0, 0, true, 3600,
+		false, 0, 0, "",
+		"", false, "", "",
+		false, []byte(safetySettings), []byte(features), true, nil, now, now,
+	)
+}
+
+func TestGetAPIKeyParsesFeatures(t *testing.T) {
+	db, mock := mockDB(t)
+	mock.ExpectQuery(selectAPIKey).WillReturnRows(apiKeyRow(`{"race_mode": true, "stream_resume_retries": 2}`))
+
+	key, err := db.GetAPIKey(context.Background(), "gw_test_abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.GetBool(models.FeatureRaceMode, false) || key.GetInt(models.FeatureStreamResumeRetries, 0) != 2 {
+		t.Errorf("flags not read: %v", key.Features)
+	}
+	if key.GetBool(models.FeatureAutoContinue, false) || key.GetInt(models.FeatureRetryMaxAttempts, 7) != 7 {
+		t.Error("missing flags should use the defaults")
+	}
+}
+
+func TestGetAPIKeyToleratesNonObjectFeatures(t *testing.T) {
+	for _, features := range []string{`[]`, `"race_mode"`, `true`, `42`, `null`} {
+		db, mock := mockDB(t)
+		mock.ExpectQuery(selectAPIKey).WillReturnRows(apiKeyRow(features))
+
+		key, err := db.GetAPIKey(context.Background(), "gw_test_abc")
+		if err != nil {
+			t.Errorf("features %s: key rejected: %v", features, err)
+			continue
+		}
+		if key.ID != "key-1" || key.GetBool(models.FeatureRaceMode, false) || key.GetInt(models.FeatureStreamResumeRetries, 3) != 3 {
+			t.Errorf("features %s: expected the key with default flags, got %+v", features, key)
+		}
+	}
+}
+
+func TestGetAPIKeyReadsGeminiSafetySettings(t *testing.T) {
+	db, mock := mockDB(t)
+	mock.ExpectQuery(selectAPIKey).WillReturnRows(apiKeyRowWithSafety(`{"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_ONLY_HIGH"}`, "{}"))
+	key, err := db.GetAPIKey(context.Background(), "gw_test_abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key.GeminiSafetySettings) != 1 || key.GeminiSafetySettings["HARM_CATEGORY_DANGEROUS_CONTENT"] != "BLOCK_ONLY_HIGH" {
+		t.Errorf("safety settings not read: %v", key.GeminiSafetySettings)
+	}
+
+	db, mock = mockDB(t)
+	mock.ExpectQuery(selectAPIKey).WillReturnRows(apiKeyRowWithSafety(`["BLOCK_NONE"]`, "{}"))
+	if _, err := db.GetAPIKey(context.Background(), "gw_test_abc"); err == nil {
+		t.Error("expected malformed safety settings to be an error")
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// ErrConversationNotFound is returned when no conversation with the ID belongs to the key
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// CreateConversation starts an empty conversation owned by apiKeyID
+func (db *DB) CreateConversation(ctx context.Context, apiKeyID string) (*models.Conversation, error) {
+	conversation := models.Conversation{APIKeyID: apiKeyID}
+	err := db.conn.QueryRowContext(ctx, `
+		INSERT INTO conversations (api_key_id) VALUES ($1)
+		RETURNING id, created_at, updated_at
+	`, apiKeyID).Scan(&conversation.ID, &conversation.CreatedAt, &conversation.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &conversation, nil
+}
+
+// GetConversationMessages returns a conversation's messages, oldest first.
+// Conversations owned by another key are reported as not found.
+func (db *DB) GetConversationMessages(ctx context.Context, conversationID, apiKeyID string) ([]models.ConversationMessage, error) {
+	var exists int
+	err := db.conn.QueryRowContext(ctx, `
+		SELECT 1 FROM conversations WHERE id = $1 AND api_key_id = $2
+	`, conversationID, apiKeyID).Scan(&exists)
+	if err == sql.ErrNoRows || isInvalidUUID(err) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT message, created_at FROM conversation_messages
+		WHERE conversation_id = $1
+		ORDER BY id
+	`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.ConversationMessage
+	for rows.Next() {
+		var message models.ConversationMessage
+		if err := rows.Scan(&message.Message, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// AppendConversationMessages adds messages (JSON) to the end of a conversation
+func (db *DB) AppendConversationMessages(ctx context.Context, conversationID string, messages []string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, message := range messages {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO conversation_messages (conversation_id, message) VALUES ($1, $2)
+		`, conversationID, message); err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE conversations SET updated_at = NOW() WHERE id = $1
+	`, conversationID); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	return tx.Commit()
+}
+
+// isInvalidUUID reports whether err is Postgres rejecting a malformed UUID
+func isInvalidUUID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "22P02" // invalid_text_representation
+}
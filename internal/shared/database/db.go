@@ -4,11 +4,17 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
 )
 
@@ -16,17 +22,33 @@ type DB struct {
 	conn *sql.DB
 }
 
+// PoolConfig holds connection pool settings
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// apply configures conn's connection pool
+func (p PoolConfig) apply(conn *sql.DB) {
+	conn.SetMaxOpenConns(p.MaxOpenConns)
+	conn.SetMaxIdleConns(p.MaxIdleConns)
+	conn.SetConnMaxLifetime(p.ConnMaxLifetime)
+}
+
+// FromConn wraps an already open connection pool, such as one from a mock driver
+func FromConn(conn *sql.DB) *DB {
+	return &DB{conn: conn}
+}
+
 // New creates a new database connection
-func New(databaseURL string) (*DB, error) {
+func New(databaseURL string, pool PoolConfig) (*DB, error) {
 	conn, err := sql.Open("postgres", databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Configure connection pool
-	conn.SetMaxOpenConns(25)
-	conn.SetMaxIdleConns(10)
-	conn.SetConnMaxLifetime(5 * time.Minute)
+	pool.apply(conn)
 
 	// Test connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -39,33 +61,67 @@ func New(databaseURL string) (*DB, error) {
 	return &DB{conn: conn}, nil
 }
 
+// Stats returns connection pool statistics
+func (db *DB) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// ErrInvalidAPIKey is returned when no active key matches
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrMalformedID is returned when an ID isn't a valid UUID
+var ErrMalformedID = errors.New("malformed ID")
+
+// HashAPIKey returns the SHA-256 hex digest stored in api_keys.key_hash
+func HashAPIKey(rawKey string) string {
+	hash := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(hash[:])
+}
+
 // GetAPIKey retrieves an API key by its raw key value
 func (db *DB) GetAPIKey(ctx context.Context, rawKey string) (*models.APIKey, error) {
 	// Hash the key
-	hash := sha256.Sum256([]byte(rawKey))
-	keyHash := hex.EncodeToString(hash[:])
+	keyHash := HashAPIKey(rawKey)
 
 	query := `
-		SELECT id, key_hash, key_prefix, name, rate_limit_per_minute, cache_enabled, 
-		       cache_ttl_seconds, is_active, last_used_at, created_at, updated_at
+		SELECT id, key_hash, key_prefix, name, rate_limit_per_minute, rate_limit_wait_seconds,
+		       max_concurrent_requests, max_output_tokens, cache_enabled, cache_ttl_seconds,
+		       prompt_caching_enabled, stream_coalesce_chars, stream_coalesce_ms, COALESCE(openai_organization, ''),
+		       COALESCE(postprocess_webhook_url, ''), postprocess_fail_closed, COALESCE(prompt_prelude, ''), COALESCE(prompt_suffix, ''),
+		       prompt_prelude_override, COALESCE(gemini_safety_settings, '{}'), COALESCE(features, '{}'), is_active, last_used_at, created_at, updated_at
 		FROM api_keys
 		WHERE key_hash = $1 AND is_active = true
 	`
 
 	var apiKey models.APIKey
+	var safetySettings, features []byte
 	err := db.conn.QueryRowContext(ctx, query, keyHash).Scan(
 		&apiKey.ID,
 		&apiKey.KeyHash,
 		&apiKey.KeyPrefix,
 		&apiKey.Name,
 		&apiKey.RateLimitPerMinute,
+		&apiKey.RateLimitWaitSeconds,
+		&apiKey.MaxConcurrentRequests,
+		&apiKey.MaxOutputTokens,
 		&apiKey.CacheEnabled,
 		&apiKey.CacheTTLSeconds,
+		&apiKey.PromptCachingEnabled,
+		&apiKey.StreamCoalesceChars,
+		&apiKey.StreamCoalesceMs,
+		&apiKey.OpenAIOrganization,
+		&apiKey.PostprocessURL,
+		&apiKey.PostprocessFailClosed,
+		&apiKey.PromptPrelude,
+		&apiKey.PromptSuffix,
+		&apiKey.PromptPreludeOverride,
+		&safetySettings,
+		&features,
 		&apiKey.IsActive,
 		&apiKey.LastUsedAt,
 		&apiKey.CreatedAt,
@@ -73,12 +129,21 @@ func (db *DB) GetAPIKey(ctx context.Context, rawKey string) (*models.APIKey, err
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("invalid API key")
+		return nil, ErrInvalidAPIKey
 	}
 	if err != nil {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
+	if err := json.Unmarshal(features, &apiKey.Features); err != nil {
+		// A bad flag value shouldn't lock the key out - run it with no flags
+		log.Printf("Ignoring features for key %s, not a JSON object: %v", apiKey.KeyPrefix, err)
+		apiKey.Features = nil
+	}
+	if err := json.Unmarshal(safetySettings, &apiKey.GeminiSafetySettings); err != nil {
+		return nil, fmt.Errorf("invalid gemini_safety_settings for key %s: %w", apiKey.KeyPrefix, err)
+	}
+
 	return &apiKey, nil
 }
 
@@ -89,11 +154,31 @@ func (db *DB) UpdateAPIKeyLastUsed(ctx context.Context, apiKeyID string) error {
 	return err
 }
 
+// RevokeAPIKey deactivates an API key by ID and returns its hash
+func (db *DB) RevokeAPIKey(ctx context.Context, apiKeyID string) (string, error) {
+	query := `UPDATE api_keys SET is_active = false, updated_at = NOW() WHERE id = $1 RETURNING key_hash`
+
+	var keyHash string
+	err := db.conn.QueryRowContext(ctx, query, apiKeyID).Scan(&keyHash)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidAPIKey
+	}
+	if isInvalidUUID(err) {
+		return "", ErrMalformedID
+	}
+	if err != nil {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	return keyHash, nil
+}
+
 // GetModelPricing retrieves pricing for a model
 func (db *DB) GetModelPricing(ctx context.Context, provider, model string) (*models.ModelPricing, error) {
 	query := `
 		SELECT id, provider, model, input_per_1k_tokens, output_per_1k_tokens,
-		       context_window, supports_streaming, created_at, updated_at
+		       COALESCE(context_window, 0), COALESCE(supports_streaming, true), cache_ttl_seconds,
+		       COALESCE(price_per_minute, 0), created_at, updated_at
 		FROM model_pricing
 		WHERE provider = $1 AND model = $2
 	`
@@ -107,6 +192,8 @@ func (db *DB) GetModelPricing(ctx context.Context, provider, model string) (*mod
 		&pricing.OutputPer1kTokens,
 		&pricing.ContextWindow,
 		&pricing.SupportsStreaming,
+		&pricing.CacheTTLSeconds,
+		&pricing.PricePerMinute,
 		&pricing.CreatedAt,
 		&pricing.UpdatedAt,
 	)
@@ -121,34 +208,596 @@ func (db *DB) GetModelPricing(ctx context.Context, provider, model string) (*mod
 	return &pricing, nil
 }
 
-// LogRequest logs a gateway request
-func (db *DB) LogRequest(ctx context.Context, log *models.GatewayLog) error {
-	query := `
-		INSERT INTO gateway_logs (
-			api_key_id, method, endpoint, model, provider, cost_usd, latency_ms,
-			prompt_tokens, completion_tokens, total_tokens, cache_hit, failover_used,
-			original_provider, status_code, error_message
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
-	`
+// ListModelPricing returns every model_pricing row
+func (db *DB) ListModelPricing(ctx context.Context) ([]models.ModelPricing, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+		SELECT id, provider, model, input_per_1k_tokens, output_per_1k_tokens,
+		       COALESCE(context_window, 0), COALESCE(supports_streaming, true),
+		       cache_ttl_seconds, COALESCE(price_per_minute, 0), created_at, updated_at
+		FROM model_pricing
+		ORDER BY provider, model
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []models.ModelPricing
+	for rows.Next() {
+		var pricing models.ModelPricing
+		if err := rows.Scan(
+			&pricing.ID,
+			&pricing.Provider,
+			&pricing.Model,
+			&pricing.InputPer1kTokens,
+			&pricing.OutputPer1kTokens,
+			&pricing.ContextWindow,
+			&pricing.SupportsStreaming,
+			&pricing.CacheTTLSeconds,
+			&pricing.PricePerMinute,
+			&pricing.CreatedAt,
+			&pricing.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		prices = append(prices, pricing)
+	}
+	return prices, rows.Err()
+}
+
+// SyncModelPricing upserts pricing rows (provider, model, token and per-minute
+// prices, context window, streaming support) in one transaction, recording
+// every insert or change in model_pricing_audit. Only the fields an update
+// provides are written; rows that already match are left alone, and
+// cache_ttl_seconds is never touched.
+func (db *DB) SyncModelPricing(ctx context.Context, prices []models.PricingUpdate, source string) (inserted, updated int, err error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range prices {
+		price := &prices[i]
+
+		var current models.ModelPricing
+		err := tx.QueryRowContext(ctx, `
+			SELECT input_per_1k_tokens, output_per_1k_tokens, COALESCE(context_window, 0),
+			       COALESCE(supports_streaming, true), COALESCE(price_per_minute, 0)
+			FROM model_pricing
+			WHERE provider = $1 AND model = $2
+			FOR UPDATE
+		`, price.Provider, price.Model).Scan(
+			&current.InputPer1kTokens,
+			&current.OutputPer1kTokens,
+			&current.ContextWindow,
+			&current.SupportsStreaming,
+			&current.PricePerMinute,
+		)
+
+		// Omitted fields are passed as NULL and fall back to the current value
+		contextWindow, supportsStreaming, pricePerMinute := nullableInt(price.ContextWindow), nullableBool(price.SupportsStreaming), nullableFloat(price.PricePerMinute)
+
+		action := "update"
+		var merged models.ModelPricing
+		switch {
+		case err == sql.ErrNoRows:
+			action = "insert"
+			merged = applyPricingUpdate(models.ModelPricing{SupportsStreaming: true}, price)
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO model_pricing (provider, model, input_per_1k_tokens, output_per_1k_tokens,
+				                           context_window, supports_streaming, price_per_minute)
+				VALUES ($1, $2, $3, $4, $5, COALESCE($6, true), $7)
+			`, price.Provider, price.Model, price.InputPer1kTokens, price.OutputPer1kTokens,
+				contextWindow, supportsStreaming, pricePerMinute)
+		case err != nil:
+		default:
+			merged = applyPricingUpdate(current, price)
+			if samePricing(&current, &merged) {
+				continue
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE model_pricing
+				SET input_per_1k_tokens = $3, output_per_1k_tokens = $4,
+				    context_window = COALESCE($5, context_window),
+				    supports_streaming = COALESCE($6, supports_streaming),
+				    price_per_minute = COALESCE($7, price_per_minute),
+				    updated_at = NOW()
+				WHERE provider = $1 AND model = $2
+			`, price.Provider, price.Model, price.InputPer1kTokens, price.OutputPer1kTokens,
+				contextWindow, supportsStreaming, pricePerMinute)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to sync pricing for %s/%s: %w", price.Provider, price.Model, err)
+		}
 
-	_, err := db.conn.ExecContext(ctx,
-		query,
+		var oldValues sql.NullString
+		if action == "update" {
+			oldValues = sql.NullString{String: pricingAuditValues(&current), Valid: true}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO model_pricing_audit (provider, model, action, old_values, new_values, source)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, price.Provider, price.Model, action, oldValues, pricingAuditValues(&merged), source); err != nil {
+			return 0, 0, fmt.Errorf("failed to audit pricing for %s/%s: %w", price.Provider, price.Model, err)
+		}
+
+		if action == "insert" {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("database error: %w", err)
+	}
+	return inserted, updated, nil
+}
+
+// applyPricingUpdate returns current with the fields the update provides
+func applyPricingUpdate(current models.ModelPricing, update *models.PricingUpdate) models.ModelPricing {
+	current.InputPer1kTokens = update.InputPer1kTokens
+	current.OutputPer1kTokens = update.OutputPer1kTokens
+	if update.ContextWindow != nil {
+		current.ContextWindow = *update.ContextWindow
+	}
+	if update.SupportsStreaming != nil {
+		current.SupportsStreaming = *update.SupportsStreaming
+	}
+	if update.PricePerMinute != nil {
+		current.PricePerMinute = *update.PricePerMinute
+	}
+	return current
+}
+
+func nullableInt(v *int) sql.NullInt64 {
+	if v == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
+
+func nullableBool(v *bool) sql.NullBool {
+	if v == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *v, Valid: true}
+}
+
+func nullableFloat(v *float64) sql.NullFloat64 {
+	if v == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *v, Valid: true}
+}
+
+// samePricing compares the synced pricing fields, with prices at the column's
+// six-decimal precision
+func samePricing(a, b *models.ModelPricing) bool {
+	samePrice := func(x, y float64) bool { return math.Abs(x-y) < 5e-7 }
+	return samePrice(a.InputPer1kTokens, b.InputPer1kTokens) &&
+		samePrice(a.OutputPer1kTokens, b.OutputPer1kTokens) &&
+		samePrice(a.PricePerMinute, b.PricePerMinute) &&
+		a.ContextWindow == b.ContextWindow &&
+		a.SupportsStreaming == b.SupportsStreaming
+}
+
+// pricingAuditValues encodes the synced pricing fields for model_pricing_audit
+func pricingAuditValues(p *models.ModelPricing) string {
+	values, _ := json.Marshal(map[string]interface{}{
+		"input_per_1k_tokens":  p.InputPer1kTokens,
+		"output_per_1k_tokens": p.OutputPer1kTokens,
+		"context_window":       p.ContextWindow,
+		"supports_streaming":   p.SupportsStreaming,
+		"price_per_minute":     p.PricePerMinute,
+	})
+	return string(values)
+}
+
+// gatewayLogColumns lists the gateway_logs columns written by LogRequests
+var gatewayLogColumns = []string{
+	"api_key_id", "method", "endpoint", "model", "provider", "cost_usd", "cache_savings_usd", "latency_ms",
+	"prompt_tokens", "completion_tokens", "total_tokens", "cache_hit", "failover_used",
+	"race_used", "original_provider", "original_model", "served_model", "end_user", "organization",
+	"client_ip", "finish_reason", "status_code", "error_message", "error_type", "metadata",
+	"sample_weight",
+}
+
+// gatewayLogValues returns the column values for a log entry, in gatewayLogColumns order
+func gatewayLogValues(log *models.GatewayLog) []interface{} {
+	return []interface{}{
 		log.APIKeyID,
 		log.Method,
 		log.Endpoint,
 		log.Model,
 		log.Provider,
 		log.CostUSD,
+		log.CacheSavingsUSD,
 		log.LatencyMs,
 		log.PromptTokens,
 		log.CompletionTokens,
 		log.TotalTokens,
 		log.CacheHit,
 		log.FailoverUsed,
+		log.RaceUsed,
 		log.OriginalProvider,
+		log.OriginalModel,
+		log.ServedModel,
+		log.EndUser,
+		log.Organization,
+		log.ClientIP,
+		log.FinishReason,
 		log.StatusCode,
 		log.ErrorMessage,
-	)
+		log.ErrorType,
+		logMetadata(log.Metadata),
+		sampleWeight(log),
+	}
+}
+
+// sampleWeight is the number of requests a log row stands for
+func sampleWeight(log *models.GatewayLog) float64 {
+	if log.SampleWeight <= 0 {
+		return 1
+	}
+	return log.SampleWeight
+}
+
+// LogRequest logs a gateway request
+func (db *DB) LogRequest(ctx context.Context, log *models.GatewayLog) error {
+	return db.LogRequests(ctx, []*models.GatewayLog{log})
+}
+
+// maxBindParams is the most bind parameters Postgres accepts in one statement
+const maxBindParams = 65535
+
+// LogRequests logs a batch of gateway requests with a multi-row INSERT. Batches
+// with more rows than one statement's bind parameters allow are split across
+// several INSERTs in one transaction, so they're still written all or nothing.
+func (db *DB) LogRequests(ctx context.Context, logs []*models.GatewayLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	rowsPerInsert := maxBindParams / len(gatewayLogColumns)
+	if len(logs) <= rowsPerInsert {
+		query, args := insertLogsQuery(logs)
+		_, err := db.conn.ExecContext(ctx, query, args...)
+		return err
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	for start := 0; start < len(logs); start += rowsPerInsert {
+		end := start + rowsPerInsert
+		if end > len(logs) {
+			end = len(logs)
+		}
+		query, args := insertLogsQuery(logs[start:end])
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertLogsQuery builds the multi-row gateway_logs INSERT for logs
+func insertLogsQuery(logs []*models.GatewayLog) (string, []interface{}) {
+	var query strings.Builder
+	query.WriteString("INSERT INTO gateway_logs (")
+	query.WriteString(strings.Join(gatewayLogColumns, ", "))
+	query.WriteString(") VALUES ")
+
+	args := make([]interface{}, 0, len(logs)*len(gatewayLogColumns))
+	for i, log := range logs {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j := range gatewayLogColumns {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+		args = append(args, gatewayLogValues(log)...)
+	}
+	return query.String(), args
+}
+
+// UpdateAPIKeysLastUsed sets last_used_at for several keys at once, never moving it backwards
+func (db *DB) UpdateAPIKeysLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	if len(lastUsed) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(lastUsed))
+	times := make([]string, 0, len(lastUsed))
+	for id, usedAt := range lastUsed {
+		ids = append(ids, id)
+		times = append(times, usedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	query := `
+		UPDATE api_keys AS k SET last_used_at = v.used_at
+		FROM unnest($1::uuid[], $2::timestamptz[]) AS v(id, used_at)
+		WHERE k.id = v.id AND (k.last_used_at IS NULL OR k.last_used_at < v.used_at)
+	`
+	_, err := db.conn.ExecContext(ctx, query, pq.Array(ids), pq.Array(times))
 	return err
 }
+
+// GetUsageByUser aggregates usage per end-user for an API key since the given
+// time. Sampled rows count for every request they stand for.
+func (db *DB) GetUsageByUser(ctx context.Context, apiKeyID string, since time.Time) ([]models.UserUsage, error) {
+	query := `
+		SELECT end_user, ROUND(SUM(sample_weight))::BIGINT,
+		       COALESCE(ROUND(SUM(prompt_tokens * sample_weight)), 0)::BIGINT,
+		       COALESCE(ROUND(SUM(completion_tokens * sample_weight)), 0)::BIGINT,
+		       COALESCE(ROUND(SUM(total_tokens * sample_weight)), 0)::BIGINT,
+		       COALESCE(SUM(cost_usd * sample_weight), 0), COALESCE(SUM(cache_savings_usd * sample_weight), 0)
+		FROM gateway_logs
+		WHERE api_key_id = $1 AND end_user IS NOT NULL AND created_at >= $2
+		GROUP BY end_user
+		ORDER BY SUM(cost_usd * sample_weight) DESC
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, apiKeyID, since)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []models.UserUsage
+	for rows.Next() {
+		var u models.UserUsage
+		if err := rows.Scan(
+			&u.EndUser,
+			&u.RequestCount,
+			&u.PromptTokens,
+			&u.CompletionTokens,
+			&u.TotalTokens,
+			&u.CostUSD,
+			&u.CacheSavingsUSD,
+		); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetLatencyStats computes latency percentiles per provider and model between start and end.
+// Empty provider, model or apiKeyID match all, as does empty metadata; otherwise only requests
+// tagged with every given metadata pair count. Cache hits and failed requests are excluded.
+func (db *DB) GetLatencyStats(ctx context.Context, apiKeyID, provider, model string, metadata map[string]string, start, end time.Time) ([]models.LatencyStats, error) {
+	query := `
+		SELECT provider, model, COUNT(*), AVG(latency_ms),
+		       PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency_ms),
+		       PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY latency_ms),
+		       PERCENTILE_CONT(0.99) WITHIN GROUP (ORDER BY latency_ms)
+		FROM gateway_logs
+		WHERE created_at >= $1 AND created_at < $2
+		  AND cache_hit = false AND status_code = 200
+		  AND ($3 = '' OR provider = $3)
+		  AND ($4 = '' OR model = $4)
+		  AND ($5::jsonb IS NULL OR metadata @> $5::jsonb)
+		  AND ($6 = '' OR api_key_id::text = $6)
+		GROUP BY provider, model
+		ORDER BY provider, model
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, start, end, provider, model, logMetadata(metadata), apiKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.LatencyStats
+	for rows.Next() {
+		var s models.LatencyStats
+		if err := rows.Scan(
+			&s.Provider,
+			&s.Model,
+			&s.RequestCount,
+			&s.AvgMs,
+			&s.P50Ms,
+			&s.P90Ms,
+			&s.P99Ms,
+		); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetErrorStats counts failed requests per provider, model and error type
+// between start and end. Empty provider, model or metadata match all.
+func (db *DB) GetErrorStats(ctx context.Context, provider, model string, metadata map[string]string, start, end time.Time) ([]models.ErrorStats, error) {
+	query := `
+		SELECT provider, model, COALESCE(error_type, 'other'), COUNT(*)
+		FROM gateway_logs
+		WHERE created_at >= $1 AND created_at < $2
+		  AND error_message IS NOT NULL
+		  AND ($3 = '' OR provider = $3)
+		  AND ($4 = '' OR model = $4)
+		  AND ($5::jsonb IS NULL OR metadata @> $5::jsonb)
+		GROUP BY 1, 2, 3
+		ORDER BY 4 DESC, 1, 2, 3
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, start, end, provider, model, logMetadata(metadata))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.ErrorStats
+	for rows.Next() {
+		var s models.ErrorStats
+		if err := rows.Scan(&s.Provider, &s.Model, &s.ErrorType, &s.Count); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return stats, nil
+}
+
+// ExportLogs pages through logs created before `before`, oldest first, passing
+// each page of up to pageSize rows to fn. Paging is keyset-based, so fn may
+// delete the rows it was given. Stops at the first error from fn.
+func (db *DB) ExportLogs(ctx context.Context, before time.Time, pageSize int, fn func(page []*models.GatewayLog) error) error {
+	query := `
+		SELECT id, ` + strings.Join(gatewayLogColumns, ", ") + `, created_at
+		FROM gateway_logs
+		WHERE created_at < $1 AND (created_at, id) > ($2, $3)
+		ORDER BY created_at, id
+		LIMIT $4
+	`
+
+	cursorTime, cursorID := time.Time{}, "00000000-0000-0000-0000-000000000000"
+	for {
+		page, err := db.logPage(ctx, query, before, cursorTime, cursorID, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(page) == 0 {
+			return nil
+		}
+
+		last := page[len(page)-1]
+		cursorTime, cursorID = last.CreatedAt, last.ID
+
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+	}
+}
+
+// logPage runs one ExportLogs page query
+func (db *DB) logPage(ctx context.Context, query string, before, cursorTime time.Time, cursorID string, pageSize int) ([]*models.GatewayLog, error) {
+	rows, err := db.conn.QueryContext(ctx, query, before, cursorTime, cursorID, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	var page []*models.GatewayLog
+	for rows.Next() {
+		log := &models.GatewayLog{}
+		dest := append([]interface{}{&log.ID}, gatewayLogDest(log)...)
+		if err := rows.Scan(append(dest, &log.CreatedAt)...); err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		page = append(page, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return page, nil
+}
+
+// gatewayLogDest returns scan destinations for a log entry, in gatewayLogColumns order
+func gatewayLogDest(log *models.GatewayLog) []interface{} {
+	return []interface{}{
+		&log.APIKeyID,
+		&log.Method,
+		&log.Endpoint,
+		&log.Model,
+		&log.Provider,
+		&log.CostUSD,
+		&log.CacheSavingsUSD,
+		&log.LatencyMs,
+		&log.PromptTokens,
+		&log.CompletionTokens,
+		&log.TotalTokens,
+		&log.CacheHit,
+		&log.FailoverUsed,
+		&log.RaceUsed,
+		&log.OriginalProvider,
+		&log.OriginalModel,
+		&log.ServedModel,
+		&log.EndUser,
+		&log.Organization,
+		&log.ClientIP,
+		&log.FinishReason,
+		&log.StatusCode,
+		&log.ErrorMessage,
+		&log.ErrorType,
+		(*logMetadata)(&log.Metadata),
+		&log.SampleWeight,
+	}
+}
+
+// logMetadata stores request metadata as JSONB, NULL when empty
+type logMetadata map[string]string
+
+// Value encodes the metadata for a JSONB column
+func (m logMetadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(map[string]string(m))
+	return string(encoded), err
+}
+
+// Scan decodes a JSONB column into the metadata
+func (m *logMetadata) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, (*map[string]string)(m))
+	case string:
+		return json.Unmarshal([]byte(value), (*map[string]string)(m))
+	default:
+		return fmt.Errorf("unsupported metadata type %T", src)
+	}
+}
+
+// LogRecord returns a log entry keyed by column name, for exports
+func LogRecord(log *models.GatewayLog) map[string]interface{} {
+	record := make(map[string]interface{}, len(gatewayLogColumns)+2)
+	for i, value := range gatewayLogValues(log) {
+		record[gatewayLogColumns[i]] = value
+	}
+	record["id"] = log.ID
+	record["created_at"] = log.CreatedAt
+	return record
+}
+
+// DeleteLogs deletes logs by ID and returns how many were removed
+func (db *DB) DeleteLogs(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM gateway_logs WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return result.RowsAffected()
+}
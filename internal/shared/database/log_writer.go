@@ -0,0 +1,442 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/retry"
+)
+
+// LogWriterConfig holds settings for the async log writer
+type LogWriterConfig struct {
+	BufferSize    int
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// Retry bounds retries of a batch insert that failed on a transient
+	// (connection-level) error. With FailClosed, a batch that still fails is
+	// kept for the next attempt instead of dropped, and Failing reports true
+	// until a write succeeds. Rows the database rejects outright are dropped
+	// and counted in Rejected either way.
+	Retry      retry.Policy
+	FailClosed bool
+	// MaxKept caps the entries each worker keeps while writes fail; the
+	// oldest beyond it are dropped and counted (default BufferSize)
+	MaxKept int
+
+	// Fractions of successful requests and cache hits whose rows are written;
+	// errors and failovers always are. Below 1, every request is still
+	// counted in Totals, and each written row carries a sample weight of
+	// 1/rate so the spend functions sum to the whole.
+	SampleRate         float64
+	CacheHitSampleRate float64
+	Totals             TotalsStore
+
+	// LastUsedInterval is how often each key's last_used_at is written at most
+	LastUsedInterval time.Duration
+	// LastUsedGate, if set, shares that throttle across gateway instances (e.g. Redis)
+	LastUsedGate LastUsedGate
+}
+
+// LastUsedGate claims a key's next last-used write; SetNX returns false while
+// another writer's claim is still live
+type LastUsedGate interface {
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+}
+
+// TotalsStore keeps request totals per day, e.g. in Redis
+type TotalsStore interface {
+	AddLogTotals(ctx context.Context, day time.Time, totals models.LogTotals) error
+}
+
+// logStore is the part of DB the log writer uses
+type logStore interface {
+	LogRequests(ctx context.Context, logs []*models.GatewayLog) error
+	UpdateAPIKeysLastUsed(ctx context.Context, lastUsed map[string]time.Time) error
+}
+
+// LogWriter buffers request logs and writes them in batches from a small
+// worker pool, so the request path never blocks on (or spawns goroutines for)
+// database writes. Last-used updates are debounced per LastUsedInterval.
+type LogWriter struct {
+	db      logStore
+	cfg     LogWriterConfig
+	entries chan *models.GatewayLog
+
+	mu      sync.Mutex
+	touched map[string]time.Time // key ID -> latest use not yet written
+	closed  bool
+
+	failing         atomic.Bool
+	dropped         atomic.Uint64
+	rejected        atomic.Uint64
+	reportedDropped uint64
+
+	workers sync.WaitGroup
+	flusher sync.WaitGroup
+	stop    chan struct{}
+}
+
+// NewLogWriter creates a log writer and starts its workers
+func NewLogWriter(db *DB, cfg LogWriterConfig) *LogWriter {
+	return newLogWriter(db, cfg)
+}
+
+func newLogWriter(db logStore, cfg LogWriterConfig) *LogWriter {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.LastUsedInterval <= 0 {
+		cfg.LastUsedInterval = cfg.FlushInterval
+	}
+	if cfg.MaxKept <= 0 {
+		cfg.MaxKept = cfg.BufferSize
+	}
+
+	w := &LogWriter{
+		db:      db,
+		cfg:     cfg,
+		entries: make(chan *models.GatewayLog, cfg.BufferSize),
+		touched: make(map[string]time.Time),
+		stop:    make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		w.workers.Add(1)
+		go w.runWorker()
+	}
+
+	w.flusher.Add(1)
+	go w.runLastUsedFlusher()
+
+	return w
+}
+
+// Enqueue queues a log entry for writing. If the buffer is full the entry is
+// dropped and counted rather than blocking the caller.
+func (w *LogWriter) Enqueue(entry *models.GatewayLog) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		w.dropped.Add(1)
+		return
+	}
+
+	select {
+	case w.entries <- entry:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// TouchAPIKey marks an API key as used; updates are written at most once per LastUsedInterval
+func (w *LogWriter) TouchAPIKey(apiKeyID string) {
+	w.mu.Lock()
+	w.touched[apiKeyID] = time.Now()
+	w.mu.Unlock()
+}
+
+// Dropped returns the number of log entries dropped due to backpressure
+func (w *LogWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Rejected returns the number of log entries the database refused to store
+func (w *LogWriter) Rejected() uint64 {
+	return w.rejected.Load()
+}
+
+// Failing reports whether the last batch write failed on a transient error
+// after its retries. It only becomes true with FailClosed set.
+func (w *LogWriter) Failing() bool {
+	return w.failing.Load()
+}
+
+// Close stops accepting entries and blocks until everything buffered has been written
+func (w *LogWriter) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.entries)
+	w.mu.Unlock()
+
+	w.workers.Wait()
+
+	close(w.stop)
+	w.flusher.Wait()
+}
+
+// runWorker consumes entries and writes them in batches
+func (w *LogWriter) runWorker() {
+	defer w.workers.Done()
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.GatewayLog, 0, w.cfg.BatchSize)
+	var totals models.LogTotals
+	for {
+		select {
+		case entry, ok := <-w.entries:
+			if !ok {
+				w.writeBatch(batch)
+				w.writeTotals(&totals)
+				return
+			}
+			logged := w.sample(entry)
+			if w.sampling() {
+				totals.Add(entry, logged)
+			}
+			if !logged {
+				continue
+			}
+			batch = w.keep(batch, entry)
+			// While writes fail, kept entries are retried on the ticker only
+			if len(batch) >= w.cfg.BatchSize && !w.failing.Load() {
+				batch = w.writeBatch(batch)
+			}
+		case <-ticker.C:
+			batch = w.writeBatch(batch)
+			w.writeTotals(&totals)
+		}
+	}
+}
+
+// sampling reports whether some successful requests go unlogged
+func (w *LogWriter) sampling() bool {
+	return w.cfg.SampleRate < 1 || w.cfg.CacheHitSampleRate < 1
+}
+
+// sample decides whether an entry's row is written
+func (w *LogWriter) sample(entry *models.GatewayLog) bool {
+	if entry.ErrorMessage != nil || entry.FailoverUsed {
+		return true
+	}
+	rate := w.cfg.SampleRate
+	if entry.CacheHit {
+		rate = w.cfg.CacheHitSampleRate
+	}
+	if rate >= 1 {
+		return true
+	}
+	if rand.Float64() >= rate {
+		return false
+	}
+	entry.SampleWeight = 1 / rate
+	return true
+}
+
+// writeTotals adds a worker's counted totals to the store and resets them
+func (w *LogWriter) writeTotals(totals *models.LogTotals) {
+	if totals.Requests == 0 || w.cfg.Totals == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.cfg.Totals.AddLogTotals(ctx, time.Now(), *totals); err != nil {
+		log.Printf("Failed to record totals for %d requests: %v", totals.Requests, err)
+	}
+	*totals = models.LogTotals{}
+}
+
+// keep appends an entry to a worker's batch, dropping the oldest entries
+// beyond MaxKept
+func (w *LogWriter) keep(batch []*models.GatewayLog, entry *models.GatewayLog) []*models.GatewayLog {
+	batch = append(batch, entry)
+	if over := len(batch) - w.cfg.MaxKept; over > 0 {
+		w.dropped.Add(uint64(over))
+		batch = append(batch[:0], batch[over:]...)
+	}
+	return batch
+}
+
+// writeBatch writes entries to the database in chunks of BatchSize and
+// returns those to keep for the next attempt: with FailClosed, everything
+// from the first chunk that failed on a transient error; otherwise none.
+func (w *LogWriter) writeBatch(batch []*models.GatewayLog) []*models.GatewayLog {
+	for start := 0; start < len(batch); start += w.cfg.BatchSize {
+		end := start + w.cfg.BatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+
+		err := w.writeChunk(batch[start:end])
+		if err == nil {
+			w.failing.Store(false)
+			continue
+		}
+
+		if !w.cfg.FailClosed {
+			log.Printf("Failed to write %d request logs: %v", end-start, err)
+			continue
+		}
+		w.failing.Store(true)
+		log.Printf("Failed to write %d request logs, keeping them for the next attempt: %v", len(batch)-start, err)
+		return append(batch[:0], batch[start:]...)
+	}
+	return batch[:0]
+}
+
+// writeChunk inserts entries, retrying transient errors. If the database
+// rejects the insert outright, one bad row fails all of them, so each row is
+// written on its own and only the rejected ones are dropped. The returned
+// error is always transient.
+func (w *LogWriter) writeChunk(entries []*models.GatewayLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := w.insert(ctx, entries)
+	if err == nil || isTransient(err) {
+		return err
+	}
+	if len(entries) == 1 {
+		w.reject(entries[0], err)
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := w.insert(ctx, []*models.GatewayLog{entry}); err != nil {
+			if isTransient(err) {
+				return err
+			}
+			w.reject(entry, err)
+		}
+	}
+	return nil
+}
+
+// insert writes entries, retrying only transient errors
+func (w *LogWriter) insert(ctx context.Context, entries []*models.GatewayLog) error {
+	return retry.Do(ctx, w.cfg.Retry, func() error {
+		err := w.db.LogRequests(ctx, entries)
+		if err != nil && !isTransient(err) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+}
+
+// reject drops an entry the database refused to store
+func (w *LogWriter) reject(entry *models.GatewayLog, err error) {
+	w.rejected.Add(1)
+	log.Printf("Dropping request log for %s %s (%s): %v", entry.Method, entry.Endpoint, entry.Model, err)
+}
+
+// isTransient reports whether a database error is about the connection or
+// server state rather than the statement, so the same insert may succeed later
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", // connection exception
+			"40", // transaction rollback (serialization failure, deadlock)
+			"53", // insufficient resources
+			"57": // operator intervention (shutdown, cancel)
+			return true
+		}
+	}
+	return false
+}
+
+// runLastUsedFlusher periodically writes debounced last-used updates
+func (w *LogWriter) runLastUsedFlusher() {
+	defer w.flusher.Done()
+
+	ticker := time.NewTicker(w.cfg.LastUsedInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.flushLastUsed(false)
+		case <-w.stop:
+			w.flushLastUsed(true)
+			return
+		}
+	}
+}
+
+// flushLastUsed writes pending last-used updates and reports dropped entries.
+// Keys another instance wrote within the interval stay pending for the next
+// flush, unless this is the final flush on shutdown.
+func (w *LogWriter) flushLastUsed(final bool) {
+	w.mu.Lock()
+	touched := w.touched
+	w.touched = make(map[string]time.Time)
+	w.mu.Unlock()
+
+	if dropped := w.dropped.Load(); dropped > w.reportedDropped {
+		log.Printf("Log buffer full: dropped %d request logs (%d total)", dropped-w.reportedDropped, dropped)
+		w.reportedDropped = dropped
+	}
+
+	if len(touched) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if w.cfg.LastUsedGate != nil && !final {
+		for id, usedAt := range touched {
+			claimed, err := w.cfg.LastUsedGate.SetNX(ctx, "lastused:"+id, usedAt.Format(time.RFC3339Nano), w.cfg.LastUsedInterval)
+			if err == nil && !claimed {
+				delete(touched, id)
+				w.requeueLastUsed(id, usedAt)
+			}
+			// On a gate error, write anyway - an extra UPDATE beats a stale timestamp
+		}
+	}
+
+	if err := w.db.UpdateAPIKeysLastUsed(ctx, touched); err != nil {
+		log.Printf("Failed to update last_used_at for %d keys: %v", len(touched), err)
+	}
+}
+
+// requeueLastUsed puts a deferred update back, keeping any newer use recorded since
+func (w *LogWriter) requeueLastUsed(apiKeyID string, usedAt time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if current, ok := w.touched[apiKeyID]; !ok || current.Before(usedAt) {
+		w.touched[apiKeyID] = usedAt
+	}
+}
@@ -0,0 +1,474 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/retry"
+)
+
+// fakeLogStore records written rows and last-used updates; fail decides each
+// insert's error
+type fakeLogStore struct {
+	mu       sync.Mutex
+	fail     func(attempt int, logs []*models.GatewayLog) error
+	calls    int
+	written  []*models.GatewayLog
+	lastUsed []map[string]time.Time
+}
+
+func (s *fakeLogStore) LogRequests(ctx context.Context, logs []*models.GatewayLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fail != nil {
+		if err := s.fail(s.calls, logs); err != nil {
+			return err
+		}
+	}
+	s.written = append(s.written, logs...)
+	return nil
+}
+
+func (s *fakeLogStore) UpdateAPIKeysLastUsed(ctx context.Context, lastUsed map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(lastUsed) > 0 { // as the database, which skips empty updates
+		s.lastUsed = append(s.lastUsed, lastUsed)
+	}
+	return nil
+}
+
+// lastUsedUpdates returns the last-used updates written so far
+func (s *fakeLogStore) lastUsedUpdates() []map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastUsed
+}
+
+// fakeGate is a LastUsedGate shared by writers standing in for separate
+// gateway instances; claims last until expire is called
+type fakeGate struct {
+	mu     sync.Mutex
+	claims map[string]bool
+}
+
+func (g *fakeGate) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.claims[key] {
+		return false, nil
+	}
+	if g.claims == nil {
+		g.claims = make(map[string]bool)
+	}
+	g.claims[key] = true
+	return true, nil
+}
+
+// expire ends every claim, as the interval passing would
+func (g *fakeGate) expire() {
+	g.mu.Lock()
+	g.claims = nil
+	g.mu.Unlock()
+}
+
+var (
+	errConnRefused = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	errInvalidUUID = &pq.Error{Code: "22P02", Message: "invalid input syntax for type uuid"}
+)
+
+// testWriter builds a writer without starting its workers
+func testWriter(store logStore, cfg LogWriterConfig) *LogWriter {
+	if cfg.Retry.Backoff == 0 {
+		cfg.Retry.Backoff = time.Millisecond
+	}
+	w := newLogWriter(store, cfg)
+	w.Close()
+	return w
+}
+
+func entries(names ...string) []*models.GatewayLog {
+	logs := make([]*models.GatewayLog, len(names))
+	for i, model := range names {
+		logs[i] = &models.GatewayLog{Method: "POST", Endpoint: "/v1/chat/completions", Model: model}
+	}
+	return logs
+}
+
+func TestEnqueuedEntriesAreWrittenInBatches(t *testing.T) {
+	var sizes []int
+	store := &fakeLogStore{fail: func(_ int, logs []*models.GatewayLog) error {
+		sizes = append(sizes, len(logs))
+		return nil
+	}}
+	w := newLogWriter(store, LogWriterConfig{Workers: 1, BatchSize: 3, FlushInterval: time.Hour, SampleRate: 1})
+
+	for _, entry := range entries("a", "b", "c", "d", "e", "f", "g") {
+		w.Enqueue(entry)
+	}
+	w.Close()
+
+	// Full batches are written as they fill; Close writes the remainder
+	if len(sizes) != 3 || sizes[0] != 3 || sizes[1] != 3 || sizes[2] != 1 {
+		t.Errorf("expected inserts of 3, 3 and 1 rows, got %v", sizes)
+	}
+	if len(store.written) != 7 {
+		t.Errorf("expected 7 rows written, got %d", len(store.written))
+	}
+}
+
+func TestCloseDrainsBufferedEntries(t *testing.T) {
+	store := &fakeLogStore{}
+	w := newLogWriter(store, LogWriterConfig{Workers: 2, FlushInterval: time.Hour, SampleRate: 1})
+
+	for i := 0; i < 50; i++ {
+		w.Enqueue(&models.GatewayLog{Method: "POST", Endpoint: "/v1/chat/completions", Model: "gpt-4o"})
+	}
+	w.Close()
+
+	if len(store.written) != 50 || w.Dropped() != 0 {
+		t.Errorf("expected all 50 rows written on Close, got %d (%d dropped)", len(store.written), w.Dropped())
+	}
+
+	w.Enqueue(&models.GatewayLog{Model: "late"})
+	if len(store.written) != 50 || w.Dropped() != 1 {
+		t.Errorf("expected an entry after Close dropped, got %d written and %d dropped", len(store.written), w.Dropped())
+	}
+}
+
+func TestEnqueueDropsWhenTheBufferIsFull(t *testing.T) {
+	writing := make(chan struct{})
+	unblock := make(chan struct{})
+	store := &fakeLogStore{fail: func(attempt int, _ []*models.GatewayLog) error {
+		if attempt == 1 {
+			close(writing)
+			<-unblock
+		}
+		return nil
+	}}
+	w := newLogWriter(store, LogWriterConfig{BufferSize: 2, Workers: 1, BatchSize: 1, FlushInterval: time.Hour, SampleRate: 1})
+
+	// The worker takes the first entry and blocks writing it; two more fill the buffer
+	w.Enqueue(&models.GatewayLog{Model: "a"})
+	<-writing
+	for _, entry := range entries("b", "c", "d", "e") {
+		w.Enqueue(entry)
+	}
+	if w.Dropped() != 2 {
+		t.Errorf("expected 2 entries dropped, got %d", w.Dropped())
+	}
+
+	close(unblock)
+	w.Close()
+	if len(store.written) != 3 {
+		t.Errorf("expected the 3 accepted rows written, got %d", len(store.written))
+	}
+}
+
+func TestWriteBatchRetriesTransientErrors(t *testing.T) {
+	store := &fakeLogStore{fail: func(attempt int, _ []*models.GatewayLog) error {
+		if attempt < 3 {
+			return errConnRefused
+		}
+		return nil
+	}}
+	w := testWriter(store, LogWriterConfig{Retry: retry.Policy{Retries: 3}, FailClosed: true})
+
+	if kept := w.writeBatch(entries("a", "b")); len(kept) != 0 {
+		t.Errorf("expected nothing kept, got %d", len(kept))
+	}
+	if len(store.written) != 2 || w.Failing() {
+		t.Errorf("expected both rows written after the blip, got %d (failing=%v)", len(store.written), w.Failing())
+	}
+}
+
+func TestWriteBatchDropsRejectedRowsWithoutFailing(t *testing.T) {
+	store := &fakeLogStore{fail: func(_ int, logs []*models.GatewayLog) error {
+		for _, entry := range logs {
+			if entry.Model == "bad" {
+				return errInvalidUUID
+			}
+		}
+		return nil
+	}}
+	w := testWriter(store, LogWriterConfig{Retry: retry.Policy{Retries: 3}, FailClosed: true})
+
+	if kept := w.writeBatch(entries("a", "bad", "c")); len(kept) != 0 {
+		t.Errorf("expected nothing kept, got %d", len(kept))
+	}
+	if len(store.written) != 2 || store.written[0].Model != "a" || store.written[1].Model != "c" {
+		t.Errorf("expected the good rows written, got %+v", store.written)
+	}
+	if w.Rejected() != 1 || w.Failing() {
+		t.Errorf("expected 1 rejected row and not failing, got %d (failing=%v)", w.Rejected(), w.Failing())
+	}
+	// 1 batch insert + 3 single-row inserts; the rejected row isn't retried
+	if store.calls != 4 {
+		t.Errorf("expected 4 inserts, got %d", store.calls)
+	}
+}
+
+func TestWriteBatchKeepsRowsOnOutageUntilRecovery(t *testing.T) {
+	down := true
+	store := &fakeLogStore{fail: func(int, []*models.GatewayLog) error {
+		if down {
+			return errConnRefused
+		}
+		return nil
+	}}
+	w := testWriter(store, LogWriterConfig{Retry: retry.Policy{Retries: 1}, FailClosed: true})
+
+	kept := w.writeBatch(entries("a", "b"))
+	if len(kept) != 2 || !w.Failing() {
+		t.Fatalf("expected both rows kept and failing, got %d (failing=%v)", len(kept), w.Failing())
+	}
+
+	down = false
+	if kept = w.writeBatch(kept); len(kept) != 0 || w.Failing() || len(store.written) != 2 {
+		t.Errorf("expected the kept rows written on recovery, got kept=%d written=%d failing=%v", len(kept), len(store.written), w.Failing())
+	}
+}
+
+func TestWriteBatchFailOpenDropsOnOutage(t *testing.T) {
+	store := &fakeLogStore{fail: func(int, []*models.GatewayLog) error { return errConnRefused }}
+	w := testWriter(store, LogWriterConfig{Retry: retry.Policy{Retries: 1}})
+
+	if kept := w.writeBatch(entries("a")); len(kept) != 0 || w.Failing() {
+		t.Errorf("expected the batch dropped without failing, got %d (failing=%v)", len(kept), w.Failing())
+	}
+}
+
+func TestWriteBatchWritesKeptRowsInChunks(t *testing.T) {
+	var sizes []int
+	store := &fakeLogStore{fail: func(_ int, logs []*models.GatewayLog) error {
+		sizes = append(sizes, len(logs))
+		return nil
+	}}
+	w := testWriter(store, LogWriterConfig{BatchSize: 2})
+
+	w.writeBatch(entries("a", "b", "c", "d", "e"))
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 {
+		t.Errorf("expected chunks of 2, 2, 1, got %v", sizes)
+	}
+}
+
+func TestKeepCapsKeptEntries(t *testing.T) {
+	w := testWriter(&fakeLogStore{}, LogWriterConfig{MaxKept: 3})
+
+	var batch []*models.GatewayLog
+	for _, entry := range entries("a", "b", "c", "d", "e") {
+		batch = w.keep(batch, entry)
+	}
+	if len(batch) != 3 || batch[0].Model != "c" || batch[2].Model != "e" {
+		t.Errorf("expected the newest 3 entries kept, got %d starting at %q", len(batch), batch[0].Model)
+	}
+	if w.Dropped() != 2 {
+		t.Errorf("expected 2 dropped, got %d", w.Dropped())
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errConnRefused, true},
+		{&pq.Error{Code: "57P01"}, true}, // admin_shutdown
+		{&pq.Error{Code: "08006"}, true}, // connection_failure
+		{&pq.Error{Code: "40001"}, true}, // serialization_failure
+		{context.DeadlineExceeded, true},
+		{errInvalidUUID, false},
+		{&pq.Error{Code: "23503"}, false}, // foreign_key_violation
+		{errors.New("pq: value too long for type character varying(255)"), false},
+	} {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRapidTouchesWriteLastUsedOncePerInterval(t *testing.T) {
+	store := &fakeLogStore{}
+	w := testWriter(store, LogWriterConfig{LastUsedInterval: time.Minute})
+
+	for i := 0; i < 1000; i++ {
+		w.TouchAPIKey("key-1")
+		if i%10 == 0 {
+			w.TouchAPIKey("key-2")
+		}
+	}
+	w.flushLastUsed(false)
+	w.flushLastUsed(false) // nothing touched since
+
+	updates := store.lastUsedUpdates()
+	if len(updates) != 1 || len(updates[0]) != 2 {
+		t.Fatalf("expected one update covering both keys, got %v", updates)
+	}
+	if updates[0]["key-1"].Before(updates[0]["key-2"]) {
+		t.Errorf("expected key-1's latest use, got %v", updates[0])
+	}
+}
+
+func TestLastUsedGateBoundsUpdatesAcrossInstances(t *testing.T) {
+	gate := &fakeGate{}
+	stores := []*fakeLogStore{{}, {}, {}}
+	var writers []*LogWriter
+	for _, store := range stores {
+		writers = append(writers, testWriter(store, LogWriterConfig{LastUsedInterval: time.Minute, LastUsedGate: gate}))
+	}
+
+	// Every instance sees the hot key each interval; one write per interval
+	for interval := 0; interval < 3; interval++ {
+		for _, w := range writers {
+			for i := 0; i < 100; i++ {
+				w.TouchAPIKey("key-1")
+			}
+			w.flushLastUsed(false)
+		}
+		gate.expire()
+	}
+	total := 0
+	for _, store := range stores {
+		total += len(store.lastUsedUpdates())
+	}
+	if total != 3 {
+		t.Errorf("expected one update per interval across the instances, got %d", total)
+	}
+
+	// Deferred updates stay pending, and the final flush on shutdown writes them
+	if len(writers[1].touched) != 1 {
+		t.Errorf("expected the deferred update pending, got %v", writers[1].touched)
+	}
+	writers[1].flushLastUsed(true)
+	if len(stores[1].lastUsedUpdates()) != 1 {
+		t.Errorf("expected the final flush to write the deferred update, got %v", stores[1].lastUsedUpdates())
+	}
+}
+
+func TestLastUsedFlusherRunsOncePerInterval(t *testing.T) {
+	store := &fakeLogStore{}
+	w := newLogWriter(store, LogWriterConfig{Workers: 1, FlushInterval: time.Hour, LastUsedInterval: 50 * time.Millisecond})
+
+	start := time.Now()
+	for time.Since(start) < 260*time.Millisecond {
+		w.TouchAPIKey("key-1")
+		time.Sleep(time.Millisecond)
+	}
+	w.Close()
+
+	// About five ticks plus the final flush, never one per touch
+	if n := len(store.lastUsedUpdates()); n < 2 || n > 7 {
+		t.Errorf("expected a bounded number of updates, got %d", n)
+	}
+}
+
+// fakeTotals sums the totals each worker adds
+type fakeTotals struct {
+	mu     sync.Mutex
+	totals models.LogTotals
+	adds   int
+}
+
+func (f *fakeTotals) AddLogTotals(ctx context.Context, day time.Time, totals models.LogTotals) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.adds++
+	f.totals.Requests += totals.Requests
+	f.totals.Logged += totals.Logged
+	f.totals.CacheHits += totals.CacheHits
+	f.totals.Errors += totals.Errors
+	f.totals.Failovers += totals.Failovers
+	f.totals.PromptTokens += totals.PromptTokens
+	f.totals.CompletionTokens += totals.CompletionTokens
+	f.totals.CostUSD += totals.CostUSD
+	return nil
+}
+
+func TestSamplingRespectsRatesAndKeepsErrors(t *testing.T) {
+	store := &fakeLogStore{}
+	totals := &fakeTotals{}
+	w := newLogWriter(store, LogWriterConfig{
+		Workers: 2, BufferSize: 5000, FlushInterval: time.Hour,
+		SampleRate: 0.1, CacheHitSampleRate: 0.5, Totals: totals,
+	})
+
+	failed := "upstream 503"
+	for i := 0; i < 2000; i++ {
+		w.Enqueue(&models.GatewayLog{Model: "success", PromptTokens: 10, CompletionTokens: 5})
+	}
+	for i := 0; i < 1000; i++ {
+		w.Enqueue(&models.GatewayLog{Model: "cached", CacheHit: true})
+	}
+	for i := 0; i < 100; i++ {
+		w.Enqueue(&models.GatewayLog{Model: "error", ErrorMessage: &failed})
+		w.Enqueue(&models.GatewayLog{Model: "failover", FailoverUsed: true})
+	}
+	w.Close()
+
+	written := make(map[string]int)
+	weights := map[string]float64{"success": 10, "cached": 2, "error": 0, "failover": 0}
+	for _, entry := range store.written {
+		written[entry.Model]++
+		// Sampled rows stand for 1/rate requests each; the rest for themselves
+		if entry.SampleWeight != weights[entry.Model] {
+			t.Errorf("expected a %s row weighted %v, got %v", entry.Model, weights[entry.Model], entry.SampleWeight)
+		}
+	}
+	if written["error"] != 100 || written["failover"] != 100 {
+		t.Errorf("expected every error and failover logged, got %d and %d", written["error"], written["failover"])
+	}
+	// Binomial counts; the bounds are several standard deviations wide
+	if n := written["success"]; n < 120 || n > 280 {
+		t.Errorf("expected about 200 of 2000 successes logged at 0.1, got %d", n)
+	}
+	if n := written["cached"]; n < 400 || n > 600 {
+		t.Errorf("expected about 500 of 1000 cache hits logged at 0.5, got %d", n)
+	}
+
+	// Totals count every request, sampled out or not
+	got := totals.totals
+	if got.Requests != 3200 || got.Logged != int64(len(store.written)) || got.CacheHits != 1000 || got.Errors != 100 || got.Failovers != 100 {
+		t.Errorf("unexpected totals: %+v (%d rows written)", got, len(store.written))
+	}
+	if got.PromptTokens != 20000 || got.CompletionTokens != 10000 {
+		t.Errorf("expected tokens of all 2000 successes, got %d and %d", got.PromptTokens, got.CompletionTokens)
+	}
+}
+
+func TestZeroRateLogsOnlyFailures(t *testing.T) {
+	store := &fakeLogStore{}
+	w := newLogWriter(store, LogWriterConfig{Workers: 1, FlushInterval: time.Hour, Totals: &fakeTotals{}})
+
+	failed := "context length exceeded"
+	w.Enqueue(&models.GatewayLog{Model: "success"})
+	w.Enqueue(&models.GatewayLog{Model: "cached", CacheHit: true})
+	w.Enqueue(&models.GatewayLog{Model: "error", ErrorMessage: &failed})
+	w.Close()
+
+	if len(store.written) != 1 || store.written[0].Model != "error" {
+		t.Errorf("expected only the error logged, got %d rows", len(store.written))
+	}
+}
+
+func TestFullRatesSkipTotals(t *testing.T) {
+	store := &fakeLogStore{}
+	totals := &fakeTotals{}
+	w := newLogWriter(store, LogWriterConfig{Workers: 1, FlushInterval: time.Hour, SampleRate: 1, CacheHitSampleRate: 1, Totals: totals})
+
+	for _, entry := range entries("a", "b", "c") {
+		w.Enqueue(entry)
+	}
+	w.Close()
+
+	// Every row is in the database, so no separate totals are kept
+	if len(store.written) != 3 || totals.adds != 0 {
+		t.Errorf("expected 3 rows and no totals, got %d rows and %d adds", len(store.written), totals.adds)
+	}
+}
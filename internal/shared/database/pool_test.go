@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPoolConfigIsApplied(t *testing.T) {
+	conn, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	PoolConfig{MaxOpenConns: 80, MaxIdleConns: 1, ConnMaxLifetime: time.Hour}.apply(conn)
+	db := FromConn(conn)
+
+	if got := db.Stats().MaxOpenConnections; got != 80 {
+		t.Errorf("expected 80 max open connections, got %d", got)
+	}
+
+	// Only one of three released connections stays idle
+	ctx := context.Background()
+	var held []*sql.Conn
+	for i := 0; i < 3; i++ {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		held = append(held, c)
+	}
+	for _, c := range held {
+		c.Close()
+	}
+	if stats := db.Stats(); stats.Idle != 1 || stats.MaxIdleClosed != 2 {
+		t.Errorf("expected 1 idle connection and 2 closed, got %d and %d", stats.Idle, stats.MaxIdleClosed)
+	}
+}
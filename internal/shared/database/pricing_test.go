@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// mockDB returns a DB over sqlmock; expectations are checked at cleanup
+func mockDB(t *testing.T) (*DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return &DB{conn: conn}, mock
+}
+
+var (
+	selectPricing = regexp.QuoteMeta("FROM model_pricing\n\t\t\tWHERE provider = $1 AND model = $2\n\t\t\tFOR UPDATE")
+	insertPricing = regexp.QuoteMeta("INSERT INTO model_pricing (")
+	updatePricing = regexp.QuoteMeta("UPDATE model_pricing")
+	insertAudit   = regexp.QuoteMeta("INSERT INTO model_pricing_audit")
+)
+
+func currentPricing(input, output float64, contextWindow int, streaming bool, perMinute float64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"input", "output", "context_window", "supports_streaming", "price_per_minute"}).
+		AddRow(input, output, contextWindow, streaming, perMinute)
+}
+
+func TestSyncModelPricingInsertsNewRows(t *testing.T) {
+	db, mock := mockDB(t)
+	window := 128000
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPricing).WithArgs("openai", "gpt-4o").WillReturnError(sql.ErrNoRows)
+	// Omitted supports_streaming and price_per_minute go in as NULL (column defaults)
+	mock.ExpectExec(insertPricing).WithArgs("openai", "gpt-4o", 0.0025, 0.01, int64(window), nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertAudit).
+		WithArgs("openai", "gpt-4o", "insert", nil, `{"context_window":128000,"input_per_1k_tokens":0.0025,"output_per_1k_tokens":0.01,"price_per_minute":0,"supports_streaming":true}`, "feed.json").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	inserted, updated, err := db.SyncModelPricing(context.Background(), []models.PricingUpdate{
+		{Provider: "openai", Model: "gpt-4o", InputPer1kTokens: 0.0025, OutputPer1kTokens: 0.01, ContextWindow: &window},
+	}, "feed.json")
+	if err != nil || inserted != 1 || updated != 0 {
+		t.Errorf("got %d inserted, %d updated, %v", inserted, updated, err)
+	}
+}
+
+func TestSyncedModelWithoutContextWindowIsReadable(t *testing.T) {
+	db, mock := mockDB(t)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPricing).WithArgs("openai", "gpt-5-mini").WillReturnError(sql.ErrNoRows)
+	// No context_window in the feed, so the row is stored with a NULL one
+	mock.ExpectExec(insertPricing).WithArgs("openai", "gpt-5-mini", 0.00025, 0.002, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(insertAudit).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if _, _, err := db.SyncModelPricing(context.Background(), []models.PricingUpdate{
+		{Provider: "openai", Model: "gpt-5-mini", InputPer1kTokens: 0.00025, OutputPer1kTokens: 0.002},
+	}, "feed.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	cols := []string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("COALESCE(context_window, 0), COALESCE(supports_streaming, true), cache_ttl_seconds")).
+		WithArgs("openai", "gpt-5-mini").
+		WillReturnRows(sqlmock.NewRows(cols).AddRow("p1", "openai", "gpt-5-mini", 0.00025, 0.002, 0, true, 3600, 0.0, now, now))
+
+	pricing, err := db.GetModelPricing(context.Background(), "openai", "gpt-5-mini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pricing.ContextWindow != 0 || pricing.OutputPer1kTokens != 0.002 {
+		t.Errorf("unexpected pricing: %+v", pricing)
+	}
+}
+
+func TestSyncModelPricingUpdatesOnlyProvidedColumns(t *testing.T) {
+	db, mock := mockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPricing).WithArgs("google", "gemini-2.5-pro").
+		WillReturnRows(currentPricing(0.00125, 0.01, 1048576, false, 0))
+	// context_window and supports_streaming aren't in the feed, so they're passed as NULL and kept
+	mock.ExpectExec(updatePricing).WithArgs("google", "gemini-2.5-pro", 0.002, 0.012, nil, nil, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertAudit).
+		WithArgs("google", "gemini-2.5-pro", "update",
+			`{"context_window":1048576,"input_per_1k_tokens":0.00125,"output_per_1k_tokens":0.01,"price_per_minute":0,"supports_streaming":false}`,
+			`{"context_window":1048576,"input_per_1k_tokens":0.002,"output_per_1k_tokens":0.012,"price_per_minute":0,"supports_streaming":false}`,
+			"feed.json").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	inserted, updated, err := db.SyncModelPricing(context.Background(), []models.PricingUpdate{
+		{Provider: "google", Model: "gemini-2.5-pro", InputPer1kTokens: 0.002, OutputPer1kTokens: 0.012},
+	}, "feed.json")
+	if err != nil || inserted != 0 || updated != 1 {
+		t.Errorf("got %d inserted, %d updated, %v", inserted, updated, err)
+	}
+}
+
+func TestSyncModelPricingSkipsRowsThatMatch(t *testing.T) {
+	db, mock := mockDB(t)
+
+	// Only the prices are in the feed, and they match; the stored context window
+	// and streaming flag must not count as changes
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPricing).WithArgs("openai", "whisper-1").
+		WillReturnRows(currentPricing(0, 0, 0, false, 0.006))
+	mock.ExpectCommit()
+
+	inserted, updated, err := db.SyncModelPricing(context.Background(), []models.PricingUpdate{
+		{Provider: "openai", Model: "whisper-1", InputPer1kTokens: 0, OutputPer1kTokens: 0},
+	}, "feed.json")
+	if err != nil || inserted != 0 || updated != 0 {
+		t.Errorf("got %d inserted, %d updated, %v", inserted, updated, err)
+	}
+}
+
+func TestSyncModelPricingRollsBackOnError(t *testing.T) {
+	db, mock := mockDB(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPricing).WithArgs("openai", "gpt-4o").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(insertPricing).WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if _, _, err := db.SyncModelPricing(context.Background(), []models.PricingUpdate{
+		{Provider: "openai", Model: "gpt-4o", InputPer1kTokens: 0.0025, OutputPer1kTokens: 0.01},
+	}, "feed.json"); err == nil {
+		t.Error("expected the insert error")
+	}
+}
+
+func TestListModelPricingReturnsEveryRow(t *testing.T) {
+	db, mock := mockDB(t)
+	now := time.Now()
+	cols := []string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM model_pricing\n\t\tORDER BY provider, model")).WillReturnRows(sqlmock.NewRows(cols).
+		AddRow("p1", "anthropic", "claude-sonnet-4-5", 0.003, 0.015, 200000, true, nil, 0.0, now, now).
+		AddRow("p2", "openai", "whisper-1", 0.0, 0.0, 0, true, nil, 0.006, now, now))
+
+	prices, err := db.ListModelPricing(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 || prices[0].Model != "claude-sonnet-4-5" || prices[0].ContextWindow != 200000 || prices[1].PricePerMinute != 0.006 {
+		t.Errorf("unexpected rows: %+v", prices)
+	}
+}
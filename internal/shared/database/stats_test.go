@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestGetLatencyStatsQueriesPercentilesPerModel(t *testing.T) {
+	db, mock := mockDB(t)
+	end := time.Now()
+	start := end.Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency_ms),
+		       PERCENTILE_CONT(0.9) WITHIN GROUP (ORDER BY latency_ms),
+		       PERCENTILE_CONT(0.99) WITHIN GROUP (ORDER BY latency_ms)`)).
+		WithArgs(start, end, "openai", "", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "count", "avg", "p50", "p90", "p99"}).
+			AddRow("openai", "gpt-4o", 100, 50.5, 50.5, 90.1, 99.01).
+			AddRow("openai", "gpt-4o-mini", 4, 250.0, 250.0, 370.0, 397.0))
+
+	stats, err := db.GetLatencyStats(context.Background(), "", "openai", "", nil, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Model != "gpt-4o" || stats[1].Model != "gpt-4o-mini" {
+		t.Fatalf("expected a row per model, got %+v", stats)
+	}
+	if s := stats[0]; s.RequestCount != 100 || s.AvgMs != 50.5 || s.P50Ms != 50.5 || s.P90Ms != 90.1 || s.P99Ms != 99.01 {
+		t.Errorf("scanned %+v", s)
+	}
+}
+
+func TestGetUsageByUserSumsCacheSavings(t *testing.T) {
+	db, mock := mockDB(t)
+	since := time.Now().Add(-24 * time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("COALESCE(SUM(cost_usd * sample_weight), 0), COALESCE(SUM(cache_savings_usd * sample_weight), 0)")).
+		WithArgs("key-1", since).
+		WillReturnRows(sqlmock.NewRows([]string{"end_user", "count", "prompt", "completion", "total", "cost", "savings"}).
+			AddRow("user-42", 3, 42, 6, 48, 0.000055, 0.00011))
+
+	usage, err := db.GetUsageByUser(context.Background(), "key-1", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[0].EndUser != "user-42" || usage[0].CostUSD != 0.000055 || usage[0].CacheSavingsUSD != 0.00011 {
+		t.Errorf("scanned %+v", usage)
+	}
+}
+
+// TestGetLatencyStatsComputesPercentiles seeds latencies into a real
+// PostgreSQL; set TEST_DATABASE_URL to run it
+func TestGetLatencyStatsComputesPercentiles(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The seeded table is temporary, so only exists on this connection
+	conn.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TEMP TABLE gateway_logs (
+		api_key_id UUID, provider TEXT, model TEXT, latency_ms INT, cache_hit BOOLEAN, status_code INT,
+		metadata JSONB, created_at TIMESTAMP DEFAULT NOW())`); err != nil {
+		t.Fatal(err)
+	}
+	seed := func(provider, model string, latencyMs int, cacheHit bool, status int) {
+		t.Helper()
+		if _, err := conn.ExecContext(ctx, `INSERT INTO gateway_logs (provider, model, latency_ms, cache_hit, status_code) VALUES ($1, $2, $3, $4, $5)`,
+			provider, model, latencyMs, cacheHit, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for ms := 1; ms <= 100; ms++ {
+		seed("openai", "gpt-4o", ms, false, 200)
+	}
+	for _, ms := range []int{100, 200, 300, 400} {
+		seed("anthropic", "claude-sonnet-4-5-20250929", ms, false, 200)
+	}
+	// Cache hits and failures don't count
+	seed("openai", "gpt-4o", 0, true, 200)
+	seed("openai", "gpt-4o", 30000, false, 504)
+
+	db := &DB{conn: conn}
+	stats, err := db.GetLatencyStats(ctx, "", "", "", nil, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected a row per provider and model, got %+v", stats)
+	}
+	for i, want := range []struct {
+		model              string
+		count              int
+		avg, p50, p90, p99 float64
+	}{
+		{"claude-sonnet-4-5-20250929", 4, 250, 250, 370, 397},
+		{"gpt-4o", 100, 50.5, 50.5, 90.1, 99.01},
+	} {
+		got := stats[i]
+		if got.Model != want.model || got.RequestCount != want.count {
+			t.Errorf("row %d: got %s with %d requests, want %s with %d", i, got.Model, got.RequestCount, want.model, want.count)
+		}
+		for name, values := range map[string][2]float64{"avg": {got.AvgMs, want.avg}, "p50": {got.P50Ms, want.p50}, "p90": {got.P90Ms, want.p90}, "p99": {got.P99Ms, want.p99}} {
+			if math.Abs(values[0]-values[1]) > 1e-6 {
+				t.Errorf("%s %s = %v, want %v", want.model, name, values[0], values[1])
+			}
+		}
+	}
+}
+
+func TestGetErrorStatsGroupsFailuresByType(t *testing.T) {
+	db, mock := mockDB(t)
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT provider, model, COALESCE(error_type, 'other'), COUNT(*)`)).
+		WithArgs(start, end, "", "gpt-4o", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "error_type", "count"}).
+			AddRow("openai", "gpt-4o", "rate_limit", 12).
+			AddRow("openai", "gpt-4o", "timeout", 3).
+			AddRow("openai", "gpt-4o", "other", 1)) // rows logged before error_type existed
+
+	stats, err := db.GetErrorStats(context.Background(), "", "gpt-4o", nil, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 3 || stats[0] != (models.ErrorStats{Provider: "openai", Model: "gpt-4o", ErrorType: "rate_limit", Count: 12}) || stats[2].ErrorType != "other" {
+		t.Errorf("scanned %+v", stats)
+	}
+}
+
+// exportedRow is one gateway_logs row as ExportLogs selects it
+func exportedRow(id string, createdAt time.Time) []driver.Value {
+	row := []driver.Value{id, "key-1", "POST", "/v1/chat/completions", "gpt-4o", "openai", 0.0004, 0.0, 120, 10, 2, 12, false, false, false}
+	row = append(row, nil, nil, nil, nil, nil, nil, "stop", 200, nil, nil, nil, 1.0)
+	return append(row, createdAt)
+}
+
+func TestExportLogsPagesOldestFirstByKeyset(t *testing.T) {
+	db, mock := mockDB(t)
+	before := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	t1, t2, t3 := before.Add(-72*time.Hour), before.Add(-48*time.Hour), before.Add(-24*time.Hour)
+	columns := append(append([]string{"id"}, gatewayLogColumns...), "created_at")
+	query := regexp.QuoteMeta(`WHERE created_at < $1 AND (created_at, id) > ($2, $3)
+		ORDER BY created_at, id
+		LIMIT $4`)
+
+	// Full pages continue from the last row; a short page ends the export
+	mock.ExpectQuery(query).WithArgs(before, time.Time{}, "00000000-0000-0000-0000-000000000000", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(exportedRow("log-1", t1)...).AddRow(exportedRow("log-2", t2)...))
+	mock.ExpectQuery(query).WithArgs(before, t2, "log-2", 2).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(exportedRow("log-3", t3)...))
+
+	var pages [][]string
+	err := db.ExportLogs(context.Background(), before, 2, func(page []*models.GatewayLog) error {
+		var ids []string
+		for _, entry := range page {
+			ids = append(ids, entry.ID)
+		}
+		pages = append(pages, ids)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || len(pages[0]) != 2 || pages[0][1] != "log-2" || len(pages[1]) != 1 || pages[1][0] != "log-3" {
+		t.Errorf("unexpected pages: %v", pages)
+	}
+}
+
+func TestExportLogsStopsAtTheFirstPageError(t *testing.T) {
+	db, mock := mockDB(t)
+	before := time.Now()
+	columns := append(append([]string{"id"}, gatewayLogColumns...), "created_at")
+	mock.ExpectQuery(`FROM gateway_logs`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(exportedRow("log-1", before.Add(-time.Hour))...))
+
+	uploadFailed := errors.New("upload failed")
+	if err := db.ExportLogs(context.Background(), before, 1, func([]*models.GatewayLog) error { return uploadFailed }); !errors.Is(err, uploadFailed) {
+		t.Errorf("expected the page error, got %v", err)
+	}
+}
+
+func TestDeleteLogsByID(t *testing.T) {
+	db, mock := mockDB(t)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM gateway_logs WHERE id = ANY($1::uuid[])`)).
+		WithArgs(pq.Array([]string{"log-1", "log-2"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	deleted, err := db.DeleteLogs(context.Background(), []string{"log-1", "log-2"})
+	if err != nil || deleted != 2 {
+		t.Errorf("got %d, %v", deleted, err)
+	}
+
+	// Nothing to delete makes no query
+	if deleted, err := db.DeleteLogs(context.Background(), nil); err != nil || deleted != 0 {
+		t.Errorf("got %d, %v", deleted, err)
+	}
+}
+
+func TestStatsFilterByMetadataContainment(t *testing.T) {
+	db, mock := mockDB(t)
+	end := time.Now()
+	start := end.Add(-time.Hour)
+	filter := map[string]string{"team": "search", "env": "prod"}
+	// The filter is a JSONB containment match; NULL (no filter) matches every row
+	mock.ExpectQuery(regexp.QuoteMeta(`AND ($5::jsonb IS NULL OR metadata @> $5::jsonb)`)).
+		WithArgs(start, end, "", "", `{"env":"prod","team":"search"}`, "").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "count", "avg", "p50", "p90", "p99"}).
+			AddRow("openai", "gpt-4o", 2, 50.0, 50.0, 50.0, 50.0))
+	mock.ExpectQuery(regexp.QuoteMeta(`AND ($5::jsonb IS NULL OR metadata @> $5::jsonb)`)).
+		WithArgs(start, end, "", "", `{"env":"prod","team":"search"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "model", "error_type", "count"}))
+
+	if stats, err := db.GetLatencyStats(context.Background(), "", "", "", filter, start, end); err != nil || len(stats) != 1 {
+		t.Errorf("latency: got %+v, %v", stats, err)
+	}
+	if stats, err := db.GetErrorStats(context.Background(), "", "", filter, start, end); err != nil || len(stats) != 0 {
+		t.Errorf("errors: got %+v, %v", stats, err)
+	}
+}
+
+func TestExportedLogsCarryTheirMetadata(t *testing.T) {
+	db, mock := mockDB(t)
+	before := time.Now()
+	columns := append(append([]string{"id"}, gatewayLogColumns...), "created_at")
+	tagged := exportedRow("log-1", before.Add(-2*time.Hour))
+	tagged[len(tagged)-3] = []byte(`{"team":"search","feature":"autocomplete"}`)
+	mock.ExpectQuery(`FROM gateway_logs`).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(tagged...).AddRow(exportedRow("log-2", before.Add(-time.Hour))...))
+
+	var exported []*models.GatewayLog
+	if err := db.ExportLogs(context.Background(), before, 10, func(page []*models.GatewayLog) error {
+		exported = append(exported, page...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 || exported[0].Metadata["team"] != "search" || exported[0].Metadata["feature"] != "autocomplete" || exported[1].Metadata != nil {
+		t.Errorf("unexpected metadata: %v, %v", exported[0].Metadata, exported[1].Metadata)
+	}
+}
+
+// TestGetErrorStatsFiltersByMetadata seeds tagged failures into a real
+// PostgreSQL; set TEST_DATABASE_URL to run it
+func TestGetErrorStatsFiltersByMetadata(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	if _, err := conn.ExecContext(ctx, `CREATE TEMP TABLE gateway_logs (
+		provider TEXT, model TEXT, error_message TEXT, error_type TEXT,
+		metadata JSONB, created_at TIMESTAMP DEFAULT NOW())`); err != nil {
+		t.Fatal(err)
+	}
+	for _, metadata := range []interface{}{`{"team":"search","env":"prod"}`, `{"team":"search","env":"staging"}`, `{"team":"billing","env":"prod"}`, nil} {
+		if _, err := conn.ExecContext(ctx, `INSERT INTO gateway_logs (provider, model, error_message, error_type, metadata) VALUES ('openai', 'gpt-4o', 'timeout', 'timeout', $1)`, metadata); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := &DB{conn: conn}
+	window := func() (time.Time, time.Time) { return time.Now().Add(-time.Hour), time.Now().Add(time.Hour) }
+	for _, tc := range []struct {
+		filter map[string]string
+		want   int
+	}{
+		{nil, 4},
+		{map[string]string{"team": "search"}, 2},
+		{map[string]string{"team": "search", "env": "prod"}, 1},
+		{map[string]string{"team": "growth"}, 0},
+	} {
+		start, end := window()
+		stats, err := db.GetErrorStats(ctx, "", "", tc.filter, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for _, s := range stats {
+			got += s.Count
+		}
+		if got != tc.want {
+			t.Errorf("filter %v: counted %d failures, want %d", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestLogRequestsSplitsBatchesOverTheParameterLimit(t *testing.T) {
+	db, mock := mockDB(t)
+	rowsPerInsert := maxBindParams / len(gatewayLogColumns)
+	logs := make([]*models.GatewayLog, rowsPerInsert+1)
+	for i := range logs {
+		logs[i] = &models.GatewayLog{Model: "gpt-4o"}
+	}
+
+	insert := regexp.QuoteMeta("INSERT INTO gateway_logs (")
+	mock.ExpectBegin()
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, int64(rowsPerInsert)))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := db.LogRequests(context.Background(), logs); err != nil {
+		t.Fatal(err)
+	}
+}
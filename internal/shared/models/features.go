@@ -0,0 +1,60 @@
+package models
+
+import "encoding/json"
+
+// Feature flag names read from api_keys.features
+const (
+	FeatureRaceMode            = "race_mode"             // bool: race the primary model against its first failover
+	FeatureAutoDowngrade       = "auto_downgrade"        // bool: serve cheaper siblings under upstream 429s
+	FeatureStreamResumeRetries = "stream_resume_retries" // int: overrides STREAM_RESUME_MAX_RETRIES
+	FeatureTruncateContext     = "truncate_context"      // bool: drop the oldest turns instead of overflowing the context window
+	FeatureCacheNormalizeSpace = "cache_normalize_space" // bool: trim and collapse whitespace in prompts before cache lookups
+	FeatureCacheNormalizeCase  = "cache_normalize_case"  // bool: lowercase prompts before cache lookups
+	FeatureAutoContinue        = "auto_continue"         // bool: continue completions cut off by the token limit
+	FeatureForceNonStream      = "force_non_stream"      // bool: answer stream:true requests with one buffered JSON response
+	FeatureRetryMaxAttempts    = "retry_max_attempts"    // int: overrides RETRY_MAX_ATTEMPTS
+	FeatureRetryMaxDurationMs  = "retry_max_duration_ms" // int: overrides RETRY_MAX_DURATION, in milliseconds
+	FeatureOpenAIOrganizations = "openai_organizations"  // []string: further orgs the OpenAI-Organization header may select
+)
+
+// GetBool returns a boolean feature flag, or def if it's missing or not a bool
+func (k *APIKey) GetBool(name string, def bool) bool {
+	value, ok := k.Features[name].(bool)
+	if !ok {
+		return def
+	}
+	return value
+}
+
+// GetStrings returns a list of strings feature flag, skipping any element that
+// isn't a string, or nil if it's missing or not a list
+func (k *APIKey) GetStrings(name string) []string {
+	values, ok := k.Features[name].([]interface{})
+	if !ok {
+		return nil
+	}
+	var strs []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
+
+// GetInt returns an integer feature flag, or def if it's missing or not a whole number
+func (k *APIKey) GetInt(name string, def int) int {
+	switch value := k.Features[name].(type) {
+	case float64: // JSON numbers decode as float64
+		if value == float64(int(value)) {
+			return int(value)
+		}
+	case int:
+		return value
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return int(n)
+		}
+	}
+	return def
+}
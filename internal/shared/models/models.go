@@ -4,30 +4,59 @@ import "time"
 
 // APIKey represents a gateway API key
 type APIKey struct {
-	ID                 string
-	KeyHash            string
-	KeyPrefix          string
-	Name               string
-	RateLimitPerMinute int
-	CacheEnabled       bool
-	CacheTTLSeconds    int
-	IsActive           bool
-	LastUsedAt         *time.Time
-	CreatedAt          time.Time
-	UpdatedAt          time.Time
+	ID                    string
+	KeyHash               string
+	KeyPrefix             string
+	Name                  string
+	RateLimitPerMinute    int
+	RateLimitWaitSeconds  int // max time to queue when rate-limited (0 = reject immediately)
+	MaxConcurrentRequests int // 0 = unlimited
+	MaxOutputTokens       int // cap on max_tokens per request (0 = unlimited)
+	CacheEnabled          bool
+	CacheTTLSeconds       int
+	PromptCachingEnabled  bool
+	StreamCoalesceChars   int // 0 = no size-based coalescing
+	StreamCoalesceMs      int // 0 = no time-based coalescing
+	OpenAIOrganization    string
+	PostprocessURL        string                 // completion post-processing webhook ("" = off)
+	PostprocessFailClosed bool                   // fail the request, rather than return the original, if the webhook fails
+	PromptPrelude         string                 // system prompt prepended to every request ("" = none)
+	PromptSuffix          string                 // system prompt added after the client's system messages
+	PromptPreludeOverride bool                   // drop the client's system messages instead of merging
+	GeminiSafetySettings  map[string]string      // harm category -> block threshold sent to Gemini (nil = Gemini's defaults)
+	Features              map[string]interface{} // experimental per-key flags; read with GetBool/GetInt/GetStrings
+	IsActive              bool
+	LastUsedAt            *time.Time
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 // ModelPricing represents pricing for an LLM model
 type ModelPricing struct {
-	ID                  string
-	Provider            string
-	Model               string
-	InputPer1kTokens    float64
-	OutputPer1kTokens   float64
-	ContextWindow       int
-	SupportsStreaming   bool
-	CreatedAt           time.Time
-	UpdatedAt           time.Time
+	ID                string
+	Provider          string
+	Model             string
+	InputPer1kTokens  float64
+	OutputPer1kTokens float64
+	ContextWindow     int
+	SupportsStreaming bool
+	CacheTTLSeconds   *int    // per-model cache TTL override (nil = use the key's)
+	PricePerMinute    float64 // audio models, billed by duration
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// PricingUpdate is one model's pricing from a sync source. Nil fields weren't
+// in the source: updates leave those columns as they are, and inserts leave
+// them to the column defaults.
+type PricingUpdate struct {
+	Provider          string
+	Model             string
+	InputPer1kTokens  float64
+	OutputPer1kTokens float64
+	ContextWindow     *int
+	SupportsStreaming *bool
+	PricePerMinute    *float64
 }
 
 // GatewayLog represents a request log entry
@@ -39,14 +68,111 @@ type GatewayLog struct {
 	Model            string
 	Provider         string
 	CostUSD          float64
+	CacheSavingsUSD  float64
 	LatencyMs        int
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 	CacheHit         bool
 	FailoverUsed     bool
+	RaceUsed         bool
 	OriginalProvider *string
+	OriginalModel    *string // requested model, set on failover
+	ServedModel      *string // model that actually answered, set on failover
+	EndUser          *string
+	Organization     *string
+	ClientIP         *string
+	FinishReason     *string
 	StatusCode       int
 	ErrorMessage     *string
+	ErrorType        *string // e.g. "rate_limit", "timeout"; see providers.ClassifyError
+	Metadata         map[string]string
+	SampleWeight     float64 // requests the row stands for when sampled (1/rate); 0 = 1
 	CreatedAt        time.Time
 }
+
+// UserUsage represents aggregated usage for a single end-user
+type UserUsage struct {
+	EndUser          string
+	RequestCount     int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CostUSD          float64
+	CacheSavingsUSD  float64
+}
+
+// Conversation is a server-side chat history owned by an API key
+type Conversation struct {
+	ID        string
+	APIKeyID  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ConversationMessage is one stored turn of a conversation
+type ConversationMessage struct {
+	Message   string // OpenAI-format chat message as JSON
+	CreatedAt time.Time
+}
+
+// NamespaceUsage is the Redis footprint of one key namespace, e.g. "cache:exact"
+type NamespaceUsage struct {
+	Namespace    string `json:"namespace"`
+	Keys         int64  `json:"keys"`
+	Sampled      int    `json:"sampled"`       // keys measured with MEMORY USAGE
+	SampledBytes int64  `json:"sampled_bytes"` // memory of the sampled keys
+	ApproxBytes  int64  `json:"approx_bytes"`  // SampledBytes scaled up to all keys
+}
+
+// LogTotals are request totals counted for every request, including those whose
+// log rows were sampled out
+type LogTotals struct {
+	Requests         int64   `json:"requests"`
+	Logged           int64   `json:"logged"`
+	CacheHits        int64   `json:"cache_hits"`
+	Errors           int64   `json:"errors"`
+	Failovers        int64   `json:"failovers"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Add counts a request in the totals
+func (t *LogTotals) Add(entry *GatewayLog, logged bool) {
+	t.Requests++
+	if logged {
+		t.Logged++
+	}
+	if entry.CacheHit {
+		t.CacheHits++
+	}
+	if entry.ErrorMessage != nil {
+		t.Errors++
+	}
+	if entry.FailoverUsed {
+		t.Failovers++
+	}
+	t.PromptTokens += int64(entry.PromptTokens)
+	t.CompletionTokens += int64(entry.CompletionTokens)
+	t.CostUSD += entry.CostUSD
+}
+
+// ErrorStats counts failed requests of one error type for a provider/model
+type ErrorStats struct {
+	Provider  string
+	Model     string
+	ErrorType string
+	Count     int
+}
+
+// LatencyStats represents the latency distribution for a provider/model
+type LatencyStats struct {
+	Provider     string
+	Model        string
+	RequestCount int
+	AvgMs        float64
+	P50Ms        float64
+	P90Ms        float64
+	P99Ms        float64
+}
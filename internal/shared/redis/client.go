@@ -2,33 +2,115 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// Deployment modes
+const (
+	ModeSingle   = "single"
+	ModeCluster  = "cluster"
+	ModeSentinel = "sentinel"
 )
 
 type Client struct {
-	client *redis.Client
+	client redis.UniversalClient
+}
+
+// Options selects and configures the Redis deployment. Single mode connects to
+// URL, with any credentials, DB or TLS set here overriding the URL's; cluster
+// and sentinel modes use Addrs (cluster nodes or sentinels).
+type Options struct {
+	Mode             string
+	URL              string
+	Addrs            []string
+	MasterName       string // sentinel mode
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int // single and sentinel modes
+	TLS              bool
 }
 
 // New creates a new Redis client
-func New(ctx context.Context, redisURL string) (*Client, error) {
-	opts, err := redis.ParseURL(redisURL)
+func New(ctx context.Context, opts Options) (*Client, error) {
+	client, err := newUniversalClient(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	client := redis.NewClient(opts)
-
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("Redis ping failed: %w", err)
 	}
 
 	return &Client{client: client}, nil
 }
 
+// newUniversalClient builds the go-redis client for the configured mode
+func newUniversalClient(opts Options) (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if opts.TLS {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	switch opts.Mode {
+	case "", ModeSingle:
+		parsed, err := redis.ParseURL(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		}
+		// Settings given on their own take precedence over the URL's
+		if opts.Username != "" {
+			parsed.Username = opts.Username
+		}
+		if opts.Password != "" {
+			parsed.Password = opts.Password
+		}
+		if opts.DB != 0 {
+			parsed.DB = opts.DB
+		}
+		if opts.TLS && parsed.TLSConfig == nil {
+			parsed.TLSConfig = tlsConfig
+		}
+		return redis.NewClient(parsed), nil
+
+	case ModeCluster:
+		if len(opts.Addrs) == 0 {
+			return nil, fmt.Errorf("REDIS_ADDRS is required in cluster mode")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opts.Addrs,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			TLSConfig: tlsConfig,
+		}), nil
+
+	case ModeSentinel:
+		if len(opts.Addrs) == 0 || opts.MasterName == "" {
+			return nil, fmt.Errorf("REDIS_ADDRS and REDIS_MASTER_NAME are required in sentinel mode")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opts.MasterName,
+			SentinelAddrs:    opts.Addrs,
+			SentinelPassword: opts.SentinelPassword,
+			Username:         opts.Username,
+			Password:         opts.Password,
+			DB:               opts.DB,
+			TLSConfig:        tlsConfig,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("invalid REDIS_MODE %q (use single, cluster or sentinel)", opts.Mode)
+	}
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.client.Close()
@@ -51,6 +133,22 @@ func (c *Client) Set(ctx context.Context, key string, value string, ttl time.Dur
 	return c.client.Set(ctx, key, value, ttl).Err()
 }
 
+// Del deletes a key
+func (c *Client) Del(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// Exists reports whether a key is set
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// SetNX stores a value with TTL only if the key doesn't exist. Returns false if it already did.
+func (c *Client) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, ttl).Result()
+}
+
 // Incr increments a counter
 func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
 	return c.client.Incr(ctx, key).Result()
@@ -102,3 +200,178 @@ func (c *Client) CheckRateLimit(ctx context.Context, apiKeyID string, limit int)
 
 	return false, remaining, nil
 }
+
+// RateLimitReset returns the time until an API key's rate limit window resets
+func (c *Client) RateLimitReset(ctx context.Context, apiKeyID string) (time.Duration, error) {
+	key := fmt.Sprintf("ratelimit:%s", apiKeyID)
+	return c.client.PTTL(ctx, key).Result()
+}
+
+// RateLimitCount returns how many requests an API key has made in the current window
+func (c *Client) RateLimitCount(ctx context.Context, apiKeyID string) (int, error) {
+	key := fmt.Sprintf("ratelimit:%s", apiKeyID)
+	count, err := c.client.Get(ctx, key).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+// ConcurrencyInFlight returns how many concurrency slots an API key currently holds
+func (c *Client) ConcurrencyInFlight(ctx context.Context, apiKeyID string) (int, error) {
+	key := fmt.Sprintf("concurrency:%s", apiKeyID)
+	inFlight, err := c.client.Get(ctx, key).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return inFlight, err
+}
+
+// concurrencySlotTTL bounds how long a leaked slot (e.g. from a crashed
+// instance) can hold a key's concurrency counter
+const concurrencySlotTTL = 5 * time.Minute
+
+// AcquireConcurrencySlot reserves an in-flight slot for an API key.
+// Returns false (and reserves nothing) if the key is already at its limit.
+func (c *Client) AcquireConcurrencySlot(ctx context.Context, apiKeyID string, limit int) (bool, int, error) {
+	key := fmt.Sprintf("concurrency:%s", apiKeyID)
+
+	var incr *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, concurrencySlotTTL)
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	inFlight := int(incr.Val())
+	if inFlight > limit {
+		// Over the cap - give the slot back
+		c.client.Decr(ctx, key)
+		return false, inFlight - 1, nil
+	}
+
+	return true, inFlight, nil
+}
+
+// ReleaseConcurrencySlot frees an in-flight slot previously acquired for an API key
+func (c *Client) ReleaseConcurrencySlot(ctx context.Context, apiKeyID string) error {
+	key := fmt.Sprintf("concurrency:%s", apiKeyID)
+
+	remaining, err := c.client.Decr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	// Clean up if the counter drifted below zero (e.g. after TTL expiry)
+	if remaining <= 0 {
+		return c.client.Del(ctx, key).Err()
+	}
+	return nil
+}
+
+// ewmaScript folds a sample into an exponentially weighted moving average atomically.
+// The first sample seeds the average.
+var ewmaScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+local sample = tonumber(ARGV[1])
+local value = sample
+if current then
+	value = tonumber(ARGV[2]) * sample + (1 - tonumber(ARGV[2])) * tonumber(current)
+end
+redis.call("SET", KEYS[1], tostring(value), "PX", ARGV[3])
+return tostring(value)
+`)
+
+// UpdateEWMA adds sample to the moving average at key (weighting it by alpha) and returns the new average
+func (c *Client) UpdateEWMA(ctx context.Context, key string, sample, alpha float64, ttl time.Duration) (float64, error) {
+	val, err := ewmaScript.Run(ctx, c.client, []string{key},
+		strconv.FormatFloat(sample, 'f', -1, 64),
+		strconv.FormatFloat(alpha, 'f', -1, 64),
+		ttl.Milliseconds(),
+	).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+// GetFloat retrieves a float value by key
+func (c *Client) GetFloat(ctx context.Context, key string) (float64, error) {
+	val, err := c.client.Get(ctx, key).Float64()
+	if err == redis.Nil {
+		return 0, fmt.Errorf("key not found")
+	}
+	return val, err
+}
+
+// releaseLockScript deletes a lock only if it still holds the caller's token
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLock takes a lock held until ttl expires or ReleaseLock is called with the same token.
+// Returns false if another holder has it.
+func (c *Client) AcquireLock(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, token, ttl).Result()
+}
+
+// ReleaseLock releases a lock if it's still held with token
+func (c *Client) ReleaseLock(ctx context.Context, key string, token string) error {
+	return releaseLockScript.Run(ctx, c.client, []string{key}, token).Err()
+}
+
+// logTotalsTTL is how long each day's request totals are kept
+const logTotalsTTL = 90 * 24 * time.Hour
+
+// logTotalsKey names the hash holding a UTC day's request totals
+func logTotalsKey(day time.Time) string {
+	return "logtotals:" + day.UTC().Format("2006-01-02")
+}
+
+// AddLogTotals adds to the request totals for day
+func (c *Client) AddLogTotals(ctx context.Context, day time.Time, totals models.LogTotals) error {
+	key := logTotalsKey(day)
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, key, "requests", totals.Requests)
+		pipe.HIncrBy(ctx, key, "logged", totals.Logged)
+		pipe.HIncrBy(ctx, key, "cache_hits", totals.CacheHits)
+		pipe.HIncrBy(ctx, key, "errors", totals.Errors)
+		pipe.HIncrBy(ctx, key, "failovers", totals.Failovers)
+		pipe.HIncrBy(ctx, key, "prompt_tokens", totals.PromptTokens)
+		pipe.HIncrBy(ctx, key, "completion_tokens", totals.CompletionTokens)
+		pipe.HIncrByFloat(ctx, key, "cost_usd", totals.CostUSD)
+		pipe.Expire(ctx, key, logTotalsTTL)
+		return nil
+	})
+	return err
+}
+
+// GetLogTotals returns the request totals for day (zero if none were recorded)
+func (c *Client) GetLogTotals(ctx context.Context, day time.Time) (models.LogTotals, error) {
+	values, err := c.client.HGetAll(ctx, logTotalsKey(day)).Result()
+	if err != nil {
+		return models.LogTotals{}, err
+	}
+
+	count := func(field string) int64 {
+		n, _ := strconv.ParseInt(values[field], 10, 64)
+		return n
+	}
+	cost, _ := strconv.ParseFloat(values["cost_usd"], 64)
+	return models.LogTotals{
+		Requests:         count("requests"),
+		Logged:           count("logged"),
+		CacheHits:        count("cache_hits"),
+		Errors:           count("errors"),
+		Failovers:        count("failovers"),
+		PromptTokens:     count("prompt_tokens"),
+		CompletionTokens: count("completion_tokens"),
+		CostUSD:          cost,
+	}, nil
+}
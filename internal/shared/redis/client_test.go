@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+func TestNewBuildsTheClientForEachMode(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  Options
+		check func(t *testing.T, client redis.UniversalClient)
+	}{
+		{"default", Options{URL: "redis://:secret@cache.internal:6380/2"}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.Client)
+			if !ok {
+				t.Fatalf("expected a single-node client, got %T", client)
+			}
+			if opt := c.Options(); opt.Addr != "cache.internal:6380" || opt.Password != "secret" || opt.DB != 2 {
+				t.Errorf("URL not applied: %+v", opt)
+			}
+		}},
+		{"single", Options{Mode: ModeSingle, URL: "redis://localhost:6379"}, func(t *testing.T, client redis.UniversalClient) {
+			if _, ok := client.(*redis.Client); !ok {
+				t.Fatalf("expected a single-node client, got %T", client)
+			}
+		}},
+		{"single with overrides", Options{URL: "redis://:secret@cache.internal:6380/2", Username: "gateway", Password: "rotated", DB: 5, TLS: true}, func(t *testing.T, client redis.UniversalClient) {
+			opt := client.(*redis.Client).Options()
+			if opt.Addr != "cache.internal:6380" || opt.Username != "gateway" || opt.Password != "rotated" || opt.DB != 5 || opt.TLSConfig == nil {
+				t.Errorf("REDIS_USERNAME/PASSWORD/DB/TLS not applied over the URL: %+v", opt)
+			}
+		}},
+		{"cluster", Options{Mode: ModeCluster, Addrs: []string{"node-1:6379", "node-2:6379"}, Password: "secret", TLS: true}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.ClusterClient)
+			if !ok {
+				t.Fatalf("expected a cluster client, got %T", client)
+			}
+			if opt := c.Options(); len(opt.Addrs) != 2 || opt.Password != "secret" || opt.TLSConfig == nil {
+				t.Errorf("cluster options not applied: %+v", opt)
+			}
+		}},
+		{"sentinel", Options{Mode: ModeSentinel, Addrs: []string{"sentinel-1:26379"}, MasterName: "mymaster", DB: 3}, func(t *testing.T, client redis.UniversalClient) {
+			c, ok := client.(*redis.Client)
+			if !ok {
+				t.Fatalf("expected a failover client, got %T", client)
+			}
+			// Failover clients resolve the master through the sentinels rather than dialing an address
+			if opt := c.Options(); opt.Addr != "FailoverClient" || opt.DB != 3 {
+				t.Errorf("expected a sentinel-backed client, got %+v", opt)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := newUniversalClient(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			tc.check(t, client)
+		})
+	}
+}
+
+func TestNewRejectsIncompleteModeConfig(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"unknown mode":         {Mode: "replicated", URL: "redis://localhost:6379"},
+		"cluster, no nodes":    {Mode: ModeCluster},
+		"sentinel, no master":  {Mode: ModeSentinel, Addrs: []string{"sentinel-1:26379"}},
+		"sentinel, no address": {Mode: ModeSentinel, MasterName: "mymaster"},
+		"bad URL":              {URL: "http://localhost:6379"},
+	} {
+		if _, err := newUniversalClient(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := newUniversalClient(Options{Mode: "replicated"}); err == nil || !strings.Contains(err.Error(), "REDIS_MODE") {
+		t.Errorf("expected the error to name REDIS_MODE, got %v", err)
+	}
+}
+
+func TestClusterModeServesTheSameMethods(t *testing.T) {
+	srv := miniredis.RunT(t)
+	c, err := New(context.Background(), Options{Mode: ModeCluster, Addrs: []string{srv.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Set(ctx, "ratelimit:key-1", "3", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Incr(ctx, "ratelimit:key-1"); err != nil || n != 4 {
+		t.Errorf("Incr: %d, %v", n, err)
+	}
+	if v, err := c.Get(ctx, "ratelimit:key-1"); err != nil || v != "4" {
+		t.Errorf("Get: %q, %v", v, err)
+	}
+}
+
+func TestLogTotalsAccumulatePerDay(t *testing.T) {
+	srv := miniredis.RunT(t)
+	c, err := New(context.Background(), Options{URL: "redis://" + srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	day := time.Date(2026, 7, 1, 23, 0, 0, 0, time.UTC)
+	for _, totals := range []models.LogTotals{
+		{Requests: 10, Logged: 2, CacheHits: 3, Errors: 1, PromptTokens: 100, CompletionTokens: 50, CostUSD: 0.25},
+		{Requests: 5, Logged: 5, Errors: 1, Failovers: 2, PromptTokens: 20, CompletionTokens: 10, CostUSD: 0.5},
+	} {
+		if err := c.AddLogTotals(ctx, day, totals); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := c.GetLogTotals(ctx, day.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.LogTotals{Requests: 15, Logged: 7, CacheHits: 3, Errors: 2, Failovers: 2, PromptTokens: 120, CompletionTokens: 60, CostUSD: 0.75}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if ttl := srv.TTL(logTotalsKey(day)); ttl != logTotalsTTL {
+		t.Errorf("expected the totals to expire after %s, got %s", logTotalsTTL, ttl)
+	}
+
+	if got, err := c.GetLogTotals(ctx, day.AddDate(0, 0, 1)); err != nil || got != (models.LogTotals{}) {
+		t.Errorf("expected zero totals for an unrecorded day, got %+v, %v", got, err)
+	}
+}
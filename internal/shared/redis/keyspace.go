@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+)
+
+// scanBatch is the SCAN COUNT hint and the number of keys deleted per pipeline
+const scanBatch = 1000
+
+// OtherNamespace collects keys that match none of the requested namespaces
+const OtherNamespace = "other"
+
+// KeyspaceUsage counts keys per namespace (a key prefix such as "cache:exact") in one SCAN
+// pass, and estimates their memory from MEMORY USAGE on up to samples keys per
+// namespace. In cluster mode every master is scanned.
+func (c *Client) KeyspaceUsage(ctx context.Context, namespaces []string, samples int) (map[string]*models.NamespaceUsage, error) {
+	usage := make(map[string]*models.NamespaceUsage, len(namespaces)+1)
+	for _, namespace := range append(namespaces, OtherNamespace) {
+		usage[namespace] = &models.NamespaceUsage{Namespace: namespace}
+	}
+
+	var mu sync.Mutex
+	err := c.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+		iter := node.Scan(ctx, 0, "*", scanBatch).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+
+			mu.Lock()
+			u := usage[namespaceOf(key, namespaces)]
+			u.Keys++
+			sample := u.Sampled < samples
+			if sample {
+				u.Sampled++
+			}
+			mu.Unlock()
+
+			if !sample {
+				continue
+			}
+			bytes, err := node.MemoryUsage(ctx, key).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			mu.Lock()
+			u.SampledBytes += bytes
+			mu.Unlock()
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range usage {
+		if u.Sampled > 0 {
+			u.ApproxBytes = u.SampledBytes * u.Keys / int64(u.Sampled)
+		}
+	}
+	return usage, nil
+}
+
+// PurgeNamespace deletes every key in namespace (keys prefixed "namespace:")
+// and returns how many were removed. Keys are unlinked one by one in
+// pipelines, so cluster slots never need to match.
+func (c *Client) PurgeNamespace(ctx context.Context, namespace string) (int64, error) {
+	var mu sync.Mutex
+	var deleted int64
+
+	err := c.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+		iter := node.Scan(ctx, 0, namespace+":*", scanBatch).Iterator()
+		keys := make([]string, 0, scanBatch)
+
+		flush := func() error {
+			if len(keys) == 0 {
+				return nil
+			}
+			cmds, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Unlink(ctx, key)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			for _, cmd := range cmds {
+				deleted += cmd.(*redis.IntCmd).Val()
+			}
+			mu.Unlock()
+			keys = keys[:0]
+			return nil
+		}
+
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+			if len(keys) == scanBatch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		return flush()
+	})
+	return deleted, err
+}
+
+// forEachNode runs fn against every cluster master, or once against the
+// single or sentinel-managed server
+func (c *Client) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.Cmdable) error) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	}
+	return fn(ctx, c.client)
+}
+
+// namespaceOf returns the longest namespace key belongs to, or OtherNamespace.
+// A key named exactly like a namespace (e.g. "maintenance") belongs to it.
+func namespaceOf(key string, namespaces []string) string {
+	match := OtherNamespace
+	for _, namespace := range namespaces {
+		inNamespace := key == namespace || strings.HasPrefix(key, namespace+":")
+		if inNamespace && (match == OtherNamespace || len(namespace) > len(match)) {
+			match = namespace
+		}
+	}
+	return match
+}
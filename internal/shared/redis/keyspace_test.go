@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testClient connects to an in-memory Redis seeded with keys
+func testClient(t *testing.T, keys ...string) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	for _, key := range keys {
+		srv.Set(key, "v")
+	}
+	c, err := New(context.Background(), Options{URL: "redis://" + srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, srv
+}
+
+func TestPurgeNamespaceRemovesOnlyItsKeys(t *testing.T) {
+	c, srv := testClient(t,
+		"cache:exact:abc", "cache:exact:def", "cache:exact:lock:abc",
+		"cache:exactly:abc", "cache:exact", "cache:semantic:abc",
+		"ratelimit:key-1:minute", "apikey:hash", "admin_nonce:n1",
+	)
+	srv.SetTTL("cache:exact:abc", time.Hour)
+
+	deleted, err := c.PurgeNamespace(context.Background(), "cache:exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted %d keys, want 3", deleted)
+	}
+	for _, key := range []string{"cache:exact:abc", "cache:exact:def", "cache:exact:lock:abc"} {
+		if srv.Exists(key) {
+			t.Errorf("%s survived the purge", key)
+		}
+	}
+	for _, key := range []string{"cache:exactly:abc", "cache:exact", "cache:semantic:abc", "ratelimit:key-1:minute", "apikey:hash", "admin_nonce:n1"} {
+		if !srv.Exists(key) {
+			t.Errorf("%s was purged with cache:exact", key)
+		}
+	}
+}
+
+func TestPurgeNamespaceDeletesAcrossScanBatches(t *testing.T) {
+	keys := []string{"ratelimit:keep"}
+	for i := 0; i < scanBatch*2+5; i++ {
+		keys = append(keys, "apikey:"+strconv.Itoa(i))
+	}
+	c, srv := testClient(t, keys...)
+
+	deleted, err := c.PurgeNamespace(context.Background(), "apikey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != int64(scanBatch*2+5) {
+		t.Errorf("deleted %d keys, want %d", deleted, scanBatch*2+5)
+	}
+	if got := srv.Keys(); len(got) != 1 || got[0] != "ratelimit:keep" {
+		t.Errorf("left %v, want only ratelimit:keep", got)
+	}
+}
+
+func TestKeyspaceUsageCountsPerNamespace(t *testing.T) {
+	c, _ := testClient(t,
+		"cache:exact:a", "cache:exact:b", "cache:exact:lock:a",
+		"ratelimit:k:minute", "ratelimit:ip:10.0.0.1:minute", "maintenance",
+		"stray", "cache:exactly:a", "maintenance_window",
+	)
+
+	usage, err := c.KeyspaceUsage(context.Background(), []string{"cache:exact", "cache:exact:lock", "ratelimit", "maintenance"}, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for namespace, want := range map[string]int64{"cache:exact": 2, "cache:exact:lock": 1, "ratelimit": 2, "maintenance": 1, OtherNamespace: 3} {
+		if got := usage[namespace].Keys; got != want {
+			t.Errorf("%s: %d keys, want %d", namespace, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Policy bounds how a transient failure is retried
+type Policy struct {
+	Retries int           // attempts after the first (0 = no retries)
+	Backoff time.Duration // wait before the first retry, doubled after each
+}
+
+// permanentError marks an error that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so Do returns it at once instead of retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, the retries run out or ctx is done, and
+// returns fn's last error. Context errors and errors wrapped with Permanent
+// are never retried; the latter are returned unwrapped.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	err := fn()
+	backoff := p.Backoff
+	for i := 0; err != nil && i < p.Retries; i++ {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = fn()
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return permanent.err
+	}
+	return err
+}
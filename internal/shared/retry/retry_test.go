@@ -0,0 +1,60 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBlip = errors.New("connection reset")
+
+func TestDoRetriesTransientErrorsUntilSuccess(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{Retries: 3, Backoff: time.Millisecond}, func() error {
+		calls++
+		if calls < 3 {
+			return errBlip
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on the third call, got %v after %d", err, calls)
+	}
+}
+
+func TestDoGivesUpAfterRetries(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{Retries: 2, Backoff: time.Millisecond}, func() error {
+		calls++
+		return errBlip
+	})
+	if !errors.Is(err, errBlip) || calls != 3 {
+		t.Errorf("expected the last error after 3 calls, got %v after %d", err, calls)
+	}
+}
+
+func TestDoReturnsPermanentErrorsAtOnce(t *testing.T) {
+	bad := errors.New("invalid input syntax for type uuid")
+	calls := 0
+	err := Do(context.Background(), Policy{Retries: 3, Backoff: time.Millisecond}, func() error {
+		calls++
+		return Permanent(bad)
+	})
+	if err != bad || calls != 1 {
+		t.Errorf("expected the unwrapped error after 1 call, got %v after %d", err, calls)
+	}
+}
+
+func TestDoStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, Policy{Retries: 5, Backoff: time.Hour}, func() error {
+		calls++
+		cancel()
+		return errBlip
+	})
+	if !errors.Is(err, errBlip) || calls != 1 {
+		t.Errorf("expected to stop after 1 call, got %v after %d", err, calls)
+	}
+}
@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - End-user tracking
+-- Stores the OpenAI-style `user` field for abuse monitoring and per-user analytics
+
+ALTER TABLE gateway_logs ADD COLUMN end_user VARCHAR(255);
+
+CREATE INDEX idx_gateway_logs_end_user ON gateway_logs(api_key_id, end_user);
@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Race mode
+-- Opt-in parallel dispatch to the primary and first failover model
+
+ALTER TABLE api_keys ADD COLUMN race_mode_enabled BOOLEAN DEFAULT false;
+
+ALTER TABLE gateway_logs ADD COLUMN race_used BOOLEAN DEFAULT false;
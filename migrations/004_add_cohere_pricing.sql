@@ -0,0 +1,8 @@
+-- LLM Gateway Starter - Cohere pricing
+
+INSERT INTO model_pricing (provider, model, input_per_1k_tokens, output_per_1k_tokens, context_window, supports_streaming) VALUES
+('cohere', 'command-a-03-2025', 0.0025, 0.01, 256000, true),
+('cohere', 'command-r-plus-08-2024', 0.0025, 0.01, 128000, true),
+('cohere', 'command-r-08-2024', 0.00015, 0.0006, 128000, true),
+('cohere', 'command-r7b-12-2024', 0.0000375, 0.00015, 128000, true)
+ON CONFLICT (provider, model) DO NOTHING;
@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Per-key concurrency limiting
+
+-- Maximum simultaneous in-flight requests (0 = unlimited)
+ALTER TABLE api_keys ADD COLUMN max_concurrent_requests INT DEFAULT 0;
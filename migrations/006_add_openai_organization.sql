@@ -0,0 +1,7 @@
+-- LLM Gateway Starter - OpenAI organization passthrough
+
+-- Default OpenAI organization for requests made with this key
+ALTER TABLE api_keys ADD COLUMN openai_organization VARCHAR(255);
+
+-- Organization the request was billed to
+ALTER TABLE gateway_logs ADD COLUMN organization VARCHAR(255);
@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Finish reason tracking
+
+-- OpenAI-style finish reason: stop, length, content_filter, tool_calls
+ALTER TABLE gateway_logs ADD COLUMN finish_reason VARCHAR(50);
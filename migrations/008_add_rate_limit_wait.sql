@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Rate limit queuing
+
+-- Max seconds a rate-limited request may wait for capacity (0 = reject immediately)
+ALTER TABLE api_keys ADD COLUMN rate_limit_wait_seconds INT DEFAULT 0;
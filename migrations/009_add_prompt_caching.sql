@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Provider-native prompt caching
+
+-- Mark static prompt prefixes with Anthropic cache_control for this key's requests
+ALTER TABLE api_keys ADD COLUMN prompt_caching_enabled BOOLEAN DEFAULT false;
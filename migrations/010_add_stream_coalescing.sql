@@ -0,0 +1,5 @@
+-- LLM Gateway Starter - Stream chunk coalescing
+
+-- Merge streamed text deltas until this many characters / milliseconds (0 = off)
+ALTER TABLE api_keys ADD COLUMN stream_coalesce_chars INT DEFAULT 0;
+ALTER TABLE api_keys ADD COLUMN stream_coalesce_ms INT DEFAULT 0;
@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Per-key output token cap
+
+-- Requested max_tokens above this are clamped (0 = unlimited)
+ALTER TABLE api_keys ADD COLUMN max_output_tokens INT DEFAULT 0;
@@ -0,0 +1,5 @@
+-- LLM Gateway Starter - Original vs served model on failover
+
+-- Requested model and the model that actually answered, when failover swapped them
+ALTER TABLE gateway_logs ADD COLUMN original_model VARCHAR(255);
+ALTER TABLE gateway_logs ADD COLUMN served_model VARCHAR(255);
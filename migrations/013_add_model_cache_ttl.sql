@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Per-model cache TTL
+
+-- Overrides the key's cache TTL for this model (NULL = no override, 0 = never cache)
+ALTER TABLE model_pricing ADD COLUMN cache_ttl_seconds INT;
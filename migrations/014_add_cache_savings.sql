@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Cache savings
+
+-- Cost the provider would have charged for a request served from cache (0 on a miss)
+ALTER TABLE gateway_logs ADD COLUMN cache_savings_usd DECIMAL(10,6) DEFAULT 0;
@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Client IP
+
+-- Real client address, resolved through trusted proxies
+ALTER TABLE gateway_logs ADD COLUMN client_ip VARCHAR(45);
@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Automatic model downgrade
+
+-- Serve the configured cheaper sibling while a model is being rate-limited upstream
+ALTER TABLE api_keys ADD COLUMN auto_downgrade_enabled BOOLEAN DEFAULT false;
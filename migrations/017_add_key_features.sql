@@ -0,0 +1,4 @@
+-- LLM Gateway Starter - Per-key feature flags
+
+-- Free-form flags for experimental behaviour, e.g. {"race_mode": true, "stream_resume_retries": 2}
+ALTER TABLE api_keys ADD COLUMN features JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,8 @@
+-- LLM Gateway Starter - Audio transcription pricing
+
+-- Duration-based price for audio models (NULL for token-priced models)
+ALTER TABLE model_pricing ADD COLUMN price_per_minute DECIMAL(10,6);
+
+INSERT INTO model_pricing (provider, model, input_per_1k_tokens, output_per_1k_tokens, context_window, supports_streaming, price_per_minute) VALUES
+('openai', 'whisper-1', 0, 0, 0, false, 0.006)
+ON CONFLICT (provider, model) DO NOTHING;
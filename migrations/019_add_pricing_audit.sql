@@ -0,0 +1,15 @@
+-- LLM Gateway Starter - Pricing sync audit
+
+-- One row per model_pricing insert or change applied by the pricing sync
+CREATE TABLE model_pricing_audit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(50) NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    action VARCHAR(10) NOT NULL,  -- 'insert' or 'update'
+    old_values JSONB,             -- NULL for inserts
+    new_values JSONB NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_model_pricing_audit_model ON model_pricing_audit(provider, model, created_at DESC);
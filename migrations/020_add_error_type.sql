@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Error classification
+
+-- Coarse error category (rate_limit, timeout, auth, server, ...) for aggregating failures
+ALTER TABLE gateway_logs ADD COLUMN error_type VARCHAR(32);
+
+CREATE INDEX idx_gateway_logs_error_type ON gateway_logs(error_type, created_at DESC) WHERE error_type IS NOT NULL;
@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Completion post-processing webhook
+
+-- Optional per-key webhook that may rewrite completions before they are returned.
+-- With fail_closed, a webhook failure fails the request instead of returning the original.
+ALTER TABLE api_keys ADD COLUMN postprocess_webhook_url TEXT;
+ALTER TABLE api_keys ADD COLUMN postprocess_fail_closed BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,21 @@
+-- LLM Gateway Starter - Server-side conversations
+
+-- Chat history kept by the gateway so clients can send only the new turn.
+-- A conversation is only visible to the API key that created it.
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_conversations_api_key ON conversations(api_key_id);
+
+CREATE TABLE conversation_messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    message JSONB NOT NULL,  -- OpenAI-format chat message
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_conversation_messages_conversation ON conversation_messages(conversation_id, id);
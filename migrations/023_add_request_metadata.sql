@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Request metadata
+
+-- Client-supplied tags (team, feature, env, ...) from the request's metadata field
+ALTER TABLE gateway_logs ADD COLUMN metadata JSONB;
+
+CREATE INDEX idx_gateway_logs_metadata ON gateway_logs USING GIN (metadata) WHERE metadata IS NOT NULL;
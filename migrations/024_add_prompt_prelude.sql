@@ -0,0 +1,7 @@
+-- LLM Gateway Starter - Per-key prompt prelude
+
+-- System prompt text added to every request from a key, before and after the
+-- client's own system messages. With override, the client's system messages are dropped.
+ALTER TABLE api_keys ADD COLUMN prompt_prelude TEXT;
+ALTER TABLE api_keys ADD COLUMN prompt_suffix TEXT;
+ALTER TABLE api_keys ADD COLUMN prompt_prelude_override BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Per-key Gemini safety settings
+
+-- Block thresholds sent to Gemini as safetySettings, as an object of harm
+-- category to threshold, e.g. {"HARM_CATEGORY_DANGEROUS_CONTENT": "BLOCK_ONLY_HIGH"}.
+-- A request's safety_settings override it per category. NULL = Gemini's defaults.
+ALTER TABLE api_keys ADD COLUMN gemini_safety_settings JSONB;
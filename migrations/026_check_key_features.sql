@@ -0,0 +1,6 @@
+-- LLM Gateway Starter - Require per-key feature flags to be an object
+
+-- Keys whose features aren't a JSON object run with no flags; reset them and
+-- reject such values from now on
+UPDATE api_keys SET features = '{}' WHERE jsonb_typeof(features) <> 'object';
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_features_object CHECK (jsonb_typeof(features) = 'object');
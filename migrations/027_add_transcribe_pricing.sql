@@ -0,0 +1,9 @@
+-- LLM Gateway Starter - gpt-4o transcription pricing
+
+-- These models report token usage rather than audio duration, so they're
+-- priced per token: input at the audio input rate (a prompt's few text tokens
+-- are billed lower by OpenAI), output at the text output rate
+INSERT INTO model_pricing (provider, model, input_per_1k_tokens, output_per_1k_tokens, context_window, supports_streaming, price_per_minute) VALUES
+('openai', 'gpt-4o-transcribe', 0.006, 0.01, 16000, false, NULL),
+('openai', 'gpt-4o-mini-transcribe', 0.003, 0.005, 16000, false, NULL)
+ON CONFLICT (provider, model) DO NOTHING;
@@ -0,0 +1,9 @@
+-- LLM Gateway Starter - Move race mode and auto-downgrade into per-key feature flags
+
+-- Keys that had either column on keep the behaviour through the flag, which
+-- the column used to override
+UPDATE api_keys SET features = features || '{"race_mode": true}' WHERE race_mode_enabled;
+UPDATE api_keys SET features = features || '{"auto_downgrade": true}' WHERE auto_downgrade_enabled;
+
+ALTER TABLE api_keys DROP COLUMN race_mode_enabled;
+ALTER TABLE api_keys DROP COLUMN auto_downgrade_enabled;
@@ -0,0 +1,21 @@
+-- LLM Gateway Starter - Weight sampled log rows so spend sums stay whole
+
+-- With LOG_SAMPLE_RATE below 1, each written row stands for 1/rate requests;
+-- rows written before sampling existed, and unsampled ones, count once
+ALTER TABLE gateway_logs ADD COLUMN sample_weight DOUBLE PRECISION NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION get_daily_spend(p_api_key_id UUID)
+RETURNS DECIMAL AS $$
+    SELECT COALESCE(SUM(cost_usd * sample_weight), 0)::DECIMAL
+    FROM gateway_logs
+    WHERE api_key_id = p_api_key_id
+      AND created_at >= date_trunc('day', NOW());
+$$ LANGUAGE SQL;
+
+CREATE OR REPLACE FUNCTION get_monthly_spend(p_api_key_id UUID)
+RETURNS DECIMAL AS $$
+    SELECT COALESCE(SUM(cost_usd * sample_weight), 0)::DECIMAL
+    FROM gateway_logs
+    WHERE api_key_id = p_api_key_id
+      AND created_at >= date_trunc('month', NOW());
+$$ LANGUAGE SQL;
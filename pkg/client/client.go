@@ -0,0 +1,198 @@
+// Package client is a typed Go client for the gateway's OpenAI-compatible API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a gateway instance
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// New creates a new gateway client
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 120 * time.Second,
+		},
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client
+func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// Meta holds the gateway metadata returned in response headers
+type Meta struct {
+	Provider  string
+	CacheHit  bool
+	CostUSD   float64
+	LatencyMs int
+	Failover  bool
+}
+
+// Result is a chat completion together with its gateway metadata
+type Result struct {
+	*ChatResponse
+	Meta Meta
+}
+
+// APIError is returned when the gateway responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gateway error (status %d): %s", e.StatusCode, e.Message)
+}
+
+// ChatCompletion sends a non-streaming chat completion request
+func (c *Client) ChatCompletion(ctx context.Context, req ChatRequest) (*Result, error) {
+	req.Stream = false
+
+	httpResp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp ChatResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &Result{
+		ChatResponse: &resp,
+		Meta:         parseMeta(httpResp.Header),
+	}, nil
+}
+
+// ChatCompletionStream sends a streaming chat completion request. The caller
+// must Close the returned stream.
+func (c *Client) ChatCompletionStream(ctx context.Context, req ChatRequest) (*Stream, error) {
+	req.Stream = true
+
+	httpResp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stream{
+		Meta:   parseMeta(httpResp.Header),
+		reader: bufio.NewReader(httpResp.Body),
+		body:   httpResp.Body,
+	}, nil
+}
+
+// do POSTs a chat request and returns the response if it succeeded
+func (c *Client) do(ctx context.Context, req ChatRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if req.Stream {
+		// The gateway serves stream:true as a single JSON body to Accept: application/json
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("gateway request failed: %w", err)
+	}
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		defer httpResp.Body.Close()
+		body, _ := io.ReadAll(httpResp.Body)
+		return nil, &APIError{
+			StatusCode: httpResp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+
+	return httpResp, nil
+}
+
+// parseMeta reads gateway metadata from response headers
+func parseMeta(header http.Header) Meta {
+	cost, _ := strconv.ParseFloat(header.Get("X-Cost-USD"), 64)
+	latency, _ := strconv.Atoi(header.Get("X-Latency-Ms"))
+
+	return Meta{
+		Provider:  header.Get("X-Provider"),
+		CacheHit:  header.Get("X-Cache-Hit") == "true",
+		CostUSD:   cost,
+		LatencyMs: latency,
+		Failover:  header.Get("X-Failover") == "true",
+	}
+}
+
+// Stream iterates over the chunks of a streaming response
+type Stream struct {
+	Meta Meta
+
+	reader *bufio.Reader
+	body   io.ReadCloser
+}
+
+// Recv returns the next chunk, or io.EOF once the stream is complete
+func (s *Stream) Recv() (StreamChunk, error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return StreamChunk{}, err
+		}
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return StreamChunk{}, io.EOF
+		}
+
+		// Mid-stream errors are sent as {"error": "..."}
+		var errEvent struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal([]byte(data), &errEvent) == nil && errEvent.Error != "" {
+			return StreamChunk{}, fmt.Errorf("stream error: %s", errEvent.Error)
+		}
+
+		var chunk StreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return StreamChunk{}, fmt.Errorf("failed to parse chunk: %w", err)
+		}
+		return chunk, nil
+	}
+}
+
+// Close closes the stream
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/alerts"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/cache"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/handlers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/postprocess"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/config"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/database"
+	"github.com/mrmushfiq/llm0-gateway-starter/internal/shared/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeOpenAI answers chat completions as OpenAI would, streamed or not
+func fakeOpenAI(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-1","object":"chat.completion","model":%q,"choices":[{"index":0,"message":{"role":"assistant","content":"Hello!"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000,"completion_tokens":500,"total_tokens":1500}}`, req.Model)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, content := range []string{"Hel", "lo!"} {
+		fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", req.Model, content)
+	}
+	fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n", req.Model)
+	fmt.Fprintf(w, "data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[],\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":500,\"total_tokens\":1500}}\n\n", req.Model)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// testGateway serves the real chat handler over a fake OpenAI upstream,
+// authenticating every request as one key and expecting lookups model_pricing queries
+func testGateway(t *testing.T, lookups int) *httptest.Server {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(fakeOpenAI))
+	t.Cleanup(upstream.Close)
+
+	cfg := &config.Config{
+		OpenAIAPIKey:       "sk-test",
+		ProviderRegions:    map[string][]string{"openai": {upstream.URL + "/v1"}},
+		CacheTTLSeconds:    3600,
+		CacheTTLMaxSeconds: 86400,
+	}
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	now := time.Now()
+	for i := 0; i < lookups; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM model_pricing")).WithArgs("openai", "gpt-4o-mini").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "provider", "model", "input", "output", "context_window", "supports_streaming", "cache_ttl_seconds", "price_per_minute", "created_at", "updated_at"}).
+				AddRow("p-1", "openai", "gpt-4o-mini", 0.00015, 0.0006, 128000, true, nil, 0.0, now, now))
+	}
+	db := database.FromConn(conn)
+	logs := database.NewLogWriter(db, database.LogWriterConfig{Workers: 1, FlushInterval: time.Hour})
+
+	chat := handlers.NewChatHandler(cfg, providers.NewManager(cfg, nil), cache.New(cache.NewMemoryBackend(0)), db, logs, alerts.New("", 0), nil, postprocess.New(time.Second))
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gw_test_abc123" {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+		key := &models.APIKey{ID: "key-1", RateLimitPerMinute: 100}
+		chat.HandleChatCompletion(w, r.WithContext(context.WithValue(r.Context(), "api_key", key)))
+	}))
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func helloRequest() ChatRequest {
+	return ChatRequest{
+		Model:    "gpt-4o-mini",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hello!"}},
+	}
+}
+
+func TestChatCompletionReadsGatewayMetadata(t *testing.T) {
+	c := New(testGateway(t, 1).URL, "gw_test_abc123")
+
+	result, err := c.ChatCompletion(context.Background(), helloRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Choices[0].Message.Content != "Hello!" || result.Usage.TotalTokens != 1500 {
+		t.Errorf("unexpected completion %+v", result.ChatResponse)
+	}
+	// 1k prompt tokens at $0.00015 + 0.5k completion tokens at $0.0006
+	if result.Meta.Provider != "openai" || result.Meta.CacheHit || result.Meta.CostUSD != 0.00045 {
+		t.Errorf("unexpected metadata %+v", result.Meta)
+	}
+}
+
+func TestChatCompletionStreamYieldsChunksUntilEOF(t *testing.T) {
+	// A stream looks the model up to check it streams, for its context-window headers and for its cost
+	c := New(testGateway(t, 3).URL, "gw_test_abc123")
+
+	stream, err := c.ChatCompletionStream(context.Background(), helloRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	var content string
+	var cost *float64
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+		}
+		if chunk.CostUSD != nil {
+			cost = chunk.CostUSD
+		}
+	}
+	if content != "Hello!" {
+		t.Errorf("streamed %q", content)
+	}
+	if cost == nil || *cost != 0.00045 {
+		t.Errorf("expected the final chunk to carry the cost, got %v", cost)
+	}
+}
+
+func TestChatCompletionReturnsAPIError(t *testing.T) {
+	c := New(testGateway(t, 0).URL, "gw_wrong")
+
+	_, err := c.ChatCompletion(context.Background(), helloRequest())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "invalid API key" {
+		t.Errorf("expected a 401 APIError, got %v", err)
+	}
+}
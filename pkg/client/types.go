@@ -0,0 +1,18 @@
+package client
+
+import "github.com/mrmushfiq/llm0-gateway-starter/internal/gateway/providers"
+
+// Request and response types are shared with the gateway itself, so every
+// field the gateway accepts is available here. The types they nest are
+// aliased too, so callers can name them.
+type (
+	ChatRequest  = providers.ChatRequest
+	ChatResponse = providers.ChatResponse
+	StreamChunk  = providers.StreamChunk
+
+	StopSequences    = providers.StopSequences
+	ThinkingConfig   = providers.ThinkingConfig
+	ResponseFormat   = providers.ResponseFormat
+	JSONSchemaFormat = providers.JSONSchemaFormat
+	SafetySetting    = providers.SafetySetting
+)
@@ -64,11 +64,13 @@ if command -v docker &> /dev/null; then
     # Run migrations
     echo ""
     echo "5️⃣  Running database migrations..."
-    docker exec -i gateway_postgres psql -U gateway -d gateway < migrations/001_initial_schema.sql
+    for migration in migrations/*.sql; do
+        docker exec -i gateway_postgres psql -U gateway -d gateway < "$migration"
+    done
     echo "   ✓ Migrations applied"
 else
     echo "   ⚠️  Docker not available. Please start PostgreSQL and Redis manually."
-    echo "   Then run: psql \$DATABASE_URL -f migrations/001_initial_schema.sql"
+    echo "   Then run: for f in migrations/*.sql; do psql \$DATABASE_URL -f \$f; done"
 fi
 
 echo ""